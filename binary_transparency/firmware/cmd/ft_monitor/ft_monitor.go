@@ -25,14 +25,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_monitor/impl"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/serverless/client"
 	"golang.org/x/mod/sumdb/note"
+
+	slapi "github.com/google/trillian-examples/serverless/api"
 )
 
 var (
@@ -41,15 +50,35 @@ var (
 	keyWord      = flag.String("keyword", "trojan", "Example keyword for malware")
 	annotate     = flag.Bool("annotate", false, "If true then this will add annotations to the log in addition to local logging")
 	stateFile    = flag.String("state_file", "", "Filepath to persist monitor state to")
+	smtpServer   = flag.String("smtp_server", "", "If set, host:port of an SMTP server through which to email alerts")
+	smtpUser     = flag.String("smtp_user", "", "User to authenticate to the SMTP server as, with the password in the SMTP_PASSWORD environment variable")
+	smtpFrom     = flag.String("smtp_from", "", "Sender address of alert emails")
+	smtpTo       = flag.String("smtp_to", "", "Comma separated list of addresses to email alerts to")
+	slackWebhook = flag.String("slack_webhook", "", "If set, URL of a Slack incoming webhook to post alerts to")
+	alertWebhook = flag.String("alert_webhook", "", "If set, URL to post alerts to as JSON objects with subject and body fields")
+	logList      = flag.String("log_list", "", "If set, file containing a signed serverless log list, whose entry for the FT log gives its URL and key in place of --ftlog and the test key")
+	logListName  = flag.String("log_list_name", "", "Expected name of the log list given by --log_list")
+	logListKey   = flag.String("log_list_public_key", "", "File containing the public key of the maintainer of the log list given by --log_list")
 )
 
 func main() {
 	flag.Parse()
 
-	testLogSigV, _ := note.NewVerifier(crypto.TestFTPersonalityPub)
+	logURL := *ftLog
+	logSigV, _ := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if len(*logList) > 0 {
+		e, err := logListEntry()
+		if err != nil {
+			glog.Exitf("Failed to load log list: %v", err)
+		}
+		if logSigV, _, err = client.LogVerifiers(*e); err != nil {
+			glog.Exitf("Invalid log list: %v", err)
+		}
+		logURL = e.URL
+	}
 
 	if err := impl.Main(context.Background(), impl.MonitorOpts{
-		LogURL:       *ftLog,
+		LogURL:       logURL,
 		PollInterval: *pollInterval,
 		Keyword:      *keyWord,
 		Matched: func(idx uint64, fw api.FirmwareMetadata) {
@@ -57,8 +86,65 @@ func main() {
 		},
 		Annotate:       *annotate,
 		StateFile:      *stateFile,
-		LogSigVerifier: testLogSigV,
+		LogSigVerifier: logSigV,
+		Alerts:         alertSinks(),
 	}); err != nil {
 		glog.Exitf(err.Error())
 	}
 }
+
+// logListEntry returns the FT log's entry in the log list given by
+// --log_list. The monitor doesn't check witness signatures, so the entry's
+// witness policy is ignored.
+func logListEntry() (*slapi.LogListEntry, error) {
+	if len(*logListKey) == 0 || len(*logListName) == 0 {
+		return nil, errors.New("--log_list_public_key and --log_list_name must be set with --log_list")
+	}
+	k, err := os.ReadFile(*logListKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log list public key: %v", err)
+	}
+	v, err := note.NewVerifier(strings.TrimSpace(string(k)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log list public key: %v", err)
+	}
+	raw, err := os.ReadFile(*logList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log list: %v", err)
+	}
+	l, err := client.OpenLogList(raw, v, *logListName)
+	if err != nil {
+		return nil, err
+	}
+	e := l.Find(api.FTLogOrigin)
+	if e == nil {
+		return nil, fmt.Errorf("log list %q has no log with origin %q", l.Name, api.FTLogOrigin)
+	}
+	return e, nil
+}
+
+// alertSinks returns the alert sinks configured by flags.
+func alertSinks() []impl.AlertSink {
+	var sinks []impl.AlertSink
+	if len(*smtpServer) > 0 {
+		if len(*smtpFrom) == 0 || len(*smtpTo) == 0 {
+			glog.Exit("--smtp_from and --smtp_to must be set with --smtp_server")
+		}
+		s := impl.SMTPSink{Addr: *smtpServer, From: *smtpFrom, To: strings.Split(*smtpTo, ",")}
+		if len(*smtpUser) > 0 {
+			host, _, err := net.SplitHostPort(*smtpServer)
+			if err != nil {
+				glog.Exitf("Invalid --smtp_server: %v", err)
+			}
+			s.Auth = smtp.PlainAuth("", *smtpUser, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		sinks = append(sinks, s)
+	}
+	if len(*slackWebhook) > 0 {
+		sinks = append(sinks, impl.SlackSink{WebhookURL: *slackWebhook})
+	}
+	if len(*alertWebhook) > 0 {
+		sinks = append(sinks, impl.WebhookSink{URL: *alertWebhook})
+	}
+	return sinks
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Alert describes something found by the monitor which needs a human to look
+// at it, such as a keyword match or an inconsistent log.
+type Alert struct {
+	// Subject is a one line summary of the alert.
+	Subject string `json:"subject"`
+	// Body holds the details of the alert.
+	Body string `json:"body"`
+}
+
+// AlertSink delivers alerts to a human.
+type AlertSink interface {
+	// Send delivers a, returning an error if it couldn't be.
+	Send(ctx context.Context, a Alert) error
+}
+
+// sendAlert delivers a to each of the sinks. Failures are only logged, so
+// that one broken sink doesn't stop the others, or the monitor.
+func sendAlert(ctx context.Context, sinks []AlertSink, a Alert) {
+	for _, s := range sinks {
+		if err := s.Send(ctx, a); err != nil {
+			glog.Warningf("Failed to send alert %q: %v", a.Subject, err)
+		}
+	}
+}
+
+// SMTPSink sends alerts by email.
+type SMTPSink struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// Auth, if set, is used to authenticate to the server.
+	Auth smtp.Auth
+	// From is the sender's address.
+	From string
+	// To holds the recipients' addresses.
+	To []string
+}
+
+// Send sends a as an email to each of the recipients.
+func (s SMTPSink) Send(_ context.Context, a Alert) error {
+	if err := smtp.SendMail(s.Addr, s.Auth, s.From, s.To, s.message(a)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// message returns the email for a, in the format expected by smtp.SendMail.
+func (s SMTPSink) message(a Alert) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\n", s.From)
+	fmt.Fprintf(b, "To: %s\r\n", strings.Join(s.To, ", "))
+	// Newlines in the subject would start new headers.
+	fmt.Fprintf(b, "Subject: %s\r\n", strings.Join(strings.Fields(a.Subject), " "))
+	fmt.Fprintf(b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(b, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(a.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// SlackSink posts alerts to a Slack channel through an incoming webhook.
+type SlackSink struct {
+	// WebhookURL is the URL of the incoming webhook.
+	WebhookURL string
+	// Client is used to make requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Send posts a as a message to the webhook's channel.
+func (s SlackSink) Send(ctx context.Context, a Alert) error {
+	msg := struct {
+		Text string `json:"text"`
+	}{
+		Text: fmt.Sprintf("*%s*\n%s", a.Subject, a.Body),
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, msg)
+}
+
+// WebhookSink posts alerts as JSON objects with subject and body fields to a
+// URL, for delivery by any alerting system which accepts webhooks.
+type WebhookSink struct {
+	// URL is the URL to post alerts to.
+	URL string
+	// Client is used to make requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Send posts a to the webhook.
+func (s WebhookSink) Send(ctx context.Context, a Alert) error {
+	return postJSON(ctx, s.Client, s.URL, a)
+}
+
+// postJSON posts v, encoded as JSON, to u, and checks that it was accepted.
+func postJSON(ctx context.Context, c *http.Client, u string, v interface{}) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %s: %q", resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookSinks(t *testing.T) {
+	ctx := context.Background()
+	a := Alert{Subject: "Malware detected at log index 3", Body: "Keyword: \"trojan\""}
+	for _, test := range []struct {
+		desc    string
+		sink    func(url string) AlertSink
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{
+			desc:   "webhook",
+			sink:   func(u string) AlertSink { return WebhookSink{URL: u} },
+			status: http.StatusOK,
+			want:   `{"subject":"Malware detected at log index 3","body":"Keyword: \"trojan\""}`,
+		}, {
+			desc:   "slack",
+			sink:   func(u string) AlertSink { return SlackSink{WebhookURL: u} },
+			status: http.StatusOK,
+			want:   `{"text":"*Malware detected at log index 3*\nKeyword: \"trojan\""}`,
+		}, {
+			desc:    "rejected",
+			sink:    func(u string) AlertSink { return WebhookSink{URL: u} },
+			status:  http.StatusBadRequest,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got []byte
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q, want application/json", ct)
+				}
+				got, _ = io.ReadAll(r.Body)
+				w.WriteHeader(test.status)
+			}))
+			defer s.Close()
+
+			err := test.sink(s.URL).Send(ctx, a)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Send: %v, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !json.Valid(got) || string(got) != test.want {
+				t.Errorf("Posted %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSMTPMessage(t *testing.T) {
+	s := SMTPSink{From: "monitor@example.com", To: []string{"a@example.com", "b@example.com"}}
+	got := string(s.message(Alert{Subject: "Log checkpoints\nBcc: x@example.com", Body: "line 1\nline 2"}))
+	for _, want := range []string{
+		"From: monitor@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: Log checkpoints Bcc: x@example.com\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Message %q doesn't contain %q", got, want)
+		}
+	}
+}
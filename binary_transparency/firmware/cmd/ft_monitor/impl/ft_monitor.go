@@ -52,8 +52,15 @@ type MonitorOpts struct {
 	Matched        MatchFunc
 	Annotate       bool
 	StateFile      string
+	// Alerts, if set, are sent alerts for keyword matches, and for any
+	// inconsistency found in the log or its contents.
+	Alerts []AlertSink
 }
 
+// errImageMismatch is returned when a firmware image doesn't have the hash
+// logged for it.
+var errImageMismatch = errors.New("downloaded image does not match SHA512 in metadata")
+
 // Main runs the monitor until the context is canceled.
 func Main(ctx context.Context, opts MonitorOpts) error {
 	if len(opts.LogURL) == 0 {
@@ -102,17 +109,25 @@ func Main(ctx context.Context, opts MonitorOpts) error {
 		var entry client.LogEntry
 		select {
 		case err = <-cperrc:
+			alertFollowError(ctx, opts, err)
 			return err
 		case err = <-eerrc:
+			alertFollowError(ctx, opts, err)
 			return err
 		case <-ctx.Done():
 			return ctx.Err()
 		case entry = <-ec:
 		}
 
-		if err := processEntry(entry, c, opts, matcher); err != nil {
+		if err := processEntry(ctx, entry, c, opts, matcher); err != nil {
 			// TODO(mhutchinson): Consider a flag that causes processing errors to hard-fail.
 			glog.Warningf("Warning processing entry at index %d: %q", entry.Index, err)
+			if errors.Is(err, errImageMismatch) {
+				sendAlert(ctx, opts.Alerts, Alert{
+					Subject: fmt.Sprintf("Firmware image at log index %d doesn't match its metadata", entry.Index),
+					Body:    fmt.Sprintf("Log: %s\nError: %v", opts.LogURL, err),
+				})
+			}
 		}
 
 		if entry.Index == entry.Root.Size-1 {
@@ -123,7 +138,27 @@ func Main(ctx context.Context, opts MonitorOpts) error {
 	}
 }
 
-func processEntry(entry client.LogEntry, c client.ReadonlyClient, opts MonitorOpts, matcher *regexp.Regexp) error {
+// alertFollowError alerts about err, which stopped the monitor from following
+// the log, unless it was caused by ctx being done.
+func alertFollowError(ctx context.Context, opts MonitorOpts, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	subject := "Monitor stopped following the log"
+	var ec client.ErrConsistency
+	var ei client.ErrInclusion
+	if errors.As(err, &ec) {
+		subject = "Log checkpoints are inconsistent"
+	} else if errors.As(err, &ei) {
+		subject = fmt.Sprintf("Log entry %d isn't included under its checkpoint", ei.Proof.LeafIndex)
+	}
+	sendAlert(ctx, opts.Alerts, Alert{
+		Subject: subject,
+		Body:    fmt.Sprintf("Log: %s\nError: %v", opts.LogURL, err),
+	})
+}
+
+func processEntry(ctx context.Context, entry client.LogEntry, c client.ReadonlyClient, opts MonitorOpts, matcher *regexp.Regexp) error {
 	stmt := entry.Value
 	if stmt.Type != api.FirmwareMetadataType {
 		// Only analyze firmware statements in the monitor.
@@ -146,7 +181,7 @@ func processEntry(entry client.LogEntry, c client.ReadonlyClient, opts MonitorOp
 	// Verify Image Hash from log Manifest matches the actual image hash
 	h := sha512.Sum512(image)
 	if !bytes.Equal(h[:], meta.FirmwareImageSHA512) {
-		return fmt.Errorf("downloaded image does not match SHA512 in metadata (%x != %x)", h[:], meta.FirmwareImageSHA512)
+		return fmt.Errorf("%w (%x != %x)", errImageMismatch, h[:], meta.FirmwareImageSHA512)
 	}
 	glog.V(1).Infof("Image Hash Verified for image at leaf index %d", entry.Index)
 
@@ -155,6 +190,10 @@ func processEntry(entry client.LogEntry, c client.ReadonlyClient, opts MonitorOp
 
 	if malwareDetected {
 		opts.Matched(entry.Index, meta)
+		sendAlert(ctx, opts.Alerts, Alert{
+			Subject: fmt.Sprintf("Malware detected at log index %d", entry.Index),
+			Body:    fmt.Sprintf("Log: %s\nKeyword: %q\nFirmware: %v", opts.LogURL, opts.Keyword, meta),
+		})
 	}
 	if opts.Annotate {
 		ms := api.MalwareStatement{
@@ -24,6 +24,7 @@ require (
 	golang.org/x/mod v0.9.0
 	golang.org/x/oauth2 v0.6.0
 	golang.org/x/sync v0.1.0
+	golang.org/x/sys v0.6.0
 	google.golang.org/grpc v1.54.0
 	google.golang.org/protobuf v1.30.0
 	gopkg.in/yaml.v2 v2.4.0
@@ -31,7 +32,11 @@ require (
 	gvisor.dev/gvisor v0.0.0-20220920171436-4e7fd140e8d0
 )
 
-require github.com/transparency-dev/formats v0.0.0-20230124125735-2da9e2580a26
+require (
+	github.com/nats-io/nats.go v1.24.0
+	github.com/segmentio/kafka-go v0.4.35
+	github.com/transparency-dev/formats v0.0.0-20230124125735-2da9e2580a26
+)
 
 require (
 	bitbucket.org/creachadair/shell v0.0.7 // indirect
@@ -53,10 +58,13 @@ require (
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.2.1 // indirect
 	github.com/googleapis/gax-go/v2 v2.7.0 // indirect
+	github.com/klauspost/compress v1.15.7 // indirect
+	github.com/nats-io/nkeys v0.3.0 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/vmihailenco/msgpack v4.0.4+incompatible // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/net v0.8.0 // indirect
-	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
 	golang.org/x/time v0.0.0-20220411224347-583f2d630306 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
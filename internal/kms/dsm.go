@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// dsm is a Fortanix DSM key.
+type dsm struct {
+	endpoint string
+	apiKey   string
+	name     string
+}
+
+func newDSM(name string) (*dsm, error) {
+	apiKey := os.Getenv("FORTANIX_API_KEY")
+	if len(apiKey) == 0 {
+		return nil, errors.New("FORTANIX_API_KEY is not set")
+	}
+	endpoint := os.Getenv("FORTANIX_API_ENDPOINT")
+	if len(endpoint) == 0 {
+		endpoint = "https://sdkms.fortanix.com"
+	}
+	return &dsm{endpoint: strings.TrimSuffix(endpoint, "/"), apiKey: apiKey, name: name}, nil
+}
+
+// session calls f with the authorization header of a new session, which is
+// ended afterwards.
+func (d *dsm) session(ctx context.Context, f func(h http.Header) error) error {
+	var auth struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(ctx, http.MethodPost, d.endpoint+"/sys/v1/session/auth", http.Header{"Authorization": {"Basic " + d.apiKey}}, nil, &auth); err != nil {
+		return err
+	}
+	h := http.Header{"Authorization": {"Bearer " + auth.AccessToken}}
+	defer func() {
+		_ = doJSON(ctx, http.MethodPost, d.endpoint+"/sys/v1/session/terminate", h, nil, nil)
+	}()
+	return f(h)
+}
+
+func (d *dsm) publicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	var sobj struct {
+		EllipticCurve string `json:"elliptic_curve"`
+		PubKey        []byte `json:"pub_key"`
+	}
+	if err := d.session(ctx, func(h http.Header) error {
+		return doJSON(ctx, http.MethodPost, d.endpoint+"/crypto/v1/keys/info", h, map[string]string{"name": d.name}, &sobj)
+	}); err != nil {
+		return nil, err
+	}
+	if sobj.EllipticCurve != "Ed25519" {
+		return nil, errors.New("key isn't an Ed25519 key")
+	}
+	return parsePKIX(sobj.PubKey)
+}
+
+func (d *dsm) sign(ctx context.Context, msg []byte) ([]byte, error) {
+	// Ed25519 keys sign the data itself, with the SHA-512 hash which is part
+	// of the algorithm.
+	req := struct {
+		Key     map[string]string `json:"key"`
+		HashAlg string            `json:"hash_alg"`
+		Data    []byte            `json:"data"`
+	}{Key: map[string]string{"name": d.name}, HashAlg: "SHA512", Data: msg}
+	var rsp struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := d.session(ctx, func(h http.Header) error {
+		return doJSON(ctx, http.MethodPost, d.endpoint+"/crypto/v1/sign", h, req, &rsp)
+	}); err != nil {
+		return nil, err
+	}
+	return rsp.Signature, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	// gcpEndpoint is the base URL of the Cloud KMS API, replaced in tests.
+	gcpEndpoint = "https://cloudkms.googleapis.com/v1/"
+	// gcpTokenSource returns the credentials for GCP, replaced in tests.
+	gcpTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+		return google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloudkms")
+	}
+)
+
+// gcp is a Cloud KMS key version.
+type gcp struct {
+	name string
+	ts   oauth2.TokenSource
+}
+
+func newGCP(ctx context.Context, name string) (*gcp, error) {
+	ts, err := gcpTokenSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find GCP credentials: %w", err)
+	}
+	return &gcp{name: name, ts: ts}, nil
+}
+
+func (g *gcp) header() (http.Header, error) {
+	tok, err := g.ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCP token: %w", err)
+	}
+	return http.Header{"Authorization": {tok.Type() + " " + tok.AccessToken}}, nil
+}
+
+func (g *gcp) publicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	h, err := g.header()
+	if err != nil {
+		return nil, err
+	}
+	var rsp struct {
+		PEM       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := doJSON(ctx, http.MethodGet, gcpEndpoint+g.name+"/publicKey", h, nil, &rsp); err != nil {
+		return nil, err
+	}
+	if rsp.Algorithm != "EC_SIGN_ED25519" {
+		return nil, fmt.Errorf("key has algorithm %s, want EC_SIGN_ED25519", rsp.Algorithm)
+	}
+	b, _ := pem.Decode([]byte(rsp.PEM))
+	if b == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+	return parsePKIX(b.Bytes)
+}
+
+func (g *gcp) sign(ctx context.Context, msg []byte) ([]byte, error) {
+	h, err := g.header()
+	if err != nil {
+		return nil, err
+	}
+	// Ed25519 keys sign the message itself, rather than a digest of it.
+	req := struct {
+		Data []byte `json:"data"`
+	}{Data: msg}
+	var rsp struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := doJSON(ctx, http.MethodPost, gcpEndpoint+g.name+":asymmetricSign", h, req, &rsp); err != nil {
+		return nil, err
+	}
+	return rsp.Signature, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kms provides note signers whose private keys are held in a KMS or
+// HSM, so that log and witness keys never leave it.
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// signTimeout bounds each request to sign a note.
+const signTimeout = 30 * time.Second
+
+// backend makes raw Ed25519 signatures with a key held in a KMS.
+type backend interface {
+	// publicKey returns the public key of the KMS key.
+	publicKey(ctx context.Context) (ed25519.PublicKey, error)
+	// sign returns the Ed25519 signature of msg.
+	sign(ctx context.Context, msg []byte) ([]byte, error)
+}
+
+// NewSigner returns a signer using the Ed25519 key with the given URI, which
+// has the note verifier key vkey, either an Ed25519 or a cosignature/v1 key.
+// The URI is one of:
+//
+//   - gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>,
+//     a GCP Cloud KMS EC_SIGN_ED25519 key version, using application default
+//     credentials.
+//   - dsm://<name>, a Fortanix DSM Ed25519 key, using the API key in
+//     FORTANIX_API_KEY and the cluster at FORTANIX_API_ENDPOINT.
+//
+// The KMS key's public key is checked against vkey before it's used.
+func NewSigner(ctx context.Context, uri, vkey string) (note.Signer, error) {
+	scheme, name, ok := strings.Cut(uri, "://")
+	if !ok || len(name) == 0 {
+		return nil, fmt.Errorf("invalid KMS key URI %q", uri)
+	}
+	var b backend
+	var err error
+	switch scheme {
+	case "gcpkms":
+		b, err = newGCP(ctx, name)
+	case "dsm":
+		b, err = newDSM(name)
+	default:
+		return nil, fmt.Errorf("unknown KMS %q, want gcpkms or dsm", scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The verifier key may be in any of the forms accepted by
+	// ConvertVerifierKey.
+	vkey, err = i_note.ConvertVerifierKey(vkey, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+	v, err := i_note.NewVerifierForKey(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+	pub, err := b.publicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key of %s: %w", uri, err)
+	}
+	if want := publicKeyOf(vkey); !bytes.Equal(pub, want) {
+		return nil, fmt.Errorf("public key of %s doesn't match verifier key %s", uri, v.Name())
+	}
+	return i_note.NewExternalSigner(vkey, func(msg []byte) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+		defer cancel()
+		sig, err := b.sign(ctx, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign with %s: %w", uri, err)
+		}
+		return sig, nil
+	})
+}
+
+// publicKeyOf returns the Ed25519 public key in the verifier key vkey, which
+// has already been checked to be valid.
+func publicKeyOf(vkey string) ed25519.PublicKey {
+	parts := strings.SplitN(vkey, "+", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	k, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(k) != 1+ed25519.PublicKeySize {
+		return nil
+	}
+	return k[1:]
+}
+
+// parsePKIX returns the Ed25519 public key in the DER-encoded PKIX public key
+// der.
+func parsePKIX(der []byte) (ed25519.PublicKey, error) {
+	pk, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	pub, ok := pk.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key is a %T, not an Ed25519 key", pk)
+	}
+	return pub, nil
+}
+
+// doJSON sends a request with the given JSON body, if it's not nil, and
+// decodes the JSON response into resp.
+func doJSON(ctx context.Context, method, url string, header http.Header, body, resp interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	raw, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", rsp.Status, strings.TrimSpace(string(raw)))
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/oauth2"
+)
+
+const gcpKey = "projects/p/locations/global/keyRings/r/cryptoKeys/witness/cryptoKeyVersions/1"
+
+// fakeGCP serves the Cloud KMS API for a single key version.
+func fakeGCP(t *testing.T, priv ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/" + gcpKey + "/publicKey":
+			json.NewEncoder(w).Encode(map[string]string{
+				"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+				"algorithm": "EC_SIGN_ED25519",
+			})
+		case "/" + gcpKey + ":asymmetricSign":
+			var req struct{ Data []byte }
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string][]byte{"signature": ed25519.Sign(priv, req.Data)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// fakeDSM serves the Fortanix DSM API for a single key named "witness".
+func fakeDSM(t *testing.T, priv ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sys/v1/session/auth" {
+			if r.Header.Get("Authorization") != "Basic apikey" {
+				http.Error(w, "bad API key", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Name string
+			Key  struct{ Name string }
+			Data []byte
+		}
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		switch r.URL.Path {
+		case "/sys/v1/session/terminate":
+		case "/crypto/v1/keys/info":
+			if req.Name != "witness" {
+				http.Error(w, "sobject not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"elliptic_curve": "Ed25519", "pub_key": der})
+		case "/crypto/v1/sign":
+			if req.Key.Name != "witness" {
+				http.Error(w, "sobject not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string][]byte{"signature": ed25519.Sign(priv, req.Data)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestNewSigner(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherVKey, err := i_note.GenerateCosignatureV1Key(rand.Reader, "witness.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gs := fakeGCP(t, priv)
+	defer gs.Close()
+	defer func(e string, ts func(context.Context) (oauth2.TokenSource, error)) {
+		gcpEndpoint, gcpTokenSource = e, ts
+	}(gcpEndpoint, gcpTokenSource)
+	gcpEndpoint = gs.URL + "/"
+	gcpTokenSource = func(context.Context) (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token", TokenType: "Bearer"}), nil
+	}
+	ds := fakeDSM(t, priv)
+	defer ds.Close()
+	t.Setenv("FORTANIX_API_ENDPOINT", ds.URL)
+	t.Setenv("FORTANIX_API_KEY", "apikey")
+
+	for _, test := range []struct {
+		desc    string
+		uri     string
+		vkey    string
+		wantErr bool
+	}{
+		{desc: "GCP Ed25519", uri: "gcpkms://" + gcpKey, vkey: vkey(t, "log.example.com", 1, pub)},
+		{desc: "GCP cosignature/v1", uri: "gcpkms://" + gcpKey, vkey: vkey(t, "witness.example.com", 4, pub)},
+		{desc: "DSM Ed25519", uri: "dsm://witness", vkey: vkey(t, "log.example.com", 1, pub)},
+		{desc: "DSM cosignature/v1", uri: "dsm://witness", vkey: vkey(t, "witness.example.com", 4, pub)},
+		{desc: "wrong key", uri: "dsm://witness", vkey: otherVKey, wantErr: true},
+		{desc: "missing key", uri: "dsm://other", vkey: vkey(t, "log.example.com", 1, pub), wantErr: true},
+		{desc: "unknown KMS", uri: "pkcs11://token/witness", vkey: vkey(t, "log.example.com", 1, pub), wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			s, err := NewSigner(ctx, test.uri, test.vkey)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("NewSigner: %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			v, err := i_note.NewVerifierForKey(test.vkey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := note.Sign(&note.Note{Text: "log.example.com\n1\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n"}, s)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := note.Open(msg, note.VerifierList(v)); err != nil {
+				t.Errorf("Open: %v", err)
+			}
+		})
+	}
+}
+
+// vkey returns the note verifier key with the given name, algorithm and
+// Ed25519 public key.
+func vkey(t *testing.T, name string, alg byte, pub ed25519.PublicKey) string {
+	t.Helper()
+	k := append([]byte{alg}, pub...)
+	h := sha256.Sum256(append([]byte(name+"\n"), k...))
+	return fmt.Sprintf("%s+%08x+%s", name, binary.BigEndian.Uint32(h[:]), base64.StdEncoding.EncodeToString(k))
+}
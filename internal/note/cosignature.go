@@ -0,0 +1,231 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	sdb_note "golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// CosignatureV1 is a timestamped Ed25519 signature over a checkpoint, in
+	// the cosignature/v1 format used by witnesses, which commits to when the
+	// checkpoint was signed.
+	CosignatureV1 = "cosignature/v1"
+
+	algCosignatureV1   = 4
+	cosignatureV1Label = "cosignature/v1\n"
+	privateKeyPrefix   = "PRIVATE+KEY+"
+)
+
+// timeNow is the clock used by cosignature/v1 signers, replaced in tests.
+var timeNow = time.Now
+
+// GenerateCosignatureV1Key generates a signer and verifier key pair for
+// cosignature/v1 signatures, in the same text form as note.GenerateKey.
+func GenerateCosignatureV1Key(rand io.Reader, name string) (skey, vkey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return "", "", err
+	}
+	pubKey := append([]byte{algCosignatureV1}, pub...)
+	privKey := append([]byte{algCosignatureV1}, priv.Seed()...)
+	h := noteKeyHash(name, pubKey)
+	skey = fmt.Sprintf("%s%s+%08x+%s", privateKeyPrefix, name, h, base64.StdEncoding.EncodeToString(privKey))
+	vkey = fmt.Sprintf("%s+%08x+%s", name, h, base64.StdEncoding.EncodeToString(pubKey))
+	return skey, vkey, nil
+}
+
+// NewCosignatureV1Signer returns a signer which makes cosignature/v1
+// signatures over checkpoints with the given signer key, as generated by
+// GenerateCosignatureV1Key. Each signature commits to the time it was made.
+func NewCosignatureV1Signer(skey string) (sdb_note.Signer, error) {
+	if !strings.HasPrefix(skey, privateKeyPrefix) {
+		return nil, errors.New("invalid signer key")
+	}
+	name, h, key, err := parseKey(strings.TrimPrefix(skey, privateKeyPrefix), algCosignatureV1)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.SeedSize {
+		return nil, errors.New("invalid signer key")
+	}
+	priv := ed25519.NewKeyFromSeed(key)
+	pubKey := append([]byte{algCosignatureV1}, priv.Public().(ed25519.PublicKey)...)
+	if noteKeyHash(name, pubKey) != h {
+		return nil, errors.New("invalid signer key hash")
+	}
+	return &signer{
+		name:    name,
+		keyHash: h,
+		sign: func(msg []byte) ([]byte, error) {
+			ts := uint64(timeNow().Unix())
+			sig := make([]byte, 8, 8+ed25519.SignatureSize)
+			binary.BigEndian.PutUint64(sig, ts)
+			return append(sig, ed25519.Sign(priv, cosignatureV1Message(ts, msg))...), nil
+		},
+	}, nil
+}
+
+// NewCosignatureV1Verifier returns a verifier of cosignature/v1 signatures
+// made with the key matching the given verifier key.
+func NewCosignatureV1Verifier(vkey string) (sdb_note.Verifier, error) {
+	name, h, key, err := parseKey(vkey, algCosignatureV1)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid verifier key")
+	}
+	if noteKeyHash(name, append([]byte{algCosignatureV1}, key...)) != h {
+		return nil, errors.New("invalid verifier key hash")
+	}
+	pub := ed25519.PublicKey(key)
+	return &verifier{
+		name:    name,
+		keyHash: h,
+		v: func(msg, sig []byte) bool {
+			if len(sig) != 8+ed25519.SignatureSize {
+				return false
+			}
+			ts := binary.BigEndian.Uint64(sig)
+			return ed25519.Verify(pub, cosignatureV1Message(ts, msg), sig[8:])
+		},
+	}, nil
+}
+
+// CosignatureV1Timestamp returns the time committed to by a cosignature/v1
+// signature on a note. It doesn't verify the signature.
+func CosignatureV1Timestamp(sig sdb_note.Signature) (time.Time, error) {
+	b, err := base64.StdEncoding.DecodeString(sig.Base64)
+	if err != nil || len(b) != 4+8+ed25519.SignatureSize {
+		return time.Time{}, errors.New("not a cosignature/v1 signature")
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), 0), nil
+}
+
+// NewSignerForKey returns a signer for the given signer key, which may be
+// either a note Ed25519 key or a cosignature/v1 key, or an Ed25519 key in any
+// of the forms accepted by ConvertSignerKey.
+func NewSignerForKey(skey string) (sdb_note.Signer, error) {
+	skey, err := ConvertSignerKey(skey, "")
+	if err != nil {
+		return nil, err
+	}
+	if alg(strings.TrimPrefix(skey, privateKeyPrefix)) == algCosignatureV1 {
+		return NewCosignatureV1Signer(skey)
+	}
+	return sdb_note.NewSigner(skey)
+}
+
+// NewVerifierForKey returns a verifier for the given verifier key, which may
+// be a note Ed25519 key, a cosignature/v1 key or a threshold key, or an
+// Ed25519 key in any of the forms accepted by ConvertVerifierKey.
+func NewVerifierForKey(vkey string) (sdb_note.Verifier, error) {
+	vkey, err := ConvertVerifierKey(vkey, "")
+	if err != nil {
+		return nil, err
+	}
+	switch alg(vkey) {
+	case algCosignatureV1:
+		return NewCosignatureV1Verifier(vkey)
+	case algThresholdEd25519:
+		return NewThresholdVerifier(vkey)
+	}
+	return sdb_note.NewVerifier(vkey)
+}
+
+// signer is a note-compatible signer.
+type signer struct {
+	name    string
+	keyHash uint32
+	sign    func(msg []byte) ([]byte, error)
+}
+
+// Name returns the name associated with the key this signer is based on.
+func (s *signer) Name() string {
+	return s.name
+}
+
+// KeyHash returns a truncated hash of the key this signer is based on.
+func (s *signer) KeyHash() uint32 {
+	return s.keyHash
+}
+
+// Sign returns a signature over msg.
+func (s *signer) Sign(msg []byte) ([]byte, error) {
+	return s.sign(msg)
+}
+
+// cosignatureV1Message returns the message signed by a cosignature/v1
+// signature made at the given time over the checkpoint body msg.
+func cosignatureV1Message(ts uint64, msg []byte) []byte {
+	return append([]byte(cosignatureV1Label+"time "+strconv.FormatUint(ts, 10)+"\n"), msg...)
+}
+
+// noteKeyHash returns the note key hash of the given key, which starts with
+// its algorithm byte.
+func noteKeyHash(name string, key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte("\n"))
+	h.Write(key)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+// parseKey splits a key of the form <name>+<hash>+<base64 key> with the given
+// algorithm, returning the key bytes without the algorithm byte.
+func parseKey(k string, wantAlg byte) (string, uint32, []byte, error) {
+	parts := strings.SplitN(k, "+", 3)
+	if len(parts) != 3 || len(parts[0]) == 0 {
+		return "", 0, nil, errors.New("malformed key")
+	}
+	h, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil || len(parts[1]) != 8 {
+		return "", 0, nil, errors.New("malformed key hash")
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) == 0 {
+		return "", 0, nil, errors.New("malformed key")
+	}
+	if key[0] != wantAlg {
+		return "", 0, nil, fmt.Errorf("key has algorithm %d, want %d", key[0], wantAlg)
+	}
+	return parts[0], uint32(h), key[1:], nil
+}
+
+// alg returns the algorithm byte of a key of the form
+// <name>+<hash>+<base64 key>, or 0 if it's malformed.
+func alg(k string) byte {
+	parts := strings.SplitN(k, "+", 3)
+	if len(parts) != 3 {
+		return 0
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) == 0 {
+		return 0
+	}
+	return key[0]
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestCosignatureV1(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	skey, vkey, err := GenerateCosignatureV1Key(rand.Reader, "witness.example.com")
+	if err != nil {
+		t.Fatalf("GenerateCosignatureV1Key: %v", err)
+	}
+	s, err := NewSignerForKey(skey)
+	if err != nil {
+		t.Fatalf("NewSignerForKey: %v", err)
+	}
+	v, err := NewVerifierForKey(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifierForKey: %v", err)
+	}
+	if s.Name() != v.Name() || s.KeyHash() != v.KeyHash() {
+		t.Fatalf("Signer is %s+%08x, verifier is %s+%08x", s.Name(), s.KeyHash(), v.Name(), v.KeyHash())
+	}
+
+	const cp = "example.com/log\n3\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n"
+	msg, err := note.Sign(&note.Note{Text: cp}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	n, err := note.Open(msg, note.VerifierList(v))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	ts, err := CosignatureV1Timestamp(n.Sigs[0])
+	if err != nil {
+		t.Fatalf("CosignatureV1Timestamp: %v", err)
+	}
+	if !ts.Equal(now) {
+		t.Errorf("CosignatureV1Timestamp = %v, want %v", ts, now)
+	}
+
+	// The signature covers the checkpoint and the timestamp.
+	tampered := strings.Replace(string(msg), "\n3\n", "\n4\n", 1)
+	if _, err := note.Open([]byte(tampered), note.VerifierList(v)); err == nil {
+		t.Error("Open of tampered checkpoint succeeded")
+	}
+	sig := msg[len(cp)+1:]
+	raw := []byte(cp + "\n" + string(sig))
+	if _, err := note.Open(raw, note.VerifierList(v)); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	now = now.Add(time.Second)
+	other, err := note.Sign(&note.Note{Text: cp}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if string(other) == string(msg) {
+		t.Error("Signatures made at different times are the same")
+	}
+
+	// Plain note keys still work, and the two don't verify each other's
+	// signatures.
+	nskey, nvkey, err := note.GenerateKey(rand.Reader, "witness.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ns, err := NewSignerForKey(nskey)
+	if err != nil {
+		t.Fatalf("NewSignerForKey(note key): %v", err)
+	}
+	if _, err := NewVerifierForKey(nvkey); err != nil {
+		t.Fatalf("NewVerifierForKey(note key): %v", err)
+	}
+	nmsg, err := note.Sign(&note.Note{Text: cp}, ns)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := note.Open(nmsg, note.VerifierList(v)); err == nil {
+		t.Error("Open of note signature with cosignature/v1 verifier succeeded")
+	}
+	if _, err := NewCosignatureV1Verifier(nvkey); err == nil {
+		t.Error("NewCosignatureV1Verifier(note key) succeeded")
+	}
+	if _, err := NewVerifier(CosignatureV1, vkey); err != nil {
+		t.Errorf("NewVerifier(%q): %v", CosignatureV1, err)
+	}
+}
+
+func TestNewCosignatureV1VerifierErrors(t *testing.T) {
+	_, vkey, err := GenerateCosignatureV1Key(rand.Reader, "witness")
+	if err != nil {
+		t.Fatalf("GenerateCosignatureV1Key: %v", err)
+	}
+	parts := strings.SplitN(vkey, "+", 3)
+	for _, k := range []string{
+		"",
+		"witness",
+		parts[0] + "+00000000+" + parts[2],
+		"other+" + parts[1] + "+" + parts[2],
+		parts[0] + "+" + parts[1] + "+" + parts[2][:10],
+	} {
+		if _, err := NewCosignatureV1Verifier(k); err == nil {
+			t.Errorf("NewCosignatureV1Verifier(%q) succeeded", k)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	sdb_note "golang.org/x/mod/sumdb/note"
+)
+
+// NewExternalSigner returns a signer for the Ed25519 or cosignature/v1 key
+// with the given verifier key, whose private key is held elsewhere, e.g. in a
+// KMS or HSM, and which makes raw Ed25519 signatures with sign. The signatures
+// are in the form given by the verifier key's algorithm, as for the signers
+// returned by NewSignerForKey.
+func NewExternalSigner(vkey string, sign func(msg []byte) ([]byte, error)) (sdb_note.Signer, error) {
+	a := alg(vkey)
+	if a != algEd25519 && a != algCosignatureV1 {
+		return nil, fmt.Errorf("unsupported key algorithm %d", a)
+	}
+	name, h, key, err := parseKey(vkey, a)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize || noteKeyHash(name, append([]byte{a}, key...)) != h {
+		return nil, errors.New("invalid verifier key")
+	}
+	pub := ed25519.PublicKey(key)
+	// Signatures are checked before they're used, so that a misconfigured
+	// signer can't publish unverifiable notes.
+	checked := func(msg []byte) ([]byte, error) {
+		sig, err := sign(msg)
+		if err != nil {
+			return nil, err
+		}
+		if !ed25519.Verify(pub, msg, sig) {
+			return nil, errors.New("external signer made an invalid signature, is it using the wrong key?")
+		}
+		return sig, nil
+	}
+	s := &signer{name: name, keyHash: h, sign: checked}
+	if a == algCosignatureV1 {
+		s.sign = func(msg []byte) ([]byte, error) {
+			ts := uint64(timeNow().Unix())
+			sig, err := checked(cosignatureV1Message(ts, msg))
+			if err != nil {
+				return nil, err
+			}
+			return append(binary.BigEndian.AppendUint64(nil, ts), sig...), nil
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestExternalSigner(t *testing.T) {
+	noteSKey, noteVKey, err := note.GenerateKey(rand.Reader, "log.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosigSKey, cosigVKey, err := GenerateCosignatureV1Key(rand.Reader, "witness.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherSKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		desc       string
+		skey, vkey string
+		alg        byte
+	}{
+		{desc: "Ed25519", skey: noteSKey, vkey: noteVKey, alg: algEd25519},
+		{desc: "cosignature/v1", skey: cosigSKey, vkey: cosigVKey, alg: algCosignatureV1},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, _, seed, err := parseKey(strings.TrimPrefix(test.skey, privateKeyPrefix), test.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			priv := ed25519.NewKeyFromSeed(seed)
+			s, err := NewExternalSigner(test.vkey, func(msg []byte) ([]byte, error) {
+				return ed25519.Sign(priv, msg), nil
+			})
+			if err != nil {
+				t.Fatalf("NewExternalSigner: %v", err)
+			}
+			v, err := NewVerifierForKey(test.vkey)
+			if err != nil {
+				t.Fatalf("NewVerifierForKey: %v", err)
+			}
+			msg, err := note.Sign(&note.Note{Text: "hello\n"}, s)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := note.Open(msg, note.VerifierList(v)); err != nil {
+				t.Errorf("Open: %v", err)
+			}
+
+			// Signatures by the wrong key, or failures, aren't returned.
+			wrong, err := NewExternalSigner(test.vkey, func(msg []byte) ([]byte, error) {
+				return ed25519.Sign(otherSKey, msg), nil
+			})
+			if err != nil {
+				t.Fatalf("NewExternalSigner: %v", err)
+			}
+			if _, err := note.Sign(&note.Note{Text: "hello\n"}, wrong); err == nil {
+				t.Error("Sign with wrong key succeeded")
+			}
+			failing, err := NewExternalSigner(test.vkey, func(msg []byte) ([]byte, error) {
+				return nil, errors.New("HSM unavailable")
+			})
+			if err != nil {
+				t.Fatalf("NewExternalSigner: %v", err)
+			}
+			if _, err := note.Sign(&note.Note{Text: "hello\n"}, failing); err == nil {
+				t.Error("Sign with failing signer succeeded")
+			}
+		})
+	}
+
+	if _, err := NewExternalSigner("PeterNeumann+c74f20a3+AAAA", nil); err == nil {
+		t.Error("NewExternalSigner with invalid key succeeded")
+	}
+}
@@ -45,6 +45,10 @@ func NewVerifier(keyType, key string) (sdb_note.Verifier, error) {
 	switch keyType {
 	case ECDSA:
 		return NewECDSAVerifier(key)
+	case CosignatureV1:
+		return NewCosignatureV1Verifier(key)
+	case ThresholdEd25519:
+		return NewThresholdVerifier(key)
 	case Note:
 		return sdb_note.NewVerifier(key)
 	default:
@@ -0,0 +1,295 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+
+	sdb_note "golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// ThresholdEd25519 is a k-of-n threshold key, whose signature is made up
+	// of independent Ed25519 signatures by at least k of its n member keys.
+	// Since no member's key can make a signature alone, no single party can
+	// sign for a log with such a key.
+	//
+	// Its algorithm byte isn't registered with the note format, so these
+	// signatures are only understood by the verifiers in this package.
+	ThresholdEd25519 = "threshold-ed25519"
+
+	algThresholdEd25519 = 0x80
+
+	// memberSigSize is the size of each member's part of a threshold
+	// signature: its index, followed by its Ed25519 signature.
+	memberSigSize = 1 + ed25519.SignatureSize
+)
+
+// thresholdMessage returns the message which members of tk sign as their
+// share of its signature over msg. It's prefixed with the threshold key's name
+// and hash, separated by NUL bytes, which the text of a note can't contain,
+// so that no note signature by a member's key can be taken for a share, nor a
+// share for a threshold key taken for one of another.
+func thresholdMessage(tk *thresholdKey, msg []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s\x00%s+%08x\x00", ThresholdEd25519, tk.name, tk.keyHash)), msg...)
+}
+
+// thresholdKey is a parsed threshold verifier key.
+type thresholdKey struct {
+	name    string
+	keyHash uint32
+	k       int
+	members []ed25519.PublicKey
+}
+
+// GenerateThresholdKey returns the verifier key with the given name of the
+// threshold key which needs signatures by k of the Ed25519 member keys with
+// the given verifier keys. There's no corresponding signer key; signatures
+// are made by the members, and combined with CombineThreshold.
+func GenerateThresholdKey(name string, k int, members []string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	if len(members) == 0 || len(members) > 255 {
+		return "", fmt.Errorf("threshold key must have between 1 and 255 members, not %d", len(members))
+	}
+	if k < 1 || k > len(members) {
+		return "", fmt.Errorf("threshold must be between 1 and the number of members, %d", len(members))
+	}
+	key := []byte{algThresholdEd25519, byte(k), byte(len(members))}
+	seen := make(map[string]bool)
+	for _, m := range members {
+		m, err := ConvertVerifierKey(m, "")
+		if err != nil {
+			return "", err
+		}
+		_, _, pub, err := parseKey(m, algEd25519)
+		if err != nil {
+			return "", fmt.Errorf("invalid member key %q: %w", m, err)
+		}
+		if len(pub) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("invalid member key %q", m)
+		}
+		if seen[string(pub)] {
+			return "", fmt.Errorf("member key %q is given more than once", m)
+		}
+		seen[string(pub)] = true
+		key = append(key, pub...)
+	}
+	return fmt.Sprintf("%s+%08x+%s", name, noteKeyHash(name, key), base64.StdEncoding.EncodeToString(key)), nil
+}
+
+// IsThresholdKey returns true if vkey is a threshold verifier key.
+func IsThresholdKey(vkey string) bool {
+	return alg(vkey) == algThresholdEd25519
+}
+
+// parseThresholdKey parses a threshold verifier key.
+func parseThresholdKey(vkey string) (*thresholdKey, error) {
+	name, h, key, err := parseKey(vkey, algThresholdEd25519)
+	if err != nil {
+		return nil, err
+	}
+	if noteKeyHash(name, append([]byte{algThresholdEd25519}, key...)) != h {
+		return nil, errors.New("invalid verifier key hash")
+	}
+	if len(key) < 2 {
+		return nil, errors.New("invalid threshold key")
+	}
+	k, n := int(key[0]), int(key[1])
+	if k < 1 || k > n || len(key) != 2+n*ed25519.PublicKeySize {
+		return nil, errors.New("invalid threshold key")
+	}
+	tk := &thresholdKey{name: name, keyHash: h, k: k}
+	for i := 0; i < n; i++ {
+		tk.members = append(tk.members, ed25519.PublicKey(key[2+i*ed25519.PublicKeySize:2+(i+1)*ed25519.PublicKeySize]))
+	}
+	return tk, nil
+}
+
+// ThresholdParams returns the threshold k and number of members n of the
+// threshold verifier key vkey.
+func ThresholdParams(vkey string) (k, n int, err error) {
+	tk, err := parseThresholdKey(vkey)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tk.k, len(tk.members), nil
+}
+
+// NewThresholdVerifier returns a verifier of signatures by the threshold key
+// with the given verifier key.
+func NewThresholdVerifier(vkey string) (sdb_note.Verifier, error) {
+	tk, err := parseThresholdKey(vkey)
+	if err != nil {
+		return nil, err
+	}
+	return &verifier{
+		name:    tk.name,
+		keyHash: tk.keyHash,
+		v: func(msg, sig []byte) bool {
+			if len(sig)%memberSigSize != 0 || len(sig)/memberSigSize < tk.k {
+				return false
+			}
+			tm := thresholdMessage(tk, msg)
+			// Member signatures are in strictly increasing order of index, so
+			// that none is counted twice.
+			last := -1
+			for ; len(sig) > 0; sig = sig[memberSigSize:] {
+				i := int(sig[0])
+				if i <= last || i >= len(tk.members) || !ed25519.Verify(tk.members[i], tm, sig[1:memberSigSize]) {
+					return false
+				}
+				last = i
+			}
+			return true
+		},
+	}, nil
+}
+
+// CombineThreshold returns the signature by the threshold key with verifier
+// key vkey over msg, made up of the valid shares by its members among sigs,
+// which are note signatures over msg by any keys, made by members with the
+// signers returned by NewThresholdMemberSigner. Fails unless at least the
+// threshold number of members have signed.
+func CombineThreshold(vkey string, msg []byte, sigs []sdb_note.Signature) (sdb_note.Signature, error) {
+	tk, err := parseThresholdKey(vkey)
+	if err != nil {
+		return sdb_note.Signature{}, err
+	}
+	tm := thresholdMessage(tk, msg)
+	found := make(map[int][]byte)
+	for _, s := range sigs {
+		raw, err := base64.StdEncoding.DecodeString(s.Base64)
+		// Member signatures are Ed25519 note signatures: a 4-byte key hash
+		// followed by the signature itself.
+		if err != nil || len(raw) != 4+ed25519.SignatureSize {
+			continue
+		}
+		for i, pub := range tk.members {
+			if ed25519.Verify(pub, tm, raw[4:]) {
+				found[i] = raw[4:]
+				break
+			}
+		}
+	}
+	if len(found) < tk.k {
+		return sdb_note.Signature{}, fmt.Errorf("have valid signatures by %d members of %s, %d are required", len(found), tk.name, tk.k)
+	}
+	idx := make([]int, 0, len(found))
+	for i := range found {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	sig := make([]byte, 0, len(idx)*memberSigSize)
+	for _, i := range idx {
+		sig = append(append(sig, byte(i)), found[i]...)
+	}
+	return sdb_note.Signature{
+		Name:   tk.name,
+		Hash:   tk.keyHash,
+		Base64: base64.StdEncoding.EncodeToString(append(keyHashBytes(tk.keyHash), sig...)),
+	}, nil
+}
+
+// NewThresholdMemberSigner returns a signer which signs with member, one of
+// the members of the threshold key with verifier key vkey, making its share of
+// the threshold key's signature. Its note signatures are over a message
+// distinct from the note's text, so are only of use to CombineThreshold.
+func NewThresholdMemberSigner(vkey string, member sdb_note.Signer) (sdb_note.Signer, error) {
+	tk, err := parseThresholdKey(vkey)
+	if err != nil {
+		return nil, err
+	}
+	return &signer{
+		name:    member.Name(),
+		keyHash: member.KeyHash(),
+		sign: func(msg []byte) ([]byte, error) {
+			return member.Sign(thresholdMessage(tk, msg))
+		},
+	}, nil
+}
+
+// NewThresholdSigner returns a signer for the threshold key with verifier key
+// vkey which signs with each of the given member signers, which must include
+// at least the threshold number of members, and combines their signatures.
+// Fails if too few members are given.
+// It's for use where the members' keys are brought together, e.g. to sign
+// the initial state of a log at a key ceremony; otherwise members sign
+// independently and their signatures are combined with CombineThreshold.
+func NewThresholdSigner(vkey string, members []sdb_note.Signer) (sdb_note.Signer, error) {
+	tk, err := parseThresholdKey(vkey)
+	if err != nil {
+		return nil, err
+	}
+	// Check up front that enough distinct members are given, by their key
+	// hashes, rather than failing part way through signing several things.
+	seen := make(map[int]bool)
+	for _, m := range members {
+		i := tk.memberIndex(m.Name(), m.KeyHash())
+		if i < 0 {
+			return nil, fmt.Errorf("%s+%08x isn't a member of %s", m.Name(), m.KeyHash(), tk.name)
+		}
+		seen[i] = true
+	}
+	if len(seen) < tk.k {
+		return nil, fmt.Errorf("have %d members of %s, %d are required", len(seen), tk.name, tk.k)
+	}
+	s := &signer{
+		name:    tk.name,
+		keyHash: tk.keyHash,
+		sign: func(msg []byte) ([]byte, error) {
+			var sigs []sdb_note.Signature
+			for _, m := range members {
+				sig, err := m.Sign(thresholdMessage(tk, msg))
+				if err != nil {
+					return nil, err
+				}
+				sigs = append(sigs, sdb_note.Signature{Base64: base64.StdEncoding.EncodeToString(append(keyHashBytes(m.KeyHash()), sig...))})
+			}
+			s, err := CombineThreshold(vkey, msg, sigs)
+			if err != nil {
+				return nil, err
+			}
+			raw, err := base64.StdEncoding.DecodeString(s.Base64)
+			if err != nil {
+				return nil, err
+			}
+			return raw[4:], nil
+		},
+	}
+	return s, nil
+}
+
+// memberIndex returns the index of the member whose Ed25519 key has the
+// given name and note key hash, or -1 if there's none.
+func (tk *thresholdKey) memberIndex(name string, hash uint32) int {
+	for i, pub := range tk.members {
+		if noteKeyHash(name, append([]byte{algEd25519}, pub...)) == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyHashBytes returns the big-endian encoding of a key hash, which prefixes
+// the signature in a note signature line.
+func keyHashBytes(h uint32) []byte {
+	return []byte{byte(h >> 24), byte(h >> 16), byte(h >> 8), byte(h)}
+}
@@ -0,0 +1,219 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestThreshold(t *testing.T) {
+	var signers []note.Signer
+	var vkeys []string
+	for i := 0; i < 3; i++ {
+		skey, vkey, err := note.GenerateKey(rand.Reader, fmt.Sprintf("member%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := note.NewSigner(skey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+		vkeys = append(vkeys, vkey)
+	}
+	tkey, err := GenerateThresholdKey("log.example.com", 2, vkeys)
+	if err != nil {
+		t.Fatalf("GenerateThresholdKey: %v", err)
+	}
+	if !IsThresholdKey(tkey) {
+		t.Errorf("IsThresholdKey(%q) = false", tkey)
+	}
+	if k, n, err := ThresholdParams(tkey); err != nil || k != 2 || n != 3 {
+		t.Errorf("ThresholdParams = %d, %d, %v, want 2, 3", k, n, err)
+	}
+	v, err := NewVerifierForKey(tkey)
+	if err != nil {
+		t.Fatalf("NewVerifierForKey: %v", err)
+	}
+
+	const text = "log.example.com\n3\nqINS1GRFhWHwdkUeqLEoP4yEMkTBBzxBkGwGQlVlVcs=\n"
+	// memberSigs returns the shares of the signature over text by the given
+	// members, or if plain is set, their ordinary note signatures over it.
+	memberSigs := func(plain bool, members ...int) []note.Signature {
+		t.Helper()
+		if len(members) == 0 {
+			return nil
+		}
+		var ss []note.Signer
+		for _, m := range members {
+			s := signers[m]
+			if !plain {
+				var err error
+				if s, err = NewThresholdMemberSigner(tkey, s); err != nil {
+					t.Fatalf("NewThresholdMemberSigner: %v", err)
+				}
+			}
+			ss = append(ss, s)
+		}
+		raw, err := note.Sign(&note.Note{Text: text}, ss...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = note.Open(raw, note.VerifierList())
+		var e *note.UnverifiedNoteError
+		if !errors.As(err, &e) {
+			t.Fatalf("Open: %v", err)
+		}
+		return e.Note.UnverifiedSigs
+	}
+
+	for _, test := range []struct {
+		desc    string
+		members []int
+		plain   bool
+		wantErr bool
+	}{
+		{desc: "threshold", members: []int{2, 0}},
+		{desc: "all", members: []int{0, 1, 2}},
+		{desc: "too few", members: []int{1}, wantErr: true},
+		{desc: "none", wantErr: true},
+		{desc: "ordinary note signatures", members: []int{0, 1, 2}, plain: true, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			sig, err := CombineThreshold(tkey, []byte(text), memberSigs(test.plain, test.members...))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("CombineThreshold: %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			raw, err := note.Sign(&note.Note{Text: text, Sigs: []note.Signature{sig}})
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := note.Open(raw, note.VerifierList(v)); err != nil {
+				t.Errorf("Open: %v", err)
+			}
+			if _, err := note.Open([]byte("other\n"+string(raw)), note.VerifierList(v)); err == nil {
+				t.Error("Open of other text succeeded")
+			}
+		})
+	}
+
+	// Fewer members than the threshold can't sign, even by repeating one
+	// member's signature.
+	if _, err := NewThresholdSigner(tkey, signers[:1]); err == nil {
+		t.Error("NewThresholdSigner with one member succeeded")
+	}
+	if _, err := NewThresholdSigner(tkey, []note.Signer{signers[0], signers[0]}); err == nil {
+		t.Error("NewThresholdSigner with a repeated member succeeded")
+	}
+	other, _, err := note.GenerateKey(rand.Reader, "member1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonMember, err := note.NewSigner(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewThresholdSigner(tkey, []note.Signer{signers[0], nonMember}); err == nil {
+		t.Error("NewThresholdSigner with a non-member succeeded")
+	}
+	one, err := signers[0].Sign(thresholdMessage(mustParseThresholdKey(t, tkey), []byte(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range [][2]byte{{0, 0}, {0, 1}, {1, 0}} {
+		forged := keyHashBytes(v.KeyHash())
+		for _, i := range idx {
+			forged = append(append(forged, i), one...)
+		}
+		raw, err := note.Sign(&note.Note{Text: text, Sigs: []note.Signature{{Name: v.Name(), Hash: v.KeyHash(), Base64: base64.StdEncoding.EncodeToString(forged)}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := note.Open(raw, note.VerifierList(v)); err == nil {
+			t.Errorf("Open of member 0's signature as members %v succeeded", idx)
+		}
+	}
+
+	// Members brought together can sign directly, and only sign when asked.
+	counted := make([]note.Signer, 0, 2)
+	signs := 0
+	for _, m := range signers[1:] {
+		m := m
+		counted = append(counted, &signer{name: m.Name(), keyHash: m.KeyHash(), sign: func(msg []byte) ([]byte, error) {
+			signs++
+			return m.Sign(msg)
+		}})
+	}
+	s, err := NewThresholdSigner(tkey, counted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signs != 0 {
+		t.Errorf("NewThresholdSigner made %d signatures, want 0", signs)
+	}
+	signed, err := note.Sign(&note.Note{Text: text}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := note.Open(signed, note.VerifierList(v)); err != nil {
+		t.Errorf("Open: %v", err)
+	}
+}
+
+func mustParseThresholdKey(t *testing.T, vkey string) *thresholdKey {
+	t.Helper()
+	tk, err := parseThresholdKey(vkey)
+	if err != nil {
+		t.Fatalf("parseThresholdKey: %v", err)
+	}
+	return tk
+}
+
+func TestGenerateThresholdKeyErrors(t *testing.T) {
+	_, vkey, err := note.GenerateKey(rand.Reader, "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cosigVKey, err := GenerateCosignatureV1Key(rand.Reader, "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		desc    string
+		k       int
+		members []string
+	}{
+		{desc: "no members", k: 1},
+		{desc: "threshold too high", k: 2, members: []string{vkey}},
+		{desc: "zero threshold", k: 0, members: []string{vkey}},
+		{desc: "repeated member", k: 1, members: []string{vkey, vkey}},
+		{desc: "cosignature/v1 member", k: 1, members: []string{cosigVKey}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := GenerateThresholdKey("log", test.k, test.members); err == nil {
+				t.Error("GenerateThresholdKey succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VerificationAttestationHeaderV0 is the first line of a marshaled
+// verification attestation.
+const VerificationAttestationHeaderV0 = "Serverless Log Verification v0"
+
+// VerificationAttestation records that a client verified the inclusion of an
+// artifact in a log. It's signed with a key local to the client's host, so
+// that other tools on the host which trust the key can rely on the result
+// rather than verifying the artifact again.
+type VerificationAttestation struct {
+	// Origin is the origin of the log.
+	Origin string
+	// Size and Hash are those of the checkpoint the artifact was verified
+	// against.
+	Size uint64
+	Hash []byte
+	// Index and LeafHash are those of the artifact's entry in the log.
+	Index    uint64
+	LeafHash []byte
+	// Time is when the artifact was verified, to a second's precision.
+	Time time.Time
+}
+
+// Marshal returns the serialised form of the attestation, in the following
+// format:
+//
+// Serverless Log Verification v0\n
+// <origin>\n
+// <size>\n
+// <base64 root hash>\n
+// <index>\n
+// <base64 leaf hash>\n
+// <unix seconds>\n
+func (a VerificationAttestation) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%d\n%s\n", VerificationAttestationHeaderV0, a.Origin, a.Size, base64.StdEncoding.EncodeToString(a.Hash))
+	fmt.Fprintf(b, "%d\n%s\n%d\n", a.Index, base64.StdEncoding.EncodeToString(a.LeafHash), a.Time.Unix())
+	return b.Bytes()
+}
+
+// ParseVerificationAttestation parses and validates the serialised form of a
+// verification attestation, as written by VerificationAttestation.Marshal.
+func ParseVerificationAttestation(raw []byte) (*VerificationAttestation, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("verification attestation must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 7 {
+		return nil, fmt.Errorf("verification attestation has %d lines, want 7", len(lines))
+	}
+	if lines[0] != VerificationAttestationHeaderV0 {
+		return nil, fmt.Errorf("invalid verification attestation header %q", lines[0])
+	}
+	a := &VerificationAttestation{Origin: lines[1]}
+	if len(a.Origin) == 0 {
+		return nil, errors.New("verification attestation has empty origin")
+	}
+	var err error
+	if a.Size, err = strconv.ParseUint(lines[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid verification attestation size %q: %w", lines[2], err)
+	}
+	if a.Hash, err = base64.StdEncoding.DecodeString(lines[3]); err != nil {
+		return nil, fmt.Errorf("invalid verification attestation root hash %q: %w", lines[3], err)
+	}
+	if len(a.Hash) != HashSize {
+		return nil, fmt.Errorf("verification attestation root hash has length %d, want %d", len(a.Hash), HashSize)
+	}
+	if a.Index, err = strconv.ParseUint(lines[4], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid verification attestation index %q: %w", lines[4], err)
+	}
+	if a.Index >= a.Size {
+		return nil, fmt.Errorf("verification attestation index %d isn't in the tree of size %d", a.Index, a.Size)
+	}
+	if a.LeafHash, err = base64.StdEncoding.DecodeString(lines[5]); err != nil {
+		return nil, fmt.Errorf("invalid verification attestation leaf hash %q: %w", lines[5], err)
+	}
+	if len(a.LeafHash) != HashSize {
+		return nil, fmt.Errorf("verification attestation leaf hash has length %d, want %d", len(a.LeafHash), HashSize)
+	}
+	secs, err := strconv.ParseInt(lines[6], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification attestation time %q: %w", lines[6], err)
+	}
+	a.Time = time.Unix(secs, 0)
+	return a, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseVerificationAttestation(t *testing.T) {
+	const rootB64 = "0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="
+	const leafB64 = "bjQLnP+zepicpUTmu3gKLHiQHT+zNzh2hRGjBhevoB0="
+	root, err := base64.StdEncoding.DecodeString(rootB64)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	leaf, err := base64.StdEncoding.DecodeString(leafB64)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	const header = "Serverless Log Verification v0\n"
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.VerificationAttestation
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  header + "My Log\n2\n" + rootB64 + "\n1\n" + leafB64 + "\n1700000000\n",
+			want: &api.VerificationAttestation{Origin: "My Log", Size: 2, Hash: root, Index: 1, LeafHash: leaf, Time: time.Unix(1700000000, 0)},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Audit Receipt v0\nMy Log\n2\n" + rootB64 + "\n1\n" + leafB64 + "\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     header + "My Log\n2\n" + rootB64 + "\n1\n" + leafB64 + "\n1700000000",
+			wantErr: true,
+		}, {
+			desc:    "empty origin",
+			raw:     header + "\n2\n" + rootB64 + "\n1\n" + leafB64 + "\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "index outside tree",
+			raw:     header + "My Log\n2\n" + rootB64 + "\n2\n" + leafB64 + "\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "short leaf hash",
+			raw:     header + "My Log\n2\n" + rootB64 + "\n1\nYmFuYW5h\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "bad time",
+			raw:     header + "My Log\n2\n" + rootB64 + "\n1\n" + leafB64 + "\nyesterday\n",
+			wantErr: true,
+		}, {
+			desc:    "missing time",
+			raw:     header + "My Log\n2\n" + rootB64 + "\n1\n" + leafB64 + "\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			a, err := api.ParseVerificationAttestation([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseVerificationAttestation: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(a, test.want); len(diff) != 0 {
+				t.Errorf("ParseVerificationAttestation had diff %s", diff)
+			}
+			if a != nil {
+				if got := string(a.Marshal()); got != test.raw {
+					t.Errorf("Marshal = %q, want %q", got, test.raw)
+				}
+			}
+		})
+	}
+}
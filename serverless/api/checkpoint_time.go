@@ -0,0 +1,93 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckpointTimeHeaderV0 is the first line of a marshaled checkpoint time.
+const CheckpointTimeHeaderV0 = "Serverless Log Checkpoint Time v0"
+
+// CheckpointTime states that a checkpoint was the log's latest at the given
+// wall clock time. It's published signed by the log's timestamping key, which
+// is distinct from the key which signs checkpoints, so that claims about the
+// log's freshness can be made as often as needed by a less protected key, and
+// that key rotated or replaced after a compromise without touching the key
+// clients trust the tree with.
+type CheckpointTime struct {
+	// Origin, Size and Hash are those of the checkpoint.
+	Origin string
+	Size   uint64
+	Hash   []byte
+	// Time is when the checkpoint was the log's latest, to the second.
+	Time time.Time
+}
+
+// Marshal returns the serialised form of the checkpoint time, in the
+// following format:
+//
+// Serverless Log Checkpoint Time v0\n
+// <origin>\n
+// <size>\n
+// <base64 root hash>\n
+// <unix seconds>\n
+func (c CheckpointTime) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%d\n%s\n%d\n", CheckpointTimeHeaderV0, c.Origin, c.Size, base64.StdEncoding.EncodeToString(c.Hash), c.Time.Unix())
+	return b.Bytes()
+}
+
+// ParseCheckpointTime parses and validates the serialised form of a
+// checkpoint time, as written by CheckpointTime.Marshal.
+func ParseCheckpointTime(raw []byte) (*CheckpointTime, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("checkpoint time must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 5 {
+		return nil, fmt.Errorf("checkpoint time has %d lines, want 5", len(lines))
+	}
+	if lines[0] != CheckpointTimeHeaderV0 {
+		return nil, fmt.Errorf("invalid checkpoint time header %q", lines[0])
+	}
+	c := &CheckpointTime{Origin: lines[1]}
+	if len(c.Origin) == 0 {
+		return nil, errors.New("checkpoint time has empty origin")
+	}
+	var err error
+	if c.Size, err = strconv.ParseUint(lines[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint time size %q: %w", lines[2], err)
+	}
+	if c.Hash, err = base64.StdEncoding.DecodeString(lines[3]); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint time root hash %q: %w", lines[3], err)
+	}
+	if len(c.Hash) != HashSize {
+		return nil, fmt.Errorf("checkpoint time root hash has length %d, want %d", len(c.Hash), HashSize)
+	}
+	secs, err := strconv.ParseInt(lines[4], 10, 64)
+	if err != nil || secs < 0 {
+		return nil, fmt.Errorf("invalid checkpoint time %q", lines[4])
+	}
+	c.Time = time.Unix(secs, 0)
+	return c, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseCheckpointTime(t *testing.T) {
+	const rootB64 = "0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="
+	root, err := base64.StdEncoding.DecodeString(rootB64)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.CheckpointTime
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "Serverless Log Checkpoint Time v0\nMy Log\n2\n" + rootB64 + "\n1700000000\n",
+			want: &api.CheckpointTime{Origin: "My Log", Size: 2, Hash: root, Time: time.Unix(1700000000, 0)},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Audit Receipt v0\nMy Log\n2\n" + rootB64 + "\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Checkpoint Time v0\nMy Log\n2\n" + rootB64 + "\n1700000000",
+			wantErr: true,
+		}, {
+			desc:    "empty origin",
+			raw:     "Serverless Log Checkpoint Time v0\n\n2\n" + rootB64 + "\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "bad size",
+			raw:     "Serverless Log Checkpoint Time v0\nMy Log\n-2\n" + rootB64 + "\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "short root hash",
+			raw:     "Serverless Log Checkpoint Time v0\nMy Log\n2\nYmFuYW5h\n1700000000\n",
+			wantErr: true,
+		}, {
+			desc:    "negative time",
+			raw:     "Serverless Log Checkpoint Time v0\nMy Log\n2\n" + rootB64 + "\n-1\n",
+			wantErr: true,
+		}, {
+			desc:    "missing time",
+			raw:     "Serverless Log Checkpoint Time v0\nMy Log\n2\n" + rootB64 + "\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			c, err := api.ParseCheckpointTime([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseCheckpointTime: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(c, test.want); len(diff) != 0 {
+				t.Errorf("ParseCheckpointTime had diff %s", diff)
+			}
+			if c != nil {
+				if got := string(c.Marshal()); got != test.raw {
+					t.Errorf("Marshal = %q, want %q", got, test.raw)
+				}
+			}
+		})
+	}
+}
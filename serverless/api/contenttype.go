@@ -0,0 +1,130 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Content types of entries with built-in support, whose entries are validated
+// and indexed by the digests of their subjects when they're sequenced.
+const (
+	// ContentTypeInToto is an in-toto attestation statement, indexed by the
+	// digests of its subjects.
+	ContentTypeInToto = "application/vnd.in-toto+json"
+	// ContentTypeDSSE is a DSSE signed envelope in JSON form. Envelopes of
+	// in-toto statements are indexed as the statement is.
+	ContentTypeDSSE = "application/vnd.dsse.envelope.v1+json"
+	// ContentTypeCycloneDX is a CycloneDX SBOM in JSON form, indexed by the
+	// digests of the component it describes.
+	ContentTypeCycloneDX = "application/vnd.cyclonedx+json"
+	// ContentTypeSPDX is an SPDX SBOM in JSON form, indexed by the digests
+	// of the packages it describes.
+	ContentTypeSPDX = "application/spdx+json"
+)
+
+// ValidateContentType checks that t may be used as the content type of log
+// entries. Content types are lower case media types without parameters, e.g.
+// "application/vnd.in-toto+json".
+func ValidateContentType(t string) error {
+	mt, params, err := mime.ParseMediaType(t)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", t, err)
+	}
+	if mt != t || len(params) > 0 || !strings.Contains(t, "/") {
+		return fmt.Errorf("invalid content type %q, want a lower case media type without parameters", t)
+	}
+	return nil
+}
+
+// MarshalContentType returns the serialised form of the content type of an
+// entry.
+func MarshalContentType(t string) []byte {
+	return []byte(t + "\n")
+}
+
+// ParseContentType parses and validates the serialised form of the content
+// type of an entry, as written by MarshalContentType.
+func ParseContentType(raw []byte) (string, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return "", errors.New("content type must end with a newline")
+	}
+	t := strings.TrimSuffix(s, "\n")
+	if err := ValidateContentType(t); err != nil {
+		return "", err
+	}
+	return t, nil
+}
+
+// AcceptsContentType returns true if entries of content type t may be
+// sequenced into the log. Logs which don't declare content types accept
+// entries of any type, or of none; logs which do only accept entries tagged
+// with one of them.
+func (m Manifest) AcceptsContentType(t string) bool {
+	if len(m.ContentTypes) == 0 {
+		return true
+	}
+	for _, c := range m.ContentTypes {
+		if c == t {
+			return true
+		}
+	}
+	return false
+}
+
+// parseContentTypes parses the value of the content-types key of a manifest.
+func parseContentTypes(v string) ([]string, error) {
+	ts := strings.Split(v, " ")
+	seen := make(map[string]bool)
+	for _, t := range ts {
+		if err := ValidateContentType(t); err != nil {
+			return nil, err
+		}
+		if seen[t] {
+			return nil, fmt.Errorf("duplicate content type %q", t)
+		}
+		seen[t] = true
+	}
+	return ts, nil
+}
+
+// DigestIdentifier returns the identifier by which entries describing an
+// artifact with the given digest are indexed, of the form <alg>:<hex digest>,
+// e.g. "sha256:e3b0c442...". The algorithm name is normalised, so that the
+// names used by different formats, such as "SHA-256", "SHA256" and "sha256",
+// give the same identifier.
+func DigestIdentifier(alg, digest string) (string, error) {
+	alg = strings.ToLower(alg)
+	if strings.HasPrefix(alg, "sha-") {
+		alg = "sha" + strings.TrimPrefix(alg, "sha-")
+	}
+	if len(alg) == 0 || strings.ContainsAny(alg, ": \t\n") {
+		return "", fmt.Errorf("invalid digest algorithm %q", alg)
+	}
+	b, err := hex.DecodeString(digest)
+	if err != nil || len(b) == 0 {
+		return "", fmt.Errorf("invalid %s digest %q", alg, digest)
+	}
+	id := alg + ":" + hex.EncodeToString(b)
+	if err := ValidateIdentifier(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
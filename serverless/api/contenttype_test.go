@@ -0,0 +1,91 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestValidateContentType(t *testing.T) {
+	for _, test := range []struct {
+		t       string
+		wantErr bool
+	}{
+		{t: api.ContentTypeInToto},
+		{t: "text/plain"},
+		{t: "", wantErr: true},
+		{t: "text", wantErr: true},
+		{t: "Text/Plain", wantErr: true},
+		{t: "text/plain; charset=utf-8", wantErr: true},
+		{t: "text/plain text/html", wantErr: true},
+	} {
+		if err := api.ValidateContentType(test.t); (err != nil) != test.wantErr {
+			t.Errorf("ValidateContentType(%q) = %v, want err %t", test.t, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseContentType(t *testing.T) {
+	raw := api.MarshalContentType(api.ContentTypeSPDX)
+	if got, err := api.ParseContentType(raw); err != nil || got != api.ContentTypeSPDX {
+		t.Errorf("ParseContentType(%q) = %q, %v, want %q", raw, got, err, api.ContentTypeSPDX)
+	}
+	for _, raw := range []string{"", "text/plain", "text\n"} {
+		if got, err := api.ParseContentType([]byte(raw)); err == nil {
+			t.Errorf("ParseContentType(%q) = %q, want error", raw, got)
+		}
+	}
+}
+
+func TestAcceptsContentType(t *testing.T) {
+	any := api.Manifest{}
+	if !any.AcceptsContentType("") || !any.AcceptsContentType("text/plain") {
+		t.Error("Manifest without content types doesn't accept every entry")
+	}
+	m := api.Manifest{ContentTypes: []string{api.ContentTypeInToto}}
+	if !m.AcceptsContentType(api.ContentTypeInToto) {
+		t.Errorf("AcceptsContentType(%q) = false, want true", api.ContentTypeInToto)
+	}
+	for _, c := range []string{"", "text/plain"} {
+		if m.AcceptsContentType(c) {
+			t.Errorf("AcceptsContentType(%q) = true, want false", c)
+		}
+	}
+}
+
+func TestDigestIdentifier(t *testing.T) {
+	const d = "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"
+	const want = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	for _, alg := range []string{"sha256", "SHA256", "SHA-256"} {
+		if got, err := api.DigestIdentifier(alg, d); err != nil || got != want {
+			t.Errorf("DigestIdentifier(%q) = %q, %v, want %q", alg, got, err, want)
+		}
+	}
+	if got, err := api.DigestIdentifier("SHA3-256", "ab"); err != nil || got != "sha3-256:ab" {
+		t.Errorf("DigestIdentifier(SHA3-256) = %q, %v, want %q", got, err, "sha3-256:ab")
+	}
+	for _, test := range []struct{ alg, digest string }{
+		{alg: "", digest: "ab"},
+		{alg: "sha256", digest: ""},
+		{alg: "sha256", digest: "xyz"},
+		{alg: "a:b", digest: "ab"},
+	} {
+		if got, err := api.DigestIdentifier(test.alg, test.digest); err == nil {
+			t.Errorf("DigestIdentifier(%q, %q) = %q, want error", test.alg, test.digest, got)
+		}
+	}
+}
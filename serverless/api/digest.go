@@ -0,0 +1,71 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CheckpointDigestPrefixV0 is the first field of a marshaled checkpoint
+// digest.
+const CheckpointDigestPrefixV0 = "serverless-checkpoint-v0"
+
+// CheckpointDigest is the size and root hash of a log's checkpoint, without
+// its signatures. It's small enough to be published in channels which can't
+// hold a whole checkpoint, such as a DNS TXT record, where it's authenticated
+// by whoever controls the channel rather than by the log's key.
+type CheckpointDigest struct {
+	Size uint64
+	Hash []byte
+}
+
+// Marshal returns the serialised form of the digest, which is a single line
+// without a trailing newline:
+//
+// serverless-checkpoint-v0 <size> <base64 root hash>
+func (d CheckpointDigest) Marshal() string {
+	return fmt.Sprintf("%s %d %s", CheckpointDigestPrefixV0, d.Size, base64.StdEncoding.EncodeToString(d.Hash))
+}
+
+// ParseCheckpointDigest parses and validates the serialised form of a
+// checkpoint digest, as written by CheckpointDigest.Marshal.
+func ParseCheckpointDigest(s string) (*CheckpointDigest, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, errors.New("checkpoint digest must be a single line")
+	}
+	fields := strings.Split(s, " ")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("checkpoint digest has %d fields, want 3", len(fields))
+	}
+	if fields[0] != CheckpointDigestPrefixV0 {
+		return nil, fmt.Errorf("invalid checkpoint digest prefix %q", fields[0])
+	}
+	d := &CheckpointDigest{}
+	var err error
+	if d.Size, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint digest size %q: %w", fields[1], err)
+	}
+	if d.Hash, err = base64.StdEncoding.DecodeString(fields[2]); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint digest root hash %q: %w", fields[2], err)
+	}
+	if len(d.Hash) != HashSize {
+		return nil, fmt.Errorf("checkpoint digest root hash has length %d, want %d", len(d.Hash), HashSize)
+	}
+	return d, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseCheckpointDigest(t *testing.T) {
+	const rootB64 = "0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="
+	root, err := base64.StdEncoding.DecodeString(rootB64)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.CheckpointDigest
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "serverless-checkpoint-v0 2 " + rootB64,
+			want: &api.CheckpointDigest{Size: 2, Hash: root},
+		}, {
+			desc:    "bad prefix",
+			raw:     "v=spf1 2 " + rootB64,
+			wantErr: true,
+		}, {
+			desc:    "missing hash",
+			raw:     "serverless-checkpoint-v0 2",
+			wantErr: true,
+		}, {
+			desc:    "bad size",
+			raw:     "serverless-checkpoint-v0 -2 " + rootB64,
+			wantErr: true,
+		}, {
+			desc:    "short root hash",
+			raw:     "serverless-checkpoint-v0 2 YmFuYW5h",
+			wantErr: true,
+		}, {
+			desc:    "trailing newline",
+			raw:     "serverless-checkpoint-v0 2 " + rootB64 + "\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			d, err := api.ParseCheckpointDigest(test.raw)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseCheckpointDigest: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(d, test.want); len(diff) != 0 {
+				t.Errorf("ParseCheckpointDigest had diff %s", diff)
+			}
+			if d != nil {
+				if got := d.Marshal(); got != test.raw {
+					t.Errorf("Marshal = %q, want %q", got, test.raw)
+				}
+			}
+		})
+	}
+}
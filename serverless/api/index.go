@@ -0,0 +1,404 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxIdentifierLen is the maximum length in bytes of an identifier which
+	// may be associated with log entries.
+	MaxIdentifierLen = 256
+
+	// MapDepth is the depth of the sparse Merkle tree which maps identifiers
+	// to the entries associated with them.
+	MapDepth = 256
+
+	// MaxPrefixIndexLen is the maximum number of leading bytes of entries by
+	// which a log may index them, as set by Manifest.PrefixIndex.
+	MaxPrefixIndexLen = 32
+
+	// prefixIdentifierScheme starts the identifiers under which entries are
+	// indexed by their leading bytes.
+	prefixIdentifierScheme = "prefix:"
+
+	// mapExtensionKeyword starts the checkpoint extension line which commits
+	// to a snapshot of the identifier map.
+	mapExtensionKeyword = "vmap"
+)
+
+// ErrNoMapRoot is returned by ParseMapRoot if a checkpoint doesn't commit to
+// a snapshot of the identifier map.
+var ErrNoMapRoot = errors.New("checkpoint has no map root")
+
+// ValidateIdentifier checks that id may be used as an application identifier
+// for log entries. Identifiers must be non-empty, valid UTF-8, no longer than
+// MaxIdentifierLen, and must not contain control characters.
+func ValidateIdentifier(id string) error {
+	if len(id) == 0 || len(id) > MaxIdentifierLen {
+		return fmt.Errorf("invalid identifier length %d", len(id))
+	}
+	if !utf8.ValidString(id) {
+		return fmt.Errorf("identifier %q is not valid UTF-8", id)
+	}
+	if strings.IndexFunc(id, unicode.IsControl) >= 0 {
+		return fmt.Errorf("identifier %q contains control characters", id)
+	}
+	return nil
+}
+
+// IdentifierKey returns the key under which the entries associated with id
+// are stored, both in the index and in the identifier map.
+func IdentifierKey(id string) []byte {
+	k := sha256.Sum256([]byte(id))
+	return k[:]
+}
+
+// PrefixIdentifier returns the identifier under which entries starting with
+// prefix are indexed by logs which index entries by their leading bytes, of
+// the form prefix:<hex prefix>.
+func PrefixIdentifier(prefix []byte) string {
+	return prefixIdentifierScheme + hex.EncodeToString(prefix)
+}
+
+// MarshalIdentifiers returns the serialised form of the list of identifiers
+// associated with an entry, with one identifier per line.
+func MarshalIdentifiers(ids []string) []byte {
+	b := &bytes.Buffer{}
+	for _, id := range ids {
+		fmt.Fprintf(b, "%s\n", id)
+	}
+	return b.Bytes()
+}
+
+// ParseIdentifiers parses and validates the serialised form of the list of
+// identifiers associated with an entry, as written by MarshalIdentifiers.
+func ParseIdentifiers(raw []byte) ([]string, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("identifiers must end with a newline")
+	}
+	ids := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for _, id := range ids {
+		if err := ValidateIdentifier(id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// InstanceIdentifiers records the identifiers one instance of an entry was
+// submitted with, in logs whose duplicate policy is DuplicatesPerNamespace,
+// where the same entry may be added several times with different identifiers.
+type InstanceIdentifiers struct {
+	// LeafHash is the leaf hash of the entry.
+	LeafHash []byte
+	// Identifiers are the identifiers the instance was submitted with, if
+	// any.
+	Identifiers []string
+}
+
+// Marshal returns the serialised form of the record, in the following format:
+//
+// <hex leaf hash>\n
+// <identifier>\n
+// ...
+func (i InstanceIdentifiers) Marshal() []byte {
+	return append([]byte(hex.EncodeToString(i.LeafHash)+"\n"), MarshalIdentifiers(i.Identifiers)...)
+}
+
+// ParseInstanceIdentifiers parses and validates the serialised form of the
+// identifiers of an instance of an entry, as written by
+// InstanceIdentifiers.Marshal.
+func ParseInstanceIdentifiers(raw []byte) (*InstanceIdentifiers, error) {
+	first, rest, ok := bytes.Cut(raw, []byte("\n"))
+	if !ok {
+		return nil, errors.New("instance identifiers must end with a newline")
+	}
+	lh, err := hex.DecodeString(string(first))
+	if err != nil || len(lh) != HashSize {
+		return nil, fmt.Errorf("invalid instance leaf hash %q", first)
+	}
+	r := &InstanceIdentifiers{LeafHash: lh}
+	if len(rest) > 0 {
+		if r.Identifiers, err = ParseIdentifiers(rest); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// EntryPageSize is the number of indices in each page of a paginated entry
+// list.
+const EntryPageSize = 1024
+
+// EntryList lists the indices of the log entries associated with an
+// identifier.
+//
+// Once an identifier has more than EntryPageSize entries, the earlier ones
+// are moved to pages, each holding EntryPageSize of them, which are stored
+// separately and referenced by their hash, so that the list itself stays
+// small. Lists without pages have the same form as before pagination.
+type EntryList struct {
+	// Format is the encoding of the serialised form of the list, which is
+	// JSON unless it's IndexFormatBinary. Pages of the list have the same
+	// format as the list.
+	Format     IndexFormat `json:"-"`
+	Identifier string      `json:"identifier"`
+	// Pages references the pages holding the earliest entries, in order.
+	Pages []EntryPage `json:"pages,omitempty"`
+	// Indices holds the indices of the entries after those in Pages, in
+	// strictly increasing order.
+	Indices []uint64 `json:"indices"`
+}
+
+// EntryPage references a page of an entry list, which is stored as the
+// serialised form of an EntryList of the same identifier, with no pages and
+// EntryPageSize indices.
+type EntryPage struct {
+	// First and Last are the first and last indices in the page.
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+	// Hash is the SHA-256 hash of the page's serialised form.
+	Hash []byte `json:"hash"`
+}
+
+// NewEntryPage returns the reference to page, which must be a page of an
+// entry list, as described by EntryPage, and its serialised form.
+func NewEntryPage(page EntryList) (EntryPage, []byte) {
+	raw := page.Marshal()
+	h := sha256.Sum256(raw)
+	return EntryPage{First: page.Indices[0], Last: page.Indices[len(page.Indices)-1], Hash: h[:]}, raw
+}
+
+// Marshal returns the serialised form of the entry list. This is also the
+// value committed to for the identifier in the identifier map, so it must
+// be deterministic.
+func (l EntryList) Marshal() []byte {
+	if l.Format == IndexFormatBinary {
+		return l.marshalBinary()
+	}
+	if l.Indices == nil {
+		l.Indices = []uint64{}
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		// Marshalling strings, byte slices and integers can't fail.
+		panic(err)
+	}
+	return b
+}
+
+// Last returns the last index in the entry list.
+func (l EntryList) Last() uint64 {
+	if len(l.Indices) > 0 {
+		return l.Indices[len(l.Indices)-1]
+	}
+	return l.Pages[len(l.Pages)-1].Last
+}
+
+// ParseEntryList parses and validates the serialised form of an entry list,
+// as written by EntryList.Marshal, in either format.
+func ParseEntryList(raw []byte) (*EntryList, error) {
+	l := &EntryList{}
+	if bytes.HasPrefix(raw, binaryEntryListMagic) {
+		var err error
+		if l, err = parseBinaryEntryList(raw); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(raw, l); err != nil {
+		return nil, fmt.Errorf("invalid entry list: %w", err)
+	}
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ParseEntryPage parses and validates the serialised form of the page of the
+// entry list of identifier referenced by ref, checking it against the
+// reference.
+func ParseEntryPage(raw []byte, identifier string, ref EntryPage) (*EntryList, error) {
+	if h := sha256.Sum256(raw); !bytes.Equal(h[:], ref.Hash) {
+		return nil, fmt.Errorf("entry page has hash %x, want %x", h, ref.Hash)
+	}
+	l, err := ParseEntryList(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case l.Identifier != identifier:
+		return nil, fmt.Errorf("entry page is for identifier %q, want %q", l.Identifier, identifier)
+	case len(l.Pages) > 0 || len(l.Indices) != EntryPageSize:
+		return nil, fmt.Errorf("entry page for %q has %d pages and %d indices, want none and %d", identifier, len(l.Pages), len(l.Indices), EntryPageSize)
+	case l.Indices[0] != ref.First || l.Indices[len(l.Indices)-1] != ref.Last:
+		return nil, fmt.Errorf("entry page for %q covers [%d, %d], want [%d, %d]", identifier, l.Indices[0], l.Indices[len(l.Indices)-1], ref.First, ref.Last)
+	}
+	return l, nil
+}
+
+func (l EntryList) validate() error {
+	if err := ValidateIdentifier(l.Identifier); err != nil {
+		return err
+	}
+	if len(l.Pages) == 0 && len(l.Indices) == 0 {
+		return fmt.Errorf("entry list for %q is empty", l.Identifier)
+	}
+	for i, p := range l.Pages {
+		if len(p.Hash) != sha256.Size {
+			return fmt.Errorf("entry list for %q has page %d with invalid hash length %d", l.Identifier, i, len(p.Hash))
+		}
+		if p.Last < p.First || p.Last-p.First < EntryPageSize-1 {
+			return fmt.Errorf("entry list for %q has page %d covering [%d, %d], too few for %d entries", l.Identifier, i, p.First, p.Last, EntryPageSize)
+		}
+		if i > 0 && p.First <= l.Pages[i-1].Last {
+			return fmt.Errorf("entry list for %q has overlapping pages at %d", l.Identifier, i)
+		}
+	}
+	if len(l.Pages) > 0 && len(l.Indices) > 0 && l.Indices[0] <= l.Pages[len(l.Pages)-1].Last {
+		return fmt.Errorf("entry list for %q has indices overlapping its pages", l.Identifier)
+	}
+	for i := 1; i < len(l.Indices); i++ {
+		if l.Indices[i] <= l.Indices[i-1] {
+			return fmt.Errorf("entry list for %q is not strictly increasing at %d", l.Identifier, i)
+		}
+	}
+	return nil
+}
+
+// MapRoot identifies a snapshot of the identifier map, built from the entries
+// in the log at Size. Checkpoints commit to it in an extension line.
+type MapRoot struct {
+	Size uint64
+	Root []byte
+}
+
+// Extension returns the checkpoint extension line committing to the map
+// snapshot, in the following format:
+//
+// vmap <size> <base64 root hash>\n
+func (r MapRoot) Extension() []byte {
+	return []byte(fmt.Sprintf("%s %d %s\n", mapExtensionKeyword, r.Size, base64.StdEncoding.EncodeToString(r.Root)))
+}
+
+// ParseMapRoot finds and parses the map root in the extension lines of a
+// checkpoint, as returned by log.ParseCheckpoint. ErrNoMapRoot is returned if
+// there is none.
+func ParseMapRoot(ext []byte) (*MapRoot, error) {
+	for _, l := range strings.Split(string(ext), "\n") {
+		f := strings.Fields(l)
+		if len(f) == 0 || f[0] != mapExtensionKeyword {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("invalid map root %q", l)
+		}
+		size, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map root size %q: %w", f[1], err)
+		}
+		root, err := base64.StdEncoding.DecodeString(f[2])
+		if err != nil || len(root) != HashSize {
+			return nil, fmt.Errorf("invalid map root hash %q", f[2])
+		}
+		return &MapRoot{Size: size, Root: root}, nil
+	}
+	return nil, ErrNoMapRoot
+}
+
+// MapProof proves the value stored under a key in the identifier map.
+type MapProof struct {
+	// Bitmap has bit i, counting from the most significant bit of the first
+	// byte, set if the sibling of the node at depth i+1 on the path to the key
+	// isn't the root of an empty subtree.
+	Bitmap []byte `json:"bitmap"`
+	// Siblings holds the hashes of the non-empty siblings, starting with the
+	// one nearest the root.
+	Siblings [][]byte `json:"siblings"`
+}
+
+func (p MapProof) validate() error {
+	if len(p.Bitmap) != MapDepth/8 {
+		return fmt.Errorf("invalid map proof bitmap length %d", len(p.Bitmap))
+	}
+	n := 0
+	for _, b := range p.Bitmap {
+		n += bits.OnesCount8(b)
+	}
+	if n != len(p.Siblings) {
+		return fmt.Errorf("map proof bitmap has %d bits set, but there are %d siblings", n, len(p.Siblings))
+	}
+	for i, s := range p.Siblings {
+		if len(s) != HashSize {
+			return fmt.Errorf("invalid map proof sibling %d length %d", i, len(s))
+		}
+	}
+	return nil
+}
+
+// MapEntry is published for each identifier in a snapshot of the identifier
+// map, and holds its entry list with a proof of the list's presence in the
+// map.
+type MapEntry struct {
+	Entries EntryList `json:"entries"`
+	Proof   MapProof  `json:"proof"`
+}
+
+// Marshal returns the serialised form of the map entry, which is binary if
+// its entry list is.
+func (e MapEntry) Marshal() []byte {
+	if e.Entries.Format == IndexFormatBinary {
+		return e.marshalBinary()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// ParseMapEntry parses and validates the serialised form of a map entry, as
+// written by MapEntry.Marshal, in either format. The proof is checked to be
+// well formed, but isn't verified.
+func ParseMapEntry(raw []byte) (*MapEntry, error) {
+	e := &MapEntry{}
+	if IsBinaryMapEntry(raw) {
+		var err error
+		if e, err = parseBinaryMapEntry(raw); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(raw, e); err != nil {
+		return nil, fmt.Errorf("invalid map entry: %w", err)
+	}
+	if err := e.Entries.validate(); err != nil {
+		return nil, err
+	}
+	if err := e.Proof.validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
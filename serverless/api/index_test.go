@@ -0,0 +1,273 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseIdentifiers(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    []string
+		wantErr bool
+	}{
+		{desc: "one", raw: "pkg:go/example.com/foo\n", want: []string{"pkg:go/example.com/foo"}},
+		{desc: "many", raw: "a\nb c\n", want: []string{"a", "b c"}},
+		{desc: "no trailing newline", raw: "a", wantErr: true},
+		{desc: "empty", raw: "\n", wantErr: true},
+		{desc: "control character", raw: "a\tb\n", wantErr: true},
+		{desc: "invalid UTF-8", raw: "\xff\n", wantErr: true},
+		{desc: "too long", raw: strings.Repeat("a", api.MaxIdentifierLen+1) + "\n", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := api.ParseIdentifiers([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseIdentifiers: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("ParseIdentifiers: diff %s", diff)
+			}
+			if err == nil && string(api.MarshalIdentifiers(got)) != test.raw {
+				t.Errorf("MarshalIdentifiers = %q, want %q", api.MarshalIdentifiers(got), test.raw)
+			}
+		})
+	}
+}
+
+func TestParseEntryList(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.EntryList
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  `{"identifier":"foo","indices":[1,5,7]}`,
+			want: &api.EntryList{Identifier: "foo", Indices: []uint64{1, 5, 7}},
+		}, {
+			desc: "paginated",
+			raw:  `{"identifier":"foo","pages":[{"first":0,"last":1023,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},{"first":2000,"last":4000,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}],"indices":[4001]}`,
+			want: &api.EntryList{Identifier: "foo", Pages: []api.EntryPage{{First: 0, Last: 1023, Hash: make([]byte, 32)}, {First: 2000, Last: 4000, Hash: make([]byte, 32)}}, Indices: []uint64{4001}},
+		}, {
+			desc: "paginated without indices",
+			raw:  `{"identifier":"foo","pages":[{"first":0,"last":1023,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}],"indices":[]}`,
+			want: &api.EntryList{Identifier: "foo", Pages: []api.EntryPage{{First: 0, Last: 1023, Hash: make([]byte, 32)}}, Indices: []uint64{}},
+		}, {
+			desc:    "page too small",
+			raw:     `{"identifier":"foo","pages":[{"first":0,"last":1000,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}],"indices":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "overlapping pages",
+			raw:     `{"identifier":"foo","pages":[{"first":0,"last":2000,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},{"first":2000,"last":4000,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}],"indices":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "indices overlapping page",
+			raw:     `{"identifier":"foo","pages":[{"first":0,"last":2000,"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}],"indices":[5]}`,
+			wantErr: true,
+		}, {
+			desc:    "short page hash",
+			raw:     `{"identifier":"foo","pages":[{"first":0,"last":2000,"hash":"AAAA"}],"indices":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "not increasing",
+			raw:     `{"identifier":"foo","indices":[1,1]}`,
+			wantErr: true,
+		}, {
+			desc:    "no indices",
+			raw:     `{"identifier":"foo","indices":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "no identifier",
+			raw:     `{"indices":[1]}`,
+			wantErr: true,
+		}, {
+			desc:    "not JSON",
+			raw:     `foo 1`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := api.ParseEntryList([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseEntryList: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("ParseEntryList: diff %s", diff)
+			}
+			if err == nil && string(got.Marshal()) != test.raw {
+				t.Errorf("Marshal = %q, want %q", got.Marshal(), test.raw)
+			}
+		})
+	}
+}
+
+func TestParseMapRoot(t *testing.T) {
+	root := bytes.Repeat([]byte{0xab}, api.HashSize)
+	r := api.MapRoot{Size: 42, Root: root}
+	for _, test := range []struct {
+		desc    string
+		ext     string
+		want    *api.MapRoot
+		wantErr error
+	}{
+		{desc: "only line", ext: string(r.Extension()), want: &r},
+		{desc: "among others", ext: "other 1\n" + string(r.Extension()) + "more\n", want: &r},
+		{desc: "missing", ext: "other 1\n", wantErr: api.ErrNoMapRoot},
+		{desc: "empty", ext: "", wantErr: api.ErrNoMapRoot},
+		{desc: "short hash", ext: "vmap 42 q83vzQ==\n", wantErr: errors.New("")},
+		{desc: "bad size", ext: "vmap -1 " + strings.Fields(string(r.Extension()))[2] + "\n", wantErr: errors.New("")},
+		{desc: "extra field", ext: strings.TrimSuffix(string(r.Extension()), "\n") + " x\n", wantErr: errors.New("")},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := api.ParseMapRoot([]byte(test.ext))
+			switch {
+			case test.wantErr == nil && err != nil:
+				t.Fatalf("ParseMapRoot: %v", err)
+			case test.wantErr != nil && err == nil:
+				t.Fatal("ParseMapRoot succeeded, want error")
+			case errors.Is(test.wantErr, api.ErrNoMapRoot) && !errors.Is(err, api.ErrNoMapRoot):
+				t.Fatalf("ParseMapRoot: %v, want ErrNoMapRoot", err)
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("ParseMapRoot: diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseMapEntry(t *testing.T) {
+	sib := bytes.Repeat([]byte{1}, api.HashSize)
+	bitmap := make([]byte, api.MapDepth/8)
+	bitmap[0] = 0x81
+	valid := api.MapEntry{
+		Entries: api.EntryList{Identifier: "foo", Indices: []uint64{3}},
+		Proof:   api.MapProof{Bitmap: bitmap, Siblings: [][]byte{sib, sib}},
+	}
+	for _, test := range []struct {
+		desc    string
+		e       api.MapEntry
+		wantErr bool
+	}{
+		{desc: "valid", e: valid},
+		{desc: "too few siblings", e: api.MapEntry{Entries: valid.Entries, Proof: api.MapProof{Bitmap: bitmap, Siblings: [][]byte{sib}}}, wantErr: true},
+		{desc: "short sibling", e: api.MapEntry{Entries: valid.Entries, Proof: api.MapProof{Bitmap: bitmap, Siblings: [][]byte{sib, sib[1:]}}}, wantErr: true},
+		{desc: "short bitmap", e: api.MapEntry{Entries: valid.Entries, Proof: api.MapProof{Bitmap: bitmap[1:], Siblings: [][]byte{sib, sib}}}, wantErr: true},
+		{desc: "invalid entries", e: api.MapEntry{Entries: api.EntryList{Identifier: "foo"}, Proof: valid.Proof}, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := api.ParseMapEntry(test.e.Marshal())
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseMapEntry: got err %v, want err %t", err, test.wantErr)
+			}
+			if err == nil {
+				if diff := cmp.Diff(*got, test.e); len(diff) != 0 {
+					t.Errorf("ParseMapEntry: diff %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func FuzzParseMapEntry(f *testing.F) {
+	f.Add([]byte(`{"entries":{"identifier":"foo","indices":[1,2]},"proof":{"bitmap":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","siblings":[]}}`))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		e, err := api.ParseMapEntry(raw)
+		if err != nil {
+			return
+		}
+		e2, err := api.ParseMapEntry(e.Marshal())
+		if err != nil {
+			t.Fatalf("ParseMapEntry(Marshal(%q)): %v", raw, err)
+		}
+		if diff := cmp.Diff(e, e2); len(diff) != 0 {
+			t.Fatalf("Roundtripped map entry has diff: %s", diff)
+		}
+	})
+}
+
+func TestParseEntryPage(t *testing.T) {
+	page := api.EntryList{Identifier: "foo"}
+	for i := uint64(0); i < api.EntryPageSize; i++ {
+		page.Indices = append(page.Indices, 2*i)
+	}
+	ref, raw := api.NewEntryPage(page)
+	if ref.First != 0 || ref.Last != 2*(api.EntryPageSize-1) {
+		t.Errorf("NewEntryPage = [%d, %d], want [0, %d]", ref.First, ref.Last, 2*(api.EntryPageSize-1))
+	}
+	got, err := api.ParseEntryPage(raw, "foo", ref)
+	if err != nil {
+		t.Fatalf("ParseEntryPage: %v", err)
+	}
+	if diff := cmp.Diff(got, &page); len(diff) != 0 {
+		t.Errorf("ParseEntryPage: diff %s", diff)
+	}
+
+	short := api.EntryList{Identifier: "foo", Indices: page.Indices[:10]}
+	shortRef, shortRaw := api.NewEntryPage(short)
+	for _, test := range []struct {
+		desc string
+		raw  []byte
+		id   string
+		ref  api.EntryPage
+	}{
+		{desc: "wrong identifier", raw: raw, id: "bar", ref: ref},
+		{desc: "wrong hash", raw: raw, id: "foo", ref: shortRef},
+		{desc: "wrong range", raw: raw, id: "foo", ref: api.EntryPage{First: 1, Last: ref.Last, Hash: ref.Hash}},
+		{desc: "short page", raw: shortRaw, id: "foo", ref: shortRef},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := api.ParseEntryPage(test.raw, test.id, test.ref); err == nil {
+				t.Error("ParseEntryPage succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestParseInstanceIdentifiers(t *testing.T) {
+	for _, r := range []api.InstanceIdentifiers{
+		{LeafHash: bytes.Repeat([]byte{0xab}, api.HashSize), Identifiers: []string{"tenant-a/foo", "tenant-a/bar"}},
+		{LeafHash: bytes.Repeat([]byte{0xcd}, api.HashSize)},
+	} {
+		got, err := api.ParseInstanceIdentifiers(r.Marshal())
+		if err != nil {
+			t.Fatalf("ParseInstanceIdentifiers: %v", err)
+		}
+		if diff := cmp.Diff(got, &r); len(diff) != 0 {
+			t.Errorf("ParseInstanceIdentifiers had diff %s", diff)
+		}
+	}
+	lh := strings.Repeat("ab", api.HashSize)
+	for _, raw := range []string{
+		"",
+		lh,
+		lh + "\na",
+		lh + "\n\n",
+		"abab\na\n",
+		lh + "\na\tb\n",
+	} {
+		if _, err := api.ParseInstanceIdentifiers([]byte(raw)); err == nil {
+			t.Errorf("ParseInstanceIdentifiers(%q) succeeded, want error", raw)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// IndexFormat is the encoding of a log's identifier index, i.e. its entry
+// lists and the entries of its identifier map snapshots.
+type IndexFormat string
+
+const (
+	// IndexFormatJSON encodes the index as JSON. It's the default.
+	IndexFormatJSON IndexFormat = "json"
+	// IndexFormatBinary encodes the index compactly, with the indices in
+	// entry lists delta encoded as varints, for logs with identifiers
+	// associated with very many entries.
+	IndexFormatBinary IndexFormat = "binary"
+)
+
+// Valid returns true if f is a known index format.
+func (f IndexFormat) Valid() bool {
+	return f == IndexFormatJSON || f == IndexFormatBinary
+}
+
+var (
+	// binaryEntryListMagic and binaryMapEntryMagic start the binary forms of
+	// entry lists and map entries. JSON can't start with a zero byte, so
+	// parsers can tell the formats apart.
+	binaryEntryListMagic = []byte{0, 'E', 'L', 1}
+	binaryMapEntryMagic  = []byte{0, 'M', 'E', 1}
+)
+
+// IsBinaryMapEntry returns true if raw is the binary form of a map entry.
+func IsBinaryMapEntry(raw []byte) bool {
+	return bytes.HasPrefix(raw, binaryMapEntryMagic)
+}
+
+// marshalBinary returns the binary form of the entry list:
+//
+//	magic
+//	uvarint(len(identifier)) identifier
+//	uvarint(len(pages)) [uvarint(first - previous last) uvarint(last - first) hash]...
+//	uvarint(len(indices)) [uvarint(index - previous index)]...
+//
+// where the previous index of the first page and index is 0, and the
+// previous index of the first index is the last index of the last page, if
+// there are pages.
+func (l EntryList) marshalBinary() []byte {
+	b := append([]byte{}, binaryEntryListMagic...)
+	b = binary.AppendUvarint(b, uint64(len(l.Identifier)))
+	b = append(b, l.Identifier...)
+	b = binary.AppendUvarint(b, uint64(len(l.Pages)))
+	var prev uint64
+	for _, p := range l.Pages {
+		b = binary.AppendUvarint(b, p.First-prev)
+		b = binary.AppendUvarint(b, p.Last-p.First)
+		b = append(b, p.Hash...)
+		prev = p.Last
+	}
+	b = binary.AppendUvarint(b, uint64(len(l.Indices)))
+	for _, i := range l.Indices {
+		b = binary.AppendUvarint(b, i-prev)
+		prev = i
+	}
+	return b
+}
+
+// parseBinaryEntryList parses the binary form of an entry list, as written
+// by marshalBinary. It isn't validated.
+func parseBinaryEntryList(raw []byte) (*EntryList, error) {
+	r := &binaryReader{b: raw[len(binaryEntryListMagic):]}
+	l := &EntryList{Format: IndexFormatBinary}
+	l.Identifier = string(r.bytes(int(r.count(MaxIdentifierLen))))
+	var prev uint64
+	if n := r.count(len(r.b)); n > 0 {
+		l.Pages = make([]EntryPage, 0, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			p := EntryPage{}
+			p.First = r.add(prev, r.uvarint())
+			p.Last = r.add(p.First, r.uvarint())
+			p.Hash = append([]byte{}, r.bytes(HashSize)...)
+			l.Pages = append(l.Pages, p)
+			prev = p.Last
+		}
+	}
+	n := r.count(len(r.b))
+	l.Indices = make([]uint64, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		prev = r.add(prev, r.uvarint())
+		l.Indices = append(l.Indices, prev)
+	}
+	if r.err == nil && len(r.b) > 0 {
+		r.err = fmt.Errorf("%d trailing bytes", len(r.b))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid binary entry list: %w", r.err)
+	}
+	return l, nil
+}
+
+// marshalBinary returns the binary form of the map entry:
+//
+//	magic
+//	uvarint(len(entries)) entries
+//	bitmap
+//	uvarint(len(siblings)) siblings
+//
+// where entries is the binary form of the entry list.
+func (e MapEntry) marshalBinary() []byte {
+	l := e.Entries.marshalBinary()
+	b := append([]byte{}, binaryMapEntryMagic...)
+	b = binary.AppendUvarint(b, uint64(len(l)))
+	b = append(b, l...)
+	b = append(b, e.Proof.Bitmap...)
+	b = binary.AppendUvarint(b, uint64(len(e.Proof.Siblings)))
+	for _, s := range e.Proof.Siblings {
+		b = append(b, s...)
+	}
+	return b
+}
+
+// parseBinaryMapEntry parses the binary form of a map entry, as written by
+// marshalBinary. It isn't validated.
+func parseBinaryMapEntry(raw []byte) (*MapEntry, error) {
+	r := &binaryReader{b: raw[len(binaryMapEntryMagic):]}
+	lRaw := r.bytes(int(r.count(len(r.b))))
+	e := &MapEntry{}
+	e.Proof.Bitmap = append([]byte{}, r.bytes(MapDepth/8)...)
+	n := r.count(MapDepth)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		e.Proof.Siblings = append(e.Proof.Siblings, append([]byte{}, r.bytes(HashSize)...))
+	}
+	if r.err == nil && len(r.b) > 0 {
+		r.err = fmt.Errorf("%d trailing bytes", len(r.b))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid binary map entry: %w", r.err)
+	}
+	if !bytes.HasPrefix(lRaw, binaryEntryListMagic) {
+		return nil, errors.New("invalid binary map entry: entry list isn't binary")
+	}
+	l, err := parseBinaryEntryList(lRaw)
+	if err != nil {
+		return nil, err
+	}
+	e.Entries = *l
+	return e, nil
+}
+
+// binaryReader reads the fields of the binary index encodings, recording the
+// first error, after which reads return zero values.
+type binaryReader struct {
+	b   []byte
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errors.New("invalid varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// count reads a uvarint count of items, which must be at most max.
+func (r *binaryReader) count(max int) uint64 {
+	v := r.uvarint()
+	if r.err == nil && v > uint64(max) {
+		r.err = fmt.Errorf("count %d exceeds %d", v, max)
+		return 0
+	}
+	return v
+}
+
+func (r *binaryReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = fmt.Errorf("need %d bytes, have %d", n, len(r.b))
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// add returns a+b, recording an error if it overflows.
+func (r *binaryReader) add(a, b uint64) uint64 {
+	if b > math.MaxUint64-a {
+		if r.err == nil {
+			r.err = errors.New("index overflows")
+		}
+		return 0
+	}
+	return a + b
+}
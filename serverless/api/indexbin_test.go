@@ -0,0 +1,116 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestBinaryEntryList(t *testing.T) {
+	page := api.EntryList{Format: api.IndexFormatBinary, Identifier: "foo"}
+	for i := uint64(0); i < api.EntryPageSize; i++ {
+		page.Indices = append(page.Indices, 1000000+3*i)
+	}
+	ref, raw := api.NewEntryPage(page)
+	got, err := api.ParseEntryPage(raw, "foo", ref)
+	if err != nil {
+		t.Fatalf("ParseEntryPage: %v", err)
+	}
+	if diff := cmp.Diff(got, &page); len(diff) != 0 {
+		t.Errorf("ParseEntryPage: diff %s", diff)
+	}
+	page.Format = api.IndexFormatJSON
+	if b, j := len(raw), len(page.Marshal()); b >= j/2 {
+		t.Errorf("binary page is %d bytes, want less than half the %d bytes of JSON", b, j)
+	}
+
+	for _, l := range []api.EntryList{
+		{Format: api.IndexFormatBinary, Identifier: "foo", Indices: []uint64{0}},
+		{Format: api.IndexFormatBinary, Identifier: "foo", Indices: []uint64{3, 1 << 40, 1<<64 - 1}},
+		{Format: api.IndexFormatBinary, Identifier: "foo", Pages: []api.EntryPage{ref}, Indices: []uint64{}},
+		{Format: api.IndexFormatBinary, Identifier: "foo", Pages: []api.EntryPage{ref}, Indices: []uint64{ref.Last + 1, ref.Last + 7}},
+	} {
+		raw := l.Marshal()
+		got, err := api.ParseEntryList(raw)
+		if err != nil {
+			t.Fatalf("ParseEntryList(%x): %v", raw, err)
+		}
+		if diff := cmp.Diff(got, &l); len(diff) != 0 {
+			t.Errorf("ParseEntryList(%x): diff %s", raw, diff)
+		}
+	}
+
+	valid := api.EntryList{Format: api.IndexFormatBinary, Identifier: "foo", Indices: []uint64{1, 2}}.Marshal()
+	for _, test := range []struct {
+		desc string
+		raw  []byte
+	}{
+		{desc: "truncated", raw: valid[:len(valid)-1]},
+		{desc: "trailing bytes", raw: append(append([]byte{}, valid...), 0)},
+		{desc: "not increasing", raw: api.EntryList{Format: api.IndexFormatBinary, Identifier: "foo", Indices: []uint64{2, 2}}.Marshal()},
+		{desc: "overflow", raw: append(valid[:len(valid)-3], 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)},
+		{desc: "empty", raw: api.EntryList{Format: api.IndexFormatBinary, Identifier: "foo"}.Marshal()},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if l, err := api.ParseEntryList(test.raw); err == nil {
+				t.Errorf("ParseEntryList = %+v, want error", l)
+			}
+		})
+	}
+}
+
+func TestBinaryMapEntry(t *testing.T) {
+	sib := bytes.Repeat([]byte{1}, api.HashSize)
+	bitmap := make([]byte, api.MapDepth/8)
+	bitmap[0] = 0x81
+	e := api.MapEntry{
+		Entries: api.EntryList{Format: api.IndexFormatBinary, Identifier: "foo", Indices: []uint64{3, 5}},
+		Proof:   api.MapProof{Bitmap: bitmap, Siblings: [][]byte{sib, sib}},
+	}
+	raw := e.Marshal()
+	if !api.IsBinaryMapEntry(raw) {
+		t.Errorf("IsBinaryMapEntry(%x) = false, want true", raw)
+	}
+	got, err := api.ParseMapEntry(raw)
+	if err != nil {
+		t.Fatalf("ParseMapEntry: %v", err)
+	}
+	if diff := cmp.Diff(*got, e); len(diff) != 0 {
+		t.Errorf("ParseMapEntry: diff %s", diff)
+	}
+
+	json := api.MapEntry{Entries: api.EntryList{Identifier: "foo", Indices: []uint64{3}}, Proof: e.Proof}.Marshal()
+	if api.IsBinaryMapEntry(json) {
+		t.Errorf("IsBinaryMapEntry(%q) = true, want false", json)
+	}
+	for _, test := range []struct {
+		desc string
+		raw  []byte
+	}{
+		{desc: "truncated", raw: raw[:len(raw)-1]},
+		{desc: "trailing bytes", raw: append(append([]byte{}, raw...), 0)},
+		{desc: "too few siblings", raw: api.MapEntry{Entries: e.Entries, Proof: api.MapProof{Bitmap: bitmap, Siblings: [][]byte{sib}}}.Marshal()},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if e, err := api.ParseMapEntry(test.raw); err == nil {
+				t.Errorf("ParseMapEntry = %+v, want error", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+// InventoryHeaderV0 is the first line of a marshaled inventory.
+const InventoryHeaderV0 = "Serverless Log Inventory v0"
+
+// Inventory lists the files of a log which are committed to by a checkpoint,
+// along with the hashes of their contents. It's published signed by the
+// log's key, so that mirrors can cheaply check that they hold a byte-for-byte
+// copy of every file without recomputing the tree.
+type Inventory struct {
+	// Origin is the origin of the log.
+	Origin string
+	// Size and Hash are those of the checkpoint the inventory was built
+	// from.
+	Size uint64
+	Hash []byte
+	// Objects holds the files, in strictly increasing order of path.
+	Objects []InventoryObject
+}
+
+// InventoryObject is a file listed in an inventory.
+type InventoryObject struct {
+	// Path is the slash-separated path of the file, relative to the root of
+	// the log.
+	Path string
+	// Hash is the SHA-256 hash of the file's contents.
+	Hash []byte
+}
+
+// NewInventoryObject returns the InventoryObject for the file at path p with
+// the given contents.
+func NewInventoryObject(p string, contents []byte) InventoryObject {
+	h := sha256.Sum256(contents)
+	return InventoryObject{Path: p, Hash: h[:]}
+}
+
+// Marshal returns the serialised form of the inventory, in the following
+// format:
+//
+// Serverless Log Inventory v0\n
+// <origin>\n
+// <size>\n
+// <base64 root hash>\n
+// <base64 SHA-256 hash> <path>\n
+// ...
+func (i Inventory) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%d\n%s\n", InventoryHeaderV0, i.Origin, i.Size, base64.StdEncoding.EncodeToString(i.Hash))
+	for _, o := range i.Objects {
+		fmt.Fprintf(b, "%s %s\n", base64.StdEncoding.EncodeToString(o.Hash), o.Path)
+	}
+	return b.Bytes()
+}
+
+// ParseInventory parses and validates the serialised form of an inventory, as
+// written by Inventory.Marshal.
+func ParseInventory(raw []byte) (*Inventory, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("inventory must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 4 {
+		return nil, errors.New("inventory is too short")
+	}
+	if lines[0] != InventoryHeaderV0 {
+		return nil, fmt.Errorf("invalid inventory header %q", lines[0])
+	}
+	i := &Inventory{Origin: lines[1]}
+	if len(i.Origin) == 0 {
+		return nil, errors.New("inventory has empty origin")
+	}
+	var err error
+	if i.Size, err = strconv.ParseUint(lines[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid inventory size %q: %w", lines[2], err)
+	}
+	if i.Hash, err = base64.StdEncoding.DecodeString(lines[3]); err != nil {
+		return nil, fmt.Errorf("invalid inventory root hash %q: %w", lines[3], err)
+	}
+	if len(i.Hash) != HashSize {
+		return nil, fmt.Errorf("inventory root hash has length %d, want %d", len(i.Hash), HashSize)
+	}
+	for n, l := range lines[4:] {
+		h, p, ok := strings.Cut(l, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid inventory line %q", l)
+		}
+		if err := layout.ValidatePath(p); err != nil {
+			return nil, fmt.Errorf("invalid inventory path: %w", err)
+		}
+		if n > 0 && p <= i.Objects[n-1].Path {
+			return nil, fmt.Errorf("inventory path %q is out of order", p)
+		}
+		o := InventoryObject{Path: p}
+		if o.Hash, err = base64.StdEncoding.DecodeString(h); err != nil {
+			return nil, fmt.Errorf("invalid hash of %q: %w", p, err)
+		}
+		if len(o.Hash) != sha256.Size {
+			return nil, fmt.Errorf("hash of %q has length %d, want %d", p, len(o.Hash), sha256.Size)
+		}
+		i.Objects = append(i.Objects, o)
+	}
+	return i, nil
+}
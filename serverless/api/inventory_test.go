@@ -0,0 +1,106 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseInventory(t *testing.T) {
+	const (
+		rootB64 = "0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="
+		hdr     = "Serverless Log Inventory v0\nMy Log\n2\n" + rootB64 + "\n"
+	)
+	root, err := base64.StdEncoding.DecodeString(rootB64)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	seq0 := api.NewInventoryObject("seq/00/00/00/00/00", []byte("one"))
+	seq1 := api.NewInventoryObject("seq/00/00/00/00/01", []byte("two"))
+	line := func(o api.InventoryObject) string {
+		return base64.StdEncoding.EncodeToString(o.Hash) + " " + o.Path + "\n"
+	}
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.Inventory
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+			raw:  hdr,
+			want: &api.Inventory{Origin: "My Log", Size: 2, Hash: root},
+		}, {
+			desc: "objects",
+			raw:  hdr + line(seq0) + line(seq1),
+			want: &api.Inventory{Origin: "My Log", Size: 2, Hash: root, Objects: []api.InventoryObject{seq0, seq1}},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Inventory v1\nMy Log\n2\n" + rootB64 + "\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Inventory v0\nMy Log\n2\n" + rootB64,
+			wantErr: true,
+		}, {
+			desc:    "bad size",
+			raw:     "Serverless Log Inventory v0\nMy Log\n-2\n" + rootB64 + "\n",
+			wantErr: true,
+		}, {
+			desc:    "short root hash",
+			raw:     "Serverless Log Inventory v0\nMy Log\n2\nYmFuYW5h\n",
+			wantErr: true,
+		}, {
+			desc:    "out of order",
+			raw:     hdr + line(seq1) + line(seq0),
+			wantErr: true,
+		}, {
+			desc:    "duplicate",
+			raw:     hdr + line(seq0) + line(seq0),
+			wantErr: true,
+		}, {
+			desc:    "escaping path",
+			raw:     hdr + base64.StdEncoding.EncodeToString(seq0.Hash) + " ../secret\n",
+			wantErr: true,
+		}, {
+			desc:    "short object hash",
+			raw:     hdr + "YmFuYW5h seq/00/00/00/00/00\n",
+			wantErr: true,
+		}, {
+			desc:    "no hash",
+			raw:     hdr + "seq/00/00/00/00/00\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			i, err := api.ParseInventory([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseInventory: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(i, test.want); len(diff) != 0 {
+				t.Errorf("ParseInventory had diff %s", diff)
+			}
+			if i != nil {
+				if got := string(i.Marshal()); got != test.raw {
+					t.Errorf("Marshal = %q, want %q", got, test.raw)
+				}
+			}
+		})
+	}
+}
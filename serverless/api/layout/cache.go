@@ -0,0 +1,51 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import "strings"
+
+// immutablePrefixes are the directories whose files are never rewritten once
+// published, since their names include the sequence number, leaf hash, or
+// tree size they're specific to.
+var immutablePrefixes = []string{"seq/", "leaves/", "map/", "proof/", "inventory/"}
+
+// Immutable returns true if the file at the given slash-separated path,
+// relative to the root of the log, never changes once it's been published,
+// in a log which uses the immutable layout (see api.Manifest). Such files may
+// be cached indefinitely, e.g. by a CDN in front of the log, and only the
+// files for which it returns false, such as the checkpoint, need to be
+// revalidated.
+//
+// In logs which don't use the immutable layout partial tiles are replaced
+// once the full tile has been written, although since the full tile contains
+// the partial tile's hashes stale copies remain usable.
+func Immutable(p string) bool {
+	if strings.HasSuffix(p, ".tmp") || strings.HasSuffix(p, ".temp") || strings.HasSuffix(p, ".link") {
+		return false
+	}
+	if strings.HasPrefix(p, "tile/") {
+		_, _, _, err := ParseTilePath(p)
+		return err == nil
+	}
+	if strings.HasPrefix(p, "leaves/pending/") || strings.HasPrefix(p, "leaves/requests/") {
+		return false
+	}
+	for _, pfx := range immutablePrefixes {
+		if strings.HasPrefix(p, pfx) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import "testing"
+
+func TestImmutable(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want bool
+	}{
+		{path: "tile/00/0000/00/00/00", want: true},
+		{path: "tile/00/0000/00/00/00.01", want: true},
+		{path: "seq/00/00/00/00/05", want: true},
+		{path: "leaves/ab/cd/ef/0123", want: true},
+		{path: "leaves/ab/cd/ef/0123.ids", want: true},
+		{path: "map/5/ab/cd/ef/0123", want: true},
+		{path: "proof/inclusion/5/00/00/00/00/01.json", want: true},
+		{path: "inventory/5", want: true},
+		{path: "checkpoint"},
+		{path: "manifest"},
+		{path: "shards"},
+		{path: "checkpoint.staged"},
+		{path: "index/ab/cd/ef/0123"},
+		{path: "leaves/pending/abcdef0123"},
+		{path: "leaves/requests/ab/cd/ef/0123"},
+		{path: "tile/00/0000/00/00/00.temp"},
+		{path: "tile/00/0000/00/00/00.link"},
+		{path: "seq/00/00/00/00/05.tmp"},
+		{path: "tile/00/bogus"},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			if got := Immutable(test.path); got != test.want {
+				t.Errorf("Immutable(%q) = %t, want %t", test.path, got, test.want)
+			}
+		})
+	}
+}
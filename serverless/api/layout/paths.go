@@ -16,11 +16,26 @@
 // stored log.
 // This will be used by both the storage package, as well as clients accessing
 // the stored data either directly or via some other transport.
+//
+// All paths returned by this package use "/" as a separator regardless of the
+// platform, since they are also used to build URLs. Storage implementations
+// which use the local filesystem should convert them with filepath.FromSlash.
+//
+// # Publication order
+//
+// Writers publish the files of a log in an order which ensures that readers
+// never see a checkpoint before the data it commits to: entries, tiles,
+// indices and identifier map snapshots are stored first, and the checkpoint
+// at CheckpointPath is replaced atomically last. Readers may therefore see
+// data beyond the latest checkpoint, such as entries which have been
+// sequenced but not integrated, or tiles extended for a checkpoint which
+// hasn't been published yet, and must only rely on what's committed to by a
+// checkpoint they've verified. client.SnapshotFetcher hides the rest.
 package layout
 
 import (
 	"fmt"
-	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -29,6 +44,70 @@ import (
 const (
 	// CheckpointPath is the location of the file containing the log checkpoint.
 	CheckpointPath = "checkpoint"
+
+	// StagedCheckpointPath is the location of the file containing the unsigned
+	// body of a checkpoint which has been staged, but not yet published.
+	StagedCheckpointPath = "checkpoint.staged"
+
+	// StagedApprovalsPath is the location of the directory containing
+	// approvals of the staged checkpoint.
+	StagedApprovalsPath = "checkpoint.staged.approvals"
+
+	// CompactRangePath is the location of the file containing the compact
+	// range of the tree committed to by the checkpoint, as written by
+	// api.CompactRange.MarshalText, from which integration resumes hashing
+	// rather than reading the tiles on the right edge of the tree. It's
+	// derived from the tiles, so clients have no need of it.
+	CompactRangePath = "checkpoint.range"
+
+	// CheckpointTimePath is the location of the file containing the
+	// api.CheckpointTime of the latest checkpoint, signed by the log's
+	// timestamping key rather than the key which signs checkpoints.
+	CheckpointTimePath = "checkpoint.time"
+
+	// ManifestPath is the location of the file containing the signed log
+	// manifest.
+	ManifestPath = "manifest"
+
+	// ShardsPath is the location of the file containing the signed index of
+	// shards, in the root of a sharded log. Each shard is a log stored in the
+	// directory with the shard's name.
+	ShardsPath = "shards"
+
+	// LeasePath is the location of the file containing the api.Lease held by
+	// the integrator which is currently allowed to publish checkpoints, when
+	// several share the log's storage. It's operational state rather than
+	// part of the log, so is a dotfile, which backups skip.
+	LeasePath = ".integrator.lease"
+
+	// NamespacesPath is the location of the file containing the signed
+	// registry of identifier namespaces.
+	NamespacesPath = "namespaces"
+
+	// PublicKeyPath is the location of the file containing the log's note
+	// verifier key, published for clients which trust it on first use
+	// rather than getting it from somewhere else.
+	PublicKeyPath = "public_key"
+
+	// TimestampsDir is the location of the directory containing the
+	// timestamp log, which records the time at which each entry was
+	// sequenced.
+	TimestampsDir = "timestamps"
+
+	// RedactionsDir is the location of the directory containing the
+	// redaction log, which lists the records of the entries whose data is
+	// withheld.
+	RedactionsDir = "redactions"
+
+	// SubmissionsDir is the location of the directory into which entries may
+	// be dropped to have them sequenced automatically, e.g. by an object
+	// storage event notification to the admin API.
+	SubmissionsDir = "submissions"
+
+	// AuditDir is the location of the directory containing the operator's
+	// audit records, such as who submitted each entry. They aren't part of
+	// the published log, and shouldn't be served to its clients.
+	AuditDir = "audit"
 )
 
 // SeqPath builds the directory path and relative filename for the entry at the given
@@ -43,19 +122,24 @@ func SeqPath(root string, seq uint64) (string, string) {
 		fmt.Sprintf("%02x", (seq>>8)&0xff),
 		fmt.Sprintf("%02x", seq&0xff),
 	}
-	d := filepath.Join(frag[:6]...)
+	d := path.Join(frag[:6]...)
 	return d, frag[6]
 }
 
 // SeqFromPath recovers a sequence number from the specified path.
-// The path must have been generated with the SeqPath method in this package.
+// The path must have been generated with the SeqPath method in this package,
+// but may have been converted to use the platform's path separator.
 func SeqFromPath(root, seqPath string) (uint64, error) {
-	seqDir := filepath.Join(root, "seq")
+	seqDir := path.Join(filepath.ToSlash(root), "seq")
+	seqPath = filepath.ToSlash(seqPath)
 	if !strings.HasPrefix(seqPath, seqDir) {
 		return 0, fmt.Errorf("invalid seqPath %q, doesn't start with prefix %q", seqPath, seqDir)
 	}
 	s := strings.TrimPrefix(seqPath, seqDir)
-	if s[0] != os.PathSeparator || s[3] != os.PathSeparator || s[6] != os.PathSeparator || s[9] != os.PathSeparator || s[12] != os.PathSeparator {
+	if len(s) != 15 {
+		return 0, fmt.Errorf("seqPath format invalid %q", s)
+	}
+	if s[0] != '/' || s[3] != '/' || s[6] != '/' || s[9] != '/' || s[12] != '/' {
 		return 0, fmt.Errorf("seqPath format invalid %q", s)
 	}
 	var b strings.Builder
@@ -76,10 +160,118 @@ func LeafPath(root string, leafhash []byte) (string, string) {
 		fmt.Sprintf("%02x", leafhash[2]),
 		fmt.Sprintf("%0x", leafhash[3:]),
 	}
-	d := filepath.Join(frag[:5]...)
+	d := path.Join(frag[:5]...)
 	return d, frag[5]
 }
 
+// IdentifiersPath builds the directory path and relative filename for the list
+// of identifiers associated with the entry with the given leafhash.
+func IdentifiersPath(root string, leafhash []byte) (string, string) {
+	d, f := LeafPath(root, leafhash)
+	return d, f + ".ids"
+}
+
+// ClaimPath builds the directory path and relative filename for the signed
+// claim to the identifiers associated with the entry with the given leafhash.
+func ClaimPath(root string, leafhash []byte) (string, string) {
+	d, f := LeafPath(root, leafhash)
+	return d, f + ".claim"
+}
+
+// ContentTypePath builds the directory path and relative filename for the
+// content type the entry with the given leafhash was tagged with.
+func ContentTypePath(root string, leafhash []byte) (string, string) {
+	d, f := LeafPath(root, leafhash)
+	return d, f + ".type"
+}
+
+// RequestPath builds the directory path and relative filename for the record
+// of the submission with the given request key, as returned by
+// api.RequestKey. Request records are kept alongside the pending entries,
+// since they're only used when sequencing.
+func RequestPath(root string, key []byte) (string, string) {
+	return keyPath(path.Join(root, "leaves", "requests"), key)
+}
+
+// NamespaceLeafPath builds the directory path and relative filename for the
+// sequence number of the instance of an entry submitted in a namespace, with
+// the given key as returned by api.NamespaceLeafKey. Like request records,
+// they're only used when sequencing.
+func NamespaceLeafPath(root string, key []byte) (string, string) {
+	return keyPath(path.Join(root, "leaves", "namespaces"), key)
+}
+
+// InstanceIdentifiersPath builds the directory path and relative filename for
+// the identifiers the entry at the given sequence number was submitted with,
+// as recorded by logs whose duplicate policy is api.DuplicatesPerNamespace.
+func InstanceIdentifiersPath(root string, seq uint64) (string, string) {
+	return SeqPath(path.Join(root, "leaves", "instances"), seq)
+}
+
+// TombstonePath builds the directory path and relative filename for the
+// tombstone served in place of the withheld data of the entry at the given
+// sequence number, which is its signed api.Redaction.
+func TombstonePath(root string, seq uint64) (string, string) {
+	return SeqPath(path.Join(root, "tombstones"), seq)
+}
+
+// SubmitterPath builds the directory path and relative filename for the
+// audit log of the submissions of the submitter with the given key, as
+// returned by api.SubmitterKey.
+func SubmitterPath(root string, key []byte) (string, string) {
+	return keyPath(path.Join(root, AuditDir, "submitters"), key)
+}
+
+// EntrySubmitterPath builds the directory path and relative filename for the
+// identity of the submitter of the entry at the given sequence number.
+func EntrySubmitterPath(root string, seq uint64) (string, string) {
+	return SeqPath(path.Join(root, AuditDir), seq)
+}
+
+// IndexPath builds the directory path and relative filename for the list of
+// entries associated with the identifier with the given key, as returned by
+// api.IdentifierKey.
+func IndexPath(root string, key []byte) (string, string) {
+	return keyPath(path.Join(root, "index"), key)
+}
+
+// MapPath builds the directory path and relative filename for the entry of
+// the identifier with the given key in the snapshot of the identifier map
+// built at the given log size.
+func MapPath(root string, size uint64, key []byte) (string, string) {
+	return keyPath(path.Join(root, "map", strconv.FormatUint(size, 10)), key)
+}
+
+// EntryPagePath builds the directory path and relative filename for the page
+// of an entry list with the given hash, as referenced by api.EntryPage. Pages
+// are shared by the snapshots of the identifier map which include them.
+func EntryPagePath(root string, hash []byte) (string, string) {
+	return keyPath(path.Join(root, "map", "pages"), hash)
+}
+
+// InclusionProofPath builds the directory path and relative filename for the
+// precomputed inclusion proof of the entry at the given index in the tree of
+// the given size. Proofs are stored in the JSON form of api.InclusionProof.
+func InclusionProofPath(root string, size, index uint64) (string, string) {
+	d, f := SeqPath("", index)
+	d = strings.TrimPrefix(d, "seq/")
+	return path.Join(root, "proof", "inclusion", strconv.FormatUint(size, 10), d), f + ".json"
+}
+
+// InventoryPath builds the directory path and relative filename for the
+// inventory of the log's files committed to by the checkpoint of the given
+// size, as described by api.Inventory.
+func InventoryPath(root string, size uint64) (string, string) {
+	return path.Join(root, "inventory"), strconv.FormatUint(size, 10)
+}
+
+// keyPath splits the hex encoding of key into a directory path and filename
+// under prefix, in the same way as LeafPath.
+func keyPath(prefix string, key []byte) (string, string) {
+	d := path.Join(prefix, fmt.Sprintf("%02x", key[0]), fmt.Sprintf("%02x", key[1]), fmt.Sprintf("%02x", key[2]))
+	return d, fmt.Sprintf("%0x", key[3:])
+}
+
 // TilePath builds the directory path and relative filename for the subtree tile with the
 // given level and index.
 // partialTileSize should be set to a non-zero number if the path to a partial tile
@@ -99,6 +291,44 @@ func TilePath(root string, level, index, partialTileSize uint64) (string, string
 		fmt.Sprintf("%02x", (index>>8)&0xff),
 		fmt.Sprintf("%02x%s", index&0xff, suffix),
 	}
-	d := filepath.Join(frag[:6]...)
+	d := path.Join(frag[:6]...)
 	return d, frag[6]
 }
+
+// ParseTilePath recovers the tile level, index, and partial tile size from the
+// given slash-separated tile path, relative to the root of the log.
+// The path must be of the form generated by the TilePath method in this
+// package, i.e. tile/<level>/<index>[.<partial tile size>], and partialTileSize
+// will be zero for fully populated tiles.
+func ParseTilePath(tilePath string) (level, index, partialTileSize uint64, err error) {
+	frag := strings.Split(tilePath, "/")
+	if len(frag) != 6 || frag[0] != "tile" {
+		return 0, 0, 0, fmt.Errorf("tile path %q has invalid format", tilePath)
+	}
+	if f, p, ok := strings.Cut(frag[5], "."); ok {
+		if len(p) != 2 {
+			return 0, 0, 0, fmt.Errorf("tile path %q has invalid partial tile suffix", tilePath)
+		}
+		if partialTileSize, err = strconv.ParseUint(p, 16, 64); err != nil || partialTileSize == 0 {
+			return 0, 0, 0, fmt.Errorf("tile path %q has invalid partial tile size %q", tilePath, p)
+		}
+		frag[5] = f
+	}
+	if len(frag[1]) != 2 {
+		return 0, 0, 0, fmt.Errorf("tile path %q has invalid level", tilePath)
+	}
+	if level, err = strconv.ParseUint(frag[1], 16, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("tile path %q has invalid level: %v", tilePath, err)
+	}
+	var b strings.Builder
+	for i, w := range []int{4, 2, 2, 2} {
+		if len(frag[i+2]) != w {
+			return 0, 0, 0, fmt.Errorf("tile path %q has invalid index component %q", tilePath, frag[i+2])
+		}
+		b.WriteString(frag[i+2])
+	}
+	if index, err = strconv.ParseUint(b.String(), 16, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("tile path %q has invalid index: %v", tilePath, err)
+	}
+	return level, index, partialTileSize, nil
+}
@@ -99,6 +99,16 @@ func TestSeqFromPath(t *testing.T) {
 			root:    "/lemons",
 			seqPath: "/lemons/12/4/56/78/90",
 			wantErr: true,
+		}, {
+			desc:    "truncated",
+			root:    "/lemons",
+			seqPath: "/lemons/seq",
+			wantErr: true,
+		}, {
+			desc:    "trailing junk",
+			root:    "/lemons",
+			seqPath: "/lemons/seq/12/34/56/78/90/12",
+			wantErr: true,
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
@@ -150,6 +160,41 @@ func TestLeafPath(t *testing.T) {
 	}
 }
 
+func TestInclusionProofPath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		size     uint64
+		index    uint64
+		wantDir  string
+		wantFile string
+	}{
+		{
+			root:     "/root/path",
+			size:     1,
+			index:    0,
+			wantDir:  "/root/path/proof/inclusion/1/00/00/00/00",
+			wantFile: "00.json",
+		}, {
+			root:     "",
+			size:     1000,
+			index:    0x1234567,
+			wantDir:  "proof/inclusion/1000/00/01/23/45",
+			wantFile: "67.json",
+		},
+	} {
+		desc := fmt.Sprintf("root %q size %d index %d", test.root, test.size, test.index)
+		t.Run(desc, func(t *testing.T) {
+			gotDir, gotFile := InclusionProofPath(test.root, test.size, test.index)
+			if gotDir != test.wantDir {
+				t.Errorf("Got dir %q want %q", gotDir, test.wantDir)
+			}
+			if gotFile != test.wantFile {
+				t.Errorf("got file %q want %q", gotFile, test.wantFile)
+			}
+		})
+	}
+}
+
 func TestTilePath(t *testing.T) {
 	for _, test := range []struct {
 		root     string
@@ -213,3 +258,166 @@ func TestTilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTilePath(t *testing.T) {
+	for _, test := range []struct {
+		path        string
+		wantLevel   uint64
+		wantIndex   uint64
+		wantPartial uint64
+		wantErr     bool
+	}{
+		{
+			path: "tile/00/0000/00/00/00",
+		}, {
+			path:        "tile/00/0000/00/00/00.01",
+			wantPartial: 1,
+		}, {
+			path:        "tile/10/1234/56/78/9a.07",
+			wantLevel:   0x10,
+			wantIndex:   0x123456789a,
+			wantPartial: 7,
+		}, {
+			path:    "tile/00/0000/00/00",
+			wantErr: true,
+		}, {
+			path:    "tile/00/0000/00/00/00/00",
+			wantErr: true,
+		}, {
+			path:    "leaves/00/0000/00/00/00",
+			wantErr: true,
+		}, {
+			path:    "tile/0/0000/00/00/00",
+			wantErr: true,
+		}, {
+			path:    "tile/00/000/00/00/00",
+			wantErr: true,
+		}, {
+			path:    "tile/00/0000/00/00/00.00",
+			wantErr: true,
+		}, {
+			path:    "tile/00/0000/00/00/00.1",
+			wantErr: true,
+		}, {
+			path:    "tile/00/0000/00/00/zz",
+			wantErr: true,
+		}, {
+			path:    "tile/00/0000/../00/00",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			level, index, partial, err := ParseTilePath(test.path)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseTilePath: got err %v, want err %t", err, test.wantErr)
+			}
+			if level != test.wantLevel || index != test.wantIndex || partial != test.wantPartial {
+				t.Errorf("ParseTilePath: got (%x, %x, %x), want (%x, %x, %x)", level, index, partial, test.wantLevel, test.wantIndex, test.wantPartial)
+			}
+		})
+	}
+}
+
+func FuzzParseTilePath(f *testing.F) {
+	for _, p := range []string{"tile/00/0000/00/00/00", "tile/00/0000/00/00/00.01", "tile/10/1234/56/78/9a.07"} {
+		f.Add(p)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		level, index, partial, err := ParseTilePath(p)
+		if err != nil {
+			return
+		}
+		d, f := TilePath("", level, index, partial)
+		l2, i2, p2, err := ParseTilePath(d + "/" + f)
+		if err != nil {
+			t.Fatalf("ParseTilePath(TilePath(%x, %x, %x)): %v", level, index, partial, err)
+		}
+		if l2 != level || i2 != index || p2 != partial {
+			t.Fatalf("Roundtrip got (%x, %x, %x), want (%x, %x, %x)", l2, i2, p2, level, index, partial)
+		}
+	})
+}
+
+func FuzzSeqFromPath(f *testing.F) {
+	f.Add("/bananas/seq/00/00/00/00/10")
+	f.Fuzz(func(t *testing.T, p string) {
+		// Must not panic.
+		_, _ = SeqFromPath("/bananas", p)
+	})
+}
+
+func TestInventoryPath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		size     uint64
+		wantDir  string
+		wantFile string
+	}{
+		{root: "/root/path", size: 1, wantDir: "/root/path/inventory", wantFile: "1"},
+		{root: "", size: 1000, wantDir: "inventory", wantFile: "1000"},
+	} {
+		t.Run(fmt.Sprintf("root %q size %d", test.root, test.size), func(t *testing.T) {
+			gotDir, gotFile := InventoryPath(test.root, test.size)
+			if gotDir != test.wantDir || gotFile != test.wantFile {
+				t.Errorf("Got %q, %q want %q, %q", gotDir, gotFile, test.wantDir, test.wantFile)
+			}
+		})
+	}
+}
+
+func TestEntrySubmitterPath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		seq      uint64
+		wantDir  string
+		wantFile string
+	}{
+		{root: "/root/path", seq: 0x1234, wantDir: "/root/path/audit/seq/00/00/00/12", wantFile: "34"},
+		{root: "", seq: 1, wantDir: "audit/seq/00/00/00/00", wantFile: "01"},
+	} {
+		t.Run(fmt.Sprintf("root %q seq %d", test.root, test.seq), func(t *testing.T) {
+			gotDir, gotFile := EntrySubmitterPath(test.root, test.seq)
+			if gotDir != test.wantDir || gotFile != test.wantFile {
+				t.Errorf("Got %q, %q want %q, %q", gotDir, gotFile, test.wantDir, test.wantFile)
+			}
+		})
+	}
+}
+
+func TestTombstonePath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		seq      uint64
+		wantDir  string
+		wantFile string
+	}{
+		{root: "/root/path", seq: 0x1234, wantDir: "/root/path/tombstones/seq/00/00/00/12", wantFile: "34"},
+		{root: "", seq: 1, wantDir: "tombstones/seq/00/00/00/00", wantFile: "01"},
+	} {
+		t.Run(fmt.Sprintf("root %q seq %d", test.root, test.seq), func(t *testing.T) {
+			gotDir, gotFile := TombstonePath(test.root, test.seq)
+			if gotDir != test.wantDir || gotFile != test.wantFile {
+				t.Errorf("Got %q, %q want %q, %q", gotDir, gotFile, test.wantDir, test.wantFile)
+			}
+		})
+	}
+}
+
+func TestInstanceIdentifiersPath(t *testing.T) {
+	for _, test := range []struct {
+		root     string
+		seq      uint64
+		wantDir  string
+		wantFile string
+	}{
+		{root: "/root/path", seq: 0x1234, wantDir: "/root/path/leaves/instances/seq/00/00/00/12", wantFile: "34"},
+		{root: "", seq: 1, wantDir: "leaves/instances/seq/00/00/00/00", wantFile: "01"},
+	} {
+		t.Run(fmt.Sprintf("root %q seq %d", test.root, test.seq), func(t *testing.T) {
+			gotDir, gotFile := InstanceIdentifiersPath(test.root, test.seq)
+			if gotDir != test.wantDir || gotFile != test.wantFile {
+				t.Errorf("Got %q, %q want %q, %q", gotDir, gotFile, test.wantDir, test.wantFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidPath is returned (wrapped) when a path or path component fails
+// validation.
+var ErrInvalidPath = errors.New("invalid path")
+
+// ValidatePath checks that p is a slash-separated path, relative to the root
+// of the log, which cannot refer to a location outside of that root.
+//
+// In addition to the rules of io/fs.ValidPath, the path must not be ".", and
+// must not contain backslashes, colons, or NUL bytes, since these can be
+// interpreted as separators, volume names, URL schemes, or terminators
+// depending on the platform and transport.
+func ValidatePath(p string) error {
+	if p == "." || !iofs.ValidPath(p) {
+		return fmt.Errorf("%w: %q", ErrInvalidPath, p)
+	}
+	if strings.ContainsAny(p, "\\:\x00") {
+		return fmt.Errorf("%w: %q contains disallowed characters", ErrInvalidPath, p)
+	}
+	return nil
+}
+
+// ValidateElement checks that e is suitable for use as a single element of a
+// path, e.g. a log ID used as a directory name.
+func ValidateElement(e string) error {
+	if err := ValidatePath(e); err != nil {
+		return err
+	}
+	if strings.Contains(e, "/") {
+		return fmt.Errorf("%w: %q contains a separator", ErrInvalidPath, e)
+	}
+	return nil
+}
+
+// ValidateLeafHash checks that lh is long enough to be used with LeafPath.
+func ValidateLeafHash(lh []byte) error {
+	if len(lh) < 4 {
+		return fmt.Errorf("%w: leafhash %x too short", ErrInvalidPath, lh)
+	}
+	return nil
+}
+
+// SafeJoin validates the slash-separated relative path p with ValidatePath,
+// and joins it onto root using the platform's path separator.
+func SafeJoin(root, p string) (string, error) {
+	if err := ValidatePath(p); err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(p)), nil
+}
+
+// IsWithin returns true if the path p is located inside the directory root.
+// Both paths should be absolute and have had any symlinks resolved.
+func IsWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
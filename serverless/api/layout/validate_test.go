@@ -0,0 +1,129 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	for _, test := range []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "checkpoint"},
+		{path: "tile/00/0000/00/00/00.01"},
+		{path: "leaves/ab/cd/ef/0123"},
+		{path: "logs/..hidden/checkpoint"},
+		{path: "", wantErr: true},
+		{path: ".", wantErr: true},
+		{path: "..", wantErr: true},
+		{path: "../checkpoint", wantErr: true},
+		{path: "tile/../../etc/passwd", wantErr: true},
+		{path: "tile/./00", wantErr: true},
+		{path: "/etc/passwd", wantErr: true},
+		{path: "//evil.example.com/checkpoint", wantErr: true},
+		{path: "tile//00", wantErr: true},
+		{path: "tile/", wantErr: true},
+		{path: "..\\..\\windows", wantErr: true},
+		{path: "C:/Windows", wantErr: true},
+		{path: "https://evil.example.com/checkpoint", wantErr: true},
+		{path: "checkpoint\x00.txt", wantErr: true},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			err := ValidatePath(test.path)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ValidatePath(%q): got err %v, want err %t", test.path, err, test.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("ValidatePath(%q): got err %v, want ErrInvalidPath", test.path, err)
+			}
+		})
+	}
+}
+
+func TestValidateElement(t *testing.T) {
+	for _, test := range []struct {
+		elem    string
+		wantErr bool
+	}{
+		{elem: "d1e2f9b1f65a1a9b5fd1c34e6f1d1ad3d0b4b5fb0a37e4d6a9f8e0f7d9d7c2a1"},
+		{elem: "a/b", wantErr: true},
+		{elem: "..", wantErr: true},
+		{elem: "", wantErr: true},
+	} {
+		t.Run(test.elem, func(t *testing.T) {
+			if err := ValidateElement(test.elem); (err != nil) != test.wantErr {
+				t.Fatalf("ValidateElement(%q): got err %v, want err %t", test.elem, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLeafHash(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		lh      []byte
+		wantErr bool
+	}{
+		{desc: "full", lh: make([]byte, 32)},
+		{desc: "minimum", lh: make([]byte, 4)},
+		{desc: "short", lh: make([]byte, 3), wantErr: true},
+		{desc: "nil", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := ValidateLeafHash(test.lh); (err != nil) != test.wantErr {
+				t.Fatalf("ValidateLeafHash(%x): got err %v, want err %t", test.lh, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	root := filepath.FromSlash("/log/root")
+	got, err := SafeJoin(root, "tile/00/0000/00/00/00")
+	if err != nil {
+		t.Fatalf("SafeJoin: %v", err)
+	}
+	if want := filepath.FromSlash("/log/root/tile/00/0000/00/00/00"); got != want {
+		t.Errorf("SafeJoin: got %q, want %q", got, want)
+	}
+	if _, err := SafeJoin(root, "../elsewhere"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("SafeJoin(../elsewhere): got err %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	root := filepath.FromSlash("/log/root")
+	for _, test := range []struct {
+		path string
+		want bool
+	}{
+		{path: "/log/root", want: true},
+		{path: "/log/root/tile/00", want: true},
+		{path: "/log/root/..data", want: true},
+		{path: "/log/rootkit/tile", want: false},
+		{path: "/log", want: false},
+		{path: "/etc/passwd", want: false},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			if got := IsWithin(root, filepath.FromSlash(test.path)); got != test.want {
+				t.Errorf("IsWithin(%q, %q): got %t, want %t", root, test.path, got, test.want)
+			}
+		})
+	}
+}
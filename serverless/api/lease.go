@@ -0,0 +1,100 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LeaseHeaderV0 is the first line of a marshaled integrator lease.
+const LeaseHeaderV0 = "Serverless Log Integrator Lease v0"
+
+// MaxLeaseHolderLen is the maximum length in bytes of the identity of the
+// holder of a lease.
+const MaxLeaseHolderLen = 256
+
+// Lease records which of several integrators sharing a log's storage is the
+// leader, the only one allowed to publish checkpoints, until it expires.
+type Lease struct {
+	// Holder identifies the integrator holding the lease, such as its host
+	// name. It must be non-empty, no longer than MaxLeaseHolderLen, and a
+	// single line.
+	Holder string
+	// Token is the lease's fencing token. It increases each time the lease is
+	// taken by a new holder, or taken again after it has expired, so a
+	// checkpoint written on behalf of an earlier token can be rejected.
+	Token uint64
+	// Expires is when the lease expires, unless it's renewed by its holder.
+	Expires time.Time
+}
+
+// Marshal returns the serialised form of the lease, in the following format:
+//
+// Serverless Log Integrator Lease v0\n
+// <holder>\n
+// <token>\n
+// <expiry in unix nanoseconds>\n
+func (l Lease) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%d\n%d\n", LeaseHeaderV0, l.Holder, l.Token, l.Expires.UnixNano())
+	return b.Bytes()
+}
+
+// ParseLease parses and validates the serialised form of a lease, as written
+// by Lease.Marshal.
+func ParseLease(raw []byte) (*Lease, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("lease must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("lease has %d lines, want 4", len(lines))
+	}
+	if lines[0] != LeaseHeaderV0 {
+		return nil, fmt.Errorf("invalid lease header %q", lines[0])
+	}
+	l := &Lease{Holder: lines[1]}
+	if err := ValidateLeaseHolder(l.Holder); err != nil {
+		return nil, err
+	}
+	var err error
+	if l.Token, err = strconv.ParseUint(lines[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid lease token %q: %w", lines[2], err)
+	}
+	nanos, err := strconv.ParseInt(lines[3], 10, 64)
+	if err != nil || nanos < 0 {
+		return nil, fmt.Errorf("invalid lease expiry %q", lines[3])
+	}
+	l.Expires = time.Unix(0, nanos)
+	return l, nil
+}
+
+// ValidateLeaseHolder checks that id may be used as the identity of the holder
+// of a lease.
+func ValidateLeaseHolder(id string) error {
+	if len(id) == 0 || len(id) > MaxLeaseHolderLen {
+		return fmt.Errorf("invalid lease holder length %d", len(id))
+	}
+	if strings.ContainsAny(id, "\r\n") {
+		return errors.New("lease holder must be a single line")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseLease(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.Lease
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "Serverless Log Integrator Lease v0\nintegrator-1\n7\n1700000000500000000\n",
+			want: &api.Lease{Holder: "integrator-1", Token: 7, Expires: time.Unix(1700000000, 500000000)},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Checkpoint Time v0\nintegrator-1\n7\n1700000000500000000\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Integrator Lease v0\nintegrator-1\n7\n1700000000500000000",
+			wantErr: true,
+		}, {
+			desc:    "empty holder",
+			raw:     "Serverless Log Integrator Lease v0\n\n7\n1700000000500000000\n",
+			wantErr: true,
+		}, {
+			desc:    "long holder",
+			raw:     "Serverless Log Integrator Lease v0\n" + strings.Repeat("a", api.MaxLeaseHolderLen+1) + "\n7\n1700000000500000000\n",
+			wantErr: true,
+		}, {
+			desc:    "bad token",
+			raw:     "Serverless Log Integrator Lease v0\nintegrator-1\n-7\n1700000000500000000\n",
+			wantErr: true,
+		}, {
+			desc:    "negative expiry",
+			raw:     "Serverless Log Integrator Lease v0\nintegrator-1\n7\n-1\n",
+			wantErr: true,
+		}, {
+			desc:    "missing expiry",
+			raw:     "Serverless Log Integrator Lease v0\nintegrator-1\n7\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			l, err := api.ParseLease([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLease: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(l, test.want); len(diff) != 0 {
+				t.Errorf("ParseLease had diff %s", diff)
+			}
+			if l != nil {
+				if got := string(l.Marshal()); got != test.raw {
+					t.Errorf("Marshal = %q, want %q", got, test.raw)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogListHeaderV0 is the first line of a marshaled log list.
+const LogListHeaderV0 = "Serverless Log List v0"
+
+// LogList describes the logs a relying party trusts, and how to verify them.
+// It's published signed by whoever maintains it, so that relying parties can
+// be configured for many logs with a single key.
+type LogList struct {
+	// Name identifies the list, and is checked when it's opened so that
+	// one list signed by a key can't be substituted for another.
+	Name string
+	// Logs holds the logs in the list, whose origins are unique.
+	Logs []LogListEntry
+}
+
+// LogListEntry describes a single log in a log list.
+type LogListEntry struct {
+	// Origin is the origin of the log's checkpoints.
+	Origin string
+	// URL is the location of the root of the log.
+	URL string
+	// PublicKey is the note verifier key of the log.
+	PublicKey string
+	// Witnesses holds the note verifier keys of the witnesses trusted to
+	// cosign the log's checkpoints, and WitnessQuorum is how many of them
+	// must have cosigned a checkpoint before it's trusted. A quorum of 0
+	// means checkpoints are trusted on the log's signature alone.
+	Witnesses     []string
+	WitnessQuorum int
+	// Distributors holds the URLs of the distributors from which cosigned
+	// checkpoints of the log are fetched.
+	Distributors []string
+}
+
+// Find returns the entry for the log with the given origin, or nil if there
+// isn't one.
+func (l LogList) Find(origin string) *LogListEntry {
+	for i := range l.Logs {
+		if l.Logs[i].Origin == origin {
+			return &l.Logs[i]
+		}
+	}
+	return nil
+}
+
+// Marshal returns the serialised form of the log list, in the following
+// format:
+//
+// Serverless Log List v0\n
+// <name>\n
+// log <origin>\n
+// url <url>\n
+// key <verifier key>\n
+// [witness <verifier key>\n]
+// ...
+// [witness-quorum <n>\n]
+// [distributor <url>\n]
+// ...
+// log <origin>\n
+// ...
+//
+// Each log line starts the entry for a log, and the key/value lines which
+// follow it, up to the next log line, describe that log. Parsers ignore
+// unknown keys so that fields can be added in future.
+func (l LogList) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n", LogListHeaderV0, l.Name)
+	for _, e := range l.Logs {
+		fmt.Fprintf(b, "log %s\nurl %s\nkey %s\n", e.Origin, e.URL, e.PublicKey)
+		for _, w := range e.Witnesses {
+			fmt.Fprintf(b, "witness %s\n", w)
+		}
+		if e.WitnessQuorum > 0 {
+			fmt.Fprintf(b, "witness-quorum %d\n", e.WitnessQuorum)
+		}
+		for _, d := range e.Distributors {
+			fmt.Fprintf(b, "distributor %s\n", d)
+		}
+	}
+	return b.Bytes()
+}
+
+// ParseLogList parses and validates the serialised form of a log list, as
+// written by LogList.Marshal.
+func ParseLogList(raw []byte) (*LogList, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("log list must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("log list is too short")
+	}
+	if lines[0] != LogListHeaderV0 {
+		return nil, fmt.Errorf("invalid log list header %q", lines[0])
+	}
+	l := &LogList{Name: lines[1]}
+	if len(l.Name) == 0 {
+		return nil, errors.New("log list has empty name")
+	}
+	var e *LogListEntry
+	// seen holds the single-valued keys of the current entry.
+	seen := make(map[string]bool)
+	for _, line := range lines[2:] {
+		k, v, ok := strings.Cut(line, " ")
+		if !ok || len(k) == 0 || len(v) == 0 {
+			return nil, fmt.Errorf("invalid log list line %q", line)
+		}
+		if k == "log" {
+			if l.Find(v) != nil {
+				return nil, fmt.Errorf("duplicate log %q", v)
+			}
+			l.Logs = append(l.Logs, LogListEntry{Origin: v})
+			e = &l.Logs[len(l.Logs)-1]
+			seen = make(map[string]bool)
+			continue
+		}
+		if e == nil {
+			return nil, fmt.Errorf("log list line %q precedes the first log", line)
+		}
+		switch k {
+		case "witness":
+			e.Witnesses = append(e.Witnesses, v)
+			continue
+		case "distributor":
+			e.Distributors = append(e.Distributors, v)
+			continue
+		}
+		if seen[k] {
+			return nil, fmt.Errorf("duplicate key %q for log %q", k, e.Origin)
+		}
+		seen[k] = true
+		switch k {
+		case "url":
+			e.URL = v
+		case "key":
+			e.PublicKey = v
+		case "witness-quorum":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid witness quorum %q for log %q", v, e.Origin)
+			}
+			e.WitnessQuorum = n
+		}
+	}
+	for _, e := range l.Logs {
+		if len(e.URL) == 0 {
+			return nil, fmt.Errorf("log %q has no url", e.Origin)
+		}
+		if len(e.PublicKey) == 0 {
+			return nil, fmt.Errorf("log %q has no key", e.Origin)
+		}
+		if e.WitnessQuorum > len(e.Witnesses) {
+			return nil, fmt.Errorf("log %q has witness quorum %d but only %d witnesses", e.Origin, e.WitnessQuorum, len(e.Witnesses))
+		}
+		if e.WitnessQuorum > 0 && len(e.Distributors) == 0 {
+			return nil, fmt.Errorf("log %q has a witness quorum but no distributors", e.Origin)
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseLogList(t *testing.T) {
+	const (
+		header = "Serverless Log List v0\nMy List\n"
+		logA   = "log Log A\nurl https://a.example.com/\nkey a+12345678+AAAA\n"
+	)
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.LogList
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+			raw:  header,
+			want: &api.LogList{Name: "My List"},
+		}, {
+			desc: "valid",
+			raw:  header + logA + "log Log B\nurl https://b.example.com/\nkey b+12345678+BBBB\nwitness w1+12345678+CCCC\nwitness w2+12345678+DDDD\nwitness-quorum 1\ndistributor https://d.example.com/\n",
+			want: &api.LogList{
+				Name: "My List",
+				Logs: []api.LogListEntry{
+					{Origin: "Log A", URL: "https://a.example.com/", PublicKey: "a+12345678+AAAA"},
+					{
+						Origin:        "Log B",
+						URL:           "https://b.example.com/",
+						PublicKey:     "b+12345678+BBBB",
+						Witnesses:     []string{"w1+12345678+CCCC", "w2+12345678+DDDD"},
+						WitnessQuorum: 1,
+						Distributors:  []string{"https://d.example.com/"},
+					},
+				},
+			},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Manifest v0\nMy List\n" + logA,
+			wantErr: true,
+		}, {
+			desc:    "empty name",
+			raw:     "Serverless Log List v0\n\n" + logA,
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     header + "log Log A\nurl https://a.example.com/\nkey a+12345678+AAAA",
+			wantErr: true,
+		}, {
+			desc:    "key before log",
+			raw:     header + "url https://a.example.com/\n" + logA,
+			wantErr: true,
+		}, {
+			desc:    "duplicate log",
+			raw:     header + logA + logA,
+			wantErr: true,
+		}, {
+			desc:    "duplicate key",
+			raw:     header + logA + "url https://other.example.com/\n",
+			wantErr: true,
+		}, {
+			desc:    "no url",
+			raw:     header + "log Log A\nkey a+12345678+AAAA\n",
+			wantErr: true,
+		}, {
+			desc:    "no key",
+			raw:     header + "log Log A\nurl https://a.example.com/\n",
+			wantErr: true,
+		}, {
+			desc:    "quorum too large",
+			raw:     header + logA + "witness w1+12345678+CCCC\nwitness-quorum 2\ndistributor https://d.example.com/\n",
+			wantErr: true,
+		}, {
+			desc:    "quorum without distributors",
+			raw:     header + logA + "witness w1+12345678+CCCC\nwitness-quorum 1\n",
+			wantErr: true,
+		}, {
+			desc:    "bad quorum",
+			raw:     header + logA + "witness w1+12345678+CCCC\nwitness-quorum 0\ndistributor https://d.example.com/\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			l, err := api.ParseLogList([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLogList: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(l, test.want); len(diff) != 0 {
+				t.Errorf("ParseLogList had diff %s", diff)
+			}
+			if l != nil {
+				if got := string(l.Marshal()); got != test.raw {
+					t.Errorf("Marshal = %q, want %q", got, test.raw)
+				}
+			}
+		})
+	}
+}
+
+func TestLogListUnknownKeys(t *testing.T) {
+	l, err := api.ParseLogList([]byte("Serverless Log List v0\nMy List\nlog Log A\nurl https://a.example.com/\nkey a+12345678+AAAA\ncolour blue\n"))
+	if err != nil {
+		t.Fatalf("ParseLogList: %v", err)
+	}
+	if e := l.Find("Log A"); e == nil || e.URL != "https://a.example.com/" {
+		t.Errorf("Find(Log A) = %+v", e)
+	}
+	if e := l.Find("Log B"); e != nil {
+		t.Errorf("Find(Log B) = %+v, want nil", e)
+	}
+}
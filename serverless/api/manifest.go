@@ -0,0 +1,452 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestHeaderV0 is the first line of a marshaled log manifest.
+const ManifestHeaderV0 = "Serverless Log Manifest v0"
+
+// LogState describes the lifecycle state of a log.
+type LogState string
+
+const (
+	// StateActive logs accept and integrate new entries.
+	StateActive LogState = "active"
+	// StateFrozen logs are paused: they accept no new entries, and don't
+	// integrate entries which have already been sequenced. A frozen log may
+	// later be made active again.
+	StateFrozen LogState = "frozen"
+	// StateReadOnly logs accept no new entries, but still integrate any which
+	// were sequenced before the log was made read-only. This state is final.
+	StateReadOnly LogState = "read-only"
+)
+
+// AcceptsEntries returns true if new entries may be sequenced into a log in
+// this state.
+func (s LogState) AcceptsEntries() bool {
+	return s == StateActive
+}
+
+// Integrates returns true if sequenced entries may be integrated into a log in
+// this state.
+func (s LogState) Integrates() bool {
+	return s == StateActive || s == StateReadOnly
+}
+
+// CanBecome returns true if a log in this state may move to state t.
+func (s LogState) CanBecome(t LogState) bool {
+	return s != StateReadOnly || t == StateReadOnly
+}
+
+// Valid returns true if s is a known log state.
+func (s LogState) Valid() bool {
+	switch s {
+	case StateActive, StateFrozen, StateReadOnly:
+		return true
+	}
+	return false
+}
+
+// DuplicatePolicy describes how a log handles the submission of an entry which
+// it already contains.
+type DuplicatePolicy string
+
+const (
+	// DuplicatesReject logs don't add the entry again, and report the
+	// submission as a duplicate, along with the index of the original. This
+	// is the policy of logs whose manifest doesn't specify one.
+	DuplicatesReject DuplicatePolicy = "reject"
+	// DuplicatesOriginal logs don't add the entry again, and treat the
+	// submission as successful, returning the index of the original.
+	DuplicatesOriginal DuplicatePolicy = "original"
+	// DuplicatesAllow logs add the entry again at a new index. Looking the
+	// entry up by its leaf hash finds the first instance.
+	DuplicatesAllow DuplicatePolicy = "allow"
+	// DuplicatesPerNamespace logs reject the entry as a duplicate, as for
+	// DuplicatesReject, only if an earlier instance of it was submitted with
+	// an identifier in the same namespace as one it's submitted with, and
+	// otherwise add it again at a new index, associated with its own
+	// identifiers. Entries submitted without identifiers are duplicates of
+	// earlier instances submitted without them. This suits logs shared by
+	// tenants with a namespace each. Looking the entry up by its leaf hash
+	// finds the first instance, along with its identifiers.
+	DuplicatesPerNamespace DuplicatePolicy = "namespace"
+)
+
+// Valid returns true if p is a known duplicate policy.
+func (p DuplicatePolicy) Valid() bool {
+	switch p {
+	case DuplicatesReject, DuplicatesOriginal, DuplicatesAllow, DuplicatesPerNamespace:
+		return true
+	}
+	return false
+}
+
+// PartialTiles describes whether a log stores the partial tiles on the right
+// edge of its tree.
+type PartialTiles string
+
+const (
+	// PartialTilesStored logs store every partial tile, so that any tile a
+	// reader needs can be fetched with one request. This is the behaviour of
+	// logs whose manifest doesn't say.
+	PartialTilesStored PartialTiles = "stored"
+	// PartialTilesDerived logs only store full tiles. Readers derive the
+	// partial tiles they need from the leaves of the tile, i.e. the entries
+	// for level 0 and the roots of the full tiles below it otherwise, as
+	// client.DerivePartialTile does. This saves storing an object per tile
+	// per checkpoint, at the cost of more reads for the right edge of the
+	// tree.
+	PartialTilesDerived PartialTiles = "derived"
+)
+
+// Valid returns true if p is a known partial tiles mode.
+func (p PartialTiles) Valid() bool {
+	return p == PartialTilesStored || p == PartialTilesDerived
+}
+
+// Manifest describes a log, and is published alongside its checkpoint signed
+// by the log's key.
+type Manifest struct {
+	// Origin is the origin of the log's checkpoints.
+	Origin string
+	// State is the lifecycle state of the log.
+	State LogState
+	// Reason is an optional human readable explanation of the state.
+	Reason string
+	// Created is the time at which the log was created, if known.
+	Created time.Time
+	// Final is set once a log has been closed, and references its final
+	// checkpoint.
+	Final *CheckpointRef
+	// Successor, if set, identifies the log which took over from this one
+	// when it was closed.
+	Successor *LogLink
+	// Predecessor, if set, identifies the log which this one took over from.
+	// Its Final field references the predecessor's final checkpoint.
+	Predecessor *LogLink
+	// Immutable is set if the log uses the immutable layout, in which no
+	// file for which layout.Immutable returns true is ever rewritten once
+	// published, so that they can safely be cached indefinitely.
+	Immutable bool
+	// Duplicates is the log's duplicate policy. If empty, it's
+	// DuplicatesReject.
+	Duplicates DuplicatePolicy
+	// Timestamps is set if the log publishes the time at which each entry
+	// was sequenced, in the timestamp log stored in layout.TimestampsDir.
+	Timestamps bool
+	// ContentTypes, if set, are the content types of the entries the log
+	// accepts, as checked by ValidateContentType. Each entry is tagged with
+	// its type when it's sequenced.
+	ContentTypes []string
+	// PrefixIndex, if non-zero, is the number of leading bytes of each entry
+	// by which the log indexes it, under the identifier returned by
+	// PrefixIdentifier, for entries which start with structured
+	// identifiers. Entries shorter than this aren't indexed by prefix.
+	PrefixIndex int
+	// IndexFormat is the format of the log's identifier index, i.e. of its
+	// entry lists, their pages and its map entries. If empty, it's
+	// IndexFormatJSON. Lists are parsed in whichever format they're in, so
+	// readers only need it to know whether they support the log's index.
+	IndexFormat IndexFormat
+	// PartialTiles says whether the log stores its partial tiles. If empty,
+	// it's PartialTilesStored.
+	PartialTiles PartialTiles
+}
+
+// immutableLayout is the value of the layout key of the manifest of a log
+// which uses the immutable layout.
+const immutableLayout = "immutable"
+
+// CheckpointRef references a checkpoint of a log by its size and root hash.
+type CheckpointRef struct {
+	Size uint64
+	Hash []byte
+}
+
+// LogLink identifies a log related to the one described by a manifest.
+type LogLink struct {
+	// Origin is the origin of the linked log's checkpoints.
+	Origin string
+	// PublicKey is the note verifier key of the linked log.
+	PublicKey string
+	// URL is the optional location of the root of the linked log, and may be
+	// relative to the root of the log described by the manifest.
+	URL string
+	// Final references the final checkpoint of the linked log, if it has
+	// been closed.
+	Final *CheckpointRef
+}
+
+// Marshal returns the serialised form of the manifest, in the following
+// format:
+//
+// Serverless Log Manifest v0\n
+// <origin>\n
+// state <state>\n
+// [reason <reason>\n]
+// [created <unix seconds>\n]
+// [final <size> <base64 root hash>\n]
+// [successor <origin>\n]
+// [successor-key <verifier key>\n]
+// [successor-url <url>\n]
+// [predecessor <origin>\n]
+// [predecessor-key <verifier key>\n]
+// [predecessor-url <url>\n]
+// [predecessor-final <size> <base64 root hash>\n]
+// [layout immutable\n]
+// [duplicates <policy>\n]
+// [timestamps on\n]
+// [content-types <content type> [<content type> ...]\n]
+// [prefix-index <length>\n]
+// [index-format <format>\n]
+// [partial-tiles <mode>\n]
+//
+// A successor or predecessor must have a key, and a predecessor must have a
+// final checkpoint.
+//
+// Lines after the origin are key/value pairs, and parsers ignore unknown keys
+// so that fields can be added in future.
+func (m Manifest) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\nstate %s\n", ManifestHeaderV0, m.Origin, m.State)
+	if len(m.Reason) > 0 {
+		fmt.Fprintf(b, "reason %s\n", m.Reason)
+	}
+	if !m.Created.IsZero() {
+		fmt.Fprintf(b, "created %d\n", m.Created.Unix())
+	}
+	if m.Final != nil {
+		fmt.Fprintf(b, "final %s\n", m.Final)
+	}
+	if l := m.Successor; l != nil {
+		fmt.Fprintf(b, "successor %s\nsuccessor-key %s\n", l.Origin, l.PublicKey)
+		if len(l.URL) > 0 {
+			fmt.Fprintf(b, "successor-url %s\n", l.URL)
+		}
+	}
+	if l := m.Predecessor; l != nil {
+		fmt.Fprintf(b, "predecessor %s\npredecessor-key %s\n", l.Origin, l.PublicKey)
+		if len(l.URL) > 0 {
+			fmt.Fprintf(b, "predecessor-url %s\n", l.URL)
+		}
+		if l.Final != nil {
+			fmt.Fprintf(b, "predecessor-final %s\n", l.Final)
+		}
+	}
+	if m.Immutable {
+		fmt.Fprintf(b, "layout %s\n", immutableLayout)
+	}
+	if len(m.Duplicates) > 0 {
+		fmt.Fprintf(b, "duplicates %s\n", m.Duplicates)
+	}
+	if m.Timestamps {
+		b.WriteString("timestamps on\n")
+	}
+	if len(m.ContentTypes) > 0 {
+		fmt.Fprintf(b, "content-types %s\n", strings.Join(m.ContentTypes, " "))
+	}
+	if m.PrefixIndex > 0 {
+		fmt.Fprintf(b, "prefix-index %d\n", m.PrefixIndex)
+	}
+	if len(m.IndexFormat) > 0 {
+		fmt.Fprintf(b, "index-format %s\n", m.IndexFormat)
+	}
+	if len(m.PartialTiles) > 0 {
+		fmt.Fprintf(b, "partial-tiles %s\n", m.PartialTiles)
+	}
+	return b.Bytes()
+}
+
+// String returns the serialised form of the reference used in manifests.
+func (r CheckpointRef) String() string {
+	return fmt.Sprintf("%d %s", r.Size, base64.StdEncoding.EncodeToString(r.Hash))
+}
+
+func parseCheckpointRef(v string) (*CheckpointRef, error) {
+	size, hash, ok := strings.Cut(v, " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid checkpoint reference %q", v)
+	}
+	r := &CheckpointRef{}
+	var err error
+	if r.Size, err = strconv.ParseUint(size, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint reference size %q: %w", size, err)
+	}
+	if r.Hash, err = base64.StdEncoding.DecodeString(hash); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint reference hash %q: %w", hash, err)
+	}
+	if len(r.Hash) != HashSize {
+		return nil, fmt.Errorf("checkpoint reference hash has length %d, want %d", len(r.Hash), HashSize)
+	}
+	return r, nil
+}
+
+// ParseManifest parses and validates the serialised form of a manifest, as
+// written by Manifest.Marshal.
+func ParseManifest(raw []byte) (*Manifest, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("manifest must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("manifest is too short")
+	}
+	if lines[0] != ManifestHeaderV0 {
+		return nil, fmt.Errorf("invalid manifest header %q", lines[0])
+	}
+	m := &Manifest{Origin: lines[1]}
+	if len(m.Origin) == 0 {
+		return nil, errors.New("manifest has empty origin")
+	}
+	kv := make(map[string]string)
+	for _, l := range lines[2:] {
+		k, v, ok := strings.Cut(l, " ")
+		if !ok || len(k) == 0 || len(v) == 0 {
+			return nil, fmt.Errorf("invalid manifest line %q", l)
+		}
+		if _, ok := kv[k]; ok {
+			return nil, fmt.Errorf("duplicate manifest key %q", k)
+		}
+		kv[k] = v
+	}
+
+	v, ok := kv["state"]
+	if !ok {
+		return nil, errors.New("manifest has no state")
+	}
+	m.State = LogState(v)
+	if !m.State.Valid() {
+		return nil, fmt.Errorf("unknown log state %q", v)
+	}
+	m.Reason = kv["reason"]
+	if v, ok := kv["created"]; ok {
+		t, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation time %q: %w", v, err)
+		}
+		m.Created = time.Unix(t, 0)
+	}
+	if v, ok := kv["final"]; ok {
+		r, err := parseCheckpointRef(v)
+		if err != nil {
+			return nil, err
+		}
+		m.Final = r
+	}
+	if v, ok := kv["layout"]; ok {
+		// Clients which misunderstood the layout could cache files which
+		// change, so unknown layouts are rejected rather than ignored.
+		if v != immutableLayout {
+			return nil, fmt.Errorf("unknown log layout %q", v)
+		}
+		m.Immutable = true
+	}
+	if v, ok := kv["duplicates"]; ok {
+		// Tools which misunderstood the policy could squash entries which
+		// should be added, or the reverse, so unknown policies are rejected.
+		m.Duplicates = DuplicatePolicy(v)
+		if !m.Duplicates.Valid() {
+			return nil, fmt.Errorf("unknown duplicate policy %q", v)
+		}
+	}
+	if v, ok := kv["timestamps"]; ok {
+		if v != "on" {
+			return nil, fmt.Errorf("invalid timestamps value %q", v)
+		}
+		m.Timestamps = true
+	}
+	var err error
+	if v, ok := kv["content-types"]; ok {
+		if m.ContentTypes, err = parseContentTypes(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := kv["prefix-index"]; ok {
+		// Clients searching with the wrong length would miss entries, so
+		// invalid lengths are rejected rather than ignored.
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > MaxPrefixIndexLen {
+			return nil, fmt.Errorf("invalid prefix index length %q", v)
+		}
+		m.PrefixIndex = n
+	}
+	if v, ok := kv["index-format"]; ok {
+		// Readers which don't support the format can't use the index, so
+		// unknown formats are rejected.
+		m.IndexFormat = IndexFormat(v)
+		if !m.IndexFormat.Valid() {
+			return nil, fmt.Errorf("unknown index format %q", v)
+		}
+	}
+	if v, ok := kv["partial-tiles"]; ok {
+		// Readers which expected partial tiles to be stored would fail to
+		// find them, so unknown modes are rejected.
+		m.PartialTiles = PartialTiles(v)
+		if !m.PartialTiles.Valid() {
+			return nil, fmt.Errorf("unknown partial tiles mode %q", v)
+		}
+	}
+	if m.Successor, err = parseLogLink(kv, "successor"); err != nil {
+		return nil, err
+	}
+	if m.Predecessor, err = parseLogLink(kv, "predecessor"); err != nil {
+		return nil, err
+	}
+	if m.Predecessor != nil && m.Predecessor.Final == nil {
+		return nil, errors.New("manifest has no predecessor-final")
+	}
+	if m.Successor != nil && m.Successor.Final != nil {
+		return nil, errors.New("manifest has unexpected successor-final")
+	}
+	return m, nil
+}
+
+// parseLogLink parses the log link with the given name prefix from the
+// manifest key/value pairs, returning nil if there is none.
+func parseLogLink(kv map[string]string, name string) (*LogLink, error) {
+	l := &LogLink{
+		Origin:    kv[name],
+		PublicKey: kv[name+"-key"],
+		URL:       kv[name+"-url"],
+	}
+	if v, ok := kv[name+"-final"]; ok {
+		r, err := parseCheckpointRef(v)
+		if err != nil {
+			return nil, err
+		}
+		l.Final = r
+	}
+	if len(l.Origin) == 0 {
+		if len(l.PublicKey) > 0 || len(l.URL) > 0 || l.Final != nil {
+			return nil, fmt.Errorf("manifest has %s details, but no %s", name, name)
+		}
+		return nil, nil
+	}
+	if len(l.PublicKey) == 0 {
+		return nil, fmt.Errorf("manifest has no %s-key", name)
+	}
+	return l, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseManifest(t *testing.T) {
+	const (
+		hashB64 = "0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="
+		key     = "astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b"
+	)
+	hash, err := base64.StdEncoding.DecodeString(hashB64)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.Manifest
+		wantErr bool
+	}{
+		{
+			desc: "active",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive},
+		}, {
+			desc: "read-only with reason",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\nreason superseded by Log Checkpoint v1\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateReadOnly, Reason: "superseded by Log Checkpoint v1"},
+		}, {
+			desc: "unknown keys ignored",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nbanana yellow\nstate frozen\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateFrozen},
+		}, {
+			desc: "closed with successor",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\ncreated 1680000000\nfinal 10 " + hashB64 + "\nsuccessor Log Checkpoint v1\nsuccessor-key " + key + "\nsuccessor-url ../v1/\n",
+			want: &api.Manifest{
+				Origin:    "Log Checkpoint v0",
+				State:     api.StateReadOnly,
+				Created:   time.Unix(1680000000, 0),
+				Final:     &api.CheckpointRef{Size: 10, Hash: hash},
+				Successor: &api.LogLink{Origin: "Log Checkpoint v1", PublicKey: key, URL: "../v1/"},
+			},
+		}, {
+			desc: "with predecessor",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v1\nstate active\npredecessor Log Checkpoint v0\npredecessor-key " + key + "\npredecessor-final 10 " + hashB64 + "\n",
+			want: &api.Manifest{
+				Origin:      "Log Checkpoint v1",
+				State:       api.StateActive,
+				Predecessor: &api.LogLink{Origin: "Log Checkpoint v0", PublicKey: key, Final: &api.CheckpointRef{Size: 10, Hash: hash}},
+			},
+		}, {
+			desc: "immutable layout",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nlayout immutable\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, Immutable: true},
+		}, {
+			desc: "duplicate policy",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nduplicates allow\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, Duplicates: api.DuplicatesAllow},
+		}, {
+			desc:    "unknown duplicate policy",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nduplicates sometimes\n",
+			wantErr: true,
+		}, {
+			desc: "timestamps",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\ntimestamps on\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, Timestamps: true},
+		}, {
+			desc:    "invalid timestamps",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\ntimestamps off\n",
+			wantErr: true,
+		}, {
+			desc: "content types",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\ncontent-types application/vnd.in-toto+json application/spdx+json\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, ContentTypes: []string{api.ContentTypeInToto, api.ContentTypeSPDX}},
+		}, {
+			desc:    "invalid content type",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\ncontent-types text/plain;charset=utf-8\n",
+			wantErr: true,
+		}, {
+			desc:    "duplicate content type",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\ncontent-types text/plain text/plain\n",
+			wantErr: true,
+		}, {
+			desc: "prefix index",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nprefix-index 8\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, PrefixIndex: 8},
+		}, {
+			desc:    "prefix index too long",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nprefix-index 33\n",
+			wantErr: true,
+		}, {
+			desc:    "zero prefix index",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nprefix-index 0\n",
+			wantErr: true,
+		}, {
+			desc: "binary index format",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nindex-format binary\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, IndexFormat: api.IndexFormatBinary},
+		}, {
+			desc:    "unknown index format",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nindex-format cbor\n",
+			wantErr: true,
+		}, {
+			desc: "derived partial tiles",
+			raw:  "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\npartial-tiles derived\n",
+			want: &api.Manifest{Origin: "Log Checkpoint v0", State: api.StateActive, PartialTiles: api.PartialTilesDerived},
+		}, {
+			desc:    "unknown partial tiles mode",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\npartial-tiles sometimes\n",
+			wantErr: true,
+		}, {
+			desc:    "unknown layout",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nlayout sideways\n",
+			wantErr: true,
+		}, {
+			desc:    "predecessor without final",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v1\nstate active\npredecessor Log Checkpoint v0\npredecessor-key " + key + "\n",
+			wantErr: true,
+		}, {
+			desc:    "successor without key",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\nsuccessor Log Checkpoint v1\n",
+			wantErr: true,
+		}, {
+			desc:    "successor url without successor",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\nsuccessor-url ../v1/\n",
+			wantErr: true,
+		}, {
+			desc:    "bad final hash",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\nfinal 10 YmFuYW5h\n",
+			wantErr: true,
+		}, {
+			desc:    "bad final size",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\nfinal -1 " + hashB64 + "\n",
+			wantErr: true,
+		}, {
+			desc:    "bad created",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\ncreated yesterday\n",
+			wantErr: true,
+		}, {
+			desc:    "empty",
+			raw:     "",
+			wantErr: true,
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Manifest v1\nLog Checkpoint v0\nstate active\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active",
+			wantErr: true,
+		}, {
+			desc:    "empty origin",
+			raw:     "Serverless Log Manifest v0\n\nstate active\n",
+			wantErr: true,
+		}, {
+			desc:    "no state",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\n",
+			wantErr: true,
+		}, {
+			desc:    "unknown state",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate sleepy\n",
+			wantErr: true,
+		}, {
+			desc:    "duplicate state",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nstate frozen\n",
+			wantErr: true,
+		}, {
+			desc:    "bad line",
+			raw:     "Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nbanana\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			m, err := api.ParseManifest([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseManifest: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(m, test.want); len(diff) != 0 {
+				t.Errorf("ParseManifest had diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestLogStateTransitions(t *testing.T) {
+	for _, test := range []struct {
+		from, to api.LogState
+		want     bool
+	}{
+		{from: api.StateActive, to: api.StateFrozen, want: true},
+		{from: api.StateFrozen, to: api.StateActive, want: true},
+		{from: api.StateActive, to: api.StateReadOnly, want: true},
+		{from: api.StateReadOnly, to: api.StateReadOnly, want: true},
+		{from: api.StateReadOnly, to: api.StateActive, want: false},
+		{from: api.StateReadOnly, to: api.StateFrozen, want: false},
+	} {
+		if got := test.from.CanBecome(test.to); got != test.want {
+			t.Errorf("%q.CanBecome(%q) = %t, want %t", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func FuzzParseManifest(f *testing.F) {
+	f.Add([]byte("Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\n"))
+	f.Add([]byte("Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\nreason retired\n"))
+	f.Add([]byte("Serverless Log Manifest v0\nLog Checkpoint v0\nstate read-only\ncreated 1680000000\nfinal 10 0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\nsuccessor Log Checkpoint v1\nsuccessor-key astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b\nsuccessor-url ../v1/\n"))
+	f.Add([]byte("Serverless Log Manifest v0\nLog Checkpoint v1\nstate active\npredecessor Log Checkpoint v0\npredecessor-key astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b\npredecessor-final 10 0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n"))
+	f.Add([]byte("Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nlayout immutable\n"))
+	f.Add([]byte("Serverless Log Manifest v0\nLog Checkpoint v0\nstate active\nduplicates original\n"))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		m, err := api.ParseManifest(raw)
+		if err != nil {
+			return
+		}
+		m2, err := api.ParseManifest(m.Marshal())
+		if err != nil {
+			t.Fatalf("ParseManifest(Marshal(%q)): %v", raw, err)
+		}
+		if diff := cmp.Diff(m, m2); len(diff) != 0 {
+			t.Fatalf("Roundtripped manifest has diff: %s", diff)
+		}
+	})
+}
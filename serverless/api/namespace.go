@@ -0,0 +1,292 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// NamespacesHeaderV0 is the first line of a marshaled namespace registry.
+	NamespacesHeaderV0 = "Serverless Log Namespaces v0"
+
+	// ClaimHeaderV0 is the first line of a marshaled identifier claim.
+	ClaimHeaderV0 = "Serverless Log Identifier Claim v0"
+)
+
+// Namespace returns the namespace of the identifier id, which is the part of
+// it before the first slash, or the whole identifier if it has none. So the
+// owner of the namespace "example.com" owns both the identifier "example.com"
+// and "example.com/pkg".
+func Namespace(id string) string {
+	if i := strings.IndexByte(id, '/'); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// IdentifierNamespaces returns the distinct namespaces of the identifiers ids,
+// as returned by Namespace, in sorted order.
+func IdentifierNamespaces(ids []string) []string {
+	seen := make(map[string]bool)
+	var r []string
+	for _, id := range ids {
+		if ns := Namespace(id); !seen[ns] {
+			seen[ns] = true
+			r = append(r, ns)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// NamespaceLeafKey returns the key under which logs whose duplicate policy is
+// DuplicatesPerNamespace record the instance of the entry with the given leaf
+// hash submitted with identifiers in the namespace ns.
+func NamespaceLeafKey(ns string, leafhash []byte) []byte {
+	h := sha256.New()
+	h.Write(leafhash)
+	h.Write([]byte(ns))
+	return h.Sum(nil)
+}
+
+// Namespaces registers the owners of identifier namespaces. Entries may only
+// be associated with an identifier in a registered namespace if the claim to
+// it is signed with the namespace's key. Identifiers in other namespaces may
+// be used by anyone. It's published in the root of the log, signed with the
+// log's key.
+type Namespaces struct {
+	// Origin is the origin of the log.
+	Origin string
+	// Owners maps each registered namespace to its owner.
+	Owners map[string]NamespaceOwner
+}
+
+// NamespaceOwner describes the owner of a registered namespace.
+type NamespaceOwner struct {
+	// Key is the note verifier key of the owner.
+	Key string
+	// Since is the number of entries sequenced when the namespace was
+	// registered. Earlier entries didn't need a claim to use it.
+	Since uint64
+}
+
+// At returns the registry as it applied to the entry at index seq, without
+// the namespaces registered after it was sequenced.
+func (n Namespaces) At(seq uint64) Namespaces {
+	r := Namespaces{Origin: n.Origin, Owners: make(map[string]NamespaceOwner)}
+	for ns, o := range n.Owners {
+		if o.Since <= seq {
+			r.Owners[ns] = o
+		}
+	}
+	return r
+}
+
+// Marshal returns the serialised form of the namespace registry, in the
+// following format, with the namespaces in increasing order:
+//
+// Serverless Log Namespaces v0\n
+// <origin>\n
+// <namespace> <since> <verifier key>\n
+// ...
+func (n Namespaces) Marshal() []byte {
+	names := make([]string, 0, len(n.Owners))
+	for ns := range n.Owners {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n", NamespacesHeaderV0, n.Origin)
+	for _, ns := range names {
+		fmt.Fprintf(b, "%s %d %s\n", ns, n.Owners[ns].Since, n.Owners[ns].Key)
+	}
+	return b.Bytes()
+}
+
+// ParseNamespaces parses and validates the serialised form of a namespace
+// registry, as written by Namespaces.Marshal.
+func ParseNamespaces(raw []byte) (*Namespaces, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("namespace registry must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("namespace registry is too short")
+	}
+	if lines[0] != NamespacesHeaderV0 {
+		return nil, fmt.Errorf("invalid namespace registry header %q", lines[0])
+	}
+	n := &Namespaces{Origin: lines[1], Owners: make(map[string]NamespaceOwner)}
+	if len(n.Origin) == 0 {
+		return nil, errors.New("namespace registry has empty origin")
+	}
+	prev := ""
+	for _, l := range lines[2:] {
+		f := strings.Split(l, " ")
+		if len(f) != 3 {
+			return nil, fmt.Errorf("invalid namespace registration %q", l)
+		}
+		ns := f[0]
+		if err := ValidateNamespace(ns); err != nil {
+			return nil, err
+		}
+		if ns <= prev {
+			return nil, fmt.Errorf("namespace %q is out of order", ns)
+		}
+		since, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registration size for namespace %q: %w", ns, err)
+		}
+		if _, err := note.NewVerifier(f[2]); err != nil {
+			return nil, fmt.Errorf("invalid key for namespace %q: %w", ns, err)
+		}
+		n.Owners[ns] = NamespaceOwner{Key: f[2], Since: since}
+		prev = ns
+	}
+	return n, nil
+}
+
+// ValidateNamespace checks that ns may be registered as a namespace. It must
+// be a valid identifier without a slash or spaces.
+func ValidateNamespace(ns string) error {
+	if err := ValidateIdentifier(ns); err != nil {
+		return err
+	}
+	if strings.ContainsAny(ns, "/ ") {
+		return fmt.Errorf("namespace %q contains a slash or space", ns)
+	}
+	return nil
+}
+
+// Claim is the statement, signed by the owner of each registered namespace
+// it uses, that the entry with the given leaf hash may be associated with the
+// given identifiers. Claims are recorded alongside the identifiers, so that
+// anyone can check that identifiers weren't used without their owner's
+// consent.
+type Claim struct {
+	// Origin is the origin of the log the entry is submitted to, so that a
+	// claim can't be replayed to another log.
+	Origin      string
+	LeafHash    []byte
+	Identifiers []string
+}
+
+// Marshal returns the serialised form of the claim, in the following format:
+//
+// Serverless Log Identifier Claim v0\n
+// <origin>\n
+// <base64 leaf hash>\n
+// <identifier>\n
+// ...
+func (c Claim) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%s\n", ClaimHeaderV0, c.Origin, base64.StdEncoding.EncodeToString(c.LeafHash))
+	b.Write(MarshalIdentifiers(c.Identifiers))
+	return b.Bytes()
+}
+
+// ParseClaim parses and validates the serialised form of a claim, as written
+// by Claim.Marshal.
+func ParseClaim(raw []byte) (*Claim, error) {
+	header, rest, ok := bytes.Cut(raw, []byte("\n"))
+	if !ok || string(header) != ClaimHeaderV0 {
+		return nil, fmt.Errorf("invalid claim header %q", header)
+	}
+	origin, rest, ok := bytes.Cut(rest, []byte("\n"))
+	if !ok || len(origin) == 0 {
+		return nil, errors.New("claim has no origin")
+	}
+	lh, rest, ok := bytes.Cut(rest, []byte("\n"))
+	if !ok {
+		return nil, errors.New("claim has no leaf hash")
+	}
+	c := &Claim{Origin: string(origin)}
+	var err error
+	if c.LeafHash, err = base64.StdEncoding.DecodeString(string(lh)); err != nil || len(c.LeafHash) != HashSize {
+		return nil, fmt.Errorf("invalid claim leaf hash %q", lh)
+	}
+	if c.Identifiers, err = ParseIdentifiers(rest); err != nil {
+		return nil, fmt.Errorf("invalid claim identifiers: %w", err)
+	}
+	return c, nil
+}
+
+// VerifyClaim checks that the entry with the given leaf hash may be associated
+// with the identifiers ids. If any of them are in registered namespaces,
+// claimRaw must be a note containing the Claim to exactly those identifiers
+// for the entry, signed with the key of each of those namespaces. Otherwise
+// no claim is needed, and claimRaw is ignored.
+func (n Namespaces) VerifyClaim(leafhash []byte, ids []string, claimRaw []byte) error {
+	var vs []note.Verifier
+	keys := make(map[string]bool)
+	for _, id := range ids {
+		ns := Namespace(id)
+		o, ok := n.Owners[ns]
+		key := o.Key
+		if !ok || keys[key] {
+			continue
+		}
+		if len(claimRaw) == 0 {
+			return fmt.Errorf("identifier %q is in registered namespace %q, so needs a claim signed by its owner", id, ns)
+		}
+		v, err := note.NewVerifier(key)
+		if err != nil {
+			return fmt.Errorf("invalid key for namespace %q: %w", ns, err)
+		}
+		vs = append(vs, v)
+		keys[key] = true
+	}
+	if len(vs) == 0 {
+		return nil
+	}
+	cn, err := note.Open(claimRaw, note.VerifierList(vs...))
+	if err != nil {
+		return fmt.Errorf("failed to open claim: %w", err)
+	}
+	for _, v := range vs {
+		signed := false
+		for _, s := range cn.Sigs {
+			signed = signed || (s.Name == v.Name() && s.Hash == v.KeyHash())
+		}
+		if !signed {
+			return fmt.Errorf("claim isn't signed by namespace key %q", v.Name())
+		}
+	}
+	c, err := ParseClaim([]byte(cn.Text))
+	if err != nil {
+		return err
+	}
+	if c.Origin != n.Origin {
+		return fmt.Errorf("claim is for log %q, want %q", c.Origin, n.Origin)
+	}
+	if !bytes.Equal(c.LeafHash, leafhash) {
+		return fmt.Errorf("claim is for leaf hash %x, want %x", c.LeafHash, leafhash)
+	}
+	if !bytes.Equal(MarshalIdentifiers(c.Identifiers), MarshalIdentifiers(ids)) {
+		return fmt.Errorf("claim is for identifiers %q, want %q", c.Identifiers, ids)
+	}
+	return nil
+}
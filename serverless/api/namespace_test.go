@@ -0,0 +1,229 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func newKey(t *testing.T, name string) (note.Signer, string) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return s, vkey
+}
+
+func TestParseNamespaces(t *testing.T) {
+	_, vkey := newKey(t, "example.com")
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.Namespaces
+		wantErr bool
+	}{
+		{
+			desc: "none",
+			raw:  "Serverless Log Namespaces v0\nMy Log\n",
+			want: &api.Namespaces{Origin: "My Log", Owners: map[string]api.NamespaceOwner{}},
+		}, {
+			desc: "namespaces",
+			raw:  "Serverless Log Namespaces v0\nMy Log\nexample.com 10 " + vkey + "\nexample.org 0 " + vkey + "\n",
+			want: &api.Namespaces{Origin: "My Log", Owners: map[string]api.NamespaceOwner{
+				"example.com": {Key: vkey, Since: 10},
+				"example.org": {Key: vkey},
+			}},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Namespaces v1\nMy Log\n",
+			wantErr: true,
+		}, {
+			desc:    "empty origin",
+			raw:     "Serverless Log Namespaces v0\n\n",
+			wantErr: true,
+		}, {
+			desc:    "out of order",
+			raw:     "Serverless Log Namespaces v0\nMy Log\nexample.org 0 " + vkey + "\nexample.com 0 " + vkey + "\n",
+			wantErr: true,
+		}, {
+			desc:    "slash in namespace",
+			raw:     "Serverless Log Namespaces v0\nMy Log\nexample.com/pkg 0 " + vkey + "\n",
+			wantErr: true,
+		}, {
+			desc:    "bad key",
+			raw:     "Serverless Log Namespaces v0\nMy Log\nexample.com 0 banana\n",
+			wantErr: true,
+		}, {
+			desc:    "missing size",
+			raw:     "Serverless Log Namespaces v0\nMy Log\nexample.com " + vkey + "\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			n, err := api.ParseNamespaces([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseNamespaces: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(n, test.want); len(diff) != 0 {
+				t.Errorf("ParseNamespaces had diff %s", diff)
+			}
+			if got := n.Marshal(); string(got) != test.raw {
+				t.Errorf("Marshal = %q, want %q", got, test.raw)
+			}
+		})
+	}
+}
+
+func TestVerifyClaim(t *testing.T) {
+	owner, ownerKey := newKey(t, "example.com")
+	other, otherKey := newKey(t, "example.org")
+	mallory, _ := newKey(t, "mallory")
+	ns := api.Namespaces{Origin: "My Log", Owners: map[string]api.NamespaceOwner{
+		"example.com": {Key: ownerKey},
+		"example.org": {Key: otherKey, Since: 5},
+	}}
+	lh := bytes.Repeat([]byte{0x01}, api.HashSize)
+	claim := func(c api.Claim, s ...note.Signer) []byte {
+		t.Helper()
+		raw, err := note.Sign(&note.Note{Text: string(c.Marshal())}, s...)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return raw
+	}
+	ids := []string{"example.com/pkg", "docs"}
+
+	for _, test := range []struct {
+		desc    string
+		ns      api.Namespaces
+		ids     []string
+		claim   []byte
+		wantErr bool
+	}{
+		{
+			desc: "unregistered namespace",
+			ns:   ns,
+			ids:  []string{"docs"},
+		}, {
+			desc:  "claimed",
+			ns:    ns,
+			ids:   ids,
+			claim: claim(api.Claim{Origin: "My Log", LeafHash: lh, Identifiers: ids}, owner),
+		}, {
+			desc:    "no claim",
+			ns:      ns,
+			ids:     ids,
+			wantErr: true,
+		}, {
+			desc:    "claim signed by someone else",
+			ns:      ns,
+			ids:     ids,
+			claim:   claim(api.Claim{Origin: "My Log", LeafHash: lh, Identifiers: ids}, mallory),
+			wantErr: true,
+		}, {
+			desc:    "claim for other log",
+			ns:      ns,
+			ids:     ids,
+			claim:   claim(api.Claim{Origin: "Other Log", LeafHash: lh, Identifiers: ids}, owner),
+			wantErr: true,
+		}, {
+			desc:    "claim for other entry",
+			ns:      ns,
+			ids:     ids,
+			claim:   claim(api.Claim{Origin: "My Log", LeafHash: make([]byte, api.HashSize), Identifiers: ids}, owner),
+			wantErr: true,
+		}, {
+			desc:    "claim for other identifiers",
+			ns:      ns,
+			ids:     ids,
+			claim:   claim(api.Claim{Origin: "My Log", LeafHash: lh, Identifiers: []string{"example.com/pkg"}}, owner),
+			wantErr: true,
+		}, {
+			desc:    "claim missing a namespace signature",
+			ns:      ns,
+			ids:     []string{"example.com", "example.org/pkg"},
+			claim:   claim(api.Claim{Origin: "My Log", LeafHash: lh, Identifiers: []string{"example.com", "example.org/pkg"}}, owner),
+			wantErr: true,
+		}, {
+			desc:  "claim signed by every namespace",
+			ns:    ns,
+			ids:   []string{"example.com", "example.org/pkg"},
+			claim: claim(api.Claim{Origin: "My Log", LeafHash: lh, Identifiers: []string{"example.com", "example.org/pkg"}}, owner, other),
+		}, {
+			desc: "entry sequenced before registration",
+			ns:   ns.At(4),
+			ids:  []string{"example.org/pkg"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := test.ns.VerifyClaim(lh, test.ids, test.claim)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("VerifyClaim: got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseClaim(t *testing.T) {
+	c := api.Claim{Origin: "My Log", LeafHash: bytes.Repeat([]byte{0x01}, api.HashSize), Identifiers: []string{"example.com/pkg", "docs"}}
+	got, err := api.ParseClaim(c.Marshal())
+	if err != nil {
+		t.Fatalf("ParseClaim: %v", err)
+	}
+	if diff := cmp.Diff(got, &c); len(diff) != 0 {
+		t.Errorf("ParseClaim had diff %s", diff)
+	}
+	for _, raw := range []string{
+		"Serverless Log Identifier Claim v1\nMy Log\nAQ==\ndocs\n",
+		"Serverless Log Identifier Claim v0\nMy Log\nAQ==\ndocs\n",
+		"Serverless Log Identifier Claim v0\nMy Log\n" + "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n",
+	} {
+		if _, err := api.ParseClaim([]byte(raw)); err == nil {
+			t.Errorf("ParseClaim(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestIdentifierNamespaces(t *testing.T) {
+	for _, test := range []struct {
+		ids  []string
+		want []string
+	}{
+		{ids: nil, want: nil},
+		{ids: []string{"tenant-b/foo", "tenant-a", "tenant-b/bar"}, want: []string{"tenant-a", "tenant-b"}},
+	} {
+		if diff := cmp.Diff(api.IdentifierNamespaces(test.ids), test.want); len(diff) != 0 {
+			t.Errorf("IdentifierNamespaces(%q) had diff %s", test.ids, diff)
+		}
+	}
+	lh := bytes.Repeat([]byte{0xab}, api.HashSize)
+	if bytes.Equal(api.NamespaceLeafKey("tenant-a", lh), api.NamespaceLeafKey("tenant-b", lh)) {
+		t.Error("NamespaceLeafKey is the same for different namespaces")
+	}
+}
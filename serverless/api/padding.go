@@ -0,0 +1,50 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// PaddingHeaderV0 is the first line of a padding entry.
+const PaddingHeaderV0 = "Serverless Log Padding v0"
+
+// paddingNonceSize is the number of random bytes in a padding entry, which
+// keep padding entries distinct so that they aren't squashed as duplicates.
+const paddingNonceSize = 16
+
+// NewPaddingEntry returns a new padding entry, which carries no data and is
+// added to the log by an integrator to fill out a batch of entries, so that
+// the number of entries released at once says nothing about the number of
+// submissions. Its format is:
+//
+// Serverless Log Padding v0\n
+// <hex nonce>\n
+func NewPaddingEntry() ([]byte, error) {
+	n := make([]byte, paddingNonceSize)
+	if _, err := rand.Read(n); err != nil {
+		return nil, fmt.Errorf("failed to generate padding nonce: %w", err)
+	}
+	return []byte(fmt.Sprintf("%s\n%s\n", PaddingHeaderV0, hex.EncodeToString(n))), nil
+}
+
+// IsPaddingEntry returns true if the log entry e is a padding entry, which
+// clients and monitors should skip.
+func IsPaddingEntry(e []byte) bool {
+	return bytes.HasPrefix(e, []byte(PaddingHeaderV0+"\n"))
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestPaddingEntry(t *testing.T) {
+	a, err := api.NewPaddingEntry()
+	if err != nil {
+		t.Fatalf("NewPaddingEntry: %v", err)
+	}
+	b, err := api.NewPaddingEntry()
+	if err != nil {
+		t.Fatalf("NewPaddingEntry: %v", err)
+	}
+	if bytes.Equal(a, b) {
+		t.Errorf("Padding entries %q and %q are identical, and would be squashed as duplicates", a, b)
+	}
+	for _, test := range []struct {
+		entry []byte
+		want  bool
+	}{
+		{entry: a, want: true},
+		{entry: []byte(api.PaddingHeaderV0 + "\nanything\n"), want: true},
+		{entry: []byte(api.PaddingHeaderV0)},
+		{entry: []byte("Serverless Log Padding v1\nabcd\n")},
+		{entry: []byte("hello")},
+		{},
+	} {
+		if got := api.IsPaddingEntry(test.entry); got != test.want {
+			t.Errorf("IsPaddingEntry(%q) = %t, want %t", test.entry, got, test.want)
+		}
+	}
+}
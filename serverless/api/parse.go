@@ -0,0 +1,147 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/formats/log"
+)
+
+// The functions in this file parse and validate the raw contents of the
+// artifacts which make up a serverless log.
+//
+// They are pure functions with no dependencies on storage or transport so that
+// they can be fuzzed, and reused by independent verifier implementations.
+// None of them will panic on malformed input.
+//
+// Note that ParseCheckpoint only parses the body of a checkpoint; its
+// signatures are verified by log.ParseCheckpoint in the
+// github.com/transparency-dev/formats module.
+
+const (
+	// HashSize is the size in bytes of the node hashes stored in tiles.
+	HashSize = 32
+
+	// TileWidth is the maximum number of "tile leaves" in a tile.
+	TileWidth = 256
+
+	// maxTileNodes is the maximum number of node entries a serialised tile
+	// can contain, i.e. the number of nodes in a perfect tile.
+	maxTileNodes = TileWidth*2 - 1
+)
+
+// ParseCheckpoint parses and validates the body of a checkpoint, i.e. the text
+// of its signed note, in the following format:
+//
+// <origin>\n
+// <decimal size>\n
+// <base64 root hash>\n
+// [extension lines...]
+//
+// It returns the checkpoint and its extension lines, if any, which
+// append(cp.Marshal(), ext...) reproduces.
+func ParseCheckpoint(body []byte) (*log.Checkpoint, []byte, error) {
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		return nil, nil, errors.New("checkpoint must end with a newline")
+	}
+	cp := &log.Checkpoint{}
+	ext, err := cp.Unmarshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cp.Hash) != HashSize {
+		return nil, nil, fmt.Errorf("invalid checkpoint hash size %d", len(cp.Hash))
+	}
+	// Reject other encodings of the same size and hash, e.g. with leading
+	// zeros, so that a checkpoint has only one valid body.
+	if !bytes.Equal(body[:len(body)-len(ext)], cp.Marshal()) {
+		return nil, nil, errors.New("checkpoint isn't in canonical form")
+	}
+	for _, l := range bytes.Split(bytes.TrimSuffix(ext, []byte("\n")), []byte("\n")) {
+		if len(ext) > 0 && len(l) == 0 {
+			return nil, nil, errors.New("checkpoint has an empty extension line")
+		}
+	}
+	return cp, ext, nil
+}
+
+// ParseTile parses and validates the serialised form of a tile, as written by
+// Tile.MarshalText.
+func ParseTile(raw []byte) (*Tile, error) {
+	t := &Tile{}
+	if err := t.UnmarshalText(raw); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseLeafIndex parses the contents of a leafhash->sequence number mapping
+// file stored under the leaves/ directory, returning the sequence number it
+// contains.
+func ParseLeafIndex(raw []byte) (uint64, error) {
+	s := string(raw)
+	if len(s) == 0 || len(s) > 16 {
+		return 0, fmt.Errorf("invalid leaf index length %d", len(s))
+	}
+	seq, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid leaf index %q: %w", s, err)
+	}
+	return seq, nil
+}
+
+// MarshalLeafIndex returns the serialised form of a leafhash->sequence number
+// mapping file, suitable for parsing with ParseLeafIndex.
+func MarshalLeafIndex(seq uint64) []byte {
+	return []byte(strconv.FormatUint(seq, 16))
+}
+
+// MarshalProof returns the serialised form of an inclusion or consistency
+// proof, with one base64 encoded hash per line.
+func MarshalProof(p [][]byte) []byte {
+	b := &bytes.Buffer{}
+	for _, h := range p {
+		fmt.Fprintf(b, "%s\n", base64.StdEncoding.EncodeToString(h))
+	}
+	return b.Bytes()
+}
+
+// ParseProof parses and validates the serialised form of an inclusion or
+// consistency proof, as written by MarshalProof.
+func ParseProof(raw []byte) ([][]byte, error) {
+	if len(raw) == 0 {
+		return [][]byte{}, nil
+	}
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("proof must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	p := make([][]byte, 0, len(lines))
+	for i, l := range lines {
+		h, err := base64.StdEncoding.DecodeString(l)
+		if err != nil || len(h) != HashSize {
+			return nil, fmt.Errorf("invalid proof hash %d %q", i, l)
+		}
+		p = append(p, h)
+	}
+	return p, nil
+}
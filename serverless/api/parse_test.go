@@ -0,0 +1,288 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	const cp = "Log Checkpoint v0\n15\nrKbDipCvhuX1GZ7g5BBe8sA6BbJ7ja/1nk427v383cs=\n"
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		wantExt string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  cp,
+		}, {
+			desc:    "valid with extensions",
+			raw:     cp + "map 3 abc\nother\n",
+			wantExt: "map 3 abc\nother\n",
+		}, {
+			desc:    "empty",
+			raw:     "",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     strings.TrimSuffix(cp, "\n"),
+			wantErr: true,
+		}, {
+			desc:    "extension without trailing newline",
+			raw:     cp + "map 3 abc",
+			wantErr: true,
+		}, {
+			desc:    "empty extension line",
+			raw:     cp + "\nother\n",
+			wantErr: true,
+		}, {
+			desc:    "empty origin",
+			raw:     "\n15\nrKbDipCvhuX1GZ7g5BBe8sA6BbJ7ja/1nk427v383cs=\n",
+			wantErr: true,
+		}, {
+			desc:    "invalid size",
+			raw:     "Log Checkpoint v0\n-1\nrKbDipCvhuX1GZ7g5BBe8sA6BbJ7ja/1nk427v383cs=\n",
+			wantErr: true,
+		}, {
+			desc:    "non-canonical size",
+			raw:     "Log Checkpoint v0\n015\nrKbDipCvhuX1GZ7g5BBe8sA6BbJ7ja/1nk427v383cs=\n",
+			wantErr: true,
+		}, {
+			desc:    "short hash",
+			raw:     "Log Checkpoint v0\n15\nYmFuYW5h\n",
+			wantErr: true,
+		}, {
+			desc:    "invalid base64",
+			raw:     "Log Checkpoint v0\n15\n!!!!\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, ext, err := api.ParseCheckpoint([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseCheckpoint: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if string(ext) != test.wantExt {
+				t.Errorf("ParseCheckpoint: got extensions %q, want %q", ext, test.wantExt)
+			}
+			if got.Origin != "Log Checkpoint v0" || got.Size != 15 {
+				t.Errorf("ParseCheckpoint: got %+v", got)
+			}
+		})
+	}
+}
+
+func TestParseTile(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "32\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n",
+		}, {
+			desc: "valid with ephemeral node",
+			raw:  "32\n3\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\nT1X2GdkhUjV3iyufF9b0kVsWFxIU0VI4EpNml2Teci4=\nqxq38Hx8j+Dv9LpvqlPH5EEukaWZFT6KpOAb7s5beCU=\n\nZx8UbF5HHooag6PCFM5LqQe486WIjRTMjNPOdbsS75Q=\n",
+		}, {
+			desc:    "empty",
+			raw:     "",
+			wantErr: true,
+		}, {
+			desc:    "hash size only",
+			raw:     "32\n",
+			wantErr: true,
+		}, {
+			desc:    "wrong hash size",
+			raw:     "20\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n",
+			wantErr: true,
+		}, {
+			desc:    "too many leaves",
+			raw:     "32\n257\n",
+			wantErr: true,
+		}, {
+			desc:    "short node hash",
+			raw:     "32\n1\nYmFuYW5h\n",
+			wantErr: true,
+		}, {
+			desc:    "invalid base64",
+			raw:     "32\n1\n!!!!\n",
+			wantErr: true,
+		}, {
+			desc:    "too many nodes",
+			raw:     "32\n256\n" + strings.Repeat("0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n", 512),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := api.ParseTile([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseTile: got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseLeafIndex(t *testing.T) {
+	for _, test := range []struct {
+		raw     string
+		want    uint64
+		wantErr bool
+	}{
+		{raw: "0", want: 0},
+		{raw: "1a", want: 0x1a},
+		{raw: "ffffffffffffffff", want: 0xffffffffffffffff},
+		{raw: "", wantErr: true},
+		{raw: "-1", wantErr: true},
+		{raw: "0x10", wantErr: true},
+		{raw: "10\n", wantErr: true},
+		{raw: "10000000000000000", wantErr: true},
+	} {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := api.ParseLeafIndex([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLeafIndex: got err %v, want err %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseLeafIndex: got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func FuzzParseTile(f *testing.F) {
+	for _, p := range []string{"00.01", "00.03", "00.0f"} {
+		raw, err := os.ReadFile("../testdata/log/tile/00/0000/00/00/" + p)
+		if err != nil {
+			f.Fatalf("Failed to read seed tile %q: %v", p, err)
+		}
+		f.Add(raw)
+	}
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		tile, err := api.ParseTile(raw)
+		if err != nil {
+			return
+		}
+		// Anything which parses successfully must survive a roundtrip.
+		m, err := tile.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText: %v", err)
+		}
+		tile2, err := api.ParseTile(m)
+		if err != nil {
+			t.Fatalf("ParseTile(MarshalText(%q)): %v", raw, err)
+		}
+		if diff := cmp.Diff(tile, tile2); len(diff) != 0 {
+			t.Fatalf("Roundtripped tile has diff: %s", diff)
+		}
+	})
+}
+
+func FuzzParseCheckpoint(f *testing.F) {
+	for _, p := range []string{"checkpoint", "checkpoint.1"} {
+		raw, err := os.ReadFile("../testdata/log/" + p)
+		if err != nil {
+			f.Fatalf("Failed to read seed checkpoint %q: %v", p, err)
+		}
+		// Seed with the body of the signed note.
+		body, _, _ := bytes.Cut(raw, []byte("\n\n"))
+		f.Add(append(body, '\n'))
+	}
+	f.Add([]byte("Log Checkpoint v0\n15\nrKbDipCvhuX1GZ7g5BBe8sA6BbJ7ja/1nk427v383cs=\nmap 3 abc\n"))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		cp, ext, err := api.ParseCheckpoint(raw)
+		if err != nil {
+			return
+		}
+		// Anything which parses successfully must survive a roundtrip.
+		m := append(cp.Marshal(), ext...)
+		if !bytes.Equal(m, raw) {
+			t.Fatalf("Marshal(ParseCheckpoint(%q)) = %q", raw, m)
+		}
+		cp2, ext2, err := api.ParseCheckpoint(m)
+		if err != nil {
+			t.Fatalf("ParseCheckpoint(Marshal(%q)): %v", raw, err)
+		}
+		if diff := cmp.Diff(cp, cp2); len(diff) != 0 {
+			t.Fatalf("Roundtripped checkpoint has diff: %s", diff)
+		}
+		if !bytes.Equal(ext, ext2) {
+			t.Fatalf("Roundtripped extensions %q, want %q", ext2, ext)
+		}
+	})
+}
+
+func FuzzParseLeafIndex(f *testing.F) {
+	for _, s := range []string{"0", "1a", "ffffffffffffffff"} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		seq, err := api.ParseLeafIndex(raw)
+		if err != nil {
+			return
+		}
+		got, err := api.ParseLeafIndex(api.MarshalLeafIndex(seq))
+		if err != nil {
+			t.Fatalf("ParseLeafIndex(MarshalLeafIndex(%d)): %v", seq, err)
+		}
+		if got != seq {
+			t.Fatalf("Roundtrip got %d, want %d", got, seq)
+		}
+	})
+}
+
+func TestParseProof(t *testing.T) {
+	h := bytes.Repeat([]byte{0x11}, api.HashSize)
+	for _, test := range []struct {
+		desc    string
+		p       [][]byte
+		raw     string
+		wantErr bool
+	}{
+		{desc: "empty", p: [][]byte{}},
+		{desc: "roundtrip", p: [][]byte{h, h}},
+		{desc: "short hash", raw: "q83vzQ==\n", wantErr: true},
+		{desc: "not base64", raw: "!!\n", wantErr: true},
+		{desc: "no trailing newline", raw: strings.TrimSuffix(string(api.MarshalProof([][]byte{h})), "\n"), wantErr: true},
+		{desc: "blank line", raw: "\n", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			raw := []byte(test.raw)
+			if test.p != nil {
+				raw = api.MarshalProof(test.p)
+			}
+			got, err := api.ParseProof(raw)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseProof: got err %v, want err %t", err, test.wantErr)
+			}
+			if test.p != nil {
+				if diff := cmp.Diff(got, test.p); len(diff) != 0 {
+					t.Errorf("ParseProof: diff %s", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// InclusionProof is the JSON form of an inclusion proof, which identifies the
+// leaf and tree it's for so that it can be verified on its own, e.g. by a
+// verifier running in a browser. Hashes are base64 encoded.
+type InclusionProof struct {
+	Index  uint64   `json:"index"`
+	Size   uint64   `json:"size"`
+	Hashes [][]byte `json:"hashes"`
+}
+
+// Marshal returns the JSON form of the proof.
+func (p InclusionProof) Marshal() []byte {
+	if p.Hashes == nil {
+		p.Hashes = [][]byte{}
+	}
+	return marshalJSONProof(p)
+}
+
+// ParseInclusionProof parses and validates the JSON form of an inclusion
+// proof, as written by InclusionProof.Marshal.
+func ParseInclusionProof(raw []byte) (*InclusionProof, error) {
+	p := &InclusionProof{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("invalid inclusion proof: %w", err)
+	}
+	if p.Index >= p.Size {
+		return nil, fmt.Errorf("inclusion proof index %d is not less than size %d", p.Index, p.Size)
+	}
+	if err := validateHashes(p.Hashes); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ConsistencyProof is the JSON form of a consistency proof, which identifies
+// the trees it's between so that it can be verified on its own. Hashes are
+// base64 encoded.
+type ConsistencyProof struct {
+	From   uint64   `json:"from"`
+	To     uint64   `json:"to"`
+	Hashes [][]byte `json:"hashes"`
+}
+
+// Marshal returns the JSON form of the proof.
+func (p ConsistencyProof) Marshal() []byte {
+	if p.Hashes == nil {
+		p.Hashes = [][]byte{}
+	}
+	return marshalJSONProof(p)
+}
+
+// ParseConsistencyProof parses and validates the JSON form of a consistency
+// proof, as written by ConsistencyProof.Marshal.
+func ParseConsistencyProof(raw []byte) (*ConsistencyProof, error) {
+	p := &ConsistencyProof{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("invalid consistency proof: %w", err)
+	}
+	if p.From > p.To {
+		return nil, fmt.Errorf("consistency proof from %d is larger than to %d", p.From, p.To)
+	}
+	if err := validateHashes(p.Hashes); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ProofBundle is the JSON form of everything needed to verify the inclusion of
+// an entry in a log offline: the log's signed checkpoint, the entry's leaf
+// hash, and its inclusion proof in the checkpoint's tree.
+type ProofBundle struct {
+	Checkpoint string         `json:"checkpoint"`
+	LeafHash   []byte         `json:"leaf_hash"`
+	Proof      InclusionProof `json:"proof"`
+}
+
+// Marshal returns the JSON form of the bundle.
+func (b ProofBundle) Marshal() []byte {
+	if b.Proof.Hashes == nil {
+		b.Proof.Hashes = [][]byte{}
+	}
+	return marshalJSONProof(b)
+}
+
+// ParseProofBundle parses and validates the JSON form of a proof bundle, as
+// written by ProofBundle.Marshal. The checkpoint is not opened.
+func ParseProofBundle(raw []byte) (*ProofBundle, error) {
+	b := &ProofBundle{}
+	if err := json.Unmarshal(raw, b); err != nil {
+		return nil, fmt.Errorf("invalid proof bundle: %w", err)
+	}
+	if len(b.LeafHash) != HashSize {
+		return nil, fmt.Errorf("proof bundle leaf hash has length %d, want %d", len(b.LeafHash), HashSize)
+	}
+	if b.Proof.Index >= b.Proof.Size {
+		return nil, fmt.Errorf("inclusion proof index %d is not less than size %d", b.Proof.Index, b.Proof.Size)
+	}
+	if err := validateHashes(b.Proof.Hashes); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// TailEntry is an entry streamed to a client following the log, with the
+// bundle proving its inclusion under the checkpoint at which it was sent.
+type TailEntry struct {
+	// Data is the entry's contents, whose leaf hash is in the bundle.
+	Data []byte `json:"data"`
+	// Tombstone, if the entry has been redacted, is the signed Redaction
+	// served in place of its withheld contents, and Data is empty.
+	Tombstone []byte `json:"tombstone,omitempty"`
+	ProofBundle
+}
+
+func marshalJSONProof(p interface{}) []byte {
+	b, err := json.Marshal(p)
+	if err != nil {
+		// Marshalling integers and byte slices can't fail.
+		panic(err)
+	}
+	return b
+}
+
+func validateHashes(hs [][]byte) error {
+	for i, h := range hs {
+		if len(h) != HashSize {
+			return fmt.Errorf("proof hash %d has length %d, want %d", i, len(h), HashSize)
+		}
+	}
+	return nil
+}
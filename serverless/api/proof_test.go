@@ -0,0 +1,137 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestInclusionProofRoundTrip(t *testing.T) {
+	h := bytes.Repeat([]byte{1}, api.HashSize)
+	for _, p := range []api.InclusionProof{
+		{Index: 0, Size: 1, Hashes: [][]byte{}},
+		{Index: 3, Size: 7, Hashes: [][]byte{h, h, h}},
+	} {
+		got, err := api.ParseInclusionProof(p.Marshal())
+		if err != nil {
+			t.Fatalf("ParseInclusionProof: %v", err)
+		}
+		if diff := cmp.Diff(*got, p); len(diff) != 0 {
+			t.Errorf("Round trip had diff %s", diff)
+		}
+	}
+	if got, want := string(api.InclusionProof{Index: 0, Size: 1}.Marshal()), `{"index":0,"size":1,"hashes":[]}`; got != want {
+		t.Errorf("Marshal of empty proof got %s, want %s", got, want)
+	}
+}
+
+func TestParseInclusionProof(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  `{"index":1,"size":2,"hashes":["0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="]}`,
+		}, {
+			desc:    "index beyond size",
+			raw:     `{"index":2,"size":2,"hashes":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "short hash",
+			raw:     `{"index":1,"size":2,"hashes":["AAAA"]}`,
+			wantErr: true,
+		}, {
+			desc:    "not json",
+			raw:     "0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := api.ParseInclusionProof([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("ParseInclusionProof: %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConsistencyProof(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  `{"from":1,"to":2,"hashes":["0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek="]}`,
+		}, {
+			desc: "same size",
+			raw:  `{"from":2,"to":2,"hashes":[]}`,
+		}, {
+			desc:    "from larger than to",
+			raw:     `{"from":3,"to":2,"hashes":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "short hash",
+			raw:     `{"from":1,"to":2,"hashes":["AAAA"]}`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := api.ParseConsistencyProof([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("ParseConsistencyProof: %v, wantErr %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseProofBundle(t *testing.T) {
+	h := bytes.Repeat([]byte{1}, api.HashSize)
+	b := api.ProofBundle{
+		Checkpoint: "Log Checkpoint v0\n2\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n\n— astra ytWj0g==\n",
+		LeafHash:   h,
+		Proof:      api.InclusionProof{Index: 1, Size: 2, Hashes: [][]byte{h}},
+	}
+	got, err := api.ParseProofBundle(b.Marshal())
+	if err != nil {
+		t.Fatalf("ParseProofBundle: %v", err)
+	}
+	if diff := cmp.Diff(*got, b); len(diff) != 0 {
+		t.Errorf("Round trip had diff %s", diff)
+	}
+
+	for _, test := range []struct {
+		desc string
+		raw  string
+	}{
+		{desc: "short leaf hash", raw: `{"checkpoint":"","leaf_hash":"AAAA","proof":{"index":1,"size":2,"hashes":[]}}`},
+		{desc: "index beyond size", raw: `{"checkpoint":"","leaf_hash":"0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=","proof":{"index":2,"size":2,"hashes":[]}}`},
+		{desc: "short proof hash", raw: `{"checkpoint":"","leaf_hash":"0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=","proof":{"index":1,"size":2,"hashes":["AAAA"]}}`},
+		{desc: "not json", raw: "banana"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := api.ParseProofBundle([]byte(test.raw)); err == nil {
+				t.Error("ParseProofBundle succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ProofEncoding is an encoding of a Merkle proof, so that proofs can be
+// handed to external verifiers which expect a particular one.
+type ProofEncoding string
+
+const (
+	// ProofEncodingText is one base64 encoded hash per line, as written by
+	// MarshalProof.
+	ProofEncodingText ProofEncoding = "text"
+	// ProofEncodingJSON is the JSON form of the responses to the
+	// get-proof-by-hash and get-sth-consistency requests of RFC 6962,
+	// sections 4.5 and 4.4.
+	ProofEncodingJSON ProofEncoding = "json"
+	// ProofEncodingBinary is the raw hashes, concatenated.
+	ProofEncodingBinary ProofEncoding = "binary"
+	// ProofEncodingPEM is a PEM block of the concatenated hashes, whose type
+	// names the type of proof, and which has a Leaf-Index header for an
+	// inclusion proof.
+	ProofEncodingPEM ProofEncoding = "pem"
+)
+
+// Valid returns true if e is a known proof encoding.
+func (e ProofEncoding) Valid() bool {
+	switch e {
+	case ProofEncodingText, ProofEncodingJSON, ProofEncodingBinary, ProofEncodingPEM:
+		return true
+	}
+	return false
+}
+
+// SelfDescribing returns true if proofs in encoding e carry their type and,
+// for inclusion proofs, their leaf index.
+func (e ProofEncoding) SelfDescribing() bool {
+	return e == ProofEncodingJSON || e == ProofEncodingPEM
+}
+
+// ProofType is the type of a Merkle proof.
+type ProofType string
+
+const (
+	// InclusionProofType is the type of inclusion proofs.
+	InclusionProofType ProofType = "inclusion"
+	// ConsistencyProofType is the type of consistency proofs.
+	ConsistencyProofType ProofType = "consistency"
+)
+
+// pemTypes maps proof types to the types of their PEM blocks.
+var pemTypes = map[ProofType]string{
+	InclusionProofType:   "MERKLE INCLUSION PROOF",
+	ConsistencyProofType: "MERKLE CONSISTENCY PROOF",
+}
+
+// leafIndexHeader is the PEM header holding the leaf index of an inclusion
+// proof.
+const leafIndexHeader = "Leaf-Index"
+
+// MerkleProof is a Merkle proof along with what's needed to encode it in any
+// ProofEncoding.
+type MerkleProof struct {
+	Type ProofType
+	// LeafIndex is the index of the leaf an inclusion proof is for. It's
+	// zero for proofs decoded from encodings which don't carry it.
+	LeafIndex uint64
+	Hashes    [][]byte
+}
+
+// rfc6962Proof is the JSON form of both types of proof in RFC 6962.
+type rfc6962Proof struct {
+	LeafIndex   *uint64  `json:"leaf_index,omitempty"`
+	AuditPath   [][]byte `json:"audit_path,omitempty"`
+	Consistency [][]byte `json:"consistency,omitempty"`
+}
+
+// Encode returns the proof in encoding e.
+func (p MerkleProof) Encode(e ProofEncoding) ([]byte, error) {
+	if _, ok := pemTypes[p.Type]; !ok {
+		return nil, fmt.Errorf("unknown proof type %q", p.Type)
+	}
+	hashes := p.Hashes
+	if hashes == nil {
+		hashes = [][]byte{}
+	}
+	switch e {
+	case ProofEncodingText:
+		return MarshalProof(hashes), nil
+	case ProofEncodingBinary:
+		return bytes.Join(hashes, nil), nil
+	case ProofEncodingJSON:
+		// Unlike in rfc6962Proof, the fields mustn't be omitted when
+		// they're empty.
+		if p.Type == InclusionProofType {
+			return marshalJSONProof(struct {
+				LeafIndex uint64   `json:"leaf_index"`
+				AuditPath [][]byte `json:"audit_path"`
+			}{p.LeafIndex, hashes}), nil
+		}
+		return marshalJSONProof(struct {
+			Consistency [][]byte `json:"consistency"`
+		}{hashes}), nil
+	case ProofEncodingPEM:
+		b := &pem.Block{Type: pemTypes[p.Type], Bytes: bytes.Join(hashes, nil)}
+		if p.Type == InclusionProofType {
+			b.Headers = map[string]string{leafIndexHeader: strconv.FormatUint(p.LeafIndex, 10)}
+		}
+		return pem.EncodeToMemory(b), nil
+	}
+	return nil, fmt.Errorf("unknown proof encoding %q", e)
+}
+
+// DecodeProof parses and validates a proof of type t in encoding e, as
+// written by MerkleProof.Encode.
+func DecodeProof(raw []byte, e ProofEncoding, t ProofType) (*MerkleProof, error) {
+	if _, ok := pemTypes[t]; !ok {
+		return nil, fmt.Errorf("unknown proof type %q", t)
+	}
+	p := &MerkleProof{Type: t}
+	var err error
+	switch e {
+	case ProofEncodingText:
+		if p.Hashes, err = ParseProof(raw); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case ProofEncodingBinary:
+		if p.Hashes, err = splitHashes(raw); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case ProofEncodingJSON:
+		j := rfc6962Proof{}
+		if err := json.Unmarshal(raw, &j); err != nil {
+			return nil, fmt.Errorf("invalid JSON proof: %w", err)
+		}
+		if t == InclusionProofType {
+			if j.LeafIndex == nil || j.Consistency != nil {
+				return nil, errors.New("JSON proof isn't an inclusion proof")
+			}
+			p.LeafIndex, p.Hashes = *j.LeafIndex, j.AuditPath
+		} else {
+			if j.LeafIndex != nil || j.AuditPath != nil {
+				return nil, errors.New("JSON proof isn't a consistency proof")
+			}
+			p.Hashes = j.Consistency
+		}
+		if p.Hashes == nil {
+			p.Hashes = [][]byte{}
+		}
+		if err := validateHashes(p.Hashes); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case ProofEncodingPEM:
+		b, rest := pem.Decode(raw)
+		if b == nil {
+			return nil, errors.New("no PEM block found")
+		}
+		if len(bytes.TrimSpace(rest)) > 0 {
+			return nil, errors.New("trailing data after PEM block")
+		}
+		if b.Type != pemTypes[t] {
+			return nil, fmt.Errorf("PEM block has type %q, want %q", b.Type, pemTypes[t])
+		}
+		if t == InclusionProofType {
+			if p.LeafIndex, err = strconv.ParseUint(b.Headers[leafIndexHeader], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s header: %w", leafIndexHeader, err)
+			}
+		}
+		if p.Hashes, err = splitHashes(b.Bytes); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown proof encoding %q", e)
+}
+
+// splitHashes splits concatenated hashes.
+func splitHashes(b []byte) ([][]byte, error) {
+	if len(b)%HashSize != 0 {
+		return nil, fmt.Errorf("proof has length %d, not a multiple of %d", len(b), HashSize)
+	}
+	hs := make([][]byte, 0, len(b)/HashSize)
+	for i := 0; i < len(b); i += HashSize {
+		hs = append(hs, b[i:i+HashSize])
+	}
+	return hs, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestProofEncodings(t *testing.T) {
+	h1 := bytes.Repeat([]byte{0x01}, api.HashSize)
+	h2 := bytes.Repeat([]byte{0x02}, api.HashSize)
+	encodings := []api.ProofEncoding{api.ProofEncodingText, api.ProofEncodingJSON, api.ProofEncodingBinary, api.ProofEncodingPEM}
+	for _, p := range []api.MerkleProof{
+		{Type: api.InclusionProofType, LeafIndex: 5, Hashes: [][]byte{h1, h2}},
+		{Type: api.InclusionProofType, Hashes: [][]byte{}},
+		{Type: api.ConsistencyProofType, Hashes: [][]byte{h2, h1}},
+		{Type: api.ConsistencyProofType, Hashes: [][]byte{}},
+	} {
+		for _, e := range encodings {
+			t.Run(fmt.Sprintf("%s/%s/%d", p.Type, e, len(p.Hashes)), func(t *testing.T) {
+				raw, err := p.Encode(e)
+				if err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+				got, err := api.DecodeProof(raw, e, p.Type)
+				if err != nil {
+					t.Fatalf("DecodeProof: %v", err)
+				}
+				want := p
+				if !e.SelfDescribing() {
+					want.LeafIndex = 0
+				}
+				if diff := cmp.Diff(&want, got); len(diff) != 0 {
+					t.Errorf("DecodeProof had diff %s", diff)
+				}
+				// Self-describing encodings of one type of proof aren't
+				// accepted as the other.
+				other := api.ConsistencyProofType
+				if p.Type == other {
+					other = api.InclusionProofType
+				}
+				if _, err := api.DecodeProof(raw, e, other); e.SelfDescribing() && err == nil {
+					t.Errorf("DecodeProof as %s succeeded, want error", other)
+				}
+			})
+		}
+	}
+}
+
+func TestProofEncodingFormats(t *testing.T) {
+	h := bytes.Repeat([]byte{0x01}, api.HashSize)
+	const b64 = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	for _, test := range []struct {
+		p    api.MerkleProof
+		e    api.ProofEncoding
+		want string
+	}{
+		{
+			p:    api.MerkleProof{Type: api.InclusionProofType, LeafIndex: 3, Hashes: [][]byte{h}},
+			e:    api.ProofEncodingJSON,
+			want: `{"leaf_index":3,"audit_path":["` + b64 + `"]}`,
+		}, {
+			p:    api.MerkleProof{Type: api.ConsistencyProofType},
+			e:    api.ProofEncodingJSON,
+			want: `{"consistency":[]}`,
+		}, {
+			p:    api.MerkleProof{Type: api.InclusionProofType, LeafIndex: 3, Hashes: [][]byte{h}},
+			e:    api.ProofEncodingPEM,
+			want: "-----BEGIN MERKLE INCLUSION PROOF-----\nLeaf-Index: 3\n\n" + b64 + "\n-----END MERKLE INCLUSION PROOF-----\n",
+		}, {
+			p:    api.MerkleProof{Type: api.ConsistencyProofType, Hashes: [][]byte{h}},
+			e:    api.ProofEncodingText,
+			want: b64 + "\n",
+		},
+	} {
+		raw, err := test.p.Encode(test.e)
+		if err != nil {
+			t.Fatalf("Encode(%s): %v", test.e, err)
+		}
+		if got := string(raw); got != test.want {
+			t.Errorf("Encode(%s) = %q, want %q", test.e, got, test.want)
+		}
+	}
+}
+
+func TestDecodeProofErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		raw  string
+		e    api.ProofEncoding
+		t    api.ProofType
+	}{
+		{desc: "unknown encoding", raw: "", e: "xml", t: api.InclusionProofType},
+		{desc: "unknown type", raw: "", e: api.ProofEncodingText, t: "audit"},
+		{desc: "short binary", raw: "abc", e: api.ProofEncodingBinary, t: api.InclusionProofType},
+		{desc: "JSON without leaf index", raw: `{"audit_path":[]}`, e: api.ProofEncodingJSON, t: api.InclusionProofType},
+		{desc: "JSON short hash", raw: `{"consistency":["YWJj"]}`, e: api.ProofEncodingJSON, t: api.ConsistencyProofType},
+		{desc: "PEM without leaf index", raw: "-----BEGIN MERKLE INCLUSION PROOF-----\n-----END MERKLE INCLUSION PROOF-----\n", e: api.ProofEncodingPEM, t: api.InclusionProofType},
+		{desc: "not PEM", raw: "hello", e: api.ProofEncodingPEM, t: api.ConsistencyProofType},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if p, err := api.DecodeProof([]byte(test.raw), test.e, test.t); err == nil {
+				t.Errorf("DecodeProof = %+v, want error", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AuditReceiptHeaderV0 is the first line of a marshaled audit receipt.
+const AuditReceiptHeaderV0 = "Serverless Log Audit Receipt v0"
+
+// AuditReceipt records that an auditor recomputed the tree of a log from its
+// entries, up to the given size, and found that it matched every tile. It's
+// published signed by the auditor's key, as a third party's attestation that
+// the log was correct up to that point.
+type AuditReceipt struct {
+	// Origin is the origin of the audited log.
+	Origin string
+	// Size and Hash are those of the checkpoint of the audited tree.
+	Size uint64
+	Hash []byte
+}
+
+// Marshal returns the serialised form of the receipt, in the following
+// format:
+//
+// Serverless Log Audit Receipt v0\n
+// <origin>\n
+// <size>\n
+// <base64 root hash>\n
+func (r AuditReceipt) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%d\n%s\n", AuditReceiptHeaderV0, r.Origin, r.Size, base64.StdEncoding.EncodeToString(r.Hash))
+	return b.Bytes()
+}
+
+// ParseAuditReceipt parses and validates the serialised form of an audit
+// receipt, as written by AuditReceipt.Marshal.
+func ParseAuditReceipt(raw []byte) (*AuditReceipt, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("audit receipt must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("audit receipt has %d lines, want 4", len(lines))
+	}
+	if lines[0] != AuditReceiptHeaderV0 {
+		return nil, fmt.Errorf("invalid audit receipt header %q", lines[0])
+	}
+	r := &AuditReceipt{Origin: lines[1]}
+	if len(r.Origin) == 0 {
+		return nil, errors.New("audit receipt has empty origin")
+	}
+	var err error
+	if r.Size, err = strconv.ParseUint(lines[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid audit receipt size %q: %w", lines[2], err)
+	}
+	if r.Hash, err = base64.StdEncoding.DecodeString(lines[3]); err != nil {
+		return nil, fmt.Errorf("invalid audit receipt root hash %q: %w", lines[3], err)
+	}
+	if len(r.Hash) != HashSize {
+		return nil, fmt.Errorf("audit receipt root hash has length %d, want %d", len(r.Hash), HashSize)
+	}
+	return r, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RedactionHeaderV0 is the first line of a marshaled redaction record.
+const RedactionHeaderV0 = "Serverless Log Redaction v0"
+
+// MaxRedactionReasonLen is the maximum length in bytes of the reason given
+// for a redaction.
+const MaxRedactionReasonLen = 1024
+
+// RedactionsOrigin returns the origin of the redaction log of the log with the
+// given origin, which lists the redaction records of the log's entries.
+func RedactionsOrigin(origin string) string {
+	return origin + "/redactions"
+}
+
+// Redaction records that the data of an entry in a log is withheld, e.g.
+// because it's illegal to distribute. The entry's leaf hash stays in the
+// log's tree, so proofs still verify, but its data is no longer served. The
+// record, signed with the log's key, is served as a tombstone in place of
+// the entry, and is listed in the log's redaction log.
+type Redaction struct {
+	// Origin is the origin of the log.
+	Origin string
+	// Index is the index of the entry in the log.
+	Index uint64
+	// LeafHash is the leaf hash of the entry.
+	LeafHash []byte
+	// Reason is why the entry was redacted, e.g. a reference to the takedown
+	// request.
+	Reason string
+}
+
+// ValidateRedactionReason checks that reason may be given as the reason for a
+// redaction. It must be a single line of UTF-8 text.
+func ValidateRedactionReason(reason string) error {
+	if len(reason) == 0 || len(reason) > MaxRedactionReasonLen {
+		return fmt.Errorf("invalid redaction reason length %d", len(reason))
+	}
+	if !utf8.ValidString(reason) {
+		return errors.New("redaction reason is not valid UTF-8")
+	}
+	if strings.IndexFunc(reason, unicode.IsControl) >= 0 {
+		return errors.New("redaction reason contains control characters")
+	}
+	return nil
+}
+
+// Marshal returns the serialised form of the redaction record, in the
+// following format:
+//
+// Serverless Log Redaction v0\n
+// <origin>\n
+// <index>\n
+// <base64 leaf hash>\n
+// <reason>\n
+func (r Redaction) Marshal() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%s\n%s\n", RedactionHeaderV0, r.Origin, r.Index, base64.StdEncoding.EncodeToString(r.LeafHash), r.Reason))
+}
+
+// ParseRedaction parses and validates the serialised form of a redaction
+// record, as written by Redaction.Marshal.
+func ParseRedaction(raw []byte) (*Redaction, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("redaction must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 5 {
+		return nil, fmt.Errorf("redaction has %d lines, want 5", len(lines))
+	}
+	if lines[0] != RedactionHeaderV0 {
+		return nil, fmt.Errorf("invalid redaction header %q", lines[0])
+	}
+	if len(lines[1]) == 0 {
+		return nil, errors.New("redaction has no origin")
+	}
+	r := &Redaction{Origin: lines[1], Reason: lines[4]}
+	var err error
+	if r.Index, err = strconv.ParseUint(lines[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid redaction index %q: %w", lines[2], err)
+	}
+	if r.LeafHash, err = base64.StdEncoding.DecodeString(lines[3]); err != nil || len(r.LeafHash) != HashSize {
+		return nil, fmt.Errorf("invalid redaction leaf hash %q", lines[3])
+	}
+	if err := ValidateRedactionReason(r.Reason); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseRedaction(t *testing.T) {
+	r := api.Redaction{Origin: "example.com/log", Index: 42, LeafHash: bytes.Repeat([]byte{0xab}, api.HashSize), Reason: "Court order 2023-17"}
+	got, err := api.ParseRedaction(r.Marshal())
+	if err != nil {
+		t.Fatalf("ParseRedaction: %v", err)
+	}
+	if diff := cmp.Diff(got, &r); len(diff) != 0 {
+		t.Errorf("ParseRedaction had diff %s", diff)
+	}
+	lh := strings.Repeat("q", 43) + "="
+	for _, raw := range []string{
+		"",
+		api.RedactionHeaderV0 + "\nexample.com/log\n42\n" + lh + "\nreason",
+		api.RedactionHeaderV0 + "\nexample.com/log\n42\n" + lh + "\nreason\n\n",
+		api.RedactionHeaderV0 + "\n\n42\n" + lh + "\nreason\n",
+		api.RedactionHeaderV0 + "\nexample.com/log\n-1\n" + lh + "\nreason\n",
+		api.RedactionHeaderV0 + "\nexample.com/log\n42\nabab\nreason\n",
+		api.RedactionHeaderV0 + "\nexample.com/log\n42\n" + lh + "\n\n",
+		"Serverless Log Timestamp v0\nexample.com/log\n42\n" + lh + "\nreason\n",
+	} {
+		if _, err := api.ParseRedaction([]byte(raw)); err == nil {
+			t.Errorf("ParseRedaction(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestValidateRedactionReason(t *testing.T) {
+	for _, test := range []struct {
+		reason  string
+		wantErr bool
+	}{
+		{reason: "DMCA takedown #1234"},
+		{reason: strings.Repeat("a", api.MaxRedactionReasonLen)},
+		{reason: "", wantErr: true},
+		{reason: strings.Repeat("a", api.MaxRedactionReasonLen+1), wantErr: true},
+		{reason: "two\nlines", wantErr: true},
+		{reason: "\xff", wantErr: true},
+	} {
+		if err := api.ValidateRedactionReason(test.reason); (err != nil) != test.wantErr {
+			t.Errorf("ValidateRedactionReason(%q) = %v, want error %t", test.reason, err, test.wantErr)
+		}
+	}
+}
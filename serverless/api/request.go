@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// MaxRequestIDLen is the maximum length in bytes of a request ID supplied by
+// a submitter.
+const MaxRequestIDLen = 256
+
+// ValidateRequestID checks that id may be used as the request ID of a
+// submission. Request IDs are opaque to the log, but must be non-empty and no
+// longer than MaxRequestIDLen.
+func ValidateRequestID(id string) error {
+	if len(id) == 0 || len(id) > MaxRequestIDLen {
+		return fmt.Errorf("invalid request ID length %d", len(id))
+	}
+	return nil
+}
+
+// RequestKey returns the key under which the outcome of the submission with
+// the given request ID is stored. Request IDs are hashed so that they needn't
+// be valid file names, and aren't revealed by the log's layout.
+func RequestKey(id string) []byte {
+	k := sha256.Sum256([]byte(id))
+	return k[:]
+}
+
+// RequestRecord records the sequencing of the entry submitted with a request
+// ID, so that retried submissions with the same ID are assigned the same
+// sequence number rather than being added again.
+type RequestRecord struct {
+	// LeafHash is the leaf hash of the submitted entry. A retry must submit
+	// the same entry.
+	LeafHash []byte
+	// Seq is the sequence number assigned to the entry. In the record of a
+	// submission which is still in progress, it's instead a lower bound on
+	// the number which will be assigned.
+	Seq uint64
+}
+
+// Marshal returns the serialised form of the record, in the following format:
+//
+// <hex leaf hash>\n
+// <hex sequence number>\n
+func (r RequestRecord) Marshal() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n", hex.EncodeToString(r.LeafHash), MarshalLeafIndex(r.Seq)))
+}
+
+// ParseRequestRecord parses the serialised form of a request record, as
+// written by RequestRecord.Marshal.
+func ParseRequestRecord(raw []byte) (*RequestRecord, error) {
+	lines := strings.Split(string(raw), "\n")
+	if len(lines) != 3 || len(lines[2]) != 0 {
+		return nil, fmt.Errorf("request record has %d lines, want 2", len(lines)-1)
+	}
+	lh, err := hex.DecodeString(lines[0])
+	if err != nil || len(lh) != HashSize {
+		return nil, fmt.Errorf("invalid request record leaf hash %q", lines[0])
+	}
+	seq, err := ParseLeafIndex([]byte(lines[1]))
+	if err != nil {
+		return nil, err
+	}
+	return &RequestRecord{LeafHash: lh, Seq: seq}, nil
+}
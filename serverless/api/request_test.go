@@ -0,0 +1,63 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseRequestRecord(t *testing.T) {
+	r := api.RequestRecord{LeafHash: bytes.Repeat([]byte{0xab}, api.HashSize), Seq: 0x1f}
+	got, err := api.ParseRequestRecord(r.Marshal())
+	if err != nil {
+		t.Fatalf("ParseRequestRecord: %v", err)
+	}
+	if diff := cmp.Diff(got, &r); len(diff) != 0 {
+		t.Errorf("ParseRequestRecord had diff %s", diff)
+	}
+	lh := strings.Repeat("ab", api.HashSize)
+	for _, raw := range []string{
+		"",
+		lh + "\n1f",
+		lh + "\n1f\n\n",
+		"abab\n1f\n",
+		lh + "\nbanana\n",
+	} {
+		if _, err := api.ParseRequestRecord([]byte(raw)); err == nil {
+			t.Errorf("ParseRequestRecord(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestValidateRequestID(t *testing.T) {
+	for _, test := range []struct {
+		id      string
+		wantErr bool
+	}{
+		{id: "lambda-request-1234"},
+		{id: strings.Repeat("a", api.MaxRequestIDLen)},
+		{id: "", wantErr: true},
+		{id: strings.Repeat("a", api.MaxRequestIDLen+1), wantErr: true},
+	} {
+		if err := api.ValidateRequestID(test.id); (err != nil) != test.wantErr {
+			t.Errorf("ValidateRequestID(%q) = %v, want error %t", test.id, err, test.wantErr)
+		}
+	}
+}
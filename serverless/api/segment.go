@@ -0,0 +1,106 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LogSegmentHeaderV0 is the first line of a marshaled log segment record.
+const LogSegmentHeaderV0 = "Serverless Log Segment v0"
+
+// LogSegment records the hash of a contiguous range of a host's log file, e.g.
+// from syslog, so that later tampering with the file can be detected. The
+// entries for a host's segments are associated with its name as identifier.
+type LogSegment struct {
+	// Host is the name of the host which wrote the file.
+	Host string
+	// File is the name of the file on the host.
+	File string
+	// Offset is the offset in bytes of the start of the segment in the file.
+	Offset uint64
+	// Length is the length in bytes of the segment.
+	Length uint64
+	// Hash is the SHA-256 hash of the contents of the segment.
+	Hash []byte
+}
+
+// Marshal returns the serialised form of the log segment record, in the
+// following format:
+//
+// Serverless Log Segment v0\n
+// <host>\n
+// <file>\n
+// <offset>\n
+// <length>\n
+// <base64 hash>\n
+func (s LogSegment) Marshal() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%s\n%d\n%d\n%s\n", LogSegmentHeaderV0, s.Host, s.File, s.Offset, s.Length, base64.StdEncoding.EncodeToString(s.Hash)))
+}
+
+// ValidateLogSegment checks that s can be marshaled and parsed back again.
+func ValidateLogSegment(s LogSegment) error {
+	if err := ValidateIdentifier(s.Host); err != nil {
+		return fmt.Errorf("invalid host: %w", err)
+	}
+	if len(s.File) == 0 || strings.IndexFunc(s.File, unicode.IsControl) >= 0 {
+		return fmt.Errorf("invalid file name %q", s.File)
+	}
+	if len(s.Hash) != HashSize {
+		return fmt.Errorf("invalid hash length %d", len(s.Hash))
+	}
+	return nil
+}
+
+// IsLogSegment returns true if the log entry e is a log segment record.
+func IsLogSegment(e []byte) bool {
+	return strings.HasPrefix(string(e), LogSegmentHeaderV0+"\n")
+}
+
+// ParseLogSegment parses and validates the serialised form of a log segment
+// record, as written by LogSegment.Marshal.
+func ParseLogSegment(raw []byte) (*LogSegment, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("log segment must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 6 {
+		return nil, fmt.Errorf("log segment has %d lines, want 6", len(lines))
+	}
+	if lines[0] != LogSegmentHeaderV0 {
+		return nil, fmt.Errorf("invalid log segment header %q", lines[0])
+	}
+	seg := &LogSegment{Host: lines[1], File: lines[2]}
+	var err error
+	if seg.Offset, err = strconv.ParseUint(lines[3], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid log segment offset %q: %w", lines[3], err)
+	}
+	if seg.Length, err = strconv.ParseUint(lines[4], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid log segment length %q: %w", lines[4], err)
+	}
+	if seg.Hash, err = base64.StdEncoding.DecodeString(lines[5]); err != nil {
+		return nil, fmt.Errorf("invalid log segment hash %q: %w", lines[5], err)
+	}
+	if err := ValidateLogSegment(*seg); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseLogSegment(t *testing.T) {
+	h := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.LogSegment
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "Serverless Log Segment v0\nhost1\n/var/log/syslog\n1024\n512\n" + h + "\n",
+			want: &api.LogSegment{Host: "host1", File: "/var/log/syslog", Offset: 1024, Length: 512, Hash: bytes.Repeat([]byte{0x01}, api.HashSize)},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Segment v1\nhost1\n/var/log/syslog\n1024\n512\n" + h + "\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Segment v0\nhost1\n/var/log/syslog\n1024\n512\n" + h,
+			wantErr: true,
+		}, {
+			desc:    "empty host",
+			raw:     "Serverless Log Segment v0\n\n/var/log/syslog\n1024\n512\n" + h + "\n",
+			wantErr: true,
+		}, {
+			desc:    "empty file",
+			raw:     "Serverless Log Segment v0\nhost1\n\n1024\n512\n" + h + "\n",
+			wantErr: true,
+		}, {
+			desc:    "bad offset",
+			raw:     "Serverless Log Segment v0\nhost1\n/var/log/syslog\n-1\n512\n" + h + "\n",
+			wantErr: true,
+		}, {
+			desc:    "short hash",
+			raw:     "Serverless Log Segment v0\nhost1\n/var/log/syslog\n1024\n512\nAQ==\n",
+			wantErr: true,
+		}, {
+			desc:    "extra line",
+			raw:     "Serverless Log Segment v0\nhost1\n/var/log/syslog\n1024\n512\n" + h + "\nbanana\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := api.ParseLogSegment([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseLogSegment: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("ParseLogSegment had diff %s", diff)
+			}
+			if m := got.Marshal(); string(m) != test.raw {
+				t.Errorf("Marshal = %q, want %q", m, test.raw)
+			}
+			if !api.IsLogSegment(got.Marshal()) {
+				t.Error("IsLogSegment = false, want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+// ShardsHeaderV0 is the first line of a marshaled shard index.
+const ShardsHeaderV0 = "Serverless Log Shards v0"
+
+// ShardIndex lists the shards of a sharded log. It's published in the root of
+// the sharded log, signed by the key which also signs each shard's
+// checkpoints.
+type ShardIndex struct {
+	// Origin is the origin of the sharded log. Each shard's origin is built
+	// from this with ShardOrigin.
+	Origin string
+	// Shards holds the names of the shards, in strictly increasing order.
+	// New entries are added to the last one.
+	Shards []string
+}
+
+// ShardOrigin returns the origin of the named shard of a sharded log with the
+// given origin.
+func ShardOrigin(origin, shard string) string {
+	return origin + "/" + shard
+}
+
+// Active returns the name of the shard to which new entries are added, or
+// the empty string if there are no shards.
+func (i ShardIndex) Active() string {
+	if len(i.Shards) == 0 {
+		return ""
+	}
+	return i.Shards[len(i.Shards)-1]
+}
+
+// Marshal returns the serialised form of the shard index, in the following
+// format:
+//
+// Serverless Log Shards v0\n
+// <origin>\n
+// <shard name>\n
+// ...
+func (i ShardIndex) Marshal() []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n", ShardsHeaderV0, i.Origin)
+	for _, s := range i.Shards {
+		fmt.Fprintf(b, "%s\n", s)
+	}
+	return b.Bytes()
+}
+
+// ParseShardIndex parses and validates the serialised form of a shard index,
+// as written by ShardIndex.Marshal.
+func ParseShardIndex(raw []byte) (*ShardIndex, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("shard index must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("shard index is too short")
+	}
+	if lines[0] != ShardsHeaderV0 {
+		return nil, fmt.Errorf("invalid shard index header %q", lines[0])
+	}
+	i := &ShardIndex{Origin: lines[1]}
+	if len(i.Origin) == 0 {
+		return nil, errors.New("shard index has empty origin")
+	}
+	for n, s := range lines[2:] {
+		if err := layout.ValidateElement(s); err != nil {
+			return nil, fmt.Errorf("invalid shard name: %w", err)
+		}
+		if n > 0 && s <= i.Shards[n-1] {
+			return nil, fmt.Errorf("shard %q is out of order", s)
+		}
+		i.Shards = append(i.Shards, s)
+	}
+	return i, nil
+}
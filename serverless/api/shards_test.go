@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseShardIndex(t *testing.T) {
+	for _, test := range []struct {
+		desc       string
+		raw        string
+		want       *api.ShardIndex
+		wantActive string
+		wantErr    bool
+	}{
+		{
+			desc: "no shards",
+			raw:  "Serverless Log Shards v0\nMy Log\n",
+			want: &api.ShardIndex{Origin: "My Log"},
+		}, {
+			desc:       "shards",
+			raw:        "Serverless Log Shards v0\nMy Log\n2022\n2023-q1\n2023-q2\n",
+			want:       &api.ShardIndex{Origin: "My Log", Shards: []string{"2022", "2023-q1", "2023-q2"}},
+			wantActive: "2023-q2",
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Shards v1\nMy Log\n2022\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Shards v0\nMy Log\n2022",
+			wantErr: true,
+		}, {
+			desc:    "empty origin",
+			raw:     "Serverless Log Shards v0\n\n2022\n",
+			wantErr: true,
+		}, {
+			desc:    "out of order",
+			raw:     "Serverless Log Shards v0\nMy Log\n2023\n2022\n",
+			wantErr: true,
+		}, {
+			desc:    "duplicate",
+			raw:     "Serverless Log Shards v0\nMy Log\n2022\n2022\n",
+			wantErr: true,
+		}, {
+			desc:    "path escape",
+			raw:     "Serverless Log Shards v0\nMy Log\n..\n",
+			wantErr: true,
+		}, {
+			desc:    "empty shard name",
+			raw:     "Serverless Log Shards v0\nMy Log\n\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			i, err := api.ParseShardIndex([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseShardIndex: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(i, test.want); len(diff) != 0 {
+				t.Errorf("ParseShardIndex had diff %s", diff)
+			}
+			if got := i.Active(); got != test.wantActive {
+				t.Errorf("Active() = %q, want %q", got, test.wantActive)
+			}
+		})
+	}
+}
+
+func FuzzParseShardIndex(f *testing.F) {
+	f.Add([]byte("Serverless Log Shards v0\nMy Log\n"))
+	f.Add([]byte("Serverless Log Shards v0\nMy Log\n2022\n2023-q1\n2023-q2\n"))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		i, err := api.ParseShardIndex(raw)
+		if err != nil {
+			return
+		}
+		i2, err := api.ParseShardIndex(i.Marshal())
+		if err != nil {
+			t.Fatalf("ParseShardIndex(Marshal(%q)): %v", raw, err)
+		}
+		if diff := cmp.Diff(i, i2); len(diff) != 0 {
+			t.Fatalf("Roundtripped shard index has diff: %s", diff)
+		}
+	})
+}
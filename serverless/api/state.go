@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"math/bits"
 	"strconv"
 	"strings"
 )
@@ -49,7 +50,7 @@ type Tile struct {
 // <Nodes[n] base64 encoded>\n
 func (t Tile) MarshalText() ([]byte, error) {
 	b := &bytes.Buffer{}
-	_, err := fmt.Fprintf(b, "%d\n%d\n", 32, t.NumLeaves)
+	_, err := fmt.Fprintf(b, "%d\n%d\n", HashSize, t.NumLeaves)
 	if err != nil {
 		return nil, err
 	}
@@ -66,29 +67,112 @@ func (t Tile) MarshalText() ([]byte, error) {
 // which were written by the MarshalText method above.
 func (t *Tile) UnmarshalText(raw []byte) error {
 	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) < 2 {
+		return fmt.Errorf("tile has %d lines, want at least 2", len(lines))
+	}
 	hs, err := strconv.ParseUint(lines[0], 10, 16)
 	if err != nil {
 		return fmt.Errorf("unable to parse hash size: %w", err)
 	}
-	if hs != 32 {
+	if hs != HashSize {
 		return fmt.Errorf("invalid hash size %d", hs)
 	}
 	numLeaves, err := strconv.ParseUint(lines[1], 10, 16)
 	if err != nil {
 		return fmt.Errorf("unable to parse numLeaves: %w", err)
 	}
+	if numLeaves > TileWidth {
+		return fmt.Errorf("invalid numLeaves %d, must be <= %d", numLeaves, TileWidth)
+	}
+	if n := len(lines) - 2; n > maxTileNodes {
+		return fmt.Errorf("tile has %d nodes, want <= %d", n, maxTileNodes)
+	}
 	nodes := make([][]byte, 0, numLeaves*2)
 	for l := 2; l < len(lines); l++ {
 		h, err := base64.StdEncoding.DecodeString(lines[l])
 		if err != nil {
 			return fmt.Errorf("unable to parse nodehash on line %d; %w", l, err)
 		}
+		// Empty lines represent ephemeral nodes which are not stored.
+		if len(h) != 0 && len(h) != HashSize {
+			return fmt.Errorf("invalid nodehash length %d on line %d", len(h), l)
+		}
 		nodes = append(nodes, h)
 	}
 	t.NumLeaves, t.Nodes = uint(numLeaves), nodes
 	return nil
 }
 
+// Trim returns a copy of the tile with only the nodes of its first n leaves,
+// as it was when it had n leaves.
+func (t Tile) Trim(n uint) *Tile {
+	r := &Tile{NumLeaves: n, Nodes: make([][]byte, 0, 2*TileWidth)}
+	for level := uint(0); n>>level > 0; level++ {
+		for i := uint64(0); i < uint64(n>>level); i++ {
+			k := TileNodeKey(level, i)
+			if k >= uint(len(t.Nodes)) {
+				break
+			}
+			if l := uint(len(r.Nodes)); k >= l {
+				r.Nodes = append(r.Nodes, make([][]byte, k-l+1)...)
+			}
+			r.Nodes[k] = t.Nodes[k]
+		}
+	}
+	return r
+}
+
+// CompactRange is the compact range covering the whole tree of a given size:
+// the hashes of its perfect subtrees, from left to right, from which the root
+// hash of the tree and of any extension of it can be computed.
+type CompactRange struct {
+	Size   uint64
+	Hashes [][]byte
+}
+
+// MarshalText implements encoding/TextMarshaler and writes out a CompactRange
+// in the following format:
+//
+// <tree size in decimal>\n
+// <Hashes[0] base64 encoded>\n
+// ...
+// <Hashes[n] base64 encoded>\n
+func (r CompactRange) MarshalText() ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%d\n", r.Size)
+	for _, h := range r.Hashes {
+		fmt.Fprintf(b, "%s\n", base64.StdEncoding.EncodeToString(h))
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler and reads compact ranges
+// which were written by the MarshalText method above.
+func (r *CompactRange) UnmarshalText(raw []byte) error {
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	size, err := strconv.ParseUint(lines[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("unable to parse tree size: %w", err)
+	}
+	// The tree has a perfect subtree for each bit set in its size.
+	if got, want := len(lines)-1, bits.OnesCount64(size); got != want {
+		return fmt.Errorf("compact range of tree size %d has %d hashes, want %d", size, got, want)
+	}
+	hashes := make([][]byte, 0, len(lines)-1)
+	for l := 1; l < len(lines); l++ {
+		h, err := base64.StdEncoding.DecodeString(lines[l])
+		if err != nil {
+			return fmt.Errorf("unable to parse hash on line %d: %w", l, err)
+		}
+		if len(h) != HashSize {
+			return fmt.Errorf("invalid hash length %d on line %d", len(h), l)
+		}
+		hashes = append(hashes, h)
+	}
+	r.Size, r.Hashes = size, hashes
+	return nil
+}
+
 // TileNodeKey generates keys used in Tile.Nodes array.
 func TileNodeKey(level uint, index uint64) uint {
 	return uint(1<<(level+1)*index + 1<<level - 1)
@@ -102,3 +102,43 @@ func TestMarshalTileRoundtrip(t *testing.T) {
 		})
 	}
 }
+
+func TestCompactRangeRoundtrip(t *testing.T) {
+	for _, size := range []uint64{0, 1, 6, 256, 1<<40 + 3} {
+		t.Run(fmt.Sprintf("size %d", size), func(t *testing.T) {
+			r := api.CompactRange{Size: size, Hashes: [][]byte{}}
+			for s := size; s > 0; s &= s - 1 {
+				h := make([]byte, api.HashSize)
+				rand.Read(h)
+				r.Hashes = append(r.Hashes, h)
+			}
+			raw, err := r.MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText() = %v", err)
+			}
+			var got api.CompactRange
+			if err := got.UnmarshalText(raw); err != nil {
+				t.Fatalf("UnmarshalText() = %v", err)
+			}
+			if diff := cmp.Diff(r, got); len(diff) != 0 {
+				t.Fatalf("Got compact range with diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCompactRangeUnmarshalErrors(t *testing.T) {
+	h := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	for _, raw := range []string{
+		"",
+		"x\n",
+		"3\n" + h + "\n",
+		"1\n" + h + "\n" + h + "\n",
+		"1\nYWJj\n",
+	} {
+		var r api.CompactRange
+		if err := r.UnmarshalText([]byte(raw)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %+v, want error", raw, r)
+		}
+	}
+}
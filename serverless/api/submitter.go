@@ -0,0 +1,103 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSubmitterLen is the maximum length in bytes of a submitter identity.
+const MaxSubmitterLen = 256
+
+// ValidateSubmitter checks that id may be recorded as the identity of the
+// submitter of entries, such as the ID of an API key or the subject of a
+// client certificate. Identities are opaque to the log, but must be non-empty,
+// no longer than MaxSubmitterLen, and a single line.
+func ValidateSubmitter(id string) error {
+	if len(id) == 0 || len(id) > MaxSubmitterLen {
+		return fmt.Errorf("invalid submitter length %d", len(id))
+	}
+	if strings.ContainsAny(id, "\r\n") {
+		return errors.New("submitter must be a single line")
+	}
+	return nil
+}
+
+// SubmitterKey returns the key under which the submissions of the submitter
+// with the given identity are recorded. Identities are hashed so that they
+// needn't be valid file names.
+func SubmitterKey(id string) []byte {
+	k := sha256.Sum256([]byte(id))
+	return k[:]
+}
+
+// SubmissionRecord records an entry submitted by a submitter, in the audit log
+// of their submissions.
+type SubmissionRecord struct {
+	// Time is when the entry was submitted.
+	Time time.Time
+	// Seq is the sequence number of the entry. If the submission was a
+	// duplicate, it's that of the entry it duplicated.
+	Seq uint64
+	// LeafHash is the leaf hash of the submitted entry.
+	LeafHash []byte
+}
+
+// Marshal returns the serialised form of the record, which is a single line
+// appended to the audit log of the submitter's submissions:
+//
+// <unix time in nanoseconds> <hex sequence number> <hex leaf hash>\n
+func (r SubmissionRecord) Marshal() []byte {
+	return []byte(fmt.Sprintf("%d %s %s\n", r.Time.UnixNano(), MarshalLeafIndex(r.Seq), hex.EncodeToString(r.LeafHash)))
+}
+
+// ParseSubmissionRecords parses an audit log of submissions, made up of the
+// records written by SubmissionRecord.Marshal.
+func ParseSubmissionRecords(raw []byte) ([]SubmissionRecord, error) {
+	s := string(raw)
+	if len(s) == 0 {
+		return nil, nil
+	}
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("submission records must end with a newline")
+	}
+	var r []SubmissionRecord
+	for _, l := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		f := strings.Split(l, " ")
+		if len(f) != 3 {
+			return nil, fmt.Errorf("invalid submission record %q", l)
+		}
+		ns, err := strconv.ParseInt(f[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid submission record time %q", f[0])
+		}
+		seq, err := ParseLeafIndex([]byte(f[1]))
+		if err != nil {
+			return nil, err
+		}
+		lh, err := hex.DecodeString(f[2])
+		if err != nil || len(lh) != HashSize {
+			return nil, fmt.Errorf("invalid submission record leaf hash %q", f[2])
+		}
+		r = append(r, SubmissionRecord{Time: time.Unix(0, ns), Seq: seq, LeafHash: lh})
+	}
+	return r, nil
+}
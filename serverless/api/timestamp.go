@@ -0,0 +1,85 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampHeaderV0 is the first line of a marshaled timestamp record.
+const TimestampHeaderV0 = "Serverless Log Timestamp v0"
+
+// TimestampsOrigin returns the origin of the timestamp log of the log with the
+// given origin. Entry i of the timestamp log records when entry i of the log
+// was sequenced.
+func TimestampsOrigin(origin string) string {
+	return origin + "/timestamps"
+}
+
+// Timestamp records the time at which an entry was sequenced into a log.
+type Timestamp struct {
+	// Index is the index of the entry in the log.
+	Index uint64
+	// LeafHash is the leaf hash of the entry.
+	LeafHash []byte
+	// Sequenced is the time at which the entry was sequenced.
+	Sequenced time.Time
+}
+
+// Marshal returns the serialised form of the timestamp record, in the
+// following format:
+//
+// Serverless Log Timestamp v0\n
+// <index>\n
+// <base64 leaf hash>\n
+// <unix nanoseconds>\n
+func (t Timestamp) Marshal() []byte {
+	return []byte(fmt.Sprintf("%s\n%d\n%s\n%d\n", TimestampHeaderV0, t.Index, base64.StdEncoding.EncodeToString(t.LeafHash), t.Sequenced.UnixNano()))
+}
+
+// ParseTimestamp parses and validates the serialised form of a timestamp
+// record, as written by Timestamp.Marshal.
+func ParseTimestamp(raw []byte) (*Timestamp, error) {
+	s := string(raw)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("timestamp must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("timestamp has %d lines, want 4", len(lines))
+	}
+	if lines[0] != TimestampHeaderV0 {
+		return nil, fmt.Errorf("invalid timestamp header %q", lines[0])
+	}
+	t := &Timestamp{}
+	var err error
+	if t.Index, err = strconv.ParseUint(lines[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid timestamp index %q: %w", lines[1], err)
+	}
+	if t.LeafHash, err = base64.StdEncoding.DecodeString(lines[2]); err != nil || len(t.LeafHash) != HashSize {
+		return nil, fmt.Errorf("invalid timestamp leaf hash %q", lines[2])
+	}
+	ns, err := strconv.ParseInt(lines[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp time %q: %w", lines[3], err)
+	}
+	t.Sequenced = time.Unix(0, ns)
+	return t, nil
+}
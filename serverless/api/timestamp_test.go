@@ -0,0 +1,76 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	lh := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    *api.Timestamp
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "Serverless Log Timestamp v0\n42\n" + lh + "\n1680000000000000001\n",
+			want: &api.Timestamp{Index: 42, LeafHash: bytes.Repeat([]byte{0x01}, api.HashSize), Sequenced: time.Unix(1680000000, 1)},
+		}, {
+			desc:    "bad header",
+			raw:     "Serverless Log Timestamp v1\n42\n" + lh + "\n1680000000000000001\n",
+			wantErr: true,
+		}, {
+			desc:    "no trailing newline",
+			raw:     "Serverless Log Timestamp v0\n42\n" + lh + "\n1680000000000000001",
+			wantErr: true,
+		}, {
+			desc:    "short leaf hash",
+			raw:     "Serverless Log Timestamp v0\n42\nAQ==\n1680000000000000001\n",
+			wantErr: true,
+		}, {
+			desc:    "bad time",
+			raw:     "Serverless Log Timestamp v0\n42\n" + lh + "\nyesterday\n",
+			wantErr: true,
+		}, {
+			desc:    "extra line",
+			raw:     "Serverless Log Timestamp v0\n42\n" + lh + "\n1680000000000000001\nbanana\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := api.ParseTimestamp([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseTimestamp: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("ParseTimestamp had diff %s", diff)
+			}
+			if m := got.Marshal(); string(m) != test.raw {
+				t.Errorf("Marshal = %q, want %q", m, test.raw)
+			}
+		})
+	}
+}
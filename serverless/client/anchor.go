@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Anchor is a checkpoint of one log which was sequenced as an entry of
+// another, the anchoring log. Its inclusion in the anchoring log shows that
+// the checkpoint existed by the time the anchoring log committed to it, and
+// that the anchored log presented it to the world.
+type Anchor struct {
+	// Index is the index of the entry in the anchoring log.
+	Index uint64
+	// Checkpoint is the anchored checkpoint.
+	Checkpoint log.Checkpoint
+	// Raw is the anchored checkpoint's signed note, as sequenced.
+	Raw []byte
+}
+
+// FindAnchors returns the checkpoints of the log with verifier v and the given
+// origin which were sequenced as entries in the range [begin, end) of the
+// anchoring log, read with f. The entries must be committed to by cp, the
+// anchoring log's checkpoint. Entries which aren't checkpoints of the log are
+// skipped.
+func FindAnchors(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, begin, end uint64, v note.Verifier, origin string) ([]Anchor, error) {
+	leaves, err := FetchVerifiedLeaves(ctx, f, h, cp, begin, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch entries of the anchoring log: %w", err)
+	}
+	var anchors []Anchor
+	for i, l := range leaves {
+		c, _, _, err := log.ParseCheckpoint(l, origin, v)
+		if err != nil {
+			continue
+		}
+		anchors = append(anchors, Anchor{Index: begin + uint64(i), Checkpoint: *c, Raw: l})
+	}
+	return anchors, nil
+}
+
+// VerifyAnchors checks that anchors, ordered by their index in the anchoring
+// log, are of a single append-only view of the anchored log: no anchor is of a
+// smaller tree than one before it, and every anchored checkpoint is consistent
+// with cp, the anchored log's checkpoint, whose tiles are read with f. Any
+// anchors of a larger tree than cp's are an error, since they can't be
+// checked.
+func VerifyAnchors(ctx context.Context, f Fetcher, h merkle.LogHasher, anchors []Anchor, cp log.Checkpoint) error {
+	cps := make([]log.Checkpoint, 0, len(anchors)+1)
+	for i, a := range anchors {
+		if i > 0 {
+			prev := anchors[i-1]
+			if a.Index <= prev.Index {
+				return fmt.Errorf("anchors at indices %d and %d are out of order", prev.Index, a.Index)
+			}
+			if a.Checkpoint.Size < prev.Checkpoint.Size {
+				return fmt.Errorf("anchor at index %d has tree size %d, smaller than %d at index %d: %w", a.Index, a.Checkpoint.Size, prev.Checkpoint.Size, prev.Index, ErrInconsistentTree)
+			}
+		}
+		if a.Checkpoint.Size > cp.Size {
+			return fmt.Errorf("anchor at index %d has tree size %d, larger than the checkpoint's %d", a.Index, a.Checkpoint.Size, cp.Size)
+		}
+		cps = append(cps, a.Checkpoint)
+	}
+	if len(cps) == 0 {
+		return nil
+	}
+	if err := CheckConsistency(ctx, h, f, append(cps, cp)); err != nil {
+		return fmt.Errorf("anchored checkpoints are inconsistent: %w", err)
+	}
+	return nil
+}
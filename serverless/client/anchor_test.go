@@ -0,0 +1,122 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestAnchors(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	key := newTestKey(t, "log-a")
+	entries := func(n int) [][]byte {
+		r := make([][]byte, n)
+		for i := range r {
+			r[i] = []byte(fmt.Sprintf("a %d", i))
+		}
+		return r
+	}
+	// checkpoint returns the signed checkpoint of log A with n entries.
+	checkpoint := func(n int) []byte {
+		_, cp := buildLogOf(t, "Log A", entries(n))
+		return key.sign(t, string(cp.Marshal()))
+	}
+	aFiles, aCP := buildLogOf(t, "Log A", entries(20))
+	fetcher := func(files map[string][]byte) Fetcher {
+		return func(_ context.Context, p string) ([]byte, error) {
+			d, ok := files[p]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return d, nil
+		}
+	}
+
+	// Log B has checkpoints of log A at sizes 3 and 10 among other entries.
+	bFiles, bCP := buildLogOf(t, "Log B", [][]byte{[]byte("b 0"), checkpoint(3), []byte("b 2"), checkpoint(10), []byte("b 4")})
+	anchors, err := FindAnchors(ctx, fetcher(bFiles), h, bCP, 0, bCP.Size, key.v, "Log A")
+	if err != nil {
+		t.Fatalf("FindAnchors: %v", err)
+	}
+	if got, want := len(anchors), 2; got != want {
+		t.Fatalf("FindAnchors found %d anchors, want %d", got, want)
+	}
+	for i, want := range []struct{ index, size uint64 }{{1, 3}, {3, 10}} {
+		if a := anchors[i]; a.Index != want.index || a.Checkpoint.Size != want.size {
+			t.Errorf("Anchor %d at index %d of size %d, want index %d of size %d", i, a.Index, a.Checkpoint.Size, want.index, want.size)
+		}
+	}
+	if got, err := FindAnchors(ctx, fetcher(bFiles), h, bCP, 2, 3, key.v, "Log A"); err != nil || len(got) != 0 {
+		t.Errorf("FindAnchors(2, 3) = %v, %v, want no anchors", got, err)
+	}
+
+	// forked returns an anchor of a checkpoint of log A with n entries, but
+	// the root hash of a different tree.
+	forked := func(index uint64, n int) Anchor {
+		es := entries(n)
+		es[0] = []byte("fork")
+		_, cp := buildLogOf(t, "Log A", es)
+		return Anchor{Index: index, Checkpoint: cp}
+	}
+	for _, test := range []struct {
+		desc    string
+		anchors []Anchor
+		cp      log.Checkpoint
+		wantErr bool
+	}{
+		{
+			desc:    "consistent",
+			anchors: anchors,
+			cp:      aCP,
+		}, {
+			desc: "none",
+			cp:   aCP,
+		}, {
+			desc:    "fork",
+			anchors: append(anchors[:1:1], forked(5, 15)),
+			cp:      aCP,
+			wantErr: true,
+		}, {
+			desc:    "rolled back",
+			anchors: []Anchor{{Index: 1, Checkpoint: anchors[1].Checkpoint}, {Index: 3, Checkpoint: anchors[0].Checkpoint}},
+			cp:      aCP,
+			wantErr: true,
+		}, {
+			desc:    "out of order",
+			anchors: []Anchor{anchors[1], anchors[0]},
+			cp:      aCP,
+			wantErr: true,
+		}, {
+			desc:    "ahead of checkpoint",
+			anchors: anchors,
+			cp:      anchors[0].Checkpoint,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := VerifyAnchors(ctx, fetcher(aFiles), h, test.anchors, test.cp)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyAnchors: %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
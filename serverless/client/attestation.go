@@ -0,0 +1,123 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// ErrAttestationExpired is returned for a verification attestation which is
+// older than it may be trusted for.
+var ErrAttestationExpired = errors.New("verification attestation has expired")
+
+// OpenVerificationAttestation verifies the signature with verifier v on the
+// verification attestation note raw, which must be for the log with the given
+// origin, and returns the attestation. An attestation made more than ttl
+// before now is rejected with an error wrapping ErrAttestationExpired.
+func OpenVerificationAttestation(raw []byte, v note.Verifier, origin string, ttl time.Duration, now time.Time) (*api.VerificationAttestation, error) {
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open verification attestation: %w", err)
+	}
+	a, err := api.ParseVerificationAttestation([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verification attestation: %w", err)
+	}
+	if a.Origin != origin {
+		return nil, fmt.Errorf("verification attestation has origin %q, want %q", a.Origin, origin)
+	}
+	if a.Time.After(now) {
+		return nil, fmt.Errorf("verification attestation was made in the future, at %v", a.Time)
+	}
+	if now.Sub(a.Time) > ttl {
+		return nil, fmt.Errorf("verification attestation made at %v: %w", a.Time, ErrAttestationExpired)
+	}
+	return a, nil
+}
+
+// AttestationCache holds signed verification attestations for the artifacts
+// of a single log in a local directory, so that the tools on a host which
+// share it only need to verify an artifact once within the attestations' time
+// to live.
+type AttestationCache struct {
+	dir    string
+	origin string
+	s      note.Signer
+	v      note.Verifier
+	ttl    time.Duration
+}
+
+// NewAttestationCache returns a cache of attestations in dir for the log with
+// the given origin, which are signed with s and trusted if they verify with v
+// and were made at most ttl ago. s may be nil if the cache is only read.
+func NewAttestationCache(dir, origin string, s note.Signer, v note.Verifier, ttl time.Duration) *AttestationCache {
+	return &AttestationCache{dir: dir, origin: origin, s: s, v: v, ttl: ttl}
+}
+
+// Lookup returns the attestation that the artifact with leaf hash lh was
+// verified, if there's one which can be trusted at time now. If there isn't,
+// the error wraps os.ErrNotExist or ErrAttestationExpired.
+func (c *AttestationCache) Lookup(lh []byte, now time.Time) (*api.VerificationAttestation, error) {
+	raw, err := os.ReadFile(c.path(lh))
+	if err != nil {
+		return nil, err
+	}
+	a, err := OpenVerificationAttestation(raw, c.v, c.origin, c.ttl, now)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(a.LeafHash, lh) {
+		return nil, fmt.Errorf("verification attestation is for leaf hash %x, want %x", a.LeafHash, lh)
+	}
+	return a, nil
+}
+
+// Attest signs an attestation that the artifact with leaf hash lh at index idx
+// was verified against the checkpoint cp at time now, and stores it in the
+// cache, replacing any earlier one. Returns the signed attestation.
+func (c *AttestationCache) Attest(cp log.Checkpoint, idx uint64, lh []byte, now time.Time) ([]byte, error) {
+	if c.s == nil {
+		return nil, errors.New("attestation cache has no signer")
+	}
+	a := api.VerificationAttestation{Origin: c.origin, Size: cp.Size, Hash: cp.Hash, Index: idx, LeafHash: lh, Time: now}
+	raw, err := note.Sign(&note.Note{Text: string(a.Marshal())}, c.s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign verification attestation: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return nil, err
+	}
+	// Other processes may be reading the attestation, so it's replaced
+	// atomically.
+	if err := writeAtomic(c.path(lh), raw); err != nil {
+		return nil, fmt.Errorf("failed to store verification attestation: %w", err)
+	}
+	return raw, nil
+}
+
+// path returns the path of the attestation for the artifact with leaf hash lh.
+func (c *AttestationCache) path(lh []byte) string {
+	return filepath.Join(c.dir, hex.EncodeToString(lh))
+}
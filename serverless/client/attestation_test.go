@@ -0,0 +1,96 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/transparency-dev/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestAttestationCache(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "host")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	dir := t.TempDir()
+	root := sha256.Sum256([]byte("root"))
+	cp := log.Checkpoint{Origin: "My Log", Size: 10, Hash: root[:]}
+	lh := sha256.Sum256([]byte("artifact"))
+	other := sha256.Sum256([]byte("other artifact"))
+	now := time.Unix(1700000000, 0)
+
+	c := NewAttestationCache(dir, "My Log", s, v, time.Hour)
+	if _, err := c.Lookup(lh[:], now); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Lookup before Attest = %v, want ErrNotExist", err)
+	}
+	raw, err := c.Attest(cp, 3, lh[:], now)
+	if err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+
+	// Another tool which only reads the cache trusts the attestation within
+	// its time to live.
+	r := NewAttestationCache(dir, "My Log", nil, v, time.Hour)
+	a, err := r.Lookup(lh[:], now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if a.Index != 3 || a.Size != 10 || !a.Time.Equal(now) {
+		t.Errorf("Lookup = %+v, want index 3 of size 10 at %v", a, now)
+	}
+	if _, err := r.Lookup(lh[:], now.Add(2*time.Hour)); !errors.Is(err, ErrAttestationExpired) {
+		t.Errorf("Lookup after TTL = %v, want ErrAttestationExpired", err)
+	}
+	if _, err := r.Lookup(lh[:], now.Add(-time.Minute)); err == nil {
+		t.Error("Lookup of attestation from the future succeeded")
+	}
+	if _, err := r.Lookup(other[:], now); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Lookup of other artifact = %v, want ErrNotExist", err)
+	}
+	if _, err := r.Attest(cp, 3, lh[:], now); err == nil {
+		t.Error("Attest without signer succeeded")
+	}
+
+	// Attestations are only trusted for the right log and key.
+	if _, err := OpenVerificationAttestation(raw, v, "Other Log", time.Hour, now); err == nil {
+		t.Error("OpenVerificationAttestation for other origin succeeded")
+	}
+	_, vkey2, err := note.GenerateKey(rand.Reader, "host")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	v2, err := note.NewVerifier(vkey2)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	if _, err := NewAttestationCache(dir, "My Log", nil, v2, time.Hour).Lookup(lh[:], now); err == nil {
+		t.Error("Lookup with another key succeeded")
+	}
+}
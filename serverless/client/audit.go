@@ -0,0 +1,303 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultMaxMismatches is the number of mismatches reported by Audit unless
+// configured otherwise.
+const DefaultMaxMismatches = 10
+
+// AuditOptions configures Audit.
+type AuditOptions struct {
+	// Workers is the number of tiles verified at once, runtime.NumCPU() if
+	// zero.
+	Workers int
+	// MaxMismatches is the number of mismatches reported,
+	// DefaultMaxMismatches if zero.
+	MaxMismatches int
+	// From, if its Size is non-zero, is the checkpoint of a previous audit
+	// of the log. The tree being audited must be an extension of it, and
+	// only the tiles and entries added since are verified.
+	From log.Checkpoint
+}
+
+// Mismatch describes a node of the tree whose hash doesn't match the data it
+// commits to.
+type Mismatch struct {
+	// Level and Index are the coordinates of the node in the tree. For an
+	// entry they're those of its leaf, so Index is the entry's index.
+	Level, Index uint64
+	// Path is the path of the entry or tile holding the node.
+	Path string
+	// Reason describes what the node doesn't match.
+	Reason string
+}
+
+// less orders mismatches by their position in the tree.
+func (m Mismatch) less(o Mismatch) bool {
+	if m.Level != o.Level {
+		return m.Level < o.Level
+	}
+	if m.Index != o.Index {
+		return m.Index < o.Index
+	}
+	return m.Path < o.Path
+}
+
+// AuditReport describes the mismatches found by Audit.
+type AuditReport struct {
+	// Mismatches holds the first of the mismatches found, ordered by level
+	// and then index, so that auditing the same data always gives the same
+	// report however the work was scheduled.
+	Mismatches []Mismatch
+	// Total is the number of mismatches found, which may be more than were
+	// reported.
+	Total int
+}
+
+// OK returns true if no mismatches were found.
+func (r AuditReport) OK() bool {
+	return r.Total == 0
+}
+
+// Audit recomputes the tree committed to by cp from the entries read with f,
+// using a pool of workers to verify tiles in parallel. The leaf hash of each
+// entry must match its level 0 tile, the hashes in each tile must match the
+// nodes below them, and the bottom row of each tile above level 0 must match
+// the roots of the tiles below it. Redacted entries are checked by the leaf
+// hash recorded in their tombstone instead. Missing entries are reported as
+// mismatches, while missing tiles are an error, since VerifyLayout is better
+// suited to finding them. If no mismatches are found, the tiles must also
+// commit to cp's root hash, or an error is returned.
+//
+// Every entry is fetched, so for a large log this is as expensive as a full
+// mirror, unless the audit continues from a previous one with opts.From.
+func Audit(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, opts AuditOptions) (*AuditReport, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	a := &auditor{
+		f:       f,
+		h:       h,
+		rf:      &compact.RangeFactory{Hash: h.HashChildren},
+		getTile: newTileFetcher(f, cp.Size),
+		size:    cp.Size,
+		max:     opts.MaxMismatches,
+	}
+	if a.max <= 0 {
+		a.max = DefaultMaxMismatches
+	}
+	from := opts.From
+	if from.Size > 0 {
+		if from.Origin != cp.Origin {
+			return nil, fmt.Errorf("previous audit was of log %q, not %q", from.Origin, cp.Origin)
+		}
+		if from.Size > cp.Size {
+			return nil, fmt.Errorf("previous audit was of tree size %d, larger than %d", from.Size, cp.Size)
+		}
+		if err := CheckConsistency(ctx, h, f, []log.Checkpoint{from, cp}); err != nil {
+			return nil, fmt.Errorf("tree isn't an extension of the one previously audited: %w", err)
+		}
+	}
+
+	// below holds the roots of the full tiles of the level below which were
+	// verified by this audit, rather than a previous one.
+	var below [][]byte
+	for level := uint64(0); cp.Size>>(level*8) > 0; level++ {
+		width := cp.Size >> (level * 8)
+		roots := make([][]byte, width/256)
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(workers)
+		// Tiles wholly covered by the previous audit are skipped.
+		for i := (from.Size >> (level * 8)) / 256; i*256 < width; i++ {
+			level, i := level, i
+			g.Go(func() error {
+				root, err := a.verifyTile(gctx, level, i, below)
+				if root != nil {
+					roots[i] = root
+				}
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+		below = roots
+	}
+
+	r := &AuditReport{Mismatches: a.found, Total: a.total}
+	if r.OK() && cp.Size > 0 {
+		if err := verifyTilesRoot(ctx, f, h, cp); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// OpenAuditReceipt verifies the signature of the auditor with verifier v on
+// the audit receipt note raw, which must be for the log with the given origin,
+// and returns the receipt.
+func OpenAuditReceipt(raw []byte, v note.Verifier, origin string) (*api.AuditReceipt, error) {
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit receipt: %w", err)
+	}
+	r, err := api.ParseAuditReceipt([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audit receipt: %w", err)
+	}
+	if r.Origin != origin {
+		return nil, fmt.Errorf("audit receipt has origin %q, want %q", r.Origin, origin)
+	}
+	return r, nil
+}
+
+// auditor holds the state of a call to Audit.
+type auditor struct {
+	f       Fetcher
+	h       merkle.LogHasher
+	rf      *compact.RangeFactory
+	getTile GetTileFunc
+	size    uint64
+	max     int
+
+	// mu guards found and total.
+	mu    sync.Mutex
+	found []Mismatch
+	total int
+}
+
+// mismatch records m, keeping only the first a.max mismatches in order.
+func (a *auditor) mismatch(m Mismatch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total++
+	i := sort.Search(len(a.found), func(i int) bool { return m.less(a.found[i]) })
+	if i >= a.max {
+		return
+	}
+	a.found = append(a.found, Mismatch{})
+	copy(a.found[i+1:], a.found[i:])
+	a.found[i] = m
+	if len(a.found) > a.max {
+		a.found = a.found[:a.max]
+	}
+}
+
+// verifyTile verifies the tile at the given level and index against the
+// entries it commits to, or against below, the roots of the tiles of the level
+// below. It returns the root of the tile if it's full.
+func (a *auditor) verifyTile(ctx context.Context, level, index uint64, below [][]byte) ([]byte, error) {
+	n := a.size>>(level*8) - index*256
+	if n > 256 {
+		n = 256
+	}
+	t, err := a.getTile(ctx, level, index)
+	if err != nil {
+		return nil, err
+	}
+	p := path.Join(layout.TilePath("", level, index, n%256))
+	if uint64(t.NumLeaves) < n {
+		return nil, fmt.Errorf("tile %q has %d leaves, want %d", p, t.NumLeaves, n)
+	}
+
+	cr := a.rf.NewEmptyRange(0)
+	for j := uint64(0); j < n; j++ {
+		k := api.TileNodeKey(0, j)
+		if k >= uint(len(t.Nodes)) {
+			return nil, fmt.Errorf("tile %q is missing leaf %d", p, j)
+		}
+		node := t.Nodes[k]
+		if err := a.verifyLeaf(ctx, level, index*256+j, node, p, below); err != nil {
+			return nil, err
+		}
+		if err := cr.Append(node, func(id compact.NodeID, hash []byte) {
+			// The leaves were checked above, and the root is the next
+			// level's to check.
+			if id.Level == 0 || id.Level == 8 {
+				return
+			}
+			if k := api.TileNodeKey(id.Level, id.Index); k >= uint(len(t.Nodes)) || !bytes.Equal(t.Nodes[k], hash) {
+				a.mismatch(Mismatch{
+					Level:  level*8 + uint64(id.Level),
+					Index:  index<<(8-id.Level) + id.Index,
+					Path:   p,
+					Reason: "doesn't match the hash of its children",
+				})
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if n < 256 {
+		return nil, nil
+	}
+	return cr.GetRootHash(nil)
+}
+
+// verifyLeaf verifies the node on the bottom row of a tile at the given level,
+// which has the given index at that level, against the entry or the root of
+// the tile below that it commits to.
+func (a *auditor) verifyLeaf(ctx context.Context, level, index uint64, node []byte, tilePath string, below [][]byte) error {
+	if level > 0 {
+		// Tiles which were verified by a previous audit are committed to
+		// by its checkpoint, with which this tree is consistent.
+		if below[index] != nil && !bytes.Equal(node, below[index]) {
+			a.mismatch(Mismatch{
+				Level:  level * 8,
+				Index:  index,
+				Path:   tilePath,
+				Reason: fmt.Sprintf("doesn't match the root of tile %q", path.Join(layout.TilePath("", level-1, index, 0))),
+			})
+		}
+		return nil
+	}
+	p := path.Join(layout.SeqPath("", index))
+	e, r, err := getLeaf(ctx, a.f, index)
+	if errors.Is(err, os.ErrNotExist) {
+		a.mismatch(Mismatch{Index: index, Path: p, Reason: "is missing"})
+		return nil
+	} else if err != nil {
+		return err
+	}
+	lh := a.h.HashLeaf(e)
+	if r != nil {
+		lh, p = r.LeafHash, path.Join(layout.TombstonePath("", index))
+	}
+	if !bytes.Equal(lh, node) {
+		a.mismatch(Mismatch{Index: index, Path: p, Reason: fmt.Sprintf("doesn't match its leaf hash in tile %q", tilePath)})
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// buildTiledLog returns the files of a log of the given size, laid out as by
+// integration, along with its checkpoint.
+func buildTiledLog(t *testing.T, size uint64) (map[string][]byte, log.Checkpoint) {
+	t.Helper()
+	entries := make([][]byte, size)
+	for i := range entries {
+		entries[i] = []byte(fmt.Sprintf("entry %d", i))
+	}
+	return buildLogOf(t, "audit", entries)
+}
+
+// buildLogOf returns the files of a log with the given origin and entries,
+// laid out as by integration, along with its checkpoint.
+func buildLogOf(t *testing.T, origin string, entries [][]byte) (map[string][]byte, log.Checkpoint) {
+	t.Helper()
+	h := rfc6962.DefaultHasher
+	files := make(map[string][]byte)
+	type tileKey struct{ level, index uint64 }
+	tiles := make(map[tileKey]*api.Tile)
+	cr := (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0)
+	for i, e := range entries {
+		files[path.Join(layout.SeqPath("", uint64(i)))] = e
+		if err := cr.Append(h.HashLeaf(e), func(id compact.NodeID, hash []byte) {
+			tl, ti, nl, ni := layout.NodeCoordsToTileAddress(uint64(id.Level), id.Index)
+			tile := tiles[tileKey{tl, ti}]
+			if tile == nil {
+				tile = &api.Tile{}
+				tiles[tileKey{tl, ti}] = tile
+			}
+			k := api.TileNodeKey(nl, ni)
+			if l := uint(len(tile.Nodes)); k >= l {
+				tile.Nodes = append(tile.Nodes, make([][]byte, k-l+1)...)
+			}
+			tile.Nodes[k] = hash
+			if nl == 0 && ni >= uint64(tile.NumLeaves) {
+				tile.NumLeaves = uint(ni + 1)
+			}
+		}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	for k, tile := range tiles {
+		raw, err := tile.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText: %v", err)
+		}
+		files[path.Join(layout.TilePath("", k.level, k.index, uint64(tile.NumLeaves)%256))] = raw
+	}
+	root, err := cr.GetRootHash(nil)
+	if err != nil {
+		t.Fatalf("GetRootHash: %v", err)
+	}
+	return files, log.Checkpoint{Origin: origin, Size: uint64(len(entries)), Hash: root}
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	// Two full level 0 tiles and a partial one, under a partial level 1 tile.
+	files, cp := buildTiledLog(t, 515)
+	_, cp300 := buildTiledLog(t, 300)
+	tilePath := func(level, index, size uint64) string {
+		return path.Join(layout.TilePath("", level, index, size))
+	}
+	// setNode returns the tile at p with the node at the given coordinates
+	// set to hash.
+	setNode := func(p string, level uint, index uint64, hash []byte) []byte {
+		t.Helper()
+		tile, err := api.ParseTile(files[p])
+		if err != nil {
+			t.Fatalf("ParseTile: %v", err)
+		}
+		tile.Nodes[api.TileNodeKey(level, index)] = hash
+		raw, err := tile.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText: %v", err)
+		}
+		return raw
+	}
+	bad := h.HashLeaf([]byte("banana"))
+	seq := func(i uint64) string { return path.Join(layout.SeqPath("", i)) }
+
+	for _, test := range []struct {
+		desc          string
+		cp            log.Checkpoint
+		from          log.Checkpoint
+		files         map[string][]byte
+		maxMismatches int
+		want          AuditReport
+		wantErr       bool
+	}{
+		{
+			desc: "intact",
+			cp:   cp,
+		}, {
+			desc:  "altered entries",
+			cp:    cp,
+			files: map[string][]byte{seq(300): []byte("banana"), seq(3): []byte("banana"), seq(514): nil},
+			want: AuditReport{
+				Mismatches: []Mismatch{
+					{Index: 3, Path: seq(3), Reason: fmt.Sprintf("doesn't match its leaf hash in tile %q", tilePath(0, 0, 0))},
+					{Index: 300, Path: seq(300), Reason: fmt.Sprintf("doesn't match its leaf hash in tile %q", tilePath(0, 1, 0))},
+					{Index: 514, Path: seq(514), Reason: "is missing"},
+				},
+				Total: 3,
+			},
+		}, {
+			desc:          "first mismatches",
+			cp:            cp,
+			files:         map[string][]byte{seq(300): []byte("banana"), seq(3): []byte("banana"), seq(514): nil},
+			maxMismatches: 1,
+			want: AuditReport{
+				Mismatches: []Mismatch{
+					{Index: 3, Path: seq(3), Reason: fmt.Sprintf("doesn't match its leaf hash in tile %q", tilePath(0, 0, 0))},
+				},
+				Total: 3,
+			},
+		}, {
+			desc:  "inconsistent tile",
+			cp:    cp,
+			files: map[string][]byte{tilePath(0, 1, 0): setNode(tilePath(0, 1, 0), 3, 5, bad)},
+			want: AuditReport{
+				Mismatches: []Mismatch{
+					{Level: 3, Index: 37, Path: tilePath(0, 1, 0), Reason: "doesn't match the hash of its children"},
+				},
+				Total: 1,
+			},
+		}, {
+			desc:  "inconsistent levels",
+			cp:    cp,
+			files: map[string][]byte{tilePath(1, 0, 2): setNode(tilePath(1, 0, 2), 0, 1, bad)},
+			want: AuditReport{
+				Mismatches: []Mismatch{
+					{Level: 8, Index: 1, Path: tilePath(1, 0, 2), Reason: fmt.Sprintf("doesn't match the root of tile %q", tilePath(0, 1, 0))},
+					// The tile's own hashes are computed from the altered node.
+					{Level: 9, Index: 0, Path: tilePath(1, 0, 2), Reason: "doesn't match the hash of its children"},
+				},
+				Total: 2,
+			},
+		}, {
+			desc:  "continued",
+			cp:    cp,
+			from:  cp300,
+			files: map[string][]byte{seq(3): []byte("banana"), seq(300): []byte("banana")},
+			want: AuditReport{
+				// Entry 3 was audited before, so isn't fetched again.
+				Mismatches: []Mismatch{
+					{Index: 300, Path: seq(300), Reason: fmt.Sprintf("doesn't match its leaf hash in tile %q", tilePath(0, 1, 0))},
+				},
+				Total: 1,
+			},
+		}, {
+			desc: "continued from same size",
+			cp:   cp,
+			from: cp,
+		}, {
+			desc:    "continued from inconsistent",
+			cp:      cp,
+			from:    log.Checkpoint{Origin: cp.Origin, Size: 300, Hash: bad},
+			wantErr: true,
+		}, {
+			desc:    "continued from larger",
+			cp:      cp300,
+			from:    cp,
+			wantErr: true,
+		}, {
+			desc:    "missing tile",
+			cp:      cp,
+			files:   map[string][]byte{tilePath(0, 1, 0): nil},
+			wantErr: true,
+		}, {
+			desc:    "wrong root",
+			cp:      log.Checkpoint{Origin: cp.Origin, Size: cp.Size, Hash: bad},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				d, ok := test.files[p]
+				if !ok {
+					d, ok = files[p]
+				}
+				if !ok || d == nil {
+					return nil, os.ErrNotExist
+				}
+				return d, nil
+			}
+			// Audit with a single worker as well as several, which must
+			// give the same report.
+			for _, workers := range []int{1, 4} {
+				got, err := Audit(ctx, f, h, test.cp, AuditOptions{Workers: workers, MaxMismatches: test.maxMismatches, From: test.from})
+				if gotErr := err != nil; gotErr != test.wantErr {
+					t.Fatalf("Audit(%d workers): %v, want error %t", workers, err, test.wantErr)
+				}
+				if err != nil {
+					continue
+				}
+				if diff := cmp.Diff(&test.want, got); diff != "" {
+					t.Errorf("Audit(%d workers) had diff (-want +got):\n%s", workers, diff)
+				}
+			}
+		})
+	}
+}
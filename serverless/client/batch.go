@@ -0,0 +1,197 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/proof"
+)
+
+// BatchInclusionProof is a compact representation of the inclusion proofs for
+// a number of leaves in the same tree, in which each distinct proof node hash
+// is stored only once.
+type BatchInclusionProof struct {
+	// Size is the size of the tree the proofs were built for.
+	Size uint64
+	// Indices are the indices of the leaves, in the order they were requested.
+	Indices []uint64
+	// Nodes are the distinct node hashes used by the proofs.
+	Nodes [][]byte
+	// Refs holds, for each entry in Indices, the positions in Nodes of the
+	// hashes which make up that leaf's inclusion proof.
+	Refs [][]int
+}
+
+// Proof returns the inclusion proof for the i'th leaf in the batch.
+func (b *BatchInclusionProof) Proof(i int) ([][]byte, error) {
+	if i < 0 || i >= len(b.Refs) {
+		return nil, fmt.Errorf("proof %d out of range (batch has %d)", i, len(b.Refs))
+	}
+	p := make([][]byte, 0, len(b.Refs[i]))
+	for _, r := range b.Refs[i] {
+		if r < 0 || r >= len(b.Nodes) {
+			return nil, fmt.Errorf("proof %d refers to unknown node %d", i, r)
+		}
+		p = append(p, b.Nodes[r])
+	}
+	return p, nil
+}
+
+// Verify checks that each of the proofs in the batch proves inclusion of the
+// corresponding leaf hash in the tree with the given root hash.
+func (b *BatchInclusionProof) Verify(h merkle.LogHasher, root []byte, leafHashes [][]byte) error {
+	if len(leafHashes) != len(b.Indices) || len(b.Refs) != len(b.Indices) {
+		return fmt.Errorf("batch has %d indices and %d proofs, but got %d leaf hashes", len(b.Indices), len(b.Refs), len(leafHashes))
+	}
+	for i, idx := range b.Indices {
+		p, err := b.Proof(i)
+		if err != nil {
+			return err
+		}
+		if err := proof.VerifyInclusion(h, idx, b.Size, leafHashes[i], p, root); err != nil {
+			return fmt.Errorf("failed to verify inclusion of leaf %d: %w", idx, err)
+		}
+	}
+	return nil
+}
+
+// MarshalText implements encoding/TextMarshaler.
+//
+// The format is the tree size, followed by the number of distinct nodes, then
+// the base64 encoded nodes, each on their own line. Finally, there is a line
+// for each leaf containing its index followed by its proof's node positions,
+// separated by spaces. All numbers are in decimal.
+func (b *BatchInclusionProof) MarshalText() ([]byte, error) {
+	if len(b.Refs) != len(b.Indices) {
+		return nil, fmt.Errorf("batch has %d indices but %d proofs", len(b.Indices), len(b.Refs))
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%d\n%d\n", b.Size, len(b.Nodes))
+	for _, n := range b.Nodes {
+		fmt.Fprintf(buf, "%s\n", base64.StdEncoding.EncodeToString(n))
+	}
+	for i, idx := range b.Indices {
+		buf.WriteString(strconv.FormatUint(idx, 10))
+		for _, r := range b.Refs[i] {
+			fmt.Fprintf(buf, " %d", r)
+		}
+		buf.WriteRune('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText implements encoding/TextUnmarshaler.
+func (b *BatchInclusionProof) UnmarshalText(raw []byte) error {
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	if len(lines) < 2 {
+		return fmt.Errorf("invalid batch proof: %d lines, want at least 2", len(lines))
+	}
+	size, err := strconv.ParseUint(lines[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid tree size %q: %w", lines[0], err)
+	}
+	numNodes, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid node count %q: %w", lines[1], err)
+	}
+	if numNodes > uint64(len(lines)-2) {
+		return fmt.Errorf("invalid batch proof: %d nodes, but only %d lines", numNodes, len(lines)-2)
+	}
+	nodes := make([][]byte, 0, numNodes)
+	for _, l := range lines[2 : 2+numNodes] {
+		n, err := base64.StdEncoding.DecodeString(l)
+		if err != nil {
+			return fmt.Errorf("invalid node %q: %w", l, err)
+		}
+		nodes = append(nodes, n)
+	}
+	var indices []uint64
+	var refs [][]int
+	for _, l := range lines[2+numNodes:] {
+		f := strings.Fields(l)
+		if len(f) == 0 {
+			return fmt.Errorf("invalid empty proof line")
+		}
+		idx, err := strconv.ParseUint(f[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid leaf index %q: %w", f[0], err)
+		}
+		r := make([]int, 0, len(f)-1)
+		for _, s := range f[1:] {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || n >= len(nodes) {
+				return fmt.Errorf("invalid node position %q for leaf %d", s, idx)
+			}
+			r = append(r, n)
+		}
+		indices = append(indices, idx)
+		refs = append(refs, r)
+	}
+	*b = BatchInclusionProof{Size: size, Indices: indices, Nodes: nodes, Refs: refs}
+	return nil
+}
+
+// BatchInclusionProof constructs inclusion proofs for the leaves at each of
+// the given indices.
+// The tiles needed by all of the proofs are fetched together, so each is read
+// only once.
+func (pb *ProofBuilder) BatchInclusionProof(ctx context.Context, indices []uint64) (*BatchInclusionProof, error) {
+	allNodes := make([]proof.Nodes, 0, len(indices))
+	allIDs := []compact.NodeID{}
+	for _, idx := range indices {
+		nodes, err := proof.Inclusion(idx, pb.cp.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate inclusion proof node list for %d: %w", idx, err)
+		}
+		allNodes = append(allNodes, nodes)
+		allIDs = append(allIDs, nodes.IDs...)
+	}
+	if err := pb.nodeCache.Prefetch(ctx, allIDs); err != nil {
+		return nil, err
+	}
+
+	ret := &BatchInclusionProof{
+		Size:    pb.cp.Size,
+		Indices: append([]uint64(nil), indices...),
+		Refs:    make([][]int, 0, len(indices)),
+	}
+	pos := make(map[string]int)
+	for _, nodes := range allNodes {
+		hashes, err := pb.fetchNodes(ctx, nodes)
+		if err != nil {
+			return nil, err
+		}
+		r := make([]int, 0, len(hashes))
+		for _, h := range hashes {
+			p, ok := pos[string(h)]
+			if !ok {
+				p = len(ret.Nodes)
+				pos[string(h)] = p
+				ret.Nodes = append(ret.Nodes, h)
+			}
+			r = append(r, p)
+		}
+		ret.Refs = append(ret.Refs, r)
+	}
+	return ret, nil
+}
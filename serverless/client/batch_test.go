@@ -0,0 +1,137 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestBatchInclusionProof(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	fetches := 0
+	f := func(_ context.Context, p string) ([]byte, error) {
+		fetches++
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	cp := testCheckpoints[len(testCheckpoints)-1]
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, f)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+
+	indices := []uint64{0, 3, 5, 14, 3}
+	leafHashes := make([][]byte, 0, len(indices))
+	for _, idx := range indices {
+		l, err := os.ReadFile(fmt.Sprintf("../testdata/log/seq/00/00/00/00/%02x", idx))
+		if err != nil {
+			t.Fatalf("Failed to read leaf %d: %v", idx, err)
+		}
+		leafHashes = append(leafHashes, h.HashLeaf(l))
+	}
+
+	fetches = 0
+	b, err := pb.BatchInclusionProof(ctx, indices)
+	if err != nil {
+		t.Fatalf("BatchInclusionProof: %v", err)
+	}
+	// The log's only tile is on the right edge of the tree, which the builder
+	// read when it was created.
+	if fetches != 0 {
+		t.Errorf("Batch needed %d fetches, want none", fetches)
+	}
+	if err := b.Verify(h, cp.Hash, leafHashes); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	total := 0
+	for i, idx := range indices {
+		want, err := pb.InclusionProof(ctx, idx)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d): %v", idx, err)
+		}
+		got, err := b.Proof(i)
+		if err != nil {
+			t.Fatalf("Proof(%d): %v", i, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Proof(%d) diff: %s", i, diff)
+		}
+		total += len(want)
+	}
+	if len(b.Nodes) >= total {
+		t.Errorf("Batch has %d nodes, want fewer than the %d in the individual proofs", len(b.Nodes), total)
+	}
+
+	// Proofs must not verify against the wrong leaves.
+	leafHashes[0], leafHashes[1] = leafHashes[1], leafHashes[0]
+	if err := b.Verify(h, cp.Hash, leafHashes); err == nil {
+		t.Error("Verify with swapped leaf hashes succeeded, want error")
+	}
+
+	raw, err := b.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText: %v", err)
+	}
+	b2 := &BatchInclusionProof{}
+	if err := b2.UnmarshalText(raw); err != nil {
+		t.Fatalf("UnmarshalText: %v", err)
+	}
+	if diff := cmp.Diff(b, b2); diff != "" {
+		t.Errorf("Roundtripped batch has diff: %s", diff)
+	}
+}
+
+func TestBatchInclusionProofUnmarshalText(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			raw:  "3\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n0 0\n2\n",
+		}, {
+			desc:    "empty",
+			raw:     "",
+			wantErr: true,
+		}, {
+			desc:    "too few nodes",
+			raw:     "3\n2\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n",
+			wantErr: true,
+		}, {
+			desc:    "bad node position",
+			raw:     "3\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n0 1\n",
+			wantErr: true,
+		}, {
+			desc:    "bad index",
+			raw:     "3\n0\n-1\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := (&BatchInclusionProof{}).UnmarshalText([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("UnmarshalText: got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
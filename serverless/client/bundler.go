@@ -0,0 +1,281 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/proof"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// BundlerOpts configures a Bundler.
+type BundlerOpts struct {
+	// RefreshInterval is how often the log's checkpoint is checked for
+	// updates. Defaults to one minute.
+	RefreshInterval time.Duration
+	// Consensus is used to fetch the log's checkpoint. Defaults to
+	// UnilateralConsensus of the Bundler's Fetcher.
+	Consensus ConsensusCheckpointFunc
+	// MaxArtifacts is the number of bundles cached. Defaults to 1024.
+	MaxArtifacts int
+}
+
+// Bundler provides proof bundles for artifacts in a log, for update servers
+// to serve alongside them, e.g. in their update metadata, so that clients
+// can verify that an update is in the log without contacting it.
+//
+// Bundles are cached, and are rebuilt against the latest checkpoint when the
+// log grows, which is checked for at most every RefreshInterval. Every new
+// checkpoint is checked to be consistent with the previous one, so all
+// bundles served are for a single consistent view of the log.
+//
+// A Bundler is safe for concurrent use.
+type Bundler struct {
+	f        Fetcher
+	h        merkle.LogHasher
+	interval time.Duration
+	max      int
+
+	mu        sync.Mutex
+	lst       LogStateTracker
+	refreshed time.Time
+	pb        *ProofBuilder
+	bundles   map[string]cachedBundle
+}
+
+// cachedBundle is a bundle built for the entry at index under the checkpoint
+// of the given size.
+type cachedBundle struct {
+	index uint64
+	size  uint64
+	raw   []byte
+}
+
+// NewBundler returns a Bundler for the log accessed via f, whose checkpoints
+// are signed by v with the given origin. It fetches the log's current
+// checkpoint.
+func NewBundler(ctx context.Context, f Fetcher, h merkle.LogHasher, v note.Verifier, origin string, opts BundlerOpts) (*Bundler, error) {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Minute
+	}
+	if opts.Consensus == nil {
+		opts.Consensus = UnilateralConsensus(f)
+	}
+	if opts.MaxArtifacts <= 0 {
+		opts.MaxArtifacts = 1024
+	}
+	lst, err := NewLogStateTracker(ctx, f, h, nil, v, origin, opts.Consensus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	return &Bundler{
+		f:         f,
+		h:         h,
+		interval:  opts.RefreshInterval,
+		max:       opts.MaxArtifacts,
+		lst:       lst,
+		refreshed: time.Now(),
+		bundles:   make(map[string]cachedBundle),
+	}, nil
+}
+
+// Checkpoint returns the raw checkpoint which bundles are currently built
+// for.
+func (b *Bundler) Checkpoint() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lst.LatestConsistentRaw
+}
+
+// Bundle returns the JSON form of the api.ProofBundle for the artifact,
+// whose leaf hash is that of its contents. If it's been sequenced but isn't
+// yet covered by the checkpoint, an error wrapping ErrNotIntegrated is
+// returned.
+func (b *Bundler) Bundle(ctx context.Context, artifact []byte) ([]byte, error) {
+	return b.BundleByHash(ctx, b.h.HashLeaf(artifact))
+}
+
+// BundleByHash is as for Bundle, but takes the artifact's leaf hash.
+func (b *Bundler) BundleByHash(ctx context.Context, lh []byte) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(b.refreshed) >= b.interval {
+		if err := b.refresh(ctx); err != nil {
+			// Bundles for the current checkpoint are still valid, so keep
+			// serving them rather than failing the update server.
+			glog.Warningf("Failed to refresh checkpoint, continuing with size %d: %v", b.lst.LatestConsistent.Size, err)
+		}
+	}
+	return b.bundle(ctx, lh)
+}
+
+// Attach returns the JSON object metadata with the proof bundle for the
+// artifact added to it under key, replacing any existing value. metadata may
+// be empty, in which case a new object is returned.
+func (b *Bundler) Attach(ctx context.Context, metadata []byte, key string, artifact []byte) ([]byte, error) {
+	m := map[string]json.RawMessage{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &m); err != nil {
+			return nil, fmt.Errorf("metadata isn't a JSON object: %w", err)
+		}
+	}
+	raw, err := b.Bundle(ctx, artifact)
+	if err != nil {
+		return nil, err
+	}
+	m[key] = raw
+	return json.Marshal(m)
+}
+
+// OpenProofBundle parses the JSON form of the api.ProofBundle raw, and
+// verifies that its checkpoint is signed by v for the log with the given
+// origin, and that its proof shows the inclusion of its leaf hash under the
+// checkpoint. Returns the bundle and its checkpoint.
+func OpenProofBundle(raw []byte, h merkle.LogHasher, v note.Verifier, origin string) (*api.ProofBundle, *log.Checkpoint, error) {
+	b, err := api.ParseProofBundle(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	cp, _, _, err := log.ParseCheckpoint([]byte(b.Checkpoint), origin, v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open proof bundle checkpoint: %w", err)
+	}
+	if b.Proof.Size != cp.Size {
+		return nil, nil, fmt.Errorf("proof bundle proof is for size %d, but checkpoint has size %d", b.Proof.Size, cp.Size)
+	}
+	if err := proof.VerifyInclusion(h, b.Proof.Index, cp.Size, b.LeafHash, b.Proof.Hashes, cp.Hash); err != nil {
+		return nil, nil, fmt.Errorf("failed to verify proof bundle inclusion proof: %w", err)
+	}
+	return b, cp, nil
+}
+
+// Refresh fetches the log's latest checkpoint and, if the log has grown,
+// rebuilds the cached bundles for it. If the checkpoint is stale or can't be
+// shown to be consistent with the current one, an error is returned and the
+// current one is kept.
+func (b *Bundler) Refresh(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refresh(ctx)
+}
+
+// Run calls Refresh every RefreshInterval until ctx is done, so that bundles
+// are rebuilt ahead of being requested.
+func (b *Bundler) Run(ctx context.Context) {
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := b.Refresh(ctx); err != nil {
+			glog.Warningf("Failed to refresh checkpoint: %v", err)
+		}
+	}
+}
+
+// refresh is as for Refresh, and must be called with b.mu held.
+func (b *Bundler) refresh(ctx context.Context) error {
+	b.refreshed = time.Now()
+	size := b.lst.LatestConsistent.Size
+	if _, _, _, err := b.lst.Update(ctx); err != nil {
+		return err
+	}
+	if b.lst.LatestConsistent.Size == size {
+		return nil
+	}
+	b.pb = nil
+	for k, c := range b.bundles {
+		if _, err := b.build(ctx, []byte(k), c.index); err != nil {
+			glog.Warningf("Failed to rebuild bundle for leaf %x: %v", k, err)
+			delete(b.bundles, k)
+		}
+	}
+	return nil
+}
+
+// bundle returns the bundle for the leaf hash lh under the current
+// checkpoint, from the cache if possible. It must be called with b.mu held.
+func (b *Bundler) bundle(ctx context.Context, lh []byte) ([]byte, error) {
+	c, ok := b.bundles[string(lh)]
+	if ok && c.size == b.lst.LatestConsistent.Size {
+		return c.raw, nil
+	}
+	index := c.index
+	if !ok {
+		var err error
+		if index, err = LookupIndex(ctx, b.f, lh); err != nil {
+			return nil, fmt.Errorf("failed to look up leaf index: %w", err)
+		}
+	}
+	return b.build(ctx, lh, index)
+}
+
+// build builds and caches the bundle for the entry with leaf hash lh at
+// index under the current checkpoint. It must be called with b.mu held.
+func (b *Bundler) build(ctx context.Context, lh []byte, index uint64) ([]byte, error) {
+	cp := b.lst.LatestConsistent
+	if index >= cp.Size {
+		return nil, fmt.Errorf("leaf index %d outside checkpoint size %d: %w", index, cp.Size, ErrNotIntegrated)
+	}
+	if b.pb == nil {
+		pb, err := NewProofBuilder(ctx, cp, b.h.HashChildren, b.f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create proof builder: %w", err)
+		}
+		b.pb = pb
+	}
+	p, err := b.pb.InclusionProof(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inclusion proof: %w", err)
+	}
+	if err := proof.VerifyInclusion(b.h, index, cp.Size, lh, p, cp.Hash); err != nil {
+		return nil, fmt.Errorf("failed to verify inclusion proof: %w", err)
+	}
+	raw := api.ProofBundle{
+		Checkpoint: string(b.lst.LatestConsistentRaw),
+		LeafHash:   lh,
+		Proof:      api.InclusionProof{Index: index, Size: cp.Size, Hashes: p},
+	}.Marshal()
+	if _, ok := b.bundles[string(lh)]; !ok && len(b.bundles) >= b.max {
+		b.evict()
+	}
+	b.bundles[string(lh)] = cachedBundle{index: index, size: cp.Size, raw: raw}
+	return raw, nil
+}
+
+// evict removes a bundle from the cache, preferring one for an older
+// checkpoint. It must be called with b.mu held.
+func (b *Bundler) evict() {
+	var victim string
+	for k, c := range b.bundles {
+		victim = k
+		if c.size != b.lst.LatestConsistent.Size {
+			break
+		}
+	}
+	delete(b.bundles, victim)
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestBundler(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	v, err := note.NewVerifier("astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b")
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	// The log serves the checkpoint of the given size from its history.
+	size, fetches := 5, 0
+	f := func(_ context.Context, p string) ([]byte, error) {
+		fetches++
+		if p == layout.CheckpointPath {
+			p = fmt.Sprintf("%s.%d", p, size)
+		}
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	leaf := func(i uint64) []byte {
+		l, err := os.ReadFile(fmt.Sprintf("../testdata/log/seq/00/00/00/00/%02x", i))
+		if err != nil {
+			t.Fatalf("Failed to read leaf %d: %v", i, err)
+		}
+		return l
+	}
+	checkBundle := func(raw []byte, index uint64, cp log.Checkpoint) {
+		t.Helper()
+		b, err := api.ParseProofBundle(raw)
+		if err != nil {
+			t.Fatalf("ParseProofBundle: %v", err)
+		}
+		if b.Proof.Index != index || b.Proof.Size != cp.Size {
+			t.Errorf("Bundle has index %d and size %d, want %d and %d", b.Proof.Index, b.Proof.Size, index, cp.Size)
+		}
+		if _, _, _, err := log.ParseCheckpoint([]byte(b.Checkpoint), "Log Checkpoint v0", v); err != nil {
+			t.Errorf("Bundle checkpoint: %v", err)
+		}
+		if err := proof.VerifyInclusion(h, index, cp.Size, b.LeafHash, b.Proof.Hashes, cp.Hash); err != nil {
+			t.Errorf("Bundle proof: %v", err)
+		}
+	}
+
+	b, err := NewBundler(ctx, f, h, v, "Log Checkpoint v0", BundlerOpts{RefreshInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewBundler: %v", err)
+	}
+	raw, err := b.Bundle(ctx, leaf(3))
+	if err != nil {
+		t.Fatalf("Bundle(3): %v", err)
+	}
+	checkBundle(raw, 3, testCheckpoints[4])
+	if _, err := b.Bundle(ctx, leaf(10)); !errors.Is(err, ErrNotIntegrated) {
+		t.Errorf("Bundle(10) = %v, want ErrNotIntegrated", err)
+	}
+
+	// Cached bundles are served until the checkpoint is refreshed, and then
+	// rebuilt for the new one.
+	size = 15
+	fetches = 0
+	again, err := b.Bundle(ctx, leaf(3))
+	if err != nil {
+		t.Fatalf("Bundle(3): %v", err)
+	}
+	if !bytes.Equal(again, raw) || fetches != 0 {
+		t.Errorf("Bundle(3) made %d fetches and changed, want cached bundle", fetches)
+	}
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	fetches = 0
+	raw, err = b.Bundle(ctx, leaf(3))
+	if err != nil {
+		t.Fatalf("Bundle(3): %v", err)
+	}
+	if fetches != 0 {
+		t.Errorf("Bundle(3) made %d fetches after Refresh, want 0", fetches)
+	}
+	checkBundle(raw, 3, testCheckpoints[8])
+	raw, err = b.Bundle(ctx, leaf(10))
+	if err != nil {
+		t.Fatalf("Bundle(10): %v", err)
+	}
+	checkBundle(raw, 10, testCheckpoints[8])
+
+	// A stale checkpoint is rejected, and the current one kept.
+	cpRaw := b.Checkpoint()
+	size = 3
+	if err := b.Refresh(ctx); !errors.Is(err, ErrCheckpointStale) {
+		t.Errorf("Refresh = %v, want ErrCheckpointStale", err)
+	}
+	if !bytes.Equal(b.Checkpoint(), cpRaw) {
+		t.Error("Refresh with stale checkpoint changed checkpoint")
+	}
+
+	ob, ocp, err := OpenProofBundle(raw, h, v, "Log Checkpoint v0")
+	if err != nil {
+		t.Fatalf("OpenProofBundle: %v", err)
+	}
+	if ob.Proof.Index != 10 || ocp.Size != testCheckpoints[8].Size {
+		t.Errorf("OpenProofBundle = index %d of size %d, want 10 of %d", ob.Proof.Index, ocp.Size, testCheckpoints[8].Size)
+	}
+	if _, _, err := OpenProofBundle(raw, h, v, "Other Log"); err == nil {
+		t.Error("OpenProofBundle for other origin succeeded")
+	}
+	tampered, err := api.ParseProofBundle(raw)
+	if err != nil {
+		t.Fatalf("ParseProofBundle: %v", err)
+	}
+	tampered.LeafHash = h.HashLeaf(leaf(9))
+	if _, _, err := OpenProofBundle(tampered.Marshal(), h, v, "Log Checkpoint v0"); err == nil {
+		t.Error("OpenProofBundle of bundle for another leaf succeeded")
+	}
+
+	m, err := b.Attach(ctx, []byte(`{"version":"1.2.3"}`), "proof", leaf(10))
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	var got struct {
+		Version string          `json:"version"`
+		Proof   json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(m, &got); err != nil {
+		t.Fatalf("Attach returned invalid JSON: %v", err)
+	}
+	if got.Version != "1.2.3" {
+		t.Errorf("Attach lost version, got %q", got.Version)
+	}
+	checkBundle(got.Proof, 10, testCheckpoints[8])
+	if _, err := b.Attach(ctx, []byte(`[]`), "proof", leaf(10)); err == nil {
+		t.Error("Attach to non-object succeeded, want error")
+	}
+}
+
+func TestBundlerEviction(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	v, err := note.NewVerifier("astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b")
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	b, err := NewBundler(ctx, f, h, v, "Log Checkpoint v0", BundlerOpts{MaxArtifacts: 2})
+	if err != nil {
+		t.Fatalf("NewBundler: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		l, err := os.ReadFile(fmt.Sprintf("../testdata/log/seq/00/00/00/00/%02x", i))
+		if err != nil {
+			t.Fatalf("Failed to read leaf %d: %v", i, err)
+		}
+		if _, err := b.Bundle(ctx, l); err != nil {
+			t.Fatalf("Bundle(%d): %v", i, err)
+		}
+	}
+	if got := len(b.bundles); got != 2 {
+		t.Errorf("Cached %d bundles, want 2", got)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// ArtifactCache stores the immutable artifacts fetched from a single log, i.e.
+// tiles and leafhash->index mappings, in a local directory, and serves later
+// requests for them from there. It also stores the latest checkpoint the
+// client has verified, as its trusted view of the log.
+//
+// Only artifacts which have been verified are cached: those fetched within a
+// CacheScope are held until the scope is done, and only written to the cache
+// if every proof built from them verified against a trusted checkpoint. A
+// corrupt or misbehaving server, or a cache in between, therefore can't
+// poison the cache. Each cached file includes a SHA256 digest of its contents
+// which is checked when it's loaded; corrupt entries are discarded and
+// fetched again.
+type ArtifactCache struct {
+	f   Fetcher
+	dir string
+}
+
+// NewArtifactCache returns an ArtifactCache of the artifacts fetched via f,
+// stored in the directory dir.
+func NewArtifactCache(f Fetcher, dir string) *ArtifactCache {
+	return &ArtifactCache{f: f, dir: dir}
+}
+
+// scopeKey is the context key of the CacheScope of a fetch.
+type scopeKey struct{}
+
+// CacheScope tracks the artifacts read through an ArtifactCache for one set of
+// proofs, so that they're cached only once the proofs have verified. It's
+// safe for concurrent use.
+type CacheScope struct {
+	c *ArtifactCache
+
+	mu sync.Mutex
+	// fetched holds the artifacts fetched from the log, by path, which
+	// haven't yet been verified.
+	fetched map[string][]byte
+	// cached holds the paths of the artifacts served from the cache.
+	cached map[string]bool
+}
+
+// Scope returns a new CacheScope, and a context carrying it, which should be
+// passed to Fetch for every fetch made while building and verifying a set of
+// proofs. Done must be called with the outcome once they've been verified.
+func (c *ArtifactCache) Scope(ctx context.Context) (context.Context, *CacheScope) {
+	s := &CacheScope{c: c, fetched: make(map[string][]byte), cached: make(map[string]bool)}
+	return context.WithValue(ctx, scopeKey{}, s), s
+}
+
+// Fetch is a Fetcher which serves tiles and leaf indices from the cache, and
+// fetches them via the cache's Fetcher when they're not cached. Requests for
+// any other paths, e.g. the checkpoint, are always passed through.
+//
+// Artifacts fetched with a context returned by Scope are cached when the
+// scope is done, if it succeeded. Those fetched without one are never cached.
+func (c *ArtifactCache) Fetch(ctx context.Context, p string) ([]byte, error) {
+	if err := layout.ValidatePath(p); err != nil {
+		return nil, err
+	}
+	parse := cacheParser(p)
+	if parse == nil {
+		return c.f(ctx, p)
+	}
+	s, _ := ctx.Value(scopeKey{}).(*CacheScope)
+	if s != nil && s.c != c {
+		s = nil
+	}
+	if s != nil {
+		s.mu.Lock()
+		b, ok := s.fetched[p]
+		s.mu.Unlock()
+		if ok {
+			return b, nil
+		}
+	}
+	cp := c.path(p)
+	b, err := readCached(cp)
+	if err == nil {
+		if s != nil {
+			s.mu.Lock()
+			s.cached[p] = true
+			s.mu.Unlock()
+		}
+		return b, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		glog.Warningf("Discarding cached %q: %v", cp, err)
+	}
+
+	b, err = c.f(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := parse(b); err != nil {
+		// Leave it to the caller to report the problem, but don't cache it.
+		return b, nil
+	}
+	if s != nil {
+		s.mu.Lock()
+		s.fetched[p] = b
+		s.mu.Unlock()
+	}
+	return b, nil
+}
+
+// path returns the location in the cache of the artifact at log path p.
+func (c *ArtifactCache) path(p string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(p))
+}
+
+// checkpointPath returns the location in the cache of the checkpoint of the
+// log with the given origin. It's outside the log's layout, so Fetch never
+// serves it.
+func (c *ArtifactCache) checkpointPath(origin string) string {
+	h := sha256.Sum256([]byte(origin))
+	return filepath.Join(c.dir, ".checkpoints", hex.EncodeToString(h[:]))
+}
+
+// StoreCheckpoint caches raw as the latest trusted checkpoint of the log with
+// the given origin. It must only be given checkpoints which have been
+// verified, e.g. by a LogStateTracker.
+func (c *ArtifactCache) StoreCheckpoint(origin string, raw []byte) error {
+	return writeCached(c.checkpointPath(origin), raw)
+}
+
+// LoadCheckpoint returns the checkpoint cached by StoreCheckpoint for the log
+// with the given origin, after checking its digest, and that it's a
+// checkpoint for origin signed by v. If no checkpoint is cached, the error
+// wraps os.ErrNotExist.
+//
+// Unlike other artifacts, a cached checkpoint which fails these checks isn't
+// evicted, since it's the client's only record of the log state it trusts,
+// and fetching a new one in its place would lose that.
+func (c *ArtifactCache) LoadCheckpoint(origin string, v note.Verifier) ([]byte, error) {
+	raw, err := os.ReadFile(c.checkpointPath(origin))
+	if err != nil {
+		return nil, err
+	}
+	b, err := checkCachedDigest(raw)
+	if err != nil {
+		return nil, fmt.Errorf("cached checkpoint: %w", err)
+	}
+	if _, _, _, err := log.ParseCheckpoint(b, origin, v); err != nil {
+		return nil, fmt.Errorf("cached checkpoint failed to verify: %w", err)
+	}
+	return b, nil
+}
+
+// Done ends the scope, given the outcome of verifying the proofs built from
+// the artifacts read through it. If err is nil, the artifacts fetched from
+// the log are written to the cache. If err shows that a proof failed to
+// verify, the artifacts which were served from the cache are evicted from it,
+// since they may be why, so that they're fetched again next time. Otherwise
+// nothing is cached, but the cache is left as it is, e.g. so that it can
+// still be used offline after a network failure.
+func (s *CacheScope) Done(err error) {
+	s.mu.Lock()
+	fetched, cached := s.fetched, s.cached
+	s.fetched, s.cached = make(map[string][]byte), make(map[string]bool)
+	s.mu.Unlock()
+
+	switch {
+	case err == nil:
+		for p, b := range fetched {
+			if err := writeCached(s.c.path(p), b); err != nil {
+				glog.Warningf("Failed to cache %q: %v", p, err)
+			}
+		}
+	case verificationFailed(err):
+		for p := range cached {
+			if err := os.Remove(s.c.path(p)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				glog.Warningf("Failed to evict %q from cache: %v", p, err)
+			}
+		}
+	}
+}
+
+// verificationFailed returns true if err shows that data fetched from a log
+// failed to verify against a checkpoint.
+func verificationFailed(err error) bool {
+	var rm proof.RootMismatchError
+	return errors.Is(err, ErrInconsistentTree) || errors.As(err, &rm)
+}
+
+// cacheParser returns a function which validates the contents of the artifact
+// at log path p, or nil if p is not an immutable artifact.
+func cacheParser(p string) func([]byte) error {
+	switch {
+	case strings.HasPrefix(p, "tile/"):
+		return func(b []byte) error {
+			_, err := api.ParseTile(b)
+			return err
+		}
+	case strings.HasPrefix(p, "leaves/"):
+		return func(b []byte) error {
+			_, err := api.ParseLeafIndex(b)
+			return err
+		}
+	}
+	return nil
+}
+
+// readCached reads the cached file at p, checking and stripping the digest
+// prefix written by writeCached.
+func readCached(p string) ([]byte, error) {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	b, err := checkCachedDigest(raw)
+	if err != nil {
+		os.Remove(p)
+		return nil, err
+	}
+	return b, nil
+}
+
+// checkCachedDigest checks and strips the digest prefix of a cached file.
+func checkCachedDigest(raw []byte) ([]byte, error) {
+	if len(raw) < sha256.Size {
+		return nil, fmt.Errorf("truncated cache entry (%d bytes)", len(raw))
+	}
+	digest, b := raw[:sha256.Size], raw[sha256.Size:]
+	if h := sha256.Sum256(b); !bytes.Equal(digest, h[:]) {
+		return nil, errors.New("cache entry digest mismatch")
+	}
+	return b, nil
+}
+
+// writeCached atomically writes b, prefixed with its SHA256 digest, to the
+// file at p.
+func writeCached(p string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	h := sha256.Sum256(b)
+	return writeAtomic(p, append(h[:], b...))
+}
+
+// writeAtomic writes b to the file at p, by renaming a temporary file into
+// place, so that readers never see it partially written.
+func writeAtomic(p string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
@@ -0,0 +1,221 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestArtifactCache(t *testing.T) {
+	const (
+		tilePath = "tile/00/0000/00/00/00.01"
+		tile     = "32\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n"
+		leafPath = "leaves/00/01/02/03"
+		badPath  = "tile/00/0000/00/00/00.02"
+	)
+	offline := false
+	calls := make(map[string]int)
+	f := func(_ context.Context, p string) ([]byte, error) {
+		calls[p]++
+		if offline {
+			return nil, errors.New("offline")
+		}
+		switch p {
+		case tilePath:
+			return []byte(tile), nil
+		case leafPath:
+			return []byte("1a"), nil
+		case badPath:
+			return []byte("not a tile"), nil
+		case "checkpoint":
+			return []byte("checkpoint"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	dir := t.TempDir()
+	c := NewArtifactCache(f, dir)
+	fetchAll := func(ctx context.Context) {
+		t.Helper()
+		for _, p := range []string{tilePath, leafPath, badPath, "checkpoint"} {
+			if _, err := c.Fetch(ctx, p); err != nil {
+				t.Fatalf("Fetch(%q): %v", p, err)
+			}
+		}
+	}
+	wantCalls := func(want map[string]int) {
+		t.Helper()
+		for p, w := range want {
+			if got := calls[p]; got != w {
+				t.Errorf("Fetched %q %d times, want %d", p, got, w)
+			}
+		}
+	}
+
+	// Nothing is cached without a scope, or until a scope succeeds.
+	fetchAll(context.Background())
+	ctx, s := c.Scope(context.Background())
+	fetchAll(ctx)
+	fetchAll(ctx)
+	wantCalls(map[string]int{tilePath: 2, leafPath: 2, badPath: 3, "checkpoint": 3})
+	s.Done(errors.New("network failure"))
+	fetchAll(context.Background())
+	wantCalls(map[string]int{tilePath: 3, leafPath: 3})
+
+	// Once a scope succeeds, the valid artifacts it fetched are cached.
+	ctx, s = c.Scope(context.Background())
+	fetchAll(ctx)
+	s.Done(nil)
+	fetchAll(context.Background())
+	wantCalls(map[string]int{tilePath: 4, leafPath: 4, badPath: 6, "checkpoint": 6})
+	if _, err := c.Fetch(context.Background(), "tile/00/0000/00/00/01"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Got err %v, want os.ErrNotExist", err)
+	}
+
+	// Cached artifacts should be available offline.
+	offline = true
+	if got, err := c.Fetch(context.Background(), tilePath); err != nil || string(got) != tile {
+		t.Errorf("Fetch offline: got %q, %v, want %q", got, err, tile)
+	}
+
+	// Corrupt entries should be discarded and refetched.
+	cp := filepath.Join(dir, filepath.FromSlash(tilePath))
+	raw, err := os.ReadFile(cp)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	raw[len(raw)-2] ^= 1
+	if err := os.WriteFile(cp, raw, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := c.Fetch(context.Background(), tilePath); err == nil {
+		t.Error("Fetch of corrupt entry while offline succeeded, want error")
+	}
+	offline = false
+	ctx, s = c.Scope(context.Background())
+	if got, err := c.Fetch(ctx, tilePath); err != nil || string(got) != tile {
+		t.Errorf("Refetch: got %q, %v, want %q", got, err, tile)
+	}
+	s.Done(nil)
+	wantCalls(map[string]int{tilePath: 6})
+
+	// Entries used by a proof which fails to verify are evicted, while others
+	// are kept.
+	ctx, s = c.Scope(context.Background())
+	if _, err := c.Fetch(ctx, leafPath); err != nil {
+		t.Fatalf("Fetch(%q): %v", leafPath, err)
+	}
+	s.Done(fmt.Errorf("failed to verify inclusion: %w", ErrInconsistentTree))
+	lp := filepath.Join(dir, filepath.FromSlash(leafPath))
+	if _, err := os.Stat(lp); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(%q) after failed verification: %v, want os.ErrNotExist", lp, err)
+	}
+	if _, err := os.Stat(cp); err != nil {
+		t.Errorf("Stat(%q): %v", cp, err)
+	}
+	ctx, s = c.Scope(context.Background())
+	if _, err := c.Fetch(ctx, tilePath); err != nil {
+		t.Fatalf("Fetch(%q): %v", tilePath, err)
+	}
+	s.Done(proof.RootMismatchError{})
+	if _, err := os.Stat(cp); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(%q) after root mismatch: %v, want os.ErrNotExist", cp, err)
+	}
+
+	if _, err := c.Fetch(context.Background(), "../checkpoint"); err == nil {
+		t.Error("Fetch of invalid path succeeded, want error")
+	}
+}
+
+func TestArtifactCacheCheckpoint(t *testing.T) {
+	const origin = "example.com/log"
+	sk, vk, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(sk)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vk)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	cp := log.Checkpoint{Origin: origin, Size: 10, Hash: make([]byte, 32)}
+	raw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	c := NewArtifactCache(nil, t.TempDir())
+	if _, err := c.LoadCheckpoint(origin, v); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadCheckpoint before storing: %v, want ErrNotExist", err)
+	}
+	if err := c.StoreCheckpoint(origin, raw); err != nil {
+		t.Fatalf("StoreCheckpoint: %v", err)
+	}
+	got, err := c.LoadCheckpoint(origin, v)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Errorf("LoadCheckpoint got %q, want %q", got, raw)
+	}
+	// Checkpoints are keyed by origin.
+	if _, err := c.LoadCheckpoint("example.com/other", v); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadCheckpoint of other origin: %v, want ErrNotExist", err)
+	}
+
+	// Tamper with the size of the cached checkpoint.
+	tampered := bytes.Replace(raw, []byte("\n10\n"), []byte("\n11\n"), 1)
+	p := c.checkpointPath(origin)
+	for _, test := range []struct {
+		desc   string
+		cached []byte
+		// redigest recomputes the digest of the tampered contents.
+		redigest bool
+	}{
+		{desc: "digest mismatch", cached: append(append([]byte{}, make([]byte, 32)...), tampered...)},
+		{desc: "bad signature", cached: tampered, redigest: true},
+		{desc: "truncated", cached: []byte("short")},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			write := func(p string, b []byte) error { return os.WriteFile(p, b, 0o600) }
+			if test.redigest {
+				write = writeCached
+			}
+			if err := write(p, test.cached); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if _, err := c.LoadCheckpoint(origin, v); err == nil || errors.Is(err, os.ErrNotExist) {
+				t.Errorf("LoadCheckpoint of tampered checkpoint: %v, want verification error", err)
+			}
+			// The trusted state must not silently be reset.
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("Tampered checkpoint was evicted: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Channel is somewhere other than the log itself which publishes the log's
+// latest checkpoint, such as a DNS TXT record. Since each channel is
+// controlled separately from the log, comparing what they publish with the
+// log's checkpoint makes it harder for the log to present a split view.
+type Channel interface {
+	// Name identifies the channel.
+	Name() string
+	// Digest returns the digest of the checkpoint the channel publishes.
+	Digest(ctx context.Context) (*api.CheckpointDigest, error)
+}
+
+// DNSChannel is a DNS TXT record holding the digest of the log's checkpoint.
+type DNSChannel struct {
+	// Domain is the name of the TXT record.
+	Domain string
+	// Resolver looks up the record, or net.DefaultResolver if nil.
+	Resolver *net.Resolver
+}
+
+// Name returns the name of the TXT record.
+func (d DNSChannel) Name() string {
+	return "dns:" + d.Domain
+}
+
+// Digest looks up the TXT record. Other TXT records with the same name are
+// ignored, but more than one checkpoint digest is an error.
+func (d DNSChannel) Digest(ctx context.Context) (*api.CheckpointDigest, error) {
+	r := d.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	txts, err := r.LookupTXT(ctx, d.Domain)
+	if err != nil {
+		return nil, err
+	}
+	var digest *api.CheckpointDigest
+	for _, txt := range txts {
+		dg, err := api.ParseCheckpointDigest(txt)
+		if err != nil {
+			continue
+		}
+		if digest != nil {
+			return nil, fmt.Errorf("%s has more than one checkpoint digest", d.Domain)
+		}
+		digest = dg
+	}
+	if digest == nil {
+		return nil, fmt.Errorf("%s has no checkpoint digest", d.Domain)
+	}
+	return digest, nil
+}
+
+// WellKnownChannel is a copy of the log's signed checkpoint served at a URL,
+// conventionally https://<domain>/.well-known/serverless-checkpoint.
+type WellKnownChannel struct {
+	URL *url.URL
+	// Client makes the request, or http.DefaultClient if nil.
+	Client *http.Client
+	// Verifier and Origin are those of the log's checkpoints.
+	Verifier note.Verifier
+	Origin   string
+}
+
+// Name returns the URL of the checkpoint.
+func (w WellKnownChannel) Name() string {
+	return w.URL.String()
+}
+
+// Digest fetches and verifies the checkpoint, and returns its digest.
+func (w WellKnownChannel) Digest(ctx context.Context) (*api.CheckpointDigest, error) {
+	c := w.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := readHTTP(ctx, c, w.URL, true, validated{})
+	if err != nil {
+		return nil, err
+	}
+	cp, _, _, err := log.ParseCheckpoint(resp.body, w.Origin, w.Verifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &api.CheckpointDigest{Size: cp.Size, Hash: cp.Hash}, nil
+}
+
+// ChannelResult is the outcome of comparing a channel with the log.
+type ChannelResult struct {
+	Name string
+	// Digest is what the channel published, or nil if it couldn't be
+	// fetched.
+	Digest *api.CheckpointDigest
+	// Err is why the digest couldn't be fetched, or why it's inconsistent
+	// with the log, in which case it wraps ErrInconsistentTree.
+	Err error
+}
+
+// Ahead returns whether the channel published a checkpoint of a larger tree
+// than cp, which therefore couldn't be checked against it.
+func (r ChannelResult) Ahead(cp log.Checkpoint) bool {
+	return r.Digest != nil && r.Digest.Size > cp.Size
+}
+
+// CompareChannels fetches the digest published by each channel, and checks
+// that it's consistent with cp, the client's view of the log, whose tiles are
+// read with f. A digest of a tree larger than cp's can't be checked against
+// it, and the client should update its view, but such digests are still
+// compared with each other. Results are in the order of channels.
+func CompareChannels(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, channels []Channel) []ChannelResult {
+	results := make([]ChannelResult, len(channels))
+	for i, c := range channels {
+		r := &results[i]
+		r.Name = c.Name()
+		if r.Digest, r.Err = c.Digest(ctx); r.Err != nil {
+			continue
+		}
+		if r.Ahead(cp) {
+			for _, o := range results[:i] {
+				if o.Digest != nil && o.Digest.Size == r.Digest.Size && !bytes.Equal(o.Digest.Hash, r.Digest.Hash) {
+					r.Err = fmt.Errorf("tree size %d has hash %x, but %x in %s: %w", r.Digest.Size, r.Digest.Hash, o.Digest.Hash, o.Name, ErrInconsistentTree)
+					break
+				}
+			}
+			continue
+		}
+		dcp := log.Checkpoint{Origin: cp.Origin, Size: r.Digest.Size, Hash: r.Digest.Hash}
+		if err := CheckConsistency(ctx, h, f, []log.Checkpoint{dcp, cp}); err != nil {
+			if !errors.Is(err, ErrInconsistentTree) {
+				err = fmt.Errorf("failed to check consistency: %w", err)
+			}
+			r.Err = err
+		}
+	}
+	return results
+}
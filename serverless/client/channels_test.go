@@ -0,0 +1,149 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// fakeChannel is a Channel publishing a fixed digest.
+type fakeChannel struct {
+	name   string
+	digest *api.CheckpointDigest
+	err    error
+}
+
+func (c fakeChannel) Name() string {
+	return c.name
+}
+
+func (c fakeChannel) Digest(context.Context) (*api.CheckpointDigest, error) {
+	return c.digest, c.err
+}
+
+func TestCompareChannels(t *testing.T) {
+	ctx := context.Background()
+	entries := func(n int, fork bool) [][]byte {
+		r := make([][]byte, n)
+		for i := range r {
+			r[i] = []byte(fmt.Sprintf("entry %d", i))
+		}
+		if fork {
+			r[0] = []byte("fork")
+		}
+		return r
+	}
+	// digest returns a channel publishing the tree of n entries.
+	digest := func(name string, n int, fork bool) Channel {
+		_, cp := buildLogOf(t, "Log", entries(n, fork))
+		return fakeChannel{name: name, digest: &api.CheckpointDigest{Size: cp.Size, Hash: cp.Hash}}
+	}
+	files, cp := buildLogOf(t, "Log", entries(20, false))
+	f := func(_ context.Context, p string) ([]byte, error) {
+		d, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return d, nil
+	}
+
+	for _, test := range []struct {
+		desc      string
+		channels  []Channel
+		wantErr   []bool
+		wantAhead []bool
+	}{
+		{
+			desc:      "consistent",
+			channels:  []Channel{digest("same", 20, false), digest("behind", 10, false)},
+			wantErr:   []bool{false, false},
+			wantAhead: []bool{false, false},
+		}, {
+			desc:      "fork",
+			channels:  []Channel{digest("same", 20, false), digest("forked", 10, true)},
+			wantErr:   []bool{false, true},
+			wantAhead: []bool{false, false},
+		}, {
+			desc:      "ahead",
+			channels:  []Channel{digest("ahead", 30, false), digest("also ahead", 30, false)},
+			wantErr:   []bool{false, false},
+			wantAhead: []bool{true, true},
+		}, {
+			desc:      "ahead and forked",
+			channels:  []Channel{digest("ahead", 30, false), digest("forked", 30, true)},
+			wantErr:   []bool{false, true},
+			wantAhead: []bool{true, true},
+		}, {
+			desc:      "unavailable",
+			channels:  []Channel{fakeChannel{name: "down", err: errors.New("down")}},
+			wantErr:   []bool{true},
+			wantAhead: []bool{false},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			rs := CompareChannels(ctx, f, rfc6962.DefaultHasher, cp, test.channels)
+			if len(rs) != len(test.channels) {
+				t.Fatalf("Got %d results, want %d", len(rs), len(test.channels))
+			}
+			for i, r := range rs {
+				if gotErr := r.Err != nil; gotErr != test.wantErr[i] {
+					t.Errorf("%s: got err %v, want err %t", r.Name, r.Err, test.wantErr[i])
+				}
+				if got := r.Ahead(cp); got != test.wantAhead[i] {
+					t.Errorf("%s: Ahead = %t, want %t", r.Name, got, test.wantAhead[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWellKnownChannel(t *testing.T) {
+	key := newTestKey(t, "log")
+	_, cp := buildLogOf(t, "Log", [][]byte{[]byte("one"), []byte("two")})
+	raw := key.sign(t, string(cp.Marshal()))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/serverless-checkpoint" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(raw)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL + "/.well-known/serverless-checkpoint")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	d, err := WellKnownChannel{URL: u, Verifier: key.v, Origin: "Log"}.Digest(context.Background())
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	if want := (api.CheckpointDigest{Size: cp.Size, Hash: cp.Hash}); d.Marshal() != want.Marshal() {
+		t.Errorf("Digest = %q, want %q", d.Marshal(), want.Marshal())
+	}
+	if _, err := (WellKnownChannel{URL: u, Verifier: newTestKey(t, "other").v, Origin: "Log"}).Digest(context.Background()); err == nil {
+		t.Error("Digest with the wrong key succeeded")
+	}
+}
@@ -23,10 +23,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
 	"sort"
-	"strconv"
+	"sync"
 
 	"github.com/google/trillian-examples/serverless/api"
 	"github.com/google/trillian-examples/serverless/api/layout"
@@ -35,6 +36,8 @@ import (
 	"github.com/transparency-dev/merkle/compact"
 	"github.com/transparency-dev/merkle/proof"
 	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // Fetcher is the signature of a function which can retrieve arbitrary files from
@@ -46,6 +49,20 @@ import (
 // based implementation MUST return this error when it receives a 404 StatusCode.
 type Fetcher func(ctx context.Context, path string) ([]byte, error)
 
+// NewFSFetcher returns a Fetcher which reads the log from fsys, which should be
+// rooted at the root of the log storage.
+//
+// This allows read-only operations to run directly against e.g. an embed.FS,
+// or a zip archive opened with archive/zip, without first extracting it.
+func NewFSFetcher(fsys fs.FS) Fetcher {
+	return func(_ context.Context, p string) ([]byte, error) {
+		if err := layout.ValidatePath(p); err != nil {
+			return nil, err
+		}
+		return fs.ReadFile(fsys, p)
+	}
+}
+
 // ConsensusCheckpointFunc is a function which returns the largest checkpoint known which is
 // signed by logSigV and satisfies some consensus algorithm.
 //
@@ -78,7 +95,7 @@ func FetchCheckpoint(ctx context.Context, f Fetcher, v note.Verifier, origin str
 // more complex as proofs can touch "ephemeral" nodes, so these need to be synthesized.
 type ProofBuilder struct {
 	cp        log.Checkpoint
-	nodeCache nodeCache
+	nodeCache *nodeCache
 	h         compact.HashFn
 }
 
@@ -93,7 +110,10 @@ func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f
 		h:         h,
 	}
 
-	hashes, err := FetchRangeNodes(ctx, cp.Size, tf)
+	// The range nodes are read through the builder's own cache, so that it
+	// keeps the tiles on the right edge of the tree, which most proofs for
+	// recent entries need.
+	hashes, err := fetchRangeNodes(ctx, pb.nodeCache, cp.Size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch range nodes: %w", err)
 	}
@@ -112,17 +132,56 @@ func NewProofBuilder(ctx context.Context, cp log.Checkpoint, h compact.HashFn, f
 		return nil, err
 	}
 	if !bytes.Equal(cp.Hash, sr) {
-		return nil, fmt.Errorf("invalid checkpoint hash %x, expected %x", cp.Hash, sr)
+		return nil, fmt.Errorf("invalid checkpoint hash %x, expected %x: %w", cp.Hash, sr, ErrInconsistentTree)
 	}
 	return pb, nil
 }
 
+// SetFetchConcurrency sets the maximum number of tiles fetched in parallel
+// when building a proof, which defaults to DefaultFetchConcurrency. Raising it
+// speeds up building proofs which need many tiles from a remote log, so long
+// as the Fetcher's connections to it can carry that many requests at once.
+func (pb *ProofBuilder) SetFetchConcurrency(n int) {
+	if n > 0 {
+		pb.nodeCache.concurrency = n
+	}
+}
+
+// Fork returns a ProofBuilder for the same checkpoint as pb which reads tiles
+// with f, starting with those pb has already read, including the tiles on the
+// right edge of the tree. Tiles read by the fork aren't added to pb, so a
+// long-lived ProofBuilder can be forked to build each proof without its cache
+// growing. Forks may be used concurrently with pb and each other.
+func (pb *ProofBuilder) Fork(f Fetcher) *ProofBuilder {
+	nc := newNodeCache(newTileFetcher(f, pb.cp.Size), pb.cp.Size)
+	nc.concurrency = pb.nodeCache.concurrency
+	// Ephemeral nodes are only set while the builder is created, so can be
+	// shared.
+	nc.ephemeral = pb.nodeCache.ephemeral
+	pb.nodeCache.mu.RLock()
+	for k, t := range pb.nodeCache.tiles {
+		nc.tiles[k] = t
+	}
+	pb.nodeCache.mu.RUnlock()
+	return &ProofBuilder{cp: pb.cp, nodeCache: nc, h: pb.h}
+}
+
 // InclusionProof constructs an inclusion proof for the leaf at index in a tree of
 // the given size.
 // This function uses the passed-in function to retrieve tiles containing any log tree
 // nodes necessary to build the proof.
 func (pb *ProofBuilder) InclusionProof(ctx context.Context, index uint64) ([][]byte, error) {
-	nodes, err := proof.Inclusion(index, pb.cp.Size)
+	return pb.InclusionProofAt(ctx, index, pb.cp.Size)
+}
+
+// InclusionProofAt constructs an inclusion proof for the leaf at index in the
+// tree of the given size, which must be no larger than the size of the
+// checkpoint the ProofBuilder was created for.
+func (pb *ProofBuilder) InclusionProofAt(ctx context.Context, index, size uint64) ([][]byte, error) {
+	if size > pb.cp.Size {
+		return nil, fmt.Errorf("tree size %d is larger than checkpoint size %d", size, pb.cp.Size)
+	}
+	nodes, err := proof.Inclusion(index, size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate inclusion proof node list: %w", err)
 	}
@@ -142,8 +201,10 @@ func (pb *ProofBuilder) ConsistencyProof(ctx context.Context, smaller, larger ui
 
 // fetchNodes retrieves the specified proof nodes via pb's nodeCache.
 func (pb *ProofBuilder) fetchNodes(ctx context.Context, nodes proof.Nodes) ([][]byte, error) {
+	if err := pb.nodeCache.Prefetch(ctx, nodes.IDs); err != nil {
+		return nil, err
+	}
 	hashes := make([][]byte, 0)
-	// TODO(al) parallelise this.
 	for _, id := range nodes.IDs {
 		h, err := pb.nodeCache.GetNode(ctx, id)
 		if err != nil {
@@ -161,8 +222,16 @@ func (pb *ProofBuilder) fetchNodes(ctx context.Context, nodes proof.Nodes) ([][]
 // FetchRangeNodes returns the set of nodes representing the compact range covering
 // a log of size s.
 func FetchRangeNodes(ctx context.Context, s uint64, gt GetTileFunc) ([][]byte, error) {
-	nc := newNodeCache(gt, s)
+	return fetchRangeNodes(ctx, newNodeCache(gt, s), s)
+}
+
+// fetchRangeNodes returns the set of nodes representing the compact range
+// covering a log of size s, read through nc.
+func fetchRangeNodes(ctx context.Context, nc *nodeCache, s uint64) ([][]byte, error) {
 	nIDs := compact.RangeNodes(0, s, nil)
+	if err := nc.Prefetch(ctx, nIDs); err != nil {
+		return nil, err
+	}
 	ret := make([][]byte, len(nIDs))
 	for i, n := range nIDs {
 		h, err := nc.GetNode(ctx, n)
@@ -177,6 +246,14 @@ func FetchRangeNodes(ctx context.Context, s uint64, gt GetTileFunc) ([][]byte, e
 // FetchLeafHashes fetches N consecutive leaf hashes starting with the leaf at index first.
 func FetchLeafHashes(ctx context.Context, f Fetcher, first, N, logSize uint64) ([][]byte, error) {
 	nc := newNodeCache(newTileFetcher(f, logSize), logSize)
+	// Only the first leaf of each tile is needed to prefetch all of the tiles.
+	ids := make([]compact.NodeID, 0, N/api.TileWidth+2)
+	for seq := first; seq < first+N; seq = (seq/api.TileWidth + 1) * api.TileWidth {
+		ids = append(ids, compact.NodeID{Level: 0, Index: seq})
+	}
+	if err := nc.Prefetch(ctx, ids); err != nil {
+		return nil, fmt.Errorf("failed to fetch tiles: %v", err)
+	}
 	ret := make([][]byte, 0, N)
 	for i, seq := uint64(0), first; i < N; i, seq = i+1, seq+1 {
 		nID := compact.NodeID{Level: 0, Index: seq}
@@ -189,15 +266,28 @@ func FetchLeafHashes(ctx context.Context, f Fetcher, first, N, logSize uint64) (
 	return ret, nil
 }
 
+// DefaultFetchConcurrency is the maximum number of tiles which will be
+// fetched in parallel when prefetching the tiles needed to build a proof,
+// unless set otherwise with ProofBuilder.SetFetchConcurrency.
+const DefaultFetchConcurrency = 8
+
 // nodeCache hides the tiles abstraction away, and improves
 // performance by caching tiles it's seen.
-// Not threadsafe, and intended to be only used throughout the course
-// of a single request.
+// Intended to be only used throughout the course of a single request.
+// Concurrent calls to GetNode and Prefetch are safe, but SetEphemeralNode
+// must not be called concurrently with any other method.
 type nodeCache struct {
-	logSize   uint64
-	ephemeral map[compact.NodeID][]byte
-	tiles     map[tileKey]api.Tile
-	getTile   GetTileFunc
+	logSize uint64
+	// concurrency is the number of tiles Prefetch fetches at once.
+	concurrency int
+	ephemeral   map[compact.NodeID][]byte
+	getTile     GetTileFunc
+
+	// mu guards tiles.
+	mu    sync.RWMutex
+	tiles map[tileKey]api.Tile
+	// inflight deduplicates concurrent fetches of the same tile.
+	inflight singleflight.Group
 }
 
 // GetTileFunc is the signature of a function which knows how to fetch a
@@ -211,12 +301,13 @@ type tileKey struct {
 }
 
 // newNodeCache creates a new nodeCache instance for a given log size.
-func newNodeCache(f GetTileFunc, logSize uint64) nodeCache {
-	return nodeCache{
-		logSize:   logSize,
-		ephemeral: make(map[compact.NodeID][]byte),
-		tiles:     make(map[tileKey]api.Tile),
-		getTile:   f,
+func newNodeCache(f GetTileFunc, logSize uint64) *nodeCache {
+	return &nodeCache{
+		logSize:     logSize,
+		concurrency: DefaultFetchConcurrency,
+		ephemeral:   make(map[compact.NodeID][]byte),
+		tiles:       make(map[tileKey]api.Tile),
+		getTile:     f,
 	}
 }
 
@@ -225,6 +316,56 @@ func (n *nodeCache) SetEphemeralNode(id compact.NodeID, h []byte) {
 	n.ephemeral[id] = h
 }
 
+// Prefetch concurrently fetches and caches any tiles needed to serve the
+// specified node IDs which aren't already cached, using a bounded number of
+// workers. Each distinct tile will be fetched at most once.
+func (n *nodeCache) Prefetch(ctx context.Context, ids []compact.NodeID) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(n.concurrency)
+	seen := make(map[tileKey]bool)
+	for _, id := range ids {
+		if e := n.ephemeral[id]; len(e) != 0 {
+			continue
+		}
+		tileLevel, tileIndex, _, _ := layout.NodeCoordsToTileAddress(uint64(id.Level), uint64(id.Index))
+		tKey := tileKey{tileLevel, tileIndex}
+		if seen[tKey] {
+			continue
+		}
+		seen[tKey] = true
+		eg.Go(func() error {
+			_, err := n.tile(ctx, tKey)
+			return err
+		})
+	}
+	return eg.Wait()
+}
+
+// tile returns the tile with the given key, fetching and caching it if
+// it's not already present in the cache.
+func (n *nodeCache) tile(ctx context.Context, tKey tileKey) (api.Tile, error) {
+	n.mu.RLock()
+	t, ok := n.tiles[tKey]
+	n.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+	r, err, _ := n.inflight.Do(fmt.Sprintf("%d/%d", tKey.tileLevel, tKey.tileIndex), func() (interface{}, error) {
+		tile, err := n.getTile(ctx, tKey.tileLevel, tKey.tileIndex)
+		if err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		n.tiles[tKey] = *tile
+		n.mu.Unlock()
+		return *tile, nil
+	})
+	if err != nil {
+		return api.Tile{}, fmt.Errorf("failed to fetch tile: %w", err)
+	}
+	return r.(api.Tile), nil
+}
+
 // GetNode returns the internal log tree node hash for the specified node ID.
 // A previously set ephemeral node will be returned if id matches, otherwise
 // the tile containing the requested node will be fetched and cached, and the
@@ -236,15 +377,9 @@ func (n *nodeCache) GetNode(ctx context.Context, id compact.NodeID) ([]byte, err
 	}
 	// Otherwise look in fetched tiles:
 	tileLevel, tileIndex, nodeLevel, nodeIndex := layout.NodeCoordsToTileAddress(uint64(id.Level), uint64(id.Index))
-	tKey := tileKey{tileLevel, tileIndex}
-	t, ok := n.tiles[tKey]
-	if !ok {
-		tile, err := n.getTile(ctx, tileLevel, tileIndex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch tile: %w", err)
-		}
-		t = *tile
-		n.tiles[tKey] = *tile
+	t, err := n.tile(ctx, tileKey{tileLevel, tileIndex})
+	if err != nil {
+		return nil, err
 	}
 	nodeKey := int(api.TileNodeKey(nodeLevel, nodeIndex))
 	if l := len(t.Nodes); nodeKey >= l {
@@ -258,30 +393,39 @@ func (n *nodeCache) GetNode(ctx context.Context, id compact.NodeID) ([]byte, err
 }
 
 // newTileFetcher returns a GetTileFunc based on the passed in Fetcher and log size.
+//
+// If a partial tile is required but can't be found, the corresponding full
+// tile will be fetched instead, since the log may have grown and had the
+// partial tile replaced. A full tile contains all of the nodes present in any
+// of its partial tiles.
 func newTileFetcher(f Fetcher, logSize uint64) GetTileFunc {
 	return func(ctx context.Context, level, index uint64) (*api.Tile, error) {
 		tileSize := layout.PartialTileSize(level, index, logSize)
-		p := filepath.Join(layout.TilePath("", level, index, tileSize))
+		p := path.Join(layout.TilePath("", level, index, tileSize))
 		t, err := f(ctx, p)
+		if err != nil && tileSize > 0 && errors.Is(err, os.ErrNotExist) {
+			p = path.Join(layout.TilePath("", level, index, 0))
+			t, err = f(ctx, p)
+		}
 		if err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				return nil, fmt.Errorf("failed to read tile at %q: %w", p, err)
-			}
-			return nil, err
+			return nil, fmt.Errorf("failed to read tile at %q: %w", p, err)
 		}
 
-		var tile api.Tile
-		if err := tile.UnmarshalText(t); err != nil {
+		tile, err := api.ParseTile(t)
+		if err != nil {
 			return nil, fmt.Errorf("failed to parse tile: %w", err)
 		}
-		return &tile, nil
+		return tile, nil
 	}
 }
 
 // LookupIndex fetches the leafhash->seq mapping file from the log, and returns
 // its parsed contents.
 func LookupIndex(ctx context.Context, f Fetcher, lh []byte) (uint64, error) {
-	p := filepath.Join(layout.LeafPath("", lh))
+	if err := layout.ValidateLeafHash(lh); err != nil {
+		return 0, err
+	}
+	p := path.Join(layout.LeafPath("", lh))
 	sRaw, err := f(ctx, p)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -289,20 +433,171 @@ func LookupIndex(ctx context.Context, f Fetcher, lh []byte) (uint64, error) {
 		}
 		return 0, fmt.Errorf("failed to fetch leafhash->seq file: %w", err)
 	}
-	return strconv.ParseUint(string(sRaw), 16, 64)
+	return api.ParseLeafIndex(sRaw)
 }
 
-// GetLeaf fetches the raw contents committed to at a given leaf index.
+// GetLeaf fetches the raw contents committed to at a given leaf index. If the
+// log has withheld the leaf's contents under a redaction, an error wrapping
+// ErrRedacted is returned.
 func GetLeaf(ctx context.Context, f Fetcher, i uint64) ([]byte, error) {
-	p := filepath.Join(layout.SeqPath("", i))
+	l, r, err := getLeaf(ctx, f, i)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return nil, fmt.Errorf("leaf index %d: %w", i, ErrRedacted)
+	}
+	return l, nil
+}
+
+// getLeaf fetches the raw contents committed to at a given leaf index, or if
+// they've been withheld, the unverified redaction record of its tombstone.
+func getLeaf(ctx context.Context, f Fetcher, i uint64) ([]byte, *api.Redaction, error) {
+	p := path.Join(layout.SeqPath("", i))
 	sRaw, err := f(ctx, p)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil, fmt.Errorf("leaf index %d not found: %w", i, err)
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("failed to fetch leaf index %d: %w", i, err)
 		}
-		return nil, fmt.Errorf("failed to fetch leaf index %d: %w", i, err)
+		r, _, tErr := FetchTombstone(ctx, f, i)
+		if tErr == nil {
+			return nil, r, nil
+		} else if !errors.Is(tErr, os.ErrNotExist) {
+			return nil, nil, tErr
+		}
+		return nil, nil, fmt.Errorf("leaf index %d not found: %w", i, err)
+	}
+	return sRaw, nil, nil
+}
+
+// FetchVerifiedLeaves fetches the contents of the leaves in the range
+// [begin, end), and verifies that they are committed to by the checkpoint cp.
+// The contents of leaves which the log has redacted are nil, and are verified
+// by the leaf hash recorded in their tombstone, whose signature isn't checked.
+func FetchVerifiedLeaves(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, begin, end uint64) ([][]byte, error) {
+	if begin > end || end > cp.Size {
+		return nil, fmt.Errorf("invalid range [%d, %d) for checkpoint size %d", begin, end, cp.Size)
+	}
+	if begin == end {
+		return [][]byte{}, nil
+	}
+	// Build a compact range covering [0, end) from the tree nodes to the left of
+	// the requested range, followed by the fetched leaves.
+	hashes, err := FetchRangeNodes(ctx, begin, newTileFetcher(f, cp.Size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch range nodes: %w", err)
+	}
+	r, err := (&compact.RangeFactory{Hash: h.HashChildren}).NewRange(0, begin, hashes)
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([][]byte, 0, end-begin)
+	for i := begin; i < end; i++ {
+		l, red, err := getLeaf(ctx, f, i)
+		if err != nil {
+			return nil, err
+		}
+		lh := h.HashLeaf(l)
+		if red != nil {
+			lh = red.LeafHash
+		}
+		if err := r.Append(lh, nil); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, l)
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		return nil, err
 	}
-	return sRaw, nil
+
+	// Finally, check that the tree of size end is consistent with cp.
+	if end == cp.Size {
+		if !bytes.Equal(root, cp.Hash) {
+			return nil, fmt.Errorf("leaves do not match checkpoint: got root %x, want %x: %w", root, cp.Hash, ErrInconsistentTree)
+		}
+		return leaves, nil
+	}
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create proof builder: %w", err)
+	}
+	p, err := pb.ConsistencyProof(ctx, end, cp.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build consistency proof: %w", err)
+	}
+	if err := proof.VerifyConsistency(h, end, cp.Size, p, root, cp.Hash); err != nil {
+		return nil, fmt.Errorf("leaves do not match checkpoint: %w", err)
+	}
+	return leaves, nil
+}
+
+// ErrNotIntegrated is returned (wrapped) when a leaf has been sequenced, but
+// is not yet committed to by the checkpoint being used to prove its inclusion.
+var ErrNotIntegrated = errors.New("leaf not yet integrated")
+
+// VerifyInclusion builds an inclusion proof for the leaf with hash lh at the
+// given index, and verifies it against the checkpoint cp.
+// Only tiles are fetched from the log, and the verified proof is returned.
+func VerifyInclusion(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, index uint64, lh []byte) ([][]byte, error) {
+	if index >= cp.Size {
+		return nil, fmt.Errorf("leaf index %d outside checkpoint size %d: %w", index, cp.Size, ErrNotIntegrated)
+	}
+	builder, err := NewProofBuilder(ctx, cp, h.HashChildren, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create proof builder: %w", err)
+	}
+	p, err := builder.InclusionProof(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inclusion proof: %w", err)
+	}
+	if err := proof.VerifyInclusion(h, index, cp.Size, lh, p, cp.Hash); err != nil {
+		return nil, fmt.Errorf("failed to verify inclusion proof: %w", err)
+	}
+	return p, nil
+}
+
+// VerifyPrecomputedInclusion fetches the inclusion proof for the leaf with
+// hash lh at the given index which was precomputed when cp was published,
+// and verifies it against cp. An error wrapping os.ErrNotExist is returned
+// if the log doesn't precompute proofs, in which case VerifyInclusion may be
+// used instead.
+func VerifyPrecomputedInclusion(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, index uint64, lh []byte) ([][]byte, error) {
+	if index >= cp.Size {
+		return nil, fmt.Errorf("leaf index %d outside checkpoint size %d: %w", index, cp.Size, ErrNotIntegrated)
+	}
+	raw, err := f(ctx, path.Join(layout.InclusionProofPath("", cp.Size, index)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch inclusion proof: %w", err)
+	}
+	p, err := api.ParseInclusionProof(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inclusion proof: %w", err)
+	}
+	if p.Index != index || p.Size != cp.Size {
+		return nil, fmt.Errorf("got inclusion proof for index %d at size %d, want index %d at size %d", p.Index, p.Size, index, cp.Size)
+	}
+	if err := proof.VerifyInclusion(h, index, cp.Size, lh, p.Hashes, cp.Hash); err != nil {
+		return nil, fmt.Errorf("failed to verify inclusion proof: %w", err)
+	}
+	return p.Hashes, nil
+}
+
+// VerifyInclusionByHash proves that a leaf with hash lh is committed to by
+// the checkpoint cp, for clients which know only the leaf hash.
+// The leaf's index is looked up via the log's leafhash->index mapping, and
+// the leaf contents are never fetched.
+// Returns the leaf index and the verified inclusion proof.
+func VerifyInclusionByHash(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, lh []byte) (uint64, [][]byte, error) {
+	index, err := LookupIndex(ctx, f, lh)
+	if err != nil {
+		return 0, nil, err
+	}
+	p, err := VerifyInclusion(ctx, f, h, cp, index, lh)
+	if err != nil {
+		return 0, nil, err
+	}
+	return index, p, nil
 }
 
 // LogStateTracker represents a client-side view of a target log's state.
@@ -371,6 +666,11 @@ func (e ErrInconsistency) Unwrap() error {
 	return e.Wrapped
 }
 
+// Is allows ErrInconsistency to be matched against ErrInconsistentTree.
+func (e ErrInconsistency) Is(target error) bool {
+	return target == ErrInconsistentTree
+}
+
 func (e ErrInconsistency) Error() string {
 	return fmt.Sprintf("log consistency check failed: %s", e.Wrapped)
 }
@@ -382,13 +682,28 @@ func (e ErrInconsistency) Error() string {
 // Returns the old checkpoint, consistency proof, and newer checkpoint used to update.
 // If the LatestConsistent checkpoint is 0 sized, no consistency proof will be returned
 // since it would be meaningless to do so.
+//
+// If the log returns a checkpoint smaller than the local state, an error
+// wrapping ErrCheckpointStale is returned and the tracker is unchanged. If it
+// returns one which can't be proven consistent with the local state, an
+// ErrInconsistency is returned.
 func (lst *LogStateTracker) Update(ctx context.Context) ([]byte, [][]byte, []byte, error) {
 	c, cRaw, cn, err := lst.ConsensusCheckpoint(ctx, lst.CpSigVerifier, lst.Origin)
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if c.Size < lst.LatestConsistent.Size {
+		return nil, nil, nil, fmt.Errorf("log returned checkpoint of size %d, smaller than the known size %d: %w", c.Size, lst.LatestConsistent.Size, ErrCheckpointStale)
+	}
 	var p [][]byte
 	if lst.LatestConsistent.Size > 0 {
+		if c.Size == lst.LatestConsistent.Size && !bytes.Equal(c.Hash, lst.LatestConsistent.Hash) {
+			return nil, nil, nil, ErrInconsistency{
+				SmallerRaw: lst.LatestConsistentRaw,
+				LargerRaw:  cRaw,
+				Wrapped:    fmt.Errorf("checkpoints of size %d have different hashes (%x vs %x)", c.Size, lst.LatestConsistent.Hash, c.Hash),
+			}
+		}
 		if c.Size > lst.LatestConsistent.Size {
 			builder, err := NewProofBuilder(ctx, *c, lst.Hasher.HashChildren, lst.Fetcher)
 			if err != nil {
@@ -423,7 +738,7 @@ func CheckConsistency(ctx context.Context, h merkle.LogHasher, f Fetcher, cp []l
 	})
 	pb, err := NewProofBuilder(ctx, cp[len(cp)-1], h.HashChildren, f)
 	if err != nil {
-		return fmt.Errorf("failed to create proofbuilder: %v", err)
+		return fmt.Errorf("failed to create proofbuilder: %w", err)
 	}
 
 	// Go through list of checkpoints pairwise, checking consistency.
@@ -433,7 +748,7 @@ func CheckConsistency(ctx context.Context, h merkle.LogHasher, f Fetcher, cp []l
 			if bytes.Equal(a.Hash, b.Hash) {
 				continue
 			}
-			return fmt.Errorf("two checkpoints with same size (%d) but different hashes (%x vs %x)", a.Size, a.Hash, b.Hash)
+			return fmt.Errorf("two checkpoints with same size (%d) but different hashes (%x vs %x): %w", a.Size, a.Hash, b.Hash, ErrInconsistentTree)
 		}
 		if a.Size > 0 {
 			cp, err := pb.ConsistencyProof(ctx, a.Size, b.Size)
@@ -441,7 +756,7 @@ func CheckConsistency(ctx context.Context, h merkle.LogHasher, f Fetcher, cp []l
 				return fmt.Errorf("failed to fetch consistency between sizes %d, %d: %v", a.Size, b.Size, err)
 			}
 			if err := proof.VerifyConsistency(h, a.Size, b.Size, cp, a.Hash, b.Hash); err != nil {
-				return fmt.Errorf("invalid consistency proof between sizes %d, %d: %v", a.Size, b.Size, err)
+				return fmt.Errorf("invalid consistency proof between sizes %d, %d: %v: %w", a.Size, b.Size, err, ErrInconsistentTree)
 			}
 		}
 	}
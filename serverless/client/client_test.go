@@ -15,17 +15,27 @@
 package client
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	iofs "io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
 	"github.com/transparency-dev/formats/log"
 	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/proof"
 	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
 )
 
 var (
@@ -190,6 +200,205 @@ func TestCheckConsistency(t *testing.T) {
 			if gotErr := err != nil; gotErr != test.wantErr {
 				t.Fatalf("wantErr: %t, got %v", test.wantErr, err)
 			}
+			if got, want := errors.Is(err, ErrInconsistentTree), test.wantErr && len(test.cp) > 1; got != want {
+				t.Errorf("errors.Is(%v, ErrInconsistentTree) = %t, want %t", err, got, want)
+			}
+		})
+	}
+}
+
+func TestLogStateTrackerUpdate(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	for _, test := range []struct {
+		desc     string
+		latest   log.Checkpoint
+		next     log.Checkpoint
+		wantErr  error
+		wantSize uint64
+	}{
+		{
+			desc:     "grown",
+			latest:   testCheckpoints[2],
+			next:     testCheckpoints[5],
+			wantSize: testCheckpoints[5].Size,
+		}, {
+			desc:     "unchanged",
+			latest:   testCheckpoints[5],
+			next:     testCheckpoints[5],
+			wantSize: testCheckpoints[5].Size,
+		}, {
+			desc:     "stale",
+			latest:   testCheckpoints[5],
+			next:     testCheckpoints[2],
+			wantErr:  ErrCheckpointStale,
+			wantSize: testCheckpoints[5].Size,
+		}, {
+			desc:     "fork",
+			latest:   testCheckpoints[5],
+			next:     log.Checkpoint{Size: testCheckpoints[5].Size, Hash: []byte("This is a banana")},
+			wantErr:  ErrInconsistentTree,
+			wantSize: testCheckpoints[5].Size,
+		}, {
+			desc:     "inconsistent",
+			latest:   log.Checkpoint{Size: 2, Hash: []byte("This is a banana")},
+			next:     testCheckpoints[5],
+			wantErr:  ErrInconsistentTree,
+			wantSize: 2,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			next := test.next
+			lst := LogStateTracker{
+				ConsensusCheckpoint: func(context.Context, note.Verifier, string) (*log.Checkpoint, []byte, *note.Note, error) {
+					return &next, next.Marshal(), nil, nil
+				},
+				Fetcher:          f,
+				Hasher:           h,
+				LatestConsistent: test.latest,
+			}
+			_, _, _, err := lst.Update(ctx)
+			if test.wantErr == nil && err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Update = %v, want %v", err, test.wantErr)
+			}
+			if got := lst.LatestConsistent.Size; got != test.wantSize {
+				t.Errorf("LatestConsistent.Size = %d, want %d", got, test.wantSize)
+			}
+		})
+	}
+}
+
+func TestInclusionProofAt(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	latest := testCheckpoints[len(testCheckpoints)-1]
+	pb, err := NewProofBuilder(ctx, latest, h.HashChildren, f)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+	for _, cp := range testCheckpoints {
+		for i := uint64(0); i < cp.Size; i++ {
+			leaf, err := f(ctx, filepath.Join(layout.SeqPath("", i)))
+			if err != nil {
+				t.Fatalf("Failed to read leaf %d: %v", i, err)
+			}
+			p, err := pb.InclusionProofAt(ctx, i, cp.Size)
+			if err != nil {
+				t.Fatalf("InclusionProofAt(%d, %d): %v", i, cp.Size, err)
+			}
+			if err := proof.VerifyInclusion(h, i, cp.Size, h.HashLeaf(leaf), p, cp.Hash); err != nil {
+				t.Errorf("Proof from InclusionProofAt(%d, %d) doesn't verify: %v", i, cp.Size, err)
+			}
+		}
+	}
+	if _, err := pb.InclusionProofAt(ctx, 0, latest.Size+1); err == nil {
+		t.Error("InclusionProofAt beyond checkpoint size succeeded")
+	}
+}
+
+func TestVerifyInclusionByHash(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	f := func(_ context.Context, p string) ([]byte, error) {
+		if strings.HasPrefix(p, "seq/") {
+			t.Fatalf("Unexpected fetch of leaf contents %q", p)
+		}
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	leaf, err := os.ReadFile("../testdata/log/seq/00/00/00/00/05")
+	if err != nil {
+		t.Fatalf("Failed to read leaf: %v", err)
+	}
+	lh := h.HashLeaf(leaf)
+
+	for _, test := range []struct {
+		desc      string
+		cp        log.Checkpoint
+		lh        []byte
+		wantErr   bool
+		wantNotIn bool
+	}{
+		{
+			desc: "included",
+			cp:   testCheckpoints[len(testCheckpoints)-1],
+			lh:   lh,
+		}, {
+			desc:      "not yet integrated",
+			cp:        testCheckpoints[2],
+			lh:        lh,
+			wantErr:   true,
+			wantNotIn: true,
+		}, {
+			desc:    "unknown leaf",
+			cp:      testCheckpoints[len(testCheckpoints)-1],
+			lh:      h.HashLeaf([]byte("banana")),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			idx, _, err := VerifyInclusionByHash(ctx, f, h, test.cp, test.lh)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Got err %v, want err %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, ErrNotIntegrated); got != test.wantNotIn {
+				t.Errorf("errors.Is(%v, ErrNotIntegrated) = %t, want %t", err, got, test.wantNotIn)
+			}
+			if err == nil && idx != 5 {
+				t.Errorf("Got index %d, want 5", idx)
+			}
+		})
+	}
+}
+
+func TestFetchVerifiedLeaves(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cp := testCheckpoints[len(testCheckpoints)-1]
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	tampered := func(ctx context.Context, p string) ([]byte, error) {
+		if p == "seq/00/00/00/00/04" {
+			return []byte("tampered"), nil
+		}
+		return f(ctx, p)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		f          Fetcher
+		begin, end uint64
+		wantErr    bool
+	}{
+		{desc: "whole log", f: f, begin: 0, end: cp.Size},
+		{desc: "middle", f: f, begin: 3, end: 9},
+		{desc: "last leaf", f: f, begin: 14, end: 15},
+		{desc: "empty", f: f, begin: 5, end: 5},
+		{desc: "beyond checkpoint", f: f, begin: 10, end: 16, wantErr: true},
+		{desc: "reversed", f: f, begin: 9, end: 3, wantErr: true},
+		{desc: "tampered", f: tampered, begin: 3, end: 9, wantErr: true},
+		{desc: "tampered whole log", f: tampered, begin: 0, end: cp.Size, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			leaves, err := FetchVerifiedLeaves(ctx, test.f, h, cp, test.begin, test.end)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := uint64(len(leaves)), test.end-test.begin; got != want {
+				t.Errorf("Got %d leaves, want %d", got, want)
+			}
 		})
 	}
 }
@@ -217,3 +426,204 @@ func TestNodeCacheHandlesInvalidRequest(t *testing.T) {
 		t.Error("got no error, want error because ID is out of range")
 	}
 }
+
+func TestNodeCachePrefetch(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	calls := make(map[tileKey]int)
+	active, maxActive := 0, 0
+	f := func(_ context.Context, level, index uint64) (*api.Tile, error) {
+		mu.Lock()
+		calls[tileKey{level, index}]++
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return &api.Tile{Nodes: [][]byte{[]byte("node")}}, nil
+	}
+
+	const numTiles = 3 * DefaultFetchConcurrency
+	nc := newNodeCache(f, numTiles*api.TileWidth)
+	ids := []compact.NodeID{}
+	for i := uint64(0); i < numTiles; i++ {
+		// Request several nodes from each tile, all of which should be served
+		// by a single fetch.
+		ids = append(ids, compact.NewNodeID(0, i*api.TileWidth), compact.NewNodeID(0, i*api.TileWidth+1), compact.NewNodeID(1, i*api.TileWidth/2))
+	}
+	if err := nc.Prefetch(ctx, ids); err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+	if got, want := len(calls), numTiles; got != want {
+		t.Errorf("Fetched %d distinct tiles, want %d", got, want)
+	}
+	for k, n := range calls {
+		if n != 1 {
+			t.Errorf("Tile %v fetched %d times, want 1", k, n)
+		}
+	}
+	if maxActive > DefaultFetchConcurrency {
+		t.Errorf("Saw %d concurrent fetches, want <= %d", maxActive, DefaultFetchConcurrency)
+	}
+
+	// Everything should now be served from the cache.
+	if _, err := nc.GetNode(ctx, compact.NewNodeID(0, api.TileWidth)); err != nil {
+		t.Errorf("GetNode: %v", err)
+	}
+	if got, want := calls[tileKey{0, 1}], 1; got != want {
+		t.Errorf("Tile fetched %d times after GetNode, want %d", got, want)
+	}
+}
+
+func TestNodeCachePrefetchError(t *testing.T) {
+	ctx := context.Background()
+	wantErr := errors.New("boom")
+	f := func(_ context.Context, _, index uint64) (*api.Tile, error) {
+		if index == 1 {
+			return nil, wantErr
+		}
+		return &api.Tile{Nodes: [][]byte{[]byte("node")}}, nil
+	}
+	nc := newNodeCache(f, 4*api.TileWidth)
+	ids := []compact.NodeID{compact.NewNodeID(0, 0), compact.NewNodeID(0, api.TileWidth), compact.NewNodeID(0, 2*api.TileWidth)}
+	if err := nc.Prefetch(ctx, ids); !errors.Is(err, wantErr) {
+		t.Errorf("Prefetch: got %v, want %v", err, wantErr)
+	}
+}
+
+func TestProofBuilderFork(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	// Two full level 0 tiles and a partial one, under a partial level 1 tile.
+	files, cp := buildTiledLog(t, 515)
+	var mu sync.Mutex
+	var fetched []string
+	f := func(_ context.Context, p string) ([]byte, error) {
+		mu.Lock()
+		fetched = append(fetched, p)
+		mu.Unlock()
+		if d, ok := files[p]; ok {
+			return d, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, f)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+
+	for _, test := range []struct {
+		index       uint64
+		wantFetches int
+	}{
+		// Recent entries only need the tiles on the right edge of the tree.
+		{index: 514, wantFetches: 0},
+		{index: 512, wantFetches: 0},
+		// Older ones need the full tile they're in, every time, since tiles
+		// read by forks aren't kept by pb.
+		{index: 0, wantFetches: 1},
+		{index: 0, wantFetches: 1},
+	} {
+		fetched = nil
+		p, err := pb.Fork(f).InclusionProof(ctx, test.index)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d): %v", test.index, err)
+		}
+		if got := len(fetched); got != test.wantFetches {
+			t.Errorf("InclusionProof(%d) read %v, want %d tiles", test.index, fetched, test.wantFetches)
+		}
+		leaf := files[path.Join(layout.SeqPath("", test.index))]
+		if err := proof.VerifyInclusion(h, test.index, cp.Size, h.HashLeaf(leaf), p, cp.Hash); err != nil {
+			t.Errorf("Inclusion proof for %d doesn't verify: %v", test.index, err)
+		}
+	}
+}
+
+func TestTileFetcherFallsBackToFullTile(t *testing.T) {
+	ctx := context.Background()
+	var fetched []string
+	f := func(_ context.Context, p string) ([]byte, error) {
+		fetched = append(fetched, p)
+		if p != "tile/00/0000/00/00/00" {
+			return nil, os.ErrNotExist
+		}
+		return []byte("32\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n"), nil
+	}
+
+	if _, err := newTileFetcher(f, 3)(ctx, 0, 0); err != nil {
+		t.Fatalf("Failed to fetch tile: %v", err)
+	}
+	if got, want := len(fetched), 2; got != want {
+		t.Errorf("Got %d fetches (%v), want %d", got, fetched, want)
+	}
+
+	if _, err := newTileFetcher(f, 3)(ctx, 0, 1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Got err %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestFSFetcher(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+
+	// Bundle a snapshot of the testdata log into an in-memory zip archive.
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	root := "../testdata/log"
+	if err := filepath.WalkDir(root, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}); err != nil {
+		t.Fatalf("Failed to create zip archive: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip archive: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open zip archive: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		fsys iofs.FS
+	}{
+		{desc: "dir", fsys: os.DirFS(root)},
+		{desc: "zip", fsys: zr},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := NewFSFetcher(test.fsys)
+			if err := CheckConsistency(ctx, h, f, []log.Checkpoint{testCheckpoints[2], testCheckpoints[8]}); err != nil {
+				t.Errorf("CheckConsistency: %v", err)
+			}
+			if r, err := Audit(ctx, f, h, testCheckpoints[8], AuditOptions{}); err != nil || !r.OK() {
+				t.Errorf("Audit: got %+v, %v, want OK", r, err)
+			}
+			if _, err := f(ctx, "nonexistent"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Fetch(nonexistent): got err %v, want ErrNotExist", err)
+			}
+			if _, err := f(ctx, "../log/checkpoint"); err == nil {
+				t.Error("Fetch(../log/checkpoint): got no error, want error")
+			}
+		})
+	}
+}
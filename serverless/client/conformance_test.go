@@ -0,0 +1,49 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/internal/conformance"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// conformanceVerifier adapts the verification done by this package to the
+// conformance suite shared with the constrained verifier.
+type conformanceVerifier struct{}
+
+func (conformanceVerifier) OpenCheckpoint(raw []byte, origin string, v note.Verifier) (uint64, []byte, error) {
+	cp, _, _, err := log.ParseCheckpoint(raw, origin, v)
+	if err != nil {
+		return 0, nil, err
+	}
+	return cp.Size, cp.Hash, nil
+}
+
+func (conformanceVerifier) VerifyInclusion(index, size uint64, lh []byte, p [][]byte, root []byte) error {
+	return proof.VerifyInclusion(rfc6962.DefaultHasher, index, size, lh, p, root)
+}
+
+func (conformanceVerifier) VerifyConsistency(size1, size2 uint64, p [][]byte, root1, root2 []byte) error {
+	return proof.VerifyConsistency(rfc6962.DefaultHasher, size1, size2, p, root1, root2)
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, conformanceVerifier{})
+}
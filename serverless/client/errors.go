@@ -0,0 +1,39 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "errors"
+
+// The errors below are returned (wrapped) by the functions in this package,
+// and by the log and storage packages built on it, so that callers can tell
+// failure modes apart with errors.Is rather than by matching error strings.
+var (
+	// ErrCheckpointStale is returned when a log serves a checkpoint which is
+	// smaller than one the caller has already seen, e.g. because a mirror or
+	// cache has fallen behind. It doesn't on its own indicate misbehaviour,
+	// and retrying later may succeed.
+	ErrCheckpointStale = errors.New("checkpoint is stale")
+
+	// ErrInconsistentTree is returned when the data published by a log
+	// doesn't commit to the tree it has signed for, or two checkpoints don't
+	// describe the same append-only tree. Unlike ErrCheckpointStale, it's
+	// evidence that the log (or something between it and the caller) has
+	// misbehaved.
+	ErrInconsistentTree = errors.New("inconsistent tree")
+
+	// ErrUnauthorized is returned when a request is refused because the
+	// caller lacks the credentials for it, e.g. an HTTP 401 or 403 response.
+	ErrUnauthorized = errors.New("unauthorized")
+)
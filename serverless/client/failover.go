@@ -0,0 +1,87 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// NewFailoverFetcher returns a Fetcher which reads from the first of fs, e.g.
+// the log in its primary region, and fails over to the others in turn, e.g.
+// replicas of it in other regions, when a read fails. It keeps reading from
+// the last one which succeeded until that fails in turn.
+//
+// Everything read through it must be verified against the log's checkpoints
+// as usual, since the replicas are no more trusted than the primary. A replica
+// may lag behind, so a checkpoint read from it may be older than one already
+// seen, which LogStateTracker reports as ErrCheckpointStale. For the same
+// reason a file which doesn't exist in one is looked for in the others, and
+// os.ErrNotExist is only returned if none of them has it.
+func NewFailoverFetcher(fs ...Fetcher) Fetcher {
+	if len(fs) == 1 {
+		return fs[0]
+	}
+	fo := &failover{fs: fs}
+	return fo.fetch
+}
+
+// failover holds the Fetchers of a failover Fetcher, and the index of the one
+// currently preferred.
+type failover struct {
+	fs []Fetcher
+
+	mu  sync.Mutex
+	cur int
+}
+
+func (fo *failover) fetch(ctx context.Context, p string) ([]byte, error) {
+	fo.mu.Lock()
+	start := fo.cur
+	fo.mu.Unlock()
+
+	var lastErr error
+	failed := false
+	for i := range fo.fs {
+		n := (start + i) % len(fo.fs)
+		b, err := fo.fs[n](ctx, p)
+		if err == nil {
+			if failed {
+				glog.Warningf("Failing over to replica %d of the log", n)
+				fo.mu.Lock()
+				fo.cur = n
+				fo.mu.Unlock()
+			}
+			return b, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		glog.V(1).Infof("Failed to fetch %q from replica %d of the log: %v", p, n, err)
+		failed, lastErr = true, err
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("%q not found in any replica of the log: %w", p, os.ErrNotExist)
+	}
+	return nil, fmt.Errorf("failed to fetch %q from every replica of the log, last error: %w", p, lastErr)
+}
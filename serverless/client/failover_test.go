@@ -0,0 +1,82 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestFailoverFetcher(t *testing.T) {
+	ctx := context.Background()
+	type region struct {
+		down  bool
+		files map[string]string
+		calls int
+	}
+	primary := &region{files: map[string]string{"checkpoint": "primary", "tile/new": "new"}}
+	replica := &region{files: map[string]string{"checkpoint": "replica"}}
+	fetcher := func(r *region) Fetcher {
+		return func(_ context.Context, p string) ([]byte, error) {
+			r.calls++
+			if r.down {
+				return nil, errors.New("region down")
+			}
+			b, ok := r.files[p]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return []byte(b), nil
+		}
+	}
+	f := NewFailoverFetcher(fetcher(primary), fetcher(replica))
+	get := func(p, want string) {
+		t.Helper()
+		got, err := f(ctx, p)
+		if err != nil || string(got) != want {
+			t.Errorf("fetch(%q) = %q, %v, want %q", p, got, err, want)
+		}
+	}
+
+	get("checkpoint", "primary")
+	if replica.calls != 0 {
+		t.Errorf("replica read %d times while primary is up", replica.calls)
+	}
+
+	// Reads fail over to the replica, and stay there.
+	primary.down = true
+	get("checkpoint", "replica")
+	primary.down = false
+	primary.calls = 0
+	get("checkpoint", "replica")
+	if primary.calls != 0 {
+		t.Errorf("primary read %d times after failing over", primary.calls)
+	}
+
+	// Files the replica doesn't have yet are read from the primary, without
+	// failing back to it.
+	get("tile/new", "new")
+	get("checkpoint", "replica")
+
+	if _, err := f(ctx, "tile/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("fetch of missing file: %v, want not exists error", err)
+	}
+	replica.down = true
+	if _, err := f(ctx, "tile/missing"); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("fetch with replica down: %v, want replica's error", err)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
+)
+
+// ErrTransient is wrapped by errors returned from an HTTP Fetcher when the
+// failure may succeed if retried, e.g. a network error or a 5xx response.
+var ErrTransient = errors.New("transient error")
+
+// HTTPError describes an unsuccessful response from an HTTP server.
+//
+// An HTTPError with a 404 or 410 status matches os.ErrNotExist, one with a
+// 401 or 403 status matches ErrUnauthorized, and one with a 429 or 5xx status
+// matches ErrTransient, when tested with errors.Is.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("GET %s: unexpected http status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is allows HTTPError to be matched against os.ErrNotExist, ErrUnauthorized
+// and ErrTransient.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist:
+		return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrTransient:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	}
+	return false
+}
+
+// transientError wraps a network-level error so that it matches ErrTransient.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e transientError) Unwrap() error {
+	return e.err
+}
+
+func (e transientError) Is(target error) bool {
+	return target == ErrTransient
+}
+
+// maxRetryTime is the maximum amount of time spent retrying a single fetch
+// which is failing with transient errors.
+const maxRetryTime = 30 * time.Second
+
+// DefaultMaxIdleConnsPerHost is the number of idle connections to each host
+// kept open for reuse by clients made by NewHTTPClient, unless set otherwise.
+// It's higher than net/http's default of 2, so that connections opened to
+// fetch tiles in parallel aren't closed as soon as each request finishes.
+const DefaultMaxIdleConnsPerHost = 2 * DefaultFetchConcurrency
+
+// HTTPClientOpts configures the HTTP client made by NewHTTPClient. The zero
+// value gives sensible defaults for fetching from a log.
+type HTTPClientOpts struct {
+	// MaxConnsPerHost, if non-zero, limits the number of connections to each
+	// host, including those in use. Requests beyond the limit wait for a
+	// connection to become free, or, with HTTP/2, are multiplexed over the
+	// open connections.
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is the number of idle connections to each host
+	// kept open for reuse, defaulting to DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open, defaulting
+	// to 90s.
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval between TCP keep-alive probes on open
+	// connections, defaulting to 30s. A negative value disables them.
+	KeepAlive time.Duration
+	// DisableHTTP2, if set, only uses HTTP/1.1. Otherwise HTTP/2 is used
+	// with servers which support it over TLS, so that concurrent requests
+	// share a single connection.
+	DisableHTTP2 bool
+}
+
+// NewHTTPClient returns an HTTP client for use with NewHTTPFetcher, which
+// pools its connections to each host as configured by opts. This matters
+// when building proofs which need many tiles, which are fetched in parallel:
+// with http.DefaultClient, most of the connections opened for them are closed
+// again once they're idle, and each later batch of requests pays for new
+// connection handshakes.
+func NewHTTPClient(opts HTTPClientOpts) *http.Client {
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = 90 * time.Second
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: opts.KeepAlive}).DialContext
+	t.MaxConnsPerHost = opts.MaxConnsPerHost
+	t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	if t.MaxIdleConns < opts.MaxIdleConnsPerHost {
+		t.MaxIdleConns = opts.MaxIdleConnsPerHost
+	}
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	t.ForceAttemptHTTP2 = !opts.DisableHTTP2
+	if opts.DisableHTTP2 {
+		// A non-nil empty map stops the transport from negotiating HTTP/2.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: t}
+}
+
+// NewHTTPFetcher returns a Fetcher which reads from the log served at the
+// given root URL, using the provided HTTP client, or http.DefaultClient if nil.
+//
+// Requests for files which may change, such as the checkpoint, ask caches to
+// revalidate them, so that the log can be fronted by a CDN. If the server gave
+// an ETag for such a file, it's fetched again with If-None-Match, so that an
+// unchanged file isn't sent again.
+//
+// Transient errors are retried with exponential backoff. Once retries are
+// exhausted, or a non-transient error is encountered, the returned error can
+// be tested with errors.Is against os.ErrNotExist or ErrTransient.
+func NewHTTPFetcher(root *url.URL, c *http.Client) Fetcher {
+	return newHTTPFetcher(root, c, func() backoff.BackOff {
+		b := backoff.NewExponentialBackOff()
+		b.MaxElapsedTime = maxRetryTime
+		return b
+	})
+}
+
+// NewGuardedHTTPFetcher returns a Fetcher like NewHTTPFetcher, but whose
+// requests are made through g, which gives each request a deadline, limits
+// retries of transient errors with a budget, and fails requests straight away
+// once the server has failed repeatedly. Errors other than transient ones
+// don't count as the server failing.
+func NewGuardedHTTPFetcher(root *url.URL, c *http.Client, g *guard.Guard) Fetcher {
+	return httpFetcher(root, c, func(ctx context.Context, _ *url.URL, op func(context.Context) error) error {
+		return g.Do(ctx, func(ctx context.Context) error {
+			err := op(ctx)
+			// Running out of time is a failure of the server, even though
+			// readHTTP doesn't treat it as transient.
+			if err != nil && !errors.Is(err, ErrTransient) && ctx.Err() == nil {
+				return guard.Permanent(err)
+			}
+			return err
+		})
+	})
+}
+
+func newHTTPFetcher(root *url.URL, c *http.Client, newBackOff func() backoff.BackOff) Fetcher {
+	return httpFetcher(root, c, func(ctx context.Context, u *url.URL, op func(context.Context) error) error {
+		retryOp := func() error {
+			err := op(ctx)
+			if err != nil && !errors.Is(err, ErrTransient) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+		notify := func(err error, d time.Duration) {
+			glog.V(1).Infof("Retrying %q in %v: %v", u.String(), d, err)
+		}
+		return backoff.RetryNotify(retryOp, backoff.WithContext(newBackOff(), ctx), notify)
+	})
+}
+
+// httpFetcher returns a Fetcher which reads from the log served at root with
+// c, making each request by calling op through do, which decides whether and
+// how to retry it.
+func httpFetcher(root *url.URL, c *http.Client, do func(ctx context.Context, u *url.URL, op func(context.Context) error) error) Fetcher {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	// last holds the latest validated response for each file which may
+	// change, by path.
+	var mu sync.Mutex
+	last := make(map[string]validated)
+	return func(ctx context.Context, p string) ([]byte, error) {
+		if err := layout.ValidatePath(p); err != nil {
+			return nil, err
+		}
+		u, err := root.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		mutable := !layout.Immutable(p)
+		var prev validated
+		if mutable {
+			mu.Lock()
+			prev = last[p]
+			mu.Unlock()
+		}
+		var resp validated
+		op := func(ctx context.Context) error {
+			var err error
+			resp, err = readHTTP(ctx, c, u, mutable, prev)
+			return err
+		}
+		if err := do(ctx, u, op); err != nil {
+			return nil, err
+		}
+		if mutable && len(resp.etag) > 0 {
+			mu.Lock()
+			last[p] = resp
+			mu.Unlock()
+		}
+		return resp.body, nil
+	}
+}
+
+// validated is a response body along with its ETag, if it had one.
+type validated struct {
+	etag string
+	body []byte
+}
+
+// readHTTP performs a single GET request for the given URL. If revalidate is
+// set, any caches between the client and the log, such as a CDN, are asked to
+// check that their copy of the response is current, since it may change, and
+// if prev has an ETag it's only fetched if it no longer matches, otherwise
+// prev is returned.
+func readHTTP(ctx context.Context, c *http.Client, u *url.URL, revalidate bool, prev validated) (validated, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return validated{}, err
+	}
+	if revalidate {
+		req.Header.Set("Cache-Control", "no-cache")
+		if len(prev.etag) > 0 {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return validated{}, ctx.Err()
+		}
+		return validated{}, transientError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && revalidate && len(prev.etag) > 0 {
+		return prev, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return validated{}, &HTTPError{URL: u.String(), StatusCode: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return validated{}, transientError{fmt.Errorf("failed to read body of %q: %w", u.String(), err)}
+	}
+	return validated{etag: resp.Header.Get("ETag"), body: body}, nil
+}
@@ -0,0 +1,320 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	for _, test := range []struct {
+		desc             string
+		statuses         []int
+		path             string
+		wantBody         string
+		wantCalls        int32
+		wantNotExist     bool
+		wantTransient    bool
+		wantUnauthorized bool
+		wantErr          bool
+	}{
+		{
+			desc:      "ok",
+			statuses:  []int{http.StatusOK},
+			path:      "checkpoint",
+			wantBody:  "checkpoint",
+			wantCalls: 1,
+		}, {
+			desc:      "retried then ok",
+			statuses:  []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			path:      "checkpoint",
+			wantBody:  "checkpoint",
+			wantCalls: 3,
+		}, {
+			desc:         "not found",
+			statuses:     []int{http.StatusNotFound},
+			path:         "checkpoint",
+			wantCalls:    1,
+			wantNotExist: true,
+			wantErr:      true,
+		}, {
+			desc:             "forbidden",
+			statuses:         []int{http.StatusForbidden},
+			path:             "checkpoint",
+			wantCalls:        1,
+			wantUnauthorized: true,
+			wantErr:          true,
+		}, {
+			desc:             "unauthorized",
+			statuses:         []int{http.StatusUnauthorized},
+			path:             "checkpoint",
+			wantCalls:        1,
+			wantUnauthorized: true,
+			wantErr:          true,
+		}, {
+			desc:          "retries exhausted",
+			statuses:      []int{http.StatusInternalServerError},
+			path:          "checkpoint",
+			wantCalls:     4,
+			wantTransient: true,
+			wantErr:       true,
+		}, {
+			desc:      "invalid path",
+			statuses:  []int{http.StatusOK},
+			path:      "../checkpoint",
+			wantCalls: 0,
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var calls int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				i := int(n) - 1
+				if i >= len(test.statuses) {
+					i = len(test.statuses) - 1
+				}
+				w.WriteHeader(test.statuses[i])
+				_, _ = w.Write([]byte(r.URL.Path[1:]))
+			}))
+			defer s.Close()
+			root, err := url.Parse(s.URL + "/")
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+			f := newHTTPFetcher(root, s.Client(), func() backoff.BackOff {
+				return backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond), 3)
+			})
+
+			got, err := f(context.Background(), test.path)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Got err %v, want err %t", err, test.wantErr)
+			}
+			if got, want := errors.Is(err, os.ErrNotExist), test.wantNotExist; got != want {
+				t.Errorf("errors.Is(%v, os.ErrNotExist) = %t, want %t", err, got, want)
+			}
+			if got, want := errors.Is(err, ErrTransient), test.wantTransient; got != want {
+				t.Errorf("errors.Is(%v, ErrTransient) = %t, want %t", err, got, want)
+			}
+			if got, want := errors.Is(err, ErrUnauthorized), test.wantUnauthorized; got != want {
+				t.Errorf("errors.Is(%v, ErrUnauthorized) = %t, want %t", err, got, want)
+			}
+			if string(got) != test.wantBody {
+				t.Errorf("Got body %q, want %q", got, test.wantBody)
+			}
+			if got := atomic.LoadInt32(&calls); got != test.wantCalls {
+				t.Errorf("Got %d requests, want %d", got, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcherRevalidatesMutableFiles(t *testing.T) {
+	var got string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Cache-Control")
+	}))
+	defer s.Close()
+	root, err := url.Parse(s.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	f := NewHTTPFetcher(root, s.Client())
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{path: "checkpoint", want: "no-cache"},
+		{path: "manifest", want: "no-cache"},
+		{path: "tile/00/0000/00/00/00.05"},
+		{path: "seq/00/00/00/00/05"},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			if _, err := f(context.Background(), test.path); err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Request had Cache-Control %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcherConditionalFetch(t *testing.T) {
+	body, etag := "checkpoint 1", `"1"`
+	var full, notModified int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/checkpoint" {
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		atomic.AddInt32(&full, 1)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer s.Close()
+	root, err := url.Parse(s.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	f := NewHTTPFetcher(root, s.Client())
+	fetch := func(p, want string) {
+		t.Helper()
+		got, err := f(context.Background(), p)
+		if err != nil {
+			t.Fatalf("Fetch(%q): %v", p, err)
+		}
+		if string(got) != want {
+			t.Errorf("Fetch(%q) got %q, want %q", p, got, want)
+		}
+	}
+
+	fetch("checkpoint", "checkpoint 1")
+	fetch("checkpoint", "checkpoint 1")
+	fetch("checkpoint", "checkpoint 1")
+	if full != 1 || notModified != 2 {
+		t.Errorf("Got %d full and %d not modified responses, want 1 and 2", full, notModified)
+	}
+	body, etag = "checkpoint 2", `"2"`
+	fetch("checkpoint", "checkpoint 2")
+	if full != 2 {
+		t.Errorf("Changed checkpoint wasn't fetched again")
+	}
+	// Immutable files aren't fetched conditionally.
+	fetch("tile/00/0000/00/00/00.05", "checkpoint 2")
+}
+
+func TestGuardedHTTPFetcher(t *testing.T) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/manifest":
+			http.NotFound(w, r)
+		case "/checkpoint":
+			// Hang until the client gives up.
+			<-r.Context().Done()
+		}
+	}))
+	defer s.Close()
+	root, err := url.Parse(s.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	g := guard.New(guard.Options{Deadline: 20 * time.Millisecond, Attempts: 2, RetryDelay: time.Millisecond, FailureThreshold: 2, Cooldown: time.Hour})
+	f := NewGuardedHTTPFetcher(root, s.Client(), g)
+	ctx := context.Background()
+
+	// Missing files don't count as the server failing.
+	for i := 0; i < 3; i++ {
+		if _, err := f(ctx, "manifest"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Fetch(manifest): %v, want not exist", err)
+		}
+	}
+	if got := atomic.SwapInt32(&calls, 0); got != 3 {
+		t.Errorf("Got %d requests for missing file, want 3", got)
+	}
+
+	// A hanging server times out, and is retried.
+	for i := 0; i < 2; i++ {
+		if _, err := f(ctx, "checkpoint"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Fetch(checkpoint): %v, want deadline exceeded", err)
+		}
+	}
+	if got := atomic.SwapInt32(&calls, 0); got != 4 {
+		t.Errorf("Got %d requests to hanging server, want 4", got)
+	}
+	// Then the breaker opens.
+	if _, err := f(ctx, "manifest"); !errors.Is(err, guard.ErrOpen) {
+		t.Errorf("Fetch with breaker open: %v, want ErrOpen", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Errorf("Got %d requests with breaker open, want 0", got)
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	for _, test := range []struct {
+		desc      string
+		opts      HTTPClientOpts
+		wantProto int
+	}{
+		{desc: "default", wantProto: 2},
+		{desc: "HTTP/1.1", opts: HTTPClientOpts{DisableHTTP2: true}, wantProto: 1},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var conns atomic.Int32
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.ProtoMajor != test.wantProto {
+					t.Errorf("Got request over HTTP/%d, want HTTP/%d", r.ProtoMajor, test.wantProto)
+				}
+				// Hold each request, so that those made together need
+				// connections of their own with HTTP/1.1.
+				time.Sleep(10 * time.Millisecond)
+				w.Write([]byte("tile"))
+			}))
+			ts.EnableHTTP2 = true
+			ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+				if s == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			c := NewHTTPClient(test.opts)
+			c.Transport.(*http.Transport).TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+			root, err := url.Parse(ts.URL + "/")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			f := NewHTTPFetcher(root, c)
+			// Connections opened for one batch of parallel fetches are
+			// reused by the next.
+			const parallel = DefaultFetchConcurrency
+			for batch := 0; batch < 3; batch++ {
+				g, ctx := errgroup.WithContext(context.Background())
+				for i := 0; i < parallel; i++ {
+					g.Go(func() error {
+						_, err := f(ctx, "tile/0/000")
+						return err
+					})
+				}
+				if err := g.Wait(); err != nil {
+					t.Fatalf("Fetch: %v", err)
+				}
+			}
+			if got := conns.Load(); got > parallel {
+				t.Errorf("Opened %d connections for %d batches of %d requests, want at most %d", got, 3, parallel, parallel)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Code generated by serverless/internal/server/gen from the OpenAPI description of Serverless Log. DO NOT EDIT.
+
+package httpapi
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+// GetCheckpoint returns the log's latest signed checkpoint.
+func (c *Client) GetCheckpoint(ctx context.Context, wait bool) ([]byte, error) {
+	q := url.Values{}
+	if wait {
+		q.Set("wait", strconv.FormatBool(wait))
+	}
+	return c.get(ctx, "checkpoint", q)
+}
+
+// GetCheckpointEvents streams the log's checkpoints as server-sent events, starting with the latest and followed by each new one as it's published. Each event has type checkpoint, its size as ID, and the signed checkpoint as data, without its final newline.
+func (c *Client) GetCheckpointEvents(ctx context.Context) (io.ReadCloser, error) {
+	q := url.Values{}
+	return c.stream(ctx, "checkpoint/events", q)
+}
+
+// GetConsistencyProof returns the proof that the tree of size from is a prefix of the tree of size to, with one base64 encoded hash per line.
+func (c *Client) GetConsistencyProof(ctx context.Context, from uint64, to uint64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("from", strconv.FormatUint(from, 10))
+	q.Set("to", strconv.FormatUint(to, 10))
+	return c.get(ctx, "proof/consistency", q)
+}
+
+// GetConsistencyProofJSON returns the proof that the tree of size from is a prefix of the tree of size to, as a JSON object with from, to, and base64 encoded hashes.
+func (c *Client) GetConsistencyProofJSON(ctx context.Context, from uint64, to uint64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("from", strconv.FormatUint(from, 10))
+	q.Set("to", strconv.FormatUint(to, 10))
+	return c.get(ctx, "proof/consistency.json", q)
+}
+
+// GetHealth reports that the server is running.
+func (c *Client) GetHealth(ctx context.Context) ([]byte, error) {
+	q := url.Values{}
+	return c.get(ctx, "healthz", q)
+}
+
+// GetInclusionProof returns the proof that the leaf at index is included in the tree of the given size, with one base64 encoded hash per line.
+func (c *Client) GetInclusionProof(ctx context.Context, index uint64, size uint64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("index", strconv.FormatUint(index, 10))
+	q.Set("size", strconv.FormatUint(size, 10))
+	return c.get(ctx, "proof/inclusion", q)
+}
+
+// GetInclusionProofJSON returns the proof that the leaf at index is included in the tree of the given size, as a JSON object with index, size, and base64 encoded hashes.
+func (c *Client) GetInclusionProofJSON(ctx context.Context, index uint64, size uint64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("index", strconv.FormatUint(index, 10))
+	q.Set("size", strconv.FormatUint(size, 10))
+	return c.get(ctx, "proof/inclusion.json", q)
+}
+
+// GetOpenAPI returns the OpenAPI description of this API.
+func (c *Client) GetOpenAPI(ctx context.Context) ([]byte, error) {
+	q := url.Values{}
+	return c.get(ctx, "openapi.json", q)
+}
+
+// GetReadiness reports whether the server can serve the log: its storage is reachable, the checkpoint verifies with the log's key, and, if configured, the checkpoint is fresh.
+func (c *Client) GetReadiness(ctx context.Context) ([]byte, error) {
+	q := url.Values{}
+	return c.get(ctx, "readyz", q)
+}
+
+// LookupIdentifier returns the entries associated with an identifier in the identifier map, along with the proof of them against the map root.
+func (c *Client) LookupIdentifier(ctx context.Context, identifier string, size uint64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("identifier", identifier)
+	q.Set("size", strconv.FormatUint(size, 10))
+	return c.get(ctx, "lookup", q)
+}
+
+// TailEntries streams the log's entries from index from onwards, waiting for new entries to be integrated, as newline delimited JSON objects with the entry's base64 encoded data, and a bundle of the signed checkpoint, leaf hash and inclusion proof verifying it.
+func (c *Client) TailEntries(ctx context.Context, from uint64) (io.ReadCloser, error) {
+	q := url.Values{}
+	q.Set("from", strconv.FormatUint(from, 10))
+	return c.stream(ctx, "tail", q)
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpapi provides a client for the HTTP API of the serve tool.
+//
+// The methods calling the API are generated from its OpenAPI description, in
+// api/openapi.json, and return response bodies unverified. Callers must
+// verify them, e.g. with the merkle/proof package or client.VerifyMapEntry,
+// against a checkpoint they trust.
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/google/trillian-examples/serverless/client"
+)
+
+// Client calls the API of a serve tool.
+type Client struct {
+	root *url.URL
+	c    *http.Client
+}
+
+// New returns a Client for the API served at root, which makes requests
+// with c.
+func New(root *url.URL, c *http.Client) *Client {
+	return &Client{root: root, c: c}
+}
+
+// get requests the path, relative to the root of the API, with the query q.
+// Unsuccessful responses are returned as a *client.HTTPError.
+func (c *Client) get(ctx context.Context, path string, q url.Values) ([]byte, error) {
+	body, err := c.stream(ctx, path, q)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body of %q: %w", path, err)
+	}
+	return b, nil
+}
+
+// stream requests the path, relative to the root of the API, with the query
+// q, and returns the body of the response, which the caller must close.
+// Unsuccessful responses are returned as a *client.HTTPError.
+func (c *Client) stream(ctx context.Context, path string, q url.Values) (io.ReadCloser, error) {
+	u, err := c.root.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &client.HTTPError{URL: u.String(), StatusCode: resp.StatusCode}
+	}
+	return resp.Body, nil
+}
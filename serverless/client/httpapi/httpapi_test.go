@@ -0,0 +1,107 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/internal/server"
+	"github.com/google/trillian-examples/serverless/testdata"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	s := server.New(os.DirFS("../../testdata/log"), rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	// The root path is preserved when the server isn't at the root of its
+	// host.
+	u, err := url.Parse(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return New(u, http.DefaultClient)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	raw, err := c.GetCheckpoint(ctx, false)
+	if err != nil {
+		t.Fatalf("GetCheckpoint: %v", err)
+	}
+	if want := testdata.Checkpoint(t, 15); !bytes.Equal(raw, want) {
+		t.Errorf("GetCheckpoint got %q, want %q", raw, want)
+	}
+	to, _, _, err := fmtlog.ParseCheckpoint(raw, testdata.TestLogOrigin, testdata.LogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("ParseCheckpoint: %v", err)
+	}
+	from, _, _, err := fmtlog.ParseCheckpoint(testdata.Checkpoint(t, 7), testdata.TestLogOrigin, testdata.LogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("ParseCheckpoint: %v", err)
+	}
+
+	body, err := c.GetConsistencyProof(ctx, from.Size, to.Size)
+	if err != nil {
+		t.Fatalf("GetConsistencyProof: %v", err)
+	}
+	p, err := api.ParseProof(body)
+	if err != nil {
+		t.Fatalf("ParseProof: %v", err)
+	}
+	if err := proof.VerifyConsistency(rfc6962.DefaultHasher, from.Size, to.Size, p, from.Hash, to.Hash); err != nil {
+		t.Errorf("VerifyConsistency: %v", err)
+	}
+
+	if _, err := c.GetInclusionProof(ctx, 3, 7); err != nil {
+		t.Errorf("GetInclusionProof: %v", err)
+	}
+	if _, err := c.GetInclusionProof(ctx, 3, 16); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetInclusionProof beyond log size: %v, want not exists error", err)
+	}
+	if _, err := c.LookupIdentifier(ctx, "apple", 3); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LookupIdentifier with no map: %v, want not exists error", err)
+	}
+
+	tctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tail, err := c.TailEntries(tctx, 14)
+	if err != nil {
+		t.Fatalf("TailEntries: %v", err)
+	}
+	defer tail.Close()
+	var e api.TailEntry
+	if err := json.NewDecoder(tail).Decode(&e); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if err := proof.VerifyInclusion(rfc6962.DefaultHasher, e.Proof.Index, to.Size, rfc6962.DefaultHasher.HashLeaf(e.Data), e.Proof.Hashes, to.Hash); err != nil {
+		t.Errorf("Tailed entry %d doesn't verify: %v", e.Proof.Index, err)
+	}
+}
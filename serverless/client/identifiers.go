@@ -0,0 +1,162 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/pkg/vmap"
+)
+
+// LookupIdentifier fetches the list of entries associated with identifier in
+// the snapshot of the identifier map with the given root, which should have
+// been taken from the extension lines of a verified checkpoint with
+// api.ParseMapRoot, and verifies it against the root.
+//
+// An error wrapping os.ErrNotExist is returned if the snapshot has no entry
+// for identifier. Note that the absence of an identifier isn't proven.
+func LookupIdentifier(ctx context.Context, f Fetcher, root api.MapRoot, identifier string) (*api.EntryList, error) {
+	if err := api.ValidateIdentifier(identifier); err != nil {
+		return nil, err
+	}
+	raw, err := f(ctx, path.Join(layout.MapPath("", root.Size, api.IdentifierKey(identifier))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch map entry: %w", err)
+	}
+	return VerifyMapEntry(root, identifier, raw)
+}
+
+// VerifyMapEntry parses raw as the map entry for identifier, however it was
+// obtained, and verifies it against the snapshot of the identifier map with
+// the given root.
+func VerifyMapEntry(root api.MapRoot, identifier string, raw []byte) (*api.EntryList, error) {
+	e, err := api.ParseMapEntry(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse map entry: %w", err)
+	}
+	if e.Entries.Identifier != identifier {
+		return nil, fmt.Errorf("map entry is for identifier %q, want %q", e.Entries.Identifier, identifier)
+	}
+	if last := e.Entries.Last(); last >= root.Size {
+		return nil, fmt.Errorf("map entry lists index %d, beyond map size %d", last, root.Size)
+	}
+	if err := vmap.Verify(root.Root, api.IdentifierKey(identifier), e.Entries.Marshal(), e.Proof); err != nil {
+		return nil, fmt.Errorf("failed to verify map entry: %w", err)
+	}
+	return &e.Entries, nil
+}
+
+// EntryIterator iterates over the indices of the entries in an entry list, as
+// returned by LookupIdentifier, fetching the list's pages as they're reached
+// and checking them against the list, so that identifiers with very many
+// entries needn't be held in memory at once:
+//
+//	it := client.IterateEntries(f, el)
+//	for it.Next(ctx) {
+//		i := it.Index()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type EntryIterator struct {
+	f        Fetcher
+	l        *api.EntryList
+	page     int
+	tailDone bool
+	buf      []uint64
+	cur      uint64
+	err      error
+}
+
+// IterateEntries returns an iterator over the indices in l, fetching its
+// pages via f.
+func IterateEntries(f Fetcher, l *api.EntryList) *EntryIterator {
+	return &EntryIterator{f: f, l: l}
+}
+
+// Next advances to the next index, returning false when there are none left
+// or a page couldn't be fetched, which Err then reports.
+func (it *EntryIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if it.err != nil {
+			return false
+		}
+		switch {
+		case it.page < len(it.l.Pages):
+			ref := it.l.Pages[it.page]
+			raw, err := it.f(ctx, path.Join(layout.EntryPagePath("", ref.Hash)))
+			if err != nil {
+				it.err = fmt.Errorf("failed to fetch entry page %d: %w", it.page, err)
+				return false
+			}
+			page, err := api.ParseEntryPage(raw, it.l.Identifier, ref)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			it.buf = page.Indices
+			it.page++
+		case !it.tailDone:
+			it.buf = it.l.Indices
+			it.tailDone = true
+		default:
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Index returns the current index.
+func (it *EntryIterator) Index() uint64 {
+	return it.cur
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *EntryIterator) Err() error {
+	return it.err
+}
+
+// AllEntries returns all of the indices in l, fetching its pages via f.
+func AllEntries(ctx context.Context, f Fetcher, l *api.EntryList) ([]uint64, error) {
+	var ret []uint64
+	it := IterateEntries(f, l)
+	for it.Next(ctx) {
+		ret = append(ret, it.Index())
+	}
+	return ret, it.Err()
+}
+
+// FetchContentType fetches the content type the entry with leaf hash lh was
+// tagged with when it was sequenced, or the empty string if it wasn't tagged.
+// Like the identifiers associated with an entry, the tag isn't committed to by
+// the log's checkpoints, so callers which rely on it should check that the
+// entry's contents match it.
+func FetchContentType(ctx context.Context, f Fetcher, lh []byte) (string, error) {
+	raw, err := f(ctx, path.Join(layout.ContentTypePath("", lh)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to fetch content type: %w", err)
+	}
+	return api.ParseContentType(raw)
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/pkg/vmap"
+)
+
+func TestLookupIdentifier(t *testing.T) {
+	ctx := context.Background()
+	const size = 10
+	lists := []api.EntryList{
+		{Identifier: "apple", Indices: []uint64{1, 4}},
+		{Identifier: "banana", Indices: []uint64{2}},
+		{Identifier: "cherry", Indices: []uint64{3, 9}},
+	}
+	values := make(map[string][]byte)
+	for _, l := range lists {
+		values[string(api.IdentifierKey(l.Identifier))] = l.Marshal()
+	}
+	m, err := vmap.New(values)
+	if err != nil {
+		t.Fatalf("vmap.New: %v", err)
+	}
+	files := make(map[string][]byte)
+	entry := func(l api.EntryList) []byte {
+		p, err := m.Proof(api.IdentifierKey(l.Identifier))
+		if err != nil {
+			t.Fatalf("Proof: %v", err)
+		}
+		return api.MapEntry{Entries: l, Proof: *p}.Marshal()
+	}
+	for _, l := range lists {
+		files[path.Join(layout.MapPath("", size, api.IdentifierKey(l.Identifier)))] = entry(l)
+	}
+	// A map entry which claims banana has an entry it doesn't, with the real
+	// proof for banana.
+	bad := entry(lists[1])
+	forged := api.EntryList{Identifier: "banana", Indices: []uint64{2, 5}}
+	e, err := api.ParseMapEntry(bad)
+	if err != nil {
+		t.Fatalf("ParseMapEntry: %v", err)
+	}
+	e.Entries = forged
+	files[path.Join(layout.MapPath("", size, api.IdentifierKey("forged")))] = e.Marshal()
+
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+	root := api.MapRoot{Size: size, Root: m.Root()}
+
+	for _, l := range lists {
+		got, err := LookupIdentifier(ctx, f, root, l.Identifier)
+		if err != nil {
+			t.Fatalf("LookupIdentifier(%q): %v", l.Identifier, err)
+		}
+		if diff := cmp.Diff(*got, l); len(diff) != 0 {
+			t.Errorf("LookupIdentifier(%q) had diff %s", l.Identifier, diff)
+		}
+	}
+
+	if _, err := LookupIdentifier(ctx, f, root, "durian"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LookupIdentifier for unknown identifier: %v, want not exists error", err)
+	}
+	if _, err := LookupIdentifier(ctx, f, root, "forged"); err == nil {
+		t.Error("LookupIdentifier returned entries for a different identifier")
+	}
+	files[path.Join(layout.MapPath("", size, api.IdentifierKey("banana")))] = e.Marshal()
+	if _, err := LookupIdentifier(ctx, f, root, "banana"); !errors.Is(err, vmap.ErrRootMismatch) {
+		t.Errorf("LookupIdentifier with forged entries: %v, want ErrRootMismatch", err)
+	}
+	// Entries beyond the size of the map can't have been included in it.
+	files[path.Join(layout.MapPath("", 5, api.IdentifierKey("cherry")))] = entry(lists[2])
+	if _, err := LookupIdentifier(ctx, f, api.MapRoot{Size: 5, Root: m.Root()}, "cherry"); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Error("LookupIdentifier with index beyond map size succeeded")
+	}
+}
+
+func TestFetchContentType(t *testing.T) {
+	ctx := context.Background()
+	tagged, untagged, bad := []byte("tagged"), []byte("untagged"), []byte("bad")
+	files := map[string][]byte{
+		path.Join(layout.ContentTypePath("", tagged)): api.MarshalContentType(api.ContentTypeSPDX),
+		path.Join(layout.ContentTypePath("", bad)):    []byte("SPDX\n"),
+	}
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+	if got, err := FetchContentType(ctx, f, tagged); err != nil || got != api.ContentTypeSPDX {
+		t.Errorf("FetchContentType(tagged) = %q, %v, want %q", got, err, api.ContentTypeSPDX)
+	}
+	if got, err := FetchContentType(ctx, f, untagged); err != nil || got != "" {
+		t.Errorf("FetchContentType(untagged) = %q, %v, want no type", got, err)
+	}
+	if got, err := FetchContentType(ctx, f, bad); err == nil {
+		t.Errorf("FetchContentType(bad) = %q, want error", got)
+	}
+}
+
+func TestIterateEntries(t *testing.T) {
+	ctx := context.Background()
+	page := api.EntryList{Identifier: "hot"}
+	for i := uint64(0); i < api.EntryPageSize; i++ {
+		page.Indices = append(page.Indices, i)
+	}
+	ref, raw := api.NewEntryPage(page)
+	files := map[string][]byte{path.Join(layout.EntryPagePath("", ref.Hash)): raw}
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+	l := &api.EntryList{Identifier: "hot", Pages: []api.EntryPage{ref}, Indices: []uint64{2000, 2001}}
+	got, err := AllEntries(ctx, f, l)
+	if err != nil {
+		t.Fatalf("AllEntries: %v", err)
+	}
+	want := append(append([]uint64{}, page.Indices...), 2000, 2001)
+	if diff := cmp.Diff(got, want); len(diff) != 0 {
+		t.Errorf("AllEntries: diff %s", diff)
+	}
+
+	// Lists without pages are read as before.
+	if got, err := AllEntries(ctx, f, &api.EntryList{Identifier: "cold", Indices: []uint64{3}}); err != nil || len(got) != 1 {
+		t.Errorf("AllEntries = %v, %v, want [3]", got, err)
+	}
+
+	// A page which doesn't match its reference stops the iteration.
+	files[path.Join(layout.EntryPagePath("", ref.Hash))] = append(raw, ' ')
+	it := IterateEntries(f, l)
+	for it.Next(ctx) {
+		t.Fatalf("Next returned index %d from tampered page", it.Index())
+	}
+	if it.Err() == nil {
+		t.Error("Err = nil, want error for tampered page")
+	}
+}
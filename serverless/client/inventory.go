@@ -0,0 +1,109 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
+)
+
+// FetchInventory retrieves and opens the inventory of the log's files which
+// are committed to by its checkpoint of the given size.
+func FetchInventory(ctx context.Context, f Fetcher, v note.Verifier, origin string, size uint64) (*api.Inventory, error) {
+	raw, err := f(ctx, path.Join(layout.InventoryPath("", size)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch inventory: %w", err)
+	}
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open inventory: %w", err)
+	}
+	i, err := api.ParseInventory([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %w", err)
+	}
+	if i.Origin != origin {
+		return nil, fmt.Errorf("inventory has origin %q, want %q", i.Origin, origin)
+	}
+	if i.Size != size {
+		return nil, fmt.Errorf("inventory has size %d, want %d", i.Size, size)
+	}
+	return i, nil
+}
+
+// InventoryResult describes how the copy of a log read by a Fetcher differs
+// from its inventory.
+type InventoryResult struct {
+	// Missing holds the paths of the files which don't exist.
+	Missing []string
+	// Mismatched holds the paths of the files whose contents differ from
+	// those listed.
+	Mismatched []string
+}
+
+// OK returns true if every file in the inventory was found with the expected
+// contents.
+func (r InventoryResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+// VerifyInventory checks that every file listed in inv can be fetched with f,
+// and has the listed contents. It's intended for use by mirrors, to check
+// that they've copied the log completely. Files are fetched concurrently.
+func VerifyInventory(ctx context.Context, f Fetcher, inv *api.Inventory) (*InventoryResult, error) {
+	missing := make([]bool, len(inv.Objects))
+	mismatched := make([]bool, len(inv.Objects))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultFetchConcurrency)
+	for i, o := range inv.Objects {
+		i, o := i, o
+		g.Go(func() error {
+			d, err := f(gctx, o.Path)
+			if errors.Is(err, os.ErrNotExist) {
+				missing[i] = true
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to fetch %q: %w", o.Path, err)
+			}
+			if h := sha256.Sum256(d); !bytes.Equal(h[:], o.Hash) {
+				mismatched[i] = true
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	r := &InventoryResult{}
+	for i, o := range inv.Objects {
+		if missing[i] {
+			r.Missing = append(r.Missing, o.Path)
+		}
+		if mismatched[i] {
+			r.Mismatched = append(r.Mismatched, o.Path)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+func TestVerifyInventory(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKey(t, "log")
+	files := map[string][]byte{
+		"seq/00/00/00/00/00": []byte("one"),
+		"seq/00/00/00/00/01": []byte("two"),
+		"seq/00/00/00/00/02": []byte("three"),
+	}
+	inv := api.Inventory{Origin: "My Log", Size: 3, Hash: make([]byte, 32)}
+	for _, p := range []string{"seq/00/00/00/00/00", "seq/00/00/00/00/01", "seq/00/00/00/00/02"} {
+		inv.Objects = append(inv.Objects, api.NewInventoryObject(p, files[p]))
+	}
+	files[path.Join(layout.InventoryPath("", 3))] = k.sign(t, string(inv.Marshal()))
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+
+	got, err := FetchInventory(ctx, f, k.v, "My Log", 3)
+	if err != nil {
+		t.Fatalf("FetchInventory: %v", err)
+	}
+	if diff := cmp.Diff(got, &inv); len(diff) != 0 {
+		t.Errorf("FetchInventory had diff %s", diff)
+	}
+	if _, err := FetchInventory(ctx, f, k.v, "Other Log", 3); err == nil {
+		t.Error("FetchInventory with wrong origin succeeded")
+	}
+	if _, err := FetchInventory(ctx, f, k.v, "My Log", 2); err == nil {
+		t.Error("FetchInventory of missing inventory succeeded")
+	}
+
+	r, err := VerifyInventory(ctx, f, got)
+	if err != nil {
+		t.Fatalf("VerifyInventory: %v", err)
+	}
+	if !r.OK() {
+		t.Errorf("VerifyInventory of complete copy = %+v, want OK", r)
+	}
+
+	delete(files, "seq/00/00/00/00/00")
+	files["seq/00/00/00/00/02"] = []byte("four")
+	r, err = VerifyInventory(ctx, f, got)
+	if err != nil {
+		t.Fatalf("VerifyInventory: %v", err)
+	}
+	want := &InventoryResult{Missing: []string{"seq/00/00/00/00/00"}, Mismatched: []string{"seq/00/00/00/00/02"}}
+	if diff := cmp.Diff(r, want); len(diff) != 0 {
+		t.Errorf("VerifyInventory of damaged copy had diff %s", diff)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"golang.org/x/sync/errgroup"
+)
+
+// LayoutResult describes how the tiles and entries read by a Fetcher differ
+// from those of the tree committed to by a checkpoint.
+type LayoutResult struct {
+	// Missing holds the paths of the tiles and entries which the tree needs,
+	// but which don't exist.
+	Missing []string
+	// Extra holds the paths of tiles which only a larger tree would have.
+	// They're expected while a checkpoint is staged, but otherwise mean
+	// that the storage is ahead of its published checkpoint.
+	Extra []string
+	// Mismatched holds the paths of the entries whose leaf hash differs from
+	// the one in the tree.
+	Mismatched []string
+	// Derived holds the paths of the partial tiles which don't exist, but
+	// which can be derived from the tiles or entries below them, as in logs
+	// which don't store their partial tiles.
+	Derived []string
+	// Redacted holds the paths of the entries whose data the log withholds,
+	// which have a tombstone in their place recording the leaf hash in the
+	// tree. The tombstones' signatures aren't verified.
+	Redacted []string
+}
+
+// OK returns true if exactly the tiles and entries of the tree were found.
+func (r LayoutResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// VerifyLayout checks that the tiles and entries read with f are exactly those
+// of the tree committed to by cp: every tile and entry of a tree of size
+// cp.Size is present, or for partial tiles can be derived, the entries hash to
+// the leaves of the tiles, or are redacted with a tombstone recording the
+// leaf, and no tile of a larger tree has been published. If
+// no tiles are missing, the tiles must also commit to cp's root hash, or an
+// error is returned.
+//
+// Entries beyond cp.Size aren't considered, since in a serverless log they're
+// sequenced entries awaiting integration. Every entry is fetched, so for a
+// large log this is as expensive as a full mirror.
+func VerifyLayout(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint) (*LayoutResult, error) {
+	var mu sync.Mutex
+	r := &LayoutResult{}
+	add := func(l *[]string, p string) {
+		mu.Lock()
+		defer mu.Unlock()
+		*l = append(*l, p)
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultFetchConcurrency)
+	// exists reports whether the file at p exists, treating any failure other
+	// than it not existing as fatal.
+	exists := func(p string) ([]byte, bool, error) {
+		d, err := f(gctx, p)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, fmt.Errorf("failed to fetch %q: %w", p, err)
+		}
+		return d, true, nil
+	}
+
+	for level := uint64(0); ; level++ {
+		size := cp.Size >> (level * 8)
+		full, partial := size/256, size%256
+		for i := uint64(0); i <= full; i++ {
+			level, i := level, i
+			tileSize := uint64(0)
+			if i == full {
+				if tileSize = partial; tileSize == 0 {
+					break
+				}
+			}
+			g.Go(func() error {
+				p := path.Join(layout.TilePath("", level, i, tileSize))
+				d, ok, err := exists(p)
+				if err != nil {
+					return err
+				}
+				var t *api.Tile
+				switch {
+				case ok && level == 0:
+					if t, err = api.ParseTile(d); err != nil {
+						return fmt.Errorf("failed to parse tile %q: %w", p, err)
+					}
+				case !ok && tileSize > 0:
+					// Logs which don't store their partial tiles only have
+					// what they're derived from.
+					t, err = DerivePartialTile(gctx, h, f, level, i, tileSize)
+					if errors.Is(err, os.ErrNotExist) {
+						add(&r.Missing, p)
+					} else if err != nil {
+						return fmt.Errorf("failed to derive tile %q: %w", p, err)
+					} else {
+						add(&r.Derived, p)
+					}
+				case !ok:
+					add(&r.Missing, p)
+				}
+				if level > 0 {
+					return nil
+				}
+				return verifyTileEntries(gctx, f, h, t, i, tileSize, add, &r.Missing, &r.Mismatched, &r.Redacted)
+			})
+		}
+		// The tile after the last one of the tree mustn't exist in full, or
+		// with more leaves than the tree gives it.
+		for tileSize := partial + 1; tileSize <= 256; tileSize++ {
+			level, tileSize := level, tileSize
+			g.Go(func() error {
+				p := path.Join(layout.TilePath("", level, full, tileSize%256))
+				_, ok, err := exists(p)
+				if ok {
+					add(&r.Extra, p)
+				}
+				return err
+			})
+		}
+		if full == 0 {
+			break
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for _, l := range [][]string{r.Missing, r.Extra, r.Mismatched, r.Derived, r.Redacted} {
+		sort.Strings(l)
+	}
+	if len(r.Missing) > 0 || cp.Size == 0 {
+		return r, nil
+	}
+	if err := verifyTilesRoot(ctx, f, h, cp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// verifyTilesRoot checks that the tiles read with f commit to cp's root hash.
+func verifyTilesRoot(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint) error {
+	hashes, err := FetchRangeNodes(ctx, cp.Size, newTileFetcher(DerivingFetcher(f, h), cp.Size))
+	if err != nil {
+		return fmt.Errorf("failed to fetch range nodes: %w", err)
+	}
+	cr, err := (&compact.RangeFactory{Hash: h.HashChildren}).NewRange(0, cp.Size, hashes)
+	if err != nil {
+		return err
+	}
+	root, err := cr.GetRootHash(nil)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, cp.Hash) {
+		return fmt.Errorf("tiles commit to root %x, want %x: %w", root, cp.Hash, ErrInconsistentTree)
+	}
+	return nil
+}
+
+// verifyTileEntries checks the entries whose leaf hashes are in the level 0 tile
+// t with index i, which should have the given number of leaves, or 256 if
+// it's zero. The paths of missing, mismatched and redacted entries are passed
+// to add along with the list to add them to. If t is nil, because the tile is
+// missing, only the presence of the entries is checked.
+func verifyTileEntries(ctx context.Context, f Fetcher, h merkle.LogHasher, t *api.Tile, i, tileSize uint64, add func(*[]string, string), missing, mismatched, redacted *[]string) error {
+	n := tileSize
+	if n == 0 {
+		n = 256
+	}
+	if t != nil && uint64(t.NumLeaves) < n {
+		return fmt.Errorf("level 0 tile %d has %d leaves, want %d", i, t.NumLeaves, n)
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultFetchConcurrency)
+	for j := uint64(0); j < n; j++ {
+		j := j
+		g.Go(func() error {
+			p := path.Join(layout.SeqPath("", i*256+j))
+			e, red, err := getLeaf(gctx, f, i*256+j)
+			if errors.Is(err, os.ErrNotExist) {
+				add(missing, p)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			lh := h.HashLeaf(e)
+			if red != nil {
+				add(redacted, p)
+				lh = red.LeafHash
+				p = path.Join(layout.TombstonePath("", i*256+j))
+			}
+			if t == nil {
+				return nil
+			}
+			k := api.TileNodeKey(0, j)
+			if k >= uint(len(t.Nodes)) || !bytes.Equal(lh, t.Nodes[k]) {
+				add(mismatched, p)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestVerifyLayout(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	checkpoint := func(size int) log.Checkpoint {
+		t.Helper()
+		raw, err := os.ReadFile(filepath.Join("../testdata/log", fmt.Sprintf("checkpoint.%d", size)))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		var cp log.Checkpoint
+		if _, err := cp.Unmarshal(raw); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		return cp
+	}
+	seq3 := path.Join(layout.SeqPath("", 3))
+	tile15 := path.Join(layout.TilePath("", 0, 0, 15))
+
+	for _, test := range []struct {
+		desc string
+		cp   log.Checkpoint
+		// files overrides the testdata log's files, with nil removing them.
+		files   map[string][]byte
+		want    LayoutResult
+		wantErr bool
+	}{
+		{
+			desc: "complete",
+			cp:   checkpoint(15),
+		}, {
+			desc: "truncated entries",
+			cp:   checkpoint(15),
+			files: map[string][]byte{
+				seq3: nil,
+			},
+			want: LayoutResult{Missing: []string{seq3}},
+		}, {
+			desc: "derived partial tiles",
+			cp:   checkpoint(15),
+			files: map[string][]byte{
+				tile15: nil,
+			},
+			want: LayoutResult{Derived: []string{tile15}},
+		}, {
+			desc: "truncated tiles",
+			cp:   checkpoint(15),
+			files: map[string][]byte{
+				tile15: nil,
+				seq3:   nil,
+			},
+			want: LayoutResult{Missing: []string{seq3, tile15}},
+		}, {
+			desc: "altered entry",
+			cp:   checkpoint(15),
+			files: map[string][]byte{
+				seq3: []byte("banana"),
+			},
+			want: LayoutResult{Mismatched: []string{seq3}},
+		}, {
+			desc: "over-published",
+			cp:   checkpoint(14),
+			want: LayoutResult{Extra: []string{tile15}},
+		}, {
+			desc: "full tile published early",
+			cp:   checkpoint(15),
+			files: map[string][]byte{
+				path.Join(layout.TilePath("", 0, 0, 0)): []byte("tile"),
+			},
+			want: LayoutResult{Extra: []string{path.Join(layout.TilePath("", 0, 0, 0))}},
+		}, {
+			desc:    "wrong root",
+			cp:      log.Checkpoint{Origin: checkpoint(15).Origin, Size: 15, Hash: checkpoint(14).Hash},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if d, ok := test.files[p]; ok {
+					if d == nil {
+						return nil, os.ErrNotExist
+					}
+					return d, nil
+				}
+				return os.ReadFile(filepath.Join("../testdata/log", p))
+			}
+			got, err := VerifyLayout(ctx, f, h, test.cp)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyLayout: %v, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(&test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("VerifyLayout had diff (-want +got):\n%s", diff)
+			}
+			if got.OK() != test.want.OK() {
+				t.Errorf("OK = %t, want %t", got.OK(), test.want.OK())
+			}
+		})
+	}
+}
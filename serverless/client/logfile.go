@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+)
+
+// FetchLogSegments fetches the log segment records associated with host in
+// the identifier map with the given root, in the order they were sequenced,
+// and verifies that they are committed to by cp. Other entries associated
+// with host are skipped.
+func FetchLogSegments(ctx context.Context, f Fetcher, h merkle.LogHasher, cp log.Checkpoint, root api.MapRoot, host string) ([]api.LogSegment, error) {
+	el, err := LookupIdentifier(ctx, f, root, host)
+	if err != nil {
+		return nil, err
+	}
+	var segs []api.LogSegment
+	it := IterateEntries(f, el)
+	for it.Next(ctx) {
+		i := it.Index()
+		e, err := GetLeaf(ctx, f, i)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := VerifyInclusion(ctx, f, h, cp, i, h.HashLeaf(e)); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if !api.IsLogSegment(e) {
+			continue
+		}
+		s, err := api.ParseLogSegment(e)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if s.Host != host {
+			continue
+		}
+		segs = append(segs, *s)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return segs, nil
+}
+
+// LogFileResult describes how a log file differs from the segments recorded
+// for it.
+type LogFileResult struct {
+	// Verified holds the segments whose range of the file has the recorded
+	// hash.
+	Verified []api.LogSegment
+	// Mismatched holds the segments whose range of the file has been
+	// altered, or truncated.
+	Mismatched []api.LogSegment
+	// Rotated is the number of segments recorded for earlier files of the
+	// same name, before the file was last rotated, which can't be checked
+	// against it.
+	Rotated int
+	// Unrecorded is the number of bytes at the end of the file beyond the
+	// last segment, which haven't been rolled up yet.
+	Unrecorded uint64
+}
+
+// OK returns true if every segment of the file matched its contents.
+func (r LogFileResult) OK() bool {
+	return len(r.Mismatched) == 0
+}
+
+// VerifyLogFile checks the contents of the log file of the given name, read
+// from r which holds size bytes, against segs, the segments recorded for the
+// host in the order they were sequenced, as returned by FetchLogSegments.
+// Segments of other files are ignored.
+//
+// Only the segments since the latest one starting at the beginning of the
+// file are checked, since earlier ones are of files since rotated away.
+func VerifyLogFile(segs []api.LogSegment, name string, r io.ReaderAt, size uint64) (*LogFileResult, error) {
+	res := &LogFileResult{}
+	var file []api.LogSegment
+	for _, s := range segs {
+		if s.File != name {
+			continue
+		}
+		if s.Offset == 0 {
+			res.Rotated += len(file)
+			file = file[:0]
+		}
+		file = append(file, s)
+	}
+
+	var end uint64
+	for _, s := range file {
+		if e := s.Offset + s.Length; e > end {
+			end = e
+		}
+		if s.Offset+s.Length > size {
+			res.Mismatched = append(res.Mismatched, s)
+			continue
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r, int64(s.Offset), int64(s.Length))); err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+		if !bytes.Equal(h.Sum(nil), s.Hash) {
+			res.Mismatched = append(res.Mismatched, s)
+			continue
+		}
+		res.Verified = append(res.Verified, s)
+	}
+	if size > end {
+		res.Unrecorded = size - end
+	}
+	return res, nil
+}
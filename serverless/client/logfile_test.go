@@ -0,0 +1,74 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestVerifyLogFile(t *testing.T) {
+	segment := func(file string, offset uint64, s string) api.LogSegment {
+		h := sha256.Sum256([]byte(s))
+		return api.LogSegment{Host: "host1", File: file, Offset: offset, Length: uint64(len(s)), Hash: h[:]}
+	}
+	old := segment("syslog", 0, "old line\n")
+	first := segment("syslog", 0, "line 1\nline 2\n")
+	second := segment("syslog", 14, "line 3\n")
+	other := segment("auth.log", 0, "login\n")
+	segs := []api.LogSegment{old, segment("syslog", 9, "old line 2\n"), first, other, second}
+
+	for _, test := range []struct {
+		desc     string
+		contents string
+		want     LogFileResult
+	}{
+		{
+			desc:     "intact",
+			contents: "line 1\nline 2\nline 3\n",
+			want:     LogFileResult{Verified: []api.LogSegment{first, second}, Rotated: 2},
+		}, {
+			desc:     "unrecorded lines",
+			contents: "line 1\nline 2\nline 3\nline 4\n",
+			want:     LogFileResult{Verified: []api.LogSegment{first, second}, Rotated: 2, Unrecorded: 7},
+		}, {
+			desc:     "altered line",
+			contents: "line 1\nline X\nline 3\n",
+			want:     LogFileResult{Verified: []api.LogSegment{second}, Mismatched: []api.LogSegment{first}, Rotated: 2},
+		}, {
+			desc:     "truncated",
+			contents: "line 1\nline 2\n",
+			want:     LogFileResult{Verified: []api.LogSegment{first}, Mismatched: []api.LogSegment{second}, Rotated: 2},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := VerifyLogFile(segs, "syslog", strings.NewReader(test.contents), uint64(len(test.contents)))
+			if err != nil {
+				t.Fatalf("VerifyLogFile: %v", err)
+			}
+			if diff := cmp.Diff(&test.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("VerifyLogFile had diff (-want +got):\n%s", diff)
+			}
+			if got.OK() != test.want.OK() {
+				t.Errorf("OK = %t, want %t", got.OK(), test.want.OK())
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// OpenLogList verifies the maintainer's signature on a raw log list, and
+// parses it. The list must have the given name.
+func OpenLogList(raw []byte, v note.Verifier, name string) (*api.LogList, error) {
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log list: %w", err)
+	}
+	l, err := api.ParseLogList([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse log list: %w", err)
+	}
+	if l.Name != name {
+		return nil, fmt.Errorf("log list has name %q, want %q", l.Name, name)
+	}
+	return l, nil
+}
+
+// LogVerifiers returns the verifiers of the log described by e, and of the
+// witnesses trusted to cosign its checkpoints.
+func LogVerifiers(e api.LogListEntry) (note.Verifier, []note.Verifier, error) {
+	v, err := i_note.NewVerifierForKey(e.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid key for log %q: %w", e.Origin, err)
+	}
+	ws := make([]note.Verifier, 0, len(e.Witnesses))
+	for _, k := range e.Witnesses {
+		w, err := i_note.NewVerifierForKey(k)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid witness key for log %q: %w", e.Origin, err)
+		}
+		ws = append(ws, w)
+	}
+	return v, ws, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestOpenLogList(t *testing.T) {
+	listK, logK, witnessK := newTestKey(t, "list"), newTestKey(t, "log"), newTestKey(t, "witness")
+	l := api.LogList{
+		Name: "My List",
+		Logs: []api.LogListEntry{{
+			Origin:        "Log A",
+			URL:           "https://a.example.com/",
+			PublicKey:     logK.pub,
+			Witnesses:     []string{witnessK.pub},
+			WitnessQuorum: 1,
+			Distributors:  []string{"https://d.example.com/"},
+		}},
+	}
+	raw := listK.sign(t, string(l.Marshal()))
+
+	got, err := OpenLogList(raw, listK.v, "My List")
+	if err != nil {
+		t.Fatalf("OpenLogList: %v", err)
+	}
+	e := got.Find("Log A")
+	if e == nil {
+		t.Fatal("Log A isn't in the list")
+	}
+	v, ws, err := LogVerifiers(*e)
+	if err != nil {
+		t.Fatalf("LogVerifiers: %v", err)
+	}
+	if v.Name() != "log" || len(ws) != 1 || ws[0].Name() != "witness" {
+		t.Errorf("LogVerifiers = %q, %v, want log and one witness", v.Name(), ws)
+	}
+
+	if _, err := OpenLogList(raw, listK.v, "Other List"); err == nil {
+		t.Error("OpenLogList with the wrong name succeeded")
+	}
+	if _, err := OpenLogList(raw, logK.v, "My List"); err == nil {
+		t.Error("OpenLogList with the wrong key succeeded")
+	}
+	e.PublicKey = "bad key"
+	if _, _, err := LogVerifiers(*e); err == nil {
+		t.Error("LogVerifiers with a bad key succeeded")
+	}
+}
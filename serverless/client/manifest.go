@@ -0,0 +1,173 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// FetchManifest retrieves and opens the manifest of the log.
+// Logs which have never published a manifest are active, so if there is no
+// manifest a default one describing an active log is returned.
+func FetchManifest(ctx context.Context, f Fetcher, v note.Verifier, origin string) (*api.Manifest, error) {
+	raw, err := f(ctx, layout.ManifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &api.Manifest{Origin: origin, State: api.StateActive}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	return OpenManifest(raw, v, origin)
+}
+
+// OpenManifest verifies the log's signature on a raw manifest, and parses it.
+func OpenManifest(raw []byte, v note.Verifier, origin string) (*api.Manifest, error) {
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	m, err := api.ParseManifest([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.Origin != origin {
+		return nil, fmt.Errorf("manifest has origin %q, want %q", m.Origin, origin)
+	}
+	return m, nil
+}
+
+// maxChainLength bounds the number of logs FollowSuccessors will visit.
+const maxChainLength = 1000
+
+// LinkedLog is one of a chain of logs, each of which succeeded the previous
+// one when it was closed.
+type LinkedLog struct {
+	// Root is the URL of the root of the log.
+	Root *url.URL
+	// Fetcher retrieves files from the log.
+	Fetcher Fetcher
+	// Verifier verifies the log's signatures.
+	Verifier note.Verifier
+	// Manifest is the log's verified manifest.
+	Manifest *api.Manifest
+}
+
+// FollowSuccessors returns the chain of logs starting with the log at root,
+// and following successor links in manifests until a log which hasn't been
+// closed is found. newFetcher is used to create fetchers for successor logs.
+//
+// The links between each log and its successor are verified as described
+// for FetchSuccessor.
+func FollowSuccessors(ctx context.Context, root *url.URL, f Fetcher, v note.Verifier, origin string, newFetcher func(*url.URL) (Fetcher, error)) ([]LinkedLog, error) {
+	m, err := FetchManifest(ctx, f, v, origin)
+	if err != nil {
+		return nil, err
+	}
+	chain := []LinkedLog{{Root: root, Fetcher: f, Verifier: v, Manifest: m}}
+	seen := map[string]bool{origin: true}
+	for {
+		next, err := FetchSuccessor(ctx, chain[len(chain)-1], newFetcher)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return chain, nil
+		}
+		if o := next.Manifest.Origin; seen[o] {
+			return nil, fmt.Errorf("log %q appears twice in the chain of successors", o)
+		}
+		seen[next.Manifest.Origin] = true
+		if len(chain) == maxChainLength {
+			return nil, fmt.Errorf("chain of successors is longer than %d logs", maxChainLength)
+		}
+		chain = append(chain, *next)
+	}
+}
+
+// FetchSuccessor returns the log which succeeded l, or nil if l hasn't been
+// succeeded by another log.
+//
+// Both logs must agree on the link between them: l's published checkpoint
+// must be the final checkpoint named in its manifest, and the successor's
+// manifest must name l, with its key and final checkpoint, as its
+// predecessor.
+func FetchSuccessor(ctx context.Context, l LinkedLog, newFetcher func(*url.URL) (Fetcher, error)) (*LinkedLog, error) {
+	m := l.Manifest
+	link := m.Successor
+	if link == nil {
+		return nil, nil
+	}
+	if m.Final == nil {
+		return nil, fmt.Errorf("log %q has a successor but no final checkpoint", m.Origin)
+	}
+	cp, _, _, err := FetchCheckpoint(ctx, l.Fetcher, l.Verifier, m.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint of log %q: %w", m.Origin, err)
+	}
+	if cp.Size != m.Final.Size || !bytes.Equal(cp.Hash, m.Final.Hash) {
+		return nil, fmt.Errorf("log %q has checkpoint of size %d, but its final checkpoint has size %d", m.Origin, cp.Size, m.Final.Size)
+	}
+
+	if len(link.URL) == 0 {
+		return nil, fmt.Errorf("successor %q of log %q has no URL", link.Origin, m.Origin)
+	}
+	ref, err := url.Parse(link.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid successor URL %q: %w", link.URL, err)
+	}
+	root := l.Root.ResolveReference(ref)
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+	}
+	sf, err := newFetcher(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fetcher for successor at %q: %w", root, err)
+	}
+	sv, err := i_note.NewVerifierForKey(link.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid successor key: %w", err)
+	}
+	sm, err := FetchManifest(ctx, sf, sv, link.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest of successor %q: %w", link.Origin, err)
+	}
+
+	p := sm.Predecessor
+	if p == nil || p.Origin != m.Origin {
+		return nil, fmt.Errorf("successor %q doesn't name log %q as its predecessor", link.Origin, m.Origin)
+	}
+	pv, err := i_note.NewVerifierForKey(p.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid predecessor key in successor %q: %w", link.Origin, err)
+	}
+	if pv.Name() != l.Verifier.Name() || pv.KeyHash() != l.Verifier.KeyHash() {
+		return nil, fmt.Errorf("successor %q names a different key for log %q", link.Origin, m.Origin)
+	}
+	if p.Final.Size != m.Final.Size || !bytes.Equal(p.Final.Hash, m.Final.Hash) {
+		return nil, fmt.Errorf("successor %q disagrees about the final checkpoint of log %q", link.Origin, m.Origin)
+	}
+	return &LinkedLog{Root: root, Fetcher: sf, Verifier: sv, Manifest: sm}, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// testKey is a note signing key pair for use in tests.
+type testKey struct {
+	s   note.Signer
+	v   note.Verifier
+	pub string
+}
+
+func newTestKey(t *testing.T, name string) testKey {
+	t.Helper()
+	sk, vk, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(sk)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vk)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	return testKey{s: s, v: v, pub: vk}
+}
+
+func (k testKey) sign(t *testing.T, text string) []byte {
+	t.Helper()
+	raw, err := note.Sign(&note.Note{Text: text}, k.s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return raw
+}
+
+func TestFetchManifest(t *testing.T) {
+	ctx := context.Background()
+	logK, otherK := newTestKey(t, "log"), newTestKey(t, "other")
+	logV := logK.v
+	frozen := "Serverless Log Manifest v0\norigin\nstate frozen\nreason maintenance\n"
+
+	for _, test := range []struct {
+		desc    string
+		raw     []byte
+		want    *api.Manifest
+		wantErr bool
+	}{
+		{
+			desc: "missing manifest means active",
+			want: &api.Manifest{Origin: "origin", State: api.StateActive},
+		}, {
+			desc: "frozen",
+			raw:  logK.sign(t, frozen),
+			want: &api.Manifest{Origin: "origin", State: api.StateFrozen, Reason: "maintenance"},
+		}, {
+			desc:    "wrong signer",
+			raw:     otherK.sign(t, frozen),
+			wantErr: true,
+		}, {
+			desc:    "wrong origin",
+			raw:     logK.sign(t, "Serverless Log Manifest v0\nbanana\nstate frozen\n"),
+			wantErr: true,
+		}, {
+			desc:    "invalid manifest",
+			raw:     logK.sign(t, "banana\n"),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f := func(_ context.Context, p string) ([]byte, error) {
+				if p != layout.ManifestPath {
+					return nil, fmt.Errorf("unexpected fetch of %q", p)
+				}
+				if test.raw == nil {
+					return nil, os.ErrNotExist
+				}
+				return test.raw, nil
+			}
+			m, err := FetchManifest(ctx, f, logV, "origin")
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("FetchManifest: got err %v, want err %t", err, test.wantErr)
+			}
+			if test.want != nil {
+				if diff := cmp.Diff(m, test.want); len(diff) != 0 {
+					t.Errorf("FetchManifest had diff %s", diff)
+				}
+			}
+		})
+	}
+
+	// Other fetch errors must not be mistaken for a missing manifest.
+	f := func(context.Context, string) ([]byte, error) { return nil, errors.New("network down") }
+	if _, err := FetchManifest(ctx, f, logV, "origin"); err == nil {
+		t.Error("FetchManifest succeeded with failing fetcher, want error")
+	}
+}
+
+func TestFollowSuccessors(t *testing.T) {
+	ctx := context.Background()
+	keys := []testKey{newTestKey(t, "log0"), newTestKey(t, "log1"), newTestKey(t, "log2")}
+	origins := []string{"log0", "log1", "log2"}
+	finals := []*api.CheckpointRef{
+		{Size: 3, Hash: rfc6962.DefaultHasher.HashLeaf([]byte("zero"))},
+		{Size: 5, Hash: rfc6962.DefaultHasher.HashLeaf([]byte("one"))},
+	}
+	root, err := url.Parse("https://example.com/logs/log0/")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	// files holds the contents of the logs, keyed by URL.
+	type tamperFunc func(files map[string][]byte)
+	build := func(tamper tamperFunc) map[string][]byte {
+		files := make(map[string][]byte)
+		for i, o := range origins {
+			base := fmt.Sprintf("https://example.com/logs/%s/", o)
+			m := api.Manifest{Origin: o, State: api.StateActive}
+			cp := log.Checkpoint{Origin: o, Size: 7, Hash: rfc6962.DefaultHasher.EmptyRoot()}
+			if i < len(finals) {
+				m.State = api.StateReadOnly
+				m.Final = finals[i]
+				m.Successor = &api.LogLink{Origin: origins[i+1], PublicKey: keys[i+1].pub, URL: "../" + origins[i+1]}
+				cp.Size, cp.Hash = finals[i].Size, finals[i].Hash
+			}
+			if i > 0 {
+				m.Predecessor = &api.LogLink{Origin: origins[i-1], PublicKey: keys[i-1].pub, Final: finals[i-1]}
+			}
+			files[base+layout.ManifestPath] = keys[i].sign(t, string(m.Marshal()))
+			files[base+layout.CheckpointPath] = keys[i].sign(t, string(cp.Marshal()))
+		}
+		if tamper != nil {
+			tamper(files)
+		}
+		return files
+	}
+	rewrite := func(i int, f func(*api.Manifest)) tamperFunc {
+		return func(files map[string][]byte) {
+			p := fmt.Sprintf("https://example.com/logs/%s/%s", origins[i], layout.ManifestPath)
+			m, err := OpenManifest(files[p], keys[i].v, origins[i])
+			if err != nil {
+				t.Fatalf("OpenManifest: %v", err)
+			}
+			f(m)
+			files[p] = keys[i].sign(t, string(m.Marshal()))
+		}
+	}
+
+	for _, test := range []struct {
+		desc    string
+		tamper  tamperFunc
+		wantErr bool
+	}{
+		{
+			desc: "valid chain",
+		}, {
+			desc: "successor doesn't link back",
+			tamper: rewrite(1, func(m *api.Manifest) {
+				m.Predecessor = nil
+			}),
+			wantErr: true,
+		}, {
+			desc: "successor disagrees about final checkpoint",
+			tamper: rewrite(1, func(m *api.Manifest) {
+				m.Predecessor.Final = finals[1]
+			}),
+			wantErr: true,
+		}, {
+			desc: "successor names wrong predecessor key",
+			tamper: rewrite(2, func(m *api.Manifest) {
+				m.Predecessor.PublicKey = keys[0].pub
+			}),
+			wantErr: true,
+		}, {
+			desc: "checkpoint grew after close",
+			tamper: func(files map[string][]byte) {
+				cp := log.Checkpoint{Origin: origins[0], Size: 4, Hash: finals[0].Hash}
+				files["https://example.com/logs/log0/"+layout.CheckpointPath] = keys[0].sign(t, string(cp.Marshal()))
+			},
+			wantErr: true,
+		}, {
+			desc: "successor missing",
+			tamper: func(files map[string][]byte) {
+				delete(files, "https://example.com/logs/log2/"+layout.ManifestPath)
+			},
+			wantErr: true,
+		}, {
+			desc: "successor without URL",
+			tamper: rewrite(0, func(m *api.Manifest) {
+				m.Successor.URL = ""
+			}),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			files := build(test.tamper)
+			newFetcher := func(u *url.URL) (Fetcher, error) {
+				return func(_ context.Context, p string) ([]byte, error) {
+					b, ok := files[u.String()+p]
+					if !ok {
+						return nil, os.ErrNotExist
+					}
+					return b, nil
+				}, nil
+			}
+			f, _ := newFetcher(root)
+			chain, err := FollowSuccessors(ctx, root, f, keys[0].v, origins[0], newFetcher)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("FollowSuccessors: got err %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(chain) != len(origins) {
+				t.Fatalf("Got chain of %d logs, want %d", len(chain), len(origins))
+			}
+			for i, l := range chain {
+				if got, want := l.Manifest.Origin, origins[i]; got != want {
+					t.Errorf("Log %d has origin %q, want %q", i, got, want)
+				}
+				if got, want := l.Root.String(), fmt.Sprintf("https://example.com/logs/%s/", origins[i]); got != want {
+					t.Errorf("Log %d has root %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
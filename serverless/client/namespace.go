@@ -0,0 +1,78 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// FetchNamespaces retrieves and opens the registry of identifier namespaces
+// of the log. If the log has never published one, no namespaces are
+// registered, so an empty registry is returned.
+func FetchNamespaces(ctx context.Context, f Fetcher, v note.Verifier, origin string) (*api.Namespaces, error) {
+	raw, err := f(ctx, layout.NamespacesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &api.Namespaces{Origin: origin, Owners: map[string]api.NamespaceOwner{}}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch namespace registry: %w", err)
+	}
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open namespace registry: %w", err)
+	}
+	ns, err := api.ParseNamespaces([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse namespace registry: %w", err)
+	}
+	if ns.Origin != origin {
+		return nil, fmt.Errorf("namespace registry has origin %q, want %q", ns.Origin, origin)
+	}
+	return ns, nil
+}
+
+// VerifyIdentifiers fetches the identifiers associated with the entry at index
+// seq with leaf hash lh, along with the claim to them if there is one, and
+// checks it against the registry ns as it applied to the entry, so that
+// auditors can confirm that no identifier in a registered namespace was used
+// without its owner's consent. It returns the identifiers, or none if the
+// entry has no identifiers.
+func VerifyIdentifiers(ctx context.Context, f Fetcher, ns *api.Namespaces, seq uint64, lh []byte) ([]string, error) {
+	raw, err := f(ctx, path.Join(layout.IdentifiersPath("", lh)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch identifiers: %w", err)
+	}
+	ids, err := api.ParseIdentifiers(raw)
+	if err != nil {
+		return nil, err
+	}
+	claim, err := f(ctx, path.Join(layout.ClaimPath("", lh)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to fetch claim: %w", err)
+	}
+	if err := ns.At(seq).VerifyClaim(lh, ids, claim); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
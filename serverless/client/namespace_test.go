@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerifyIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	ns := &api.Namespaces{Origin: "My Log", Owners: map[string]api.NamespaceOwner{"example.com": {Key: vkey, Since: 2}}}
+
+	files := make(map[string][]byte)
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+	add := func(leaf string, ids []string, signed bool) []byte {
+		t.Helper()
+		lh := h.HashLeaf([]byte(leaf))
+		files[path.Join(layout.IdentifiersPath("", lh))] = api.MarshalIdentifiers(ids)
+		if signed {
+			c := api.Claim{Origin: ns.Origin, LeafHash: lh, Identifiers: ids}
+			raw, err := note.Sign(&note.Note{Text: string(c.Marshal())}, s)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			files[path.Join(layout.ClaimPath("", lh))] = raw
+		}
+		return lh
+	}
+	early := add("early", []string{"example.com/pkg"}, false)
+	claimed := add("claimed", []string{"example.com/pkg", "docs"}, true)
+	unclaimed := add("unclaimed", []string{"example.com/pkg"}, false)
+	free := add("free", []string{"docs"}, false)
+
+	for _, test := range []struct {
+		desc    string
+		seq     uint64
+		lh      []byte
+		want    []string
+		wantErr bool
+	}{
+		{desc: "before registration", seq: 1, lh: early, want: []string{"example.com/pkg"}},
+		{desc: "claimed", seq: 2, lh: claimed, want: []string{"example.com/pkg", "docs"}},
+		{desc: "unclaimed", seq: 3, lh: unclaimed, wantErr: true},
+		{desc: "unregistered namespace", seq: 4, lh: free, want: []string{"docs"}},
+		{desc: "no identifiers", seq: 5, lh: h.HashLeaf([]byte("none"))},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := VerifyIdentifiers(ctx, f, ns, test.seq, test.lh)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyIdentifiers: %v, want error %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("VerifyIdentifiers had diff %s", diff)
+			}
+		})
+	}
+}
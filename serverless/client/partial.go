@@ -0,0 +1,131 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+	"golang.org/x/sync/errgroup"
+)
+
+// DerivePartialTile computes the partial tile at the given level and index
+// with n leaves, for logs which don't store their partial tiles, as described
+// by api.PartialTilesDerived. The leaves of a tile on level 0 are the hashes
+// of the log's entries, taken from the tombstones of redacted entries, and
+// those of a tile on a higher level are the root hashes of the full tiles
+// below it, which are read from f.
+//
+// The tile is built from whatever f returns, so like any other tile it must
+// be verified, e.g. by checking the root hash of a tree built from it.
+func DerivePartialTile(ctx context.Context, h merkle.LogHasher, f Fetcher, level, index, n uint64) (*api.Tile, error) {
+	if n == 0 || n >= api.TileWidth {
+		return nil, fmt.Errorf("partial tile can't have %d leaves", n)
+	}
+	leaves := make([][]byte, n)
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultFetchConcurrency)
+	for i := uint64(0); i < n; i++ {
+		i := i
+		g.Go(func() error {
+			if level == 0 {
+				e, r, err := getLeaf(ctx, f, index*api.TileWidth+i)
+				if err != nil {
+					return err
+				}
+				if r != nil {
+					// Redacted entries are still in the tree.
+					leaves[i] = r.LeafHash
+					return nil
+				}
+				leaves[i] = h.HashLeaf(e)
+				return nil
+			}
+			p := path.Join(layout.TilePath("", level-1, index*api.TileWidth+i, 0))
+			raw, err := f(ctx, p)
+			if err != nil {
+				return fmt.Errorf("failed to read tile at %q: %w", p, err)
+			}
+			t, err := api.ParseTile(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse tile at %q: %w", p, err)
+			}
+			if leaves[i], err = tileRoot(h, t); err != nil {
+				return fmt.Errorf("tile at %q: %w", p, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	t := &api.Tile{NumLeaves: uint(n), Nodes: make([][]byte, 0, 2*n)}
+	r := (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0)
+	visit := func(id compact.NodeID, hash []byte) {
+		idx := api.TileNodeKey(id.Level, id.Index)
+		if l := uint(len(t.Nodes)); idx >= l {
+			t.Nodes = append(t.Nodes, make([][]byte, idx-l+1)...)
+		}
+		t.Nodes[idx] = hash
+	}
+	for _, l := range leaves {
+		if err := r.Append(l, visit); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// tileRoot returns the root hash of the full tile t, which is the hash of
+// the two nodes on its top level.
+func tileRoot(h merkle.LogHasher, t *api.Tile) ([]byte, error) {
+	l, r := api.TileNodeKey(7, 0), api.TileNodeKey(7, 1)
+	if t.NumLeaves != api.TileWidth || uint(len(t.Nodes)) <= r || len(t.Nodes[l]) == 0 || len(t.Nodes[r]) == 0 {
+		return nil, errors.New("not a full tile")
+	}
+	return h.HashChildren(t.Nodes[l], t.Nodes[r]), nil
+}
+
+// DerivingFetcher returns a Fetcher which reads from f, but derives partial
+// tiles which f doesn't have with DerivePartialTile, so that logs which don't
+// store their partial tiles can be read like any other. If the tile can't be
+// derived because what it's derived from doesn't exist either, the error
+// wraps os.ErrNotExist. Tiles derived from bad data fail verification in the
+// same way as bad tiles read from f.
+func DerivingFetcher(f Fetcher, h merkle.LogHasher) Fetcher {
+	return func(ctx context.Context, p string) ([]byte, error) {
+		raw, err := f(ctx, p)
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			return raw, err
+		}
+		level, index, n, perr := layout.ParseTilePath(p)
+		if perr != nil || n == 0 {
+			return nil, err
+		}
+		t, err := DerivePartialTile(ctx, h, f, level, index, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive partial tile %q: %w", p, err)
+		}
+		return t.MarshalText()
+	}
+}
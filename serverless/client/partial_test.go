@@ -0,0 +1,108 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestDerivePartialTile(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	f := func(_ context.Context, p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	for n := uint64(1); n <= 15; n++ {
+		raw, err := f(ctx, path.Join(layout.TilePath("", 0, 0, n)))
+		if err != nil {
+			t.Fatalf("Failed to read stored tile: %v", err)
+		}
+		want, err := api.ParseTile(raw)
+		if err != nil {
+			t.Fatalf("ParseTile: %v", err)
+		}
+		got, err := DerivePartialTile(ctx, h, f, 0, 0, n)
+		if err != nil {
+			t.Fatalf("DerivePartialTile(%d): %v", n, err)
+		}
+		// Parsed tiles have empty rather than nil missing nodes.
+		if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("DerivePartialTile(%d) differs from stored tile (-want +got):\n%s", n, diff)
+		}
+	}
+
+	for _, n := range []uint64{0, api.TileWidth} {
+		if _, err := DerivePartialTile(ctx, h, f, 0, 0, n); err == nil {
+			t.Errorf("DerivePartialTile(%d) succeeded", n)
+		}
+	}
+	if _, err := DerivePartialTile(ctx, h, f, 0, 0, 16); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DerivePartialTile beyond log = %v, want not exists error", err)
+	}
+	if _, err := DerivePartialTile(ctx, h, f, 1, 0, 1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DerivePartialTile without full tile below = %v, want not exists error", err)
+	}
+}
+
+func TestDerivingFetcher(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	// The log's partial tiles are hidden, as if it didn't store them.
+	f := func(_ context.Context, p string) ([]byte, error) {
+		if _, _, n, err := layout.ParseTilePath(p); err == nil && n > 0 {
+			return nil, fmt.Errorf("hidden %q: %w", p, os.ErrNotExist)
+		}
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	df := DerivingFetcher(f, h)
+	latest := testCheckpoints[len(testCheckpoints)-1]
+	pb, err := NewProofBuilder(ctx, latest, h.HashChildren, df)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+	for i := uint64(0); i < latest.Size; i++ {
+		leaf, err := GetLeaf(ctx, df, i)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		p, err := pb.InclusionProof(ctx, i)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d): %v", i, err)
+		}
+		if err := proof.VerifyInclusion(h, i, latest.Size, h.HashLeaf(leaf), p, latest.Hash); err != nil {
+			t.Errorf("Inclusion proof for %d doesn't verify: %v", i, err)
+		}
+	}
+
+	if _, err := df(ctx, path.Join(layout.TilePath("", 0, 0, 20))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Fetching underivable tile = %v, want not exists error", err)
+	}
+	if _, err := df(ctx, layout.CheckpointPath+".missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Fetching missing file = %v, want not exists error", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// ErrRedacted is returned (wrapped) when the contents of a leaf have been
+// withheld by the log, which serves a tombstone in their place.
+var ErrRedacted = errors.New("leaf redacted")
+
+// FetchTombstone fetches the tombstone served in place of the withheld
+// contents of the leaf at index idx, returning the redaction record it holds
+// along with the raw tombstone. The tombstone's signature isn't verified, so
+// the record should only be trusted as far as its leaf hash is verified to be
+// in the log. FetchRedaction verifies it fully. An error wrapping
+// os.ErrNotExist is returned if the leaf has no tombstone.
+func FetchTombstone(ctx context.Context, f Fetcher, idx uint64) (*api.Redaction, []byte, error) {
+	p := path.Join(layout.TombstonePath("", idx))
+	raw, err := f(ctx, p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch tombstone of leaf index %d: %w", idx, err)
+	}
+	// Opening the note without any verifiers fails, but still parses it.
+	_, err = note.Open(raw, note.VerifierList())
+	var unverified *note.UnverifiedNoteError
+	if !errors.As(err, &unverified) {
+		return nil, nil, fmt.Errorf("invalid tombstone of leaf index %d: %v", idx, err)
+	}
+	r, err := parseRedaction(unverified.Note, idx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, raw, nil
+}
+
+// FetchRedaction retrieves the redaction record of the leaf at index idx of
+// the log with the given origin, whose contents the log has withheld. The
+// record's tombstone must be signed by v, and must be listed in the log's
+// redaction log, which is verified against its latest checkpoint, signed by v
+// with the origin api.RedactionsOrigin(origin). An error wrapping
+// os.ErrNotExist is returned if the leaf hasn't been redacted.
+//
+// The caller should separately verify that the record's leaf hash is in the
+// log, e.g. with VerifyInclusion.
+func FetchRedaction(ctx context.Context, f Fetcher, h merkle.LogHasher, v note.Verifier, origin string, idx uint64) (*api.Redaction, error) {
+	_, raw, err := FetchTombstone(ctx, f, idx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify tombstone of leaf index %d: %w", idx, err)
+	}
+	r, err := parseRedaction(n, idx)
+	if err != nil {
+		return nil, err
+	}
+	if r.Origin != origin {
+		return nil, fmt.Errorf("tombstone of leaf index %d has origin %q, want %q", idx, r.Origin, origin)
+	}
+
+	// A redaction is only legitimate if it's public.
+	rf := ShardFetcher(f, layout.RedactionsDir)
+	cp, _, _, err := FetchCheckpoint(ctx, rf, v, api.RedactionsOrigin(origin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch redaction log checkpoint: %w", err)
+	}
+	lh := h.HashLeaf(raw)
+	i, err := LookupIndex(ctx, rf, lh)
+	if err != nil {
+		return nil, fmt.Errorf("redaction of leaf index %d isn't in the redaction log: %w", idx, err)
+	}
+	if _, err := VerifyInclusion(ctx, rf, h, *cp, i, lh); err != nil {
+		return nil, fmt.Errorf("failed to verify inclusion of redaction of leaf index %d in the redaction log: %w", idx, err)
+	}
+	return r, nil
+}
+
+// parseRedaction parses the redaction record in the tombstone n of the leaf
+// at index idx.
+func parseRedaction(n *note.Note, idx uint64) (*api.Redaction, error) {
+	r, err := api.ParseRedaction([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tombstone of leaf index %d: %w", idx, err)
+	}
+	if r.Index != idx {
+		return nil, fmt.Errorf("tombstone of leaf index %d is for index %d", idx, r.Index)
+	}
+	return r, nil
+}
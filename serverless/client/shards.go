@@ -0,0 +1,95 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
+)
+
+// FetchShardIndex retrieves and opens the shard index from the root of a
+// sharded log.
+func FetchShardIndex(ctx context.Context, f Fetcher, v note.Verifier, origin string) (*api.ShardIndex, error) {
+	raw, err := f(ctx, layout.ShardsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch shard index: %w", err)
+	}
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shard index: %w", err)
+	}
+	i, err := api.ParseShardIndex([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse shard index: %w", err)
+	}
+	if i.Origin != origin {
+		return nil, fmt.Errorf("shard index has origin %q, want %q", i.Origin, origin)
+	}
+	return i, nil
+}
+
+// ShardFetcher returns a Fetcher for the named shard of the sharded log read
+// by f.
+func ShardFetcher(f Fetcher, shard string) Fetcher {
+	return func(ctx context.Context, p string) ([]byte, error) {
+		return f(ctx, path.Join(shard, p))
+	}
+}
+
+// ShardMatch identifies an entry in a shard of a sharded log.
+type ShardMatch struct {
+	Shard string
+	Index uint64
+}
+
+// LookupShards looks up the entry with leaf hash lh in every shard of a
+// sharded log, and returns its locations in the order the shards appear in
+// the index. Shards are searched concurrently.
+func LookupShards(ctx context.Context, f Fetcher, idx *api.ShardIndex, lh []byte) ([]ShardMatch, error) {
+	found := make([]*ShardMatch, len(idx.Shards))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultFetchConcurrency)
+	for i, s := range idx.Shards {
+		i, s := i, s
+		g.Go(func() error {
+			seq, err := LookupIndex(gctx, ShardFetcher(f, s), lh)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("shard %q: %w", s, err)
+			}
+			found[i] = &ShardMatch{Shard: s, Index: seq}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var ret []ShardMatch
+	for _, m := range found {
+		if m != nil {
+			ret = append(ret, *m)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestLookupShards(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKey(t, "log")
+	idx := api.ShardIndex{Origin: "My Log", Shards: []string{"2022", "2023-q1", "2023-q2"}}
+	lh := rfc6962.DefaultHasher.HashLeaf([]byte("banana"))
+	leafFile := path.Join(layout.LeafPath("", lh))
+	files := map[string][]byte{
+		layout.ShardsPath:              k.sign(t, string(idx.Marshal())),
+		path.Join("2022", leafFile):    api.MarshalLeafIndex(7),
+		path.Join("2023-q2", leafFile): api.MarshalLeafIndex(1),
+	}
+	var failShard string
+	f := func(_ context.Context, p string) ([]byte, error) {
+		if len(failShard) > 0 && strings.HasPrefix(p, failShard+"/") {
+			return nil, errors.New("storage unavailable")
+		}
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+
+	gotIdx, err := FetchShardIndex(ctx, f, k.v, "My Log")
+	if err != nil {
+		t.Fatalf("FetchShardIndex: %v", err)
+	}
+	if diff := cmp.Diff(gotIdx, &idx); len(diff) != 0 {
+		t.Errorf("FetchShardIndex had diff %s", diff)
+	}
+	if _, err := FetchShardIndex(ctx, f, k.v, "Other Log"); err == nil {
+		t.Error("FetchShardIndex with wrong origin succeeded, want error")
+	}
+
+	got, err := LookupShards(ctx, f, gotIdx, lh)
+	if err != nil {
+		t.Fatalf("LookupShards: %v", err)
+	}
+	want := []ShardMatch{{Shard: "2022", Index: 7}, {Shard: "2023-q2", Index: 1}}
+	if diff := cmp.Diff(got, want); len(diff) != 0 {
+		t.Errorf("LookupShards had diff %s", diff)
+	}
+
+	if got, err := LookupShards(ctx, f, gotIdx, rfc6962.DefaultHasher.HashLeaf([]byte("apple"))); err != nil || len(got) != 0 {
+		t.Errorf("LookupShards for unknown leaf = %v, %v, want no matches", got, err)
+	}
+
+	// Failures other than the leaf being absent from a shard must be reported.
+	failShard = "2023-q1"
+	if _, err := LookupShards(ctx, f, gotIdx, lh); err == nil {
+		t.Error("LookupShards with failing shard succeeded, want error")
+	}
+}
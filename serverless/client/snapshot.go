@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+// SnapshotFetcher returns a Fetcher which reads the log through f as of the
+// tree of the size returned by size, typically that of the latest checkpoint
+// the caller has verified.
+//
+// Writers publish a checkpoint only after the data it commits to, as
+// described by the layout package, so a reader may see data beyond its
+// checkpoint while an integration is in progress. Through the returned
+// Fetcher:
+//
+//   - entries at or beyond size don't exist.
+//   - tiles are trimmed to their nodes in the tree of that size, and tiles
+//     entirely beyond it don't exist.
+//   - leaf hashes don't map to entries at or beyond size.
+//
+// Reads of anything else are passed through to f.
+func SnapshotFetcher(f Fetcher, size func() uint64) Fetcher {
+	return func(ctx context.Context, p string) ([]byte, error) {
+		s := size()
+		switch {
+		case strings.HasPrefix(p, "seq/"):
+			if seq, err := layout.SeqFromPath("", p); err == nil && seq >= s {
+				return nil, fmt.Errorf("entry %d is beyond the tree of size %d: %w", seq, s, os.ErrNotExist)
+			}
+		case strings.HasPrefix(p, "tile/"):
+			level, index, _, err := layout.ParseTilePath(p)
+			if err != nil {
+				break
+			}
+			sizeAtLevel := s >> (level * 8)
+			if index*api.TileWidth >= sizeAtLevel {
+				return nil, fmt.Errorf("tile %q is beyond the tree of size %d: %w", p, s, os.ErrNotExist)
+			}
+			return snapshotTile(ctx, f, p, sizeAtLevel-index*api.TileWidth)
+		case strings.HasPrefix(p, "leaves/") && !strings.HasPrefix(p, "leaves/pending/"):
+			raw, err := f(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			if seq, err := api.ParseLeafIndex(raw); err == nil && seq >= s {
+				return nil, fmt.Errorf("leaf %q is at index %d, beyond the tree of size %d: %w", p, seq, s, os.ErrNotExist)
+			}
+			return raw, nil
+		}
+		return f(ctx, p)
+	}
+}
+
+// snapshotTile fetches the tile at p, trimming it to its first n leaves if it
+// has more.
+func snapshotTile(ctx context.Context, f Fetcher, p string, n uint64) ([]byte, error) {
+	raw, err := f(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if n >= api.TileWidth {
+		return raw, nil
+	}
+	t, err := api.ParseTile(raw)
+	if err != nil || uint64(t.NumLeaves) <= n {
+		// Leave checking the tile to the caller.
+		return raw, nil
+	}
+	return t.Trim(uint(n)).MarshalText()
+}
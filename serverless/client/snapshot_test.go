@@ -0,0 +1,102 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestSnapshotFetcher(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	cp := testCheckpoints[4]
+	// The log is read mid-integration: every level 0 tile request gets the
+	// tile of a larger tree, as if it had been extended ahead of cp.
+	f := func(_ context.Context, p string) ([]byte, error) {
+		if strings.HasPrefix(p, "tile/00/") {
+			p = "tile/00/0000/00/00/00.0f"
+		}
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	sf := SnapshotFetcher(f, func() uint64 { return cp.Size })
+
+	raw, err := sf(ctx, "tile/00/0000/00/00/00.05")
+	if err != nil {
+		t.Fatalf("Fetching tile: %v", err)
+	}
+	tile, err := api.ParseTile(raw)
+	if err != nil {
+		t.Fatalf("ParseTile: %v", err)
+	}
+	if tile.NumLeaves != uint(cp.Size) {
+		t.Errorf("Tile has %d leaves, want %d", tile.NumLeaves, cp.Size)
+	}
+	pb, err := NewProofBuilder(ctx, cp, h.HashChildren, sf)
+	if err != nil {
+		t.Fatalf("NewProofBuilder: %v", err)
+	}
+
+	leaf := func(i uint64) []byte {
+		t.Helper()
+		l, err := os.ReadFile(fmt.Sprintf("../testdata/log/seq/00/00/00/00/%02x", i))
+		if err != nil {
+			t.Fatalf("Failed to read leaf %d: %v", i, err)
+		}
+		return l
+	}
+	for i := uint64(0); i < cp.Size; i++ {
+		l, err := GetLeaf(ctx, sf, i)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		idx, err := LookupIndex(ctx, sf, h.HashLeaf(l))
+		if err != nil || idx != i {
+			t.Errorf("LookupIndex(leaf %d) = %d, %v", i, idx, err)
+		}
+		p, err := pb.InclusionProof(ctx, i)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d): %v", i, err)
+		}
+		if err := proof.VerifyInclusion(h, i, cp.Size, h.HashLeaf(l), p, cp.Hash); err != nil {
+			t.Errorf("VerifyInclusion(%d): %v", i, err)
+		}
+	}
+
+	// Data beyond the snapshot is there, but hidden.
+	if _, err := GetLeaf(ctx, f, cp.Size); err != nil {
+		t.Fatalf("GetLeaf(%d) without snapshot: %v", cp.Size, err)
+	}
+	if _, err := GetLeaf(ctx, sf, cp.Size); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetLeaf(%d) = %v, want not exist", cp.Size, err)
+	}
+	if _, err := LookupIndex(ctx, sf, h.HashLeaf(leaf(cp.Size+2))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LookupIndex(leaf %d) = %v, want not exist", cp.Size+2, err)
+	}
+	if _, err := sf(ctx, path.Join(layout.TilePath("", 0, 1, 0))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Fetching tile beyond snapshot = %v, want not exist", err)
+	}
+}
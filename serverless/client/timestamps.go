@@ -0,0 +1,93 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// FetchTimestamp retrieves the time at which the entry at index idx, with leaf
+// hash lh, was sequenced into the log with the given origin, from the log's
+// timestamp log. The record is verified to be committed to by the latest
+// checkpoint of the timestamp log, which must be signed by v and must have
+// the origin api.TimestampsOrigin(origin).
+//
+// The caller should separately verify that the entry itself is in the log.
+func FetchTimestamp(ctx context.Context, f Fetcher, h merkle.LogHasher, v note.Verifier, origin string, idx uint64, lh []byte) (*api.Timestamp, error) {
+	tf := ShardFetcher(f, layout.TimestampsDir)
+	cp, _, _, err := FetchCheckpoint(ctx, tf, v, api.TimestampsOrigin(origin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch timestamp log checkpoint: %w", err)
+	}
+	if idx >= cp.Size {
+		return nil, fmt.Errorf("entry %d isn't yet timestamped, timestamp log has size %d: %w", idx, cp.Size, ErrNotIntegrated)
+	}
+	l, err := FetchVerifiedLeaves(ctx, tf, h, *cp, idx, idx+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch timestamp of entry %d: %w", idx, err)
+	}
+	t, err := api.ParseTimestamp(l[0])
+	if err != nil {
+		return nil, err
+	}
+	if t.Index != idx || !bytes.Equal(t.LeafHash, lh) {
+		return nil, fmt.Errorf("timestamp is for entry %d with leaf hash %x, want entry %d with leaf hash %x", t.Index, t.LeafHash, idx, lh)
+	}
+	return t, nil
+}
+
+// FetchCheckpointTime retrieves the time at which cp was the latest checkpoint
+// of the log, from the api.CheckpointTime signed by the log's timestamping
+// key, which must verify with one of vs, e.g. both the old and new keys while
+// the key is rotated. That key is distinct from the one which signs
+// checkpoints, so vs should be configured separately from it.
+//
+// If the statement is about a checkpoint of a different size, e.g. because
+// the log has grown since cp was fetched, or the new checkpoint hasn't been
+// timestamped yet, an error wrapping ErrCheckpointStale is returned, and
+// fetching the checkpoint again may succeed. If it's about a different tree
+// of the same size, an error wrapping ErrInconsistentTree is returned.
+func FetchCheckpointTime(ctx context.Context, f Fetcher, vs note.Verifiers, cp log.Checkpoint) (time.Time, error) {
+	raw, err := f(ctx, layout.CheckpointTimePath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch checkpoint time: %w", err)
+	}
+	n, err := note.Open(raw, vs)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open checkpoint time: %w", err)
+	}
+	ct, err := api.ParseCheckpointTime([]byte(n.Text))
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case ct.Origin != cp.Origin:
+		return time.Time{}, fmt.Errorf("checkpoint time has origin %q, want %q", ct.Origin, cp.Origin)
+	case ct.Size != cp.Size:
+		return time.Time{}, fmt.Errorf("checkpoint time is for tree size %d, want %d: %w", ct.Size, cp.Size, ErrCheckpointStale)
+	case !bytes.Equal(ct.Hash, cp.Hash):
+		return time.Time{}, fmt.Errorf("checkpoint time is for root hash %x, but checkpoint of size %d has root hash %x: %w", ct.Hash, cp.Size, cp.Hash, ErrInconsistentTree)
+	}
+	return ct.Time, nil
+}
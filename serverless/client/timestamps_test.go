@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestFetchTimestamp(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	k := newTestKey(t, "log")
+	lh := h.HashLeaf([]byte("banana"))
+	ts := api.Timestamp{Index: 0, LeafHash: lh, Sequenced: time.Unix(1680000000, 5)}
+	r := ts.Marshal()
+	cp := log.Checkpoint{Origin: api.TimestampsOrigin("My Log"), Size: 1, Hash: h.HashLeaf(r)}
+	files := map[string][]byte{
+		path.Join(layout.TimestampsDir, layout.CheckpointPath):            k.sign(t, string(cp.Marshal())),
+		path.Join(layout.TimestampsDir, path.Join(layout.SeqPath("", 0))): r,
+	}
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+
+	got, err := FetchTimestamp(ctx, f, h, k.v, "My Log", 0, lh)
+	if err != nil {
+		t.Fatalf("FetchTimestamp: %v", err)
+	}
+	if diff := cmp.Diff(got, &ts); len(diff) != 0 {
+		t.Errorf("FetchTimestamp had diff %s", diff)
+	}
+	if _, err := FetchTimestamp(ctx, f, h, k.v, "My Log", 0, h.HashLeaf([]byte("apple"))); err == nil {
+		t.Error("FetchTimestamp for other leaf hash succeeded, want error")
+	}
+	if _, err := FetchTimestamp(ctx, f, h, k.v, "My Log", 1, lh); !errors.Is(err, ErrNotIntegrated) {
+		t.Errorf("FetchTimestamp of entry beyond timestamp log = %v, want ErrNotIntegrated", err)
+	}
+	if _, err := FetchTimestamp(ctx, f, h, k.v, "Other Log", 0, lh); err == nil {
+		t.Error("FetchTimestamp with wrong origin succeeded, want error")
+	}
+
+	// A record which doesn't match the checkpoint must be rejected.
+	files[path.Join(layout.TimestampsDir, path.Join(layout.SeqPath("", 0)))] = api.Timestamp{LeafHash: lh, Sequenced: time.Unix(1, 0)}.Marshal()
+	if _, err := FetchTimestamp(ctx, f, h, k.v, "My Log", 0, lh); err == nil {
+		t.Error("FetchTimestamp of altered record succeeded, want error")
+	}
+}
+
+func TestFetchCheckpointTime(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	logKey, tsKey := newTestKey(t, "log"), newTestKey(t, "timestamps")
+	cp := log.Checkpoint{Origin: "My Log", Size: 2, Hash: h.HashLeaf([]byte("root"))}
+	now := time.Unix(1700000000, 0)
+	files := make(map[string][]byte)
+	f := func(_ context.Context, p string) ([]byte, error) {
+		b, ok := files[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return b, nil
+	}
+	put := func(k testKey, ct api.CheckpointTime) {
+		files[layout.CheckpointTimePath] = k.sign(t, string(ct.Marshal()))
+	}
+
+	if _, err := FetchCheckpointTime(ctx, f, note.VerifierList(tsKey.v), cp); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("FetchCheckpointTime without checkpoint time = %v, want not exists error", err)
+	}
+	put(tsKey, api.CheckpointTime{Origin: cp.Origin, Size: cp.Size, Hash: cp.Hash, Time: now})
+	if got, err := FetchCheckpointTime(ctx, f, note.VerifierList(tsKey.v), cp); err != nil || !got.Equal(now) {
+		t.Errorf("FetchCheckpointTime = %v, %v, want %v", got, err, now)
+	}
+	// The checkpoint key isn't trusted for freshness.
+	if _, err := FetchCheckpointTime(ctx, f, note.VerifierList(logKey.v), cp); err == nil {
+		t.Error("FetchCheckpointTime verified with log key succeeded, want error")
+	}
+
+	put(tsKey, api.CheckpointTime{Origin: cp.Origin, Size: cp.Size + 1, Hash: cp.Hash, Time: now})
+	if _, err := FetchCheckpointTime(ctx, f, note.VerifierList(tsKey.v), cp); !errors.Is(err, ErrCheckpointStale) {
+		t.Errorf("FetchCheckpointTime for other size = %v, want ErrCheckpointStale", err)
+	}
+	put(tsKey, api.CheckpointTime{Origin: cp.Origin, Size: cp.Size, Hash: h.HashLeaf([]byte("other")), Time: now})
+	if _, err := FetchCheckpointTime(ctx, f, note.VerifierList(tsKey.v), cp); !errors.Is(err, ErrInconsistentTree) {
+		t.Errorf("FetchCheckpointTime for other root = %v, want ErrInconsistentTree", err)
+	}
+	put(tsKey, api.CheckpointTime{Origin: "Other Log", Size: cp.Size, Hash: cp.Hash, Time: now})
+	if _, err := FetchCheckpointTime(ctx, f, note.VerifierList(tsKey.v), cp); err == nil {
+		t.Error("FetchCheckpointTime for other origin succeeded, want error")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// ErrPinMismatch is wrapped by errors returned from TrustOnFirstUse when a log
+// presents a different key or origin from the ones pinned when it was first
+// contacted.
+var ErrPinMismatch = errors.New("log doesn't match its pinned key and origin")
+
+// Pin is the key and origin of a log, recorded the first time a client
+// contacted it.
+type Pin struct {
+	// URL is the root URL of the log.
+	URL string `json:"url"`
+	// Origin and PublicKey are those of the log's checkpoints.
+	Origin    string `json:"origin"`
+	PublicKey string `json:"public_key"`
+	// Pinned is when the log was first contacted.
+	Pinned time.Time `json:"pinned"`
+}
+
+// TrustStore holds the pins of the logs a client has contacted, in a local
+// file.
+type TrustStore struct {
+	path string
+	pins map[string]Pin
+}
+
+// LoadTrustStore reads the trust store kept in the file at path. The store is
+// empty if the file doesn't exist, and it's created when a pin is added.
+func LoadTrustStore(path string) (*TrustStore, error) {
+	s := &TrustStore{path: path, pins: make(map[string]Pin)}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+	var pins []Pin
+	if err := json.Unmarshal(raw, &pins); err != nil {
+		return nil, fmt.Errorf("failed to parse trust store %q: %w", path, err)
+	}
+	for _, p := range pins {
+		s.pins[p.URL] = p
+	}
+	return s, nil
+}
+
+// Get returns the pin for the log at the given root URL, if there is one.
+func (s *TrustStore) Get(url string) (Pin, bool) {
+	p, ok := s.pins[url]
+	return p, ok
+}
+
+// Pins returns all of the pins in the store, ordered by URL.
+func (s *TrustStore) Pins() []Pin {
+	pins := make([]Pin, 0, len(s.pins))
+	for _, p := range s.pins {
+		pins = append(pins, p)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].URL < pins[j].URL
+	})
+	return pins
+}
+
+// Add stores p, replacing any pin for the same URL.
+func (s *TrustStore) Add(p Pin) error {
+	s.pins[p.URL] = p
+	return s.save()
+}
+
+// Remove deletes the pin for the log at the given root URL, so that the next
+// contact with it trusts whatever key it presents. It returns false if there
+// was no such pin.
+func (s *TrustStore) Remove(url string) (bool, error) {
+	if _, ok := s.pins[url]; !ok {
+		return false, nil
+	}
+	delete(s.pins, url)
+	return true, s.save()
+}
+
+// save atomically replaces the store's file with its current pins.
+func (s *TrustStore) save() error {
+	raw, err := json.MarshalIndent(s.Pins(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create trust store directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// TrustOnFirstUse returns the pin for the log at the given root URL, read
+// with f. The first time the log is contacted, the key it publishes at
+// layout.PublicKeyPath is trusted, along with the origin of the checkpoint it
+// signs, and they're pinned in s. Afterwards, a log which publishes a
+// different key, or whose checkpoint has a different origin or isn't signed by
+// the pinned key, causes an error wrapping ErrPinMismatch, since either the
+// log's operator changed them or someone is impersonating the log.
+func TrustOnFirstUse(ctx context.Context, f Fetcher, s *TrustStore, url string) (*Pin, error) {
+	pin, pinned := s.Get(url)
+	rawKey, err := f(ctx, layout.PublicKeyPath)
+	if err != nil && !(pinned && errors.Is(err, os.ErrNotExist)) {
+		return nil, fmt.Errorf("failed to fetch log's public key: %w", err)
+	}
+	key := strings.TrimSpace(string(rawKey))
+	if !pinned {
+		pin = Pin{URL: url, PublicKey: key, Pinned: time.Now()}
+	} else if len(key) > 0 && key != pin.PublicKey {
+		return nil, fmt.Errorf("log at %s now publishes key %q, but key %q was pinned on %s: %w", url, key, pin.PublicKey, pin.Pinned.Format(time.RFC3339), ErrPinMismatch)
+	}
+	v, err := i_note.NewVerifierForKey(pin.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: %w", pin.PublicKey, err)
+	}
+	cpRaw, err := f(ctx, layout.CheckpointPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	n, err := note.Open(cpRaw, note.VerifierList(v))
+	if err != nil {
+		if pinned {
+			return nil, fmt.Errorf("log at %s has a checkpoint which isn't signed by key %q pinned on %s: %v: %w", url, pin.PublicKey, pin.Pinned.Format(time.RFC3339), err, ErrPinMismatch)
+		}
+		return nil, fmt.Errorf("log's checkpoint isn't signed by the key it publishes: %w", err)
+	}
+	origin, _, _ := strings.Cut(n.Text, "\n")
+	if !pinned {
+		pin.Origin = origin
+		if err := s.Add(pin); err != nil {
+			return nil, fmt.Errorf("failed to pin log: %w", err)
+		}
+		return &pin, nil
+	}
+	if origin != pin.Origin {
+		return nil, fmt.Errorf("log at %s now has origin %q, but origin %q was pinned on %s: %w", url, origin, pin.Origin, pin.Pinned.Format(time.RFC3339), ErrPinMismatch)
+	}
+	return &pin, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+func TestTrustOnFirstUse(t *testing.T) {
+	ctx := context.Background()
+	const url = "https://log.example.com/"
+	logK, otherK := newTestKey(t, "log"), newTestKey(t, "other")
+	// logFiles returns the files of a log which publishes the key k and a
+	// checkpoint with the given origin signed by key s.
+	logFiles := func(k, s testKey, origin string) map[string][]byte {
+		return map[string][]byte{
+			layout.PublicKeyPath:  []byte(k.pub + "\n"),
+			layout.CheckpointPath: s.sign(t, origin+"\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n"),
+		}
+	}
+	fetcher := func(files map[string][]byte) Fetcher {
+		return func(_ context.Context, p string) ([]byte, error) {
+			d, ok := files[p]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return d, nil
+		}
+	}
+	storePath := filepath.Join(t.TempDir(), "trust_store.json")
+	s, err := LoadTrustStore(storePath)
+	if err != nil {
+		t.Fatalf("LoadTrustStore: %v", err)
+	}
+
+	if _, err := TrustOnFirstUse(ctx, fetcher(logFiles(logK, otherK, "Log")), s, url); err == nil || errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("TrustOnFirstUse of a log whose checkpoint isn't signed by its key: %v, want unpinned error", err)
+	}
+	if len(s.Pins()) != 0 {
+		t.Fatalf("Log was pinned despite failing")
+	}
+	p, err := TrustOnFirstUse(ctx, fetcher(logFiles(logK, logK, "Log")), s, url)
+	if err != nil {
+		t.Fatalf("TrustOnFirstUse on first contact: %v", err)
+	}
+	if p.Origin != "Log" || p.PublicKey != logK.pub {
+		t.Errorf("Pinned %+v, want origin Log and key %q", p, logK.pub)
+	}
+
+	// The pin must survive reloading the store.
+	if s, err = LoadTrustStore(storePath); err != nil {
+		t.Fatalf("LoadTrustStore: %v", err)
+	}
+	for _, test := range []struct {
+		desc     string
+		files    map[string][]byte
+		wantErr  bool
+		mismatch bool
+	}{
+		{
+			desc:  "unchanged",
+			files: logFiles(logK, logK, "Log"),
+		}, {
+			desc: "key no longer published",
+			files: func() map[string][]byte {
+				f := logFiles(logK, logK, "Log")
+				delete(f, layout.PublicKeyPath)
+				return f
+			}(),
+		}, {
+			desc:     "key changed",
+			files:    logFiles(otherK, otherK, "Log"),
+			wantErr:  true,
+			mismatch: true,
+		}, {
+			desc:     "signed by another key",
+			files:    logFiles(logK, otherK, "Log"),
+			wantErr:  true,
+			mismatch: true,
+		}, {
+			desc:     "origin changed",
+			files:    logFiles(logK, logK, "Other Log"),
+			wantErr:  true,
+			mismatch: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := TrustOnFirstUse(ctx, fetcher(test.files), s, url)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("TrustOnFirstUse: %v, want error %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, ErrPinMismatch); got != test.mismatch {
+				t.Errorf("TrustOnFirstUse: %v, want ErrPinMismatch %t", err, test.mismatch)
+			}
+		})
+	}
+
+	// Once the pin is removed, the new key is trusted.
+	if ok, err := s.Remove(url); !ok || err != nil {
+		t.Fatalf("Remove = %t, %v", ok, err)
+	}
+	if p, err := TrustOnFirstUse(ctx, fetcher(logFiles(otherK, otherK, "Log")), s, url); err != nil || p.PublicKey != otherK.pub {
+		t.Errorf("TrustOnFirstUse after Remove = %+v, %v, want key %q", p, err, otherK.pub)
+	}
+}
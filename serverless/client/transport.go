@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// ArtifactDigestHeader is the default response header giving the digest of
+// the artifact in the body, as an identifier of the form returned by
+// api.DigestIdentifier, e.g. "sha256:e3b0c442...".
+const ArtifactDigestHeader = "X-Artifact-Digest"
+
+// ErrUnverifiedArtifact is wrapped by errors returned from a
+// VerifyingTransport when an artifact can't be verified to be in the log.
+var ErrUnverifiedArtifact = errors.New("artifact not verified to be in log")
+
+// VerifyingTransportOpts configures a VerifyingTransport.
+type VerifyingTransportOpts struct {
+	// Base is the RoundTripper used to make requests. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+	// Header is the response header giving the artifact's digest. Defaults
+	// to ArtifactDigestHeader.
+	Header string
+	// Require, if set, fails successful responses without the header, rather
+	// than passing them through unverified.
+	Require bool
+	// MaxArtifactSize is the largest artifact which is verified, since it's
+	// read into memory. Defaults to 256 MiB.
+	MaxArtifactSize int64
+}
+
+// VerifyingTransport is an http.RoundTripper which verifies that artifacts
+// downloaded through it are entries in a log before their bodies are
+// returned. Successful responses carrying the artifact digest header are
+// read in full, checked to match the digest, and the artifact is verified to
+// be included in the log under its latest checkpoint, which is checked to be
+// consistent with those seen before. Responses which fail verification are
+// discarded and an error wrapping ErrUnverifiedArtifact is returned.
+//
+// A VerifyingTransport is safe for concurrent use.
+type VerifyingTransport struct {
+	base    http.RoundTripper
+	header  string
+	require bool
+	max     int64
+
+	mu  sync.Mutex
+	lst LogStateTracker
+}
+
+// NewVerifyingTransport returns a VerifyingTransport which verifies artifacts
+// against the log accessed via f, whose checkpoints are signed by v with the
+// given origin. It fetches the log's current checkpoint.
+func NewVerifyingTransport(ctx context.Context, f Fetcher, h merkle.LogHasher, v note.Verifier, origin string, opts VerifyingTransportOpts) (*VerifyingTransport, error) {
+	if opts.Base == nil {
+		opts.Base = http.DefaultTransport
+	}
+	if len(opts.Header) == 0 {
+		opts.Header = ArtifactDigestHeader
+	}
+	if opts.MaxArtifactSize <= 0 {
+		opts.MaxArtifactSize = 256 << 20
+	}
+	lst, err := NewLogStateTracker(ctx, f, h, nil, v, origin, UnilateralConsensus(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	return &VerifyingTransport{
+		base:    opts.Base,
+		header:  opts.Header,
+		require: opts.Require,
+		max:     opts.MaxArtifactSize,
+		lst:     lst,
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *VerifyingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || req.Method == http.MethodHead {
+		return resp, err
+	}
+	d := resp.Header.Get(t.header)
+	if len(d) == 0 {
+		if t.require {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: response for %s has no %s header", ErrUnverifiedArtifact, req.URL, t.header)
+		}
+		return resp, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.max+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body of %s: %w", req.URL, err)
+	}
+	if int64(len(body)) > t.max {
+		return nil, fmt.Errorf("%w: artifact at %s is larger than %d bytes", ErrUnverifiedArtifact, req.URL, t.max)
+	}
+	if err := checkDigest(d, body); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnverifiedArtifact, req.URL, err)
+	}
+	if err := t.verify(req.Context(), body); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnverifiedArtifact, req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// verify checks that artifact is an entry in the log. If it isn't found under
+// the current checkpoint, the log's latest checkpoint is fetched and it's
+// checked again, since it may have been added since.
+func (t *VerifyingTransport) verify(ctx context.Context, artifact []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lh := t.lst.Hasher.HashLeaf(artifact)
+	_, _, err := VerifyInclusionByHash(ctx, t.lst.Fetcher, t.lst.Hasher, t.lst.LatestConsistent, lh)
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrNotIntegrated) {
+		return err
+	}
+	if _, _, _, err := t.lst.Update(ctx); err != nil && !errors.Is(err, ErrCheckpointStale) {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+	_, _, err = VerifyInclusionByHash(ctx, t.lst.Fetcher, t.lst.Hasher, t.lst.LatestConsistent, lh)
+	return err
+}
+
+// checkDigest checks that body has the digest d, an identifier of the form
+// <alg>:<hex digest>.
+func checkDigest(d string, body []byte) error {
+	alg, hexDigest, ok := strings.Cut(strings.TrimSpace(d), ":")
+	if !ok {
+		return fmt.Errorf("malformed artifact digest %q", d)
+	}
+	want, err := api.DigestIdentifier(alg, hexDigest)
+	if err != nil {
+		return err
+	}
+	alg, _, _ = strings.Cut(want, ":")
+	var h hash.Hash
+	switch alg {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported digest algorithm %q", alg)
+	}
+	h.Write(body)
+	if got, _ := api.DigestIdentifier(alg, fmt.Sprintf("%x", h.Sum(nil))); got != want {
+		return fmt.Errorf("artifact has digest %s, want %s", got, want)
+	}
+	return nil
+}
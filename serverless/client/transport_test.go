@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerifyingTransport(t *testing.T) {
+	ctx := context.Background()
+	v, err := note.NewVerifier("astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b")
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	// The log serves the checkpoint of the given size from its history.
+	size := 5
+	f := func(_ context.Context, p string) ([]byte, error) {
+		if p == "checkpoint" {
+			p = fmt.Sprintf("%s.%d", p, size)
+		}
+		return os.ReadFile(filepath.Join("../testdata/log", p))
+	}
+	leaf, err := os.ReadFile("../testdata/log/seq/00/00/00/00/03")
+	if err != nil {
+		t.Fatalf("Failed to read leaf: %v", err)
+	}
+	later, err := os.ReadFile("../testdata/log/seq/00/00/00/00/0a")
+	if err != nil {
+		t.Fatalf("Failed to read leaf: %v", err)
+	}
+	digest := func(b []byte) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+	}
+	artifacts := map[string]struct {
+		body, digest string
+	}{
+		"/logged":     {body: string(leaf), digest: digest(leaf)},
+		"/later":      {body: string(later), digest: digest(later)},
+		"/unlogged":   {body: "hello", digest: digest([]byte("hello"))},
+		"/tampered":   {body: "hello", digest: digest(leaf)},
+		"/unchecked":  {body: "hello"},
+		"/bad_digest": {body: string(leaf), digest: "md5:abcd"},
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a, ok := artifacts[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if len(a.digest) > 0 {
+			w.Header().Set(ArtifactDigestHeader, a.digest)
+		}
+		fmt.Fprint(w, a.body)
+	}))
+	defer s.Close()
+
+	for _, test := range []struct {
+		desc    string
+		require bool
+		path    string
+		size    int
+		want    string
+		wantErr bool
+	}{
+		{desc: "logged", path: "/logged", want: string(leaf)},
+		{desc: "not yet in checkpoint", path: "/later", size: 5, wantErr: true},
+		{desc: "added since checkpoint", path: "/later", size: 15, want: string(later)},
+		{desc: "not logged", path: "/unlogged", wantErr: true},
+		{desc: "digest mismatch", path: "/tampered", wantErr: true},
+		{desc: "unsupported digest", path: "/bad_digest", wantErr: true},
+		{desc: "no digest", path: "/unchecked", want: "hello"},
+		{desc: "no digest required", path: "/unchecked", require: true, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			size = 5
+			tr, err := NewVerifyingTransport(ctx, f, rfc6962.DefaultHasher, v, "Log Checkpoint v0", VerifyingTransportOpts{Require: test.require})
+			if err != nil {
+				t.Fatalf("NewVerifyingTransport: %v", err)
+			}
+			if test.size > 0 {
+				size = test.size
+			}
+			c := &http.Client{Transport: tr}
+			resp, err := c.Get(s.URL + test.path)
+			if test.wantErr {
+				if !errors.Is(err, ErrUnverifiedArtifact) {
+					t.Errorf("Get = %v, want ErrUnverifiedArtifact", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Got body %q, want %q", got, test.want)
+			}
+		})
+	}
+}
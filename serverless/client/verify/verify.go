@@ -0,0 +1,243 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package verify provides verification of a serverless log's checkpoints and
+// RFC 6962 proofs for constrained relying parties, e.g. those built with
+// TinyGo for embedded devices, which are handed a checkpoint, a proof and a
+// leaf hash rather than fetching them.
+//
+// Unlike the client package it does no I/O or logging, and has no
+// dependencies beyond the standard library and the note package. Proofs are
+// verified without allocating, and errors are returned as the sentinel values
+// below rather than being wrapped.
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/bits"
+	"strconv"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// HashSize is the size in bytes of the tree's hashes.
+const HashSize = sha256.Size
+
+var (
+	// ErrInvalidCheckpoint is returned for checkpoints which can't be
+	// opened, or are for a different log.
+	ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+	// ErrInvalidProof is returned for proofs of the wrong shape for the
+	// given indices and sizes.
+	ErrInvalidProof = errors.New("invalid proof")
+	// ErrRootMismatch is returned when a proof leads to a different root
+	// hash than the one expected.
+	ErrRootMismatch = errors.New("root hash mismatch")
+)
+
+// Checkpoint is the part of a log checkpoint needed to verify proofs.
+type Checkpoint struct {
+	// Origin is the unique identifier of the log.
+	Origin string
+	// Size is the number of entries in the log's tree.
+	Size uint64
+	// Hash is the root hash of the tree.
+	Hash [HashSize]byte
+}
+
+// OpenCheckpoint verifies the signature of the log with verifier v on the
+// checkpoint note raw, and parses its body. The checkpoint must be for the log
+// with the given origin. Any extension lines are ignored.
+func OpenCheckpoint(raw []byte, origin string, v note.Verifier) (Checkpoint, error) {
+	n, err := note.Open(raw, note.VerifierList(v))
+	if err != nil {
+		return Checkpoint{}, ErrInvalidCheckpoint
+	}
+	cp, err := ParseCheckpoint([]byte(n.Text))
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if cp.Origin != origin {
+		return Checkpoint{}, ErrInvalidCheckpoint
+	}
+	return cp, nil
+}
+
+// ParseCheckpoint parses the body of a checkpoint, whose signature must have
+// already been verified, in the following format:
+//
+// <origin>\n
+// <decimal size>\n
+// <base64 root hash>\n
+// [extension lines...]
+func ParseCheckpoint(body []byte) (Checkpoint, error) {
+	var lines [3][]byte
+	rest := body
+	for i := range lines {
+		j := bytes.IndexByte(rest, '\n')
+		if j < 0 {
+			return Checkpoint{}, ErrInvalidCheckpoint
+		}
+		lines[i], rest = rest[:j], rest[j+1:]
+	}
+	if len(lines[0]) == 0 {
+		return Checkpoint{}, ErrInvalidCheckpoint
+	}
+	size, err := strconv.ParseUint(string(lines[1]), 10, 64)
+	if err != nil {
+		return Checkpoint{}, ErrInvalidCheckpoint
+	}
+	var h [HashSize + 1]byte
+	if base64.StdEncoding.DecodedLen(len(lines[2])) > len(h) {
+		return Checkpoint{}, ErrInvalidCheckpoint
+	}
+	if n, err := base64.StdEncoding.Decode(h[:], lines[2]); err != nil || n != HashSize {
+		return Checkpoint{}, ErrInvalidCheckpoint
+	}
+	cp := Checkpoint{Origin: string(lines[0]), Size: size}
+	copy(cp.Hash[:], h[:HashSize])
+	return cp, nil
+}
+
+// HashLeaf returns the RFC 6962 leaf hash of the entry leaf.
+func HashLeaf(leaf []byte) [HashSize]byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(leaf)
+	var r [HashSize]byte
+	h.Sum(r[:0])
+	return r
+}
+
+// hashChildren returns the RFC 6962 hash of the interior node with children
+// l and r.
+func hashChildren(l, r []byte) [HashSize]byte {
+	var b [1 + 2*HashSize]byte
+	b[0] = 1
+	copy(b[1:], l)
+	copy(b[1+HashSize:], r)
+	return sha256.Sum256(b[:])
+}
+
+// VerifyInclusion verifies proof that the entry with leaf hash lh is at the
+// given index in the tree committed to by cp.
+func VerifyInclusion(cp Checkpoint, index uint64, lh [HashSize]byte, proof [][]byte) error {
+	return VerifyInclusionAt(index, cp.Size, lh, proof, cp.Hash)
+}
+
+// VerifyInclusionAt verifies proof that the entry with leaf hash lh is at the
+// given index in the tree of the given size with root hash root.
+func VerifyInclusionAt(index, size uint64, lh [HashSize]byte, proof [][]byte, root [HashSize]byte) error {
+	if index >= size {
+		return ErrInvalidProof
+	}
+	fn, sn := index, size-1
+	r := lh
+	for _, p := range proof {
+		if len(p) != HashSize || sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(p, r[:])
+			if fn&1 == 0 {
+				// Skip the levels at which the node has no sibling.
+				s := bits.TrailingZeros64(fn)
+				fn, sn = fn>>s, sn>>s
+			}
+		} else {
+			r = hashChildren(r[:], p)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 {
+		return ErrInvalidProof
+	}
+	if r != root {
+		return ErrRootMismatch
+	}
+	return nil
+}
+
+// VerifyConsistency verifies proof that the tree committed to by newer is an
+// append-only extension of the tree committed to by older.
+func VerifyConsistency(older, newer Checkpoint, proof [][]byte) error {
+	return VerifyConsistencyAt(older.Size, newer.Size, proof, older.Hash, newer.Hash)
+}
+
+// VerifyConsistencyAt verifies proof that the tree of size size2 with root
+// hash root2 is an append-only extension of the tree of size size1 with root
+// hash root1.
+func VerifyConsistencyAt(size1, size2 uint64, proof [][]byte, root1, root2 [HashSize]byte) error {
+	switch {
+	case size1 > size2:
+		return ErrInvalidProof
+	case size1 == size2:
+		if len(proof) != 0 {
+			return ErrInvalidProof
+		}
+		if root1 != root2 {
+			return ErrRootMismatch
+		}
+		return nil
+	case size1 == 0:
+		// The empty tree is consistent with every tree.
+		if len(proof) != 0 {
+			return ErrInvalidProof
+		}
+		return nil
+	}
+
+	fn, sn := size1-1, size2-1
+	s := bits.TrailingZeros64(^fn)
+	fn, sn = fn>>s, sn>>s
+	// If the smaller tree is complete, its root is the first node of the
+	// path, and is omitted from the proof.
+	var fr, sr [HashSize]byte
+	if fn == 0 {
+		fr = root1
+	} else {
+		if len(proof) == 0 || len(proof[0]) != HashSize {
+			return ErrInvalidProof
+		}
+		copy(fr[:], proof[0])
+		proof = proof[1:]
+	}
+	sr = fr
+	for _, c := range proof {
+		if len(c) != HashSize || sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashChildren(c, fr[:])
+			sr = hashChildren(c, sr[:])
+			if fn&1 == 0 {
+				s := bits.TrailingZeros64(fn)
+				fn, sn = fn>>s, sn>>s
+			}
+		} else {
+			sr = hashChildren(sr[:], c)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 {
+		return ErrInvalidProof
+	}
+	if fr != root1 || sr != root2 {
+		return ErrRootMismatch
+	}
+	return nil
+}
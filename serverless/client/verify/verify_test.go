@@ -0,0 +1,93 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify_test
+
+import (
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/client/verify"
+	"github.com/google/trillian-examples/serverless/internal/conformance"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle/testonly"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// verifier adapts the package to the conformance suite.
+type verifier struct{}
+
+func (verifier) OpenCheckpoint(raw []byte, origin string, v note.Verifier) (uint64, []byte, error) {
+	cp, err := verify.OpenCheckpoint(raw, origin, v)
+	if err != nil {
+		return 0, nil, err
+	}
+	return cp.Size, cp.Hash[:], nil
+}
+
+func (verifier) VerifyInclusion(index, size uint64, lh []byte, proof [][]byte, root []byte) error {
+	return verify.VerifyInclusionAt(index, size, hash(lh), proof, hash(root))
+}
+
+func (verifier) VerifyConsistency(size1, size2 uint64, proof [][]byte, root1, root2 []byte) error {
+	return verify.VerifyConsistencyAt(size1, size2, proof, hash(root1), hash(root2))
+}
+
+// hash converts b to a fixed size hash. Hashes of the wrong size are
+// zero, so never match.
+func hash(b []byte) [verify.HashSize]byte {
+	var h [verify.HashSize]byte
+	if len(b) == verify.HashSize {
+		copy(h[:], b)
+	}
+	return h
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, verifier{})
+}
+
+func TestHashLeaf(t *testing.T) {
+	for _, leaf := range []string{"", "entry 0", "a longer entry with more data in it"} {
+		got := verify.HashLeaf([]byte(leaf))
+		if want := rfc6962.DefaultHasher.HashLeaf([]byte(leaf)); string(got[:]) != string(want) {
+			t.Errorf("HashLeaf(%q) = %x, want %x", leaf, got, want)
+		}
+	}
+}
+
+func TestVerifyAllocations(t *testing.T) {
+	tree := testonly.New(rfc6962.DefaultHasher)
+	for i := 0; i < 1000; i++ {
+		tree.AppendData([]byte{byte(i), byte(i >> 8)})
+	}
+	ip, err := tree.InclusionProof(123, 1000)
+	if err != nil {
+		t.Fatalf("InclusionProof: %v", err)
+	}
+	cp, err := tree.ConsistencyProof(700, 1000)
+	if err != nil {
+		t.Fatalf("ConsistencyProof: %v", err)
+	}
+	lh, root, root1 := hash(tree.LeafHash(123)), hash(tree.Hash()), hash(tree.HashAt(700))
+	if n := testing.AllocsPerRun(10, func() {
+		if err := verify.VerifyInclusionAt(123, 1000, lh, ip, root); err != nil {
+			t.Fatalf("VerifyInclusionAt: %v", err)
+		}
+		if err := verify.VerifyConsistencyAt(700, 1000, cp, root1, root); err != nil {
+			t.Fatalf("VerifyConsistencyAt: %v", err)
+		}
+	}); n != 0 {
+		t.Errorf("Verification made %v allocations, want 0", n)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main builds the proof verifier of the client/verify package as a C
+// shared library, for consumers such as C, C++ or Python (via ctypes) which
+// need to verify entries in a serverless log.
+//
+// Build it with:
+//
+//	go build -buildmode=c-shared -o libverify.so ./serverless/cmd/libverify
+//
+// and use the interface declared in serverless_verify.h, rather than the header
+// generated by the build, which is an implementation detail.
+package main
+
+// #include "serverless_verify.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/google/trillian-examples/serverless/client/verify"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// errInvalidArgument is returned for malformed arguments.
+var errInvalidArgument = errors.New("invalid argument")
+
+// codes maps each error to its return code.
+var codes = []struct {
+	err  error
+	code C.int
+}{
+	{verify.ErrInvalidCheckpoint, C.SV_ERR_INVALID_CHECKPOINT},
+	{verify.ErrInvalidProof, C.SV_ERR_INVALID_PROOF},
+	{verify.ErrRootMismatch, C.SV_ERR_ROOT_MISMATCH},
+	{errInvalidArgument, C.SV_ERR_INVALID_ARGUMENT},
+}
+
+// messages holds the C strings returned by sv_strerror, which are never
+// freed.
+var messages = map[C.int]*C.char{}
+
+func init() {
+	messages[C.SV_OK] = C.CString("ok")
+	for _, c := range codes {
+		messages[c.code] = C.CString(c.err.Error())
+	}
+}
+
+// code returns the return code for err.
+func code(err error) C.int {
+	if err == nil {
+		return C.SV_OK
+	}
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return C.SV_ERR_INVALID_ARGUMENT
+}
+
+// bytes returns the n bytes at p, without copying them, or nil if p is NULL.
+func bytes(p unsafe.Pointer, n C.size_t) []byte {
+	if p == nil {
+		return nil
+	}
+	return unsafe.Slice((*byte)(p), int(n))
+}
+
+// hash returns the hash at p, which must not be NULL.
+func hash(p *C.uint8_t) [verify.HashSize]byte {
+	var h [verify.HashSize]byte
+	copy(h[:], bytes(unsafe.Pointer(p), verify.HashSize))
+	return h
+}
+
+// proof returns the n concatenated hashes at p.
+func proof(p *C.uint8_t, n C.size_t) [][]byte {
+	b := bytes(unsafe.Pointer(p), n*verify.HashSize)
+	r := make([][]byte, n)
+	for i := range r {
+		r[i] = b[i*verify.HashSize : (i+1)*verify.HashSize]
+	}
+	return r
+}
+
+// setCheckpoint writes the size and root hash of cp to out.
+func setCheckpoint(cp verify.Checkpoint, out *C.sv_checkpoint) {
+	out.size = C.uint64_t(cp.Size)
+	copy(bytes(unsafe.Pointer(&out.hash[0]), verify.HashSize), cp.Hash[:])
+}
+
+//export sv_abi_version
+func sv_abi_version() C.int {
+	return C.SV_ABI_VERSION
+}
+
+//export sv_strerror
+func sv_strerror(rc C.int) *C.char {
+	if m, ok := messages[rc]; ok {
+		return m
+	}
+	return messages[C.SV_ERR_INVALID_ARGUMENT]
+}
+
+//export sv_open_checkpoint
+func sv_open_checkpoint(raw *C.char, rawLen C.size_t, origin *C.char, originLen C.size_t, vkey *C.char, vkeyLen C.size_t, out *C.sv_checkpoint) C.int {
+	if raw == nil || origin == nil || vkey == nil || out == nil {
+		return C.SV_ERR_INVALID_ARGUMENT
+	}
+	v, err := note.NewVerifier(C.GoStringN(vkey, C.int(vkeyLen)))
+	if err != nil {
+		return C.SV_ERR_INVALID_ARGUMENT
+	}
+	cp, err := verify.OpenCheckpoint(bytes(unsafe.Pointer(raw), rawLen), C.GoStringN(origin, C.int(originLen)), v)
+	if err != nil {
+		return code(err)
+	}
+	setCheckpoint(cp, out)
+	return C.SV_OK
+}
+
+//export sv_parse_checkpoint
+func sv_parse_checkpoint(body *C.char, bodyLen C.size_t, out *C.sv_checkpoint) C.int {
+	if body == nil || out == nil {
+		return C.SV_ERR_INVALID_ARGUMENT
+	}
+	cp, err := verify.ParseCheckpoint(bytes(unsafe.Pointer(body), bodyLen))
+	if err != nil {
+		return code(err)
+	}
+	setCheckpoint(cp, out)
+	return C.SV_OK
+}
+
+//export sv_hash_leaf
+func sv_hash_leaf(leaf *C.uint8_t, leafLen C.size_t, out *C.uint8_t) {
+	if out == nil {
+		return
+	}
+	h := verify.HashLeaf(bytes(unsafe.Pointer(leaf), leafLen))
+	copy(bytes(unsafe.Pointer(out), verify.HashSize), h[:])
+}
+
+//export sv_verify_inclusion
+func sv_verify_inclusion(index, size C.uint64_t, leafHash, p *C.uint8_t, n C.size_t, root *C.uint8_t) C.int {
+	if leafHash == nil || (p == nil && n > 0) || root == nil {
+		return C.SV_ERR_INVALID_ARGUMENT
+	}
+	return code(verify.VerifyInclusionAt(uint64(index), uint64(size), hash(leafHash), proof(p, n), hash(root)))
+}
+
+//export sv_verify_consistency
+func sv_verify_consistency(size1, size2 C.uint64_t, p *C.uint8_t, n C.size_t, root1, root2 *C.uint8_t) C.int {
+	if (p == nil && n > 0) || root1 == nil || root2 == nil {
+		return C.SV_ERR_INVALID_ARGUMENT
+	}
+	return code(verify.VerifyConsistencyAt(uint64(size1), uint64(size2), proof(p, n), hash(root1), hash(root2)))
+}
+
+// main is required by -buildmode=c-shared, but is never called.
+func main() {}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2023 Google LLC. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+ * C interface to the verification of a serverless log's checkpoints and
+ * RFC 6962 proofs, for consumers which can't link Go code directly.
+ *
+ * Additions are made in a backwards compatible way, and bump
+ * SV_ABI_VERSION. Functions never retain the buffers passed to them, and
+ * never modify their contents, apart from the documented outputs.
+ */
+#ifndef SERVERLESS_LIBVERIFY_H
+#define SERVERLESS_LIBVERIFY_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* SV_ABI_VERSION is the version of this interface. */
+#define SV_ABI_VERSION 1
+
+/* SV_HASH_SIZE is the size in bytes of leaf, node and root hashes. */
+#define SV_HASH_SIZE 32
+
+/* Return codes. */
+#define SV_OK 0
+/* The checkpoint couldn't be opened, or is for a different log. */
+#define SV_ERR_INVALID_CHECKPOINT 1
+/* The proof has the wrong shape for the given indices and sizes. */
+#define SV_ERR_INVALID_PROOF 2
+/* The proof leads to a different root hash than the one expected. */
+#define SV_ERR_ROOT_MISMATCH 3
+/* An argument is malformed, e.g. a NULL pointer or an invalid key. */
+#define SV_ERR_INVALID_ARGUMENT 4
+
+/* sv_checkpoint is the part of a checkpoint needed to verify proofs. */
+typedef struct {
+	/* size is the number of entries in the log's tree. */
+	uint64_t size;
+	/* hash is the root hash of the tree. */
+	uint8_t hash[SV_HASH_SIZE];
+} sv_checkpoint;
+
+/* sv_abi_version returns the SV_ABI_VERSION the library was built with. */
+extern int sv_abi_version(void);
+
+/* sv_strerror returns a static description of the return code rc. */
+extern char *sv_strerror(int rc);
+
+/*
+ * sv_open_checkpoint verifies the signature of the log with the note
+ * verifier key vkey on the checkpoint raw, which must be for the log with the
+ * given origin, and writes its size and root hash to out.
+ */
+extern int sv_open_checkpoint(char *raw, size_t raw_len, char *origin, size_t origin_len,
+	char *vkey, size_t vkey_len, sv_checkpoint *out);
+
+/*
+ * sv_parse_checkpoint parses the body of a checkpoint, whose signature must
+ * have already been verified, and writes its size and root hash to out.
+ */
+extern int sv_parse_checkpoint(char *body, size_t body_len, sv_checkpoint *out);
+
+/* sv_hash_leaf writes the RFC 6962 leaf hash of the entry leaf to out. */
+extern void sv_hash_leaf(uint8_t *leaf, size_t leaf_len, uint8_t *out);
+
+/*
+ * sv_verify_inclusion verifies that the entry with leaf hash leaf_hash is at
+ * the given index in the tree of the given size with root hash root. The
+ * proof is n hashes, concatenated.
+ */
+extern int sv_verify_inclusion(uint64_t index, uint64_t size, uint8_t *leaf_hash,
+	uint8_t *proof, size_t n, uint8_t *root);
+
+/*
+ * sv_verify_consistency verifies that the tree of size size2 with root hash
+ * root2 is an append-only extension of the tree of size size1 with root hash
+ * root1. The proof is n hashes, concatenated.
+ */
+extern int sv_verify_consistency(uint64_t size1, uint64_t size2, uint8_t *proof, size_t n,
+	uint8_t *root1, uint8_t *root2);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* SERVERLESS_LIBVERIFY_H */
@@ -0,0 +1,87 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides the serverless binary, which runs each of the
+// serverless tools as a command, e.g.:
+//
+//	serverless --logtostderr sequence --storage_dir=... --entries=...
+//
+// Global flags, such as glog's logging flags, may be given before or after the
+// command. Each tool is also available as a binary of its own.
+package main
+
+import (
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/cmd/admission"
+	"github.com/google/trillian-examples/serverless/internal/cmd/anchor"
+	"github.com/google/trillian-examples/serverless/internal/cmd/backup"
+	"github.com/google/trillian-examples/serverless/internal/cmd/bench"
+	"github.com/google/trillian-examples/serverless/internal/cmd/client"
+	"github.com/google/trillian-examples/serverless/internal/cmd/cosignlog"
+	"github.com/google/trillian-examples/serverless/internal/cmd/feeder"
+	"github.com/google/trillian-examples/serverless/internal/cmd/generatekeys"
+	"github.com/google/trillian-examples/serverless/internal/cmd/importtrillian"
+	"github.com/google/trillian-examples/serverless/internal/cmd/ingest"
+	"github.com/google/trillian-examples/serverless/internal/cmd/integrate"
+	"github.com/google/trillian-examples/serverless/internal/cmd/inventory"
+	"github.com/google/trillian-examples/serverless/internal/cmd/loglist"
+	"github.com/google/trillian-examples/serverless/internal/cmd/logroll"
+	"github.com/google/trillian-examples/serverless/internal/cmd/manifest"
+	"github.com/google/trillian-examples/serverless/internal/cmd/namespaces"
+	"github.com/google/trillian-examples/serverless/internal/cmd/proof"
+	"github.com/google/trillian-examples/serverless/internal/cmd/publish"
+	"github.com/google/trillian-examples/serverless/internal/cmd/rebuild"
+	"github.com/google/trillian-examples/serverless/internal/cmd/redact"
+	"github.com/google/trillian-examples/serverless/internal/cmd/replicate"
+	"github.com/google/trillian-examples/serverless/internal/cmd/reproduce"
+	"github.com/google/trillian-examples/serverless/internal/cmd/rollover"
+	"github.com/google/trillian-examples/serverless/internal/cmd/sequence"
+	"github.com/google/trillian-examples/serverless/internal/cmd/serve"
+	"github.com/google/trillian-examples/serverless/internal/cmd/shards"
+	"github.com/google/trillian-examples/serverless/internal/cmd/staged"
+	"github.com/google/trillian-examples/serverless/internal/cmd/submitsbom"
+)
+
+func main() {
+	cli.RunMulti("serverless", []*cli.Command{
+		admission.Command,
+		anchor.Command,
+		backup.Command,
+		bench.Command,
+		client.Command,
+		cosignlog.Command,
+		feeder.Command,
+		generatekeys.Command,
+		importtrillian.Command,
+		ingest.Command,
+		integrate.Command,
+		inventory.Command,
+		loglist.Command,
+		logroll.Command,
+		manifest.Command,
+		namespaces.Command,
+		proof.Command,
+		publish.Command,
+		rebuild.Command,
+		redact.Command,
+		replicate.Command,
+		reproduce.Command,
+		rollover.Command,
+		sequence.Command,
+		serve.Command,
+		shards.Command,
+		staged.Command,
+		submitsbom.Command,
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js
+// +build js
+
+package main
+
+import (
+	"syscall/js"
+)
+
+// main exposes each method as a function of the global serverlessVerifier
+// object, which takes a JSON request string and returns a JSON response
+// string, and then waits forever so that they remain callable.
+func main() {
+	obj := js.Global().Get("Object").New()
+	for name := range methods {
+		name := name
+		obj.Set(name, js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+			if len(args) != 1 || args[0].Type() != js.TypeString {
+				return string(call(name, nil))
+			}
+			return string(call(name, []byte(args[0].String())))
+		}))
+	}
+	js.Global().Set("serverlessVerifier", obj)
+	select {}
+}
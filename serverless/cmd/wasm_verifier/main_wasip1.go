@@ -0,0 +1,86 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build wasip1
+// +build wasip1
+
+package main
+
+import (
+	"unsafe"
+)
+
+// Built with -buildmode=c-shared, the module is a WASI reactor. The host
+// passes a request by writing it to a buffer returned by alloc, and calling
+// a method with its address and length. The method returns the address and
+// length of its response, packed as addr<<32 | len, which remains valid
+// until the next call.
+
+// buffers holds the memory handed out by alloc, and the last response, so
+// that they aren't garbage collected while the host is using them.
+var buffers = map[uintptr][]byte{}
+
+var lastResponse []byte
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	// Allocate at least one byte, so that every buffer has an address.
+	b := make([]byte, size+1)[:size]
+	p := addr(b)
+	buffers[p] = b
+	return uint32(p)
+}
+
+//go:wasmexport free
+func free(ptr uint32) {
+	delete(buffers, uintptr(ptr))
+}
+
+//go:wasmexport verify_inclusion
+func wasmVerifyInclusion(ptr, size uint32) uint64 {
+	return respond(call("verifyInclusion", request(ptr, size)))
+}
+
+//go:wasmexport verify_consistency
+func wasmVerifyConsistency(ptr, size uint32) uint64 {
+	return respond(call("verifyConsistency", request(ptr, size)))
+}
+
+//go:wasmexport verify_bundle
+func wasmVerifyBundle(ptr, size uint32) uint64 {
+	return respond(call("verifyBundle", request(ptr, size)))
+}
+
+// request returns the request of the given size in the buffer at ptr, which
+// must have been returned by alloc.
+func request(ptr, size uint32) []byte {
+	b, ok := buffers[uintptr(ptr)]
+	if !ok || int(size) > len(b) {
+		return nil
+	}
+	return b[:size]
+}
+
+// respond keeps resp, and returns its packed address and length.
+func respond(resp []byte) uint64 {
+	lastResponse = resp
+	return uint64(addr(resp))<<32 | uint64(len(resp))
+}
+
+// addr returns the address of the first byte of b's backing array.
+func addr(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(&b[:cap(b)][0]))
+}
+
+func main() {}
@@ -0,0 +1,186 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main builds the proof verifier of the client/verify package as a
+// WebAssembly module, for web apps (GOOS=js) and plugin hosts (GOOS=wasip1),
+// with a small API to verify inclusion proofs, consistency proofs and proof
+// bundles produced by a serverless log.
+//
+// Each method takes a JSON request and returns a JSON response. Built for
+// other platforms, it's a command which reads a request from stdin, for
+// trying out requests.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client/verify"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// logKey identifies the log whose checkpoints are verified.
+type logKey struct {
+	// PublicKey is the note verifier key of the log.
+	PublicKey string `json:"public_key"`
+	// Origin is the origin of the log.
+	Origin string `json:"origin"`
+}
+
+// open opens the signed checkpoint raw of the log.
+func (k logKey) open(raw string) (verify.Checkpoint, error) {
+	v, err := note.NewVerifier(k.PublicKey)
+	if err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	cp, err := verify.OpenCheckpoint([]byte(raw), k.Origin, v)
+	if err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// inclusionRequest asks for the inclusion of an entry under a checkpoint to
+// be verified. The entry is given by either its leaf hash, or its contents.
+type inclusionRequest struct {
+	logKey
+	Checkpoint string             `json:"checkpoint"`
+	LeafHash   []byte             `json:"leaf_hash,omitempty"`
+	Leaf       []byte             `json:"leaf,omitempty"`
+	Proof      api.InclusionProof `json:"proof"`
+}
+
+// consistencyRequest asks for the consistency of two checkpoints to be
+// verified.
+type consistencyRequest struct {
+	logKey
+	From  string               `json:"from_checkpoint"`
+	To    string               `json:"to_checkpoint"`
+	Proof api.ConsistencyProof `json:"proof"`
+}
+
+// bundleRequest asks for a proof bundle, an api.ProofBundle, to be verified.
+type bundleRequest struct {
+	logKey
+	Bundle json.RawMessage `json:"bundle"`
+}
+
+// response is the outcome of a request. If the verification succeeded, OK
+// is set along with the size and root hash of the checkpoint verified
+// against, otherwise Error says why it failed.
+type response struct {
+	OK    bool   `json:"ok"`
+	Size  uint64 `json:"size,omitempty"`
+	Root  []byte `json:"root,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// methods maps the name of each method to its implementation.
+var methods = map[string]func(req []byte) (verify.Checkpoint, error){
+	"verifyInclusion":   verifyInclusion,
+	"verifyConsistency": verifyConsistency,
+	"verifyBundle":      verifyBundle,
+}
+
+// call calls the named method with the JSON request req, and returns its
+// JSON response.
+func call(method string, req []byte) []byte {
+	var resp response
+	if f, ok := methods[method]; !ok {
+		resp.Error = fmt.Sprintf("unknown method %q", method)
+	} else if cp, err := f(req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp = response{OK: true, Size: cp.Size, Root: cp.Hash[:]}
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		// Marshalling strings, integers and byte slices can't fail.
+		panic(err)
+	}
+	return b
+}
+
+func verifyInclusion(raw []byte) (verify.Checkpoint, error) {
+	var req inclusionRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("invalid request: %w", err)
+	}
+	var lh [verify.HashSize]byte
+	switch {
+	case req.Leaf != nil && req.LeafHash != nil:
+		return verify.Checkpoint{}, errors.New("only one of leaf and leaf_hash may be set")
+	case req.Leaf != nil:
+		lh = verify.HashLeaf(req.Leaf)
+	case len(req.LeafHash) == verify.HashSize:
+		copy(lh[:], req.LeafHash)
+	default:
+		return verify.Checkpoint{}, fmt.Errorf("invalid leaf hash length %d", len(req.LeafHash))
+	}
+	return checkInclusion(req.logKey, req.Checkpoint, lh, req.Proof)
+}
+
+func verifyConsistency(raw []byte) (verify.Checkpoint, error) {
+	var req consistencyRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("invalid request: %w", err)
+	}
+	from, err := req.open(req.From)
+	if err != nil {
+		return verify.Checkpoint{}, err
+	}
+	to, err := req.open(req.To)
+	if err != nil {
+		return verify.Checkpoint{}, err
+	}
+	if req.Proof.From != from.Size || req.Proof.To != to.Size {
+		return verify.Checkpoint{}, fmt.Errorf("proof is from size %d to %d, want %d to %d", req.Proof.From, req.Proof.To, from.Size, to.Size)
+	}
+	if err := verify.VerifyConsistency(from, to, req.Proof.Hashes); err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("failed to verify consistency proof: %w", err)
+	}
+	return to, nil
+}
+
+func verifyBundle(raw []byte) (verify.Checkpoint, error) {
+	var req bundleRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("invalid request: %w", err)
+	}
+	b, err := api.ParseProofBundle(req.Bundle)
+	if err != nil {
+		return verify.Checkpoint{}, err
+	}
+	var lh [verify.HashSize]byte
+	copy(lh[:], b.LeafHash)
+	return checkInclusion(req.logKey, b.Checkpoint, lh, b.Proof)
+}
+
+// checkInclusion opens the checkpoint cpRaw of the log with key k, and
+// verifies the inclusion proof p of the leaf hash lh under it.
+func checkInclusion(k logKey, cpRaw string, lh [verify.HashSize]byte, p api.InclusionProof) (verify.Checkpoint, error) {
+	cp, err := k.open(cpRaw)
+	if err != nil {
+		return verify.Checkpoint{}, err
+	}
+	if p.Size != cp.Size {
+		return verify.Checkpoint{}, fmt.Errorf("proof is for size %d, want checkpoint size %d", p.Size, cp.Size)
+	}
+	if err := verify.VerifyInclusion(cp, p.Index, lh, p.Hashes); err != nil {
+		return verify.Checkpoint{}, fmt.Errorf("failed to verify inclusion proof: %w", err)
+	}
+	return cp, nil
+}
@@ -0,0 +1,379 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides the provision command, which creates the GCS bucket
+// and Cloud Functions of a serverless log deployment in one step, using the
+// application default credentials, and writes the configuration needed to
+// use them.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/golang/glog"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+	"google.golang.org/api/cloudfunctions/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/gcp_serverless_module/internal/storage"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+var (
+	project     = flag.String("project", "", "GCP project to create the log's resources in.")
+	region      = flag.String("region", "us-central1", "Region to deploy the functions to.")
+	bucket      = flag.String("bucket", "", "Name of the GCS bucket to create to store the log.")
+	origin      = flag.String("origin", "", "Origin of the log, committed to by its checkpoints.")
+	pubKeyFile  = flag.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile = flag.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	sourceDir   = flag.String("source_dir", ".", "Directory of the gcp-log module, whose functions are deployed.")
+	runtime     = flag.String("runtime", "go119", "Cloud Functions runtime to deploy the functions with.")
+	configFile  = flag.String("config", "gcp-log.json", "Location to write the deployment's configuration to.")
+	timeout     = flag.Duration("timeout", 15*time.Minute, "How long to wait for provisioning to complete.")
+)
+
+// Config is the configuration of a provisioned deployment, which is written as
+// JSON to the file given by --config.
+type Config struct {
+	Project string `json:"project"`
+	Region  string `json:"region"`
+	Bucket  string `json:"bucket"`
+	Origin  string `json:"origin"`
+	// LogURL is the public URL of the bucket, from which clients read the
+	// log, e.g. with the client's --log_url flag.
+	LogURL string `json:"logURL"`
+	// IntegrateURL and SequenceURL are the endpoints of the functions,
+	// which are sent requests with the bucket and origin above.
+	IntegrateURL string `json:"integrateURL"`
+	SequenceURL  string `json:"sequenceURL"`
+}
+
+// function describes one of the Cloud Functions of the deployment.
+type function struct {
+	name       string
+	entryPoint string
+	env        map[string]string
+}
+
+func main() {
+	flag.Parse()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if len(*project) == 0 || len(*bucket) == 0 || len(*origin) == 0 {
+		glog.Exit("--project, --bucket and --origin must be set")
+	}
+	pubKey, err := readKey(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		glog.Exitf("Unable to get public key: %v", err)
+	}
+	privKey, err := readKey(*privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		glog.Exitf("Unable to get private key: %v", err)
+	}
+	s, err := note.NewSigner(privKey)
+	if err != nil {
+		glog.Exitf("Failed to instantiate signer: %v", err)
+	}
+
+	if err := provisionBucket(ctx, s); err != nil {
+		glog.Exitf("Failed to provision bucket: %v", err)
+	}
+
+	src, err := sourceArchive(*sourceDir)
+	if err != nil {
+		glog.Exitf("Failed to archive function source: %v", err)
+	}
+	svc, err := cloudfunctions.NewService(ctx)
+	if err != nil {
+		glog.Exitf("Failed to create Cloud Functions client: %v", err)
+	}
+	common := map[string]string{
+		"GCP_PROJECT":               *project,
+		"SERVERLESS_LOG_PUBLIC_KEY": pubKey,
+	}
+	urls := make(map[string]string)
+	for _, f := range []function{
+		{name: "integrate", entryPoint: "Integrate", env: map[string]string{"SERVERLESS_LOG_PRIVATE_KEY": privKey}},
+		{name: "sequence", entryPoint: "Sequence"},
+	} {
+		for k, v := range common {
+			if f.env == nil {
+				f.env = make(map[string]string)
+			}
+			f.env[k] = v
+		}
+		u, err := deploy(ctx, svc, f, src)
+		if err != nil {
+			glog.Exitf("Failed to deploy %s function: %v", f.name, err)
+		}
+		urls[f.name] = u
+		glog.Infof("Deployed %s function at %s", f.name, u)
+	}
+
+	c := Config{
+		Project:      *project,
+		Region:       *region,
+		Bucket:       *bucket,
+		Origin:       *origin,
+		LogURL:       fmt.Sprintf("https://storage.googleapis.com/%s/", *bucket),
+		IntegrateURL: urls["integrate"],
+		SequenceURL:  urls["sequence"],
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		glog.Exitf("Failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(*configFile, append(b, '\n'), 0o644); err != nil {
+		glog.Exitf("Failed to write config: %v", err)
+	}
+	glog.Infof("Wrote configuration of the log to %s", *configFile)
+}
+
+// readKey returns the key read from the file at path, or if path is empty,
+// from the environment variable env.
+func readKey(path, env string) (string, error) {
+	if len(path) == 0 {
+		k := os.Getenv(env)
+		if len(k) == 0 {
+			return "", fmt.Errorf("neither a key file nor %s is set", env)
+		}
+		return strings.TrimSpace(k), nil
+	}
+	k, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(k)), nil
+}
+
+// provisionBucket creates the log's bucket, if it doesn't exist, and writes
+// the checkpoint of the empty log to it, as the integrate function does when
+// asked to initialise the log. An existing log is left as it is, so that
+// provisioning can be retried.
+func provisionBucket(ctx context.Context, s note.Signer) error {
+	gc, err := gcs.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer gc.Close()
+	client, err := storage.NewClient(ctx, *project, *bucket)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	if _, err := gc.Bucket(*bucket).Attrs(ctx); errors.Is(err, gcs.ErrBucketNotExist) {
+		if err := client.Create(ctx, *bucket); err != nil {
+			return err
+		}
+		glog.Infof("Created bucket %q", *bucket)
+	} else if err != nil {
+		return fmt.Errorf("failed to read attributes of bucket %q: %w", *bucket, err)
+	}
+	if _, err := client.ReadCheckpoint(ctx); err == nil {
+		glog.Infof("Bucket %q already holds a log, so leaving it as it is", *bucket)
+		return nil
+	} else if !errors.Is(err, gcs.ErrObjectNotExist) {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	cp := fmtlog.Checkpoint{Origin: *origin, Hash: rfc6962.DefaultHasher.EmptyRoot()}
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	if err := client.WriteCheckpoint(ctx, cpRaw); err != nil {
+		return err
+	}
+	glog.Infof("Initialised log %q in bucket %q", *origin, *bucket)
+	return nil
+}
+
+// sourceArchive returns a zip archive of the function source in dir. The
+// module's dependencies, including the trillian-examples checkout it's in, are
+// vendored, so the archive is all Cloud Functions needs to build it.
+func sourceArchive(dir string) ([]byte, error) {
+	if _, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err != nil {
+		return nil, fmt.Errorf("function source isn't vendored, run vendor.sh: %w", err)
+	}
+	b := &bytes.Buffer{}
+	zw := zip.NewWriter(b)
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if err := addFiles(dir, add); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// addFiles adds the files needed to build the module in dir to an archive:
+// go.mod, go.sum, the non-test Go files of its packages, and everything under
+// vendor. Nested modules, and directories which go ignores, aren't descended
+// into.
+func addFiles(dir string, add func(name string, data []byte) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := d.Name()
+		if d.IsDir() {
+			if p == dir {
+				return nil
+			}
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		vendored := strings.HasPrefix(rel, "vendor/")
+		if !vendored && name != "go.mod" && name != "go.sum" && (!strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go")) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return add(rel, data)
+	})
+}
+
+// deploy creates the Cloud Function f from the source archive src, or updates
+// it if it already exists, and returns the URL it's triggered at.
+func deploy(ctx context.Context, svc *cloudfunctions.Service, f function, src []byte) (string, error) {
+	parent := fmt.Sprintf("projects/%s/locations/%s", *project, *region)
+	fns := svc.Projects.Locations.Functions
+	up, err := fns.GenerateUploadUrl(parent, &cloudfunctions.GenerateUploadUrlRequest{}).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to get source upload URL: %w", err)
+	}
+	if err := upload(ctx, up.UploadUrl, src); err != nil {
+		return "", err
+	}
+	cf := &cloudfunctions.CloudFunction{
+		Name:                 fmt.Sprintf("%s/functions/%s", parent, f.name),
+		EntryPoint:           f.entryPoint,
+		Runtime:              *runtime,
+		HttpsTrigger:         &cloudfunctions.HttpsTrigger{},
+		EnvironmentVariables: f.env,
+		SourceUploadUrl:      up.UploadUrl,
+		// Each function must run alone, since neither sequencing nor
+		// integration may be run concurrently against the same log.
+		MaxInstances: 1,
+	}
+	var op *cloudfunctions.Operation
+	if _, err := fns.Get(cf.Name).Context(ctx).Do(); isNotFound(err) {
+		op, err = fns.Create(parent, cf).Context(ctx).Do()
+		if err != nil {
+			return "", fmt.Errorf("failed to create function: %w", err)
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get function: %w", err)
+	} else {
+		op, err = fns.Patch(cf.Name, cf).UpdateMask("entryPoint,runtime,httpsTrigger,environmentVariables,sourceUploadUrl,maxInstances").Context(ctx).Do()
+		if err != nil {
+			return "", fmt.Errorf("failed to update function: %w", err)
+		}
+	}
+	if err := wait(ctx, svc, op); err != nil {
+		return "", err
+	}
+	got, err := fns.Get(cf.Name).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployed function: %w", err)
+	}
+	if got.HttpsTrigger == nil || len(got.HttpsTrigger.Url) == 0 {
+		return "", errors.New("deployed function has no trigger URL")
+	}
+	return got.HttpsTrigger.Url, nil
+}
+
+// upload puts the source archive src at the signed URL u, as returned by
+// GenerateUploadUrl.
+func upload(ctx context.Context, u string, src []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(src))
+	if err != nil {
+		return err
+	}
+	// These headers are part of the signature of the URL.
+	req.Header.Set("Content-Type", "application/zip")
+	req.Header.Set("x-goog-content-length-range", "0,104857600")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload source: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to upload source: %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// wait polls the long-running operation op until it's done, returning its
+// error, if any.
+func wait(ctx context.Context, svc *cloudfunctions.Service, op *cloudfunctions.Operation) error {
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for operation %q: %w", op.Name, ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+		var err error
+		if op, err = svc.Operations.Get(op.Name).Context(ctx).Do(); err != nil {
+			return fmt.Errorf("failed to get operation: %w", err)
+		}
+	}
+	if op.Error != nil {
+		return fmt.Errorf("operation %q failed: %s", op.Name, op.Error.Message)
+	}
+	return nil
+}
+
+// isNotFound returns true if err is a Google API error for a missing
+// resource.
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
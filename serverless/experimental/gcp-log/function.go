@@ -29,11 +29,17 @@ import (
 	"google.golang.org/api/iterator"
 
 	"github.com/gcp_serverless_module/internal/storage"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
 	"github.com/google/trillian-examples/serverless/pkg/log"
 
 	fmtlog "github.com/transparency-dev/formats/log"
 )
 
+// gcsGuard guards the operations on GCS made by every invocation of the
+// functions on this instance, so that retries are budgeted, and GCS failing
+// repeatedly fails invocations quickly, across all of them.
+var gcsGuard = guard.New(guard.Options{})
+
 func validateCommonArgs(w http.ResponseWriter, origin string) (ok bool, pubKey string) {
 	if len(origin) == 0 {
 		http.Error(w, "Please set `origin` in HTTP body to log identifier.", http.StatusBadRequest)
@@ -76,7 +82,7 @@ func Sequence(w http.ResponseWriter, r *http.Request) {
 	// init storage
 
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx, os.Getenv("GCP_PROJECT"), d.Bucket)
+	client, err := storage.NewClient(ctx, os.Getenv("GCP_PROJECT"), d.Bucket, storage.WithGuard(gcsGuard))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create GCS client: %q", err), http.StatusInternalServerError)
 		return
@@ -160,6 +166,9 @@ func Integrate(w http.ResponseWriter, r *http.Request) {
 		Origin     string `json:"origin"`
 		Initialise bool   `json:"initialise"`
 		Bucket     string `json:"bucket"`
+		// Parallelism is the maximum number of tiles uploaded at once. If
+		// zero, tiles are uploaded one at a time.
+		Parallelism int `json:"parallelism"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
@@ -187,7 +196,11 @@ func Integrate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx, os.Getenv("GCP_PROJECT"), d.Bucket)
+	opts := []storage.Option{storage.WithGuard(gcsGuard)}
+	if d.Parallelism > 0 {
+		opts = append(opts, storage.WithWriteBatching(log.BatchOptions{Parallelism: d.Parallelism}))
+	}
+	client, err := storage.NewClient(ctx, os.Getenv("GCP_PROJECT"), d.Bucket, opts...)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create GCS client: %v", err), http.StatusBadRequest)
 		return
@@ -16,6 +16,7 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/serverless/api"
 	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
 	"github.com/google/trillian-examples/serverless/pkg/log"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
@@ -54,21 +56,139 @@ type Client struct {
 	// Note that nextSeq may be <= than the actual next available number, but
 	// never greater.
 	nextSeq uint64
+	// batcher, if set, is used to upload tiles concurrently.
+	batcher *log.WriteBatcher
+	// guard, if set, wraps each operation on the bucket.
+	guard *guard.Guard
+	// objects reads and writes the objects in the bucket.
+	objects objectStore
+}
+
+// Option configures optional behaviour of a Client.
+type Option func(*Client)
+
+// WithWriteBatching makes the Client upload tiles concurrently, with at most
+// parallelism uploads in flight, retrying failed uploads as configured by
+// opts. Integrating a large batch of entries into the log writes many tiles,
+// which is impractically slow if they're uploaded one at a time.
+func WithWriteBatching(opts log.BatchOptions) Option {
+	return func(c *Client) {
+		c.batcher = log.NewWriteBatcher(c.putObject, opts)
+	}
+}
+
+// WithGuard makes the Client perform each operation on the bucket through g,
+// which gives it a deadline, retries it within a budget, and fails it straight
+// away once GCS has failed repeatedly, so that a degraded GCS makes
+// sequencing and integration fail quickly rather than hang. The same Guard
+// should be shared by every Client for the bucket.
+func WithGuard(g *guard.Guard) Option {
+	return func(c *Client) {
+		c.guard = g
+	}
+}
+
+// do performs op, through the guard if there is one.
+func (c *Client) do(ctx context.Context, op func(ctx context.Context) error) error {
+	if c.guard == nil {
+		return op(ctx)
+	}
+	return c.guard.Do(ctx, op)
 }
 
 // NewClient returns a Client which allows interaction with the log stored in
 // the specified bucket on GCS.
-func NewClient(ctx context.Context, projectID, bucket string) (*Client, error) {
-	c, err := gcs.NewClient(ctx)
+func NewClient(ctx context.Context, projectID, bucket string, opts ...Option) (*Client, error) {
+	gc, err := gcs.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		gcsClient: c,
+	c := &Client{
+		gcsClient: gc,
 		projectID: projectID,
 		bucket:    bucket,
-	}, nil
+	}
+	c.objects = bucketObjects{c}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Flush waits for any tile uploads in flight to complete, and returns an
+// error if any of them failed. It's a no-op unless write batching is enabled.
+func (c *Client) Flush(ctx context.Context) error {
+	if c.batcher == nil {
+		return nil
+	}
+	return c.batcher.Flush(ctx)
+}
+
+// putObject writes data to the object at the given path in the bucket.
+func (c *Client) putObject(ctx context.Context, path string, data []byte) error {
+	return c.do(ctx, func(ctx context.Context) error {
+		return c.objects.write(ctx, path, data, false)
+	})
+}
+
+// createObject writes data to the object at the given path in the bucket if
+// there's no object there, and otherwise returns errObjectExists.
+func (c *Client) createObject(ctx context.Context, path string, data []byte) error {
+	return c.do(ctx, func(ctx context.Context) error {
+		err := c.objects.write(ctx, path, data, true)
+		if errors.Is(err, errObjectExists) {
+			return guard.Permanent(err)
+		}
+		return err
+	})
+}
+
+// errObjectExists is returned by createObject when the object exists.
+var errObjectExists = errors.New("object already exists")
+
+// objectStore holds the objects in the bucket.
+type objectStore interface {
+	// read returns the contents of the object at path, or an error wrapping
+	// gcs.ErrObjectNotExist if there's none.
+	read(ctx context.Context, path string) ([]byte, error)
+	// write writes data to the object at path. If create is set, it's only
+	// written if there's no object there, and otherwise errObjectExists is
+	// returned.
+	write(ctx context.Context, path string, data []byte, create bool) error
+}
+
+// bucketObjects is the objectStore of a Client's bucket on GCS.
+type bucketObjects struct {
+	c *Client
+}
+
+func (b bucketObjects) read(ctx context.Context, path string) ([]byte, error) {
+	r, err := b.c.gcsClient.Bucket(b.c.bucket).Object(path).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (b bucketObjects) write(ctx context.Context, path string, data []byte, create bool) error {
+	o := b.c.gcsClient.Bucket(b.c.bucket).Object(path)
+	if create {
+		o = o.If(gcs.Conditions{DoesNotExist: true})
+	}
+	w := o.NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write object %q to bucket %q: %w", path, b.c.bucket, err)
+	}
+	if err := w.Close(); err != nil {
+		var e *googleapi.Error
+		if errors.As(err, &e) && e.Code == http.StatusPreconditionFailed {
+			return errObjectExists
+		}
+		return err
+	}
+	return nil
 }
 
 // Create creates a new GCS bucket and returns an error on failure.
@@ -98,27 +218,27 @@ func (c *Client) SetNextSeq(num uint64) {
 
 // WriteCheckpoint stores a raw log checkpoint on GCS.
 func (c *Client) WriteCheckpoint(ctx context.Context, newCPRaw []byte) error {
-	bkt := c.gcsClient.Bucket(c.bucket)
-	obj := bkt.Object(layout.CheckpointPath)
-	w := obj.NewWriter(ctx)
-	if _, err := w.Write(newCPRaw); err != nil {
-		return err
-	}
-	return w.Close()
+	return c.putObject(ctx, layout.CheckpointPath, newCPRaw)
 }
 
 // ReadCheckpoint reads from GCS and returns the contents of the log checkpoint.
 func (c *Client) ReadCheckpoint(ctx context.Context) ([]byte, error) {
-	bkt := c.gcsClient.Bucket(c.bucket)
-	obj := bkt.Object(layout.CheckpointPath)
-
-	r, err := obj.NewReader(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Close()
+	return c.readObject(ctx, layout.CheckpointPath)
+}
 
-	return io.ReadAll(r)
+// readObject reads the object at the given path in the bucket. A missing
+// object is the bucket's answer, so doesn't count against it.
+func (c *Client) readObject(ctx context.Context, path string) ([]byte, error) {
+	var data []byte
+	err := c.do(ctx, func(ctx context.Context) error {
+		var err error
+		data, err = c.objects.read(ctx, path)
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return guard.Permanent(err)
+		}
+		return err
+	})
+	return data, err
 }
 
 // GetTile returns the tile at the given tile-level and tile-index.
@@ -126,26 +246,19 @@ func (c *Client) ReadCheckpoint(ctx context.Context) ([]byte, error) {
 // partial tile for the given tree size at that location.
 func (c *Client) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
 	tileSize := layout.PartialTileSize(level, index, logSize)
-	bkt := c.gcsClient.Bucket(c.bucket)
 
 	// Pass an empty rootDir since we don't need this concept in GCS.
 	objName := filepath.Join(layout.TilePath("", level, index, tileSize))
-	r, err := bkt.Object(objName).NewReader(ctx)
+	t, err := c.readObject(ctx, objName)
 	if err != nil {
-		fmt.Printf("GetTile: failed to create reader for object %q in bucket %q: %v", objName, c.bucket, err)
+		fmt.Printf("GetTile: failed to read object %q in bucket %q: %v", objName, c.bucket, err)
 
 		if errors.Is(err, gcs.ErrObjectNotExist) {
 			// Return the generic NotExist error so that tileCache.Visit can differentiate
 			// between this and other errors.
 			return nil, os.ErrNotExist
 		}
-		return nil, err
-	}
-	defer r.Close()
-
-	t, err := io.ReadAll(r)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read tile object %q in bucket %q: %v", objName, c.bucket, err)
+		return nil, fmt.Errorf("failed to read tile object %q in bucket %q: %w", objName, c.bucket, err)
 	}
 
 	var tile api.Tile
@@ -161,7 +274,6 @@ func (c *Client) GetTile(ctx context.Context, level, index, logSize uint64) (*ap
 // return the number of sequenced entries scanned.
 func (c *Client) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
 	end := begin
-	bkt := c.gcsClient.Bucket(c.bucket)
 
 	for {
 		// Pass an empty rootDir since we don't need this concept in GCS.
@@ -170,18 +282,12 @@ func (c *Client) ScanSequenced(ctx context.Context, begin uint64, f func(seq uin
 		// Read the object in an anonymous function so that the reader gets closed
 		// in each iteration of the outside for loop.
 		done, err := func() (bool, error) {
-			r, err := bkt.Object(sp).NewReader(ctx)
+			entry, err := c.readObject(ctx, sp)
 			if errors.Is(err, gcs.ErrObjectNotExist) {
 				// we're done.
 				return true, nil
 			} else if err != nil {
-				return false, fmt.Errorf("ScanSequenced: failed to create reader for object %q in bucket %q: %v", sp, c.bucket, err)
-			}
-			defer r.Close()
-
-			entry, err := io.ReadAll(r)
-			if err != nil {
-				return false, fmt.Errorf("failed to read leafdata at index %d: %w", begin, err)
+				return false, fmt.Errorf("ScanSequenced: failed to read object %q in bucket %q: %v", sp, c.bucket, err)
 			}
 
 			if err := f(end, entry); err != nil {
@@ -210,13 +316,11 @@ func (c *Client) GetObjects(ctx context.Context, entriesDir string) *gcs.ObjectI
 
 // GetObjectData returns the bytes of the input object path.
 func (c *Client) GetObjectData(ctx context.Context, obj string) ([]byte, error) {
-	r, err := c.gcsClient.Bucket(c.bucket).Object(obj).NewReader(ctx)
+	data, err := c.readObject(ctx, obj)
 	if err != nil {
-		return nil, fmt.Errorf("GetObjectData: failed to create reader for object %q in bucket %q: %q", obj, c.bucket, err)
+		return nil, fmt.Errorf("GetObjectData: failed to read object %q in bucket %q: %q", obj, c.bucket, err)
 	}
-	defer r.Close()
-
-	return io.ReadAll(r)
+	return data, nil
 }
 
 // Sequence assigns the given leaf entry to the next available sequence number.
@@ -224,26 +328,22 @@ func (c *Client) GetObjectData(ctx context.Context, obj string) ([]byte, error)
 // be guaranteed that no duplicate entries will exist.
 // Returns the sequence number assigned to this leaf (if the leaf has already
 // been sequenced it will return the original sequence number and ErrDupeLeaf).
+//
+// Each of the steps below is retried on its own, rather than the whole
+// operation, as each is idempotent while the whole isn't: were the leafhash
+// object to fail to be written, a retry of the whole operation wouldn't find
+// it and would sequence the leaf again.
 func (c *Client) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error) {
 	// 1. Check for dupe leafhash
 	// 2. Create seq file
 	// 3. Create leafhash file containing assigned sequence number
 
-	bkt := c.gcsClient.Bucket(c.bucket)
-
 	// Check for dupe leaf already present.
 	leafPath := filepath.Join(layout.LeafPath("", leafhash))
-	r, err := bkt.Object(leafPath).NewReader(ctx)
+	seqString, err := c.readObject(ctx, leafPath)
 	if err == nil {
-		defer r.Close()
-
 		// If there is one, it should contain the existing leaf's sequence number,
 		// so read that back and return it.
-		seqString, err := io.ReadAll(r)
-		if err != nil {
-			return 0, err
-		}
-
 		origSeq, err := strconv.ParseUint(string(seqString), 16, 64)
 		if err != nil {
 			return 0, err
@@ -253,62 +353,55 @@ func (c *Client) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (ui
 		return 0, err
 	}
 
+	seq, err := c.assignSeq(ctx, leaf)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create a leafhash file containing the assigned sequence number.
+	// This isn't infallible though, if we crash after writing the sequence
+	// file above but before doing this, a resubmission of the same leafhash
+	// would be permitted, unless the sequence file is still ahead of nextSeq.
+	if err := c.putObject(ctx, leafPath, []byte(strconv.FormatUint(seq, 16))); err != nil {
+		return 0, fmt.Errorf("couldn't create leafhash object %q: %w", leafPath, err)
+	}
+	return seq, nil
+}
+
+// assignSeq writes the leaf to the first available sequence number from
+// nextSeq, and returns the number. A sequence number already holding the same
+// leaf is taken to be the leaf's, since it was written either by an attempt
+// at the write which succeeded while appearing to fail, or by an earlier call
+// for the same leaf which failed to write the leafhash object.
+func (c *Client) assignSeq(ctx context.Context, leaf []byte) (uint64, error) {
 	// Now try to sequence it, we may have to scan over some newly sequenced entries
 	// if Sequence has been called since the last time an Integrate/WriteCheckpoint
 	// was called.
 	for {
 		seq := c.nextSeq
-
-		// Try to write the sequence file
 		seqPath := filepath.Join(layout.SeqPath("", seq))
-		if _, err := bkt.Object(seqPath).Attrs(ctx); err == nil {
-			// That sequence number is in use, try the next one
-			c.nextSeq++
-			fmt.Printf("Seq num %d in use, continuing", seq)
-			continue
-		} else if !errors.Is(err, gcs.ErrObjectNotExist) {
-			return 0, fmt.Errorf("couldn't get attr of object %s: %q", seqPath, err)
-		}
 
-		// Found the next available sequence number; write it.
-		//
 		// Conditionally write only if the object does not exist yet:
 		// https://cloud.google.com/storage/docs/request-preconditions#special-case.
 		// This may exist if there is more than one instance of the sequencer
 		// writing to the same log.
-		w := bkt.Object(seqPath).If(gcs.Conditions{DoesNotExist: true}).NewWriter(ctx)
-		if _, err := w.Write(leaf); err != nil {
-			return 0, fmt.Errorf("failed to write seq file: %w", err)
-		}
-		if err := w.Close(); err != nil {
-			var e *googleapi.Error
-			if ok := errors.As(err, &e); ok {
-				// Sequence number already in use.
-				if e.Code == http.StatusPreconditionFailed {
-					fmt.Printf("GCS writer close failed with sequence number %d: %v. Trying with number %d.\n",
-						c.nextSeq, err, c.nextSeq+1)
-					c.nextSeq++
-					continue
-				}
+		err := c.createObject(ctx, seqPath, leaf)
+		if errors.Is(err, errObjectExists) {
+			existing, err := c.readObject(ctx, seqPath)
+			if err != nil {
+				return 0, fmt.Errorf("couldn't read object %q: %w", seqPath, err)
 			}
-
-			return 0, fmt.Errorf("couldn't close writer for object %q: %v", seqPath, err)
+			if bytes.Equal(existing, leaf) {
+				return seq, nil
+			}
+			// That sequence number is in use, try the next one
+			fmt.Printf("Seq num %d in use, continuing\n", seq)
+			c.nextSeq++
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("couldn't create object %q: %w", seqPath, err)
 		}
 		fmt.Printf("Wrote leaf data to path %q\n", seqPath)
-
-		// Create a leafhash file containing the assigned sequence number.
-		// This isn't infallible though, if we crash after writing the sequence
-		// file above but before doing this, a resubmission of the same leafhash
-		// would be permitted.
-		wLeaf := bkt.Object(leafPath).NewWriter(ctx)
-		if _, err := wLeaf.Write([]byte(strconv.FormatUint(seq, 16))); err != nil {
-			return 0, fmt.Errorf("couldn't create leafhash object: %w", err)
-		}
-		if err := wLeaf.Close(); err != nil {
-			return 0, fmt.Errorf("couldn't close writer for object %q", leafPath)
-		}
-
-		// All done!
 		return seq, nil
 	}
 }
@@ -332,13 +425,10 @@ func (c *Client) StoreTile(ctx context.Context, level, index uint64, tile *api.T
 
 	// Pass an empty rootDir since we don't need this concept in GCS.
 	tPath := filepath.Join(layout.TilePath("", level, index, tileSize%256))
-	obj := bkt.Object(tPath)
-
-	w := obj.NewWriter(ctx)
-	if _, err := w.Write(t); err != nil {
-		return fmt.Errorf("failed to write tile object %q to bucket %q: %w", tPath, c.bucket, err)
+	if c.batcher != nil {
+		return c.batcher.Write(ctx, tPath, t)
 	}
-	return w.Close()
+	return c.putObject(ctx, tPath, t)
 
 	if tileSize == 256 {
 		// Get partial files.
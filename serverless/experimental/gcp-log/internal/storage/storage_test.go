@@ -0,0 +1,146 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	gcs "cloud.google.com/go/storage"
+)
+
+// fakeObjects is an in-memory objectStore, whose writes can be made to fail.
+type fakeObjects struct {
+	objects map[string][]byte
+	// fail returns whether a write to path should fail, and if so whether
+	// the object is written anyway, as when a write times out after GCS has
+	// committed it.
+	fail func(path string) (fail, written bool)
+}
+
+func (f *fakeObjects) read(_ context.Context, path string) ([]byte, error) {
+	b, ok := f.objects[path]
+	if !ok {
+		return nil, gcs.ErrObjectNotExist
+	}
+	return b, nil
+}
+
+func (f *fakeObjects) write(_ context.Context, path string, data []byte, create bool) error {
+	if _, ok := f.objects[path]; ok && create {
+		return errObjectExists
+	}
+	fail, written := false, false
+	if f.fail != nil {
+		fail, written = f.fail(path)
+	}
+	if !fail || written {
+		f.objects[path] = data
+	}
+	if fail {
+		return errors.New("deadline exceeded")
+	}
+	return nil
+}
+
+func TestSequenceRetries(t *testing.T) {
+	ctx := context.Background()
+	leaf := []byte("leaf")
+	leafhash := rfc6962.DefaultHasher.HashLeaf(leaf)
+	leafPath := filepath.Join(layout.LeafPath("", leafhash))
+	seqPath := func(i uint64) string { return filepath.Join(layout.SeqPath("", i)) }
+
+	for _, test := range []struct {
+		desc string
+		// Writes to the objects under prefix fail the given number of
+		// times, having written the object if written is set.
+		prefix   string
+		failures int
+		written  bool
+		wantErr  bool
+	}{
+		{
+			desc:     "leafhash write fails",
+			prefix:   "leaves/",
+			failures: 1,
+		}, {
+			desc:     "leafhash write times out after committing",
+			prefix:   "leaves/",
+			failures: 1,
+			written:  true,
+		}, {
+			desc:     "seq write times out after committing",
+			prefix:   "seq/",
+			failures: 1,
+			written:  true,
+		}, {
+			desc:     "leafhash write keeps failing",
+			prefix:   "leaves/",
+			failures: 3,
+			wantErr:  true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			failures := test.failures
+			objs := &fakeObjects{
+				// Another leaf was sequenced before this one.
+				objects: map[string][]byte{seqPath(0): []byte("other leaf")},
+				fail: func(path string) (bool, bool) {
+					if failures > 0 && strings.HasPrefix(path, test.prefix) {
+						failures--
+						return true, test.written
+					}
+					return false, false
+				},
+			}
+			c := &Client{
+				objects: objs,
+				guard:   guard.New(guard.Options{Attempts: 3, RetryDelay: time.Millisecond}),
+			}
+
+			seq, err := c.Sequence(ctx, leafhash, leaf)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Sequence: got err %v, want err %t", err, test.wantErr)
+			}
+			if err == nil && seq != 1 {
+				t.Errorf("Sequence: got seq %d, want 1", seq)
+			}
+			if test.wantErr {
+				// A resubmission reuses the sequence number already written.
+				if seq, err = c.Sequence(ctx, leafhash, leaf); err != nil || seq != 1 {
+					t.Fatalf("Resubmitted Sequence: got %d, %v, want 1", seq, err)
+				}
+			}
+			if _, ok := objs.objects[seqPath(2)]; ok {
+				t.Error("Leaf was sequenced twice")
+			}
+			if got := string(objs.objects[leafPath]); got != "1" {
+				t.Errorf("Got leafhash object %q, want \"1\"", got)
+			}
+			if _, err := c.Sequence(ctx, leafhash, leaf); !errors.Is(err, log.ErrDupeLeaf) {
+				t.Errorf("Sequence of duplicate: got err %v, want ErrDupeLeaf", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+#!/bin/bash
+#
+# Refreshes vendor/ with the packages of the trillian-examples checkout this
+# module is in, and the module's other dependencies.
+#
+# The functions depend on serverless packages which haven't been published in
+# a release of trillian-examples, and Cloud Functions only sees this
+# directory, so the module can't replace trillian-examples with the checkout.
+# Instead the checkout is vendored, under a placeholder version, and the
+# functions are built with -mod=vendor, as Cloud Functions does when vendor/
+# exists. Run this whenever the serverless packages or the module's
+# dependencies change, and commit the result.
+set -eu
+
+readonly MODULE=github.com/google/trillian-examples
+readonly VERSION=v0.0.0-00010101000000-000000000000
+readonly CHECKOUT=../../..
+
+cd "$(dirname "$0")"
+go mod edit -require="${MODULE}@${VERSION}" -replace="${MODULE}=${CHECKOUT}"
+trap 'go mod edit -dropreplace="${MODULE}"' EXIT
+GOFLAGS=-mod=mod go mod vendor
+# vendor/modules.txt must agree with go.mod once the replacement is dropped.
+sed -i.bak \
+  -e "s|^# ${MODULE} ${VERSION} => ${CHECKOUT}\$|# ${MODULE} ${VERSION}|" \
+  -e "\|^# ${MODULE} => ${CHECKOUT}\$|d" \
+  vendor/modules.txt
+rm vendor/modules.txt.bak
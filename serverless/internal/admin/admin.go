@@ -0,0 +1,632 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admin provides an authenticated HTTP API for routine operational
+// actions on a serverless log stored in a local directory, so that operators
+// of a long-running server don't need shell access to the storage host.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+const (
+	// IntegratePath is the path of the action which integrates any sequenced
+	// entries and publishes a new checkpoint, as the integrate tool does.
+	IntegratePath = "/admin/integrate"
+
+	// StatePath is the path of the action which changes the lifecycle state
+	// of the log, as the manifest tool does. It takes state and reason form
+	// values.
+	StatePath = "/admin/state"
+
+	// StatsPath is the path serving the log's Stats.
+	StatsPath = "/admin/stats"
+
+	// SubmissionsPath is the path of the action which sequences the entries
+	// named by an S3 event notification, as described by SequenceSubmissions.
+	SubmissionsPath = "/admin/submissions"
+
+	// SubmitterAuditPath is the path serving the submissions made by a
+	// submitter over a period of time, as described by Submissions. It takes
+	// submitter, from, and to form values, with times in RFC 3339 format.
+	SubmitterAuditPath = "/admin/audit/submissions"
+
+	// EntryAuditPath is the path serving the identity of the submitter who
+	// added an entry, given its sequence number as the seq form value.
+	EntryAuditPath = "/admin/audit/entry"
+)
+
+// errConflict is returned (wrapped) when an action can't be taken in the
+// log's current state.
+var errConflict = errors.New("conflict")
+
+// Stats describes the current state of the log.
+type Stats struct {
+	Origin string       `json:"origin"`
+	Size   uint64       `json:"size"`
+	Root   []byte       `json:"root"`
+	State  api.LogState `json:"state"`
+	Reason string       `json:"reason,omitempty"`
+	// Pending is the number of entries sequenced but not yet integrated.
+	Pending uint64 `json:"pending"`
+	// CheckpointAge is how long ago the checkpoint was published, in
+	// seconds.
+	CheckpointAge float64 `json:"checkpoint_age_seconds"`
+}
+
+// Admin takes operational actions on a log.
+type Admin struct {
+	dir    string
+	origin string
+	h      merkle.LogHasher
+	s      note.Signer
+	v      note.Verifier
+	token  []byte
+	policy log.ReleasePolicy
+	ts     note.Signer
+	// admission is the queue of submissions, if there's an admission
+	// policy.
+	admission *admissionQueue
+	// leaseHolder, if set, is the identity with which Integrate takes the
+	// lease on integrating the log, for leaseTTL, before publishing a
+	// checkpoint.
+	leaseHolder string
+	leaseTTL    time.Duration
+
+	// scheduled tracks the integration loops started by Schedule, which
+	// Shutdown cancels with stopScheduled.
+	scheduled     sync.WaitGroup
+	mu            sync.Mutex
+	stopScheduled []context.CancelFunc
+}
+
+// New returns an Admin for the log stored in dir, which signs checkpoints and
+// manifests with s. Requests must present token as a bearer token.
+func New(dir, origin string, h merkle.LogHasher, s note.Signer, v note.Verifier, token string) (*Admin, error) {
+	if len(token) == 0 {
+		return nil, errors.New("admin token must not be empty")
+	}
+	return &Admin{dir: dir, origin: origin, h: h, s: s, v: v, token: []byte(token)}, nil
+}
+
+// SetReleasePolicy sets the policy controlling which sequenced entries
+// Integrate releases into the tree. By default they're all released.
+func (a *Admin) SetReleasePolicy(p log.ReleasePolicy) {
+	a.policy = p
+}
+
+// SetTimestampSigner sets the log's timestamping key, with which Integrate
+// signs the time at which the published checkpoint was current each time
+// it's called, including when there's nothing to integrate. By default no
+// checkpoint time is published.
+func (a *Admin) SetTimestampSigner(s note.Signer) {
+	a.ts = s
+}
+
+// SetLease has Integrate take the lease on integrating the log, as the
+// integrator with the given identity, before publishing a checkpoint, so that
+// several servers sharing the log's storage can integrate it, with only one at
+// a time, the leader, publishing checkpoints. The leader renews the lease for
+// ttl each time Integrate is called, and if it stops, another takes over once
+// the lease expires. Checkpoints are written with the lease's fencing token,
+// so a former leader which carries on after losing the lease can't publish
+// one. By default no lease is taken.
+func (a *Admin) SetLease(holder string, ttl time.Duration) error {
+	if err := api.ValidateLeaseHolder(holder); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("lease TTL must be positive, got %v", ttl)
+	}
+	a.leaseHolder, a.leaseTTL = holder, ttl
+	return nil
+}
+
+// ReleaseLease gives up the lease set by SetLease, if it's held, so that
+// another server may take over without waiting for it to expire.
+func (a *Admin) ReleaseLease(ctx context.Context) error {
+	if len(a.leaseHolder) == 0 {
+		return nil
+	}
+	st, err := fs.Load(a.dir, 0)
+	if err != nil {
+		return fmt.Errorf("failed to load storage: %w", err)
+	}
+	return log.ReleaseLease(ctx, st, a.leaseHolder)
+}
+
+// Schedule runs loop, e.g. IntegrateEvery or IntegrateWhenDue with their
+// arguments bound, in the background until ctx is done or Shutdown is called.
+func (a *Admin) Schedule(ctx context.Context, loop func(context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.stopScheduled = append(a.stopScheduled, cancel)
+	a.mu.Unlock()
+	a.scheduled.Add(1)
+	go func() {
+		defer a.scheduled.Done()
+		loop(ctx)
+	}()
+}
+
+// Shutdown stops the loops started by Schedule, and waits for them to return,
+// so that no scheduled integration is in progress or can start. Then, if final
+// is set, it integrates once more, so that entries sequenced since the last
+// integration aren't left waiting for another server to take over, and gives
+// up the lease set by SetLease, if it's held. If the loops don't return before
+// ctx is done, the lease is left to expire.
+func (a *Admin) Shutdown(ctx context.Context, final bool) error {
+	a.mu.Lock()
+	for _, cancel := range a.stopScheduled {
+		cancel()
+	}
+	a.stopScheduled = nil
+	a.mu.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		a.scheduled.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("scheduled integration didn't stop: %w", ctx.Err())
+	}
+	if final {
+		if _, err := a.Integrate(ctx); errors.Is(err, log.ErrNotLeader) {
+			glog.V(1).Infof("Admin: not integrating before shutdown: %v", err)
+		} else if err != nil {
+			glog.Warningf("Admin: final integration failed: %v", err)
+		}
+	}
+	return a.ReleaseLease(ctx)
+}
+
+// Handler returns an http.Handler serving the actions above. It should be
+// served on a listener which isn't reachable by the log's clients.
+func (a *Admin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(IntegratePath, a.authorized(http.MethodPost, a.postIntegrate))
+	mux.HandleFunc(StatePath, a.authorized(http.MethodPost, a.postState))
+	mux.HandleFunc(StatsPath, a.authorized(http.MethodGet, a.getStats))
+	mux.HandleFunc(SubmissionsPath, a.authorized(http.MethodPost, a.postSubmissions))
+	mux.HandleFunc(SubmitterAuditPath, a.authorized(http.MethodGet, a.getSubmitterAudit))
+	mux.HandleFunc(EntryAuditPath, a.authorized(http.MethodGet, a.getEntryAudit))
+	return mux
+}
+
+// authorized wraps h so that it only serves requests with the given method
+// which present the admin token.
+func (a *Admin) authorized(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		tok := strings.TrimPrefix(auth, "Bearer ")
+		if tok == auth || subtle.ConstantTimeCompare([]byte(tok), a.token) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="serverless-admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		h(w, r)
+	}
+}
+
+func (a *Admin) postIntegrate(w http.ResponseWriter, r *http.Request) {
+	cp, err := a.Integrate(r.Context())
+	if err != nil {
+		writeError(w, "integrate", err)
+		return
+	}
+	writeJSON(w, struct {
+		Size uint64 `json:"size"`
+		Root []byte `json:"root"`
+	}{Size: cp.Size, Root: cp.Hash})
+}
+
+func (a *Admin) postState(w http.ResponseWriter, r *http.Request) {
+	state := api.LogState(r.FormValue("state"))
+	reason := r.FormValue("reason")
+	if !state.Valid() {
+		http.Error(w, fmt.Sprintf("state must be one of %q, %q, or %q", api.StateActive, api.StateFrozen, api.StateReadOnly), http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(reason, "\n") {
+		http.Error(w, "reason must be a single line", http.StatusBadRequest)
+		return
+	}
+	if err := a.SetState(r.Context(), state, reason); err != nil {
+		writeError(w, "set state", err)
+		return
+	}
+	writeJSON(w, struct {
+		State api.LogState `json:"state"`
+	}{State: state})
+}
+
+func (a *Admin) getStats(w http.ResponseWriter, r *http.Request) {
+	st, err := a.Stats(r.Context())
+	if err != nil {
+		writeError(w, "read stats", err)
+		return
+	}
+	writeJSON(w, st)
+}
+
+// Integrate integrates the sequenced entries due to be released by the
+// release policy into the log and publishes a new checkpoint, which is
+// returned. Extension lines of the previous checkpoint, such as the identifier
+// map root, are carried over. If there's nothing to integrate the current
+// checkpoint is returned. If a lease has been set with SetLease and another
+// server holds it, an error wrapping log.ErrNotLeader is returned.
+func (a *Admin) Integrate(ctx context.Context) (*fmtlog.Checkpoint, error) {
+	unlock, err := a.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer a.unlock(unlock)
+
+	// Integration doesn't sequence entries, so the storage needn't be told
+	// the size of the log.
+	st, err := fs.Load(a.dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage: %w", err)
+	}
+	// Only the leader may publish a checkpoint. If another server holds the
+	// lease, this is a conflict like any other.
+	var lease *api.Lease
+	if len(a.leaseHolder) > 0 {
+		if lease, err = log.AcquireLease(ctx, st, a.leaseHolder, a.leaseTTL); err != nil {
+			return nil, err
+		}
+	}
+	// The new checkpoint is only written if this one is still current, so
+	// that an update by a writer which doesn't respect the lock isn't
+	// overwritten.
+	raw, gen, err := st.ReadGeneration(ctx, layout.CheckpointPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	cp, ext, err := a.openCheckpoint(raw)
+	if err != nil {
+		return nil, err
+	}
+	m, err := a.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !m.State.Integrates() {
+		return nil, fmt.Errorf("log is %s: %w", m.State, errConflict)
+	}
+	if m.Final != nil {
+		return nil, fmt.Errorf("log was closed at size %d: %w", m.Final.Size, errConflict)
+	}
+	st.SetImmutable(m.Immutable)
+	st.SetPrefixIndex(m.PrefixIndex)
+	st.SetIndexFormat(m.IndexFormat)
+	st.SetPartialTiles(m.PartialTiles)
+	newCp, err := log.IntegrateBatch(ctx, *cp, st, a.h, a.policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to integrate: %w", err)
+	}
+	if newCp == nil {
+		// Catch up on any timestamps which failed to be published last time.
+		a.updateTimestamps(ctx, m, st, *cp)
+		a.updateCheckpointTime(*cp)
+		return cp, nil
+	}
+	if err := log.VerifyAppendOnly(ctx, a.h, a.fetcher(), *cp, *newCp); err != nil {
+		return nil, fmt.Errorf("refusing to publish new checkpoint: %w", err)
+	}
+	newCp.Origin = a.origin
+	cpRaw, err := note.Sign(&note.Note{Text: string(newCp.Marshal()) + string(ext)}, a.s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	if lease != nil {
+		err = st.WriteIfFenced(ctx, layout.CheckpointPath, cpRaw, gen, lease.Token)
+	} else {
+		err = st.WriteIfGeneration(ctx, layout.CheckpointPath, cpRaw, gen)
+	}
+	if errors.Is(err, log.ErrFenced) {
+		return nil, fmt.Errorf("lease was lost during integration: %w", err)
+	} else if errors.Is(err, log.ErrStorageConflict) {
+		return nil, fmt.Errorf("checkpoint was updated during integration: %w", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to store checkpoint: %w", err)
+	}
+	// Any previously staged checkpoint has now been superseded.
+	if err := st.RemoveStagedCheckpoint(ctx); err != nil {
+		glog.Warningf("Failed to remove staged checkpoint: %v", err)
+	}
+	glog.Infof("Admin: published checkpoint for tree size %d", newCp.Size)
+	a.updateTimestamps(ctx, m, st, *newCp)
+	a.updateCheckpointTime(*newCp)
+	return newCp, nil
+}
+
+// updateCheckpointTime signs the time at which the published checkpoint cp is
+// current with the timestamping key, if there is one. Since cp has already
+// been published, failures are only logged, and clients see a stale
+// checkpoint time until the next time this is called.
+func (a *Admin) updateCheckpointTime(cp fmtlog.Checkpoint) {
+	if a.ts == nil {
+		return
+	}
+	raw, err := log.SignCheckpointTime(cp, a.ts, time.Now())
+	if err != nil {
+		glog.Warningf("Admin: %v", err)
+		return
+	}
+	if err := fs.WriteCheckpointTime(a.dir, raw); err != nil {
+		glog.Warningf("Admin: failed to write checkpoint time: %v", err)
+	}
+}
+
+// updateTimestamps extends the timestamp log to cover the entries committed to
+// by the published checkpoint cp, if the log publishes timestamps. Since cp has
+// already been published, failures are only logged, and the timestamp log
+// catches up the next time this is called.
+func (a *Admin) updateTimestamps(ctx context.Context, m *api.Manifest, st *fs.Storage, cp fmtlog.Checkpoint) {
+	if !m.Timestamps {
+		return
+	}
+	tst, err := fs.Load(filepath.Join(a.dir, layout.TimestampsDir), 0)
+	if err != nil {
+		glog.Warningf("Admin: failed to load timestamp log: %v", err)
+		return
+	}
+	tst.SetImmutable(m.Immutable)
+	if err := log.PublishTimestamps(ctx, a.h, st, tst, client.ShardFetcher(a.fetcher(), layout.TimestampsDir), a.s, a.v, a.origin, cp.Size); err != nil {
+		glog.Warningf("Admin: failed to update timestamp log to tree size %d: %v", cp.Size, err)
+	}
+}
+
+// IntegrateEvery calls Integrate at each multiple of interval since the Unix
+// epoch until ctx is done. Since entries are only released on this fixed
+// schedule, the times at which the log grows don't reveal when they were
+// submitted. Failures are logged, and retried at the next interval.
+func (a *Admin) IntegrateEvery(ctx context.Context, interval time.Duration) {
+	for {
+		now := time.Now()
+		t := time.NewTimer(now.Truncate(interval).Add(interval).Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		a.scheduledIntegrate(ctx)
+	}
+}
+
+// scheduledIntegrate calls Integrate, logging any failure. Finding that
+// another server holds the lease is expected of all but the leader, so isn't
+// logged as a failure.
+func (a *Admin) scheduledIntegrate(ctx context.Context) {
+	if _, err := a.Integrate(ctx); errors.Is(err, log.ErrNotLeader) {
+		glog.V(1).Infof("Admin: not integrating: %v", err)
+	} else if err != nil {
+		glog.Warningf("Admin: scheduled integration failed: %v", err)
+	}
+}
+
+// IntegrateWhenDue checks every poll interval whether a new checkpoint is due
+// under p, and if so calls Integrate, until ctx is done. The time of the last
+// checkpoint is taken from the stored checkpoint, so the policy holds across
+// restarts. Failures are logged, and retried at the next check.
+func (a *Admin) IntegrateWhenDue(ctx context.Context, p log.IntegrationPolicy, poll time.Duration) {
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		due, err := a.due(ctx, p)
+		if err != nil {
+			glog.Warningf("Admin: failed to check whether integration is due: %v", err)
+			continue
+		}
+		if !due {
+			continue
+		}
+		a.scheduledIntegrate(ctx)
+	}
+}
+
+// due returns true if a new checkpoint is due under p, counting only the
+// pending entries which the release policy would release.
+func (a *Admin) due(ctx context.Context, p log.IntegrationPolicy) (bool, error) {
+	cp, _, err := a.checkpoint()
+	if err != nil {
+		return false, err
+	}
+	st, err := fs.Load(a.dir, cp.Size)
+	if err != nil {
+		return false, fmt.Errorf("failed to load storage: %w", err)
+	}
+	pending, err := st.ScanSequenced(ctx, cp.Size, func(uint64, []byte) error { return nil })
+	if err != nil {
+		return false, fmt.Errorf("failed to count pending entries: %w", err)
+	}
+	release, padding := a.policy.Release(pending)
+	if release == 0 {
+		return false, nil
+	}
+	oldest, err := st.SequencedTime(ctx, cp.Size)
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(filepath.Join(a.dir, layout.CheckpointPath))
+	if err != nil {
+		return false, fmt.Errorf("failed to stat checkpoint: %w", err)
+	}
+	return p.Due(time.Now(), fi.ModTime(), release+padding, oldest), nil
+}
+
+// SetState publishes a new manifest putting the log into the given state.
+func (a *Admin) SetState(ctx context.Context, state api.LogState, reason string) error {
+	// Hold the integration lock so that no integration straddles the state
+	// change.
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer a.unlock(unlock)
+
+	old, err := a.manifest(ctx)
+	if err != nil {
+		return err
+	}
+	if !old.State.CanBecome(state) {
+		return fmt.Errorf("log is %s, and can't be made %s: %w", old.State, state, errConflict)
+	}
+	m := *old
+	m.State = state
+	m.Reason = reason
+	mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, a.s)
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	if err := fs.WriteManifest(a.dir, mRaw); err != nil {
+		return fmt.Errorf("failed to store manifest: %w", err)
+	}
+	glog.Infof("Admin: log is now %s", state)
+	return nil
+}
+
+// Stats returns the current state of the log.
+func (a *Admin) Stats(ctx context.Context) (*Stats, error) {
+	cp, _, err := a.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	m, err := a.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st, err := fs.Load(a.dir, cp.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage: %w", err)
+	}
+	pending, err := st.ScanSequenced(ctx, cp.Size, func(uint64, []byte) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending entries: %w", err)
+	}
+	fi, err := os.Stat(filepath.Join(a.dir, layout.CheckpointPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat checkpoint: %w", err)
+	}
+	return &Stats{
+		Origin:        a.origin,
+		Size:          cp.Size,
+		Root:          cp.Hash,
+		State:         m.State,
+		Reason:        m.Reason,
+		Pending:       pending,
+		CheckpointAge: time.Since(fi.ModTime()).Seconds(),
+	}, nil
+}
+
+func (a *Admin) lock() (func() error, error) {
+	unlock, err := fs.Lock(a.dir)
+	if errors.Is(err, log.ErrStorageConflict) {
+		return nil, fmt.Errorf("log is locked by another integration: %w", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock storage: %w", err)
+	}
+	return unlock, nil
+}
+
+func (a *Admin) unlock(unlock func() error) {
+	if err := unlock(); err != nil {
+		glog.Warningf("Failed to unlock storage: %v", err)
+	}
+}
+
+func (a *Admin) fetcher() client.Fetcher {
+	return client.NewFSFetcher(os.DirFS(a.dir))
+}
+
+// checkpoint returns the verified checkpoint of the log, and its extension
+// lines.
+func (a *Admin) checkpoint() (*fmtlog.Checkpoint, []byte, error) {
+	raw, err := fs.ReadCheckpoint(a.dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return a.openCheckpoint(raw)
+}
+
+// openCheckpoint verifies and parses the raw checkpoint, returning it along
+// with its extension lines.
+func (a *Admin) openCheckpoint(raw []byte) (*fmtlog.Checkpoint, []byte, error) {
+	cp, ext, _, err := fmtlog.ParseCheckpoint(raw, a.origin, a.v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	return cp, ext, nil
+}
+
+func (a *Admin) manifest(ctx context.Context) (*api.Manifest, error) {
+	m, err := client.FetchManifest(ctx, a.fetcher(), a.v, a.origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return m, nil
+}
+
+func writeError(w http.ResponseWriter, action string, err error) {
+	if errors.Is(err, errConflict) || errors.Is(err, log.ErrStorageConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	glog.Warningf("Admin: failed to %s: %v", action, err)
+	http.Error(w, fmt.Sprintf("failed to %s: %v", action, err), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		glog.Warningf("Admin: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,513 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/google/trillian-examples/serverless/testdata"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+const token = "s3cret"
+
+// newLog creates an empty log as the integrate tool's --initialise does, with
+// n entries sequenced but not integrated.
+func newLog(t *testing.T, n int) (string, *fs.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	dir := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(dir)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	cp := fmtlog.Checkpoint{Origin: testdata.TestLogOrigin, Hash: h.EmptyRoot()}
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, testdata.LogSigner(t))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpRaw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+	m := api.Manifest{Origin: testdata.TestLogOrigin, State: api.StateActive, Created: time.Now()}
+	mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, testdata.LogSigner(t))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := fs.WriteManifest(dir, mRaw); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	return dir, st
+}
+
+func newTestServer(t *testing.T, dir string) *httptest.Server {
+	t.Helper()
+	a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(a.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func do(t *testing.T, method, u, tok string, form url.Values) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(tok) > 0 {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func stats(t *testing.T, ts *httptest.Server) Stats {
+	t.Helper()
+	code, body := do(t, http.MethodGet, ts.URL+StatsPath, token, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Stats: status %d: %s", code, body)
+	}
+	var s Stats
+	if err := json.Unmarshal(body, &s); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return s
+}
+
+func TestAuthentication(t *testing.T) {
+	dir, _ := newLog(t, 0)
+	ts := newTestServer(t, dir)
+	for _, test := range []struct {
+		desc   string
+		method string
+		path   string
+		tok    string
+		want   int
+	}{
+		{desc: "no token", method: http.MethodGet, path: StatsPath, want: http.StatusUnauthorized},
+		{desc: "wrong token", method: http.MethodGet, path: StatsPath, tok: "guess", want: http.StatusUnauthorized},
+		{desc: "wrong token for action", method: http.MethodPost, path: IntegratePath, tok: "s3cre", want: http.StatusUnauthorized},
+		{desc: "wrong method", method: http.MethodGet, path: IntegratePath, tok: token, want: http.StatusMethodNotAllowed},
+		{desc: "ok", method: http.MethodGet, path: StatsPath, tok: token, want: http.StatusOK},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if code, body := do(t, test.method, ts.URL+test.path, test.tok, nil); code != test.want {
+				t.Errorf("Got status %d (%s), want %d", code, body, test.want)
+			}
+		})
+	}
+	if _, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), ""); err == nil {
+		t.Error("New accepted empty token")
+	}
+}
+
+func TestActions(t *testing.T) {
+	dir, _ := newLog(t, 5)
+	ts := newTestServer(t, dir)
+
+	if got := stats(t, ts); got.Size != 0 || got.Pending != 5 || got.State != api.StateActive {
+		t.Errorf("Got stats %+v, want size 0 with 5 pending", got)
+	}
+	if code, body := do(t, http.MethodPost, ts.URL+IntegratePath, token, nil); code != http.StatusOK {
+		t.Fatalf("Integrate: status %d: %s", code, body)
+	}
+	cpRaw, err := fs.ReadCheckpoint(dir)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, testdata.TestLogOrigin, testdata.LogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("ParseCheckpoint: %v", err)
+	}
+	if cp.Size != 5 {
+		t.Errorf("Published checkpoint has size %d, want 5", cp.Size)
+	}
+	if got := stats(t, ts); got.Size != 5 || got.Pending != 0 {
+		t.Errorf("Got stats %+v, want size 5 with none pending", got)
+	}
+
+	if code, body := do(t, http.MethodPost, ts.URL+StatePath, token, url.Values{"state": {"frozen"}, "reason": {"maintenance"}}); code != http.StatusOK {
+		t.Fatalf("SetState: status %d: %s", code, body)
+	}
+	if got := stats(t, ts); got.State != api.StateFrozen || got.Reason != "maintenance" {
+		t.Errorf("Got stats %+v, want frozen for maintenance", got)
+	}
+	if code, _ := do(t, http.MethodPost, ts.URL+IntegratePath, token, nil); code != http.StatusConflict {
+		t.Errorf("Integrate frozen log: status %d, want %d", code, http.StatusConflict)
+	}
+	if code, _ := do(t, http.MethodPost, ts.URL+StatePath, token, url.Values{"state": {"sleeping"}}); code != http.StatusBadRequest {
+		t.Errorf("SetState to invalid state: status %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, body := do(t, http.MethodPost, ts.URL+StatePath, token, url.Values{"state": {"read-only"}}); code != http.StatusOK {
+		t.Fatalf("SetState: status %d: %s", code, body)
+	}
+	if code, _ := do(t, http.MethodPost, ts.URL+StatePath, token, url.Values{"state": {"active"}}); code != http.StatusConflict {
+		t.Errorf("SetState of read-only log to active: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestIntegrateLocked(t *testing.T) {
+	dir, _ := newLog(t, 1)
+	ts := newTestServer(t, dir)
+	unlock, err := fs.Lock(dir)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer unlock()
+	if code, _ := do(t, http.MethodPost, ts.URL+IntegratePath, token, nil); code != http.StatusConflict {
+		t.Errorf("Integrate locked log: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestIntegrateLease(t *testing.T) {
+	ctx := context.Background()
+	dir, st := newLog(t, 2)
+	var as []*Admin
+	for _, holder := range []string{"a", "b"} {
+		a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if err := a.SetLease(holder, time.Minute); err != nil {
+			t.Fatalf("SetLease: %v", err)
+		}
+		as = append(as, a)
+	}
+	if cp, err := as[0].Integrate(ctx); err != nil || cp.Size != 2 {
+		t.Fatalf("Integrate by leader = %v, %v, want size 2", cp, err)
+	}
+	l := []byte("leaf 2")
+	if _, err := st.Sequence(ctx, rfc6962.DefaultHasher.HashLeaf(l), l); err != nil {
+		t.Fatalf("Sequence: %v", err)
+	}
+	if _, err := as[1].Integrate(ctx); !errors.Is(err, log.ErrNotLeader) {
+		t.Fatalf("Integrate by follower = %v, want ErrNotLeader", err)
+	}
+
+	// Once the leader steps down, the other server takes over.
+	if err := as[0].ReleaseLease(ctx); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	if cp, err := as[1].Integrate(ctx); err != nil || cp.Size != 3 {
+		t.Fatalf("Integrate by new leader = %v, %v, want size 3", cp, err)
+	}
+	if _, err := as[0].Integrate(ctx); !errors.Is(err, log.ErrNotLeader) {
+		t.Errorf("Integrate by former leader = %v, want ErrNotLeader", err)
+	}
+}
+
+func TestIntegrateEvery(t *testing.T) {
+	dir, _ := newLog(t, 5)
+	a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.SetReleasePolicy(log.ReleasePolicy{BatchSize: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.IntegrateEvery(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s, err := a.Stats(context.Background())
+		if err != nil {
+			t.Fatalf("Stats: %v", err)
+		}
+		if s.Size > 0 {
+			// Only a whole batch of entries may be released.
+			if s.Size != 4 || s.Pending != 1 {
+				t.Errorf("Got stats %+v, want size 4 with 1 pending", s)
+			}
+			return
+		}
+	}
+	t.Error("Scheduled integration didn't integrate any entries")
+}
+
+// leaseHeld returns true if the lease on integrating the log in dir is held.
+func leaseHeld(t *testing.T, dir string) bool {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join(dir, layout.LeasePath))
+	if err != nil {
+		t.Errorf("ReadFile: %v", err)
+		return false
+	}
+	l, err := api.ParseLease(raw)
+	if err != nil {
+		t.Errorf("ParseLease: %v", err)
+		return false
+	}
+	return time.Now().Before(l.Expires)
+}
+
+func TestShutdown(t *testing.T) {
+	for _, test := range []struct {
+		final    bool
+		wantSize uint64
+	}{
+		{final: false, wantSize: 2},
+		{final: true, wantSize: 3},
+	} {
+		t.Run(fmt.Sprintf("final=%t", test.final), func(t *testing.T) {
+			ctx := context.Background()
+			dir, st := newLog(t, 2)
+			a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if err := a.SetLease("a", time.Minute); err != nil {
+				t.Fatalf("SetLease: %v", err)
+			}
+			if _, err := a.Integrate(ctx); err != nil {
+				t.Fatalf("Integrate: %v", err)
+			}
+			// The loop is slow to stop, as if an integration were in
+			// progress, and must still hold the lease once it has.
+			stopped := false
+			a.Schedule(ctx, func(ctx context.Context) {
+				<-ctx.Done()
+				time.Sleep(50 * time.Millisecond)
+				if !leaseHeld(t, dir) {
+					t.Error("Lease was released before scheduled integration stopped")
+				}
+				stopped = true
+			})
+			l := []byte("leaf 2")
+			if _, err := st.Sequence(ctx, rfc6962.DefaultHasher.HashLeaf(l), l); err != nil {
+				t.Fatalf("Sequence: %v", err)
+			}
+
+			if err := a.Shutdown(ctx, test.final); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+			if !stopped {
+				t.Error("Shutdown returned before scheduled integration stopped")
+			}
+			if leaseHeld(t, dir) {
+				t.Error("Lease still held after Shutdown")
+			}
+			s, err := a.Stats(ctx)
+			if err != nil {
+				t.Fatalf("Stats: %v", err)
+			}
+			if s.Size != test.wantSize {
+				t.Errorf("Got size %d after Shutdown, want %d", s.Size, test.wantSize)
+			}
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	dir, _ := newLog(t, 1)
+	a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.SetLease("a", time.Minute); err != nil {
+		t.Fatalf("SetLease: %v", err)
+	}
+	if _, err := a.Integrate(context.Background()); err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	a.Schedule(context.Background(), func(context.Context) { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Shutdown(ctx, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+	// A loop which may still integrate must keep the lease.
+	if !leaseHeld(t, dir) {
+		t.Error("Lease was released while scheduled integration was running")
+	}
+}
+
+func TestIntegrateTimestamps(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	dir, _ := newLog(t, 3)
+	m := api.Manifest{Origin: testdata.TestLogOrigin, State: api.StateActive, Timestamps: true}
+	mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, testdata.LogSigner(t))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := fs.WriteManifest(dir, mRaw); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	tst, err := fs.Create(filepath.Join(dir, layout.TimestampsDir))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	tcp := fmtlog.Checkpoint{Origin: api.TimestampsOrigin(testdata.TestLogOrigin), Hash: h.EmptyRoot()}
+	tcpRaw, err := note.Sign(&note.Note{Text: string(tcp.Marshal())}, testdata.LogSigner(t))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := tst.WriteCheckpoint(ctx, tcpRaw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+
+	a, err := New(dir, testdata.TestLogOrigin, h, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := a.Integrate(ctx); err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	for i := uint64(0); i < 3; i++ {
+		lh := h.HashLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+		if _, err := client.FetchTimestamp(ctx, a.fetcher(), h, testdata.LogSigVerifier(t), testdata.TestLogOrigin, i, lh); err != nil {
+			t.Errorf("FetchTimestamp(%d): %v", i, err)
+		}
+	}
+}
+
+func TestIntegrateCheckpointTime(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	dir, _ := newLog(t, 3)
+	sk, vk, err := note.GenerateKey(rand.Reader, "timestamps")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(sk)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vk)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	a, err := New(dir, testdata.TestLogOrigin, h, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.SetTimestampSigner(s)
+
+	// The checkpoint is timestamped when it's published, and again when
+	// there's nothing to integrate.
+	for i := 0; i < 2; i++ {
+		before := time.Now().Truncate(time.Second)
+		cp, err := a.Integrate(ctx)
+		if err != nil {
+			t.Fatalf("Integrate: %v", err)
+		}
+		got, err := client.FetchCheckpointTime(ctx, a.fetcher(), note.VerifierList(v), *cp)
+		if err != nil {
+			t.Fatalf("FetchCheckpointTime: %v", err)
+		}
+		if cp.Size != 3 || got.Before(before) {
+			t.Errorf("Integrate %d: checkpoint of size %d timestamped at %v, want size 3 timestamped since %v", i, cp.Size, got, before)
+		}
+	}
+}
+
+func TestIntegrateWhenDue(t *testing.T) {
+	ctx := context.Background()
+	dir, _ := newLog(t, 2)
+	a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, test := range []struct {
+		desc string
+		p    log.IntegrationPolicy
+		want bool
+	}{
+		{desc: "immediate", want: true},
+		{desc: "batch too small", p: log.IntegrationPolicy{MinBatchSize: 3}},
+		{desc: "latency reached", p: log.IntegrationPolicy{MinBatchSize: 3, MaxLatency: time.Nanosecond}, want: true},
+		{desc: "too soon", p: log.IntegrationPolicy{MinInterval: time.Hour}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := a.due(ctx, test.p)
+			if err != nil {
+				t.Fatalf("due: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("due = %t, want %t", got, test.want)
+			}
+		})
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		a.IntegrateWhenDue(cctx, log.IntegrationPolicy{MinBatchSize: 3, MaxLatency: 50 * time.Millisecond}, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s, err := a.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Stats: %v", err)
+		}
+		if s.Size == 2 {
+			return
+		}
+	}
+	t.Error("Entries weren't integrated once their maximum latency passed")
+}
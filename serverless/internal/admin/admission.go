@@ -0,0 +1,217 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+// AdmissionPolicy configures the queue in which SequenceSubmissions holds
+// submitted objects, so that those which arrive together are sequenced as a
+// batch, in order of priority. Urgent entries, such as revocations, then get
+// the lowest sequence numbers in their batch.
+//
+// Priorities only affect the order of entries within a batch. Each batch is
+// sequenced in full, in the order the batches were opened, so an entry of the
+// lowest priority is never held back for longer than its own batch takes,
+// however many urgent entries follow it. Within a priority class, submitters
+// take turns, so that one submitter's burst can't push the entries of others
+// to the end of the class.
+//
+// If sequencing a batch fails, the request of every event in it fails, and
+// the events are retried, which is safe since objects which were sequenced
+// keep their sequence numbers.
+type AdmissionPolicy struct {
+	// Window is how long a batch stays open for submissions after the first
+	// one arrives.
+	Window time.Duration
+	// MaxBatchSize, if set, closes a batch early once it holds at least this
+	// many objects.
+	MaxBatchSize int
+	// Classes are the key prefixes of the objects in each priority class,
+	// relative to the submissions/ directory, highest priority first.
+	// Objects are in the class of the first prefix their key has, or in a
+	// class below all of them if it has none.
+	Classes []string
+}
+
+// class returns the priority class of the object with the given key, where 0
+// is the highest priority.
+func (p AdmissionPolicy) class(key string) int {
+	rel := strings.TrimPrefix(key, layout.SubmissionsDir+"/")
+	for i, c := range p.Classes {
+		if strings.HasPrefix(rel, c) {
+			return i
+		}
+	}
+	return len(p.Classes)
+}
+
+// order returns the indices of subs, listed in order of arrival, in the order
+// they should be sequenced: by priority class, and within a class taking one
+// object from each submitter in turn, in the order the submitters first
+// arrived.
+func (p AdmissionPolicy) order(subs []*submission) []int {
+	classes := make([][][]int, len(p.Classes)+1)
+	turns := make([]map[string]int, len(classes))
+	for i, s := range subs {
+		c := p.class(s.key)
+		if turns[c] == nil {
+			turns[c] = make(map[string]int)
+		}
+		t, ok := turns[c][s.submitter]
+		if !ok {
+			t = len(classes[c])
+			turns[c][s.submitter] = t
+			classes[c] = append(classes[c], nil)
+		}
+		classes[c][t] = append(classes[c][t], i)
+	}
+	r := make([]int, 0, len(subs))
+	for _, queues := range classes {
+		for round := 0; len(queues) > 0; round++ {
+			left := queues[:0]
+			for _, q := range queues {
+				r = append(r, q[round])
+				if round+1 < len(q) {
+					left = append(left, q)
+				}
+			}
+			queues = left
+		}
+	}
+	return r
+}
+
+// SetAdmissionPolicy sets the policy of the queue in which
+// SequenceSubmissions holds submitted objects. By default there's no queue,
+// and the objects of each event are sequenced as soon as it arrives.
+func (a *Admin) SetAdmissionPolicy(p AdmissionPolicy) error {
+	if p.Window <= 0 {
+		return errors.New("admission window must be positive")
+	}
+	if p.MaxBatchSize < 0 {
+		return errors.New("maximum batch size must not be negative")
+	}
+	for _, c := range p.Classes {
+		if len(c) == 0 {
+			return errors.New("priority class prefix must not be empty")
+		}
+	}
+	a.admission = &admissionQueue{p: p, seq: a.sequenceSubmissions}
+	return nil
+}
+
+// admissionQueue batches submissions as described by AdmissionPolicy.
+type admissionQueue struct {
+	p   AdmissionPolicy
+	seq func(context.Context, []*submission) ([]Submission, error)
+
+	mu sync.Mutex
+	// open is the batch accepting submissions, if any.
+	open *batch
+	// last is the most recently opened batch, which the next must wait for.
+	last *batch
+}
+
+// batch is a set of submissions which are sequenced together.
+type batch struct {
+	subs []*submission
+	// full is closed once the batch has reached the maximum size.
+	full chan struct{}
+	// done is closed once the batch has been sequenced, with the outcome of
+	// each submission in r, or err set.
+	done chan struct{}
+	r    []Submission
+	err  error
+}
+
+// submit adds subs to the open batch, opening one if needed, and waits for it
+// to be sequenced. If ctx is done first, the submissions may still be
+// sequenced.
+func (q *admissionQueue) submit(ctx context.Context, subs []*submission) ([]Submission, error) {
+	if len(subs) == 0 {
+		return q.seq(ctx, subs)
+	}
+	q.mu.Lock()
+	b := q.open
+	if b == nil {
+		b = &batch{full: make(chan struct{}), done: make(chan struct{})}
+		q.open = b
+		go q.run(b, q.last)
+		q.last = b
+	}
+	first := len(b.subs)
+	b.subs = append(b.subs, subs...)
+	if q.p.MaxBatchSize > 0 && len(b.subs) >= q.p.MaxBatchSize {
+		q.open = nil
+		close(b.full)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.r[first : first+len(subs)], nil
+}
+
+// run closes the batch b at the end of the admission window, or once it's
+// full, and sequences it once the batch prev before it is done.
+func (q *admissionQueue) run(b, prev *batch) {
+	select {
+	case <-time.After(q.p.Window):
+		q.mu.Lock()
+		if q.open == b {
+			q.open = nil
+		}
+		q.mu.Unlock()
+	case <-b.full:
+	}
+	if prev != nil {
+		<-prev.done
+	}
+	defer close(b.done)
+
+	// The batch is sequenced on behalf of all its submitters, so it isn't
+	// cancelled along with any one of their requests.
+	order := q.p.order(b.subs)
+	sorted := make([]*submission, len(order))
+	for i, j := range order {
+		sorted[i] = b.subs[j]
+	}
+	r, err := q.seq(context.Background(), sorted)
+	if err != nil {
+		b.err = fmt.Errorf("failed to sequence batch of %d submissions: %w", len(sorted), err)
+		return
+	}
+	b.r = make([]Submission, len(r))
+	for i, j := range order {
+		b.r[j] = r[i]
+	}
+	glog.V(1).Infof("Admin: sequenced batch of %d submissions", len(r))
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/testdata"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestAdmissionOrder(t *testing.T) {
+	p := AdmissionPolicy{Window: time.Second, Classes: []string{"revocations/", "security/"}}
+	var subs []*submission
+	for _, s := range []struct{ key, submitter string }{
+		{"submissions/bulk/1", "noisy"},
+		{"submissions/bulk/2", "noisy"},
+		{"submissions/bulk/3", "noisy"},
+		{"submissions/security/1", "scanner"},
+		{"submissions/bulk/4", "quiet"},
+		{"submissions/revocations/1", ""},
+		{"submissions/security/2", "scanner"},
+		{"submissions/bulk/5", ""},
+	} {
+		subs = append(subs, &submission{key: s.key, submitter: s.submitter})
+	}
+	// Revocations first, then security entries, then the rest with each
+	// submitter taking turns.
+	want := []int{5, 3, 6, 0, 4, 7, 1, 2}
+	if diff := cmp.Diff(p.order(subs), want); diff != "" {
+		t.Errorf("order had diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestSetAdmissionPolicy(t *testing.T) {
+	a, err := New(t.TempDir(), testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, p := range []AdmissionPolicy{
+		{},
+		{Window: time.Second, MaxBatchSize: -1},
+		{Window: time.Second, Classes: []string{""}},
+	} {
+		if err := a.SetAdmissionPolicy(p); err == nil {
+			t.Errorf("SetAdmissionPolicy(%+v) succeeded, want error", p)
+		}
+	}
+}
+
+func TestAdmissionQueue(t *testing.T) {
+	ctx := context.Background()
+	dir, _ := newLog(t, 0)
+	a, err := New(dir, testdata.TestLogOrigin, rfc6962.DefaultHasher, testdata.LogSigner(t), testdata.LogSigVerifier(t), token)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// The batch is closed by its size, rather than the window running out.
+	if err := a.SetAdmissionPolicy(AdmissionPolicy{Window: time.Hour, MaxBatchSize: 3, Classes: []string{"revocations/"}}); err != nil {
+		t.Fatalf("SetAdmissionPolicy: %v", err)
+	}
+	event := func(keys ...string) S3Event {
+		var ev S3Event
+		for _, k := range keys {
+			p := filepath.Join(dir, filepath.FromSlash(k))
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatalf("MkdirAll: %v", err)
+			}
+			if err := os.WriteFile(p, []byte(k), 0o644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			var r S3EventRecord
+			r.EventName = "ObjectCreated:Put"
+			r.S3.Bucket.Name = "my-log"
+			r.S3.Object.Key = k
+			r.S3.Object.Sequencer = "01"
+			ev.Records = append(ev.Records, r)
+		}
+		return ev
+	}
+	evs := []S3Event{
+		event("submissions/bulk/1", "submissions/bulk/2"),
+		event("submissions/revocations/1"),
+	}
+	got := make([][]Submission, len(evs))
+	var wg sync.WaitGroup
+	for i, ev := range evs {
+		i, ev := i, ev
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := a.SequenceSubmissions(ctx, ev)
+			if err != nil {
+				t.Errorf("SequenceSubmissions: %v", err)
+			}
+			got[i] = r
+		}()
+	}
+	wg.Wait()
+	want := [][]Submission{
+		{{Key: "submissions/bulk/1", Seq: 1}, {Key: "submissions/bulk/2", Seq: 2}},
+		{{Key: "submissions/revocations/1", Seq: 0}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("SequenceSubmissions had diff (-got +want):\n%s", diff)
+	}
+
+	// A cancelled request doesn't stop its submissions being sequenced.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := a.SequenceSubmissions(cctx, event("submissions/bulk/3")); err == nil {
+		t.Error("SequenceSubmissions with cancelled context succeeded")
+	}
+	r, err := a.SequenceSubmissions(ctx, event("submissions/bulk/4", "submissions/bulk/3"))
+	if err != nil {
+		t.Fatalf("SequenceSubmissions: %v", err)
+	}
+	if want := []Submission{{Key: "submissions/bulk/4", Seq: 4}, {Key: "submissions/bulk/3", Seq: 3}}; !cmp.Equal(r, want) {
+		t.Errorf("SequenceSubmissions = %+v, want %+v", r, want)
+	}
+}
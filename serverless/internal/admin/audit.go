@@ -0,0 +1,118 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+)
+
+// AuditedSubmission is a submission recorded in the audit log of a
+// submitter's submissions.
+type AuditedSubmission struct {
+	Time     time.Time `json:"time"`
+	Seq      uint64    `json:"seq"`
+	LeafHash []byte    `json:"leaf_hash"`
+}
+
+// Submissions returns the submissions made by the submitter with the given
+// identity at or after from and before to, oldest first, for investigating
+// abuse of authenticated submission.
+func (a *Admin) Submissions(ctx context.Context, submitter string, from, to time.Time) ([]AuditedSubmission, error) {
+	if err := api.ValidateSubmitter(submitter); err != nil {
+		return nil, err
+	}
+	st, err := fs.Load(a.dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage: %w", err)
+	}
+	recs, err := st.Submissions(ctx, submitter, from, to)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]AuditedSubmission, 0, len(recs))
+	for _, rec := range recs {
+		r = append(r, AuditedSubmission{Time: rec.Time.UTC(), Seq: rec.Seq, LeafHash: rec.LeafHash})
+	}
+	return r, nil
+}
+
+func (a *Admin) getSubmitterAudit(w http.ResponseWriter, r *http.Request) {
+	submitter := r.FormValue("submitter")
+	if err := api.ValidateSubmitter(submitter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := parseTime(r.FormValue("from"), time.Time{})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(r.FormValue("to"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+		return
+	}
+	subs, err := a.Submissions(r.Context(), submitter, from, to)
+	if err != nil {
+		writeError(w, "read submitter audit log", err)
+		return
+	}
+	writeJSON(w, struct {
+		Submitter   string              `json:"submitter"`
+		Submissions []AuditedSubmission `json:"submissions"`
+	}{Submitter: submitter, Submissions: subs})
+}
+
+func (a *Admin) getEntryAudit(w http.ResponseWriter, r *http.Request) {
+	seq, err := strconv.ParseUint(r.FormValue("seq"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid seq %q", r.FormValue("seq")), http.StatusBadRequest)
+		return
+	}
+	st, err := fs.Load(a.dir, 0)
+	if err != nil {
+		writeError(w, "load storage", err)
+		return
+	}
+	submitter, err := st.EntrySubmitter(r.Context(), seq)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("no submitter recorded for entry %d", seq), http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeError(w, "read entry submitter", err)
+		return
+	}
+	writeJSON(w, struct {
+		Seq       uint64 `json:"seq"`
+		Submitter string `json:"submitter"`
+	}{Seq: seq, Submitter: submitter})
+}
+
+// parseTime parses the RFC 3339 time v, or returns def if it's empty.
+func parseTime(v string, def time.Time) (time.Time, error) {
+	if len(v) == 0 {
+		return def, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+// maxEventSize is the largest event notification accepted by the submissions
+// action.
+const maxEventSize = 1 << 20
+
+// S3Event is the part of an S3 event notification, as delivered to a Lambda
+// function or forwarded to a webhook, which is needed to sequence the objects
+// it describes.
+type S3Event struct {
+	Records []S3EventRecord `json:"Records"`
+}
+
+// S3EventRecord describes an event affecting a single object.
+type S3EventRecord struct {
+	EventName string `json:"eventName"`
+	// UserIdentity identifies the authenticated principal whose request
+	// caused the event, i.e. who submitted the object.
+	UserIdentity struct {
+		PrincipalID string `json:"principalId"`
+	} `json:"userIdentity"`
+	S3 struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			// Key is the URL encoded key of the object.
+			Key       string `json:"key"`
+			VersionID string `json:"versionId"`
+			// Sequencer orders the events for a given key, so it
+			// identifies the write which created the object.
+			Sequencer string `json:"sequencer"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// Submission is the outcome of sequencing an object named by an S3 event.
+type Submission struct {
+	Key       string `json:"key"`
+	Seq       uint64 `json:"seq"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Submitter string `json:"submitter,omitempty"`
+}
+
+// SequenceSubmissions sequences the objects created under the submissions/
+// directory of the log by the events in ev. The bucket holding the log must
+// be available in the log's directory, e.g. by mounting it, and other events
+// and objects are ignored.
+//
+// Event notifications are delivered at least once, so each object is
+// sequenced with a request ID naming the write which created it, and a
+// redelivered event is assigned the same sequence number rather than adding
+// the entry again. An object overwritten with new contents is a new
+// submission.
+//
+// The principal which wrote each object is recorded as its submitter, in the
+// log's audit log of submissions.
+//
+// If an admission policy is set, the objects are queued and sequenced along
+// with those of other events in the same batch, as described by
+// AdmissionPolicy.
+func (a *Admin) SequenceSubmissions(ctx context.Context, ev S3Event) ([]Submission, error) {
+	subs, err := a.readSubmissions(ev)
+	if err != nil {
+		return nil, err
+	}
+	if a.admission != nil {
+		return a.admission.submit(ctx, subs)
+	}
+	return a.sequenceSubmissions(ctx, subs)
+}
+
+// submission is an object read from the submissions/ directory, ready to be
+// sequenced.
+type submission struct {
+	key       string
+	requestID string
+	leaf      []byte
+	// submitter is the validated identity of the submitter, if known.
+	submitter string
+}
+
+// readSubmissions reads the objects created under the submissions/ directory
+// by the events in ev.
+func (a *Admin) readSubmissions(ev S3Event) ([]*submission, error) {
+	r := make([]*submission, 0, len(ev.Records))
+	for _, rec := range ev.Records {
+		if !strings.HasPrefix(rec.EventName, "ObjectCreated:") {
+			continue
+		}
+		key, err := url.QueryUnescape(rec.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object key %q: %w", rec.S3.Object.Key, err)
+		}
+		if !strings.HasPrefix(key, layout.SubmissionsDir+"/") {
+			glog.V(1).Infof("Admin: ignoring object %q outside %s/", key, layout.SubmissionsDir)
+			continue
+		}
+		p, err := layout.SafeJoin(a.dir, key)
+		if err != nil {
+			// Redelivering the event won't help.
+			glog.Warningf("Admin: ignoring object with invalid key %q: %v", key, err)
+			continue
+		}
+		leaf, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read submitted object %q: %w", key, err)
+		}
+		write := rec.S3.Object.VersionID
+		if len(write) == 0 {
+			write = rec.S3.Object.Sequencer
+		}
+		// Keys may be longer than a request ID, so the ID is a hash.
+		id := fmt.Sprintf("s3:%x", sha256.Sum256([]byte(path.Join(rec.S3.Bucket.Name, key)+"@"+write)))
+		sub := rec.UserIdentity.PrincipalID
+		if len(sub) > 0 {
+			if err := api.ValidateSubmitter(sub); err != nil {
+				glog.Warningf("Admin: not recording invalid submitter %q of object %q: %v", sub, key, err)
+				sub = ""
+			}
+		}
+		r = append(r, &submission{key: key, requestID: id, leaf: leaf, submitter: sub})
+	}
+	return r, nil
+}
+
+// sequenceSubmissions sequences subs in order.
+func (a *Admin) sequenceSubmissions(ctx context.Context, subs []*submission) ([]Submission, error) {
+	cp, _, err := a.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	m, err := a.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !m.State.AcceptsEntries() {
+		return nil, fmt.Errorf("log is %s: %w", m.State, errConflict)
+	}
+	st, err := fs.Load(a.dir, cp.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage: %w", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+
+	r := make([]Submission, 0, len(subs))
+	for _, s := range subs {
+		lh := a.h.HashLeaf(s.leaf)
+		seq, err := st.SequenceRequest(ctx, s.requestID, lh, s.leaf)
+		dupe := errors.Is(err, log.ErrDupeLeaf)
+		if err != nil && !dupe {
+			return nil, fmt.Errorf("failed to sequence submitted object %q: %w", s.key, err)
+		}
+		glog.Infof("Admin: sequenced submitted object %q as entry %d (dupe: %t)", s.key, seq, dupe)
+		if len(s.submitter) > 0 {
+			if err := log.RecordSubmission(ctx, st, s.submitter, lh, seq); err != nil {
+				return nil, err
+			}
+		}
+		r = append(r, Submission{Key: s.key, Seq: seq, Duplicate: dupe, Submitter: s.submitter})
+	}
+	return r, nil
+}
+
+func (a *Admin) postSubmissions(w http.ResponseWriter, r *http.Request) {
+	var ev S3Event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventSize)).Decode(&ev); err != nil {
+		http.Error(w, fmt.Sprintf("invalid S3 event notification: %v", err), http.StatusBadRequest)
+		return
+	}
+	subs, err := a.SequenceSubmissions(r.Context(), ev)
+	if err != nil {
+		writeError(w, "sequence submissions", err)
+		return
+	}
+	writeJSON(w, struct {
+		Submissions []Submission `json:"submissions"`
+	}{Submissions: subs})
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSubmissions(t *testing.T) {
+	dir, _ := newLog(t, 0)
+	ts := newTestServer(t, dir)
+	write := func(key, contents string) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	record := func(name, key, sequencer string) S3EventRecord {
+		var r S3EventRecord
+		r.EventName = name
+		r.S3.Bucket.Name = "my-log"
+		r.S3.Object.Key = key
+		r.S3.Object.Sequencer = sequencer
+		return r
+	}
+	post := func(ev S3Event) []Submission {
+		t.Helper()
+		b, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, ts.URL+SubmissionsPath, bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Submissions: status %d: %s", resp.StatusCode, body)
+		}
+		var r struct {
+			Submissions []Submission `json:"submissions"`
+		}
+		if err := json.Unmarshal(body, &r); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		return r.Submissions
+	}
+
+	write("submissions/a", "one")
+	write("submissions/dir/b c", "two")
+	write("elsewhere/c", "three")
+	ev := S3Event{Records: []S3EventRecord{
+		record("ObjectCreated:Put", "submissions/a", "01"),
+		record("ObjectCreated:Put", "submissions/dir/b+c", "02"),
+		record("ObjectCreated:Put", "elsewhere/c", "03"),
+		record("ObjectCreated:Put", "submissions/../checkpoint", "04"),
+		record("ObjectRemoved:Delete", "submissions/a", "05"),
+	}}
+	want := []Submission{{Key: "submissions/a", Seq: 0}, {Key: "submissions/dir/b c", Seq: 1}}
+	if diff := cmp.Diff(post(ev), want); diff != "" {
+		t.Errorf("Submissions had diff (-got +want):\n%s", diff)
+	}
+	// Redelivered events must not add the entries again.
+	if diff := cmp.Diff(post(ev), want); diff != "" {
+		t.Errorf("Redelivered submissions had diff (-got +want):\n%s", diff)
+	}
+	// An overwritten object is a new submission.
+	write("submissions/a", "four")
+	if diff := cmp.Diff(post(S3Event{Records: []S3EventRecord{record("ObjectCreated:Put", "submissions/a", "06")}}), []Submission{{Key: "submissions/a", Seq: 2}}); diff != "" {
+		t.Errorf("Overwritten submission had diff (-got +want):\n%s", diff)
+	}
+	if got := stats(t, ts).Pending; got != 3 {
+		t.Errorf("Pending = %d, want 3", got)
+	}
+}
+
+func TestSubmitterAudit(t *testing.T) {
+	dir, _ := newLog(t, 0)
+	ts := newTestServer(t, dir)
+	for _, k := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(dir, "submissions"), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "submissions", k), []byte(k), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	var ev S3Event
+	for i, k := range []string{"a", "b"} {
+		var r S3EventRecord
+		r.EventName = "ObjectCreated:Put"
+		r.S3.Object.Key = "submissions/" + k
+		r.S3.Object.Sequencer = fmt.Sprintf("%02d", i)
+		r.UserIdentity.PrincipalID = "AWS:key-" + k
+		ev.Records = append(ev.Records, r)
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ts.URL+SubmissionsPath, bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Submissions: status %d", resp.StatusCode)
+	}
+
+	get := func(path string, q url.Values) (int, []byte) {
+		t.Helper()
+		return do(t, http.MethodGet, ts.URL+path+"?"+q.Encode(), token, nil)
+	}
+	code, body := get(SubmitterAuditPath, url.Values{"submitter": {"AWS:key-b"}})
+	if code != http.StatusOK {
+		t.Fatalf("SubmitterAudit: status %d: %s", code, body)
+	}
+	var subs struct {
+		Submissions []AuditedSubmission `json:"submissions"`
+	}
+	if err := json.Unmarshal(body, &subs); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(subs.Submissions) != 1 || subs.Submissions[0].Seq != 1 {
+		t.Errorf("SubmitterAudit = %+v, want entry 1 only", subs.Submissions)
+	}
+	// Submissions made after to aren't included.
+	code, body = get(SubmitterAuditPath, url.Values{"submitter": {"AWS:key-b"}, "to": {time.Now().Add(-time.Hour).Format(time.RFC3339)}})
+	if code != http.StatusOK {
+		t.Fatalf("SubmitterAudit: status %d: %s", code, body)
+	}
+	if err := json.Unmarshal(body, &subs); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(subs.Submissions) != 0 {
+		t.Errorf("SubmitterAudit before submission = %+v, want none", subs.Submissions)
+	}
+	if code, body := get(SubmitterAuditPath, url.Values{"submitter": {"AWS:key-b"}, "from": {"yesterday"}}); code != http.StatusBadRequest {
+		t.Errorf("SubmitterAudit with invalid from: status %d, want %d: %s", code, http.StatusBadRequest, body)
+	}
+
+	code, body = get(EntryAuditPath, url.Values{"seq": {"0"}})
+	if code != http.StatusOK {
+		t.Fatalf("EntryAudit: status %d: %s", code, body)
+	}
+	var entry struct {
+		Submitter string `json:"submitter"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got, want := entry.Submitter, "AWS:key-a"; got != want {
+		t.Errorf("EntryAudit submitter = %q, want %q", got, want)
+	}
+	if code, body := get(EntryAuditPath, url.Values{"seq": {"2"}}); code != http.StatusNotFound {
+		t.Errorf("EntryAudit of unknown entry: status %d, want %d: %s", code, http.StatusNotFound, body)
+	}
+}
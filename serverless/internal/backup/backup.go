@@ -0,0 +1,385 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup provides incremental, deduplicated backups of serverless logs
+// stored on a local filesystem.
+//
+// A backup directory has the following structure:
+//
+//	<backupDir>/objects/ab/cdef...
+//	<backupDir>/snapshots/<tree size>
+//
+// Objects are the contents of the log's files, named by the hex SHA-256 hash
+// of their contents so that each distinct file is only stored once. Each
+// snapshot is an (unsigned) api.Inventory listing every file in the log, and
+// the hash of its contents, at the time it was taken.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	dirPerm  = 0755
+	filePerm = 0644
+
+	objectsDir   = "objects"
+	snapshotsDir = "snapshots"
+
+	// verifyBatchSize is the number of entries verified against the
+	// checkpoint at a time.
+	verifyBatchSize = 1024
+)
+
+// Stats describes the work done to take a snapshot.
+type Stats struct {
+	// Files is the number of files in the snapshot.
+	Files int
+	// Reused is the number of files which weren't read, since they're
+	// immutable and were already in the previous snapshot.
+	Reused int
+	// Stored is the number of objects added to the backup.
+	Stored int
+}
+
+// Backup takes a snapshot of the log in logDir, storing it in backupDir.
+//
+// Only files which may have changed since the previous snapshot are read: the
+// files which layout.Immutable reports never change once published are taken
+// from the previous snapshot, and only the contents of files which aren't
+// already in the backup are stored.
+//
+// The log's checkpoint is verified with v, and must be consistent with that of
+// the previous snapshot, and the entries added since then must be committed to
+// by it, so that a log which has been tampered with doesn't replace a good
+// backup.
+func Backup(ctx context.Context, logDir, backupDir string, h merkle.LogHasher, v note.Verifier, origin string) (*api.Inventory, *Stats, error) {
+	f := client.NewFSFetcher(os.DirFS(logDir))
+	cp, _, _, err := client.FetchCheckpoint(ctx, f, v, origin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	m, err := client.FetchManifest(ctx, f, v, origin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prev, err := latestSnapshot(backupDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	prevHashes := make(map[string][]byte)
+	begin := uint64(0)
+	if prev != nil {
+		if prev.Origin != origin {
+			return nil, nil, fmt.Errorf("previous snapshot has origin %q, want %q", prev.Origin, origin)
+		}
+		if prev.Size > cp.Size {
+			return nil, nil, fmt.Errorf("log has size %d, smaller than previous snapshot size %d", cp.Size, prev.Size)
+		}
+		prevCP := fmtlog.Checkpoint{Origin: prev.Origin, Size: prev.Size, Hash: prev.Hash}
+		if err := client.CheckConsistency(ctx, h, f, []fmtlog.Checkpoint{prevCP, *cp}); err != nil {
+			return nil, nil, fmt.Errorf("log is not consistent with previous snapshot at size %d: %w", prev.Size, err)
+		}
+		for _, o := range prev.Objects {
+			prevHashes[o.Path] = o.Hash
+		}
+		begin = prev.Size
+	}
+	// Entries in the previous snapshot won't be read again, so make sure
+	// that the new ones are intact before they're stored.
+	if err := verifyEntries(ctx, f, h, *cp, begin); err != nil {
+		return nil, nil, err
+	}
+
+	// reusable returns true if the file at p can't have changed since the
+	// previous snapshot. Without the immutable layout, partial tiles are
+	// replaced by links to the full tile once it's written.
+	reusable := func(p string) bool {
+		if !layout.Immutable(p) {
+			return false
+		}
+		if _, _, partial, err := layout.ParseTilePath(p); err == nil && partial > 0 {
+			return m.Immutable
+		}
+		return true
+	}
+
+	inv := &api.Inventory{Origin: cp.Origin, Size: cp.Size, Hash: cp.Hash}
+	stats := &Stats{}
+	err = filepath.WalkDir(logDir, func(fp string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(logDir, fp)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		if p == "." {
+			return nil
+		}
+		if Skip(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if h, ok := prevHashes[p]; ok && reusable(p) {
+			inv.Objects = append(inv.Objects, api.InventoryObject{Path: p, Hash: h})
+			stats.Reused++
+			return nil
+		}
+		// Partial tiles may be symlinks to the full tile, so this follows
+		// them, and the restored log has a copy of it instead.
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", p, err)
+		}
+		o := api.NewInventoryObject(p, data)
+		stored, err := storeObject(backupDir, o.Hash, data)
+		if err != nil {
+			return err
+		}
+		if stored {
+			stats.Stored++
+		}
+		inv.Objects = append(inv.Objects, o)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to back up log: %w", err)
+	}
+	sort.Slice(inv.Objects, func(i, j int) bool { return inv.Objects[i].Path < inv.Objects[j].Path })
+	stats.Files = len(inv.Objects)
+
+	// The snapshot is written last, so that it's only visible once every
+	// object it refers to has been stored.
+	if err := writeFile(filepath.Join(backupDir, snapshotsDir, strconv.FormatUint(inv.Size, 10)), inv.Marshal()); err != nil {
+		return nil, nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	glog.V(1).Infof("Snapshot of size %d: %+v", inv.Size, stats)
+	return inv, stats, nil
+}
+
+// Skip returns true if the file or directory with the given name shouldn't
+// be backed up or replicated: lock files, temporary files which are about to
+// be renamed into place, and the integrator's compact range, which is derived
+// from the tiles and rewritten by every integration.
+func Skip(name string) bool {
+	if strings.HasPrefix(name, ".") || name == layout.CompactRangePath {
+		return true
+	}
+	for _, sfx := range []string{".tmp", ".temp", ".link"} {
+		if strings.HasSuffix(name, sfx) {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshots returns the tree sizes of the snapshots in backupDir, in
+// increasing order.
+func Snapshots(backupDir string) ([]uint64, error) {
+	ents, err := os.ReadDir(filepath.Join(backupDir, snapshotsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var r []uint64
+	for _, e := range ents {
+		s, err := strconv.ParseUint(e.Name(), 10, 64)
+		if err != nil {
+			// Not a snapshot, e.g. a temporary file.
+			continue
+		}
+		r = append(r, s)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r, nil
+}
+
+// ReadSnapshot reads the snapshot of the given tree size from backupDir.
+func ReadSnapshot(backupDir string, size uint64) (*api.Inventory, error) {
+	raw, err := os.ReadFile(filepath.Join(backupDir, snapshotsDir, strconv.FormatUint(size, 10)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	inv, err := api.ParseInventory(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	if inv.Size != size {
+		return nil, fmt.Errorf("snapshot has size %d, want %d", inv.Size, size)
+	}
+	return inv, nil
+}
+
+// latestSnapshot returns the largest snapshot in backupDir, or nil if there
+// are none.
+func latestSnapshot(backupDir string) (*api.Inventory, error) {
+	sizes, err := Snapshots(backupDir)
+	if err != nil || len(sizes) == 0 {
+		return nil, err
+	}
+	return ReadSnapshot(backupDir, sizes[len(sizes)-1])
+}
+
+// Restore recreates the log in logDir from the snapshot of the given tree size
+// in backupDir. logDir must not already contain a log.
+//
+// The contents of every file are checked against the snapshot, the restored
+// checkpoint is verified with v, and every entry is checked to be committed to
+// by the checkpoint, using the restored tiles.
+func Restore(ctx context.Context, backupDir string, size uint64, logDir string, h merkle.LogHasher, v note.Verifier, origin string) (*fmtlog.Checkpoint, error) {
+	inv, err := ReadSnapshot(backupDir, size)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Origin != origin {
+		return nil, fmt.Errorf("snapshot has origin %q, want %q", inv.Origin, origin)
+	}
+	if ents, err := os.ReadDir(logDir); err == nil && len(ents) > 0 {
+		return nil, fmt.Errorf("%q is not empty", logDir)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var cp *fmtlog.Checkpoint
+	for _, o := range inv.Objects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := readObject(backupDir, o.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %w", o.Path, err)
+		}
+		if o.Path == layout.CheckpointPath {
+			if cp, _, _, err = fmtlog.ParseCheckpoint(data, origin, v); err != nil {
+				return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+			}
+			if cp.Size != inv.Size || !bytes.Equal(cp.Hash, inv.Hash) {
+				return nil, fmt.Errorf("checkpoint has size %d root %x, but snapshot is of size %d root %x", cp.Size, cp.Hash, inv.Size, inv.Hash)
+			}
+		}
+		if err := writeFile(filepath.Join(logDir, filepath.FromSlash(o.Path)), data); err != nil {
+			return nil, fmt.Errorf("failed to restore %q: %w", o.Path, err)
+		}
+	}
+	if cp == nil {
+		return nil, errors.New("snapshot has no checkpoint")
+	}
+
+	if err := verifyEntries(ctx, client.NewFSFetcher(os.DirFS(logDir)), h, *cp, 0); err != nil {
+		return nil, fmt.Errorf("restored log is invalid: %w", err)
+	}
+	return cp, nil
+}
+
+// verifyEntries checks that the entries from begin onwards, as read with f,
+// are committed to by cp, using the tiles also read with f.
+func verifyEntries(ctx context.Context, f client.Fetcher, h merkle.LogHasher, cp fmtlog.Checkpoint, begin uint64) error {
+	for ; begin < cp.Size; begin += verifyBatchSize {
+		end := begin + verifyBatchSize
+		if end > cp.Size {
+			end = cp.Size
+		}
+		if _, err := client.FetchVerifiedLeaves(ctx, f, h, cp, begin, end); err != nil {
+			return fmt.Errorf("failed to verify entries [%d, %d): %w", begin, end, err)
+		}
+	}
+	return nil
+}
+
+// objectPath returns the path of the object with the given hash.
+func objectPath(backupDir string, hash []byte) string {
+	x := hex.EncodeToString(hash)
+	return filepath.Join(backupDir, objectsDir, x[:2], x[2:])
+}
+
+// storeObject stores data as the object with the given hash, unless it's
+// already stored. Returns true if it was stored.
+func storeObject(backupDir string, hash, data []byte) (bool, error) {
+	p := objectPath(backupDir, hash)
+	if _, err := os.Stat(p); err == nil {
+		return false, nil
+	}
+	if err := writeFile(p, data); err != nil {
+		return false, fmt.Errorf("failed to store object: %w", err)
+	}
+	return true, nil
+}
+
+// readObject reads the object with the given hash, and checks that its
+// contents match the hash.
+func readObject(backupDir string, hash []byte) ([]byte, error) {
+	data, err := os.ReadFile(objectPath(backupDir, hash))
+	if err != nil {
+		return nil, err
+	}
+	if h := sha256.Sum256(data); !bytes.Equal(h[:], hash) {
+		return nil, fmt.Errorf("object %x is corrupt", hash)
+	}
+	return data, nil
+}
+
+// writeFile atomically replaces the file at p with one containing data,
+// creating its directory if necessary.
+func writeFile(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), dirPerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
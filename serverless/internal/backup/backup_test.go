@@ -0,0 +1,204 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/testlog"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+const origin = "Backup Test Log"
+
+func TestBackupIsIncremental(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	backupDir := t.TempDir()
+
+	l.Grow(t, 300)
+	inv, stats, err := Backup(ctx, l.Dir, backupDir, h, l.V, origin)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if inv.Size != 300 || stats.Reused != 0 || stats.Stored == 0 {
+		t.Errorf("First backup has size %d, stats %+v, want size 300 and nothing reused", inv.Size, stats)
+	}
+	first := stats.Files
+
+	// Only the new entries, the partial tiles, and the checkpoint need to be
+	// read by the next backup.
+	l.Grow(t, 10)
+	inv, stats, err = Backup(ctx, l.Dir, backupDir, h, l.V, origin)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	// Each entry has a sequence file, sequencing time, and leaf hash index,
+	// and there's a new partial tile on level 0, alongside the one it
+	// supersedes.
+	if got, want := stats.Files, first+3*10+1; got != want {
+		t.Errorf("Second backup has %d files, want %d", got, want)
+	}
+	if got, want := stats.Files-stats.Reused, 3*10+3+1; got != want {
+		t.Errorf("Second backup read %d files, want %d", got, want)
+	}
+
+	sizes, err := Snapshots(backupDir)
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if want := []uint64{300, 310}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("Snapshots = %v, want %v", sizes, want)
+	}
+
+	// Both snapshots must be restorable.
+	for _, s := range sizes {
+		dst := filepath.Join(t.TempDir(), "restored")
+		cp, err := Restore(ctx, backupDir, s, dst, h, l.V, origin)
+		if err != nil {
+			t.Fatalf("Restore(%d): %v", s, err)
+		}
+		if cp.Size != s {
+			t.Errorf("Restore(%d) restored checkpoint of size %d", s, cp.Size)
+		}
+	}
+	if len(inv.Objects) != stats.Files {
+		t.Errorf("Snapshot lists %d objects, want %d", len(inv.Objects), stats.Files)
+	}
+}
+
+func TestBackupRejectsInconsistentLog(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	backupDir := t.TempDir()
+	l.Grow(t, 20)
+	if _, _, err := Backup(ctx, l.Dir, backupDir, h, l.V, origin); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	// Replace the log with a different one, signed with the same key.
+	other := testlog.New(t, origin)
+	other.Prefix, other.S, other.V = "other ", l.S, l.V
+	other.Grow(t, 30)
+	if _, _, err := Backup(ctx, other.Dir, backupDir, h, l.V, origin); err == nil {
+		t.Error("Backup of inconsistent log succeeded, want error")
+	}
+}
+
+func TestRestoreVerifies(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	for _, test := range []struct {
+		desc    string
+		tamper  func(t *testing.T, backupDir string)
+		wantErr bool
+	}{
+		{
+			desc:   "intact",
+			tamper: func(*testing.T, string) {},
+		}, {
+			desc:    "corrupt object",
+			wantErr: true,
+			tamper: func(t *testing.T, backupDir string) {
+				inv, err := ReadSnapshot(backupDir, 20)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(objectPath(backupDir, inv.Objects[len(inv.Objects)-1].Hash), []byte("bad"), filePerm); err != nil {
+					t.Fatal(err)
+				}
+			},
+		}, {
+			desc:    "entry replaced in snapshot",
+			wantErr: true,
+			tamper: func(t *testing.T, backupDir string) {
+				inv, err := ReadSnapshot(backupDir, 20)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Consistently swap two entries, so that only the tree
+				// check can catch it.
+				sp := func(i uint64) string { return path.Join(layout.SeqPath("", i)) }
+				var a, b int
+				for i, o := range inv.Objects {
+					switch o.Path {
+					case sp(3):
+						a = i
+					case sp(4):
+						b = i
+					}
+				}
+				inv.Objects[a].Hash, inv.Objects[b].Hash = inv.Objects[b].Hash, inv.Objects[a].Hash
+				if err := writeFile(filepath.Join(backupDir, snapshotsDir, "20"), inv.Marshal()); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			l := testlog.New(t, origin)
+			backupDir := t.TempDir()
+			l.Grow(t, 20)
+			if _, _, err := Backup(ctx, l.Dir, backupDir, h, l.V, origin); err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+			test.tamper(t, backupDir)
+			_, err := Restore(ctx, backupDir, 20, filepath.Join(t.TempDir(), "restored"), h, l.V, origin)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("Restore: %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestoreRefusesExistingLog(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	backupDir := t.TempDir()
+	l.Grow(t, 3)
+	if _, _, err := Backup(ctx, l.Dir, backupDir, h, l.V, origin); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if _, err := Restore(ctx, backupDir, 3, l.Dir, h, l.V, origin); err == nil {
+		t.Error("Restore over existing log succeeded, want error")
+	}
+}
+
+func TestBackupRejectsCorruptEntry(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	backupDir := t.TempDir()
+	l.Grow(t, 20)
+	d, f := layout.SeqPath(l.Dir, 7)
+	if err := os.WriteFile(filepath.Join(d, f), []byte("corrupt"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Backup(ctx, l.Dir, backupDir, h, l.V, origin); err == nil {
+		t.Error("Backup of log with corrupt entry succeeded, want error")
+	}
+	if sizes, err := Snapshots(backupDir); err != nil || len(sizes) != 0 {
+		t.Errorf("Snapshots = %v, %v, want none", sizes, err)
+	}
+}
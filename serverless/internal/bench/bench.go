@@ -0,0 +1,250 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench measures the performance of a log's storage driver under a
+// synthetic workload: how quickly entries are sequenced, how long integration
+// takes, and the latency of building proofs from the stored tiles. Results
+// are serialisable as JSON, so runs before and after a change can be
+// compared with Compare.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// Workload describes the synthetic workload to run.
+type Workload struct {
+	// Entries is the number of entries to add to the log.
+	Entries int `json:"entries"`
+	// EntrySize is the size in bytes of each entry, which has random
+	// contents.
+	EntrySize int `json:"entry_size"`
+	// BatchSize is the number of entries sequenced between integrations.
+	BatchSize int `json:"batch_size"`
+	// Proofs is the number of inclusion and consistency proofs built for
+	// entries and trees chosen at random once all entries are integrated.
+	Proofs int `json:"proofs"`
+	// Seed seeds the random choice of entries and proofs, so that runs are
+	// repeatable.
+	Seed int64 `json:"seed"`
+}
+
+// Stats summarises the latencies of the operations of one kind.
+type Stats struct {
+	Count     int     `json:"count"`
+	TotalNS   int64   `json:"total_ns"`
+	PerSecond float64 `json:"per_second"`
+	MeanNS    int64   `json:"mean_ns"`
+	P50NS     int64   `json:"p50_ns"`
+	P90NS     int64   `json:"p90_ns"`
+	P99NS     int64   `json:"p99_ns"`
+	MaxNS     int64   `json:"max_ns"`
+}
+
+// Result is the result of running a workload.
+type Result struct {
+	Workload Workload `json:"workload"`
+	// Size and Root are those of the tree built by the workload.
+	Size uint64 `json:"size"`
+	Root []byte `json:"root"`
+	// Sequence covers sequencing each entry, Integrate each batch, and
+	// InclusionProof and ConsistencyProof building and verifying each proof.
+	Sequence         Stats `json:"sequence"`
+	Integrate        Stats `json:"integrate"`
+	InclusionProof   Stats `json:"inclusion_proof"`
+	ConsistencyProof Stats `json:"consistency_proof"`
+}
+
+// Run runs the workload against st, which must be an empty log.
+//
+// Each proof is built by a new client.ProofBuilder reading the tiles from st,
+// as a client without cached state would, so its latency includes fetching
+// the tiles it needs.
+func Run(ctx context.Context, st log.Storage, w Workload) (*Result, error) {
+	if w.Entries <= 0 || w.BatchSize <= 0 || w.EntrySize < 8 {
+		return nil, errors.New("workload needs entries, a batch size, and entries of at least 8 bytes")
+	}
+	h := rfc6962.DefaultHasher
+	rnd := rand.New(rand.NewSource(w.Seed))
+	r := &Result{Workload: w}
+
+	var seq, integ []time.Duration
+	leafHashes := make([][]byte, 0, w.Entries)
+	cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	cps := []fmtlog.Checkpoint{cp}
+	for begin := 0; begin < w.Entries; begin += w.BatchSize {
+		end := begin + w.BatchSize
+		if end > w.Entries {
+			end = w.Entries
+		}
+		for i := begin; i < end; i++ {
+			e := make([]byte, w.EntrySize)
+			rnd.Read(e)
+			// Entries are made unique, so that none are squashed as
+			// duplicates.
+			binary.BigEndian.PutUint64(e, uint64(i))
+			lh := h.HashLeaf(e)
+			leafHashes = append(leafHashes, lh)
+			start := time.Now()
+			if _, err := st.Sequence(ctx, lh, e); err != nil {
+				return nil, fmt.Errorf("failed to sequence entry %d: %w", i, err)
+			}
+			seq = append(seq, time.Since(start))
+		}
+		start := time.Now()
+		newCP, err := log.Integrate(ctx, cp, st, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to integrate entries [%d, %d): %w", begin, end, err)
+		}
+		integ = append(integ, time.Since(start))
+		if newCP == nil || newCP.Size != uint64(end) {
+			return nil, fmt.Errorf("integration of entries [%d, %d) returned checkpoint %+v", begin, end, newCP)
+		}
+		cp = *newCP
+		cps = append(cps, cp)
+	}
+	r.Size, r.Root = cp.Size, cp.Hash
+	r.Sequence, r.Integrate = summarise(seq), summarise(integ)
+
+	f := StorageFetcher(st)
+	var incl, cons []time.Duration
+	for i := 0; i < w.Proofs; i++ {
+		index := uint64(rnd.Int63n(int64(cp.Size)))
+		start := time.Now()
+		pb, err := client.NewProofBuilder(ctx, cp, h.HashChildren, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create proof builder: %w", err)
+		}
+		p, err := pb.InclusionProof(ctx, index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build inclusion proof for %d: %w", index, err)
+		}
+		if err := proof.VerifyInclusion(h, index, cp.Size, leafHashes[index], p, cp.Hash); err != nil {
+			return nil, fmt.Errorf("inclusion proof for %d doesn't verify: %w", index, err)
+		}
+		incl = append(incl, time.Since(start))
+
+		from := cps[rnd.Intn(len(cps))]
+		start = time.Now()
+		if pb, err = client.NewProofBuilder(ctx, cp, h.HashChildren, f); err != nil {
+			return nil, fmt.Errorf("failed to create proof builder: %w", err)
+		}
+		if p, err = pb.ConsistencyProof(ctx, from.Size, cp.Size); err != nil {
+			return nil, fmt.Errorf("failed to build consistency proof from %d: %w", from.Size, err)
+		}
+		if err := proof.VerifyConsistency(h, from.Size, cp.Size, p, from.Hash, cp.Hash); err != nil {
+			return nil, fmt.Errorf("consistency proof from %d doesn't verify: %w", from.Size, err)
+		}
+		cons = append(cons, time.Since(start))
+	}
+	r.InclusionProof, r.ConsistencyProof = summarise(incl), summarise(cons)
+	return r, nil
+}
+
+// StorageFetcher returns a client.Fetcher which reads tiles from st, so that
+// proofs can be built from any storage driver. Other paths don't exist.
+func StorageFetcher(st log.Storage) client.Fetcher {
+	return func(ctx context.Context, p string) ([]byte, error) {
+		level, index, partial, err := layout.ParseTilePath(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a tile: %w", p, os.ErrNotExist)
+		}
+		// GetTile finds the tile for a tree size, so pick one for which
+		// the tile has the requested number of leaves.
+		n := partial
+		if n == 0 {
+			n = api.TileWidth
+		}
+		t, err := st.GetTile(ctx, level, index, (index*api.TileWidth+n)<<(level*8))
+		if err != nil {
+			return nil, err
+		}
+		return t.MarshalText()
+	}
+}
+
+// summarise returns the statistics of the given latencies.
+func summarise(d []time.Duration) Stats {
+	s := Stats{Count: len(d)}
+	if len(d) == 0 {
+		return s
+	}
+	sorted := append([]time.Duration{}, d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, x := range sorted {
+		total += x
+	}
+	pct := func(p int) int64 {
+		return int64(sorted[(len(sorted)-1)*p/100])
+	}
+	s.TotalNS = int64(total)
+	s.MeanNS = int64(total) / int64(len(d))
+	s.P50NS, s.P90NS, s.P99NS, s.MaxNS = pct(50), pct(90), pct(99), int64(sorted[len(sorted)-1])
+	if total > 0 {
+		s.PerSecond = float64(len(d)) / total.Seconds()
+	}
+	return s
+}
+
+// Compare compares cur with the baseline result base of the same workload,
+// and returns a description of each measure of cur which is worse than
+// base's by more than the given fraction, e.g. 0.1 for 10%.
+func Compare(base, cur *Result, tolerance float64) ([]string, error) {
+	if base.Workload != cur.Workload {
+		return nil, fmt.Errorf("results are for different workloads: %+v and %+v", base.Workload, cur.Workload)
+	}
+	if base.Size != cur.Size || !bytes.Equal(base.Root, cur.Root) {
+		return nil, fmt.Errorf("results built different trees: size %d root %x and size %d root %x", base.Size, base.Root, cur.Size, cur.Root)
+	}
+	var r []string
+	for _, m := range []struct {
+		name      string
+		base, cur Stats
+	}{
+		{"sequence", base.Sequence, cur.Sequence},
+		{"integrate", base.Integrate, cur.Integrate},
+		{"inclusion_proof", base.InclusionProof, cur.InclusionProof},
+		{"consistency_proof", base.ConsistencyProof, cur.ConsistencyProof},
+	} {
+		for _, v := range []struct {
+			name      string
+			base, cur int64
+		}{
+			{"mean_ns", m.base.MeanNS, m.cur.MeanNS},
+			{"p99_ns", m.base.P99NS, m.cur.P99NS},
+		} {
+			if v.base > 0 && float64(v.cur) > float64(v.base)*(1+tolerance) {
+				r = append(r, fmt.Sprintf("%s %s regressed from %d to %d (%+.1f%%)", m.name, v.name, v.base, v.cur, 100*(float64(v.cur)/float64(v.base)-1)))
+			}
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+func newStorage(t testing.TB) log.Storage {
+	t.Helper()
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return st
+}
+
+func TestRun(t *testing.T) {
+	w := Workload{Entries: 600, EntrySize: 32, BatchSize: 100, Proofs: 20, Seed: 1}
+	r, err := Run(context.Background(), newStorage(t), w)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if r.Size != 600 {
+		t.Errorf("Size = %d, want 600", r.Size)
+	}
+	for _, s := range []struct {
+		name string
+		s    Stats
+		want int
+	}{
+		{"sequence", r.Sequence, 600},
+		{"integrate", r.Integrate, 6},
+		{"inclusion proof", r.InclusionProof, 20},
+		{"consistency proof", r.ConsistencyProof, 20},
+	} {
+		if s.s.Count != s.want {
+			t.Errorf("%s count = %d, want %d", s.name, s.s.Count, s.want)
+		}
+		if s.s.P50NS > s.s.P99NS || s.s.P99NS > s.s.MaxNS {
+			t.Errorf("%s percentiles out of order: %+v", s.name, s.s)
+		}
+	}
+
+	// The same workload builds the same tree.
+	r2, err := Run(context.Background(), newStorage(t), w)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := Compare(r, r2, 1000); err != nil {
+		t.Errorf("Compare of runs of the same workload: %v", err)
+	}
+	raw, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got Result
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Workload != w || got.Size != r.Size {
+		t.Errorf("JSON round trip gave %+v, want %+v", got, r)
+	}
+}
+
+func TestRunInvalidWorkload(t *testing.T) {
+	for _, w := range []Workload{
+		{EntrySize: 32, BatchSize: 1},
+		{Entries: 1, EntrySize: 32},
+		{Entries: 1, EntrySize: 4, BatchSize: 1},
+	} {
+		if _, err := Run(context.Background(), newStorage(t), w); err == nil {
+			t.Errorf("Run(%+v) succeeded, want error", w)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	w := Workload{Entries: 1}
+	base := &Result{Workload: w, Size: 1, Root: []byte{1}, Sequence: Stats{MeanNS: 100, P99NS: 200}, Integrate: Stats{MeanNS: 100}}
+	cur := &Result{Workload: w, Size: 1, Root: []byte{1}, Sequence: Stats{MeanNS: 105, P99NS: 300}, Integrate: Stats{MeanNS: 200}}
+	got, err := Compare(base, cur, 0.1)
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], "sequence p99_ns") || !strings.HasPrefix(got[1], "integrate mean_ns") {
+		t.Errorf("Compare = %q, want regressions of sequence p99 and integrate mean", got)
+	}
+	if _, err := Compare(base, &Result{Workload: Workload{Entries: 2}}, 0.1); err == nil {
+		t.Error("Compare of different workloads succeeded, want error")
+	}
+}
+
+// The benchmarks below track the performance of the filesystem storage
+// driver, e.g. with:
+//
+//	go test -run=NONE -bench=. ./serverless/internal/bench
+
+func BenchmarkSequence(b *testing.B) {
+	st := newStorage(b)
+	e := make([]byte, 256)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(e, fmt.Sprintf("entry %d", i))
+		if _, err := st.Sequence(context.Background(), []byte(fmt.Sprintf("%032d", i)), e); err != nil {
+			b.Fatalf("Sequence: %v", err)
+		}
+	}
+}
+
+func BenchmarkWorkload(b *testing.B) {
+	for _, w := range []Workload{
+		{Entries: 1000, EntrySize: 256, BatchSize: 1000, Proofs: 100},
+		{Entries: 1000, EntrySize: 256, BatchSize: 10, Proofs: 100},
+	} {
+		b.Run(fmt.Sprintf("entries=%d,batch=%d", w.Entries, w.BatchSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				st := newStorage(b)
+				b.StartTimer()
+				r, err := Run(context.Background(), st, w)
+				if err != nil {
+					b.Fatalf("Run: %v", err)
+				}
+				b.ReportMetric(float64(r.Integrate.MeanNS), "integrate-ns")
+				b.ReportMetric(float64(r.InclusionProof.MeanNS), "inclusion-ns")
+			}
+		})
+	}
+}
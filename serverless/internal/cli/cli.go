@@ -0,0 +1,139 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cli provides the framework the serverless tools are built on, so
+// that each can be run both as a command of the serverless binary and as a
+// binary of its own.
+//
+// Each command has its own flags. Global flags, which are those registered on
+// flag.CommandLine such as glog's logging flags, are shared by all commands.
+//
+// Commands exit with the codes defined in this package, using Exit and Exitf
+// in place of glog.Exit and glog.Exitf, so that automation can tell failures
+// apart without parsing log messages.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Command is a single serverless tool.
+type Command struct {
+	// Name is the name the command is run with.
+	Name string
+	// Summary is a one line description of the command.
+	Summary string
+	// Flags holds the command's own flags, which must not be registered on
+	// flag.CommandLine.
+	Flags *flag.FlagSet
+	// Main runs the command once its flags have been parsed. Its arguments
+	// are available from Flags.Args.
+	Main func()
+}
+
+// StringList is a flag.Value which accumulates repeated flag values.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// Run runs cmd as a binary of its own, parsing its flags and the global flags
+// together from the command line, as they were before the tools were combined.
+func Run(cmd *Command) {
+	if err := parse(flag.CommandLine, cmd, os.Args[1:]); err != nil {
+		os.Exit(ExitUsage)
+	}
+	current = cmd.Name
+	cmd.Main()
+}
+
+// RunMulti runs the command named on the command line from cmds, as a binary
+// with the given name. The command line is of the form:
+//
+//	<name> [global flags] <command> [flags] [args]
+//
+// Global flags may also be given after the command.
+func RunMulti(name string, cmds []*Command) {
+	byName := make(map[string]*Command)
+	for _, c := range cmds {
+		byName[c.Name] = c
+	}
+	flag.Usage = func() {
+		usage(flag.CommandLine.Output(), name, cmds)
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(ExitUsage)
+	}
+	cmd, ok := byName[args[0]]
+	if !ok {
+		fmt.Fprintf(flag.CommandLine.Output(), "Unknown command %q\n\n", args[0])
+		flag.Usage()
+		os.Exit(ExitUsage)
+	}
+	if err := parse(flag.CommandLine, cmd, args[1:]); err != nil {
+		os.Exit(ExitUsage)
+	}
+	current = cmd.Name
+	cmd.Main()
+}
+
+// parse parses args with cmd's flags, having added the global flags to them.
+// The global flag set is marked as parsed, since some packages, such as glog,
+// check that flags have been parsed before using them.
+func parse(global *flag.FlagSet, cmd *Command, args []string) error {
+	global.VisitAll(func(f *flag.Flag) {
+		if cmd.Flags.Lookup(f.Name) == nil {
+			cmd.Flags.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	if err := cmd.Flags.Parse(args); err != nil {
+		return err
+	}
+	if !global.Parsed() {
+		if err := global.Parse(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usage writes the list of commands.
+func usage(w io.Writer, name string, cmds []*Command) {
+	fmt.Fprintf(w, "Usage: %s [global flags] <command> [flags] [args]\n\nCommands:\n", name)
+	sorted := append([]*Command(nil), cmds...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, c := range sorted {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s <command> --help' for the flags of a command.\n", name)
+}
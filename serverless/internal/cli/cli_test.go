@@ -0,0 +1,160 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/client/verify"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/proof"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		desc       string
+		args       []string
+		wantGlobal string
+		wantLocal  string
+		wantArgs   []string
+	}{
+		{
+			desc:     "none",
+			wantArgs: []string{},
+		}, {
+			desc:       "mixed",
+			args:       []string{"--global=g", "--local=l", "arg"},
+			wantGlobal: "g",
+			wantLocal:  "l",
+			wantArgs:   []string{"arg"},
+		}, {
+			desc:      "flags after args",
+			args:      []string{"--local=l", "arg", "--global=g"},
+			wantLocal: "l",
+			wantArgs:  []string{"arg", "--global=g"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			global := flag.NewFlagSet("global", flag.ContinueOnError)
+			g := global.String("global", "", "")
+			local := flag.NewFlagSet("cmd", flag.ContinueOnError)
+			l := local.String("local", "", "")
+			cmd := &Command{Name: "cmd", Flags: local}
+
+			if err := parse(global, cmd, test.args); err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !global.Parsed() {
+				t.Error("Global flags weren't marked as parsed")
+			}
+			if *g != test.wantGlobal || *l != test.wantLocal {
+				t.Errorf("Got global %q and local %q, want %q and %q", *g, *l, test.wantGlobal, test.wantLocal)
+			}
+			if got := strings.Join(local.Args(), " "); got != strings.Join(test.wantArgs, " ") {
+				t.Errorf("Got args %q, want %q", got, test.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseCommandFlagWins(t *testing.T) {
+	global := flag.NewFlagSet("global", flag.ContinueOnError)
+	g := global.String("v", "", "")
+	local := flag.NewFlagSet("cmd", flag.ContinueOnError)
+	l := local.String("v", "", "")
+	if err := parse(global, &Command{Name: "cmd", Flags: local}, []string{"--v=1"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if *g != "" || *l != "1" {
+		t.Errorf("Got global %q and local %q, want the command's flag set", *g, *l)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	flags := flag.NewFlagSet("cmd", flag.ContinueOnError)
+	var l StringList
+	flags.Var(&l, "id", "")
+	if err := flags.Parse([]string{"--id=a", "--id=b,c"}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, want := l.String(), "a,b,c"; len(l) != 2 || got != want {
+		t.Errorf("Got %d values %q, want 2 values %q", len(l), got, want)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	b := &bytes.Buffer{}
+	usage(b, "serverless", []*Command{{Name: "sequence", Summary: "Sequence"}, {Name: "integrate", Summary: "Integrate"}})
+	out := b.String()
+	if i, s := strings.Index(out, "integrate"), strings.Index(out, "sequence"); i < 0 || s < 0 || i > s {
+		t.Errorf("usage didn't list commands in order:\n%s", out)
+	}
+}
+
+func TestCode(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		err  error
+		want int
+	}{
+		{desc: "nil", want: ExitOK},
+		{desc: "other", err: errors.New("boom"), want: ExitFailure},
+		{desc: "nothing to do", err: ErrNothingToDo, want: ExitNothingToDo},
+		{desc: "dupe", err: fmt.Errorf("failed to sequence entry: %w", log.ErrDupeLeaf), want: ExitDupesOnly},
+		{desc: "inconsistent", err: client.ErrInconsistency{Wrapped: errors.New("bad proof")}, want: ExitVerificationFailed},
+		{desc: "invalid proof", err: fmt.Errorf("check: %w", verify.ErrInvalidProof), want: ExitVerificationFailed},
+		{desc: "invalid signature", err: &note.InvalidSignatureError{Name: "log", Hash: 1}, want: ExitVerificationFailed},
+		{desc: "root mismatch", err: proof.RootMismatchError{}, want: ExitVerificationFailed},
+		{desc: "locked", err: fmt.Errorf("lock: %w", fs.ErrLocked), want: ExitStorageConflict},
+		{desc: "generation mismatch", err: log.ErrGenerationMismatch, want: ExitStorageConflict},
+		{desc: "http 503", err: &client.HTTPError{URL: "https://log", StatusCode: 503}, want: ExitTransient},
+		{desc: "http 404", err: &client.HTTPError{URL: "https://log", StatusCode: 404}, want: ExitFailure},
+		{desc: "stale", err: client.ErrCheckpointStale, want: ExitTransient},
+		{desc: "deadline", err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), want: ExitTransient},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := Code(test.err); got != test.want {
+				t.Errorf("Code(%v) = %d, want %d", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	if got := codeOf([]interface{}{"name", log.ErrStorageConflict, ErrNothingToDo}); got != ExitStorageConflict {
+		t.Errorf("codeOf = %d, want the code of the first error %d", got, ExitStorageConflict)
+	}
+	if got := codeOf([]interface{}{"no errors"}); got != ExitFailure {
+		t.Errorf("codeOf = %d, want %d", got, ExitFailure)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	b := &bytes.Buffer{}
+	writeJSON(b, "integrate", ExitNothingToDo, `Nothing "to" integrate`)
+	want := `{"command":"integrate","code":3,"kind":"nothing_to_do","error":"Nothing \"to\" integrate"}` + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("writeJSON wrote %q, want %q", got, want)
+	}
+}
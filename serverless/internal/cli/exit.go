@@ -0,0 +1,182 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/client/verify"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/google/trillian-examples/serverless/pkg/vmap"
+	"github.com/transparency-dev/merkle/proof"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// The exit codes of the serverless commands. Automation should rely on these
+// rather than on the text of the log messages the commands write.
+const (
+	// ExitOK means the command did what it was asked to.
+	ExitOK = 0
+	// ExitFailure is any failure not covered by a more specific code.
+	ExitFailure = 1
+	// ExitUsage means the command line was invalid.
+	ExitUsage = 2
+	// ExitNothingToDo means there was no work to do, e.g. integrate found no
+	// new entries. Nothing was changed.
+	ExitNothingToDo = 3
+	// ExitDupesOnly means every entry given was already in the log, so
+	// nothing new was added.
+	ExitDupesOnly = 4
+	// ExitVerificationFailed means a signature, proof or consistency check
+	// failed. It may be evidence of misbehaviour, and shouldn't be retried
+	// blindly.
+	ExitVerificationFailed = 5
+	// ExitStorageConflict means the log was changed or locked by another
+	// writer while the command was running. Retrying may succeed.
+	ExitStorageConflict = 6
+	// ExitTransient means a failure which may succeed if retried, such as a
+	// network error or timeout.
+	ExitTransient = 7
+)
+
+// ErrNothingToDo may be passed to Exit to exit with ExitNothingToDo.
+var ErrNothingToDo = errors.New("nothing to do")
+
+// kinds names the exit codes in machine-readable errors.
+var kinds = map[int]string{
+	ExitFailure:            "failure",
+	ExitUsage:              "usage",
+	ExitNothingToDo:        "nothing_to_do",
+	ExitDupesOnly:          "dupes_only",
+	ExitVerificationFailed: "verification_failed",
+	ExitStorageConflict:    "storage_conflict",
+	ExitTransient:          "transient",
+}
+
+var (
+	errorFormat = flag.String("error_format", "text", "Format of the error reported when a command fails: text, which is only logged, or json, which also writes a JSON object as the last line of stderr")
+
+	// current is the name of the command being run, for machine-readable
+	// errors.
+	current string
+)
+
+// Code returns the exit code for a command which failed with err.
+func Code(err error) int {
+	var (
+		invalidSig   *note.InvalidSignatureError
+		unverified   *note.UnverifiedNoteError
+		unknownKey   *note.UnknownVerifierError
+		rootMismatch proof.RootMismatchError
+		netErr       net.Error
+	)
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, client.ErrInconsistentTree),
+		errors.Is(err, client.ErrPinMismatch),
+		errors.Is(err, verify.ErrInvalidCheckpoint),
+		errors.Is(err, verify.ErrInvalidProof),
+		errors.Is(err, verify.ErrRootMismatch),
+		errors.Is(err, vmap.ErrRootMismatch),
+		errors.As(err, &invalidSig),
+		errors.As(err, &unverified),
+		errors.As(err, &unknownKey),
+		errors.As(err, &rootMismatch):
+		return ExitVerificationFailed
+	case errors.Is(err, log.ErrStorageConflict):
+		return ExitStorageConflict
+	case errors.Is(err, client.ErrTransient),
+		errors.Is(err, client.ErrCheckpointStale),
+		errors.Is(err, guard.ErrOpen),
+		errors.Is(err, guard.ErrBudgetExhausted),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ExitTransient
+	case errors.Is(err, log.ErrDupeLeaf):
+		return ExitDupesOnly
+	case errors.Is(err, ErrNothingToDo):
+		return ExitNothingToDo
+	}
+	return ExitFailure
+}
+
+// Exit logs its arguments, as for fmt.Sprint, and exits with the code for the
+// first error among them, as for Code, or with ExitFailure if there's none.
+// It's the equivalent of glog.Exit for commands.
+func Exit(args ...interface{}) {
+	exit(codeOf(args), fmt.Sprint(args...))
+}
+
+// Exitf logs its arguments, as for fmt.Sprintf, and exits with the code for
+// the first error among them, as for Exit. It's the equivalent of glog.Exitf
+// for commands.
+func Exitf(format string, args ...interface{}) {
+	exit(codeOf(args), fmt.Sprintf(format, args...))
+}
+
+// ExitWith logs its arguments, as for fmt.Sprintf, and exits with code.
+func ExitWith(code int, format string, args ...interface{}) {
+	exit(code, fmt.Sprintf(format, args...))
+}
+
+// codeOf returns the exit code for the first error in args.
+func codeOf(args []interface{}) int {
+	for _, a := range args {
+		if err, ok := a.(error); ok {
+			return Code(err)
+		}
+	}
+	return ExitFailure
+}
+
+// exit reports msg and exits with code.
+func exit(code int, msg string) {
+	glog.ErrorDepth(2, msg)
+	glog.Flush()
+	if *errorFormat == "json" {
+		writeJSON(os.Stderr, current, code, msg)
+	}
+	os.Exit(code)
+}
+
+// writeJSON writes the machine-readable form of an error to w, as a single
+// line.
+func writeJSON(w io.Writer, command string, code int, msg string) {
+	kind, ok := kinds[code]
+	if !ok {
+		kind = kinds[ExitFailure]
+	}
+	b, _ := json.Marshal(struct {
+		Command string `json:"command"`
+		Code    int    `json:"code"`
+		Kind    string `json:"kind"`
+		Error   string `json:"error"`
+	}{Command: command, Code: code, Kind: kind, Error: msg})
+	fmt.Fprintf(w, "%s\n", b)
+}
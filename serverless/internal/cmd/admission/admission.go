@@ -0,0 +1,148 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admission provides an example Kubernetes validating admission
+// webhook server, which rejects pods whose images aren't pinned by a digest
+// with a verified entry in a serverless log.
+package admission
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/pkg/admission"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("admission", flag.ExitOnError)
+
+var (
+	listen          = commandLine.String("listen", ":8443", "Address to listen on.")
+	tlsCert         = commandLine.String("tls_cert", "", "Location of the server's TLS certificate, which Kubernetes requires webhooks to use.")
+	tlsKey          = commandLine.String("tls_key", "", "Location of the private key of --tls_cert.")
+	logURL          = commandLine.String("log_url", "", "Root URL of the log, e.g. https://log.server/and/path, whose identifier map the images' digests must have verified entries in.")
+	pubKeyFile      = commandLine.String("log_public_key", "", "Location of the log's public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin          = commandLine.String("origin", "", "Log origin string.")
+	cacheDir        = commandLine.String("cache_dir", "", "If set, directory to cache the log's tiles and leaf indices in, so that they survive restarts.")
+	refreshInterval = commandLine.Duration("refresh_interval", time.Minute, "How often to check the log for a new checkpoint.")
+	checkTimeout    = commandLine.Duration("check_timeout", 3*time.Second, "How long the images of a pod may take to check, which must be less than the webhook's timeoutSeconds.")
+	maxCached       = commandLine.Int("max_cached", 4096, "Number of image results to cache.")
+)
+
+// Command is the admission command.
+var Command = &cli.Command{
+	Name:    "admission",
+	Summary: "Serve a Kubernetes admission webhook admitting only pods whose images are in a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*origin) == 0 {
+		cli.ExitWith(cli.ExitUsage, "Please set --origin flag to log identifier.")
+	}
+	if len(*logURL) == 0 {
+		cli.ExitWith(cli.ExitUsage, "Please set --log_url flag to the log's root URL.")
+	}
+	if (len(*tlsCert) == 0) != (len(*tlsKey) == 0) {
+		cli.ExitWith(cli.ExitUsage, "--tls_cert and --tls_key must be set together.")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	v, err := log.LoadVerifier(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Failed to load log public key, supply it with --log_public_key or SERVERLESS_LOG_PUBLIC_KEY: %q", err)
+	}
+	f, err := newFetcher(*logURL)
+	if err != nil {
+		cli.Exitf("Failed to create fetcher: %q", err)
+	}
+	h := rfc6962.DefaultHasher
+	opts := admission.CheckerOpts{RefreshInterval: *refreshInterval, MaxCached: *maxCached}
+	if len(*cacheDir) > 0 {
+		opts.Cache = client.NewArtifactCache(f, filepath.Join(*cacheDir, "artifacts"))
+		f = opts.Cache.Fetch
+	}
+	// Logs may not store their partial tiles.
+	f = client.DerivingFetcher(f, h)
+	c, err := admission.NewChecker(ctx, f, h, v, *origin, opts)
+	if err != nil {
+		cli.Exitf("Failed to create checker: %q", err)
+	}
+	go c.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", &admission.Webhook{Checker: c, Timeout: *checkTimeout})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	hs := &http.Server{Addr: *listen, Handler: mux}
+	e := make(chan error, 1)
+	go func() {
+		if len(*tlsCert) > 0 {
+			e <- hs.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			e <- hs.ListenAndServe()
+		}
+	}()
+	glog.Infof("Serving admission webhook for log %q on %s", *origin, *listen)
+
+	select {
+	case err := <-e:
+		cli.Exitf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hs.Shutdown(sctx); err != nil {
+		glog.Warningf("Failed to finish in-flight requests: %v", err)
+	}
+	if err := <-e; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		cli.Exitf("Server failed: %v", err)
+	}
+}
+
+// newFetcher returns a fetcher for the log with the given root URL.
+func newFetcher(u string) (client.Fetcher, error) {
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	root, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log URL: %w", err)
+	}
+	switch root.Scheme {
+	case "file":
+		return client.NewFSFetcher(os.DirFS(root.Path)), nil
+	case "http", "https":
+		return client.NewHTTPFetcher(root, client.NewHTTPClient(client.HTTPClientOpts{})), nil
+	}
+	return nil, fmt.Errorf("unsupported URL scheme %s", root.Scheme)
+}
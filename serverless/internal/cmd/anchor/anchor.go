@@ -0,0 +1,203 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package anchor provides a daemon which periodically anchors the checkpoint of
+// another transparency log into a serverless log, by sequencing it as an
+// entry. Running a second instance in the other direction cross-signs the two
+// logs, so that each timestamps the other, and neither can present a split
+// view without it being recorded by the other.
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("anchor", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory of the log to anchor checkpoints in.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of the public key file of the log to anchor checkpoints in. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = commandLine.String("origin", "", "Origin of the log to anchor checkpoints in.")
+
+	sourceURL        = commandLine.String("source_log_url", "", "Root URL of the log whose checkpoints are anchored, e.g. file:///path/to/log or https://log.server/and/path")
+	sourcePubKeyFile = commandLine.String("source_public_key", "", "Location of the public key file of the log whose checkpoints are anchored.")
+	sourceOrigin     = commandLine.String("source_origin", "", "Origin of the log whose checkpoints are anchored.")
+
+	interval = commandLine.Duration("interval", time.Minute, "How often to anchor the latest checkpoint.")
+	once     = commandLine.Bool("once", false, "If set, anchor a single checkpoint and exit, e.g. when run from cron.")
+)
+
+// Command is the anchor command.
+var Command = &cli.Command{
+	Name:    "anchor",
+	Summary: "Anchor the checkpoints of another log in a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*sourceURL) == 0 || len(*sourceOrigin) == 0 || len(*sourcePubKeyFile) == 0 {
+		cli.Exit("--source_log_url, --source_origin and --source_public_key must be set")
+	}
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+	sourcePubKey, err := os.ReadFile(*sourcePubKeyFile)
+	if err != nil {
+		cli.Exitf("Unable to read source public key: %q", err)
+	}
+	sourceV, err := i_note.NewVerifierForKey(strings.TrimSpace(string(sourcePubKey)))
+	if err != nil {
+		cli.Exitf("Failed to instantiate source Verifier: %q", err)
+	}
+	u := *sourceURL
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	root, err := url.Parse(u)
+	if err != nil {
+		cli.Exitf("Invalid source log URL: %q", err)
+	}
+	var sf client.Fetcher
+	switch root.Scheme {
+	case "http", "https":
+		sf = client.NewHTTPFetcher(root, nil)
+	case "file":
+		sf = client.NewFSFetcher(os.DirFS(root.Path))
+	default:
+		cli.Exitf("Unsupported source log URL scheme %q", root.Scheme)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	m, err := client.FetchManifest(ctx, client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.AcceptsEntries() {
+		cli.Exitf("Log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+
+	a := &anchorer{
+		st:     st,
+		h:      rfc6962.DefaultHasher,
+		f:      sf,
+		v:      sourceV,
+		origin: *sourceOrigin,
+	}
+	for {
+		if err := a.anchor(ctx); err != nil {
+			if *once {
+				cli.Exitf("Failed to anchor checkpoint: %q", err)
+			}
+			glog.Warningf("Failed to anchor checkpoint: %q", err)
+		}
+		if *once {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// anchorer sequences the checkpoints of the source log into the anchoring
+// log's storage.
+type anchorer struct {
+	st     *fs.Storage
+	h      merkle.LogHasher
+	f      client.Fetcher
+	v      note.Verifier
+	origin string
+
+	// last is the checkpoint most recently anchored, if any, and lastRaw
+	// its signed note.
+	last    *fmtlog.Checkpoint
+	lastRaw []byte
+}
+
+// anchor sequences the source log's latest checkpoint, unless it's already
+// been anchored. Checkpoints are only sequenced, and are committed to by the
+// anchoring log when it's next integrated.
+func (a *anchorer) anchor(ctx context.Context) error {
+	cp, raw, _, err := client.FetchCheckpoint(ctx, a.f, a.v, a.origin)
+	if err != nil {
+		return fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	if bytes.Equal(raw, a.lastRaw) {
+		glog.V(1).Infof("Checkpoint of size %d is already anchored", cp.Size)
+		return nil
+	}
+	// An inconsistent checkpoint is still anchored, since the anchoring log
+	// then holds the evidence of the split view.
+	if a.last != nil {
+		if cp.Size < a.last.Size {
+			glog.Errorf("Source log checkpoint of size %d is smaller than the %d previously anchored", cp.Size, a.last.Size)
+		} else if err := client.CheckConsistency(ctx, a.h, a.f, []fmtlog.Checkpoint{*a.last, *cp}); err != nil {
+			glog.Errorf("Source log checkpoint of size %d is inconsistent with the one previously anchored: %v", cp.Size, err)
+		}
+	}
+	seq, err := a.st.Sequence(ctx, a.h.HashLeaf(raw), raw)
+	if err != nil && !errors.Is(err, log.ErrDupeLeaf) {
+		return fmt.Errorf("failed to sequence checkpoint: %w", err)
+	}
+	glog.Infof("Anchored checkpoint of size %d at index %d", cp.Size, seq)
+	a.last, a.lastRaw = cp, raw
+	return nil
+}
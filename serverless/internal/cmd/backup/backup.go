@@ -0,0 +1,162 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup provides a command line tool for taking incremental backups of
+// a serverless log, and restoring them.
+package backup
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/internal/backup"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("backup", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory of the log.")
+	backupDir  = commandLine.String("backup_dir", "", "Directory holding the backups of the log.")
+	origin     = commandLine.String("origin", "", "Expected log origin string.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of the log's public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+)
+
+const usage = `Usage:
+ backup --storage_dir=<dir> --backup_dir=<dir> --origin=<origin> <cmd>
+
+Where <cmd> is one of:
+ create
+	Take a snapshot of the log, storing only what's changed since the last one.
+ list
+	List the tree sizes of the snapshots in the backup.
+ restore [tree-size]
+	Restore the snapshot of the given size, or the latest one, into the empty
+	--storage_dir, and verify the restored log.
+`
+
+// Command is the backup command.
+var Command = &cli.Command{
+	Name:    "backup",
+	Summary: "Take and restore incremental backups of a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	if len(*backupDir) == 0 {
+		cli.Exitf("Please set --backup_dir flag.")
+	}
+	args := commandLine.Args()
+	if len(args) == 0 {
+		cli.Exit(usage)
+	}
+
+	ctx := context.Background()
+	var err error
+	switch args[0] {
+	case "create":
+		err = create(ctx)
+	case "list":
+		err = list()
+	case "restore":
+		err = restore(ctx, args[1:])
+	default:
+		err = errors.New(usage)
+	}
+	if err != nil {
+		cli.Exitf("%s: %v", args[0], err)
+	}
+}
+
+func create(ctx context.Context) error {
+	v, err := verifier()
+	if err != nil {
+		return err
+	}
+	inv, stats, err := backup.Backup(ctx, *storageDir, *backupDir, rfc6962.DefaultHasher, v, *origin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot of tree size %d: %d files, %d unchanged, %d new objects stored\n", inv.Size, stats.Files, stats.Reused, stats.Stored)
+	return nil
+}
+
+func list() error {
+	sizes, err := backup.Snapshots(*backupDir)
+	if err != nil {
+		return err
+	}
+	for _, s := range sizes {
+		fmt.Println(s)
+	}
+	return nil
+}
+
+func restore(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: restore [tree-size]")
+	}
+	v, err := verifier()
+	if err != nil {
+		return err
+	}
+	var size uint64
+	if len(args) == 1 {
+		if size, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid tree-size %q: %w", args[0], err)
+		}
+	} else {
+		sizes, err := backup.Snapshots(*backupDir)
+		if err != nil {
+			return err
+		}
+		if len(sizes) == 0 {
+			return errors.New("backup has no snapshots")
+		}
+		size = sizes[len(sizes)-1]
+	}
+	cp, err := backup.Restore(ctx, *backupDir, size, *storageDir, rfc6962.DefaultHasher, v, *origin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored and verified log of tree size %d with root hash %x\n", cp.Size, cp.Hash)
+	return nil
+}
+
+// verifier returns the verifier for the log's signatures.
+func verifier() (note.Verifier, error) {
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get public key: %w", err)
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate verifier: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench provides a command line tool which measures the performance
+// of a log's storage under a synthetic workload, and optionally fails if it's
+// regressed compared to an earlier run.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/internal/bench"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/internal/storage/storagetest"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("bench", flag.ExitOnError)
+
+var (
+	storageDir    = commandLine.String("storage_dir", "", "Directory in which to create the log to run the workload against, which mustn't exist. If unset, a temporary directory is used and removed afterwards.")
+	latency       = commandLine.Duration("latency", 0, "Latency to add to each storage operation, to simulate storage on a remote service.")
+	entries       = commandLine.Int("entries", 10000, "Number of entries to add to the log.")
+	entrySize     = commandLine.Int("entry_size", 256, "Size in bytes of each entry.")
+	batchSize     = commandLine.Int("batch_size", 1000, "Number of entries sequenced between integrations.")
+	proofs        = commandLine.Int("proofs", 1000, "Number of inclusion and consistency proofs to build.")
+	seed          = commandLine.Int64("seed", 0, "Seed for the random choice of entries and proofs.")
+	output        = commandLine.String("output", "", "File to write the JSON results to. If unset, they're written to stdout.")
+	baseline      = commandLine.String("baseline", "", "File of JSON results of an earlier run of the same workload to compare with. The command fails if any measure has regressed by more than --max_regression.")
+	maxRegression = commandLine.Float64("max_regression", 0.1, "Largest regression compared with --baseline to accept, as a fraction, e.g. 0.1 for 10%.")
+)
+
+// Command is the bench command.
+var Command = &cli.Command{
+	Name:    "bench",
+	Summary: "Measure log performance under a synthetic workload",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	var base *bench.Result
+	if len(*baseline) > 0 {
+		raw, err := os.ReadFile(*baseline)
+		if err != nil {
+			cli.Exitf("Failed to read --baseline: %q", err)
+		}
+		base = &bench.Result{}
+		if err := json.Unmarshal(raw, base); err != nil {
+			cli.Exitf("Failed to parse --baseline: %q", err)
+		}
+	}
+
+	dir := *storageDir
+	if len(dir) == 0 {
+		tmp, err := os.MkdirTemp("", "bench")
+		if err != nil {
+			cli.Exitf("Failed to create temporary directory: %q", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = filepath.Join(tmp, "log")
+	}
+	fst, err := fs.Create(dir)
+	if err != nil {
+		cli.Exitf("Failed to create log: %q", err)
+	}
+	var st log.Storage = fst
+	if *latency > 0 {
+		st = storagetest.NewFaulty(fst, storagetest.Faults{Latency: *latency})
+	}
+
+	w := bench.Workload{
+		Entries:   *entries,
+		EntrySize: *entrySize,
+		BatchSize: *batchSize,
+		Proofs:    *proofs,
+		Seed:      *seed,
+	}
+	start := time.Now()
+	r, err := bench.Run(ctx, st, w)
+	if err != nil {
+		cli.Exitf("Benchmark failed: %q", err)
+	}
+	glog.Infof("Ran workload %+v in %s", w, time.Since(start))
+
+	raw, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		cli.Exitf("Failed to marshal results: %q", err)
+	}
+	raw = append(raw, '\n')
+	if len(*output) > 0 {
+		err = os.WriteFile(*output, raw, 0o644)
+	} else {
+		_, err = os.Stdout.Write(raw)
+	}
+	if err != nil {
+		cli.Exitf("Failed to write results: %q", err)
+	}
+
+	if base != nil {
+		regressions, err := bench.Compare(base, r, *maxRegression)
+		if err != nil {
+			cli.Exitf("Failed to compare with --baseline: %q", err)
+		}
+		for _, reg := range regressions {
+			fmt.Fprintln(os.Stderr, reg)
+		}
+		if len(regressions) > 0 {
+			cli.Exitf("%d measures regressed by more than %.0f%%", len(regressions), 100**maxRegression)
+		}
+	}
+}
@@ -0,0 +1,1530 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client provides a read-only cli for interacting with serverless logs.
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/client/httpapi"
+	"github.com/google/trillian-examples/serverless/client/witness"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/pkg/guard"
+	"github.com/google/trillian-examples/serverless/pkg/sbom"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+func defaultCacheLocation() string {
+	hd, err := os.UserCacheDir()
+	if err != nil {
+		glog.Warningf("Failed to determine user cache dir: %q", err)
+		return ""
+	}
+	return fmt.Sprintf("%s/serverless", hd)
+}
+
+// aString is a flag Value which holds multiple strings, allowing the flag to
+// be specified multiple times on the command line.
+type aString []string
+
+func (a *aString) String() string {
+	return fmt.Sprintf("%v", *a)
+}
+
+func (a *aString) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+func flagStringList(name, usage string) *aString {
+	r := make(aString, 0)
+	commandLine.Var(&r, name, usage)
+	return &r
+}
+
+func defaultTrustStoreLocation() string {
+	cd, err := os.UserConfigDir()
+	if err != nil {
+		glog.Warningf("Failed to determine user config dir: %q", err)
+		return ""
+	}
+	return filepath.Join(cd, "serverless", "trust_store.json")
+}
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("client", flag.ExitOnError)
+
+var (
+	anchorLogURL        = commandLine.String("anchor_log_url", "", "Root URL of the log the verify-anchors command finds this log's checkpoints anchored in")
+	anchorPubKeyFile    = commandLine.String("anchor_public_key", "", "File containing the public key of the log given by --anchor_log_url")
+	anchorOrigin        = commandLine.String("anchor_origin", "", "Origin of the log given by --anchor_log_url")
+	attestationKeyFile  = commandLine.String("attestation_key", "", "If set, file containing a note signing key local to this host, with which the inclusion command signs an attestation of each artifact it verifies into the cache, for --attestation_public_key to trust")
+	attestationPubKey   = commandLine.String("attestation_public_key", "", "If set, file containing the public key of --attestation_key, and the inclusion command trusts an attestation signed by it in the cache rather than verifying the artifact again")
+	attestationTTL      = commandLine.Duration("attestation_ttl", time.Hour, "How long after it's made an attestation set by --attestation_public_key is trusted")
+	auditState          = commandLine.String("audit_state", "", "If set, file the audit command records the audited tree size in, so that later audits only verify what's been added since")
+	auditorKeyFile      = commandLine.String("auditor_key", "", "If set, file containing the note signing key the audit command signs its receipt with")
+	auditorPubKeyFile   = commandLine.String("auditor_public_key", "", "File containing the public key of the auditor whose receipt the verify-receipt command verifies")
+	auditWorkers        = commandLine.Int("audit_workers", 0, "Number of tiles the audit command verifies at once, defaults to the number of CPUs")
+	cacheDir            = commandLine.String("cache_dir", defaultCacheLocation(), "Where to cache client state for logs, if empty don't store anything locally")
+	dnsTXTNames         = flagStringList("dns_txt_name", "Name of a DNS TXT record the compare-channels command reads the log's checkpoint digest from (can specify this flag repeatedly)")
+	distributorURLs     = flagStringList("distributor_url", "URL identifying the root of a distributor (can specify this flag repeatedly)")
+	logListFile         = commandLine.String("log_list", "", "If set, file containing a signed log list, from which the entry for --origin gives the log's URL and key, and its witness policy, in place of the --log_url, --log_public_key, --witness_public_key, --witness_sigs_required and --distributor_url flags")
+	logListName         = commandLine.String("log_list_name", "", "Expected name of the log list given by --log_list")
+	logListPubKeyFile   = commandLine.String("log_list_public_key", "", "File containing the public key of the maintainer of the log list given by --log_list")
+	logURL              = commandLine.String("log_url", "", "Log storage root URL, e.g. file:///path/to/log or https://log.server/and/path")
+	logPubKeyFile       = commandLine.String("log_public_key", "", "Location of log public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable")
+	maxMismatches       = commandLine.Int("max_mismatches", client.DefaultMaxMismatches, "Number of mismatches the audit command reports, in order of their position in the tree")
+	logID               = commandLine.String("log_id", "", "LogID used by distributors. Will be derived from log public key if unset")
+	origin              = commandLine.String("origin", "", "Expected first line of checkpoints from log")
+	tsPubKeyFiles       = flagStringList("timestamp_public_key", "File containing a public key of the log's timestamping key, with which the update command verifies the time at which the checkpoint was current (can specify this flag repeatedly, e.g. while the key is rotated)")
+	maxCheckpointAge    = commandLine.Duration("max_checkpoint_age", 0, "If set with --timestamp_public_key, the update command fails if the checkpoint was last timestamped as current longer ago than this")
+	wellKnownURLs       = flagStringList("well_known_url", "URL the compare-channels command reads a copy of the log's signed checkpoint from, e.g. https://example.com/.well-known/serverless-checkpoint (can specify this flag repeatedly)")
+	witnessPubKeyFiles  = flagStringList("witness_public_key", "File containing witness public key (can specify this flag repeatedly)")
+	witnessSigsRequired = commandLine.Int("witness_sigs_required", 0, "Minimum number of witness signatures required for consensus")
+	replicaURLs         = flagStringList("replica_url", "Root URL of a replica of the log, e.g. in another region, which is read from when --log_url fails (can specify this flag repeatedly)")
+	outputCheckpoint    = commandLine.String("output_checkpoint", "", "If set, the update command will write the latest verified consistent checkpoint to this file")
+	outputConsistency   = commandLine.String("output_consistency_proof", "", "If set, the update and consistency commands will write the verified consistency proof used to update the checkpoint to this file, encoded as set by --proof_encoding")
+	outputInclusion     = commandLine.String("output_inclusion_proof", "", "If set, the inclusion and inclusions commands will write the verified inclusion proof(s) to this file. Single inclusion proofs are encoded as set by --proof_encoding")
+	proofEncoding       = commandLine.String("proof_encoding", string(api.ProofEncodingText), "Encoding of the proofs written by --output_inclusion_proof and --output_consistency_proof: text, for one base64 hash per line, json, as in RFC 6962, binary, for the concatenated hashes, or pem, for a PEM block of them")
+	outputReceipt       = commandLine.String("output_receipt", "", "If set, the audit command will write its signed receipt to this file, which requires --auditor_key")
+	outputBundle        = commandLine.String("output_bundle", "", "If set, the inclusion command will write a proof bundle of the checkpoint, leaf hash and inclusion proof to this file, for offline verification")
+	inclusionHash       = commandLine.Bool("inclusion_hash", false, "If set to true, the inclusion command will take a base64 encoded leaf hash instead of a file name")
+	fetchConcurrency    = commandLine.Int("fetch_concurrency", client.DefaultFetchConcurrency, "Number of tiles fetched at once when building batch inclusion and consistency proofs")
+	maxConnsPerHost     = commandLine.Int("max_conns_per_host", 0, "If set, the most HTTP(S) connections to open to each host, including those in use. With HTTP/2, concurrent requests share connections")
+	maxIdleConnsPerHost = commandLine.Int("max_idle_conns_per_host", client.DefaultMaxIdleConnsPerHost, "Number of idle HTTP(S) connections to each host to keep open for reuse")
+	keepAlive           = commandLine.Duration("keep_alive", 30*time.Second, "Interval between TCP keep-alive probes on open HTTP(S) connections. Negative to disable them")
+	disableHTTP2        = commandLine.Bool("disable_http2", false, "If set, only use HTTP/1.1 rather than HTTP/2 with servers which support it")
+	requestTimeout      = commandLine.Duration("request_timeout", 0, "If set, each HTTP(S) request to the log may take at most this long, transient failures are retried within a budget, and requests fail straight away once the log has failed repeatedly, rather than retrying for up to 30s")
+	tofu                = commandLine.Bool("tofu", false, "If set, trust the key the log publishes the first time it's contacted, in place of --log_public_key, and fail loudly if it later changes")
+	trustStore          = commandLine.String("trust_store", defaultTrustStoreLocation(), "File in which --tofu records the key and origin of each log when it's first contacted")
+	serveURL            = commandLine.String("serve_url", "", "If set, URL of a serve tool to fetch inclusion proofs and identifier lookups from, instead of building them from the log's files. Everything fetched is still verified")
+	snapshotReads       = commandLine.Bool("snapshot_reads", false, "If set, ignore entries and tiles which the log has published beyond the latest verified checkpoint, e.g. during an integration, so that commands see a consistent snapshot of the log")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Please specify one of the commands and its arguments:\n")
+	fmt.Fprintf(os.Stderr, "  audit\n - recompute the latest checkpoint's tree from the log's entries and check it matches every tile\n")
+	fmt.Fprintf(os.Stderr, "  chain - follow and verify the links from the log to the logs which succeeded it\n")
+	fmt.Fprintf(os.Stderr, "  compare-channels\n - check the checkpoints published by --dns_txt_name and --well_known_url are consistent with the log's\n")
+	fmt.Fprintf(os.Stderr, "  consistency <from-size> <to-size>\n - build consistency proof between two log sizes\n")
+	fmt.Fprintf(os.Stderr, "  diff [--from=<checkpoint file>] [--to=<checkpoint file>] [--leaves]\n - show what changed in the log between two checkpoints\n")
+	fmt.Fprintf(os.Stderr, "  export-entries [--format=csv|jsonl] [--payload] [--output=<file>] <from-index> <to-index>\n - export a verified range of entries\n")
+	fmt.Fprintf(os.Stderr, "  inclusion <file or leaf hash> [index-in-log]\n - verify inclusion of a file in the log\n")
+	fmt.Fprintf(os.Stderr, "  inclusions <index-in-log> [index-in-log ...]\n - verify inclusion of many leaves at once\n")
+	fmt.Fprintf(os.Stderr, "  lookup <identifier>\n - list the entries associated with an identifier in the identifier map\n")
+	fmt.Fprintf(os.Stderr, "  pins - list the logs whose keys were trusted on first use\n")
+	fmt.Fprintf(os.Stderr, "  redaction <index-in-log>\n - show why the data of an entry is withheld, verified against the log's redaction log\n")
+	fmt.Fprintf(os.Stderr, "  sboms <algorithm:hex digest or package URL>\n - list the verified SBOMs in the log which mention an artifact\n")
+	fmt.Fprintf(os.Stderr, "  search --prefix=<hex prefix> [--text]\n - list the verified entries which start with a prefix, for logs which index entries by prefix\n")
+	fmt.Fprintf(os.Stderr, "  state - show whether the log is active, frozen, or read-only\n")
+	fmt.Fprintf(os.Stderr, "  timestamp <index-in-log>\n - show when an entry was sequenced, verified against the log's timestamp log\n")
+	fmt.Fprintf(os.Stderr, "  unpin <log url>\n - forget the key trusted on first use for a log, so that its current key is trusted next time\n")
+	fmt.Fprintf(os.Stderr, "  update - force the client to update its latest checkpoint\n")
+	fmt.Fprintf(os.Stderr, "  verify-anchors [from-index]\n - check the checkpoints of this log anchored in the log given by --anchor_log_url are of a single append-only view of it\n")
+	fmt.Fprintf(os.Stderr, "  verify-layout\n - check that exactly the tiles and entries of the latest checkpoint's tree are published\n")
+	fmt.Fprintf(os.Stderr, "  verify-receipt <receipt file>\n - check an auditor's receipt, and that the latest checkpoint's tree extends the audited one\n")
+	fmt.Fprintf(os.Stderr, "  verify-logfile [--name=<recorded name>] <host> <file>\n - check a host's log file against the segments of it recorded in the log\n")
+	fmt.Fprintf(os.Stderr, "  verify-mirror [tree-size]\n - check that every file listed in the log's signed inventory is present and intact\n")
+	os.Exit(cli.ExitUsage)
+}
+
+// Command is the client command.
+var Command = &cli.Command{
+	Name:    "client",
+	Summary: "Verify and query a log as a read-only client",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	// Pins are managed without contacting a log.
+	if args := commandLine.Args(); len(args) > 0 && (args[0] == "pins" || args[0] == "unpin") {
+		if err := managePins(args[0], args[1:]); err != nil {
+			cli.Exitf("Command %q failed: %q", args[0], err)
+		}
+		return
+	}
+
+	entry, err := logListEntry()
+	if err != nil {
+		cli.Exitf("Failed to load log list: %v", err)
+	}
+	var logSigV note.Verifier
+	var pubK []byte
+	var witnesses []note.Verifier
+	switch {
+	case entry != nil:
+		if logSigV, witnesses, err = client.LogVerifiers(*entry); err != nil {
+			cli.Exitf("Invalid log list: %v", err)
+		}
+		pubK = []byte(entry.PublicKey)
+		*logURL, *witnessSigsRequired, *distributorURLs = entry.URL, entry.WitnessQuorum, entry.Distributors
+	case *tofu:
+		if logSigV, pubK, err = trustOnFirstUse(ctx); err != nil {
+			cli.Exitf("Failed to trust log key on first use: %v", err)
+		}
+	default:
+		if logSigV, pubK, err = logSigVerifier(*logPubKeyFile); err != nil {
+			cli.Exitf("failed to read log public key: %v", err)
+		}
+	}
+	if entry == nil {
+		if witnesses, err = witnessSigVerifiers(*witnessPubKeyFiles); err != nil {
+			cli.Exitf("Failed to read witness pub keys: %v", err)
+		}
+	}
+	logID := *logID
+	if logID == "" {
+		logID = log.ID(*origin, pubK)
+	}
+	// The log ID is used to construct paths in the local cache and on
+	// distributors, so make sure it can't be used to escape them.
+	if err := layout.ValidateElement(logID); err != nil {
+		cli.Exitf("Invalid log ID: %v", err)
+	}
+
+	u := *logURL
+	if len(u) == 0 {
+		cli.Exitf("--log_url must be provided")
+	}
+	// url must reference a directory, by definition
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+
+	rootURL, err := url.Parse(u)
+	if err != nil {
+		cli.Exitf("Invalid log URL: %v", err)
+	}
+
+	if want, got := *witnessSigsRequired, len(witnesses); want > got {
+		cli.Exitf("--witness_sigs_required=%d but only %d witnesses configured", want, got)
+	}
+
+	distribs, err := distributors()
+	if err != nil {
+		cli.Exitf("Failed to create distributors list: %v", err)
+	}
+
+	f, err := newFetcher(rootURL)
+	if err != nil {
+		cli.Exitf("Failed to create fetcher: %v", err)
+	}
+	if len(*replicaURLs) > 0 {
+		fs := []client.Fetcher{f}
+		for _, r := range *replicaURLs {
+			if !strings.HasSuffix(r, "/") {
+				r += "/"
+			}
+			ru, err := url.Parse(r)
+			if err != nil {
+				cli.Exitf("Invalid replica URL: %v", err)
+			}
+			rf, err := newFetcher(ru)
+			if err != nil {
+				cli.Exitf("Failed to create fetcher for replica: %v", err)
+			}
+			fs = append(fs, rf)
+		}
+		f = client.NewFailoverFetcher(fs...)
+	}
+	var (
+		cache *client.ArtifactCache
+		scope *client.CacheScope
+	)
+	if len(*cacheDir) > 0 {
+		// Tiles and leaf indices never change once written, so keep hold of
+		// those the command verifies to speed up later verifications, or allow
+		// them to happen offline.
+		cache = client.NewArtifactCache(f, filepath.Join(*cacheDir, logID, "artifacts"))
+		f = cache.Fetch
+		ctx, scope = cache.Scope(ctx)
+	}
+	lc, err := newLogClientTool(ctx, logID, cache, f, logSigV, witnesses, distribs)
+	if err != nil {
+		cli.Exitf("Failed to create new client: %v", err)
+	}
+
+	if len(*serveURL) > 0 {
+		su := *serveURL
+		if !strings.HasSuffix(su, "/") {
+			su += "/"
+		}
+		sURL, err := url.Parse(su)
+		if err != nil {
+			cli.Exitf("Invalid serve URL: %v", err)
+		}
+		lc.API = httpapi.New(sURL, http.DefaultClient)
+	}
+
+	if lc.Attestations, err = attestationCache(logID); err != nil {
+		cli.Exitf("Failed to set up attestations: %v", err)
+	}
+
+	args := commandLine.Args()
+	if len(args) == 0 {
+		usage()
+	}
+	switch args[0] {
+	case "chain":
+		err = lc.chain(ctx, rootURL, args[1:])
+	case "compare-channels":
+		err = lc.compareChannels(ctx, args[1:])
+	case "consistency":
+		err = lc.consistencyProof(ctx, args[1:])
+	case "diff":
+		err = lc.diff(ctx, args[1:])
+	case "export-entries":
+		err = lc.exportEntries(ctx, args[1:])
+	case "inclusion":
+		err = lc.inclusionProof(ctx, args[1:])
+	case "inclusions":
+		err = lc.batchInclusionProof(ctx, args[1:])
+	case "lookup":
+		err = lc.lookupIdentifier(ctx, args[1:])
+	case "redaction":
+		err = lc.redaction(ctx, args[1:])
+	case "sboms":
+		err = lc.sboms(ctx, args[1:])
+	case "search":
+		err = lc.search(ctx, args[1:])
+	case "state":
+		err = lc.logState(ctx, args[1:])
+	case "timestamp":
+		err = lc.timestamp(ctx, args[1:])
+	case "update":
+		err = lc.updateCheckpoint(ctx, args[1:])
+	case "audit":
+		err = lc.audit(ctx, args[1:])
+	case "verify-anchors":
+		err = lc.verifyAnchors(ctx, args[1:])
+	case "verify-layout":
+		err = lc.verifyLayout(ctx, args[1:])
+	case "verify-logfile":
+		err = lc.verifyLogFile(ctx, args[1:])
+	case "verify-receipt":
+		err = lc.verifyReceipt(ctx, args[1:])
+	case "verify-mirror":
+		err = lc.verifyMirror(ctx, args[1:])
+	default:
+		usage()
+	}
+	if scope != nil {
+		scope.Done(err)
+	}
+	if err != nil {
+		cli.Exitf("Command %q failed: %q", args[0], err)
+	}
+
+	// Persist new view of log state, if required.
+	if cache != nil {
+		if err := storeLocalCheckpoint(logID, cache, lc.Tracker.LatestConsistentRaw); err != nil {
+			cli.Exitf("Failed to persist local log state: %q", err)
+		}
+	}
+}
+
+// logClientTool encapsulates the "application level" interaction with the log.
+// It relies heavily on the components provided by the `internal/client` package
+// to accomplish this.
+type logClientTool struct {
+	Fetcher client.Fetcher
+	// Files reads the log's files as they are, without deriving the partial
+	// tiles which the log doesn't store, for checks of which files exist.
+	Files   client.Fetcher
+	Hasher  *rfc6962.Hasher
+	Tracker client.LogStateTracker
+	// API, if set, is used to fetch proofs rather than building them.
+	API *httpapi.Client
+	// Attestations, if set, holds attestations of the artifacts verified on
+	// this host.
+	Attestations *client.AttestationCache
+}
+
+func newLogClientTool(ctx context.Context, logID string, cache *client.ArtifactCache, logFetcher client.Fetcher, logSigV note.Verifier, witnesses []note.Verifier, distributors []client.Fetcher) (*logClientTool, error) {
+	var cpRaw []byte
+	var err error
+	if cache != nil {
+		cpRaw, err = loadLocalCheckpoint(logID, cache, logSigV)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load cached checkpoint: %q", err)
+		}
+	} else {
+		glog.Info("Local log state cache disabled")
+	}
+
+	hasher := rfc6962.DefaultHasher
+	// Logs may not store their partial tiles. Tiles derived in their place
+	// are verified like any other.
+	files := logFetcher
+	logFetcher = client.DerivingFetcher(logFetcher, hasher)
+	var cons client.ConsensusCheckpointFunc
+	if *witnessSigsRequired == 0 {
+		glog.V(1).Infof("witness_sigs_required is 0, using unilateral consensus")
+		cons = client.UnilateralConsensus(logFetcher)
+	} else {
+		glog.V(1).Infof("witness_sigs_required > 0, using checkpoint.N consensus")
+		cons, err = witness.CheckpointNConsensus(logID, distributors, witnesses, *witnessSigsRequired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create consensus func: %v", err)
+		}
+	}
+	tracker, err := client.NewLogStateTracker(ctx, logFetcher, hasher, cpRaw, logSigV, *origin, cons)
+
+	if err != nil {
+		glog.Warningf("%s", string(cpRaw))
+		return nil, fmt.Errorf("failed to create LogStateTracker: %q", err)
+	}
+
+	l := &logClientTool{
+		Fetcher: logFetcher,
+		Files:   files,
+		Hasher:  hasher,
+		Tracker: tracker,
+	}
+	if *snapshotReads {
+		l.Fetcher = client.SnapshotFetcher(logFetcher, func() uint64 { return l.Tracker.LatestConsistent.Size })
+	}
+	return l, nil
+}
+
+func (l *logClientTool) consistencyProof(ctx context.Context, args []string) error {
+	if l := len(args); l != 2 {
+		return fmt.Errorf("usage: consistency <from-size> <to-size>")
+	}
+
+	from, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid from-size %q: %w", args[1], err)
+	}
+	to, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid to-size %q: %w", args[1], err)
+	}
+	if from >= to {
+		return errors.New("from-size must be less than to-size")
+	}
+
+	builder, err := l.newProofBuilder(ctx, l.Tracker.LatestConsistent)
+	if err != nil {
+		return fmt.Errorf("failed to create proof builder: %w", err)
+	}
+
+	p, err := builder.ConsistencyProof(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to build consistency proof: %w", err)
+	}
+
+	glog.V(1).Infof("Built consistency proof: %#x", p)
+
+	if o := *outputConsistency; len(o) > 0 {
+		if err := writeProof(o, api.MerkleProof{Type: api.ConsistencyProofType, Hashes: p}); err != nil {
+			return fmt.Errorf("failed to write consistency proof to %q: %v", o, err)
+		}
+	}
+	return nil
+}
+
+// For the inclusion subcommand, parse the command-line options and arguments to get the entry's
+// hash and index.
+//
+// When the --inclusion_hash option is not provided, the first argument is taken to be the name
+// of a file that will be hashed to look up the entry. The file will be read and the leaf hash
+// will be computed. When the --inclusion_hash option is provided, the first argument will instead
+// be the base64-encoded leaf hash of the node.
+//
+// The entry's index may optionally be provided as an additional argument. If the index is
+// provided, we'll use that index. The entry at that index must match the provided contents
+// or leaf hash. If the index is not provided, we'll do a tree lookup to find the entry's index.
+//
+// Returns the entry's leaf hash and index, or an error.
+func (l *logClientTool) inclusionProofArgs(ctx context.Context, args []string) ([]byte, uint64, error) {
+	var lh []byte
+	var err error
+
+	if l := len(args); l < 1 || l > 2 {
+		return nil, 0, fmt.Errorf("usage: inclusion <file or leaf hash> [index-in-log]")
+	}
+
+	if *inclusionHash {
+		// We have a base-64 encoded leaf hash instead of the name of a file to hash.
+		lh, err = base64.StdEncoding.DecodeString(args[0])
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to base64 decode leaf hash: %w", err)
+		}
+
+	} else {
+		// We have the name of a file to hash.
+		entry, err := os.ReadFile(args[0])
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read entry from %q: %w", args[0], err)
+		}
+		lh = l.Hasher.HashLeaf(entry)
+	}
+
+	var idx uint64
+	if len(args) == 2 {
+		idx, err = strconv.ParseUint(args[1], 16, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid index-in-log %q: %w", args[1], err)
+		}
+	} else {
+		idx, err = client.LookupIndex(ctx, l.Fetcher, lh)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to lookup leaf index: %w", err)
+		}
+		glog.Infof("Leaf %q found at index %d", args[0], idx)
+	}
+
+	return lh, idx, nil
+}
+
+func (l *logClientTool) inclusionProof(ctx context.Context, args []string) error {
+	lh, idx, err := l.inclusionProofArgs(ctx, args)
+	if err != nil {
+		return fmt.Errorf("failed to decode arguments: %w", err)
+	}
+
+	// An attestation can only stand in for the verification if no proof is
+	// to be written.
+	if l.Attestations != nil && len(*outputInclusion) == 0 && len(*outputBundle) == 0 {
+		if a, err := l.Attestations.Lookup(lh, time.Now()); err == nil && a.Index == idx {
+			glog.Infof("Inclusion attested at %v under checkpoint of size %d", a.Time, a.Size)
+			return nil
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			glog.V(1).Infof("Not using attestation: %v", err)
+		}
+	}
+
+	// TODO(al): wait for growth if necessary
+
+	cp := l.Tracker.LatestConsistent
+	var p [][]byte
+	if l.API != nil {
+		p, err = l.fetchInclusionProof(ctx, cp, idx, lh)
+	} else {
+		p, err = client.VerifyInclusion(ctx, l.Fetcher, l.Hasher, cp, idx, lh)
+	}
+	if err != nil {
+		if errors.Is(err, client.ErrNotIntegrated) {
+			return fmt.Errorf("%w, try running the update command first", err)
+		}
+		return err
+	}
+
+	glog.V(1).Infof("Built inclusion proof: %#x", p)
+
+	if o := *outputInclusion; len(o) > 0 {
+		if err := writeProof(o, api.MerkleProof{Type: api.InclusionProofType, LeafIndex: idx, Hashes: p}); err != nil {
+			glog.Warningf("Failed to write inclusion proof to %q: %v", o, err)
+		}
+	}
+	if o := *outputBundle; len(o) > 0 {
+		b := api.ProofBundle{
+			Checkpoint: string(l.Tracker.LatestConsistentRaw),
+			LeafHash:   lh,
+			Proof:      api.InclusionProof{Index: idx, Size: cp.Size, Hashes: p},
+		}
+		if err := os.WriteFile(o, b.Marshal(), 0644); err != nil {
+			glog.Warningf("Failed to write proof bundle to %q: %v", o, err)
+		}
+	}
+
+	glog.Infof("Inclusion verified under checkpoint:\n%s", cp.Marshal())
+	if l.Attestations != nil && len(*attestationKeyFile) > 0 {
+		if _, err := l.Attestations.Attest(cp, idx, lh, time.Now()); err != nil {
+			glog.Warningf("Failed to attest verification: %v", err)
+		}
+	}
+	return nil
+}
+
+// attestationCache returns the cache of attestations of the artifacts of the
+// log with the given ID verified on this host, or nil if attestations aren't
+// used.
+func attestationCache(logID string) (*client.AttestationCache, error) {
+	if len(*attestationKeyFile) == 0 && len(*attestationPubKey) == 0 {
+		return nil, nil
+	}
+	if len(*attestationPubKey) == 0 {
+		return nil, fmt.Errorf("--attestation_key requires --attestation_public_key")
+	}
+	if len(*cacheDir) == 0 {
+		return nil, fmt.Errorf("attestations are stored in --cache_dir, which must be set")
+	}
+	v, err := sigVerifierFromFile(*attestationPubKey)
+	if err != nil {
+		return nil, err
+	}
+	var s note.Signer
+	if len(*attestationKeyFile) > 0 {
+		k, err := keys.Read(context.Background(), *attestationKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --attestation_key: %v", err)
+		}
+		if s, err = i_note.NewSignerForKey(strings.TrimSpace(k)); err != nil {
+			return nil, fmt.Errorf("failed to instantiate attestation signer: %v", err)
+		}
+	}
+	return client.NewAttestationCache(filepath.Join(*cacheDir, logID, "attestations"), *origin, s, v, *attestationTTL), nil
+}
+
+// fetchInclusionProof fetches an inclusion proof for the leaf with hash lh at
+// the given index from the serve tool's API, and verifies it against cp.
+func (l *logClientTool) fetchInclusionProof(ctx context.Context, cp log.Checkpoint, idx uint64, lh []byte) ([][]byte, error) {
+	if idx >= cp.Size {
+		return nil, fmt.Errorf("leaf index %d outside checkpoint size %d: %w", idx, cp.Size, client.ErrNotIntegrated)
+	}
+	raw, err := l.API.GetInclusionProof(ctx, idx, cp.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch inclusion proof: %w", err)
+	}
+	p, err := api.ParseProof(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inclusion proof: %w", err)
+	}
+	if err := proof.VerifyInclusion(l.Hasher, idx, cp.Size, lh, p, cp.Hash); err != nil {
+		return nil, fmt.Errorf("failed to verify inclusion proof: %w", err)
+	}
+	return p, nil
+}
+
+// batchInclusionProof verifies the inclusion of the leaves at each of the
+// hex-encoded indices in args, using a single batch of proofs.
+func (l *logClientTool) batchInclusionProof(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: inclusions <index-in-log> [index-in-log ...]")
+	}
+	indices := make([]uint64, 0, len(args))
+	leafHashes := make([][]byte, 0, len(args))
+	for _, a := range args {
+		idx, err := strconv.ParseUint(a, 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid index-in-log %q: %w", a, err)
+		}
+		leaf, err := client.GetLeaf(ctx, l.Fetcher, idx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch leaf: %w", err)
+		}
+		indices = append(indices, idx)
+		leafHashes = append(leafHashes, l.Hasher.HashLeaf(leaf))
+	}
+
+	cp := l.Tracker.LatestConsistent
+	builder, err := l.newProofBuilder(ctx, cp)
+	if err != nil {
+		return fmt.Errorf("failed to create proof builder: %w", err)
+	}
+	b, err := builder.BatchInclusionProof(ctx, indices)
+	if err != nil {
+		return fmt.Errorf("failed to build batch inclusion proof: %w", err)
+	}
+	if err := b.Verify(l.Hasher, cp.Hash, leafHashes); err != nil {
+		return fmt.Errorf("failed to verify batch inclusion proof: %w", err)
+	}
+
+	if o := *outputInclusion; len(o) > 0 {
+		raw, err := b.MarshalText()
+		if err != nil {
+			return fmt.Errorf("failed to marshal batch inclusion proof: %w", err)
+		}
+		if err := os.WriteFile(o, raw, 0644); err != nil {
+			glog.Warningf("Failed to write batch inclusion proof to %q: %v", o, err)
+		}
+	}
+
+	glog.Infof("Inclusion of %d leaves verified under checkpoint:\n%s", len(indices), cp.Marshal())
+	return nil
+}
+
+func (l *logClientTool) timestamp(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: timestamp <index-in-log>")
+	}
+	idx, err := strconv.ParseUint(args[0], 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid index-in-log %q: %w", args[0], err)
+	}
+	cp := l.Tracker.LatestConsistent
+	if idx >= cp.Size {
+		return fmt.Errorf("entry %d isn't in checkpoint of size %d: %w, try running the update command first", idx, cp.Size, client.ErrNotIntegrated)
+	}
+	leaves, err := client.FetchVerifiedLeaves(ctx, l.Fetcher, l.Hasher, cp, idx, idx+1)
+	if err != nil {
+		return fmt.Errorf("failed to fetch entry: %w", err)
+	}
+	if leaves[0] == nil {
+		return fmt.Errorf("entry %d: %w", idx, client.ErrRedacted)
+	}
+	t, err := client.FetchTimestamp(ctx, l.Fetcher, l.Hasher, l.Tracker.CpSigVerifier, l.Tracker.Origin, idx, l.Hasher.HashLeaf(leaves[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Println(t.Sequenced.UTC().Format(time.RFC3339Nano))
+	return nil
+}
+
+// redaction shows the reason for the redaction of the entry at the given
+// index, after verifying that its redaction record is signed by the log and
+// public, and that the entry it describes is in the log.
+func (l *logClientTool) redaction(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: redaction <index-in-log>")
+	}
+	idx, err := strconv.ParseUint(args[0], 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid index-in-log %q: %w", args[0], err)
+	}
+	r, err := client.FetchRedaction(ctx, l.Fetcher, l.Hasher, l.Tracker.CpSigVerifier, l.Tracker.Origin, idx)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("entry %d hasn't been redacted", idx)
+	} else if err != nil {
+		return err
+	}
+	cp := l.Tracker.LatestConsistent
+	if _, err := client.VerifyInclusion(ctx, l.Fetcher, l.Hasher, cp, idx, r.LeafHash); err != nil {
+		return fmt.Errorf("failed to verify inclusion of redacted entry %d: %w", idx, err)
+	}
+	glog.Infof("Redaction of entry %d with leaf hash %x verified under checkpoint:\n%s", idx, r.LeafHash, cp.Marshal())
+	fmt.Println(r.Reason)
+	return nil
+}
+
+func (l *logClientTool) logState(ctx context.Context, args []string) error {
+	if l := len(args); l != 0 {
+		return fmt.Errorf("usage: state")
+	}
+	m, err := client.FetchManifest(ctx, l.Fetcher, l.Tracker.CpSigVerifier, l.Tracker.Origin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", m.State)
+	if len(m.Reason) > 0 {
+		fmt.Printf("Reason: %s\n", m.Reason)
+	}
+	return nil
+}
+
+// audit recomputes the tree committed to by the latest checkpoint from the
+// log's entries, and reports the first of any tiles or entries which don't
+// match it. Like verifyLayout, this should be run without --cache_dir.
+func (l *logClientTool) audit(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: audit")
+	}
+	var signer note.Signer
+	if len(*auditorKeyFile) > 0 {
+		k, err := keys.Read(ctx, *auditorKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read --auditor_key: %v", err)
+		}
+		if signer, err = i_note.NewSignerForKey(strings.TrimSpace(k)); err != nil {
+			return fmt.Errorf("failed to instantiate auditor signer: %v", err)
+		}
+		if len(*outputReceipt) == 0 {
+			return fmt.Errorf("--auditor_key requires --output_receipt")
+		}
+	}
+	cp := l.Tracker.LatestConsistent
+	opts := client.AuditOptions{Workers: *auditWorkers, MaxMismatches: *maxMismatches}
+	if s := *auditState; len(s) > 0 {
+		raw, err := os.ReadFile(s)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read audit state: %v", err)
+		}
+		if err == nil {
+			prev, err := api.ParseAuditReceipt(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse audit state %q: %v", s, err)
+			}
+			opts.From = log.Checkpoint{Origin: prev.Origin, Size: prev.Size, Hash: prev.Hash}
+			glog.Infof("Continuing audit from tree size %d", prev.Size)
+		}
+	}
+	r, err := client.Audit(ctx, l.Fetcher, l.Hasher, cp, opts)
+	if err != nil {
+		return err
+	}
+	for _, m := range r.Mismatches {
+		fmt.Printf("mismatch: level %d index %d: %s %s\n", m.Level, m.Index, m.Path, m.Reason)
+	}
+	if !r.OK() {
+		return fmt.Errorf("audit of tree size %d found %d mismatches, of which the first %d are shown", cp.Size, r.Total, len(r.Mismatches))
+	}
+	fmt.Printf("Audited tree size %d\n", cp.Size)
+
+	receipt := api.AuditReceipt{Origin: cp.Origin, Size: cp.Size, Hash: cp.Hash}
+	if s := *auditState; len(s) > 0 {
+		if err := writeFileAtomic(s, receipt.Marshal()); err != nil {
+			return fmt.Errorf("failed to write audit state: %v", err)
+		}
+	}
+	if signer != nil {
+		raw, err := note.Sign(&note.Note{Text: string(receipt.Marshal())}, signer)
+		if err != nil {
+			return fmt.Errorf("failed to sign audit receipt: %v", err)
+		}
+		if err := os.WriteFile(*outputReceipt, raw, 0644); err != nil {
+			return fmt.Errorf("failed to write audit receipt: %v", err)
+		}
+	}
+	return nil
+}
+
+// verifyReceipt checks the signature on an auditor's receipt for the log, and
+// that the tree committed to by the latest checkpoint extends the audited one.
+func (l *logClientTool) verifyReceipt(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: verify-receipt <receipt file>")
+	}
+	if len(*auditorPubKeyFile) == 0 {
+		return fmt.Errorf("--auditor_public_key must be set")
+	}
+	v, err := sigVerifierFromFile(*auditorPubKeyFile)
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read receipt: %v", err)
+	}
+	cp := l.Tracker.LatestConsistent
+	r, err := client.OpenAuditReceipt(raw, v, cp.Origin)
+	if err != nil {
+		return err
+	}
+	if r.Size > cp.Size {
+		return fmt.Errorf("receipt is for tree size %d, but the latest checkpoint is for size %d; run update first", r.Size, cp.Size)
+	}
+	audited := log.Checkpoint{Origin: r.Origin, Size: r.Size, Hash: r.Hash}
+	if err := client.CheckConsistency(ctx, l.Hasher, l.Fetcher, []log.Checkpoint{audited, cp}); err != nil {
+		return fmt.Errorf("latest checkpoint is inconsistent with the audited tree: %w", err)
+	}
+	fmt.Printf("Audited by %q up to tree size %d, consistent with tree size %d\n", v.Name(), r.Size, cp.Size)
+	return nil
+}
+
+// verifyAnchors finds the checkpoints of the log which were anchored in the
+// log given by --anchor_log_url, from the given index of its entries, and
+// checks that they're consistent with each other and the latest checkpoint.
+func (l *logClientTool) verifyAnchors(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: verify-anchors [from-index]")
+	}
+	if len(*anchorLogURL) == 0 || len(*anchorPubKeyFile) == 0 || len(*anchorOrigin) == 0 {
+		return fmt.Errorf("--anchor_log_url, --anchor_public_key and --anchor_origin must be set")
+	}
+	var from uint64
+	if len(args) == 1 {
+		var err error
+		if from, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid from-index %q: %v", args[0], err)
+		}
+	}
+	av, err := sigVerifierFromFile(*anchorPubKeyFile)
+	if err != nil {
+		return err
+	}
+	u := *anchorLogURL
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	root, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid anchor log URL: %v", err)
+	}
+	af, err := newFetcher(root)
+	if err != nil {
+		return err
+	}
+	acp, _, _, err := client.FetchCheckpoint(ctx, af, av, *anchorOrigin)
+	if err != nil {
+		return fmt.Errorf("failed to fetch anchoring log checkpoint: %w", err)
+	}
+	if from > acp.Size {
+		return fmt.Errorf("from-index %d is beyond the anchoring log's size %d", from, acp.Size)
+	}
+	cp := l.Tracker.LatestConsistent
+	anchors, err := client.FindAnchors(ctx, af, l.Hasher, *acp, from, acp.Size, l.Tracker.CpSigVerifier, l.Tracker.Origin)
+	if err != nil {
+		return err
+	}
+	for _, a := range anchors {
+		fmt.Printf("anchor: tree size %d at index %d\n", a.Checkpoint.Size, a.Index)
+	}
+	if err := client.VerifyAnchors(ctx, l.Fetcher, l.Hasher, anchors, cp); err != nil {
+		return err
+	}
+	fmt.Printf("%d anchored checkpoints are consistent with tree size %d\n", len(anchors), cp.Size)
+	return nil
+}
+
+// compareChannels checks that the checkpoints published in the channels given
+// by flags are consistent with the log's latest checkpoint. Channels which
+// can't be reached are reported but aren't an error, since a log can't be
+// blamed for the failure of a channel outside it.
+func (l *logClientTool) compareChannels(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: compare-channels")
+	}
+	var chans []client.Channel
+	for _, n := range *dnsTXTNames {
+		chans = append(chans, client.DNSChannel{Domain: n})
+	}
+	for _, wu := range *wellKnownURLs {
+		u, err := url.Parse(wu)
+		if err != nil {
+			return fmt.Errorf("invalid well-known URL %q: %v", wu, err)
+		}
+		chans = append(chans, client.WellKnownChannel{URL: u, Verifier: l.Tracker.CpSigVerifier, Origin: l.Tracker.Origin})
+	}
+	if len(chans) == 0 {
+		return errors.New("at least one --dns_txt_name or --well_known_url must be set")
+	}
+	cp := l.Tracker.LatestConsistent
+	var inconsistent int
+	for _, r := range client.CompareChannels(ctx, l.Fetcher, l.Hasher, cp, chans) {
+		switch {
+		case errors.Is(r.Err, client.ErrInconsistentTree):
+			inconsistent++
+			fmt.Printf("%s: INCONSISTENT: %v\n", r.Name, r.Err)
+		case r.Err != nil:
+			fmt.Printf("%s: unavailable: %v\n", r.Name, r.Err)
+		case r.Ahead(cp):
+			fmt.Printf("%s: tree size %d, ahead of tree size %d, run update to check it\n", r.Name, r.Digest.Size, cp.Size)
+		default:
+			fmt.Printf("%s: tree size %d, consistent\n", r.Name, r.Digest.Size)
+		}
+	}
+	if inconsistent > 0 {
+		return fmt.Errorf("%d channels are inconsistent with the log", inconsistent)
+	}
+	return nil
+}
+
+// verifyLayout checks that the tiles and entries of the log are exactly those
+// of the tree committed to by the latest checkpoint. Like verifyMirror, this
+// should be run without --cache_dir so that missing files aren't hidden.
+func (l *logClientTool) verifyLayout(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: verify-layout")
+	}
+	cp := l.Tracker.LatestConsistent
+	r, err := client.VerifyLayout(ctx, l.Files, l.Hasher, cp)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Missing {
+		fmt.Printf("missing: %s\n", p)
+	}
+	for _, p := range r.Extra {
+		fmt.Printf("extra: %s\n", p)
+	}
+	for _, p := range r.Mismatched {
+		fmt.Printf("mismatched: %s\n", p)
+	}
+	for _, p := range r.Derived {
+		fmt.Printf("derived: %s\n", p)
+	}
+	for _, p := range r.Redacted {
+		fmt.Printf("redacted: %s\n", p)
+	}
+	if !r.OK() {
+		return fmt.Errorf("layout doesn't match tree size %d: %d missing, %d extra, and %d mismatched files", cp.Size, len(r.Missing), len(r.Extra), len(r.Mismatched))
+	}
+	fmt.Printf("Layout matches tree size %d\n", cp.Size)
+	return nil
+}
+
+// verifyMirror checks the files of the log against its inventory for the
+// given tree size, or the latest checkpoint's size. Since the files are read
+// with the same fetcher, this is normally run with --log_url pointing at a
+// mirror, and without --cache_dir so that missing files aren't hidden.
+func (l *logClientTool) verifyMirror(ctx context.Context, args []string) error {
+	if l := len(args); l > 1 {
+		return fmt.Errorf("usage: verify-mirror [tree-size]")
+	}
+	cp := l.Tracker.LatestConsistent
+	size := cp.Size
+	if len(args) == 1 {
+		var err error
+		if size, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid tree-size %q: %w", args[0], err)
+		}
+	}
+	if size > cp.Size {
+		return fmt.Errorf("tree-size %d is larger than the latest checkpoint size %d", size, cp.Size)
+	}
+	inv, err := client.FetchInventory(ctx, l.Fetcher, l.Tracker.CpSigVerifier, l.Tracker.Origin, size)
+	if err != nil {
+		return err
+	}
+	// The inventory is only meaningful if the tree it was built from is the
+	// one we've verified.
+	if inv.Size == cp.Size {
+		if !bytes.Equal(inv.Hash, cp.Hash) {
+			return fmt.Errorf("inventory root hash %x doesn't match checkpoint root hash %x", inv.Hash, cp.Hash)
+		}
+	} else {
+		builder, err := l.newProofBuilder(ctx, cp)
+		if err != nil {
+			return fmt.Errorf("failed to create proof builder: %w", err)
+		}
+		p, err := builder.ConsistencyProof(ctx, inv.Size, cp.Size)
+		if err != nil {
+			return fmt.Errorf("failed to build consistency proof: %w", err)
+		}
+		if err := proof.VerifyConsistency(l.Hasher, inv.Size, cp.Size, p, inv.Hash, cp.Hash); err != nil {
+			return fmt.Errorf("inventory is not consistent with checkpoint: %w", err)
+		}
+	}
+	r, err := client.VerifyInventory(ctx, l.Files, inv)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Missing {
+		fmt.Printf("missing: %s\n", p)
+	}
+	for _, p := range r.Mismatched {
+		fmt.Printf("mismatched: %s\n", p)
+	}
+	if !r.OK() {
+		return fmt.Errorf("%d of %d files are missing or mismatched", len(r.Missing)+len(r.Mismatched), len(inv.Objects))
+	}
+	fmt.Printf("All %d files for tree size %d are present and intact\n", len(inv.Objects), inv.Size)
+	return nil
+}
+
+func (l *logClientTool) lookupIdentifier(ctx context.Context, args []string) error {
+	if l := len(args); l != 1 {
+		return fmt.Errorf("usage: lookup <identifier>")
+	}
+	el, root, err := l.lookupEntries(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	glog.Infof("Verified entries of %q against identifier map at size %d", args[0], root.Size)
+	it := client.IterateEntries(l.Fetcher, el)
+	for it.Next(ctx) {
+		fmt.Println(it.Index())
+	}
+	return it.Err()
+}
+
+// lookupEntries returns the list of entries associated with id in the
+// identifier map committed to by the latest checkpoint, verified against it,
+// along with the map's root.
+func (l *logClientTool) lookupEntries(ctx context.Context, id string) (*api.EntryList, *api.MapRoot, error) {
+	_, ext, _, err := log.ParseCheckpoint(l.Tracker.LatestConsistentRaw, l.Tracker.Origin, l.Tracker.CpSigVerifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	root, err := api.ParseMapRoot(ext)
+	if err != nil {
+		return nil, nil, err
+	}
+	var el *api.EntryList
+	if l.API != nil {
+		var raw []byte
+		raw, err = l.API.LookupIdentifier(ctx, id, root.Size)
+		if err == nil {
+			el, err = client.VerifyMapEntry(*root, id, raw)
+		}
+	} else {
+		el, err = client.LookupIdentifier(ctx, l.Fetcher, *root, id)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("identifier %q not found in identifier map at size %d: %w", id, root.Size, err)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return el, root, nil
+}
+
+// sboms lists the SBOMs in the log which mention an artifact, given by its
+// digest or package URL. Each is checked to be included in the log, and to
+// mention the artifact, since the identifier index only commits to which
+// entries were associated with it.
+func (l *logClientTool) sboms(ctx context.Context, args []string) error {
+	if l := len(args); l != 1 {
+		return fmt.Errorf("usage: sboms <algorithm:hex digest or package URL>")
+	}
+	id := args[0]
+	if !strings.HasPrefix(id, "pkg:") {
+		alg, d, ok := strings.Cut(id, ":")
+		if !ok {
+			return fmt.Errorf("%q is neither a digest of the form <algorithm>:<hex digest> nor a package URL", id)
+		}
+		var err error
+		if id, err = api.DigestIdentifier(alg, d); err != nil {
+			return err
+		}
+	}
+	el, root, err := l.lookupEntries(ctx, id)
+	if errors.Is(err, os.ErrNotExist) {
+		glog.Infof("No entries are associated with %q", id)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	glog.Infof("Verified entries of %q against identifier map at size %d", id, root.Size)
+	cp := l.Tracker.LatestConsistent
+	it := client.IterateEntries(l.Fetcher, el)
+	for it.Next(ctx) {
+		i := it.Index()
+		entry, err := client.GetLeaf(ctx, l.Fetcher, i)
+		if errors.Is(err, client.ErrRedacted) {
+			glog.Warningf("Skipping entry %d, which has been redacted", i)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch entry %d: %w", i, err)
+		}
+		if _, err := client.VerifyInclusion(ctx, l.Fetcher, l.Hasher, cp, i, l.Hasher.HashLeaf(entry)); err != nil {
+			return fmt.Errorf("failed to verify inclusion of entry %d: %w", i, err)
+		}
+		s, err := sbom.Parse(entry)
+		if err != nil {
+			// Other entries, such as attestations, may describe the same
+			// artifact.
+			glog.V(1).Infof("Entry %d isn't an SBOM: %v", i, err)
+			continue
+		}
+		if !s.Mentions(id) {
+			glog.Warningf("Entry %d is associated with %q, but doesn't mention it", i, id)
+			continue
+		}
+		fmt.Printf("%d\t%s\t%s\n", i, s.ContentType, s.Name)
+	}
+	return it.Err()
+}
+
+func (l *logClientTool) chain(ctx context.Context, root *url.URL, args []string) error {
+	if l := len(args); l != 0 {
+		return fmt.Errorf("usage: chain")
+	}
+	logs, err := client.FollowSuccessors(ctx, root, l.Fetcher, l.Tracker.CpSigVerifier, l.Tracker.Origin, newFetcher)
+	if err != nil {
+		return err
+	}
+	for _, ll := range logs {
+		m := ll.Manifest
+		fmt.Printf("%s\t%s\t%s", ll.Root, m.Origin, m.State)
+		if m.Final != nil {
+			fmt.Printf("\tfinal size %d", m.Final.Size)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func (l *logClientTool) updateCheckpoint(ctx context.Context, args []string) error {
+	if l := len(args); l != 0 {
+		return fmt.Errorf("usage: update")
+	}
+
+	glog.V(1).Infof("Original checkpoint:\n%s", l.Tracker.LatestConsistentRaw)
+	cp := l.Tracker.LatestConsistent
+
+	_, p, newCPRaw, err := l.Tracker.Update(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+
+	if o := *outputCheckpoint; len(o) > 0 {
+		if err := os.WriteFile(o, newCPRaw, 0644); err != nil {
+			glog.Warningf("Failed to write latest checkpint to %q: %v", o, err)
+		}
+	}
+	if err := l.checkFreshness(ctx); err != nil {
+		return err
+	}
+
+	if lcp := l.Tracker.LatestConsistent; lcp.Size == cp.Size {
+		glog.Info("Log hasn't grown, nothing to update.")
+		return nil
+	}
+
+	if o := *outputConsistency; len(o) > 0 {
+		if err := writeProof(o, api.MerkleProof{Type: api.ConsistencyProofType, Hashes: p}); err != nil {
+			glog.Warningf("Failed to write consistency proof to %q: %v", o, err)
+		}
+	}
+
+	glog.Infof("Updated checkpoint:\n%s", l.Tracker.LatestConsistentRaw)
+
+	return nil
+}
+
+// checkFreshness checks the time at which the tracked checkpoint was current,
+// signed by one of the timestamping keys given by --timestamp_public_key, if
+// any, against --max_checkpoint_age.
+func (l *logClientTool) checkFreshness(ctx context.Context) error {
+	if len(*tsPubKeyFiles) == 0 {
+		if *maxCheckpointAge > 0 {
+			return errors.New("--max_checkpoint_age needs --timestamp_public_key")
+		}
+		return nil
+	}
+	var vs []note.Verifier
+	for _, f := range *tsPubKeyFiles {
+		v, err := sigVerifierFromFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to read timestamping key: %w", err)
+		}
+		vs = append(vs, v)
+	}
+	cp := l.Tracker.LatestConsistent
+	t, err := client.FetchCheckpointTime(ctx, l.Fetcher, note.VerifierList(vs...), cp)
+	if err != nil {
+		return err
+	}
+	age := time.Since(t)
+	glog.Infof("Checkpoint for tree size %d was current at %v", cp.Size, t.UTC())
+	if *maxCheckpointAge > 0 && age > *maxCheckpointAge {
+		return fmt.Errorf("checkpoint for tree size %d was last timestamped %v ago, longer than --max_checkpoint_age %v", cp.Size, age.Round(time.Second), *maxCheckpointAge)
+	}
+	return nil
+}
+
+// newProofBuilder returns a ProofBuilder for the tree committed to by cp,
+// which fetches up to --fetch_concurrency tiles at once.
+func (l *logClientTool) newProofBuilder(ctx context.Context, cp log.Checkpoint) (*client.ProofBuilder, error) {
+	pb, err := client.NewProofBuilder(ctx, cp, l.Hasher.HashChildren, l.Fetcher)
+	if err != nil {
+		return nil, err
+	}
+	pb.SetFetchConcurrency(*fetchConcurrency)
+	return pb, nil
+}
+
+// newFetcher creates a Fetcher for the log at the given root location.
+func newFetcher(root *url.URL) (client.Fetcher, error) {
+	switch root.Scheme {
+	case "zip":
+		return newZipFetcher(root)
+	case "http", "https":
+		c := client.NewHTTPClient(client.HTTPClientOpts{
+			MaxConnsPerHost:     *maxConnsPerHost,
+			MaxIdleConnsPerHost: *maxIdleConnsPerHost,
+			KeepAlive:           *keepAlive,
+			DisableHTTP2:        *disableHTTP2,
+		})
+		if *requestTimeout > 0 {
+			return client.NewGuardedHTTPFetcher(root, c, guard.New(guard.Options{Deadline: *requestTimeout})), nil
+		}
+		return client.NewHTTPFetcher(root, c), nil
+	}
+	get := getByScheme[root.Scheme]
+	if get == nil {
+		return nil, fmt.Errorf("unsupported URL scheme %s", root.Scheme)
+	}
+
+	return func(ctx context.Context, p string) ([]byte, error) {
+		if err := layout.ValidatePath(p); err != nil {
+			return nil, err
+		}
+		u, err := root.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		return get(ctx, u)
+	}, nil
+}
+
+// newZipFetcher creates a Fetcher which reads a log directly from a zip archive.
+// The URL should be of the form zip:///path/to/archive.zip, optionally with a
+// fragment specifying the directory within the archive containing the log,
+// e.g. zip:///path/to/archive.zip#some/dir.
+func newZipFetcher(root *url.URL) (client.Fetcher, error) {
+	zr, err := zip.OpenReader(strings.TrimSuffix(root.Path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %v", err)
+	}
+	var fsys iofs.FS = zr
+	if sub := strings.Trim(root.Fragment, "/"); sub != "" {
+		if fsys, err = iofs.Sub(zr, sub); err != nil {
+			return nil, fmt.Errorf("invalid directory %q in zip archive: %v", sub, err)
+		}
+	}
+	return client.NewFSFetcher(fsys), nil
+}
+
+var getByScheme = map[string]func(context.Context, *url.URL) ([]byte, error){
+	"file": func(_ context.Context, u *url.URL) ([]byte, error) {
+		return os.ReadFile(u.Path)
+	},
+}
+
+// loadLocalCheckpoint reads the serialised checkpoint for the given logID from the
+// local client cache, which checks that it's intact and signed by the log.
+// A checkpoint left by an earlier version of the client, which stored it
+// outside the cache, is still read, so that the client's view of the log
+// carries over; the LogStateTracker verifies its signature.
+func loadLocalCheckpoint(logID string, cache *client.ArtifactCache, logSigV note.Verifier) ([]byte, error) {
+	cpRaw, err := cache.LoadCheckpoint(*origin, logSigV)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.ReadFile(legacyCheckpointPath(logID))
+	}
+	return cpRaw, err
+}
+
+// storeLocalCheckpoint updates the local client cache for the specified log with
+// the provided serialised log checkpoint, which must have been verified.
+func storeLocalCheckpoint(logID string, cache *client.ArtifactCache, cpRaw []byte) error {
+	if err := cache.StoreCheckpoint(*origin, cpRaw); err != nil {
+		return err
+	}
+	if err := os.Remove(legacyCheckpointPath(logID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// legacyCheckpointPath returns where earlier versions of the client stored
+// the checkpoint of the given log.
+func legacyCheckpointPath(logID string) string {
+	return filepath.Join(*cacheDir, logID, "checkpoint")
+}
+
+// writeFileAtomic replaces the file at p with data, via a temporary file so
+// that it's never left partially written.
+func writeFileAtomic(p string, data []byte) error {
+	tmp := fmt.Sprintf("%s.tmp", p)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Returns a log signature verifier and the public key bytes it uses.
+// Attempts to read key material from the location f, as for keys.Read, or uses
+// the SERVERLESS_LOG_PUBLIC_KEY env var if f is unset.
+func logSigVerifier(f string) (note.Verifier, []byte, error) {
+	pubKey, err := keys.Get(context.Background(), f, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create verifier: %v", err)
+	}
+
+	return v, []byte(pubKey), nil
+}
+
+// logListEntry returns the entry for --origin in the log list given by
+// --log_list, or nil if there's no log list. Flags which the log list takes
+// the place of mustn't also be set, since it would be unclear which wins.
+func logListEntry() (*api.LogListEntry, error) {
+	if len(*logListFile) == 0 {
+		return nil, nil
+	}
+	if len(*logListPubKeyFile) == 0 || len(*logListName) == 0 {
+		return nil, errors.New("--log_list_public_key and --log_list_name must be set with --log_list")
+	}
+	var conflicts []string
+	commandLine.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "log_url", "log_public_key", "witness_public_key", "witness_sigs_required", "distributor_url", "tofu":
+			conflicts = append(conflicts, "--"+f.Name)
+		}
+	})
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%s can't be set with --log_list", strings.Join(conflicts, ", "))
+	}
+	v, err := sigVerifierFromFile(*logListPubKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(*logListFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log list: %v", err)
+	}
+	l, err := client.OpenLogList(raw, v, *logListName)
+	if err != nil {
+		return nil, err
+	}
+	e := l.Find(*origin)
+	if e == nil {
+		return nil, fmt.Errorf("log list %q has no log with origin %q", l.Name, *origin)
+	}
+	return e, nil
+}
+
+// trustOnFirstUse returns the verifier and key of the log at --log_url which
+// are pinned in the trust store, pinning the key the log publishes if it's
+// being contacted for the first time. If --origin isn't set, it's set to the
+// pinned origin.
+func trustOnFirstUse(ctx context.Context) (note.Verifier, []byte, error) {
+	if len(*logPubKeyFile) > 0 || len(*logListFile) > 0 {
+		return nil, nil, errors.New("--log_public_key and --log_list can't be set with --tofu")
+	}
+	if len(*trustStore) == 0 {
+		return nil, nil, errors.New("--trust_store must be set with --tofu")
+	}
+	if len(*logURL) == 0 {
+		return nil, nil, errors.New("--log_url must be provided")
+	}
+	u := *logURL
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	root, err := url.Parse(u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid log URL: %v", err)
+	}
+	f, err := newFetcher(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := client.LoadTrustStore(*trustStore)
+	if err != nil {
+		return nil, nil, err
+	}
+	pin, err := client.TrustOnFirstUse(ctx, f, ts, u)
+	if errors.Is(err, client.ErrPinMismatch) {
+		fmt.Fprintf(os.Stderr, "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\n")
+		fmt.Fprintf(os.Stderr, "WARNING: THE LOG AT %s DOESN'T MATCH ITS PINNED KEY!\n", u)
+		fmt.Fprintf(os.Stderr, "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\n")
+		fmt.Fprintf(os.Stderr, "Someone may be impersonating the log, or its operator may have changed\n")
+		fmt.Fprintf(os.Stderr, "its key or origin. Check with the operator before trusting it again with:\n")
+		fmt.Fprintf(os.Stderr, "  client --trust_store=%s unpin %s\n", *trustStore, u)
+		return nil, nil, err
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if len(*origin) == 0 {
+		*origin = pin.Origin
+	} else if *origin != pin.Origin {
+		return nil, nil, fmt.Errorf("--origin %q doesn't match the pinned origin %q", *origin, pin.Origin)
+	}
+	v, err := i_note.NewVerifierForKey(pin.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, []byte(pin.PublicKey), nil
+}
+
+// managePins runs the pins and unpin commands, which inspect and reset the
+// keys trusted on first use.
+func managePins(cmd string, args []string) error {
+	if len(*trustStore) == 0 {
+		return errors.New("--trust_store must be set")
+	}
+	ts, err := client.LoadTrustStore(*trustStore)
+	if err != nil {
+		return err
+	}
+	if cmd == "pins" {
+		if len(args) > 0 {
+			return errors.New("usage: pins")
+		}
+		for _, p := range ts.Pins() {
+			fmt.Printf("%s\n  origin: %s\n  key: %s\n  pinned: %s\n", p.URL, p.Origin, p.PublicKey, p.Pinned.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("usage: unpin <log url>")
+	}
+	u := args[0]
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	ok, err := ts.Remove(u)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no key is pinned for %s", u)
+	}
+	fmt.Printf("Removed pin for %s, its current key will be trusted next time\n", u)
+	return nil
+}
+
+func witnessSigVerifiers(fs []string) ([]note.Verifier, error) {
+	vs := make([]note.Verifier, 0, len(fs))
+	for _, f := range fs {
+		v, err := sigVerifierFromFile(f)
+		if err != nil {
+			return nil, err
+		}
+		glog.V(1).Infof("Found witness %q", v.Name())
+		vs = append(vs, v)
+	}
+	glog.V(1).Infof("Found %d witnesses", len(vs))
+	return vs, nil
+}
+
+func sigVerifierFromFile(f string) (note.Verifier, error) {
+	k, err := os.ReadFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key from file %q: %v", f, err)
+	}
+	return i_note.NewVerifierForKey(string(k))
+}
+
+func distributors() ([]client.Fetcher, error) {
+	distribs := make([]client.Fetcher, 0)
+	for _, d := range *distributorURLs {
+		u, err := url.Parse(d)
+		if err != nil {
+			return nil, fmt.Errorf("invalid distributor URL %q: %v", d, err)
+		}
+		f, err := newFetcher(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid distributor URL %q: %v", d, err)
+		}
+		distribs = append(distribs, f)
+	}
+	return distribs, nil
+}
+
+// writeProof writes p to the file at path, in the encoding chosen by
+// --proof_encoding.
+func writeProof(path string, p api.MerkleProof) error {
+	raw, err := p.Encode(api.ProofEncoding(*proofEncoding))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0644)
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+)
+
+// diff describes what changed in the log between two checkpoints.
+//
+// By default, the client's latest verified checkpoint is compared with the
+// log's current checkpoint, but either can be replaced with a checkpoint
+// read from a file using the --from and --to flags.
+func (l *logClientTool) diff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	from := fs.String("from", "", "File containing the checkpoint to compare from, defaults to the latest verified checkpoint")
+	to := fs.String("to", "", "File containing the checkpoint to compare to, defaults to the log's current checkpoint")
+	leaves := fs.Bool("leaves", false, "If set, list the index and hash of each new leaf")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("usage: diff [--from=<checkpoint file>] [--to=<checkpoint file>] [--leaves]: %w", err)
+	}
+
+	fromCP := l.Tracker.LatestConsistent
+	if *from != "" {
+		cp, err := l.readCheckpoint(*from)
+		if err != nil {
+			return err
+		}
+		fromCP = *cp
+	}
+	var toCP log.Checkpoint
+	if *to != "" {
+		cp, err := l.readCheckpoint(*to)
+		if err != nil {
+			return err
+		}
+		toCP = *cp
+	} else {
+		if _, _, _, err := l.Tracker.Update(ctx); err != nil {
+			return fmt.Errorf("failed to update checkpoint: %w", err)
+		}
+		toCP = l.Tracker.LatestConsistent
+	}
+
+	if fromCP.Size > toCP.Size {
+		return fmt.Errorf("from checkpoint (size %d) is larger than to checkpoint (size %d)", fromCP.Size, toCP.Size)
+	}
+
+	var p [][]byte
+	if fromCP.Size == toCP.Size {
+		if !bytes.Equal(fromCP.Hash, toCP.Hash) {
+			return fmt.Errorf("checkpoints for size %d have different root hashes %x and %x", fromCP.Size, fromCP.Hash, toCP.Hash)
+		}
+	} else if fromCP.Size > 0 {
+		builder, err := l.newProofBuilder(ctx, toCP)
+		if err != nil {
+			return fmt.Errorf("failed to create proof builder: %w", err)
+		}
+		p, err = builder.ConsistencyProof(ctx, fromCP.Size, toCP.Size)
+		if err != nil {
+			return fmt.Errorf("failed to build consistency proof: %w", err)
+		}
+		if err := proof.VerifyConsistency(l.Hasher, fromCP.Size, toCP.Size, p, fromCP.Hash, toCP.Hash); err != nil {
+			return fmt.Errorf("failed to verify consistency proof: %w", err)
+		}
+	}
+
+	var leafHashes [][]byte
+	if *leaves && toCP.Size > fromCP.Size {
+		var err error
+		leafHashes, err = client.FetchLeafHashes(ctx, l.Fetcher, fromCP.Size, toCP.Size-fromCP.Size, toCP.Size)
+		if err != nil {
+			return fmt.Errorf("failed to fetch new leaf hashes: %w", err)
+		}
+	}
+
+	writeDiff(os.Stdout, fromCP, toCP, p, leafHashes)
+	return nil
+}
+
+// readCheckpoint reads and verifies a checkpoint from the named file.
+func (l *logClientTool) readCheckpoint(f string) (*log.Checkpoint, error) {
+	raw, err := os.ReadFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	cp, _, _, err := log.ParseCheckpoint(raw, l.Tracker.Origin, l.Tracker.CpSigVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint from %q: %w", f, err)
+	}
+	return cp, nil
+}
+
+// writeDiff writes a human readable description of the differences between
+// the two checkpoints to w.
+func writeDiff(w io.Writer, from, to log.Checkpoint, p [][]byte, leafHashes [][]byte) {
+	b64 := base64.StdEncoding.EncodeToString
+	fmt.Fprintf(w, "From: size %d, root %s\n", from.Size, b64(from.Hash))
+	fmt.Fprintf(w, "To:   size %d, root %s\n", to.Size, b64(to.Hash))
+	fmt.Fprintf(w, "New entries: %d\n", to.Size-from.Size)
+	if len(p) > 0 {
+		fmt.Fprintf(w, "Consistency proof:\n%s", api.MarshalProof(p))
+	}
+	if len(leafHashes) > 0 {
+		fmt.Fprintf(w, "New leaves:\n")
+		for i, lh := range leafHashes {
+			fmt.Fprintf(w, "%x %s\n", from.Size+uint64(i), b64(lh))
+		}
+	}
+}
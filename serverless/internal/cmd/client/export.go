@@ -0,0 +1,187 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/parquet"
+)
+
+// exportedEntry is the representation of a log entry written by the
+// export-entries command.
+type exportedEntry struct {
+	Index    uint64 `json:"index"`
+	LeafHash []byte `json:"leaf_hash"`
+	// Only one of Payload or PayloadSHA256 is set.
+	Payload       []byte `json:"payload,omitempty"`
+	PayloadSHA256 string `json:"payload_sha256,omitempty"`
+}
+
+// exportEntries writes the verified leaves in the range given by args to a
+// file, or stdout, in a format suitable for loading into analytics pipelines.
+func (l *logClientTool) exportEntries(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export-entries", flag.ContinueOnError)
+	format := fs.String("format", "jsonl", "Output format, one of csv, jsonl, or parquet")
+	payload := fs.Bool("payload", false, "If set, include the leaf payloads in the output, otherwise only their SHA256 hashes are included")
+	output := fs.String("output", "", "File to write entries to, defaults to stdout")
+	padding := fs.Bool("include_padding", false, "If set, include padding entries, which carry no data, in the output")
+	usage := "usage: export-entries [--format=csv|jsonl|parquet] [--payload] [--include_padding] [--output=<file>] <from-index> <to-index>"
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 2 {
+		return errors.New(usage)
+	}
+	from, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid from-index %q: %w", fs.Arg(0), err)
+	}
+	to, err := strconv.ParseUint(fs.Arg(1), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid to-index %q: %w", fs.Arg(1), err)
+	}
+
+	var write func(io.Writer, []exportedEntry) error
+	switch *format {
+	case "csv":
+		write = writeCSV
+	case "jsonl":
+		write = writeJSONL
+	case "parquet":
+		write = writeParquet
+	default:
+		return fmt.Errorf("unsupported format %q, want csv, jsonl, or parquet", *format)
+	}
+
+	cp := l.Tracker.LatestConsistent
+	leaves, err := client.FetchVerifiedLeaves(ctx, l.Fetcher, l.Hasher, cp, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to fetch verified leaves: %w", err)
+	}
+	entries := make([]exportedEntry, 0, len(leaves))
+	skipped, redacted := 0, 0
+	for i, leaf := range leaves {
+		// The log withholds the data of redacted entries.
+		if leaf == nil {
+			redacted++
+			continue
+		}
+		// Padding entries are still verified above, as they're part of the
+		// tree, but are otherwise of no interest.
+		if !*padding && api.IsPaddingEntry(leaf) {
+			skipped++
+			continue
+		}
+		e := exportedEntry{
+			Index:    from + uint64(i),
+			LeafHash: l.Hasher.HashLeaf(leaf),
+		}
+		if *payload {
+			e.Payload = leaf
+		} else {
+			h := sha256.Sum256(leaf)
+			e.PayloadSHA256 = hex.EncodeToString(h[:])
+		}
+		entries = append(entries, e)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, entries); err != nil {
+		return fmt.Errorf("failed to write entries: %w", err)
+	}
+	glog.Infof("Exported %d entries, skipping %d padding and %d redacted entries, verified under checkpoint:\n%s", len(entries), skipped, redacted, cp.Marshal())
+	return nil
+}
+
+// writeJSONL writes entries as JSON objects, one per line.
+func writeJSONL(w io.Writer, entries []exportedEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes entries as CSV, with a header row.
+// Binary fields are base64 encoded.
+func writeCSV(w io.Writer, entries []exportedEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"index", "leaf_hash", "payload", "payload_sha256"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var p string
+		if e.Payload != nil {
+			p = base64.StdEncoding.EncodeToString(e.Payload)
+		}
+		if err := cw.Write([]string{strconv.FormatUint(e.Index, 10), base64.StdEncoding.EncodeToString(e.LeafHash), p, e.PayloadSHA256}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeParquet writes entries as a Parquet file, with a column per field.
+// Whichever of the payload columns isn't exported holds only nulls.
+func writeParquet(w io.Writer, entries []exportedEntry) error {
+	var (
+		index    = make([]int64, 0, len(entries))
+		leafHash = make([][]byte, 0, len(entries))
+		payload  = make([][]byte, 0, len(entries))
+		sha      = make([][]byte, 0, len(entries))
+	)
+	for _, e := range entries {
+		index = append(index, int64(e.Index))
+		leafHash = append(leafHash, e.LeafHash)
+		payload = append(payload, e.Payload)
+		var h []byte
+		if e.PayloadSHA256 != "" {
+			h = []byte(e.PayloadSHA256)
+		}
+		sha = append(sha, h)
+	}
+	return parquet.Write(w, []parquet.Column{
+		{Name: "index", Type: parquet.Int64, ConvertedType: parquet.Uint64, Int64s: index},
+		{Name: "leaf_hash", Type: parquet.ByteArray, ByteArrays: leafHash},
+		{Name: "payload", Type: parquet.ByteArray, Optional: true, ByteArrays: payload},
+		{Name: "payload_sha256", Type: parquet.ByteArray, ConvertedType: parquet.UTF8, Optional: true, ByteArrays: sha},
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+)
+
+// verifyLogFile checks a host's log file against the segments of it rolled
+// up into the log by the logroll tool, found through the identifier map.
+func (l *logClientTool) verifyLogFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify-logfile", flag.ContinueOnError)
+	name := fs.String("name", "", "Name the file was recorded under, defaults to its path")
+	usage := "usage: verify-logfile [--name=<recorded name>] <host> <file>"
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 2 {
+		return errors.New(usage)
+	}
+	host, path := fs.Arg(0), fs.Arg(1)
+	if *name == "" {
+		*name = path
+	}
+
+	cp := l.Tracker.LatestConsistent
+	_, ext, _, err := log.ParseCheckpoint(l.Tracker.LatestConsistentRaw, l.Tracker.Origin, l.Tracker.CpSigVerifier)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	root, err := api.ParseMapRoot(ext)
+	if err != nil {
+		return err
+	}
+	segs, err := client.FetchLogSegments(ctx, l.Fetcher, l.Hasher, cp, *root, host)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("host %q not found in identifier map at size %d", host, root.Size)
+	} else if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	res, err := client.VerifyLogFile(segs, *name, f, uint64(fi.Size()))
+	if err != nil {
+		return err
+	}
+	for _, s := range res.Mismatched {
+		fmt.Printf("MISMATCHED bytes [%d, %d)\n", s.Offset, s.Offset+s.Length)
+	}
+	glog.Infof("Verified %d segments of %q from %q against identifier map at size %d, skipping %d segments of rotated files; %d bytes not yet recorded", len(res.Verified), *name, host, root.Size, res.Rotated, res.Unrecorded)
+	if !res.OK() {
+		return fmt.Errorf("%d segments of %q don't match the log", len(res.Mismatched), *name)
+	}
+	return nil
+}
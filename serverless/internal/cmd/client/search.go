@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+)
+
+// search lists the entries in the log which start with a prefix, for logs
+// which index entries by their leading bytes. The index is looked up by the
+// first bytes of the prefix which the log indexes, and each entry found is
+// checked to be included in the log and to start with the whole prefix.
+func (l *logClientTool) search(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "Hex encoded prefix of the entries to list")
+	text := fs.Bool("text", false, "If set, --prefix is taken as text rather than hex")
+	usage := "usage: search --prefix=<hex prefix> [--text]"
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 0 || len(*prefix) == 0 {
+		return errors.New(usage)
+	}
+	p := []byte(*prefix)
+	if !*text {
+		var err error
+		if p, err = hex.DecodeString(*prefix); err != nil {
+			return fmt.Errorf("invalid hex prefix %q: %w", *prefix, err)
+		}
+	}
+
+	m, err := client.FetchManifest(ctx, l.Fetcher, l.Tracker.CpSigVerifier, l.Tracker.Origin)
+	if err != nil {
+		return err
+	}
+	if m.PrefixIndex == 0 {
+		return errors.New("log doesn't index entries by prefix")
+	}
+	if len(p) < m.PrefixIndex {
+		return fmt.Errorf("log indexes entries by their first %d bytes, so the prefix must be at least that long", m.PrefixIndex)
+	}
+	id := api.PrefixIdentifier(p[:m.PrefixIndex])
+	el, root, err := l.lookupEntries(ctx, id)
+	if errors.Is(err, os.ErrNotExist) {
+		glog.Infof("No entries start with %x", p)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	glog.Infof("Verified entries of %q against identifier map at size %d", id, root.Size)
+	cp := l.Tracker.LatestConsistent
+	it := client.IterateEntries(l.Fetcher, el)
+	for it.Next(ctx) {
+		i := it.Index()
+		entry, err := client.GetLeaf(ctx, l.Fetcher, i)
+		if errors.Is(err, client.ErrRedacted) {
+			glog.Warningf("Skipping entry %d, which has been redacted", i)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch entry %d: %w", i, err)
+		}
+		if _, err := client.VerifyInclusion(ctx, l.Fetcher, l.Hasher, cp, i, l.Hasher.HashLeaf(entry)); err != nil {
+			return fmt.Errorf("failed to verify inclusion of entry %d: %w", i, err)
+		}
+		if !bytes.HasPrefix(entry, p[:m.PrefixIndex]) {
+			// Submitters can associate entries with any identifier, so the
+			// index can't be trusted to only list matching entries.
+			glog.Warningf("Entry %d is indexed under %q, but doesn't start with it", i, id)
+			continue
+		}
+		if bytes.HasPrefix(entry, p) {
+			fmt.Println(i)
+		}
+	}
+	return it.Err()
+}
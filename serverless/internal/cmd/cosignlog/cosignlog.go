@@ -0,0 +1,256 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cosignlog provides a command line tool for adding cosign image
+// signatures and attestations to a serverless log, and for requiring their
+// inclusion in it in verification pipelines alongside `cosign verify`.
+package cosignlog
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/cosign"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("cosign_log", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory of the log, for the submit command.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of the log's public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = commandLine.String("origin", "", "Log origin string.")
+	logURL     = commandLine.String("log_url", "", "If set, root URL of the log, e.g. file:///path/to/log or https://log.server/and/path, which the verify command fetches proof bundles from.")
+	bundleDir  = commandLine.String("bundle_dir", "", "Directory of proof bundles, named by the hex leaf hash of the signature's entry with a .json suffix. The verify command reads bundles from it, or, with --log_url, writes the bundles it fetches to it.")
+	requireAll = commandLine.Bool("require_all", false, "If set, the verify command requires every signature to be in the log, rather than at least one.")
+)
+
+const usage = `Usage:
+ cosign_log --storage_dir=<dir> --origin=<origin> submit [<file>]
+ cosign_log --origin=<origin> (--log_url=<url> | --bundle_dir=<dir>) verify [<file>]
+
+Reads the output of "cosign download signature" or "cosign download
+attestation" from the file, or from stdin if it's - or not given.
+
+submit adds each signature to the log, indexed by the digests of the images
+or artifacts it's about.
+
+verify requires each signature, or at least one with --require_all unset, to
+be in the log, as shown by a proof bundle.
+`
+
+// Command is the cosign_log command.
+var Command = &cli.Command{
+	Name:    "cosign_log",
+	Summary: "Add cosign signatures to a log, and require their inclusion in it",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+	args := commandLine.Args()
+	if len(args) < 1 || len(args) > 2 {
+		cli.ExitWith(cli.ExitUsage, usage)
+	}
+	if len(*origin) == 0 {
+		cli.ExitWith(cli.ExitUsage, "Please set --origin flag to log identifier.")
+	}
+	in := "-"
+	if len(args) == 2 {
+		in = args[1]
+	}
+	sigs, err := readSignatures(in)
+	if err != nil {
+		cli.Exitf("Failed to read signatures: %q", err)
+	}
+	v, err := log.LoadVerifier(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Failed to load log public key, supply it with --public_key or SERVERLESS_LOG_PUBLIC_KEY: %q", err)
+	}
+	switch args[0] {
+	case "submit":
+		err = submit(ctx, v, sigs)
+	case "verify":
+		err = verify(ctx, v, sigs)
+	default:
+		cli.ExitWith(cli.ExitUsage, usage)
+	}
+	if err != nil {
+		cli.Exitf("Command %q failed: %q", args[0], err)
+	}
+}
+
+// readSignatures reads the cosign signatures in the file at path p, or in
+// stdin if it's "-".
+func readSignatures(p string) ([]*cosign.Signature, error) {
+	var raw []byte
+	var err error
+	if p == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cosign.Parse(raw)
+}
+
+// submit adds the signatures to the log in --storage_dir.
+func submit(ctx context.Context, v note.Verifier, sigs []*cosign.Signature) error {
+	if len(*storageDir) == 0 {
+		return errors.New("--storage_dir must be set")
+	}
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		return fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		return fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	m, err := client.FetchManifest(ctx, f, v, *origin)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if !m.State.AcceptsEntries() {
+		return fmt.Errorf("log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		return fmt.Errorf("failed to load storage: %w", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+	ns, err := client.FetchNamespaces(ctx, f, v, *origin)
+	if err != nil {
+		return fmt.Errorf("failed to read namespace registry: %w", err)
+	}
+
+	added := 0
+	for _, s := range sigs {
+		opts := log.SequenceOpts{Origin: *origin, Identifiers: s.Subjects, Namespaces: ns}
+		r, err := log.SequenceEntry(ctx, st, rfc6962.DefaultHasher, s.Entry(), opts)
+		if err != nil {
+			return fmt.Errorf("failed to sequence signature of %s: %w", strings.Join(s.Subjects, ", "), err)
+		}
+		l := fmt.Sprintf("%d: signature of %s", r.Seq, strings.Join(s.Subjects, ", "))
+		if r.Dupe {
+			l += " (dupe)"
+		} else {
+			added++
+		}
+		glog.Info(l)
+	}
+	if added == 0 {
+		cli.ExitWith(cli.ExitDupesOnly, "All signatures were already in the log")
+	}
+	return nil
+}
+
+// verify checks that the signatures are in the log, as required by
+// --require_all, using the proof bundles in --bundle_dir, or fetched from
+// --log_url.
+func verify(ctx context.Context, v note.Verifier, sigs []*cosign.Signature) error {
+	h := rfc6962.DefaultHasher
+	var b *client.Bundler
+	switch {
+	case len(*logURL) > 0:
+		f, err := newFetcher(*logURL)
+		if err != nil {
+			return err
+		}
+		// Logs may not store their partial tiles.
+		if b, err = client.NewBundler(ctx, client.DerivingFetcher(f, h), h, v, *origin, client.BundlerOpts{}); err != nil {
+			return err
+		}
+		if len(*bundleDir) > 0 {
+			if err := os.MkdirAll(*bundleDir, 0o755); err != nil {
+				return err
+			}
+		}
+	case len(*bundleDir) == 0:
+		return errors.New("one of --log_url or --bundle_dir must be set")
+	}
+
+	included := 0
+	for _, s := range sigs {
+		lh := h.HashLeaf(s.Entry())
+		bp := filepath.Join(*bundleDir, hex.EncodeToString(lh)+".json")
+		var raw []byte
+		var err error
+		if b != nil {
+			raw, err = b.BundleByHash(ctx, lh)
+		} else {
+			raw, err = os.ReadFile(bp)
+		}
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, client.ErrNotIntegrated) {
+			glog.Warningf("Signature of %s isn't in the log: %v", strings.Join(s.Subjects, ", "), err)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get proof bundle: %w", err)
+		}
+		pb, err := s.VerifyBundle(raw, h, v, *origin)
+		if err != nil {
+			return fmt.Errorf("invalid proof bundle for signature of %s: %w", strings.Join(s.Subjects, ", "), err)
+		}
+		if b != nil && len(*bundleDir) > 0 {
+			if err := os.WriteFile(bp, raw, 0o644); err != nil {
+				return fmt.Errorf("failed to write proof bundle: %w", err)
+			}
+		}
+		fmt.Printf("Signature of %s is at index %d of %q, size %d\n", strings.Join(s.Subjects, ", "), pb.Proof.Index, *origin, pb.Proof.Size)
+		included++
+	}
+	if included == 0 || (*requireAll && included < len(sigs)) {
+		cli.ExitWith(cli.ExitVerificationFailed, "%d of %d signatures are in the log", included, len(sigs))
+	}
+	return nil
+}
+
+// newFetcher returns a fetcher for the log with the given root URL.
+func newFetcher(u string) (client.Fetcher, error) {
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	root, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log URL: %w", err)
+	}
+	switch root.Scheme {
+	case "file":
+		return client.NewFSFetcher(os.DirFS(root.Path)), nil
+	case "http", "https":
+		return client.NewHTTPFetcher(root, client.NewHTTPClient(client.HTTPClientOpts{})), nil
+	}
+	return nil, fmt.Errorf("unsupported URL scheme %s", root.Scheme)
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generatekeys provides a command line tool for creating signing keys
+package generatekeys
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("generate_keys", flag.ExitOnError)
+
+var (
+	keyName = commandLine.String("key_name", "", "Name for the key identity.")
+	keyType = commandLine.String("key_type", "ed25519", "Type of key to create: ed25519, for plain note signatures, cosignature/v1, for timestamped signatures on checkpoints, as made by witnesses, or threshold-ed25519, for a public key which needs signatures by --threshold of the keys given by --member_public_key.")
+	outPriv = commandLine.String("out_priv", "", "Output file for private key.")
+	outPub  = commandLine.String("out_pub", "", "Output file for public key.")
+	print   = commandLine.Bool("print", false, "Print private key, then public key, over 2 lines, to stdout.")
+
+	threshold         = commandLine.Int("threshold", 0, "Number of member signatures needed by a threshold-ed25519 key.")
+	memberPubKeyFiles cli.StringList
+)
+
+func init() {
+	commandLine.Var(&memberPubKeyFiles, "member_public_key", "Location of the public key of a member of a threshold-ed25519 key. May be repeated.")
+}
+
+// Command is the generate_keys command.
+var Command = &cli.Command{
+	Name:    "generate_keys",
+	Summary: "Create note signing keys",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*keyName) == 0 {
+		cli.Exit("--key_name required")
+	}
+
+	if *keyType == i_note.ThresholdEd25519 {
+		generateThreshold()
+		return
+	}
+
+	if !(*print) {
+		if len(*outPriv) == 0 || len(*outPub) == 0 {
+			cli.Exit("--print and/or --out_priv and --out_pub required.")
+		}
+	}
+
+	var skey, vkey string
+	var err error
+	switch *keyType {
+	case "ed25519":
+		skey, vkey, err = note.GenerateKey(rand.Reader, *keyName)
+	case i_note.CosignatureV1:
+		skey, vkey, err = i_note.GenerateCosignatureV1Key(rand.Reader, *keyName)
+	default:
+		cli.Exitf("Unknown --key_type %q, want ed25519, %s or %s", *keyType, i_note.CosignatureV1, i_note.ThresholdEd25519)
+	}
+	if err != nil {
+		cli.Exitf("Unable to create key: %q", err)
+	}
+
+	if *print {
+		fmt.Println(skey)
+		fmt.Println(vkey)
+	}
+
+	if len(*outPriv) > 0 && len(*outPub) > 0 {
+		if err := writeFileIfNotExists(*outPriv, skey); err != nil {
+			cli.Exit(err)
+		}
+		if err := writeFileIfNotExists(*outPub, vkey); err != nil {
+			cli.Exit(err)
+		}
+	}
+}
+
+// generateThreshold creates a threshold key from the member keys. It has only
+// a public key, since signatures are made by the members.
+func generateThreshold() {
+	if !*print && len(*outPub) == 0 {
+		cli.Exit("--print and/or --out_pub required.")
+	}
+	var members []string
+	for _, f := range memberPubKeyFiles {
+		k, err := keys.Read(context.Background(), f)
+		if err != nil {
+			cli.Exitf("Unable to read member key: %q", err)
+		}
+		members = append(members, strings.TrimSpace(k))
+	}
+	vkey, err := i_note.GenerateThresholdKey(*keyName, *threshold, members)
+	if err != nil {
+		cli.Exitf("Unable to create key: %q", err)
+	}
+	if *print {
+		fmt.Println(vkey)
+	}
+	if len(*outPub) > 0 {
+		if err := writeFileIfNotExists(*outPub, vkey); err != nil {
+			cli.Exit(err)
+		}
+	}
+}
+
+// writeFileIfNotExists writes key files. Ensures files do not already exist to avoid accidental overwriting.
+func writeFileIfNotExists(filename string, key string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create new key file %q: %w", filename, err)
+	}
+	_, err = file.WriteString(key)
+	if err != nil {
+		return fmt.Errorf("unable to write new key file %q: %w", filename, err)
+	}
+	return file.Close()
+}
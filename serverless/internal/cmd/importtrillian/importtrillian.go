@@ -0,0 +1,149 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package importtrillian provides a command line tool for migrating the contents of a
+// Trillian log into a serverless log.
+package importtrillian
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/migrate"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("import_trillian", flag.ExitOnError)
+
+var (
+	trillianAddr = commandLine.String("trillian_addr", "", "Address of the Trillian log server's gRPC API, e.g. localhost:8090")
+	treeID       = commandLine.Int64("tree_id", 0, "Tree ID of the Trillian log to import from")
+	dialTimeout  = commandLine.Duration("dial_timeout", 30*time.Second, "Timeout for connecting to the Trillian log server")
+	batchSize    = commandLine.Int64("batch_size", 1000, "Maximum number of leaves to request from the Trillian log at a time")
+	storageDir   = commandLine.String("storage_dir", "", "Root directory of the serverless log to import into, it must already have been initialised by the integrate command")
+	pubKeyFile   = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile  = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin       = commandLine.String("origin", "", "Log origin string to use in produced checkpoint.")
+)
+
+// Command is the import_trillian command.
+var Command = &cli.Command{
+	Name:    "import_trillian",
+	Summary: "Migrate the contents of a Trillian log into a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	if len(*trillianAddr) == 0 {
+		cli.Exitf("Please set --trillian_addr flag.")
+	}
+
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := i_note.NewSignerForKey(privKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, *dialTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(dctx, *trillianAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		cli.Exitf("Failed to connect to Trillian on %v: %q", *trillianAddr, err)
+	}
+	defer conn.Close()
+
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to lock storage: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to open Checkpoint: %q", err)
+	}
+	m, err := client.FetchManifest(ctx, client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.AcceptsEntries() {
+		cli.Exitf("Log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetImmutable(m.Immutable)
+	st.SetPrefixIndex(m.PrefixIndex)
+	st.SetIndexFormat(m.IndexFormat)
+	st.SetPartialTiles(m.PartialTiles)
+	st.SetDuplicatePolicy(m.Duplicates)
+
+	newCP, err := migrate.ImportTrillian(ctx, trillian.NewTrillianLogClient(conn), *treeID, st, rfc6962.DefaultHasher, *cp, *batchSize)
+	if err != nil {
+		cli.Exitf("Failed to import: %q", err)
+	}
+	if newCP.Size == cp.Size {
+		cli.ExitWith(cli.ExitNothingToDo, "Nothing to import")
+	}
+
+	newCP.Origin = *origin
+	cpNoteSigned, err := note.Sign(&note.Note{Text: string(newCP.Marshal())}, s)
+	if err != nil {
+		cli.Exitf("Failed to sign Checkpoint: %q", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpNoteSigned); err != nil {
+		cli.Exitf("Failed to store new log checkpoint: %q", err)
+	}
+	glog.Infof("Imported %d entries, log now has size %d", newCP.Size-cp.Size, newCP.Size)
+}
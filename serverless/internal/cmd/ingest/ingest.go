@@ -0,0 +1,176 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ingest provides a daemon which sequences the messages read from a
+// Kafka topic or NATS JetStream consumer as entries in a serverless log.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/ingest"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("ingest", flag.ExitOnError)
+
+var (
+	storageDir   = commandLine.String("storage_dir", "", "Root directory to store log data.")
+	pubKeyFile   = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin       = commandLine.String("origin", "", "Log origin string to check for in checkpoint.")
+	source       = commandLine.String("source", "kafka", "Where to read entries from: kafka or jetstream.")
+	brokers      = commandLine.String("brokers", "", "Comma separated list of Kafka broker addresses, or NATS server URLs.")
+	topic        = commandLine.String("topic", "", "Kafka topic, or JetStream subject, to read entries from.")
+	groupID      = commandLine.String("group_id", "serverless-log", "Kafka consumer group ID, or JetStream durable consumer name, under which progress is recorded.")
+	batchSize    = commandLine.Int("batch_size", 100, "Largest number of messages to sequence before acknowledging them.")
+	batchTimeout = commandLine.Duration("batch_timeout", time.Second, "How long to wait for a batch to fill up before sequencing it.")
+	keyPattern   = commandLine.String("key_pattern", "", "If set, a regular expression matching the message keys to map to identifiers. Entries of messages with other keys aren't associated with identifiers.")
+	idTemplate   = commandLine.String("identifier_template", "$0", "Template, as for Go's regexp.Expand, of the identifier to associate with the entry of a message whose key matches --key_pattern.")
+	maxLeaf      = commandLine.Int("max_leaf_size", 0, "If set, the largest entry in bytes which may be added to the log. Larger entries are skipped.")
+	contentType  = commandLine.String("content_type", "", "If set, the content type to tag the entries of all messages with. Entries of types with a registered handler are validated, and those which aren't valid are skipped. Required if the log's manifest declares the content types it accepts.")
+)
+
+// Command is the ingest command.
+var Command = &cli.Command{
+	Name:    "ingest",
+	Summary: "Sequence messages from Kafka or NATS JetStream",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*brokers) == 0 || len(*topic) == 0 {
+		cli.Exit("--brokers and --topic must be set")
+	}
+
+	// Read log public key from file or environment variable
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	opts := ingest.Opts{BatchSize: *batchSize, BatchTimeout: *batchTimeout, ContentType: *contentType}
+	if len(*keyPattern) > 0 {
+		if opts.Identifiers, err = ingest.NewKeyMapper(*keyPattern, *idTemplate); err != nil {
+			cli.Exitf("Invalid --key_pattern: %q", err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	m, err := client.FetchManifest(ctx, f, v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.AcceptsEntries() {
+		cli.Exitf("Log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	if len(*contentType) > 0 {
+		if err := api.ValidateContentType(*contentType); err != nil {
+			cli.Exitf("Invalid --content_type: %v", err)
+		}
+	}
+	if !m.AcceptsContentType(*contentType) {
+		cli.Exitf("Log doesn't accept entries of content type %q, only %s", *contentType, strings.Join(m.ContentTypes, ", "))
+	}
+	if opts.Namespaces, err = client.FetchNamespaces(ctx, f, v, *origin); err != nil {
+		cli.Exitf("Failed to read namespace registry: %q", err)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+	st.SetMaxLeafSize(*maxLeaf)
+
+	var run func(context.Context) error
+	switch *source {
+	case "kafka":
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: strings.Split(*brokers, ","),
+			Topic:   *topic,
+			GroupID: *groupID,
+		})
+		defer func() {
+			if err := r.Close(); err != nil {
+				glog.Warningf("Failed to close Kafka reader: %q", err)
+			}
+		}()
+		s, err := ingest.NewKafkaSource(r, st, rfc6962.DefaultHasher, opts)
+		if err != nil {
+			cli.Exitf("Failed to create Kafka source: %q", err)
+		}
+		run = s.Run
+	case "jetstream":
+		nc, err := nats.Connect(*brokers)
+		if err != nil {
+			cli.Exitf("Failed to connect to NATS: %q", err)
+		}
+		defer nc.Close()
+		js, err := nc.JetStream()
+		if err != nil {
+			cli.Exitf("Failed to get JetStream context: %q", err)
+		}
+		// Limiting the unacknowledged messages to a batch stops the server
+		// from pushing messages faster than they can be sequenced.
+		sub, err := js.PullSubscribe(*topic, *groupID, nats.MaxAckPending(*batchSize), nats.ManualAck())
+		if err != nil {
+			cli.Exitf("Failed to subscribe to %q: %q", *topic, err)
+		}
+		s, err := ingest.NewJetStreamSource(ingest.NewJetStreamConsumer(sub), st, rfc6962.DefaultHasher, opts)
+		if err != nil {
+			cli.Exitf("Failed to create JetStream source: %q", err)
+		}
+		run = s.Run
+	default:
+		cli.Exitf("Unknown --source %q", *source)
+	}
+	glog.Infof("Sequencing entries from %s %q", *source, *topic)
+	if err := run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		cli.Exitf("Failed to sequence entries: %q", err)
+	}
+}
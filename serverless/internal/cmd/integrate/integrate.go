@@ -0,0 +1,545 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package integrate provides a command line tool for integrating sequenced
+// entries into a serverless log.
+package integrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	"github.com/google/trillian-examples/internal/kms"
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("integrate", flag.ExitOnError)
+
+var (
+	storageDir     = commandLine.String("storage_dir", "", "Root directory to store log data.")
+	initialise     = commandLine.Bool("initialise", false, "Set when creating a new log to initialise the structure.")
+	pubKeyFile     = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile    = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	kmsKey         = commandLine.String("kms_key", "", "URI of a KMS or HSM held signing key to use instead of --private_key: gcpkms://<Cloud KMS key version name> or dsm://<Fortanix DSM key name>.")
+	origin         = commandLine.String("origin", "", "Log origin string to use in produced checkpoint.")
+	stage          = commandLine.Bool("stage", false, "Set to integrate new entries and stage the resulting checkpoint without publishing it.")
+	publish        = commandLine.Bool("publish", false, "Set to sign and publish the previously staged checkpoint.")
+	precompute     = commandLine.Bool("precompute_proofs", false, "Set to store the inclusion proof of every entry in the newly published tree, so that a static host can serve proofs. Only suitable for small logs.")
+	immutable      = commandLine.Bool("immutable_layout", false, "Set with --initialise to create a log which uses the immutable layout, in which published files other than the checkpoint, manifest, and identifier index are never rewritten, so that the log can safely be fronted by a CDN.")
+	releaseBatch   = commandLine.Uint64("release_batch_size", 0, "If set, only integrates sequenced entries in batches of this many, holding back the remainder, so that the times at which the log grows don't reveal when entries were submitted.")
+	releasePadding = commandLine.Bool("release_padding", false, "With --release_batch_size, pads incomplete batches with padding entries rather than holding them back.")
+	memoryBudget   = commandLine.Uint64("memory_budget", 0, "If set, roughly the number of bytes of new tiles to hold in memory while integrating. Tiles are otherwise all held until the end of integration, so the memory needed grows with the number of entries integrated at once.")
+	duplicates     = commandLine.String("duplicates", "", "Set with --initialise to the log's duplicate policy, one of reject, original, allow, or namespace. Defaults to reject.")
+	timestamps     = commandLine.Bool("timestamps", false, "Set with --initialise to create a log which publishes the time at which each entry was sequenced, in a timestamp log alongside it.")
+	prefixIndex    = commandLine.Int("prefix_index", 0, "Set with --initialise to create a log which indexes each entry by this many of its leading bytes, for entries which start with structured identifiers, so that clients can search for them by prefix. The index is committed to by the identifier map built with --build_map.")
+	indexFormat    = commandLine.String("index_format", "", "Set with --initialise to create a log whose identifier index is written in this format, json or binary. The compact binary format suits logs with identifiers associated with very many entries, but needs clients which support it.")
+	partialTiles   = commandLine.String("partial_tiles", "", "Set with --initialise to how the log makes its partial tiles available, stored or derived. Derived partial tiles aren't stored, but are computed by readers from the tiles and entries below them, which means fewer objects are written but more are read. Defaults to stored.")
+	tsKeyFile      = commandLine.String("timestamp_key", "", "If set, location of the private key file of the log's timestamping key, distinct from --private_key, with which to sign the time at which the published checkpoint is current. It's signed again when there's nothing to integrate, so running this regularly keeps the time fresh.")
+	buildMap       = commandLine.Bool("build_map", false, "Set to build a new snapshot of the identifier map from the newly integrated tree, and commit to it in the new checkpoint. Otherwise the new checkpoint commits to the same snapshot as the previous one.")
+
+	approverKeyFiles   cli.StringList
+	memberPrivKeyFiles cli.StringList
+	approvalsRequired  = commandLine.Int("approvals_required", 0, "Number of distinct approvals of the staged checkpoint, made with keys given by --approver_public_key, required for --publish to publish it.")
+)
+
+func init() {
+	commandLine.Var(&approverKeyFiles, "approver_public_key", "Location of an approver's public key file. May be repeated.")
+	commandLine.Var(&memberPrivKeyFiles, "member_private_key", "Location of the private key file of a member of the log's threshold key, with which to sign the initial state of the log with --initialise. May be repeated, and must be given for at least the threshold number of members.")
+}
+
+// Command is the integrate command.
+var Command = &cli.Command{
+	Name:    "integrate",
+	Summary: "Integrate sequenced entries into a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	if *stage && *publish {
+		cli.Exitf("Only one of --stage and --publish may be set.")
+	}
+	if *approvalsRequired > 0 && !*publish {
+		cli.Exitf("--approvals_required may only be set with --publish, use --stage to stage checkpoints for approval.")
+	}
+
+	h := rfc6962.DefaultHasher
+	// Read log public key from file or environment variable
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	pubKey = strings.TrimSpace(pubKey)
+	// A log with a threshold key has no private key. Its checkpoints are
+	// signed by combining its members' approvals of the staged checkpoint.
+	threshold := i_note.IsThresholdKey(pubKey)
+	var s note.Signer
+	switch {
+	case threshold && *initialise:
+		if *timestamps {
+			cli.Exit("--timestamps isn't supported for logs with threshold keys.")
+		}
+		s, err = memberSigner(ctx, pubKey)
+	case threshold && (*stage || *publish):
+	case threshold:
+		cli.Exit("The log has a threshold key, so only its members can sign checkpoints: run with --stage, have the members approve the staged checkpoint, then run with --publish.")
+	case len(*kmsKey) > 0:
+		s, err = kms.NewSigner(ctx, *kmsKey, pubKey)
+	default:
+		// Read log private key from file or environment variable
+		privKey, kerr := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+		if kerr != nil {
+			cli.Exitf("Unable to get private key: %q", kerr)
+		}
+		s, err = i_note.NewSignerForKey(privKey)
+	}
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	ts, err := timestampSigner(ctx)
+	if err != nil {
+		cli.Exitf("Failed to instantiate timestamping signer: %q", err)
+	}
+
+	var cpNote note.Note
+
+	if *initialise {
+		if p := api.DuplicatePolicy(*duplicates); len(p) > 0 && !p.Valid() {
+			cli.Exitf("Please set --duplicates flag to one of %q, %q, %q, or %q.", api.DuplicatesReject, api.DuplicatesOriginal, api.DuplicatesAllow, api.DuplicatesPerNamespace)
+		}
+		if *prefixIndex < 0 || *prefixIndex > api.MaxPrefixIndexLen {
+			cli.Exitf("Please set --prefix_index flag to at most %d.", api.MaxPrefixIndexLen)
+		}
+		if f := api.IndexFormat(*indexFormat); len(f) > 0 && !f.Valid() {
+			cli.Exitf("Please set --index_format flag to %s or %s.", api.IndexFormatJSON, api.IndexFormatBinary)
+		}
+		if p := api.PartialTiles(*partialTiles); len(p) > 0 && !p.Valid() {
+			cli.Exitf("Please set --partial_tiles flag to %s or %s.", api.PartialTilesStored, api.PartialTilesDerived)
+		}
+		st, err := fs.Create(*storageDir)
+		if err != nil {
+			cli.Exitf("Failed to create log: %q", err)
+		}
+		cp := fmtlog.Checkpoint{
+			Hash: h.EmptyRoot(),
+		}
+		if err := signAndWrite(ctx, &cp, nil, cpNote, s, st, log.NoGeneration); err != nil {
+			cli.Exitf("Failed to sign: %q", err)
+		}
+		if err := writeCheckpointTime(cp, ts); err != nil {
+			cli.Exitf("Failed to write checkpoint time: %q", err)
+		}
+		if *timestamps {
+			tst, err := fs.Create(filepath.Join(*storageDir, layout.TimestampsDir))
+			if err != nil {
+				cli.Exitf("Failed to create timestamp log: %q", err)
+			}
+			if err := signAndWriteTimestamps(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, s, tst); err != nil {
+				cli.Exitf("Failed to sign timestamp log checkpoint: %q", err)
+			}
+		}
+		// Record when the log was created, so that it can later be rolled
+		// over by age.
+		m := api.Manifest{Origin: *origin, State: api.StateActive, Created: time.Now(), Immutable: *immutable, Duplicates: api.DuplicatePolicy(*duplicates), Timestamps: *timestamps, PrefixIndex: *prefixIndex, IndexFormat: api.IndexFormat(*indexFormat), PartialTiles: api.PartialTiles(*partialTiles)}
+		mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, s)
+		if err != nil {
+			cli.Exitf("Failed to sign manifest: %q", err)
+		}
+		if err := fs.WriteManifest(*storageDir, mRaw); err != nil {
+			cli.Exitf("Failed to store manifest: %q", err)
+		}
+		// Publish the key, for clients which trust it on first use.
+		if err := fs.WritePublicKey(*storageDir, []byte(strings.TrimSpace(pubKey)+"\n")); err != nil {
+			cli.Exitf("Failed to store public key: %q", err)
+		}
+		os.Exit(0)
+	}
+
+	// init storage
+	// Only one integrator may update the tree at a time, sequencing is safe
+	// to run concurrently so doesn't need to take the lock.
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to lock storage: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+
+	// Check signatures
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+	// Any extension lines, such as the identifier map root, are carried over
+	// to the new checkpoint unless they're replaced.
+	cp, ext, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to open Checkpoint: %q", err)
+	}
+	m, err := client.FetchManifest(ctx, client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.Integrates() {
+		cli.Exitf("Log is %s, refusing to integrate: %q", m.State, m.Reason)
+	}
+	if m.Final != nil {
+		cli.Exitf("Log was closed at size %d, refusing to integrate: %q", m.Final.Size, m.Reason)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetImmutable(m.Immutable)
+	st.SetPrefixIndex(m.PrefixIndex)
+	st.SetIndexFormat(m.IndexFormat)
+	st.SetPartialTiles(m.PartialTiles)
+	// The new checkpoint is only written if the one it's derived from is
+	// still current, so that an update by a writer which doesn't respect the
+	// lock isn't overwritten.
+	genRaw, gen, err := st.ReadGeneration(ctx, layout.CheckpointPath)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint generation: %q", err)
+	}
+	if !bytes.Equal(genRaw, cpRaw) {
+		cli.ExitWith(cli.ExitStorageConflict, "Log checkpoint changed while it was being read")
+	}
+
+	if *publish {
+		newCp, body, err := readStaged()
+		if err != nil {
+			cli.Exitf("Failed to read staged checkpoint: %q", err)
+		}
+		if err := verifyAppendOnly(ctx, h, v, *newCp); err != nil {
+			cli.Exitf("Refusing to publish staged checkpoint: %q", err)
+		}
+		if *approvalsRequired > 0 {
+			sigs, err := verifiedApprovals(body)
+			if err != nil {
+				cli.Exitf("Failed to check approvals: %q", err)
+			}
+			if len(sigs) < *approvalsRequired {
+				cli.Exitf("Refusing to publish staged checkpoint: it has %d valid approvals, %d are required", len(sigs), *approvalsRequired)
+			}
+			// Keep the approvals as cosignatures on the published checkpoint.
+			cpNote.Sigs = sigs
+		}
+		if threshold {
+			approvals, err := readApprovals()
+			if err != nil {
+				cli.Exitf("Refusing to publish staged checkpoint: %q", err)
+			}
+			sig, err := log.CombineApprovals(body, approvals, pubKey)
+			if err != nil {
+				cli.Exitf("Refusing to publish staged checkpoint: %q", err)
+			}
+			cpNote.Sigs = append([]note.Signature{sig}, cpNote.Sigs...)
+		}
+		if err := signAndWrite(ctx, newCp, body[len(newCp.Marshal()):], cpNote, s, st, gen); err != nil {
+			cli.Exitf("Failed to sign: %q", err)
+		}
+		if err := st.RemoveStagedCheckpoint(ctx); err != nil {
+			glog.Warningf("Failed to remove staged checkpoint: %q", err)
+		}
+		glog.Infof("Published checkpoint for tree size %d", newCp.Size)
+		updateCheckpointTime(*newCp, ts)
+		updateTimestamps(ctx, h, m, *newCp, st, s, v)
+		precomputeProofs(ctx, h, *newCp, st)
+		return
+	}
+
+	// Integrate new entries
+	newCp, err := log.IntegrateBatch(ctx, *cp, st, h, log.ReleasePolicy{BatchSize: *releaseBatch, Pad: *releasePadding, MemoryBudget: *memoryBudget})
+	if err != nil {
+		cli.Exitf("Failed to integrate: %q", err)
+	}
+	if newCp == nil {
+		// The published checkpoint is still current.
+		updateCheckpointTime(*cp, ts)
+		if !*buildMap {
+			cli.ExitWith(cli.ExitNothingToDo, "Nothing to integrate")
+		}
+		if r, err := api.ParseMapRoot(ext); err == nil && r.Size == cp.Size {
+			cli.ExitWith(cli.ExitNothingToDo, "Nothing to integrate, and the identifier map is up to date")
+		}
+		// Commit to a new map snapshot for the existing tree.
+		newCp = cp
+	}
+	if *buildMap {
+		r, err := log.BuildMap(ctx, st, newCp.Size)
+		if err != nil {
+			cli.Exitf("Failed to build identifier map: %q", err)
+		}
+		glog.Infof("Built identifier map for tree size %d with root %x", r.Size, r.Root)
+		ext = r.Extension()
+	}
+
+	if *stage {
+		newCp.Origin = *origin
+		if err := st.WriteStagedCheckpoint(ctx, append(newCp.Marshal(), ext...)); err != nil {
+			cli.Exitf("Failed to stage checkpoint: %q", err)
+		}
+		glog.Infof("Staged checkpoint for tree size %d, run with --publish to publish it", newCp.Size)
+		return
+	}
+
+	// Don't trust the in-memory state; re-read the published checkpoint and
+	// check the stored tree against it before publishing a new checkpoint.
+	if err := verifyAppendOnly(ctx, h, v, *newCp); err != nil {
+		cli.Exitf("Refusing to publish new checkpoint: %q", err)
+	}
+
+	err = signAndWrite(ctx, newCp, ext, cpNote, s, st, gen)
+	if err != nil {
+		cli.Exitf("Failed to sign: %q", err)
+	}
+	// Any previously staged checkpoint has now been superseded.
+	if err := st.RemoveStagedCheckpoint(ctx); err != nil {
+		glog.Warningf("Failed to remove staged checkpoint: %q", err)
+	}
+	updateCheckpointTime(*newCp, ts)
+	updateTimestamps(ctx, h, m, *newCp, st, s, v)
+	precomputeProofs(ctx, h, *newCp, st)
+}
+
+// updateTimestamps extends the timestamp log to cover the entries committed to
+// by the published checkpoint cp, if the log publishes timestamps.
+func updateTimestamps(ctx context.Context, h merkle.LogHasher, m *api.Manifest, cp fmtlog.Checkpoint, st *fs.Storage, s note.Signer, v note.Verifier) {
+	if !m.Timestamps {
+		return
+	}
+	tst, err := fs.Load(filepath.Join(*storageDir, layout.TimestampsDir), 0)
+	if err != nil {
+		cli.Exitf("Published checkpoint for tree size %d, but failed to load timestamp log: %q", cp.Size, err)
+	}
+	tst.SetImmutable(m.Immutable)
+	tf := client.ShardFetcher(client.NewFSFetcher(os.DirFS(*storageDir)), layout.TimestampsDir)
+	if err := log.PublishTimestamps(ctx, h, st, tst, tf, s, v, *origin, cp.Size); err != nil {
+		cli.Exitf("Published checkpoint for tree size %d, but failed to update timestamp log: %q", cp.Size, err)
+	}
+	glog.Infof("Updated timestamp log to tree size %d", cp.Size)
+}
+
+// timestampSigner returns the signer of the log's timestamping key given by
+// --timestamp_key, or nil if it isn't set.
+func timestampSigner(ctx context.Context) (note.Signer, error) {
+	if len(*tsKeyFile) == 0 {
+		return nil, nil
+	}
+	k, err := keys.Read(ctx, *tsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return i_note.NewSignerForKey(strings.TrimSpace(k))
+}
+
+// updateCheckpointTime signs the time at which the published checkpoint cp is
+// current with the timestamping key ts, if there is one.
+func updateCheckpointTime(cp fmtlog.Checkpoint, ts note.Signer) {
+	if err := writeCheckpointTime(cp, ts); err != nil {
+		cli.Exitf("Published checkpoint for tree size %d, but failed to write checkpoint time: %q", cp.Size, err)
+	}
+}
+
+// writeCheckpointTime signs the time at which cp is current with ts, if it's
+// not nil, and stores it.
+func writeCheckpointTime(cp fmtlog.Checkpoint, ts note.Signer) error {
+	if ts == nil {
+		return nil
+	}
+	cp.Origin = *origin
+	raw, err := log.SignCheckpointTime(cp, ts, time.Now())
+	if err != nil {
+		return err
+	}
+	return fs.WriteCheckpointTime(*storageDir, raw)
+}
+
+// signAndWriteTimestamps signs cp and stores it as the timestamp log
+// checkpoint.
+func signAndWriteTimestamps(ctx context.Context, cp fmtlog.Checkpoint, s note.Signer, tst *fs.Storage) error {
+	cp.Origin = api.TimestampsOrigin(*origin)
+	raw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		return err
+	}
+	return tst.WriteCheckpoint(ctx, raw)
+}
+
+// precomputeProofs stores the inclusion proofs for the published checkpoint
+// cp, if --precompute_proofs is set.
+func precomputeProofs(ctx context.Context, h merkle.LogHasher, cp fmtlog.Checkpoint, st *fs.Storage) {
+	if !*precompute {
+		return
+	}
+	if err := log.PrecomputeInclusionProofs(ctx, h, client.NewFSFetcher(os.DirFS(*storageDir)), cp, st); err != nil {
+		cli.Exitf("Published checkpoint for tree size %d, but failed to precompute proofs: %q", cp.Size, err)
+	}
+	glog.Infof("Precomputed %d inclusion proofs for tree size %d", cp.Size, cp.Size)
+}
+
+// verifyAppendOnly checks that the tree committed to by newCp, as read back
+// from storage, is consistent with the currently published checkpoint.
+func verifyAppendOnly(ctx context.Context, h merkle.LogHasher, v note.Verifier, newCp fmtlog.Checkpoint) error {
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		return fmt.Errorf("failed to re-read log checkpoint: %w", err)
+	}
+	prev, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		return fmt.Errorf("failed to open published checkpoint: %w", err)
+	}
+	return log.VerifyAppendOnly(ctx, h, client.NewFSFetcher(os.DirFS(*storageDir)), *prev, newCp)
+}
+
+// readStaged reads and parses the staged checkpoint body, returning it along
+// with the raw body, which includes any extension lines.
+func readStaged() (*fmtlog.Checkpoint, []byte, error) {
+	raw, err := fs.ReadStagedCheckpoint(*storageDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	cp := &fmtlog.Checkpoint{}
+	if _, err := cp.Unmarshal(raw); err != nil {
+		return nil, nil, err
+	}
+	if cp.Origin != *origin {
+		return nil, nil, fmt.Errorf("staged checkpoint has origin %q, want %q", cp.Origin, *origin)
+	}
+	if !bytes.HasPrefix(raw, cp.Marshal()) {
+		return nil, nil, errors.New("staged checkpoint isn't in canonical form")
+	}
+	return cp, raw, nil
+}
+
+// verifiedApprovals returns the valid approvals of the staged checkpoint body
+// by the approvers given by --approver_public_key.
+func verifiedApprovals(cpBody []byte) ([]note.Signature, error) {
+	if len(approverKeyFiles) == 0 {
+		return nil, errors.New("no approver keys given, set --approver_public_key")
+	}
+	var vs []note.Verifier
+	for _, f := range approverKeyFiles {
+		k, err := keys.Read(context.Background(), f)
+		if err != nil {
+			return nil, err
+		}
+		v, err := i_note.NewVerifierForKey(strings.TrimSpace(k))
+		if err != nil {
+			return nil, fmt.Errorf("failed to instantiate approver verifier from %q: %w", f, err)
+		}
+		vs = append(vs, v)
+	}
+	as, err := readApprovals()
+	if err != nil {
+		return nil, err
+	}
+	return log.VerifyApprovals(cpBody, as, note.VerifierList(vs...)), nil
+}
+
+// readApprovals returns the approvals of the staged checkpoint, in order of
+// approver ID.
+func readApprovals() ([][]byte, error) {
+	approvals, err := fs.ReadApprovals(*storageDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approvals: %w", err)
+	}
+	names := make([]string, 0, len(approvals))
+	for n := range approvals {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	as := make([][]byte, 0, len(names))
+	for _, n := range names {
+		as = append(as, approvals[n])
+	}
+	return as, nil
+}
+
+// memberSigner returns a signer for the threshold key vkey made from the
+// member keys given by --member_private_key.
+func memberSigner(ctx context.Context, vkey string) (note.Signer, error) {
+	if len(memberPrivKeyFiles) == 0 {
+		return nil, errors.New("the log has a threshold key, set --member_private_key to sign its initial state")
+	}
+	var members []note.Signer
+	for _, f := range memberPrivKeyFiles {
+		k, err := keys.Read(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		m, err := i_note.NewSignerForKey(strings.TrimSpace(k))
+		if err != nil {
+			return nil, fmt.Errorf("failed to instantiate member signer from %q: %w", f, err)
+		}
+		members = append(members, m)
+	}
+	return i_note.NewThresholdSigner(vkey, members)
+}
+
+// signAndWrite signs cp and stores it as the log checkpoint, provided that the
+// current checkpoint has the generation gen.
+func signAndWrite(ctx context.Context, cp *fmtlog.Checkpoint, ext []byte, cpNote note.Note, s note.Signer, st *fs.Storage, gen log.Generation) error {
+	cp.Origin = *origin
+	cpNote.Text = string(cp.Marshal()) + string(ext)
+	signers := []note.Signer{s}
+	if s == nil {
+		// The checkpoint is already signed by the members of the log's
+		// threshold key.
+		signers = nil
+	}
+	cpNoteSigned, err := note.Sign(&cpNote, signers...)
+	if err != nil {
+		return fmt.Errorf("failed to sign Checkpoint: %w", err)
+	}
+	if err := st.WriteIfGeneration(ctx, layout.CheckpointPath, cpNoteSigned, gen); err != nil {
+		return fmt.Errorf("failed to store new log checkpoint: %w", err)
+	}
+	return nil
+}
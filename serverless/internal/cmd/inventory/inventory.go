@@ -0,0 +1,107 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventory provides a command line tool for publishing a signed inventory
+// of the files committed to by a serverless log's checkpoint, so that mirrors
+// can check that they've copied every file intact.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("inventory", flag.ExitOnError)
+
+var (
+	storageDir  = commandLine.String("storage_dir", "", "Root directory of the log.")
+	pubKeyFile  = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin      = commandLine.String("origin", "", "Log origin string.")
+)
+
+// Command is the inventory command.
+var Command = &cli.Command{
+	Name:    "inventory",
+	Summary: "Publish a signed inventory of a log's files",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := i_note.NewSignerForKey(strings.TrimSpace(privKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	// The inventory is built from the published checkpoint, so no lock is
+	// needed: integration only adds files, and never changes those the
+	// checkpoint already commits to.
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	cp, _, _, err := client.FetchCheckpoint(ctx, f, v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	inv, err := log.BuildInventory(ctx, rfc6962.DefaultHasher, f, *cp)
+	if err != nil {
+		cli.Exitf("Failed to build inventory: %q", err)
+	}
+	raw, err := note.Sign(&note.Note{Text: string(inv.Marshal())}, s)
+	if err != nil {
+		cli.Exitf("Failed to sign inventory: %q", err)
+	}
+	if err := st.WriteInventory(ctx, cp.Size, raw); errors.Is(err, os.ErrExist) {
+		glog.Infof("Inventory for tree size %d has already been published", cp.Size)
+		return
+	} else if err != nil {
+		cli.Exitf("Failed to store inventory: %q", err)
+	}
+	glog.Infof("Published inventory of %d files for tree size %d", len(inv.Objects), cp.Size)
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loglist provides a command line tool for signing and checking log
+// lists, which describe many logs and how to verify them.
+package loglist
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("loglist", flag.ExitOnError)
+
+var (
+	pubKeyFile  = commandLine.String("public_key", "", "Location of the list maintainer's public key file, needed to check a list.")
+	privKeyFile = commandLine.String("private_key", "", "Location of the list maintainer's private key file, needed to sign a list. If unset, uses the contents of the SERVERLESS_LOG_LIST_PRIVATE_KEY environment variable.")
+	name        = commandLine.String("name", "", "Expected name of the list being checked.")
+)
+
+const usage = `Usage:
+ loglist <cmd>
+
+Where <cmd> is one of:
+ sign <list file> <output file>
+	Check that a log list is well formed, and write it signed by the
+	maintainer's key.
+ show <signed list file>
+	Verify a signed log list, and describe the logs in it.
+`
+
+// Command is the loglist command.
+var Command = &cli.Command{
+	Name:    "loglist",
+	Summary: "Sign and check log lists",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	args := commandLine.Args()
+	if len(args) == 0 {
+		cli.Exit(usage)
+	}
+	var err error
+	switch args[0] {
+	case "sign":
+		err = sign(args[1:])
+	case "show":
+		err = show(args[1:])
+	default:
+		cli.Exit(usage)
+	}
+	if err != nil {
+		cli.Exitf("Command %q failed: %v", args[0], err)
+	}
+}
+
+func sign(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: sign <list file> <output file>")
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read log list: %v", err)
+	}
+	if _, err := api.ParseLogList(raw); err != nil {
+		return err
+	}
+	privKey, err := keys.Get(context.Background(), *privKeyFile, "SERVERLESS_LOG_LIST_PRIVATE_KEY")
+	if err != nil {
+		return err
+	}
+	s, err := note.NewSigner(strings.TrimSpace(privKey))
+	if err != nil {
+		return fmt.Errorf("failed to instantiate signer: %v", err)
+	}
+	signed, err := note.Sign(&note.Note{Text: string(raw)}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign log list: %v", err)
+	}
+	return os.WriteFile(args[1], signed, 0644)
+}
+
+func show(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: show <signed list file>")
+	}
+	if len(*pubKeyFile) == 0 || len(*name) == 0 {
+		return fmt.Errorf("--public_key and --name must be set")
+	}
+	pubKey, err := os.ReadFile(*pubKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %v", err)
+	}
+	v, err := note.NewVerifier(strings.TrimSpace(string(pubKey)))
+	if err != nil {
+		return fmt.Errorf("failed to instantiate verifier: %v", err)
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read log list: %v", err)
+	}
+	l, err := client.OpenLogList(raw, v, *name)
+	if err != nil {
+		return err
+	}
+	for _, e := range l.Logs {
+		if _, _, err := client.LogVerifiers(e); err != nil {
+			return err
+		}
+		fmt.Printf("%s\n  url: %s\n  key: %s\n", e.Origin, e.URL, e.PublicKey)
+		if e.WitnessQuorum > 0 {
+			fmt.Printf("  witnesses: %d of %d, from %s\n", e.WitnessQuorum, len(e.Witnesses), strings.Join(e.Distributors, ", "))
+		}
+	}
+	return nil
+}
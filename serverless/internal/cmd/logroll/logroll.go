@@ -0,0 +1,133 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logroll provides a daemon which periodically rolls up the lines
+// appended to a host's log file, e.g. by syslog, into segments, and sequences
+// the hash of each segment into a serverless log under the host's name.
+package logroll
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/ingest"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("logroll", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory to store log data.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = commandLine.String("origin", "", "Log origin string to check for in checkpoint.")
+	file       = commandLine.String("file", "", "Log file to roll up, e.g. /var/log/syslog.")
+	name       = commandLine.String("name", "", "Name to record the file under, defaults to --file.")
+	hostname   = commandLine.String("hostname", "", "Name of the host, with which the segments are associated. Defaults to the name reported by the kernel.")
+	stateFile  = commandLine.String("state_file", "", "File to record progress through the log file in, defaults to --file with a .logroll suffix.")
+	interval   = commandLine.Duration("interval", time.Minute, "How often to roll up a new segment.")
+	once       = commandLine.Bool("once", false, "If set, roll up a single segment and exit, e.g. when run from cron.")
+)
+
+// Command is the logroll command.
+var Command = &cli.Command{
+	Name:    "logroll",
+	Summary: "Roll up a host's log file into a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*file) == 0 {
+		cli.Exit("--file must be set")
+	}
+	host := *hostname
+	if len(host) == 0 {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			cli.Exitf("Failed to get hostname, set --hostname: %q", err)
+		}
+	}
+	state := *stateFile
+	if len(state) == 0 {
+		state = *file + ".logroll"
+	}
+
+	// Read log public key from file or environment variable
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	m, err := client.FetchManifest(ctx, f, v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.AcceptsEntries() {
+		cli.Exitf("Log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	opts := ingest.Opts{BatchTimeout: *interval}
+	if opts.Namespaces, err = client.FetchNamespaces(ctx, f, v, *origin); err != nil {
+		cli.Exitf("Failed to read namespace registry: %q", err)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+
+	s, err := ingest.NewFileSource(host, *name, *file, state, st, rfc6962.DefaultHasher, opts)
+	if err != nil {
+		cli.Exitf("Failed to create log file source: %q", err)
+	}
+	if *once {
+		if _, err := s.Roll(ctx); err != nil {
+			cli.Exitf("Failed to roll up segment: %q", err)
+		}
+		return
+	}
+	glog.Infof("Rolling up %q from %q every %v", *file, host, *interval)
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		cli.Exitf("Failed to roll up segments: %q", err)
+	}
+}
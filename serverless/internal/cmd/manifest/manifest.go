@@ -0,0 +1,144 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest provides a command line tool for publishing a signed manifest
+// describing the lifecycle state of a serverless log.
+package manifest
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("manifest", flag.ExitOnError)
+
+var (
+	storageDir   = commandLine.String("storage_dir", "", "Root directory of the log.")
+	pubKeyFile   = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile  = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin       = commandLine.String("origin", "", "Log origin string.")
+	state        = commandLine.String("state", "", "State to put the log in, one of active, frozen, or read-only. Read-only logs can't be made active or frozen again.")
+	reason       = commandLine.String("reason", "", "Optional human readable explanation of the state, shown to clients.")
+	duplicates   = commandLine.String("duplicates", "", "If set, changes the log's duplicate policy to one of reject, original, allow, or namespace.")
+	contentTypes = commandLine.String("content_types", "", "If set, changes the content types of the entries the log accepts to this comma separated list, or to entries of any type if it's \"any\".")
+)
+
+// Command is the manifest command.
+var Command = &cli.Command{
+	Name:    "manifest",
+	Summary: "Publish a signed manifest of a log's lifecycle state",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	newState := api.LogState(*state)
+	if !newState.Valid() {
+		cli.Exitf("Please set --state flag to one of %q, %q, or %q.", api.StateActive, api.StateFrozen, api.StateReadOnly)
+	}
+	if strings.Contains(*reason, "\n") {
+		cli.Exitf("--reason must be a single line.")
+	}
+	if p := api.DuplicatePolicy(*duplicates); len(p) > 0 && !p.Valid() {
+		cli.Exitf("Please set --duplicates flag to one of %q, %q, %q, or %q.", api.DuplicatesReject, api.DuplicatesOriginal, api.DuplicatesAllow, api.DuplicatesPerNamespace)
+	}
+
+	var types []string
+	if len(*contentTypes) > 0 && *contentTypes != "any" {
+		types = strings.Split(*contentTypes, ",")
+		seen := make(map[string]bool)
+		for _, t := range types {
+			if err := api.ValidateContentType(t); err != nil {
+				cli.Exitf("Invalid --content_types: %v", err)
+			}
+			if seen[t] {
+				cli.Exitf("--content_types lists %q more than once", t)
+			}
+			seen[t] = true
+		}
+	}
+
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := i_note.NewSignerForKey(privKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	// Hold the integration lock so that no integrate run straddles the
+	// state change.
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to lock storage: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+
+	old, err := client.FetchManifest(ctx, client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read current manifest: %q", err)
+	}
+	if !old.State.CanBecome(newState) {
+		cli.Exitf("Log is %s, and can't be made %s.", old.State, newState)
+	}
+
+	m := *old
+	m.State = newState
+	m.Reason = *reason
+	if len(*duplicates) > 0 {
+		m.Duplicates = api.DuplicatePolicy(*duplicates)
+	}
+	if len(*contentTypes) > 0 {
+		m.ContentTypes = types
+	}
+	mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, s)
+	if err != nil {
+		cli.Exitf("Failed to sign manifest: %q", err)
+	}
+	if err := fs.WriteManifest(*storageDir, mRaw); err != nil {
+		cli.Exitf("Failed to store manifest: %q", err)
+	}
+	glog.Infof("Log is now %s", newState)
+}
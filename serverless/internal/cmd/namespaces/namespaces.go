@@ -0,0 +1,203 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package namespaces provides a command line tool for registering the owners of
+// identifier namespaces in a log.
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("namespaces", flag.ExitOnError)
+
+var (
+	storageDir  = commandLine.String("storage_dir", "", "Root directory of the log.")
+	origin      = commandLine.String("origin", "", "Expected log origin string.")
+	pubKeyFile  = commandLine.String("public_key", "", "Location of the log's public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile = commandLine.String("private_key", "", "Location of the log's private key file, needed to change the registry. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+)
+
+const usage = `Usage:
+ namespaces --storage_dir=<dir> --origin=<origin> <cmd>
+
+Where <cmd> is one of:
+ list
+	List the registered namespaces and their owners' keys.
+ register <namespace> <owner public key file>
+	Register the owner of a namespace. New entries may then only use
+	identifiers in the namespace with a claim signed by the owner's key.
+ unregister <namespace>
+	Remove a namespace from the registry, so that anyone may use it again.
+`
+
+// Command is the namespaces command.
+var Command = &cli.Command{
+	Name:    "namespaces",
+	Summary: "Register the owners of identifier namespaces",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	args := commandLine.Args()
+	if len(args) == 0 {
+		cli.Exit(usage)
+	}
+
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	v, err := note.NewVerifier(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	switch args[0] {
+	case "list":
+		err = list(ctx, v, args[1:])
+	case "register":
+		err = update(ctx, v, args[1:], 2, register)
+	case "unregister":
+		err = update(ctx, v, args[1:], 1, unregister)
+	default:
+		err = errors.New(usage)
+	}
+	if err != nil {
+		cli.Exitf("%s: %v", args[0], err)
+	}
+}
+
+func list(ctx context.Context, v note.Verifier, args []string) error {
+	if len(args) != 0 {
+		return errors.New(usage)
+	}
+	ns, err := client.FetchNamespaces(ctx, client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(ns.Owners))
+	for n := range ns.Owners {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Printf("%s\tsince %d\t%s\n", n, ns.Owners[n].Since, ns.Owners[n].Key)
+	}
+	return nil
+}
+
+// update applies the change made by f, with the given number of arguments, to
+// the namespace registry, and publishes the new registry. f is also passed the
+// number of entries sequenced so far.
+func update(ctx context.Context, v note.Verifier, args []string, nArgs int, f func(ns *api.Namespaces, size uint64, args []string) error) error {
+	if len(args) != nArgs {
+		return errors.New(usage)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		return fmt.Errorf("unable to get private key: %w", err)
+	}
+	s, err := note.NewSigner(strings.TrimSpace(privKey))
+	if err != nil {
+		return fmt.Errorf("failed to instantiate signer: %w", err)
+	}
+
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		return fmt.Errorf("failed to lock storage: %w", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+	fetcher := client.NewFSFetcher(os.DirFS(*storageDir))
+	cp, _, _, err := client.FetchCheckpoint(ctx, fetcher, v, *origin)
+	if err != nil {
+		return fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		return fmt.Errorf("failed to load storage: %w", err)
+	}
+	pending, err := st.ScanSequenced(ctx, cp.Size, func(uint64, []byte) error { return nil })
+	if err != nil {
+		return fmt.Errorf("failed to count sequenced entries: %w", err)
+	}
+	ns, err := client.FetchNamespaces(ctx, fetcher, v, *origin)
+	if err != nil {
+		return err
+	}
+	if err := f(ns, cp.Size+pending, args); err != nil {
+		return err
+	}
+	raw, err := note.Sign(&note.Note{Text: string(ns.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign namespace registry: %w", err)
+	}
+	return fs.WriteNamespaces(*storageDir, raw)
+}
+
+func register(ns *api.Namespaces, size uint64, args []string) error {
+	if err := api.ValidateNamespace(args[0]); err != nil {
+		return err
+	}
+	k, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read owner's key: %w", err)
+	}
+	key := strings.TrimSpace(string(k))
+	if _, err := note.NewVerifier(key); err != nil {
+		return fmt.Errorf("invalid owner's key: %w", err)
+	}
+	// Replacing the key would invalidate the claims made with the old one,
+	// so the namespace must be unregistered first.
+	if _, ok := ns.Owners[args[0]]; ok {
+		return fmt.Errorf("namespace %q is already registered", args[0])
+	}
+	// Entries already sequenced didn't need a claim.
+	ns.Owners[args[0]] = api.NamespaceOwner{Key: key, Since: size}
+	glog.Infof("Registered namespace %q for entries from %d", args[0], size)
+	return nil
+}
+
+func unregister(ns *api.Namespaces, _ uint64, args []string) error {
+	if _, ok := ns.Owners[args[0]]; !ok {
+		return fmt.Errorf("namespace %q isn't registered", args[0])
+	}
+	delete(ns.Owners, args[0])
+	glog.Infof("Unregistered namespace %q", args[0])
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proof provides a command line tool for working with Merkle proofs
+// written by the client, such as converting them between encodings for
+// external verifiers.
+package proof
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("proof", flag.ExitOnError)
+
+var (
+	from      = commandLine.String("from", string(api.ProofEncodingText), "Encoding of the input proof: text, json, binary, or pem.")
+	to        = commandLine.String("to", string(api.ProofEncodingJSON), "Encoding of the output proof: text, json, binary, or pem.")
+	proofType = commandLine.String("type", string(api.InclusionProofType), "Type of the proof: inclusion or consistency.")
+	leafIndex = commandLine.Int64("leaf_index", -1, "Index of the leaf an inclusion proof is for. Needed to convert inclusion proofs from the text and binary encodings, which don't carry it, to json or pem.")
+)
+
+const usage = `Usage:
+ proof <cmd>
+
+Where <cmd> is one of:
+ convert <input file> <output file>
+	Convert a proof from the --from encoding to the --to encoding.
+`
+
+// Command is the proof command.
+var Command = &cli.Command{
+	Name:    "proof",
+	Summary: "Convert Merkle proofs between encodings",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	args := commandLine.Args()
+	if len(args) == 0 {
+		cli.Exit(usage)
+	}
+	var err error
+	switch args[0] {
+	case "convert":
+		err = convert(args[1:])
+	default:
+		cli.Exit(usage)
+	}
+	if err != nil {
+		cli.Exitf("Command %q failed: %v", args[0], err)
+	}
+}
+
+func convert(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: convert <input file> <output file>")
+	}
+	in, out := api.ProofEncoding(*from), api.ProofEncoding(*to)
+	if !in.Valid() || !out.Valid() {
+		return fmt.Errorf("unknown encoding, want text, json, binary, or pem")
+	}
+	t := api.ProofType(*proofType)
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read proof: %w", err)
+	}
+	p, err := api.DecodeProof(raw, in, t)
+	if err != nil {
+		return fmt.Errorf("failed to decode proof: %w", err)
+	}
+	if t == api.InclusionProofType {
+		switch {
+		case *leafIndex >= 0 && in.SelfDescribing() && uint64(*leafIndex) != p.LeafIndex:
+			return fmt.Errorf("proof is for leaf index %d, not --leaf_index %d", p.LeafIndex, *leafIndex)
+		case *leafIndex >= 0:
+			p.LeafIndex = uint64(*leafIndex)
+		case !in.SelfDescribing() && out.SelfDescribing():
+			return fmt.Errorf("%s encoding of inclusion proofs doesn't carry the leaf index, so --leaf_index must be set", in)
+		}
+	}
+	enc, err := p.Encode(out)
+	if err != nil {
+		return fmt.Errorf("failed to encode proof: %w", err)
+	}
+	if err := os.WriteFile(args[1], enc, 0644); err != nil {
+		return fmt.Errorf("failed to write proof: %w", err)
+	}
+	glog.Infof("Converted %s proof with %d hashes from %s to %s", t, len(p.Hashes), in, out)
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package publish provides a daemon which periodically publishes the latest
+// checkpoint of a serverless log to channels other than the log itself: a
+// file served at a .well-known URL, a DNS TXT record, and a webhook. Clients
+// comparing the channels with the log make it harder for the log to present
+// a split view.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/publish"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("publish", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory of the log whose checkpoint is published.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of the public key file of the log. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = commandLine.String("origin", "", "Origin of the log.")
+
+	wellKnownFile = commandLine.String("well_known_file", "", "If set, file the signed checkpoint is written to, which should be served at /.well-known/serverless-checkpoint of a domain other than the log's.")
+	dnsName       = commandLine.String("dns_name", "", "If set, name of an existing TXT record the checkpoint's digest is written to, in a zone hosted by Cloudflare.")
+	dnsZoneID     = commandLine.String("dns_zone_id", "", "Cloudflare ID of the zone holding --dns_name.")
+	dnsRecordID   = commandLine.String("dns_record_id", "", "Cloudflare ID of the TXT record --dns_name.")
+	dnsTTL        = commandLine.Int("dns_ttl", 60, "Time to live of the TXT record, in seconds.")
+	dnsTokenFile  = commandLine.String("dns_api_token", "", "Location of the Cloudflare API token file. If unset, uses the contents of the CLOUDFLARE_API_TOKEN environment variable.")
+	webhookURL    = commandLine.String("webhook_url", "", "If set, URL the checkpoint's digest is posted to as a status update.")
+	webhookToken  = commandLine.String("webhook_token", "", "Location of a file containing a bearer token sent to --webhook_url, if it needs one.")
+
+	interval = commandLine.Duration("interval", time.Minute, "How often to publish the latest checkpoint.")
+	once     = commandLine.Bool("once", false, "If set, publish the checkpoint once and exit, e.g. when run from cron.")
+)
+
+// Command is the publish command.
+var Command = &cli.Command{
+	Name:    "publish",
+	Summary: "Publish a log's checkpoint to other channels",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(pubKey)
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	p := &publisher{v: v}
+	if len(*wellKnownFile) > 0 {
+		p.add("well-known", publish.WellKnownFile{Path: *wellKnownFile})
+	}
+	if len(*dnsName) > 0 {
+		if len(*dnsZoneID) == 0 || len(*dnsRecordID) == 0 {
+			cli.Exit("--dns_zone_id and --dns_record_id must be set with --dns_name")
+		}
+		token, err := keys.Get(context.Background(), *dnsTokenFile, "CLOUDFLARE_API_TOKEN")
+		if err != nil {
+			cli.Exitf("Unable to get Cloudflare API token: %q", err)
+		}
+		p.add("dns", publish.CloudflareTXT{
+			Token:    strings.TrimSpace(token),
+			ZoneID:   *dnsZoneID,
+			RecordID: *dnsRecordID,
+			Name:     *dnsName,
+			TTL:      *dnsTTL,
+		})
+	}
+	if len(*webhookURL) > 0 {
+		w := publish.Webhook{URL: *webhookURL}
+		if len(*webhookToken) > 0 {
+			t, err := os.ReadFile(*webhookToken)
+			if err != nil {
+				cli.Exitf("Unable to read webhook token: %q", err)
+			}
+			w.Token = strings.TrimSpace(string(t))
+		}
+		p.add("webhook", w)
+	}
+	if len(p.channels) == 0 {
+		cli.Exit("At least one of --well_known_file, --dns_name and --webhook_url must be set")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	for {
+		if err := p.publish(ctx); err != nil {
+			if *once {
+				cli.Exitf("Failed to publish checkpoint: %q", err)
+			}
+			glog.Warningf("Failed to publish checkpoint: %q", err)
+		}
+		if *once {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// publisher publishes the log's checkpoint to each of its channels.
+type publisher struct {
+	v        note.Verifier
+	channels []channel
+}
+
+// channel is a Publisher along with the checkpoint last published with it.
+type channel struct {
+	name string
+	pub  publish.Publisher
+	last []byte
+}
+
+func (p *publisher) add(name string, pub publish.Publisher) {
+	p.channels = append(p.channels, channel{name: name, pub: pub})
+}
+
+// publish publishes the log's latest checkpoint to each channel which doesn't
+// already have it. A channel which fails is retried next time, and doesn't
+// stop the checkpoint being published to the others.
+func (p *publisher) publish(ctx context.Context) error {
+	raw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		return fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(raw, *origin, p.v)
+	if err != nil {
+		return fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	var failed []string
+	for i := range p.channels {
+		c := &p.channels[i]
+		if bytes.Equal(c.last, raw) {
+			continue
+		}
+		if err := c.pub.Publish(ctx, *cp, raw); err != nil {
+			glog.Warningf("Failed to publish checkpoint of size %d to %s: %v", cp.Size, c.name, err)
+			failed = append(failed, c.name)
+			continue
+		}
+		glog.Infof("Published checkpoint of size %d to %s", cp.Size, c.name)
+		c.last = raw
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to publish to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
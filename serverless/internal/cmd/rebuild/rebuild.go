@@ -0,0 +1,123 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rebuild provides a command line tool for recovering a serverless log
+// from nothing but its entries, to be used when its other files have been
+// lost or damaged.
+package rebuild
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("rebuild", flag.ExitOnError)
+
+var (
+	sourceDir      = commandLine.String("source_dir", "", "Root directory of the damaged log, or of a copy of its seq/ directory. Identifiers files in its leaves/ directory are used to rebuild the identifier index, if present.")
+	storageDir     = commandLine.String("storage_dir", "", "Directory to rebuild the log in, which must not already exist.")
+	checkpointFile = commandLine.String("checkpoint", "", "Location of the last checkpoint of the log known to be good.")
+	pubKeyFile     = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile    = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin         = commandLine.String("origin", "", "Log origin string.")
+)
+
+// Command is the rebuild command.
+var Command = &cli.Command{
+	Name:    "rebuild",
+	Summary: "Recover a log from its entries",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	if len(*sourceDir) == 0 || len(*storageDir) == 0 || len(*checkpointFile) == 0 {
+		cli.Exitf("--source_dir, --storage_dir, and --checkpoint must all be provided")
+	}
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := i_note.NewSignerForKey(strings.TrimSpace(privKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	cpRaw, err := os.ReadFile(*checkpointFile)
+	if err != nil {
+		cli.Exitf("Failed to read known good checkpoint: %q", err)
+	}
+	good, ext, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to open known good checkpoint: %q", err)
+	}
+
+	st, err := fs.Create(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to create storage: %q", err)
+	}
+	src := client.NewFSFetcher(os.DirFS(*sourceDir))
+	// Entries must be indexed by prefix, and in the format, as they were
+	// originally for the rebuilt identifier map to match, but the manifest
+	// may be lost too.
+	if m, err := client.FetchManifest(ctx, src, v, *origin); err != nil {
+		glog.Warningf("Failed to read manifest, not indexing entries by prefix: %q", err)
+	} else {
+		st.SetPrefixIndex(m.PrefixIndex)
+		st.SetIndexFormat(m.IndexFormat)
+		st.SetPartialTiles(m.PartialTiles)
+	}
+	cp, ext, err := log.Rebuild(ctx, rfc6962.DefaultHasher, src, st, *good, ext)
+	if err != nil {
+		cli.Exitf("Failed to rebuild log: %q", err)
+	}
+
+	signed, err := note.Sign(&note.Note{Text: string(cp.Marshal()) + string(ext)}, s)
+	if err != nil {
+		cli.Exitf("Failed to sign checkpoint: %q", err)
+	}
+	if err := st.WriteCheckpoint(ctx, signed); err != nil {
+		cli.Exitf("Failed to store checkpoint: %q", err)
+	}
+	glog.Infof("Rebuilt log of tree size %d with root hash %x", cp.Size, cp.Hash)
+}
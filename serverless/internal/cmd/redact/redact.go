@@ -0,0 +1,156 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redact provides a command line tool for withholding the data of
+// entries in a serverless log, e.g. because it's illegal to distribute, while
+// keeping their leaf hashes in the tree.
+package redact
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("redact", flag.ExitOnError)
+
+var (
+	storageDir    = commandLine.String("storage_dir", "", "Root directory of the log.")
+	pubKeyFile    = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile   = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin        = commandLine.String("origin", "", "Log origin string.")
+	reason        = commandLine.String("reason", "", "Why the entries are redacted, e.g. a reference to the takedown request, which is published in their tombstones.")
+	retentionDays = commandLine.Int("retention_days", 0, "If set, instead of redacting the given entries, withholds the data of all entries sequenced more than this many days ago, e.g. because they contain personal data.")
+)
+
+const usage = `Usage:
+ redact --storage_dir=<dir> --origin=<origin> --reason=<reason> <index> [<index> ...]
+ redact --storage_dir=<dir> --origin=<origin> --retention_days=<days>
+
+Withholds the data of the entries at the given decimal indices, serving a
+signed tombstone listed in the log's redaction log in its place. With
+--retention_days, does so for all entries older than the retention period,
+so the redaction log is a journal of the deletions.
+`
+
+// Command is the redact command.
+var Command = &cli.Command{
+	Name:    "redact",
+	Summary: "Withhold the data of a log's entries under a public redaction record",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	args := commandLine.Args()
+	switch {
+	case *retentionDays < 0:
+		cli.Exitf("Invalid --retention_days %d.", *retentionDays)
+	case *retentionDays > 0:
+		if len(args) > 0 || len(*reason) > 0 {
+			cli.Exit(usage)
+		}
+	case len(args) == 0:
+		cli.Exit(usage)
+	case len(*reason) == 0:
+		cli.Exitf("Please set --reason flag to why the entries are redacted.")
+	}
+	indices := make([]uint64, 0, len(args))
+	for _, a := range args {
+		idx, err := strconv.ParseUint(a, 10, 64)
+		if err != nil {
+			cli.Exitf("Invalid index %q: %v", a, err)
+		}
+		indices = append(indices, idx)
+	}
+
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := i_note.NewSignerForKey(strings.TrimSpace(privKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	// The redaction log is appended to, so integration of the log itself
+	// mustn't run at the same time.
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to lock storage: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+	st, err := fs.Load(*storageDir, 0)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	rDir := filepath.Join(*storageDir, layout.RedactionsDir)
+	rst, err := fs.Load(rDir, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		rst, err = fs.Create(rDir)
+	}
+	if err != nil {
+		cli.Exitf("Failed to load redaction log: %q", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	if *retentionDays > 0 {
+		retention := time.Duration(*retentionDays) * 24 * time.Hour
+		n, err := log.ExpireEntries(ctx, rfc6962.DefaultHasher, st, rst, f, s, v, *origin, retention, time.Now())
+		if err != nil {
+			cli.Exitf("Failed to expire entries: %q", err)
+		}
+		glog.Infof("Withheld %d entries older than %d days", n, *retentionDays)
+		return
+	}
+	for _, idx := range indices {
+		if _, err := log.Redact(ctx, rfc6962.DefaultHasher, st, rst, f, s, v, *origin, idx, *reason); err != nil {
+			cli.Exitf("Failed to redact entry %d: %q", idx, err)
+		}
+		glog.Infof("Redacted entry %d", idx)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replicate provides a daemon which keeps replicas of a serverless
+// log, e.g. in buckets in other regions mounted as directories, up to date
+// with the log as it's integrated, verifying each before publishing a
+// checkpoint to it. Clients can then fail over to the replicas with the
+// client's --replica_url flag.
+package replicate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/replica"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("replicate", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory of the primary copy of the log, which the integrator writes to.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of the public key file of the log. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = commandLine.String("origin", "", "Origin of the log.")
+	interval   = commandLine.Duration("interval", time.Minute, "How often to replicate the latest checkpoint.")
+	once       = commandLine.Bool("once", false, "If set, replicate the log once and exit, e.g. when run from cron.")
+
+	replicaDirs cli.StringList
+)
+
+func init() {
+	commandLine.Var(&replicaDirs, "replica_dir", "Root directory of a replica of the log. May be repeated.")
+}
+
+// Command is the replicate command.
+var Command = &cli.Command{
+	Name:    "replicate",
+	Summary: "Copy a log to replicas of it, verifying them",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*storageDir) == 0 || len(*origin) == 0 {
+		cli.ExitWith(cli.ExitUsage, "--storage_dir and --origin must be set")
+	}
+	if len(replicaDirs) == 0 {
+		cli.ExitWith(cli.ExitUsage, "At least one --replica_dir must be set")
+	}
+	v, err := log.LoadVerifier(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Failed to load public key: %q", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	for {
+		if err := replicate(ctx, v); err != nil {
+			if *once {
+				cli.Exitf("Failed to replicate log: %q", err)
+			}
+			glog.Warningf("Failed to replicate log: %q", err)
+		}
+		if *once {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// replicate brings each replica up to date with the log. A replica which
+// fails is retried next time, and doesn't hold back the others.
+func replicate(ctx context.Context, v note.Verifier) error {
+	var failed []string
+	for _, dir := range replicaDirs {
+		cp, stats, err := replica.Replicate(ctx, *storageDir, dir, rfc6962.DefaultHasher, v, *origin)
+		if err != nil {
+			glog.Warningf("Failed to replicate log to %q: %v", dir, err)
+			failed = append(failed, dir)
+			continue
+		}
+		if stats.Copied > 0 || stats.Removed > 0 {
+			glog.Infof("Replicated log at size %d to %q: copied %d files, removed %d", cp.Size, dir, stats.Copied, stats.Removed)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to replicate to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reproduce provides a command line tool which independently rebuilds
+// the tree of a log from its original, ordered inputs, and confirms that it
+// matches the log's published checkpoint. This shows that the log was built
+// from exactly that set of inputs, in that order.
+package reproduce
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/entryfiles"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("reproduce", flag.ExitOnError)
+
+var (
+	storageDir     = commandLine.String("storage_dir", "", "Root directory of the log to check. Exactly one of --storage_dir and --log_url must be set.")
+	logURL         = commandLine.String("log_url", "", "Root URL of the log to check.")
+	pubKeyFile     = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin         = commandLine.String("origin", "", "Log origin string.")
+	checkpointFile = commandLine.String("checkpoint", "", "Location of the published checkpoint to check. If unset, the log's current checkpoint is fetched.")
+	entries        = commandLine.String("entries", "", "File path glob of the log's inputs.")
+	order          = commandLine.String("order", "name", "Order in which the inputs matched by --entries were sequenced: name or mtime, as for the sequence command.")
+	manifest       = commandLine.String("entries_manifest", "", "Location of a file listing the paths of the log's inputs, one per line, in the order they were sequenced. May be used instead of --entries.")
+	duplicates     = commandLine.String("duplicates", "", "Duplicate policy the log was built with. If unset, the policy in the log's manifest is used.")
+	extended       = commandLine.Bool("extended", false, "Accept a published tree larger than the reproduced one, so long as it's an extension of it, i.e. the log began with exactly the given inputs.")
+)
+
+// Command is the reproduce command.
+var Command = &cli.Command{
+	Name:    "reproduce",
+	Summary: "Check that a log was built from a known set of inputs",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	v, err := log.LoadVerifier(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Failed to load log public key, supply it with --public_key or SERVERLESS_LOG_PUBLIC_KEY: %q", err)
+	}
+	var f client.Fetcher
+	switch {
+	case len(*storageDir) > 0 && len(*logURL) == 0:
+		f = client.NewFSFetcher(os.DirFS(*storageDir))
+	case len(*logURL) > 0 && len(*storageDir) == 0:
+		u, err := url.Parse(*logURL)
+		if err != nil {
+			cli.Exitf("Invalid --log_url: %q", err)
+		}
+		f = client.NewHTTPFetcher(u, nil)
+	default:
+		cli.Exit("Exactly one of --storage_dir and --log_url must be set")
+	}
+
+	var toAdd []string
+	switch {
+	case len(*entries) > 0 && len(*manifest) > 0:
+		cli.Exit("Only one of --entries and --entries_manifest may be set")
+	case len(*manifest) > 0:
+		if toAdd, err = entryfiles.ReadManifest(*manifest); err != nil {
+			cli.Exitf("Failed to read --entries_manifest: %q", err)
+		}
+	default:
+		if toAdd, err = entryfiles.Glob(*entries, *order); err != nil {
+			cli.Exitf("Failed to list entries %q: %q", *entries, err)
+		}
+	}
+
+	var cpRaw []byte
+	if len(*checkpointFile) > 0 {
+		cpRaw, err = os.ReadFile(*checkpointFile)
+	} else {
+		cpRaw, err = f(ctx, layout.CheckpointPath)
+	}
+	if err != nil {
+		cli.Exitf("Failed to read checkpoint: %q", err)
+	}
+	published, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to open checkpoint: %q", err)
+	}
+	dupes := api.DuplicatePolicy(*duplicates)
+	if len(dupes) == 0 {
+		m, err := client.FetchManifest(ctx, f, v, *origin)
+		if err != nil {
+			cli.Exitf("Failed to read manifest: %q", err)
+		}
+		dupes = m.Duplicates
+	}
+
+	p, err := log.NewReproducer(h, dupes)
+	if err != nil {
+		cli.Exitf("Failed to create reproducer: %q", err)
+	}
+	for _, fp := range toAdd {
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			cli.Exitf("Failed to read entry file %q: %q", fp, err)
+		}
+		seq, err := p.Add(b)
+		if errors.Is(err, log.ErrDupeLeaf) {
+			glog.V(1).Infof("%d: %s (dupe)", seq, fp)
+			continue
+		} else if err != nil {
+			cli.Exitf("Failed to add %q: %q", fp, err)
+		}
+		glog.V(1).Infof("%d: %s", seq, fp)
+	}
+	got, err := p.Checkpoint(*origin)
+	if err != nil {
+		cli.Exitf("Failed to reproduce tree: %q", err)
+	}
+	if err := log.VerifyReproduction(ctx, h, f, got, *published, *extended); err != nil {
+		cli.Exitf("Log doesn't match its inputs: %q", err)
+	}
+	glog.Infof("Reproduced tree of size %d with root hash %x from %d inputs, matching the log's checkpoint of size %d", got.Size, got.Hash, len(toAdd), published.Size)
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rollover provides a command line tool for closing a serverless log and
+// starting a new log to succeed it.
+package rollover
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("rollover", flag.ExitOnError)
+
+var (
+	storageDir  = commandLine.String("storage_dir", "", "Root directory of the log to close.")
+	origin      = commandLine.String("origin", "", "Origin of the log to close.")
+	pubKeyFile  = commandLine.String("public_key", "", "Location of the public key file of the log to close. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile = commandLine.String("private_key", "", "Location of the private key file of the log to close. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+
+	successorDir         = commandLine.String("successor_storage_dir", "", "Root directory to create the successor log in.")
+	successorOrigin      = commandLine.String("successor_origin", "", "Origin of the successor log.")
+	successorPubKeyFile  = commandLine.String("successor_public_key", "", "Location of the public key file of the successor log. If unset, the key of the log being closed is used.")
+	successorPrivKeyFile = commandLine.String("successor_private_key", "", "Location of the private key file of the successor log. If unset, the key of the log being closed is used.")
+	successorURL         = commandLine.String("successor_url", "", "URL of the root of the successor log, which may be relative to the root of the log being closed, e.g. ../log2/")
+	predecessorURL       = commandLine.String("predecessor_url", "", "URL of the root of the log being closed, which may be relative to the root of the successor log, e.g. ../log1/")
+
+	maxSize = commandLine.Uint64("max_size", 0, "If set, only roll over once the log has at least this many entries.")
+	maxAge  = commandLine.Duration("max_age", 0, "If set, only roll over once the log is at least this old. May be combined with --max_size, in which case the log is rolled over when either limit is reached.")
+)
+
+// Command is the rollover command.
+var Command = &cli.Command{
+	Name:    "rollover",
+	Summary: "Close a log and start its successor",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+
+	if len(*origin) == 0 || len(*successorOrigin) == 0 {
+		cli.Exitf("Please set --origin and --successor_origin flags to log identifiers.")
+	}
+	if *origin == *successorOrigin {
+		cli.Exitf("The successor log must have a different origin.")
+	}
+	if len(*successorDir) == 0 {
+		cli.Exitf("Please set --successor_storage_dir.")
+	}
+
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	succPubKey, succPrivKey := pubKey, privKey
+	if len(*successorPubKeyFile) > 0 || len(*successorPrivKeyFile) > 0 {
+		if len(*successorPubKeyFile) == 0 || len(*successorPrivKeyFile) == 0 {
+			cli.Exitf("Please set both --successor_public_key and --successor_private_key, or neither.")
+		}
+		if succPubKey, err = keys.Get(ctx, *successorPubKeyFile, ""); err != nil {
+			cli.Exitf("Unable to get successor public key: %q", err)
+		}
+		if succPrivKey, err = keys.Get(ctx, *successorPrivKeyFile, ""); err != nil {
+			cli.Exitf("Unable to get successor private key: %q", err)
+		}
+	}
+	s, v := mustKeys(privKey, pubKey)
+	succS, _ := mustKeys(succPrivKey, succPubKey)
+
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to lock storage: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, ext, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to open Checkpoint: %q", err)
+	}
+	m, err := client.FetchManifest(ctx, client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	switch {
+	case m.Successor != nil:
+		cli.Exitf("Log has already been succeeded by %q.", m.Successor.Origin)
+	case m.State == api.StateFrozen:
+		cli.Exitf("Log is frozen, make it active before rolling it over.")
+	case m.State == api.StateActive && !due(m, cp.Size):
+		glog.Infof("Log has size %d, not rolling over yet.", cp.Size)
+		return
+	}
+
+	// Stop accepting new entries, then integrate any which were sequenced
+	// before that so that the final checkpoint covers everything the log
+	// accepted.
+	m.State = api.StateReadOnly
+	m.Reason = fmt.Sprintf("closed, succeeded by %s", *successorOrigin)
+	if err := writeManifest(*storageDir, *m, s); err != nil {
+		cli.Exitf("Failed to update manifest: %q", err)
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetImmutable(m.Immutable)
+	st.SetPrefixIndex(m.PrefixIndex)
+	st.SetIndexFormat(m.IndexFormat)
+	st.SetPartialTiles(m.PartialTiles)
+	newCp, err := log.Integrate(ctx, *cp, st, h)
+	if err != nil {
+		cli.Exitf("Failed to integrate: %q", err)
+	}
+	if newCp != nil {
+		if err := log.VerifyAppendOnly(ctx, h, client.NewFSFetcher(os.DirFS(*storageDir)), *cp, *newCp); err != nil {
+			cli.Exitf("Refusing to publish final checkpoint: %q", err)
+		}
+		newCp.Origin = *origin
+		if err := signAndWriteCheckpoint(ctx, st, *newCp, ext, s); err != nil {
+			cli.Exitf("Failed to publish final checkpoint: %q", err)
+		}
+		cp = newCp
+	}
+	if m.Timestamps {
+		// The log won't be integrated again, so this is the last chance to
+		// timestamp its final entries.
+		tst, err := fs.Load(filepath.Join(*storageDir, layout.TimestampsDir), 0)
+		if err != nil {
+			cli.Exitf("Failed to load timestamp log: %q", err)
+		}
+		tst.SetImmutable(m.Immutable)
+		tf := client.ShardFetcher(client.NewFSFetcher(os.DirFS(*storageDir)), layout.TimestampsDir)
+		if err := log.PublishTimestamps(ctx, h, st, tst, tf, s, v, *origin, cp.Size); err != nil {
+			cli.Exitf("Failed to update timestamp log: %q", err)
+		}
+	}
+	final := &api.CheckpointRef{Size: cp.Size, Hash: cp.Hash}
+
+	succSt, err := fs.Create(*successorDir)
+	if err != nil {
+		cli.Exitf("Failed to create successor log: %q", err)
+	}
+	if err := signAndWriteCheckpoint(ctx, succSt, fmtlog.Checkpoint{Origin: *successorOrigin, Hash: h.EmptyRoot()}, nil, succS); err != nil {
+		cli.Exitf("Failed to publish successor checkpoint: %q", err)
+	}
+	if m.Timestamps {
+		tst, err := fs.Create(filepath.Join(*successorDir, layout.TimestampsDir))
+		if err != nil {
+			cli.Exitf("Failed to create successor timestamp log: %q", err)
+		}
+		if err := signAndWriteCheckpoint(ctx, tst, fmtlog.Checkpoint{Origin: api.TimestampsOrigin(*successorOrigin), Hash: h.EmptyRoot()}, nil, succS); err != nil {
+			cli.Exitf("Failed to publish successor timestamp log checkpoint: %q", err)
+		}
+	}
+	sm := api.Manifest{
+		Origin:  *successorOrigin,
+		State:   api.StateActive,
+		Created: time.Now(),
+		Predecessor: &api.LogLink{
+			Origin:    *origin,
+			PublicKey: strings.TrimSpace(pubKey),
+			URL:       *predecessorURL,
+			Final:     final,
+		},
+		// The successor is served, and accepts entries, in the same way as
+		// this log.
+		Immutable:    m.Immutable,
+		Duplicates:   m.Duplicates,
+		Timestamps:   m.Timestamps,
+		PartialTiles: m.PartialTiles,
+	}
+	if err := writeManifest(*successorDir, sm, succS); err != nil {
+		cli.Exitf("Failed to write successor manifest: %q", err)
+	}
+
+	m.Final = final
+	m.Successor = &api.LogLink{
+		Origin:    *successorOrigin,
+		PublicKey: strings.TrimSpace(succPubKey),
+		URL:       *successorURL,
+	}
+	if err := writeManifest(*storageDir, *m, s); err != nil {
+		cli.Exitf("Failed to link log to its successor: %q", err)
+	}
+	glog.Infof("Closed log at size %d, succeeded by %q", cp.Size, *successorOrigin)
+}
+
+// due returns true if a log with manifest m and the given size should be
+// rolled over.
+func due(m *api.Manifest, size uint64) bool {
+	if *maxSize == 0 && *maxAge == 0 {
+		return true
+	}
+	if *maxSize > 0 && size >= *maxSize {
+		return true
+	}
+	if *maxAge > 0 {
+		if m.Created.IsZero() {
+			glog.Warning("Log manifest has no creation time, ignoring --max_age")
+		} else if time.Since(m.Created) >= *maxAge {
+			return true
+		}
+	}
+	return false
+}
+
+// signAndWriteCheckpoint signs and stores cp, followed by the extension lines
+// in ext.
+func signAndWriteCheckpoint(ctx context.Context, st *fs.Storage, cp fmtlog.Checkpoint, ext []byte, s note.Signer) error {
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal()) + string(ext)}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	return st.WriteCheckpoint(ctx, cpRaw)
+}
+
+func writeManifest(rootDir string, m api.Manifest, s note.Signer) error {
+	mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	return fs.WriteManifest(rootDir, mRaw)
+}
+
+func mustKeys(privKey, pubKey string) (note.Signer, note.Verifier) {
+	s, err := i_note.NewSignerForKey(strings.TrimSpace(privKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+	return s, v
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sequence provides a command line tool for sequencing entries in
+// a serverless log.
+package sequence
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"golang.org/x/mod/sumdb/note"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/entryfiles"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("sequence", flag.ExitOnError)
+
+var (
+	storageDir  = commandLine.String("storage_dir", "", "Root directory to store log data.")
+	entries     = commandLine.String("entries", "", "File path glob of entries to add to the log.")
+	order       = commandLine.String("order", "name", "Order in which to sequence the entries matched by --entries: name, for lexicographic order of their paths, or mtime, for oldest modified first with ties broken by path.")
+	manifest    = commandLine.String("entries_manifest", "", "Location of a file listing the paths of entries to add to the log, one per line, in the order to sequence them. Relative paths are relative to the file's directory. May be used instead of --entries.")
+	pubKeyFile  = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin      = commandLine.String("origin", "", "Log origin string to check for in checkpoint.")
+	sharded     = commandLine.Bool("sharded", false, "Set if --storage_dir is the root of a sharded log, to add the entries to its active shard. --origin is then the origin of the sharded log.")
+	maxLeaf     = commandLine.Int("max_leaf_size", 0, "If set, the largest entry in bytes which may be added to the log. Larger entries are rejected.")
+	requestID   = commandLine.String("request_id", "", "If set, the ID of this submission, so that retrying it with the same ID returns the original sequence number rather than adding the entry again. --entries must then match exactly one entry.")
+	contentType = commandLine.String("content_type", "", "If set, the content type to tag the entries with, e.g. application/vnd.in-toto+json. Entries of types with a registered handler are validated, and associated with the identifiers it derives from them. Required if the log's manifest declares the content types it accepts.")
+	submitter   = commandLine.String("submitter", "", "If set, the identity of the authenticated submitter of the entries, such as an API key ID or certificate subject, which is recorded in the log's audit log of submissions for abuse investigations. It isn't published.")
+
+	identifiers   cli.StringList
+	claimKeyFiles cli.StringList
+)
+
+func init() {
+	commandLine.Var(&identifiers, "identifier", "Application identifier to associate with the entries being added, which clients can look up in the identifier map. May be repeated.")
+	commandLine.Var(&claimKeyFiles, "claim_key", "Location of the private key of the owner of a registered namespace used by --identifier, with which to sign the claim to the identifiers. May be repeated.")
+}
+
+// Command is the sequence command.
+var Command = &cli.Command{
+	Name:    "sequence",
+	Summary: "Sequence entries into a log",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	v, err := log.LoadVerifier(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Failed to load log public key, supply it with --public_key or SERVERLESS_LOG_PUBLIC_KEY: %q", err)
+	}
+
+	var toAdd []string
+	switch {
+	case len(*entries) > 0 && len(*manifest) > 0:
+		cli.Exit("Only one of --entries and --entries_manifest may be set")
+	case len(*manifest) > 0:
+		if toAdd, err = entryfiles.ReadManifest(*manifest); err != nil {
+			cli.Exitf("Failed to read --entries_manifest: %q", err)
+		}
+	default:
+		if toAdd, err = entryfiles.Glob(*entries, *order); err != nil {
+			cli.Exitf("Failed to list entries %q: %q", *entries, err)
+		}
+	}
+	if len(toAdd) == 0 {
+		cli.Exit("Sequence must be run with at least one valid entry")
+	}
+	if len(*requestID) > 0 {
+		if err := api.ValidateRequestID(*requestID); err != nil {
+			cli.Exitf("Invalid --request_id: %q", err)
+		}
+		if len(toAdd) > 1 {
+			cli.Exitf("--entries matched %d entries, but only one may be added with --request_id", len(toAdd))
+		}
+	}
+	for _, id := range identifiers {
+		if err := api.ValidateIdentifier(id); err != nil {
+			cli.Exitf("Invalid --identifier: %q", err)
+		}
+	}
+
+	h := rfc6962.DefaultHasher
+	if *sharded {
+		idx, err := client.FetchShardIndex(context.Background(), client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+		if err != nil {
+			cli.Exitf("Failed to read shard index: %q", err)
+		}
+		shard := idx.Active()
+		if len(shard) == 0 {
+			cli.Exit("Sharded log has no shards")
+		}
+		glog.Infof("Adding entries to shard %q", shard)
+		*storageDir = filepath.Join(*storageDir, shard)
+		*origin = api.ShardOrigin(*origin, shard)
+	}
+
+	// init storage
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+
+	// Check signatures
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	m, err := client.FetchManifest(context.Background(), client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.AcceptsEntries() {
+		cli.Exitf("Log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	if len(*contentType) > 0 {
+		if err := api.ValidateContentType(*contentType); err != nil {
+			cli.Exitf("Invalid --content_type: %v", err)
+		}
+	}
+	if len(*submitter) > 0 {
+		if err := api.ValidateSubmitter(*submitter); err != nil {
+			cli.Exitf("Invalid --submitter: %v", err)
+		}
+	}
+	if !m.AcceptsContentType(*contentType) {
+		cli.Exitf("Log doesn't accept entries of content type %q, only %s", *contentType, strings.Join(m.ContentTypes, ", "))
+	}
+
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+	st.SetMaxLeafSize(*maxLeaf)
+	ns, err := client.FetchNamespaces(context.Background(), client.NewFSFetcher(os.DirFS(*storageDir)), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read namespace registry: %q", err)
+	}
+	var claimSigners []note.Signer
+	for _, f := range claimKeyFiles {
+		k, err := keys.Read(context.Background(), f)
+		if err != nil {
+			cli.Exitf("Failed to read --claim_key: %q", err)
+		}
+		s, err := note.NewSigner(strings.TrimSpace(k))
+		if err != nil {
+			cli.Exitf("Failed to instantiate claim signer: %q", err)
+		}
+		claimSigners = append(claimSigners, s)
+	}
+
+	// sequence entries
+
+	// entryInfo binds the actual bytes to be added as a leaf with a
+	// user-recognisable name for the source of those bytes.
+	// The name is only used below in order to inform the user of the
+	// sequence numbers assigned to the data from the provided input files.
+	type entryInfo struct {
+		name string
+		b    []byte
+	}
+	entries := make(chan entryInfo, 100)
+	go func() {
+		for _, fp := range toAdd {
+			b, err := os.ReadFile(fp)
+			if err != nil {
+				cli.Exitf("Failed to read entry file %q: %q", fp, err)
+			}
+			entries <- entryInfo{name: fp, b: b}
+		}
+		close(entries)
+	}()
+
+	opts := log.SequenceOpts{
+		Origin:       *origin,
+		RequestID:    *requestID,
+		Identifiers:  identifiers,
+		Namespaces:   ns,
+		ClaimSigners: claimSigners,
+		ContentType:  *contentType,
+		Submitter:    *submitter,
+	}
+	added := 0
+	for entry := range entries {
+		// ask storage to sequence
+		r, err := log.SequenceEntry(context.Background(), st, h, entry.b, opts)
+		if err != nil {
+			cli.Exitf("failed to sequence %q: %q", entry.name, err)
+		}
+		if r.IdentifiersSkipped {
+			glog.Warningf("%q has already been added to the log, not associating it with identifiers", entry.name)
+		}
+		l := fmt.Sprintf("%d: %v", r.Seq, entry.name)
+		if r.Dupe {
+			l += " (dupe)"
+		} else {
+			added++
+		}
+		glog.Info(l)
+	}
+	if added == 0 {
+		cli.ExitWith(cli.ExitDupesOnly, "All entries were already in the log")
+	}
+}
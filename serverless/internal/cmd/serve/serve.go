@@ -0,0 +1,309 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package serve provides a command line tool for serving a serverless log
+// over HTTP, along with proofs computed from it for clients which can't
+// process tiles themselves.
+package serve
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/admin"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/server"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// policyPoll is how often the checkpoint policy is checked, which bounds how
+// late a due checkpoint may be published.
+const policyPoll = time.Second
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("serve", flag.ExitOnError)
+
+var (
+	storageDir     = commandLine.String("storage_dir", "", "Root directory of the log to serve.")
+	storageZip     = commandLine.String("storage_zip", "", "Location of a zip archive holding a snapshot of the log to serve read-only, in place of --storage_dir. If the log isn't at the root of the archive, its directory can be given after a '#', e.g. snapshot.zip#log.")
+	listen         = commandLine.String("listen", ":8080", "Address to listen on.")
+	pubKeyFile     = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin         = commandLine.String("origin", "", "Log origin string to check for in checkpoints.")
+	drainDelay     = commandLine.Duration("drain_delay", 0, "On SIGTERM or SIGINT, how long to keep serving while reporting not ready on /readyz, so that load balancers stop sending requests before the listener closes.")
+	drainTimeout   = commandLine.Duration("drain_timeout", 30*time.Second, "On shutdown, how long to wait for in-flight requests to finish before closing their connections.")
+	adminListen    = commandLine.String("admin_listen", "", "If set, address to serve the authenticated admin API on. It should not be reachable by the log's clients.")
+	adminTokenFile = commandLine.String("admin_token_file", "", "Location of the file holding the bearer token admin API requests must present. If unset, uses the contents of the SERVERLESS_ADMIN_TOKEN environment variable.")
+	privKeyFile    = commandLine.String("private_key", "", "Location of private key file, needed by the admin API. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	tsKeyFile      = commandLine.String("timestamp_key", "", "If set, location of the private key file of the log's timestamping key, distinct from --private_key, with which integration signs the time at which the published checkpoint is current, even when there's nothing to integrate.")
+	integrateEvery = commandLine.Duration("integrate_interval", 0, "If set, integrates sequenced entries at each multiple of this interval, so that the times at which the log grows don't reveal when entries were submitted. Needs a private key.")
+	releaseBatch   = commandLine.Uint64("release_batch_size", 0, "If set, only integrates sequenced entries in batches of this many, holding back the remainder.")
+	releasePadding = commandLine.Bool("release_padding", false, "With --release_batch_size, pads incomplete batches with padding entries rather than holding them back.")
+	memoryBudget   = commandLine.Uint64("memory_budget", 0, "If set, roughly the number of bytes of new tiles integration may hold in memory, so that large batches can be integrated on small machines.")
+	cpMinInterval  = commandLine.Duration("checkpoint_min_interval", 0, "If set, integrates sequenced entries when a checkpoint is due under the checkpoint policy, leaving at least this long between checkpoints. Needs a private key.")
+	cpMinBatch     = commandLine.Uint64("checkpoint_min_batch_size", 0, "If set, integrates sequenced entries once at least this many are waiting, subject to --checkpoint_min_interval. Needs a private key.")
+	cpMaxLatency   = commandLine.Duration("checkpoint_max_latency", 0, "If set, integrates sequenced entries once the oldest has waited this long, even if there are fewer than --checkpoint_min_batch_size, subject to --checkpoint_min_interval. Needs a private key.")
+	maxCpAge       = commandLine.Duration("max_checkpoint_age", 0, "If set, /readyz reports the server as not ready when the checkpoint was published longer ago than this.")
+	pollInterval   = commandLine.Duration("poll_interval", server.DefaultPollInterval, "How often streaming endpoints, such as /tail, and long-polls of the checkpoint check for a new checkpoint. Proofs are built for the same checkpoint for up to this long, unless a larger tree is asked for.")
+	longPoll       = commandLine.Duration("long_poll_timeout", server.DefaultLongPollTimeout, "How long a request for /checkpoint?wait=true waits for a new checkpoint before returning the current one.")
+	admitWindow    = commandLine.Duration("admission_window", 0, "If set, submissions posted to the admin API are queued for this long after the first of a batch arrives, and the batch is sequenced in order of --priority_prefix.")
+	leaseTTL       = commandLine.Duration("lease_ttl", 0, "If set, integration first takes a lease on integrating the log, renewed each time it integrates and lasting this long, so that several servers sharing the log's storage can integrate it, with only the holder of the lease publishing checkpoints. Should be several times the integration interval or policy poll interval.")
+	leaseHolder    = commandLine.String("lease_holder", "", "With --lease_ttl, the identity with which this server holds the lease, which must be unique among the servers sharing the log's storage. Defaults to the host name.")
+	finalIntegrate = commandLine.Bool("final_integrate", false, "If set, on shutdown, once scheduled integration has stopped, integrates any sequenced entries once more before releasing the lease, so that they aren't left waiting for another server to take over.")
+	admitMaxBatch  = commandLine.Int("admission_max_batch_size", 0, "If set, sequences a batch of queued submissions as soon as it holds at least this many objects, without waiting for the rest of --admission_window.")
+
+	priorityPrefixes cli.StringList
+
+	corsOrigins cli.StringList
+)
+
+func init() {
+	commandLine.Var(&corsOrigins, "cors_origin", "Origin of web pages allowed to read the log and proofs from scripts, e.g. https://verifier.example.com, or * for any. May be repeated.")
+	commandLine.Var(&priorityPrefixes, "priority_prefix", "With --admission_window, the key prefix, relative to submissions/, of a priority class of submitted objects, e.g. revocations/. May be repeated, highest priority first. Other objects are sequenced after all the classes.")
+}
+
+// Command is the serve command.
+var Command = &cli.Command{
+	Name:    "serve",
+	Summary: "Serve a log over HTTP, with proofs",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	if (len(*storageDir) == 0) == (len(*storageZip) == 0) {
+		cli.Exitf("Please set one of --storage_dir or --storage_zip flags.")
+	}
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	fsys, err := logFS()
+	if err != nil {
+		cli.Exitf("Failed to open log: %v", err)
+	}
+	s := server.New(fsys, rfc6962.DefaultHasher, v, *origin)
+	s.MaxCheckpointAge = *maxCpAge
+	s.PollInterval = *pollInterval
+	s.LongPollTimeout = *longPoll
+	// The layout of a log is fixed when it's created, so only needs to be
+	// read once.
+	m, err := client.FetchManifest(context.Background(), client.NewFSFetcher(fsys), v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if s.Immutable = m.Immutable; s.Immutable {
+		glog.Info("Log uses the immutable layout, allowing its immutable files to be cached indefinitely")
+	}
+	if s.PartialTiles = m.PartialTiles; s.PartialTiles == api.PartialTilesDerived {
+		glog.Info("Log doesn't store its partial tiles, deriving them when they're requested")
+	}
+	h := s.Handler()
+	if len(corsOrigins) > 0 {
+		glog.Infof("Allowing cross-origin requests from %v", corsOrigins)
+		h = server.WithCORS(h, corsOrigins)
+	}
+	servers := []*http.Server{{
+		Addr:    *listen,
+		Handler: h,
+	}}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	cpPolicy := log.IntegrationPolicy{MinInterval: *cpMinInterval, MinBatchSize: *cpMinBatch, MaxLatency: *cpMaxLatency}
+	if *integrateEvery > 0 && cpPolicy != (log.IntegrationPolicy{}) {
+		cli.Exit("--integrate_interval can't be combined with the --checkpoint_* policy flags")
+	}
+	if *admitWindow > 0 && len(*adminListen) == 0 {
+		cli.Exit("--admission_window only applies to submissions posted to the admin API, so needs --admin_listen")
+	}
+	if *admitWindow == 0 && (*admitMaxBatch > 0 || len(priorityPrefixes) > 0) {
+		cli.Exit("--admission_max_batch_size and --priority_prefix need --admission_window")
+	}
+	if *leaseTTL == 0 && len(*leaseHolder) > 0 {
+		cli.Exit("--lease_holder needs --lease_ttl")
+	}
+	if *finalIntegrate && len(*adminListen) == 0 && *integrateEvery == 0 && cpPolicy == (log.IntegrationPolicy{}) {
+		cli.Exit("--final_integrate needs --admin_listen, --integrate_interval, or the --checkpoint_* policy flags")
+	}
+	var a *admin.Admin
+	if len(*adminListen) > 0 || *integrateEvery > 0 || cpPolicy != (log.IntegrationPolicy{}) {
+		if len(*storageZip) > 0 {
+			cli.Exit("A log served from --storage_zip is read-only, so can't have an admin API or be integrated")
+		}
+		var err error
+		a, err = newAdmin(v)
+		if err != nil {
+			cli.Exitf("Failed to set up admin API: %v", err)
+		}
+		a.SetReleasePolicy(log.ReleasePolicy{BatchSize: *releaseBatch, Pad: *releasePadding, MemoryBudget: *memoryBudget})
+		if len(*tsKeyFile) > 0 {
+			k, err := keys.Read(ctx, *tsKeyFile)
+			if err != nil {
+				cli.Exitf("Unable to get timestamping key: %v", err)
+			}
+			ts, err := i_note.NewSignerForKey(strings.TrimSpace(k))
+			if err != nil {
+				cli.Exitf("Failed to instantiate timestamping signer: %v", err)
+			}
+			a.SetTimestampSigner(ts)
+		}
+		if *leaseTTL > 0 {
+			holder := *leaseHolder
+			if len(holder) == 0 {
+				if holder, err = os.Hostname(); err != nil {
+					cli.Exitf("Failed to get host name for --lease_holder: %v", err)
+				}
+			}
+			if err := a.SetLease(holder, *leaseTTL); err != nil {
+				cli.Exitf("Invalid lease: %v", err)
+			}
+			glog.Infof("Integrating as %q while holding the lease", holder)
+		}
+		if *admitWindow > 0 {
+			p := admin.AdmissionPolicy{Window: *admitWindow, MaxBatchSize: *admitMaxBatch, Classes: priorityPrefixes}
+			if err := a.SetAdmissionPolicy(p); err != nil {
+				cli.Exitf("Invalid admission policy: %v", err)
+			}
+			glog.Infof("Queueing submissions under admission policy %+v", p)
+		}
+		if len(*adminListen) > 0 {
+			servers = append(servers, &http.Server{
+				Addr:    *adminListen,
+				Handler: a.Handler(),
+			})
+			glog.Infof("Serving admin API on %s", *adminListen)
+		}
+		if *integrateEvery > 0 {
+			a.Schedule(ctx, func(ctx context.Context) { a.IntegrateEvery(ctx, *integrateEvery) })
+			glog.Infof("Integrating every %v", *integrateEvery)
+		}
+		if cpPolicy != (log.IntegrationPolicy{}) {
+			a.Schedule(ctx, func(ctx context.Context) { a.IntegrateWhenDue(ctx, cpPolicy, policyPoll) })
+			glog.Infof("Integrating under checkpoint policy %+v", cpPolicy)
+		}
+	}
+	e := make(chan error, len(servers))
+	for _, hs := range servers {
+		hs := hs
+		go func() {
+			e <- hs.ListenAndServe()
+		}()
+	}
+	glog.Infof("Serving log %q from %q on %s", *origin, *storageDir+*storageZip, *listen)
+
+	select {
+	case err := <-e:
+		cli.Exitf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+
+	glog.Infof("Draining for %v before shutting down", *drainDelay)
+	s.Drain()
+	time.Sleep(*drainDelay)
+	sctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	for _, hs := range servers {
+		if err := hs.Shutdown(sctx); err != nil {
+			glog.Warningf("Failed to finish in-flight requests: %v", err)
+		}
+		if err := <-e; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			cli.Exitf("Server failed: %v", err)
+		}
+	}
+	if a != nil {
+		// Stop scheduled integration before letting another server take
+		// over straight away, so that the two don't overlap.
+		if err := a.Shutdown(sctx, *finalIntegrate); err != nil {
+			glog.Warningf("Failed to shut down integration: %v", err)
+		}
+	}
+	glog.Info("Server shut down")
+}
+
+// logFS returns the files of the log to serve, from either its directory or a
+// zip archive of it.
+func logFS() (fs.FS, error) {
+	if len(*storageDir) > 0 {
+		return os.DirFS(*storageDir), nil
+	}
+	name, dir, _ := strings.Cut(*storageZip, "#")
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %v", err)
+	}
+	if dir = strings.Trim(dir, "/"); dir == "" {
+		return zr, nil
+	}
+	fsys, err := fs.Sub(zr, dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory %q in zip archive: %v", dir, err)
+	}
+	return fsys, nil
+}
+
+// newAdmin returns the admin API for the log, using the configured token and
+// private key. If the admin API isn't served, it's only used for scheduled
+// integration, and is given a random token which is never revealed.
+func newAdmin(v note.Verifier) (*admin.Admin, error) {
+	var token string
+	if len(*adminListen) > 0 {
+		t, err := keys.Get(context.Background(), *adminTokenFile, "SERVERLESS_ADMIN_TOKEN")
+		if err != nil {
+			return nil, fmt.Errorf("unable to get admin token: %w", err)
+		}
+		token = t
+	} else {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+		token = hex.EncodeToString(b)
+	}
+	privKey, err := keys.Get(context.Background(), *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get private key: %w", err)
+	}
+	signer, err := i_note.NewSignerForKey(strings.TrimSpace(privKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate signer: %w", err)
+	}
+	return admin.New(*storageDir, *origin, rfc6962.DefaultHasher, signer, v, strings.TrimSpace(token))
+}
@@ -0,0 +1,198 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shards provides a command line tool for maintaining a log which is
+// sharded by time, with a new shard started each year or quarter.
+package shards
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("shards", flag.ExitOnError)
+
+var (
+	storageDir  = commandLine.String("storage_dir", "", "Root directory of the sharded log.")
+	initialise  = commandLine.Bool("initialise", false, "Set when creating a new sharded log.")
+	pubKeyFile  = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	privKeyFile = commandLine.String("private_key", "", "Location of private key file. If unset, uses the contents of the SERVERLESS_LOG_PRIVATE_KEY environment variable.")
+	origin      = commandLine.String("origin", "", "Origin of the sharded log. Each shard's origin is this followed by a slash and the shard's name.")
+	period      = commandLine.String("period", "year", "Period covered by each shard, one of year or quarter.")
+)
+
+// Command is the shards command.
+var Command = &cli.Command{
+	Name:    "shards",
+	Summary: "Maintain a log sharded by time",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	now := time.Now()
+	name, err := shardName(*period, now)
+	if err != nil {
+		cli.Exit(err)
+	}
+
+	pubKey, err := keys.Get(ctx, *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get public key: %q", err)
+	}
+	privKey, err := keys.Get(ctx, *privKeyFile, "SERVERLESS_LOG_PRIVATE_KEY")
+	if err != nil {
+		cli.Exitf("Unable to get private key: %q", err)
+	}
+	s, err := note.NewSigner(strings.TrimSpace(privKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate signer: %q", err)
+	}
+	v, err := note.NewVerifier(strings.TrimSpace(pubKey))
+	if err != nil {
+		cli.Exitf("Failed to instantiate Verifier: %q", err)
+	}
+
+	if *initialise {
+		if _, err := os.Stat(*storageDir); err == nil {
+			cli.Exitf("%q already exists", *storageDir)
+		}
+		if err := createShard(ctx, name, now, s); err != nil {
+			cli.Exit(err)
+		}
+		if err := writeIndex(api.ShardIndex{Origin: *origin, Shards: []string{name}}, s); err != nil {
+			cli.Exit(err)
+		}
+		glog.Infof("Created sharded log with shard %q", name)
+		return
+	}
+
+	unlock, err := fs.Lock(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to lock storage: %q", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage: %q", err)
+		}
+	}()
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	idx, err := client.FetchShardIndex(ctx, f, v, *origin)
+	if err != nil {
+		cli.Exit(err)
+	}
+	prev := idx.Active()
+	if name <= prev {
+		glog.Infof("Shard %q is still active", prev)
+		return
+	}
+
+	// Create the new shard before adding it to the index, which is what
+	// routes new entries to it.
+	if err := createShard(ctx, name, now, s); err != nil {
+		cli.Exit(err)
+	}
+	idx.Shards = append(idx.Shards, name)
+	if err := writeIndex(*idx, s); err != nil {
+		cli.Exit(err)
+	}
+
+	// The previous shard accepts no more entries, but any already sequenced
+	// will still be integrated.
+	if len(prev) > 0 {
+		prevOrigin := api.ShardOrigin(*origin, prev)
+		m, err := client.FetchManifest(ctx, client.ShardFetcher(f, prev), v, prevOrigin)
+		if err != nil {
+			cli.Exitf("Failed to read manifest of shard %q: %q", prev, err)
+		}
+		if m.State != api.StateReadOnly {
+			m.State = api.StateReadOnly
+			m.Reason = fmt.Sprintf("superseded by shard %s", name)
+			if err := writeManifest(filepath.Join(*storageDir, prev), *m, s); err != nil {
+				cli.Exitf("Failed to update manifest of shard %q: %q", prev, err)
+			}
+		}
+	}
+	glog.Infof("Started shard %q", name)
+}
+
+// shardName returns the name of the shard covering time t, for the given
+// period.
+func shardName(period string, t time.Time) (string, error) {
+	t = t.UTC()
+	switch period {
+	case "year":
+		return fmt.Sprintf("%04d", t.Year()), nil
+	case "quarter":
+		return fmt.Sprintf("%04d-q%d", t.Year(), (int(t.Month())-1)/3+1), nil
+	}
+	return "", fmt.Errorf("unknown shard period %q, want year or quarter", period)
+}
+
+// createShard creates a new, empty, shard of the log.
+func createShard(ctx context.Context, name string, now time.Time, s note.Signer) error {
+	dir := filepath.Join(*storageDir, name)
+	o := api.ShardOrigin(*origin, name)
+	st, err := fs.Create(dir)
+	if err != nil {
+		return fmt.Errorf("failed to create shard %q: %w", name, err)
+	}
+	cp := fmtlog.Checkpoint{Origin: o, Hash: rfc6962.DefaultHasher.EmptyRoot()}
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpRaw); err != nil {
+		return fmt.Errorf("failed to write checkpoint of shard %q: %w", name, err)
+	}
+	return writeManifest(dir, api.Manifest{Origin: o, State: api.StateActive, Created: now}, s)
+}
+
+func writeIndex(idx api.ShardIndex, s note.Signer) error {
+	raw, err := note.Sign(&note.Note{Text: string(idx.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign shard index: %w", err)
+	}
+	return fs.WriteShardIndex(*storageDir, raw)
+}
+
+func writeManifest(rootDir string, m api.Manifest, s note.Signer) error {
+	mRaw, err := note.Sign(&note.Note{Text: string(m.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	return fs.WriteManifest(rootDir, mRaw)
+}
@@ -0,0 +1,271 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package staged provides a command line tool for listing, inspecting, and
+// approving checkpoints staged by the integrate tool.
+package staged
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("staged", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory of the log.")
+	origin     = commandLine.String("origin", "", "Expected log origin string.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of the log's public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+)
+
+const usage = `Usage:
+ staged --storage_dir=<dir> --origin=<origin> <cmd> [flags]
+
+Where <cmd> is one of:
+ list
+	Summarise the staged checkpoint and its approvals.
+ inspect [--approver_public_key=<file>...]
+	Print the staged checkpoint, and check its approvals using the given keys.
+ approve [--private_key=<file>]
+	Approve the staged checkpoint using the approver's private key. If unset,
+	uses the contents of the SERVERLESS_APPROVER_PRIVATE_KEY environment variable.
+`
+
+// Command is the staged command.
+var Command = &cli.Command{
+	Name:    "staged",
+	Summary: "List, inspect and approve staged checkpoints",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	if len(*origin) == 0 {
+		cli.Exitf("Please set --origin flag to log identifier.")
+	}
+	args := commandLine.Args()
+	if len(args) == 0 {
+		cli.Exit(usage)
+	}
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = list()
+	case "inspect":
+		err = inspect(args[1:])
+	case "approve":
+		err = approve(args[1:])
+	default:
+		err = errors.New(usage)
+	}
+	if err != nil {
+		cli.Exitf("%s: %v", args[0], err)
+	}
+}
+
+// staged holds the state of the staged checkpoint.
+type staged struct {
+	body      []byte
+	cp        fmtlog.Checkpoint
+	published fmtlog.Checkpoint
+	approvals map[string][]byte
+	// pubKey is the log's public key.
+	pubKey string
+}
+
+// readStaged reads the staged checkpoint, its approvals, and the currently
+// published checkpoint.
+func readStaged() (*staged, error) {
+	s := &staged{}
+	var err error
+	s.body, err = fs.ReadStagedCheckpoint(*storageDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("no checkpoint is staged")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read staged checkpoint: %w", err)
+	}
+	if _, err := s.cp.Unmarshal(s.body); err != nil {
+		return nil, fmt.Errorf("failed to parse staged checkpoint: %w", err)
+	}
+	if s.cp.Origin != *origin {
+		return nil, fmt.Errorf("staged checkpoint has origin %q, want %q", s.cp.Origin, *origin)
+	}
+
+	pubKey, err := keys.Get(context.Background(), *pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get public key: %w", err)
+	}
+	s.pubKey = strings.TrimSpace(pubKey)
+	v, err := i_note.NewVerifierForKey(s.pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate verifier: %w", err)
+	}
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	pub, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open published checkpoint: %w", err)
+	}
+	s.published = *pub
+
+	s.approvals, err = fs.ReadApprovals(*storageDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approvals: %w", err)
+	}
+	return s, nil
+}
+
+// approvers returns the IDs of the approvers of the staged checkpoint, as
+// returned by log.ApproverID, in sorted order.
+func (s *staged) approvers() []string {
+	names := make([]string, 0, len(s.approvals))
+	for n := range s.approvals {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// approverKeys returns the keys of the approvers with the given IDs, for
+// display.
+func approverKeys(ids []string) []string {
+	ks := make([]string, 0, len(ids))
+	for _, id := range ids {
+		ks = append(ks, log.ApproverKey(id))
+	}
+	return ks
+}
+
+func list() error {
+	s, err := readStaged()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("size %d root %x (+%d entries), %d approvals: %s\n", s.cp.Size, s.cp.Hash, s.cp.Size-s.published.Size, len(s.approvals), strings.Join(approverKeys(s.approvers()), ", "))
+	if i_note.IsThresholdKey(s.pubKey) {
+		// The checkpoint can only be published once enough members of the
+		// log's threshold key have approved it.
+		as := make([][]byte, 0, len(s.approvals))
+		for _, a := range s.approvals {
+			as = append(as, a)
+		}
+		if _, err := log.CombineApprovals(s.body, as, s.pubKey); err != nil {
+			fmt.Printf("not yet publishable: %v\n", err)
+		} else {
+			fmt.Println("publishable: signed by enough members of the log's threshold key")
+		}
+	}
+	return nil
+}
+
+func inspect(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var keyFiles cli.StringList
+	flags.Var(&keyFiles, "approver_public_key", "Location of an approver's public key file. May be repeated.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	s, err := readStaged()
+	if err != nil {
+		return err
+	}
+	var vs []note.Verifier
+	known := make(map[string]bool)
+	for _, f := range keyFiles {
+		k, err := keys.Read(context.Background(), f)
+		if err != nil {
+			return fmt.Errorf("failed to read key file: %w", err)
+		}
+		v, err := i_note.NewVerifierForKey(strings.TrimSpace(k))
+		if err != nil {
+			return fmt.Errorf("failed to instantiate approver verifier from %q: %w", f, err)
+		}
+		vs = append(vs, v)
+		known[log.ApproverID(v.Name(), v.KeyHash())] = true
+	}
+
+	fmt.Printf("Staged checkpoint:\n%s\n", s.body)
+	fmt.Printf("Published size: %d\n", s.published.Size)
+	fmt.Printf("New entries:    %d\n", s.cp.Size-s.published.Size)
+	fmt.Printf("Approvals:      %d\n", len(s.approvals))
+	for _, n := range s.approvers() {
+		status := "unchecked"
+		switch {
+		case len(vs) == 0:
+		case !known[n]:
+			status = "unknown approver"
+		case len(log.VerifyApprovals(s.body, [][]byte{s.approvals[n]}, note.VerifierList(vs...))) > 0:
+			status = "valid"
+		default:
+			status = "INVALID"
+		}
+		fmt.Printf("  %s: %s\n", log.ApproverKey(n), status)
+	}
+	return nil
+}
+
+func approve(args []string) error {
+	flags := flag.NewFlagSet("approve", flag.ExitOnError)
+	privKeyFile := flags.String("private_key", "", "Location of the approver's private key file. If unset, uses the contents of the SERVERLESS_APPROVER_PRIVATE_KEY environment variable.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	privKey, err := keys.Get(context.Background(), *privKeyFile, "SERVERLESS_APPROVER_PRIVATE_KEY")
+	if err != nil {
+		return fmt.Errorf("unable to get private key: %w", err)
+	}
+	signer, err := i_note.NewSignerForKey(strings.TrimSpace(privKey))
+	if err != nil {
+		return fmt.Errorf("failed to instantiate signer: %w", err)
+	}
+	s, err := readStaged()
+	if err != nil {
+		return err
+	}
+	if i_note.IsThresholdKey(s.pubKey) {
+		// Members of the log's threshold key approve with their share of its
+		// signature.
+		if signer, err = i_note.NewThresholdMemberSigner(s.pubKey, signer); err != nil {
+			return err
+		}
+	}
+	a, err := log.SignApproval(s.body, signer)
+	if err != nil {
+		return err
+	}
+	if err := fs.WriteApproval(*storageDir, log.ApproverID(signer.Name(), signer.KeyHash()), a); err != nil {
+		return fmt.Errorf("failed to store approval: %w", err)
+	}
+	fmt.Printf("Approved staged checkpoint of size %d as %s\n", s.cp.Size, signer.Name())
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package submitsbom provides a command line tool for adding SPDX and
+// CycloneDX SBOMs to a serverless log, indexed by the digests and package
+// URLs of the software they describe and contain.
+package submitsbom
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/cli"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/google/trillian-examples/serverless/pkg/sbom"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// commandLine holds the command's flags.
+var commandLine = flag.NewFlagSet("submit_sbom", flag.ExitOnError)
+
+var (
+	storageDir = commandLine.String("storage_dir", "", "Root directory to store log data.")
+	pubKeyFile = commandLine.String("public_key", "", "Location of public key file. If unset, uses the contents of the SERVERLESS_LOG_PUBLIC_KEY environment variable.")
+	origin     = commandLine.String("origin", "", "Log origin string to check for in checkpoint.")
+	dryRun     = commandLine.Bool("dry_run", false, "If set, prints the identifiers each SBOM would be indexed by, without adding it to the log.")
+
+	identifiers   cli.StringList
+	claimKeyFiles cli.StringList
+)
+
+func init() {
+	commandLine.Var(&identifiers, "identifier", "Application identifier to associate with the SBOMs, in addition to those extracted from them. May be repeated.")
+	commandLine.Var(&claimKeyFiles, "claim_key", "Location of the private key of the owner of a registered namespace used by the SBOMs' identifiers, with which to sign the claim to them. May be repeated.")
+}
+
+// Command is the submit_sbom command.
+var Command = &cli.Command{
+	Name:    "submit_sbom",
+	Summary: "Add SBOMs to a log, indexed by the digests they mention",
+	Flags:   commandLine,
+	Main:    run,
+}
+
+func run() {
+	ctx := context.Background()
+	files := commandLine.Args()
+	if len(files) == 0 {
+		cli.ExitWith(cli.ExitUsage, "Usage: submit_sbom [flags] <sbom file>...")
+	}
+	for _, id := range identifiers {
+		if err := api.ValidateIdentifier(id); err != nil {
+			cli.Exitf("Invalid --identifier: %q", err)
+		}
+	}
+
+	// Parse every SBOM before adding any, so that a bad one doesn't leave
+	// the others half submitted.
+	type sbomFile struct {
+		name string
+		raw  []byte
+		ids  []string
+		s    *sbom.SBOM
+	}
+	var sboms []sbomFile
+	for _, f := range files {
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			cli.Exitf("Failed to read SBOM %q: %q", f, err)
+		}
+		s, err := sbom.Parse(raw)
+		if err != nil {
+			cli.Exitf("Failed to parse SBOM %q: %q", f, err)
+		}
+		ids, err := log.HandleContent(s.ContentType, raw, append(append([]string(nil), identifiers...), s.Identifiers()...))
+		if err != nil {
+			cli.Exitf("Invalid SBOM %q: %q", f, err)
+		}
+		sboms = append(sboms, sbomFile{name: f, raw: raw, ids: ids, s: s})
+	}
+	if *dryRun {
+		for _, f := range sboms {
+			fmt.Printf("%s: %s %q\n", f.name, f.s.ContentType, f.s.Name)
+			for _, id := range f.ids {
+				fmt.Printf("  %s\n", id)
+			}
+		}
+		return
+	}
+
+	v, err := log.LoadVerifier(*pubKeyFile, "SERVERLESS_LOG_PUBLIC_KEY")
+	if err != nil {
+		cli.Exitf("Failed to load log public key, supply it with --public_key or SERVERLESS_LOG_PUBLIC_KEY: %q", err)
+	}
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		cli.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	cp, _, _, err := fmtlog.ParseCheckpoint(cpRaw, *origin, v)
+	if err != nil {
+		cli.Exitf("Failed to parse Checkpoint: %q", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(*storageDir))
+	m, err := client.FetchManifest(ctx, f, v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read manifest: %q", err)
+	}
+	if !m.State.AcceptsEntries() {
+		cli.Exitf("Log is %s and not accepting new entries: %q", m.State, m.Reason)
+	}
+	for _, s := range sboms {
+		if !m.AcceptsContentType(s.s.ContentType) {
+			cli.Exitf("Log doesn't accept %s SBOMs like %q, only %s", s.s.ContentType, s.name, strings.Join(m.ContentTypes, ", "))
+		}
+	}
+	st, err := fs.Load(*storageDir, cp.Size)
+	if err != nil {
+		cli.Exitf("Failed to load storage: %q", err)
+	}
+	st.SetDuplicatePolicy(m.Duplicates)
+	ns, err := client.FetchNamespaces(ctx, f, v, *origin)
+	if err != nil {
+		cli.Exitf("Failed to read namespace registry: %q", err)
+	}
+	var claimSigners []note.Signer
+	for _, kf := range claimKeyFiles {
+		k, err := keys.Read(ctx, kf)
+		if err != nil {
+			cli.Exitf("Failed to read --claim_key: %q", err)
+		}
+		s, err := note.NewSigner(strings.TrimSpace(k))
+		if err != nil {
+			cli.Exitf("Failed to instantiate claim signer: %q", err)
+		}
+		claimSigners = append(claimSigners, s)
+	}
+
+	added := 0
+	for _, s := range sboms {
+		opts := log.SequenceOpts{
+			Origin:       *origin,
+			Identifiers:  s.ids,
+			Namespaces:   ns,
+			ClaimSigners: claimSigners,
+			ContentType:  s.s.ContentType,
+		}
+		r, err := log.SequenceEntry(ctx, st, rfc6962.DefaultHasher, s.raw, opts)
+		if err != nil {
+			cli.Exitf("Failed to sequence %q: %q", s.name, err)
+		}
+		if r.IdentifiersSkipped {
+			glog.Warningf("%q has already been added to the log, not indexing it", s.name)
+		}
+		l := fmt.Sprintf("%d: %v (%d identifiers)", r.Seq, s.name, len(s.ids))
+		if r.Dupe {
+			l += " (dupe)"
+		} else {
+			added++
+		}
+		glog.Info(l)
+	}
+	if added == 0 {
+		cli.ExitWith(cli.ExitDupesOnly, "All SBOMs were already in the log")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance provides a suite of test cases for checkpoint and proof
+// verification which every client implementation must agree on, so that the
+// full client and the constrained verifier can't drift apart.
+package conformance
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle/testonly"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	// Origin is the origin of the log whose checkpoints are verified.
+	Origin = "Conformance Log"
+	// PublicKey is the verifier key of the log.
+	PublicKey  = "astra+cad5a3d2+AZJqeuyE/GnknsCNh1eCtDtwdAwKBddOlS8M2eI1Jt4b"
+	privateKey = "PRIVATE+KEY+astra+cad5a3d2+ASgwwenlc0uuYcdy7kI44pQvuz1fw8cS5NqS8RkZBXoy"
+
+	// maxSize is the size of the largest tree proofs are verified in.
+	maxSize = 17
+)
+
+// Verifier is the verification implementation under test.
+type Verifier interface {
+	// OpenCheckpoint verifies the signature with v on the checkpoint raw,
+	// which must be for the log with the given origin, and returns its size
+	// and root hash.
+	OpenCheckpoint(raw []byte, origin string, v note.Verifier) (uint64, []byte, error)
+	// VerifyInclusion verifies proof that the leaf hash lh is at the given
+	// index in the tree of the given size with the given root hash.
+	VerifyInclusion(index, size uint64, lh []byte, proof [][]byte, root []byte) error
+	// VerifyConsistency verifies proof that the tree of size size2 with root
+	// hash root2 extends the tree of size size1 with root hash root1.
+	VerifyConsistency(size1, size2 uint64, proof [][]byte, root1, root2 []byte) error
+}
+
+// Run runs the suite against v.
+func Run(t *testing.T, v Verifier) {
+	t.Helper()
+	tree := testonly.New(rfc6962.DefaultHasher)
+	for i := 0; i < maxSize; i++ {
+		tree.AppendData([]byte(fmt.Sprintf("entry %d", i)))
+	}
+	t.Run("checkpoints", func(t *testing.T) { runCheckpoints(t, v, tree) })
+	t.Run("inclusion", func(t *testing.T) { runInclusion(t, v, tree) })
+	t.Run("consistency", func(t *testing.T) { runConsistency(t, v, tree) })
+}
+
+func runCheckpoints(t *testing.T, v Verifier, tree *testonly.Tree) {
+	signer, err := note.NewSigner(privateKey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	verifier, err := note.NewVerifier(PublicKey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	otherSKey, _, err := note.GenerateKey(rand.Reader, "astra")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherSigner, err := note.NewSigner(otherSKey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	sign := func(s note.Signer, body string) []byte {
+		t.Helper()
+		raw, err := note.Sign(&note.Note{Text: body}, s)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return raw
+	}
+	body := string(log.Checkpoint{Origin: Origin, Size: tree.Size(), Hash: tree.Hash()}.Marshal())
+	valid := sign(signer, body)
+
+	for _, test := range []struct {
+		desc    string
+		raw     []byte
+		wantErr bool
+	}{
+		{desc: "valid", raw: valid},
+		{desc: "extension lines", raw: sign(signer, body+"extension\n")},
+		{desc: "wrong origin", raw: sign(signer, "Other Log"+body[len(Origin):]), wantErr: true},
+		{desc: "wrong key", raw: sign(otherSigner, body), wantErr: true},
+		{desc: "tampered", raw: append([]byte("X"), valid[1:]...), wantErr: true},
+		{desc: "missing hash", raw: sign(signer, fmt.Sprintf("%s\n%d\n", Origin, tree.Size())), wantErr: true},
+		{desc: "invalid size", raw: sign(signer, fmt.Sprintf("%s\n-1\nAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n", Origin)), wantErr: true},
+		{desc: "invalid hash", raw: sign(signer, fmt.Sprintf("%s\n%d\n!!!!\n", Origin, tree.Size())), wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			size, root, err := v.OpenCheckpoint(test.raw, Origin, verifier)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("OpenCheckpoint: %v, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if size != tree.Size() || string(root) != string(tree.Hash()) {
+				t.Errorf("OpenCheckpoint = %d, %x, want %d, %x", size, root, tree.Size(), tree.Hash())
+			}
+		})
+	}
+}
+
+func runInclusion(t *testing.T, v Verifier, tree *testonly.Tree) {
+	for size := uint64(1); size <= maxSize; size++ {
+		root := tree.HashAt(size)
+		for index := uint64(0); index < size; index++ {
+			p, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", index, size, err)
+			}
+			lh := tree.LeafHash(index)
+			if err := v.VerifyInclusion(index, size, lh, p, root); err != nil {
+				t.Errorf("VerifyInclusion(%d, %d): %v", index, size, err)
+			}
+			for _, bad := range []struct {
+				desc        string
+				index, size uint64
+				lh          []byte
+				proof       [][]byte
+				root        []byte
+			}{
+				{desc: "wrong leaf", index: index, size: size, lh: tree.LeafHash((index + 1) % maxSize), proof: p, root: root},
+				{desc: "wrong index", index: index ^ 1, size: size, lh: lh, proof: p, root: root},
+				{desc: "index beyond size", index: size, size: size, lh: lh, proof: p, root: root},
+				{desc: "wrong root", index: index, size: size, lh: lh, proof: p, root: tree.HashAt(size - 1)},
+				{desc: "extra node", index: index, size: size, lh: lh, proof: append(clone(p), root), root: root},
+				{desc: "missing node", index: index, size: size, lh: lh, proof: truncate(p), root: root},
+				{desc: "flipped bit", index: index, size: size, lh: lh, proof: flip(p), root: root},
+				{desc: "short node", index: index, size: size, lh: lh, proof: shorten(p), root: root},
+			} {
+				if bad.proof == nil || (bad.desc == "wrong index" && bad.index >= size) {
+					continue
+				}
+				if err := v.VerifyInclusion(bad.index, bad.size, bad.lh, bad.proof, bad.root); err == nil {
+					t.Errorf("VerifyInclusion(%d, %d) with %s succeeded", index, size, bad.desc)
+				}
+			}
+		}
+	}
+}
+
+func runConsistency(t *testing.T, v Verifier, tree *testonly.Tree) {
+	for size2 := uint64(0); size2 <= maxSize; size2++ {
+		root2 := tree.HashAt(size2)
+		for size1 := uint64(0); size1 <= size2; size1++ {
+			root1 := tree.HashAt(size1)
+			p, err := tree.ConsistencyProof(size1, size2)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", size1, size2, err)
+			}
+			if err := v.VerifyConsistency(size1, size2, p, root1, root2); err != nil {
+				t.Errorf("VerifyConsistency(%d, %d): %v", size1, size2, err)
+			}
+			other := tree.HashAt((size2 + 1) % (maxSize + 1))
+			for _, bad := range []struct {
+				desc         string
+				size1, size2 uint64
+				proof        [][]byte
+				root1, root2 []byte
+			}{
+				{desc: "wrong first root", size1: size1, size2: size2, proof: p, root1: other, root2: root2},
+				{desc: "wrong second root", size1: size1, size2: size2, proof: p, root1: root1, root2: other},
+				{desc: "swapped sizes", size1: size2, size2: size1, proof: p, root1: root2, root2: root1},
+				{desc: "extra node", size1: size1, size2: size2, proof: append(clone(p), root1), root1: root1, root2: root2},
+				{desc: "missing node", size1: size1, size2: size2, proof: truncate(p), root1: root1, root2: root2},
+				{desc: "flipped bit", size1: size1, size2: size2, proof: flip(p), root1: root1, root2: root2},
+				{desc: "short node", size1: size1, size2: size2, proof: shorten(p), root1: root1, root2: root2},
+			} {
+				switch {
+				case bad.proof == nil, bad.desc == "swapped sizes" && size1 == size2:
+					continue
+				case size1 == 0 && (bad.desc == "wrong first root" || bad.desc == "wrong second root"):
+					// Every tree extends the empty tree, whatever the
+					// claimed roots.
+					continue
+				}
+				if err := v.VerifyConsistency(bad.size1, bad.size2, bad.proof, bad.root1, bad.root2); err == nil {
+					t.Errorf("VerifyConsistency(%d, %d) with %s succeeded", size1, size2, bad.desc)
+				}
+			}
+		}
+	}
+}
+
+func clone(p [][]byte) [][]byte {
+	r := make([][]byte, len(p))
+	for i, n := range p {
+		r[i] = append([]byte(nil), n...)
+	}
+	return r
+}
+
+// truncate returns p without its last node, or nil if it's empty.
+func truncate(p [][]byte) [][]byte {
+	if len(p) == 0 {
+		return nil
+	}
+	return clone(p[:len(p)-1])
+}
+
+// flip returns p with a bit of its last node flipped, or nil if it's empty.
+func flip(p [][]byte) [][]byte {
+	if len(p) == 0 {
+		return nil
+	}
+	r := clone(p)
+	r[len(r)-1][0] ^= 1
+	return r
+}
+
+// shorten returns p with its last node shortened, or nil if it's empty.
+func shorten(p [][]byte) [][]byte {
+	if len(p) == 0 {
+		return nil
+	}
+	r := clone(p)
+	r[len(r)-1] = r[len(r)-1][1:]
+	return r
+}
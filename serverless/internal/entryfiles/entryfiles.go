@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package entryfiles lists the files holding entries to be added to a log, in
+// a deterministic order, so that the same files always build the same tree.
+package entryfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Glob returns the paths of the entry files matching pattern, in the given
+// order: name, for lexicographic order of their paths, or mtime, for oldest
+// modified first with ties broken by path. Either way, the order doesn't
+// depend on the order in which the filesystem lists them.
+func Glob(pattern, order string) ([]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	switch order {
+	case "name":
+		sort.Strings(paths)
+	case "mtime":
+		mtimes := make(map[string]int64, len(paths))
+		for _, p := range paths {
+			fi, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			}
+			mtimes[p] = fi.ModTime().UnixNano()
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			a, b := paths[i], paths[j]
+			if mtimes[a] != mtimes[b] {
+				return mtimes[a] < mtimes[b]
+			}
+			return a < b
+		})
+	default:
+		return nil, fmt.Errorf("unknown order %q, want name or mtime", order)
+	}
+	return paths, nil
+}
+
+// ReadManifest returns the paths of the entry files listed one per line in the
+// manifest file at path, in the order listed. Relative paths are relative to
+// the manifest's directory. Blank lines and lines starting with # are
+// ignored.
+func ReadManifest(path string) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	var paths []string
+	for _, l := range strings.Split(string(raw), "\n") {
+		l = strings.TrimSpace(l)
+		if len(l) == 0 || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if !filepath.IsAbs(l) {
+			l = filepath.Join(dir, l)
+		}
+		paths = append(paths, l)
+	}
+	return paths, nil
+}
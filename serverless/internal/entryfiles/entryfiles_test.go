@@ -0,0 +1,77 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entryfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	// c is the oldest, and a and b have the same modification time.
+	for name, age := range map[string]time.Duration{"a": time.Minute, "b": time.Minute, "c": time.Hour} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if err := os.Chtimes(p, now, now.Add(-age)); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+	for _, test := range []struct {
+		order   string
+		want    []string
+		wantErr bool
+	}{
+		{order: "name", want: []string{"a", "b", "c"}},
+		{order: "mtime", want: []string{"c", "a", "b"}},
+		{order: "random", wantErr: true},
+	} {
+		t.Run(test.order, func(t *testing.T) {
+			got, err := Glob(filepath.Join(dir, "*"), test.order)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Glob: %v, want error %t", err, test.wantErr)
+			}
+			for i := range got {
+				got[i] = filepath.Base(got[i])
+			}
+			if diff := cmp.Diff(test.want, got); len(diff) != 0 {
+				t.Errorf("Glob had diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "manifest")
+	if err := os.WriteFile(p, []byte("b\n\n# comment\n/abs/a\n  c  \n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := ReadManifest(p)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	want := []string{filepath.Join(dir, "b"), "/abs/a", filepath.Join(dir, "c")}
+	if diff := cmp.Diff(want, got); len(diff) != 0 {
+		t.Errorf("ReadManifest had diff %s", diff)
+	}
+}
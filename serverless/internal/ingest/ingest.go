@@ -0,0 +1,162 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ingest provides support for sequencing entries delivered by
+// streaming systems into serverless logs.
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle"
+)
+
+// Storage represents the set of functions needed to sequence entries.
+type Storage interface {
+	log.RequestSequencer
+	LookupIndex(ctx context.Context, leafhash []byte) (uint64, error)
+	SetIdentifiers(ctx context.Context, leafhash []byte, ids []string) error
+	SetContentType(ctx context.Context, leafhash []byte, t string) error
+}
+
+// KeyMapper returns the identifiers to associate with the entry of a message
+// with the given key.
+type KeyMapper func(key []byte) ([]string, error)
+
+// NewKeyMapper returns a KeyMapper which associates the entry of each message
+// whose key matches the regular expression pattern with a single identifier,
+// given by expanding template as for regexp.Regexp.Expand. For example, the
+// pattern `^(.+)$` and template `example.com/$1` prefix every non-empty key.
+// Entries of messages with other keys aren't associated with identifiers.
+func NewKeyMapper(pattern, template string) (KeyMapper, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key pattern: %w", err)
+	}
+	return func(key []byte) ([]string, error) {
+		m := re.FindSubmatchIndex(key)
+		if m == nil {
+			return nil, nil
+		}
+		id := string(re.Expand(nil, []byte(template), key, m))
+		if err := api.ValidateIdentifier(id); err != nil {
+			return nil, err
+		}
+		return []string{id}, nil
+	}, nil
+}
+
+// Opts configures a source.
+//
+// Messages which can never be sequenced, e.g. because their entry is too
+// large or would be associated with an invalid identifier, are skipped with a
+// warning so that they don't block the stream.
+type Opts struct {
+	// BatchSize is the largest number of messages sequenced before they
+	// are acknowledged.
+	BatchSize int
+	// BatchTimeout is how long to wait, after the first message of a batch
+	// is read, for the batch to fill up.
+	BatchTimeout time.Duration
+	// Identifiers, if set, maps message keys to the identifiers to associate
+	// with their entries.
+	Identifiers KeyMapper
+	// Namespaces, if set, is the log's namespace registry. Messages whose
+	// entries would be associated with identifiers in registered namespaces
+	// are rejected, since they can't carry a claim signed by the owner.
+	Namespaces *api.Namespaces
+	// ContentType, if set, is the content type of every message's entry, as
+	// for log.SequenceOpts. Messages whose entries aren't valid content of
+	// the type are skipped.
+	ContentType string
+}
+
+// sequencer sequences the entries of messages from any source.
+type sequencer struct {
+	st   Storage
+	h    merkle.LogHasher
+	opts Opts
+}
+
+// sequence sequences value, the entry of the message with the given key.
+// name uniquely identifies the message within the given source, and is used
+// to derive its request ID, so that redelivered messages aren't added again.
+func (s *sequencer) sequence(ctx context.Context, source, name string, key, value []byte) error {
+	lh := s.h.HashLeaf(value)
+	ns, perNamespace := s.st.(log.NamespaceSequencer)
+	perNamespace = perNamespace && ns.DuplicatesPerNamespace()
+	var ids []string
+	if s.opts.Identifiers != nil {
+		var err error
+		if ids, err = s.opts.Identifiers(key); err != nil {
+			glog.Warningf("Skipping message %s with key %q: %v", name, key, err)
+			return nil
+		}
+	}
+	ids, err := log.HandleContent(s.opts.ContentType, value, ids)
+	if err != nil {
+		glog.Warningf("Skipping message %s: %v", name, err)
+		return nil
+	}
+	if len(ids) > 0 {
+		if s.opts.Namespaces != nil {
+			if err := s.opts.Namespaces.VerifyClaim(lh, ids, nil); err != nil {
+				glog.Warningf("Skipping message %s: %v", name, err)
+				return nil
+			}
+		}
+		// Identifiers must be in place before the entry is sequenced,
+		// since it may be integrated as soon as it is.
+		if _, err := s.st.LookupIndex(ctx, lh); err != nil {
+			if err := s.st.SetIdentifiers(ctx, lh, ids); err != nil {
+				return fmt.Errorf("failed to set identifiers of message %s: %w", name, err)
+			}
+		} else if !perNamespace {
+			glog.Warningf("Entry of message %s has already been added to the log, not associating it with identifiers", name)
+		}
+	}
+	if len(s.opts.ContentType) > 0 {
+		if err := s.st.SetContentType(ctx, lh, s.opts.ContentType); err != nil {
+			return fmt.Errorf("failed to set content type of message %s: %w", name, err)
+		}
+	}
+	// Names may be longer than a request ID, so the ID is a hash.
+	id := fmt.Sprintf("%s:%x", source, sha256.Sum256([]byte(name)))
+	var seq uint64
+	if perNamespace {
+		seq, err = ns.SequenceIdentified(ctx, id, lh, value, ids)
+	} else {
+		seq, err = s.st.SequenceRequest(ctx, id, lh, value)
+	}
+	switch {
+	case errors.Is(err, log.ErrLeafTooLarge), errors.Is(err, log.ErrPaddingEntry):
+		glog.Warningf("Skipping message %s: %v", name, err)
+		return nil
+	case errors.Is(err, log.ErrDupeLeaf):
+		glog.Infof("%d: %s (dupe)", seq, name)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to sequence message %s: %w", name, err)
+	}
+	glog.Infof("%d: %s", seq, name)
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nats-io/nats.go"
+	"github.com/transparency-dev/merkle"
+)
+
+// nakDelay is how long JetStream waits before redelivering the messages of a
+// batch which failed to be sequenced.
+const nakDelay = 5 * time.Second
+
+// JetStreamConsumer fetches and acknowledges messages from a JetStream pull
+// consumer.
+type JetStreamConsumer interface {
+	// Fetch returns up to batch messages, waiting until ctx is done for the
+	// batch to fill up. If none arrive, it returns an error.
+	Fetch(ctx context.Context, batch int) ([]*nats.Msg, error)
+	// Ack acknowledges m, waiting for the server to confirm it.
+	Ack(ctx context.Context, m *nats.Msg) error
+	// Nak asks for m to be redelivered after delay.
+	Nak(ctx context.Context, m *nats.Msg, delay time.Duration) error
+}
+
+// NewJetStreamConsumer returns a JetStreamConsumer for sub, a subscription to
+// a pull consumer as returned by nats.JetStreamContext.PullSubscribe.
+func NewJetStreamConsumer(sub *nats.Subscription) JetStreamConsumer {
+	return subscription{sub}
+}
+
+type subscription struct {
+	sub *nats.Subscription
+}
+
+func (s subscription) Fetch(ctx context.Context, batch int) ([]*nats.Msg, error) {
+	return s.sub.Fetch(batch, nats.Context(ctx))
+}
+
+func (s subscription) Ack(ctx context.Context, m *nats.Msg) error {
+	return m.AckSync(nats.Context(ctx))
+}
+
+func (s subscription) Nak(ctx context.Context, m *nats.Msg, delay time.Duration) error {
+	return m.NakWithDelay(delay, nats.Context(ctx))
+}
+
+// JetStreamSource sequences the data of the messages read from a JetStream
+// consumer as entries in a log.
+//
+// Messages are only acknowledged once the entries of their whole batch have
+// been durably sequenced, so they are delivered at least once. Each message
+// is sequenced with a request ID naming its stream and stream sequence
+// number, so a message redelivered, e.g. after a crash or once its ack wait
+// expires, is assigned the same sequence number rather than adding its entry
+// again.
+//
+// No more than a batch of messages is fetched at once, and the next batch
+// isn't fetched until the current one has been acknowledged, so the consumer
+// is never asked for messages faster than they can be sequenced. Its
+// MaxAckPending should be at least the batch size.
+type JetStreamSource struct {
+	c    JetStreamConsumer
+	sq   sequencer
+	opts Opts
+}
+
+// NewJetStreamSource returns a JetStreamSource which sequences the messages
+// read from c into st. The subject of each message is its key.
+func NewJetStreamSource(c JetStreamConsumer, st Storage, h merkle.LogHasher, opts Opts) (*JetStreamSource, error) {
+	if opts.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d", opts.BatchSize)
+	}
+	return &JetStreamSource{c: c, sq: sequencer{st: st, h: h, opts: opts}, opts: opts}, nil
+}
+
+// Run sequences batches of messages until ctx is done or an error occurs,
+// which is returned.
+func (s *JetStreamSource) Run(ctx context.Context) error {
+	for {
+		if _, err := s.Batch(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Batch reads a batch of messages, blocking until at least one is available,
+// sequences their entries, and acknowledges them. It returns the number of
+// messages in the batch.
+//
+// Messages which can never be sequenced are skipped, as described for Opts.
+// Other errors are returned, and the messages of the batch not yet
+// acknowledged are redelivered after a delay.
+func (s *JetStreamSource) Batch(ctx context.Context) (int, error) {
+	msgs, err := s.fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgs {
+		if err := s.sequence(ctx, m); err != nil {
+			s.nak(ctx, msgs)
+			return 0, err
+		}
+	}
+	for i, m := range msgs {
+		if err := s.c.Ack(ctx, m); err != nil {
+			s.nak(ctx, msgs[i:])
+			return 0, fmt.Errorf("failed to acknowledge message: %w", err)
+		}
+	}
+	return len(msgs), nil
+}
+
+// fetch reads the next batch of messages.
+func (s *JetStreamSource) fetch(ctx context.Context) ([]*nats.Msg, error) {
+	for {
+		bctx, cancel := context.WithTimeout(ctx, s.opts.BatchTimeout)
+		msgs, err := s.c.Fetch(bctx, s.opts.BatchSize)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("failed to fetch messages: %w", ctx.Err())
+		case errors.Is(err, nats.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+			// No messages arrived, so keep waiting.
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("failed to fetch messages: %w", err)
+		case len(msgs) > 0:
+			return msgs, nil
+		}
+	}
+}
+
+// nak asks for msgs to be redelivered. Failures are only logged, since the
+// messages will be redelivered anyway once their ack wait expires.
+func (s *JetStreamSource) nak(ctx context.Context, msgs []*nats.Msg) {
+	for _, m := range msgs {
+		if err := s.c.Nak(ctx, m, nakDelay); err != nil {
+			glog.Warningf("Failed to nak message: %v", err)
+		}
+	}
+}
+
+// sequence sequences the entry of a single message.
+func (s *JetStreamSource) sequence(ctx context.Context, m *nats.Msg) error {
+	md, err := m.Metadata()
+	if err != nil {
+		return fmt.Errorf("message on %q isn't from JetStream: %w", m.Subject, err)
+	}
+	name := fmt.Sprintf("%s/%d", md.Stream, md.Sequence.Stream)
+	return s.sq.sequence(ctx, "nats", name, []byte(m.Subject), m.Data)
+}
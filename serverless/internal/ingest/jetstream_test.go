@@ -0,0 +1,167 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/nats-io/nats.go"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// fakeConsumer delivers the messages in its queue, putting those which are
+// nak'd back in order of their stream sequence numbers.
+type fakeConsumer struct {
+	queue   []*nats.Msg
+	acked   []string
+	ackErr  error
+	fetched []int
+}
+
+func (c *fakeConsumer) Fetch(ctx context.Context, batch int) ([]*nats.Msg, error) {
+	c.fetched = append(c.fetched, batch)
+	if len(c.queue) == 0 {
+		<-ctx.Done()
+		return nil, nats.ErrTimeout
+	}
+	if batch > len(c.queue) {
+		batch = len(c.queue)
+	}
+	msgs := c.queue[:batch]
+	c.queue = c.queue[batch:]
+	return msgs, nil
+}
+
+func (c *fakeConsumer) Ack(_ context.Context, m *nats.Msg) error {
+	if c.ackErr != nil {
+		return c.ackErr
+	}
+	c.acked = append(c.acked, m.Subject)
+	return nil
+}
+
+func (c *fakeConsumer) Nak(_ context.Context, m *nats.Msg, _ time.Duration) error {
+	c.queue = append(c.queue, m)
+	sort.SliceStable(c.queue, func(i, j int) bool {
+		mi, _ := c.queue[i].Metadata()
+		mj, _ := c.queue[j].Metadata()
+		return mi != nil && mj != nil && mi.Sequence.Stream < mj.Sequence.Stream
+	})
+	return nil
+}
+
+func jetStreamMsg(seq int, subject, data string) *nats.Msg {
+	return &nats.Msg{
+		Subject: subject,
+		Reply:   fmt.Sprintf("$JS.ACK.ENTRIES.log.1.%d.%d.1680000000000000000.0", seq, seq),
+		Data:    []byte(data),
+		Sub:     &nats.Subscription{},
+	}
+}
+
+func TestJetStreamSource(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	dir := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(dir)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	st.SetDuplicatePolicy(api.DuplicatesAllow)
+
+	c := &fakeConsumer{queue: []*nats.Msg{
+		jetStreamMsg(1, "entries.one", "leaf 1"),
+		jetStreamMsg(2, "entries", "leaf 2"),
+		jetStreamMsg(3, "entries.three", "leaf 3"),
+		jetStreamMsg(4, "entries.four", "leaf 1"),
+	}}
+	km, err := NewKeyMapper(`^entries\.(.+)$`, "example.com/$1")
+	if err != nil {
+		t.Fatalf("NewKeyMapper: %v", err)
+	}
+	s, err := NewJetStreamSource(c, st, h, Opts{BatchSize: 3, BatchTimeout: 10 * time.Millisecond, Identifiers: km})
+	if err != nil {
+		t.Fatalf("NewJetStreamSource: %v", err)
+	}
+
+	// A batch which can't be acknowledged is redelivered, and mustn't be
+	// added again.
+	c.ackErr = errors.New("server unavailable")
+	if _, err := s.Batch(ctx); err == nil {
+		t.Fatal("Batch succeeded despite ack failure")
+	}
+	c.ackErr = nil
+	for _, want := range []int{3, 1} {
+		n, err := s.Batch(ctx)
+		if err != nil {
+			t.Fatalf("Batch: %v", err)
+		}
+		if n != want {
+			t.Errorf("Batch sequenced %d messages, want %d", n, want)
+		}
+	}
+	if diff := cmp.Diff(c.acked, []string{"entries.one", "entries", "entries.three", "entries.four"}); len(diff) != 0 {
+		t.Errorf("Acknowledged messages had diff %s", diff)
+	}
+	// The consumer is never asked for more than a batch.
+	for _, n := range c.fetched {
+		if n != 3 {
+			t.Errorf("Fetched batch of %d messages, want 3", n)
+		}
+	}
+
+	var got []string
+	if _, err := st.ScanSequenced(ctx, 0, func(_ uint64, e []byte) error {
+		got = append(got, string(e))
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanSequenced: %v", err)
+	}
+	if diff := cmp.Diff(got, []string{"leaf 1", "leaf 2", "leaf 3", "leaf 1"}); len(diff) != 0 {
+		t.Errorf("Sequenced entries had diff %s", diff)
+	}
+	b, err := os.ReadFile(filepath.Join(layout.IdentifiersPath(dir, h.HashLeaf([]byte("leaf 3")))))
+	if err != nil || string(b) != "example.com/three\n" {
+		t.Errorf("Identifiers of %q = %q, %v, want %q", "leaf 3", b, err, "example.com/three\n")
+	}
+
+	// Messages which aren't from JetStream can't be sequenced idempotently.
+	c.queue = []*nats.Msg{{Subject: "entries", Data: []byte("leaf 5"), Sub: &nats.Subscription{}}}
+	if _, err := s.Batch(ctx); err == nil {
+		t.Error("Batch of message without metadata succeeded, want error")
+	}
+	if len(c.queue) != 1 {
+		t.Errorf("Failed message wasn't nak'd")
+	}
+
+	// Once the stream is drained, Batch blocks until ctx is done.
+	c.queue = nil
+	cctx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if _, err := s.Batch(cctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Batch on drained stream: %v, want %v", err, context.DeadlineExceeded)
+	}
+}
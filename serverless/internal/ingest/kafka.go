@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/transparency-dev/merkle"
+)
+
+// KafkaReader reads messages from a Kafka topic. It's implemented by
+// *kafka.Reader, which must be configured with a consumer group so that
+// committed offsets are tracked.
+type KafkaReader interface {
+	// FetchMessage blocks until the next message is available, or ctx is
+	// done, without committing its offset.
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	// CommitMessages commits the offsets of the given messages.
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// KafkaSource sequences the values of the messages read from a Kafka topic
+// as entries in a log.
+//
+// Offsets are only committed once the entries of all of the messages up to
+// them have been durably sequenced, so messages are delivered at least once.
+// Each message is sequenced with a request ID naming its partition and
+// offset, so a message redelivered after a crash is assigned the same
+// sequence number rather than adding its entry again.
+type KafkaSource struct {
+	r    KafkaReader
+	sq   sequencer
+	opts Opts
+}
+
+// NewKafkaSource returns a KafkaSource which sequences the messages read by r
+// into st.
+func NewKafkaSource(r KafkaReader, st Storage, h merkle.LogHasher, opts Opts) (*KafkaSource, error) {
+	if opts.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d", opts.BatchSize)
+	}
+	return &KafkaSource{r: r, sq: sequencer{st: st, h: h, opts: opts}, opts: opts}, nil
+}
+
+// Run sequences batches of messages until ctx is done or an error occurs,
+// which is returned.
+func (s *KafkaSource) Run(ctx context.Context) error {
+	for {
+		if _, err := s.Batch(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Batch reads a batch of messages, blocking until at least one is available,
+// sequences their entries, and commits their offsets. It returns the number
+// of messages in the batch.
+//
+// Messages which can never be sequenced are skipped, as described for Opts.
+// Other errors are returned without committing the batch, and the messages
+// in it will be redelivered.
+func (s *KafkaSource) Batch(ctx context.Context) (int, error) {
+	msgs, err := s.fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgs {
+		if err := s.sequence(ctx, m); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.r.CommitMessages(ctx, msgs...); err != nil {
+		return 0, fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	return len(msgs), nil
+}
+
+// fetch reads the next batch of messages.
+func (s *KafkaSource) fetch(ctx context.Context) ([]kafka.Message, error) {
+	m, err := s.r.FetchMessage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message: %w", err)
+	}
+	msgs := []kafka.Message{m}
+	bctx, cancel := context.WithTimeout(ctx, s.opts.BatchTimeout)
+	defer cancel()
+	for len(msgs) < s.opts.BatchSize {
+		m, err := s.r.FetchMessage(bctx)
+		if err != nil {
+			if bctx.Err() != nil && ctx.Err() == nil {
+				// The batch timed out.
+				break
+			}
+			return nil, fmt.Errorf("failed to fetch message: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// sequence sequences the entry of a single message.
+func (s *KafkaSource) sequence(ctx context.Context, m kafka.Message) error {
+	name := fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset)
+	return s.sq.sequence(ctx, "kafka", name, m.Key, m.Value)
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/segmentio/kafka-go"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// fakeReader delivers msgs in order, starting after the last committed one,
+// and blocks once they run out.
+type fakeReader struct {
+	msgs      []kafka.Message
+	next      int
+	committed int
+	commitErr error
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if r.next >= len(r.msgs) {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	r.next++
+	return r.msgs[r.next-1], nil
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	if r.commitErr != nil {
+		return r.commitErr
+	}
+	for _, m := range msgs {
+		if int(m.Offset) >= r.committed {
+			r.committed = int(m.Offset) + 1
+		}
+	}
+	return nil
+}
+
+// restart makes the reader redeliver the uncommitted messages, as after a
+// crash.
+func (r *fakeReader) restart() {
+	r.next = r.committed
+	r.commitErr = nil
+}
+
+func TestNewKeyMapper(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		pattern  string
+		template string
+		key      string
+		want     []string
+		wantErr  bool
+	}{
+		{desc: "prefix", pattern: `^(.+)$`, template: "example.com/$1", key: "pkg", want: []string{"example.com/pkg"}},
+		{desc: "no match", pattern: `^(.+)$`, template: "example.com/$1", key: ""},
+		{desc: "named group", pattern: `^pkg:(?P<name>\w+)$`, template: "${name}", key: "pkg:foo", want: []string{"foo"}},
+		{desc: "invalid identifier", pattern: `(?s)^(.*)$`, template: "x/$1", key: "a\nb", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			m, err := NewKeyMapper(test.pattern, test.template)
+			if err != nil {
+				t.Fatalf("NewKeyMapper: %v", err)
+			}
+			got, err := m([]byte(test.key))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("KeyMapper(%q): %v, want error %t", test.key, err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("KeyMapper(%q) had diff %s", test.key, diff)
+			}
+		})
+	}
+	if _, err := NewKeyMapper("(", ""); err == nil {
+		t.Error("NewKeyMapper with invalid pattern succeeded, want error")
+	}
+}
+
+func TestKafkaSource(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	dir := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(dir)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	st.SetDuplicatePolicy(api.DuplicatesAllow)
+	st.SetMaxLeafSize(10)
+
+	r := &fakeReader{}
+	for i, m := range []struct{ key, value string }{
+		{"one", "leaf 1"},
+		{"", "leaf 2"},
+		{"three", "too large leaf"},
+		{"four", "leaf 4"},
+		{"five", "leaf 1"},
+	} {
+		r.msgs = append(r.msgs, kafka.Message{Topic: "entries", Offset: int64(i), Key: []byte(m.key), Value: []byte(m.value)})
+	}
+	km, err := NewKeyMapper(`^(.+)$`, "example.com/$1")
+	if err != nil {
+		t.Fatalf("NewKeyMapper: %v", err)
+	}
+	s, err := NewKafkaSource(r, st, h, Opts{BatchSize: 3, BatchTimeout: 10 * time.Millisecond, Identifiers: km})
+	if err != nil {
+		t.Fatalf("NewKafkaSource: %v", err)
+	}
+
+	// A batch which can't be committed is redelivered, and mustn't be
+	// added again.
+	r.commitErr = errors.New("broker unavailable")
+	if _, err := s.Batch(ctx); err == nil {
+		t.Fatal("Batch succeeded despite commit failure")
+	}
+	r.restart()
+	for _, want := range []int{3, 2} {
+		n, err := s.Batch(ctx)
+		if err != nil {
+			t.Fatalf("Batch: %v", err)
+		}
+		if n != want {
+			t.Errorf("Batch sequenced %d messages, want %d", n, want)
+		}
+	}
+	if r.committed != len(r.msgs) {
+		t.Errorf("Committed %d messages, want %d", r.committed, len(r.msgs))
+	}
+
+	var got []string
+	if _, err := st.ScanSequenced(ctx, 0, func(_ uint64, e []byte) error {
+		got = append(got, string(e))
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanSequenced: %v", err)
+	}
+	if diff := cmp.Diff(got, []string{"leaf 1", "leaf 2", "leaf 4", "leaf 1"}); len(diff) != 0 {
+		t.Errorf("Sequenced entries had diff %s", diff)
+	}
+	for leaf, want := range map[string]string{
+		"leaf 1": "example.com/one\n",
+		"leaf 4": "example.com/four\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(layout.IdentifiersPath(dir, h.HashLeaf([]byte(leaf)))))
+		if err != nil || string(b) != want {
+			t.Errorf("Identifiers of %q = %q, %v, want %q", leaf, b, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(layout.IdentifiersPath(dir, h.HashLeaf([]byte("leaf 2"))))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Entry of message without key has identifiers: %v", err)
+	}
+
+	// Once the topic is drained, Batch blocks until ctx is done.
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Batch(cctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Batch on drained topic: %v, want %v", err, context.DeadlineExceeded)
+	}
+}
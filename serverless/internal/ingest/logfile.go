@@ -0,0 +1,280 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/merkle"
+)
+
+// headSize is the number of bytes at the start of a log file whose hash is
+// kept, to notice when the file has been rotated and replaced by a new one.
+const headSize = 1024
+
+// FileSource rolls up the complete lines appended to a host's log file, e.g.
+// by syslog, into segments, and sequences a record of the hash of each
+// segment, an api.LogSegment, as an entry in a log. Entries are associated
+// with the host's name as identifier, so that the segments of a host can be
+// found through the identifier map and checked against its files.
+//
+// Progress is recorded in a state file. The range of the next segment is
+// recorded before it's sequenced, and each segment is sequenced with a request
+// ID naming its range and hash, so a segment retried after a crash is
+// assigned the same sequence number rather than being added again.
+type FileSource struct {
+	path      string
+	statePath string
+	seg       api.LogSegment
+	sq        sequencer
+	interval  time.Duration
+}
+
+// NewFileSource returns a FileSource which sequences segments of the file at
+// path, written by host, into st, recording its progress in the file at
+// statePath. The file is recorded in segments under the given name, which
+// defaults to path. A segment is rolled up every opts.BatchTimeout.
+//
+// The identifiers of the entries are always the host, so opts.Identifiers is
+// ignored.
+func NewFileSource(host, name, path, statePath string, st Storage, h merkle.LogHasher, opts Opts) (*FileSource, error) {
+	if len(name) == 0 {
+		name = path
+	}
+	seg := api.LogSegment{Host: host, File: name, Hash: make([]byte, sha256.Size)}
+	if err := api.ValidateLogSegment(seg); err != nil {
+		return nil, err
+	}
+	if opts.BatchTimeout <= 0 {
+		return nil, fmt.Errorf("invalid roll up interval %v", opts.BatchTimeout)
+	}
+	// Otherwise every segment would be skipped, as there's no way to supply
+	// a claim.
+	if opts.Namespaces != nil {
+		if _, ok := opts.Namespaces.Owners[api.Namespace(host)]; ok {
+			return nil, fmt.Errorf("host %q is in registered namespace %q", host, api.Namespace(host))
+		}
+	}
+	opts.Identifiers = func([]byte) ([]string, error) {
+		return []string{host}, nil
+	}
+	return &FileSource{
+		path:      path,
+		statePath: statePath,
+		seg:       api.LogSegment{Host: host, File: name},
+		sq:        sequencer{st: st, h: h, opts: opts},
+		interval:  opts.BatchTimeout,
+	}, nil
+}
+
+// Run rolls up a segment every interval until ctx is done or an error occurs,
+// which is returned.
+func (s *FileSource) Run(ctx context.Context) error {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		if _, err := s.Roll(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Roll sequences the complete lines appended to the file since the last
+// segment as a new segment, which is returned. If there are none, it returns
+// nil.
+//
+// If the file is shorter than it was, or its start has changed, it's assumed
+// to have been rotated, and rolling up starts again from its beginning.
+func (s *FileSource) Roll(ctx context.Context) (*api.LogSegment, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	size := uint64(fi.Size())
+
+	st, err := readFileState(s.statePath)
+	if err != nil {
+		return nil, err
+	}
+	if st.offset+st.pending > size {
+		glog.Warningf("Log file %q has shrunk to %d bytes, assuming it's been rotated", s.path, size)
+		st = fileState{}
+	} else if head, err := hashHead(f, st.offset); err != nil {
+		return nil, err
+	} else if !bytes.Equal(head, st.head) {
+		glog.Warningf("Start of log file %q has changed, assuming it's been rotated", s.path)
+		st = fileState{}
+	}
+
+	if st.pending == 0 {
+		end, err := lastLineEnd(f, st.offset, size)
+		if err != nil {
+			return nil, err
+		}
+		if end == st.offset {
+			return nil, nil
+		}
+		st.pending = end - st.offset
+		if err := writeFileState(s.statePath, st); err != nil {
+			return nil, err
+		}
+	}
+
+	hr := sha256.New()
+	if _, err := io.Copy(hr, io.NewSectionReader(f, int64(st.offset), int64(st.pending))); err != nil {
+		return nil, fmt.Errorf("failed to read log file: %w", err)
+	}
+	seg := s.seg
+	seg.Offset, seg.Length, seg.Hash = st.offset, st.pending, hr.Sum(nil)
+	name := fmt.Sprintf("%s/%s/%d/%d/%x", seg.Host, seg.File, seg.Offset, seg.Length, seg.Hash)
+	if err := s.sq.sequence(ctx, "logfile", name, nil, seg.Marshal()); err != nil {
+		return nil, err
+	}
+
+	st = fileState{offset: st.offset + st.pending}
+	if st.head, err = hashHead(f, st.offset); err != nil {
+		return nil, err
+	}
+	if err := writeFileState(s.statePath, st); err != nil {
+		return nil, err
+	}
+	return &seg, nil
+}
+
+// lastLineEnd returns the offset just after the last newline in f between
+// begin and end, or begin if there's none.
+func lastLineEnd(f io.ReaderAt, begin, end uint64) (uint64, error) {
+	buf := make([]byte, 4096)
+	for end > begin {
+		n := uint64(len(buf))
+		if end-begin < n {
+			n = end - begin
+		}
+		if _, err := f.ReadAt(buf[:n], int64(end-n)); err != nil {
+			return 0, fmt.Errorf("failed to read log file: %w", err)
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return end - n + uint64(i) + 1, nil
+		}
+		end -= n
+	}
+	return begin, nil
+}
+
+// hashHead returns the hash of up to headSize bytes at the start of f, but
+// not beyond limit. It returns nil if limit is zero.
+func hashHead(f io.ReaderAt, limit uint64) ([]byte, error) {
+	if limit == 0 {
+		return nil, nil
+	}
+	if limit > headSize {
+		limit = headSize
+	}
+	buf := make([]byte, limit)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("failed to read log file: %w", err)
+	}
+	h := sha256.Sum256(buf)
+	return h[:], nil
+}
+
+// fileState is the progress of a FileSource through its file.
+type fileState struct {
+	// offset is the end of the last segment sequenced.
+	offset uint64
+	// pending is the length of the segment being sequenced, if any.
+	pending uint64
+	// head is the hash of the start of the file, as returned by hashHead
+	// for offset.
+	head []byte
+}
+
+// readFileState reads the state stored in the file at p, which is in the
+// following format:
+//
+// <offset>\n
+// <pending>\n
+// <base64 head hash>\n
+//
+// If the file doesn't exist, the zero state is returned.
+func readFileState(p string) (fileState, error) {
+	raw, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return fileState{}, nil
+	} else if err != nil {
+		return fileState{}, fmt.Errorf("failed to read state: %w", err)
+	}
+	lines := strings.Split(string(raw), "\n")
+	if len(lines) != 4 || len(lines[3]) != 0 {
+		return fileState{}, fmt.Errorf("state file %q has %d lines, want 3", p, len(lines)-1)
+	}
+	var st fileState
+	if st.offset, err = strconv.ParseUint(lines[0], 10, 64); err != nil {
+		return fileState{}, fmt.Errorf("invalid offset in state file %q: %w", p, err)
+	}
+	if st.pending, err = strconv.ParseUint(lines[1], 10, 64); err != nil {
+		return fileState{}, fmt.Errorf("invalid pending length in state file %q: %w", p, err)
+	}
+	if st.head, err = base64.StdEncoding.DecodeString(lines[2]); err != nil {
+		return fileState{}, fmt.Errorf("invalid head hash in state file %q: %w", p, err)
+	}
+	if len(st.head) == 0 {
+		st.head = nil
+	}
+	return st, nil
+}
+
+// writeFileState atomically replaces the state stored in the file at p.
+func writeFileState(p string, st fileState) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintf(tmp, "%d\n%d\n%s\n", st.offset, st.pending, base64.StdEncoding.EncodeToString(st.head)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
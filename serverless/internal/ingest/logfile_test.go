@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestFileSource(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "log")
+	st, err := fs.Create(dir)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	logFile := filepath.Join(tmp, "syslog")
+	statePath := filepath.Join(tmp, "state")
+	write := func(s string, flag int) {
+		t.Helper()
+		f, err := os.OpenFile(logFile, flag|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatalf("WriteString: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	segment := func(offset uint64, s string) *api.LogSegment {
+		h := sha256.Sum256([]byte(s))
+		return &api.LogSegment{Host: "host1", File: "syslog", Offset: offset, Length: uint64(len(s)), Hash: h[:]}
+	}
+
+	s, err := NewFileSource("host1", "syslog", logFile, statePath, st, h, Opts{BatchTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewFileSource: %v", err)
+	}
+	var want []*api.LogSegment
+	for _, step := range []struct {
+		desc   string
+		append string
+		flag   int
+		want   *api.LogSegment
+	}{
+		{desc: "first lines", append: "line 1\nline 2\npart", flag: os.O_TRUNC, want: segment(0, "line 1\nline 2\n")},
+		{desc: "no complete line", append: "ial", flag: os.O_APPEND},
+		{desc: "line completed", append: " line 3\n", flag: os.O_APPEND, want: segment(14, "partial line 3\n")},
+		{desc: "rotated", append: "new file\n", flag: os.O_TRUNC, want: segment(0, "new file\n")},
+	} {
+		write(step.append, step.flag)
+		got, err := s.Roll(ctx)
+		if err != nil {
+			t.Fatalf("%s: Roll: %v", step.desc, err)
+		}
+		if diff := cmp.Diff(got, step.want); len(diff) != 0 {
+			t.Errorf("%s: Roll had diff %s", step.desc, diff)
+		}
+		if got != nil {
+			want = append(want, got)
+		}
+	}
+
+	// A segment recorded as pending, as after a crash part way through
+	// sequencing it, is retried without being added again.
+	write("line 2\n", os.O_APPEND)
+	if err := writeFileState(statePath, fileState{offset: 0, pending: 9}); err != nil {
+		t.Fatalf("writeFileState: %v", err)
+	}
+	got, err := s.Roll(ctx)
+	if err != nil {
+		t.Fatalf("Roll: %v", err)
+	}
+	if diff := cmp.Diff(got, segment(0, "new file\n")); len(diff) != 0 {
+		t.Errorf("Retried Roll had diff %s", diff)
+	}
+	if got, err := s.Roll(ctx); err != nil {
+		t.Fatalf("Roll: %v", err)
+	} else {
+		want = append(want, got)
+	}
+
+	var gotSegs []*api.LogSegment
+	if _, err := st.ScanSequenced(ctx, 0, func(_ uint64, e []byte) error {
+		seg, err := api.ParseLogSegment(e)
+		if err != nil {
+			return err
+		}
+		gotSegs = append(gotSegs, seg)
+		b, err := os.ReadFile(filepath.Join(layout.IdentifiersPath(dir, h.HashLeaf(e))))
+		if err != nil || string(b) != "host1\n" {
+			t.Errorf("Identifiers of segment %+v = %q, %v, want host1", seg, b, err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanSequenced: %v", err)
+	}
+	if diff := cmp.Diff(gotSegs, want); len(diff) != 0 {
+		t.Errorf("Sequenced segments had diff %s", diff)
+	}
+}
+
+func TestNewFileSource(t *testing.T) {
+	ns := &api.Namespaces{Origin: "log", Owners: map[string]api.NamespaceOwner{"host1": {}}}
+	for _, test := range []struct {
+		desc    string
+		host    string
+		opts    Opts
+		wantErr bool
+	}{
+		{desc: "valid", host: "host1", opts: Opts{BatchTimeout: time.Second}},
+		{desc: "no host", opts: Opts{BatchTimeout: time.Second}, wantErr: true},
+		{desc: "no interval", host: "host1", wantErr: true},
+		{desc: "registered namespace", host: "host1", opts: Opts{BatchTimeout: time.Second, Namespaces: ns}, wantErr: true},
+		{desc: "other namespace", host: "host2", opts: Opts{BatchTimeout: time.Second, Namespaces: ns}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewFileSource(test.host, "", "syslog", "state", nil, rfc6962.DefaultHasher, test.opts)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("NewFileSource: %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
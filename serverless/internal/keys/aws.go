@@ -0,0 +1,159 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeNow is the clock used to sign AWS requests, replaced in tests.
+var timeNow = time.Now
+
+// readAWS reads the AWS Secrets Manager secret with the given name or ARN,
+// optionally followed by ?region=<region>.
+func readAWS(ctx context.Context, name string) ([]byte, error) {
+	id, query, _ := strings.Cut(name, "?")
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	region := q.Get("region")
+	if len(region) == 0 {
+		region = getenvOr("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION"))
+	}
+	if len(region) == 0 {
+		return nil, errors.New("set the region with ?region= or AWS_REGION")
+	}
+	keyID, err := getenv("AWS_ACCESS_KEY_ID")
+	if err != nil {
+		return nil, err
+	}
+	secret, err := getenv("AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return nil, err
+	}
+	endpoint := getenvOr("AWS_ENDPOINT_URL_SECRETS_MANAGER", "https://secretsmanager."+region+".amazonaws.com")
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); len(token) > 0 {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWS(req, body, keyID, secret, region, "secretsmanager", timeNow())
+	var rsp struct {
+		SecretString *string
+		SecretBinary []byte
+	}
+	if err := doJSON(req, &rsp); err != nil {
+		return nil, err
+	}
+	if rsp.SecretString != nil {
+		return []byte(*rsp.SecretString), nil
+	}
+	return rsp.SecretBinary, nil
+}
+
+// signAWS adds an AWS Signature Version 4 authorization header to req, which
+// has the given body.
+func signAWS(req *http.Request, body []byte, keyID, secret, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Every header set so far is signed, along with the host.
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonReq := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	reqHash := sha256.Sum256([]byte(canonReq))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqHash[:])
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, sig))
+}
+
+// canonicalQuery returns the query string of a request in the form signed by
+// AWS Signature Version 4.
+func canonicalQuery(q url.Values) string {
+	var parts []string
+	for k, vs := range q {
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// awsEscape URI-encodes s as required by AWS Signature Version 4.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// readDSM exports the value of the Fortanix DSM secret security object with
+// the given name, authenticating with the API key in FORTANIX_API_KEY. The
+// secret must be exportable.
+func readDSM(ctx context.Context, name string) ([]byte, error) {
+	endpoint := strings.TrimSuffix(getenvOr("FORTANIX_API_ENDPOINT", "https://sdkms.fortanix.com"), "/")
+	apiKey, err := getenv("FORTANIX_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/sys/v1/session/auth", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Basic "+apiKey)
+	var auth struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(req, &auth); err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	defer func() {
+		// The session is only needed for the one export.
+		if req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/sys/v1/session/terminate", nil); err == nil {
+			req.Header.Set("Authorization", "Bearer "+auth.AccessToken)
+			if rsp, err := http.DefaultClient.Do(req); err == nil {
+				rsp.Body.Close()
+			}
+		}
+	}()
+	body, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/crypto/v1/keys/export", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+auth.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	var sobj struct {
+		Value string `json:"value"`
+	}
+	if err := doJSON(req, &sobj); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(sobj.Value)
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	// gcpEndpoint is the base URL of the GCP Secret Manager API, replaced in
+	// tests.
+	gcpEndpoint = "https://secretmanager.googleapis.com/v1/"
+	// gcpTokenSource returns the credentials for GCP, replaced in tests.
+	gcpTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+		return google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	}
+)
+
+// readGCP reads the GCP Secret Manager secret version with the given
+// resource name.
+func readGCP(ctx context.Context, name string) ([]byte, error) {
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets":
+		name += "/versions/latest"
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions":
+	default:
+		return nil, errors.New("want projects/<project>/secrets/<secret>[/versions/<version>]")
+	}
+	ts, err := gcpTokenSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find GCP credentials: %w", err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCP token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpEndpoint+name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	tok.SetAuthHeader(req)
+	var rsp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doJSON(req, &rsp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(rsp.Payload.Data)
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keys reads the keys used by the serverless tools from files, the
+// environment, or cloud secret managers, so that keys need never be written
+// to disk on the machines which use them.
+package keys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// reader reads the secret named by the part of a key location after its
+// scheme.
+type reader func(ctx context.Context, name string) ([]byte, error)
+
+// readers are the supported key location schemes.
+var readers = map[string]reader{
+	"file":  readFile,
+	"env":   readEnv,
+	"gcpsm": readGCP,
+	"awssm": readAWS,
+	"vault": readVault,
+	"dsm":   readDSM,
+}
+
+// Read returns the key at the location loc, which is either the path of a
+// file holding the key, or a URI of one of the forms:
+//
+//   - file://<path>, a file.
+//   - env://<variable>, an environment variable.
+//   - gcpsm://projects/<project>/secrets/<secret>[/versions/<version>], a
+//     GCP Secret Manager secret, by default its latest version.
+//   - awssm://<secret name or ARN>[?region=<region>], an AWS Secrets Manager
+//     secret, in the region given by AWS_REGION if it's not set.
+//   - vault://<path>[#<field>], a field of a HashiCorp Vault secret, by
+//     default the key field, from the server at VAULT_ADDR.
+//   - dsm://<name>, a Fortanix DSM secret, from the cluster at
+//     FORTANIX_API_ENDPOINT.
+//
+// Credentials for the secret managers are taken from the environment as
+// their own tools do: GCP application default credentials, the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables,
+// VAULT_TOKEN, and FORTANIX_API_KEY.
+func Read(ctx context.Context, loc string) (string, error) {
+	scheme, name, ok := strings.Cut(loc, "://")
+	if !ok {
+		scheme, name = "file", loc
+	}
+	r, ok := readers[scheme]
+	if !ok {
+		return "", fmt.Errorf("unknown key location scheme %q", scheme)
+	}
+	k, err := r(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key from %s: %w", loc, err)
+	}
+	return string(k), nil
+}
+
+// Get returns the key at the location loc, as for Read, or if loc is empty
+// the contents of the environment variable env. Since a key never contains
+// "://", the variable may instead hold the location of the key.
+func Get(ctx context.Context, loc, env string) (string, error) {
+	if len(loc) > 0 {
+		return Read(ctx, loc)
+	}
+	k := os.Getenv(env)
+	if len(env) == 0 || len(k) == 0 {
+		return "", fmt.Errorf("supply key location or set %s environment variable", env)
+	}
+	if IsLocation(k) {
+		return Read(ctx, strings.TrimSpace(k))
+	}
+	return k, nil
+}
+
+// IsLocation returns true if s is a key location URI rather than a key.
+func IsLocation(s string) bool {
+	scheme, _, ok := strings.Cut(strings.TrimSpace(s), "://")
+	_, known := readers[scheme]
+	return ok && known
+}
+
+func readFile(_ context.Context, path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func readEnv(_ context.Context, name string) ([]byte, error) {
+	k, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not set", name)
+	}
+	return []byte(k), nil
+}
+
+// doJSON sends req, and decodes the JSON response into resp.
+func doJSON(req *http.Request, resp interface{}) error {
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", rsp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// getenv returns the value of the environment variable name, or an error if
+// it's unset.
+func getenv(name string) (string, error) {
+	v := os.Getenv(name)
+	if len(v) == 0 {
+		return "", errors.New(name + " is not set")
+	}
+	return v, nil
+}
+
+// getenvOr returns the value of the environment variable name, or def if
+// it's unset.
+func getenvOr(name, def string) string {
+	if v := os.Getenv(name); len(v) > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const testKey = "PRIVATE+KEY+astra+cad5a3d2+AXJ0FNbyVBxCFAqFMtHvpE+Zm0Ft4mXMRsKCVMNt9vFE"
+
+func TestReadLocal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(testKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_KEY", testKey)
+	t.Setenv("TEST_KEY_LOCATION", "file://"+path)
+	for _, test := range []struct {
+		desc     string
+		loc, env string
+		wantErr  bool
+	}{
+		{desc: "path", loc: path},
+		{desc: "file URI", loc: "file://" + path},
+		{desc: "env URI", loc: "env://TEST_KEY"},
+		{desc: "env", env: "TEST_KEY"},
+		{desc: "env holding location", env: "TEST_KEY_LOCATION"},
+		{desc: "missing file", loc: path + ".missing", wantErr: true},
+		{desc: "unset env URI", loc: "env://TEST_KEY_UNSET", wantErr: true},
+		{desc: "unset env", env: "TEST_KEY_UNSET", wantErr: true},
+		{desc: "unknown scheme", loc: "s3://bucket/key", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := Get(ctx, test.loc, test.env)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Get = %q, %v, want err %t", got, err, test.wantErr)
+			}
+			if !test.wantErr && got != testKey {
+				t.Errorf("Get = %q, want %q", got, testKey)
+			}
+		})
+	}
+}
+
+func TestReadGCP(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Authorization"), "Bearer token"; got != want {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/projects/p/secrets/log/versions/latest:access" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(testKey))},
+		})
+	}))
+	defer s.Close()
+	defer func(e string, ts func(context.Context) (oauth2.TokenSource, error)) {
+		gcpEndpoint, gcpTokenSource = e, ts
+	}(gcpEndpoint, gcpTokenSource)
+	gcpEndpoint = s.URL + "/"
+	gcpTokenSource = func(context.Context) (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}), nil
+	}
+	checkRead(t, "gcpsm://projects/p/secrets/log", true)
+	checkRead(t, "gcpsm://projects/p/secrets/other", false)
+	checkRead(t, "gcpsm://log", false)
+}
+
+func TestReadAWS(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ SecretId string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/20230102/eu-west-1/secretsmanager/aws4_request, ") ||
+			r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			http.Error(w, "bad request", http.StatusForbidden)
+			return
+		}
+		if req.SecretId != "log" {
+			http.Error(w, "not found", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": testKey})
+	}))
+	defer s.Close()
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", s.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	checkRead(t, "awssm://log", false)
+	checkRead(t, "awssm://log?region=eu-west-1", true)
+	t.Setenv("AWS_REGION", "eu-west-1")
+	checkRead(t, "awssm://log", true)
+	checkRead(t, "awssm://other", false)
+}
+
+func TestSignAWS(t *testing.T) {
+	// The example from the AWS Signature Version 4 documentation.
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWS(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+func TestReadVault(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/log":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]string{"key": testKey, "private_key": testKey},
+					"metadata": map[string]int{"version": 1},
+				},
+			})
+		case "/v1/kv/log":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"key": testKey},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	t.Setenv("VAULT_ADDR", s.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+	checkRead(t, "vault://secret/data/log", true)
+	checkRead(t, "vault://secret/data/log#private_key", true)
+	checkRead(t, "vault://kv/log", true)
+	checkRead(t, "vault://secret/data/log#public_key", false)
+	checkRead(t, "vault://secret/data/other", false)
+}
+
+func TestReadDSM(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sys/v1/session/auth":
+			if r.Header.Get("Authorization") != "Basic apikey" {
+				http.Error(w, "bad API key", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+		case "/sys/v1/session/terminate":
+		case "/crypto/v1/keys/export":
+			var req struct{ Name string }
+			if r.Header.Get("Authorization") != "Bearer token" || json.NewDecoder(r.Body).Decode(&req) != nil || req.Name != "log" {
+				http.Error(w, "sobject not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"value": base64.StdEncoding.EncodeToString([]byte(testKey))})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	t.Setenv("FORTANIX_API_ENDPOINT", s.URL)
+	t.Setenv("FORTANIX_API_KEY", "apikey")
+	checkRead(t, "dsm://log", true)
+	checkRead(t, "dsm://other", false)
+	t.Setenv("FORTANIX_API_KEY", "wrong")
+	checkRead(t, "dsm://log", false)
+}
+
+// checkRead checks that Read of loc returns testKey if ok is set, or else
+// fails.
+func checkRead(t *testing.T, loc string, ok bool) {
+	t.Helper()
+	got, err := Read(context.Background(), loc)
+	switch {
+	case ok && err != nil:
+		t.Errorf("Read(%q): %v", loc, err)
+	case ok && got != testKey:
+		t.Errorf("Read(%q) = %q, want %q", loc, got, testKey)
+	case !ok && err == nil:
+		t.Errorf("Read(%q) = %q, want error", loc, got)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// readVault reads a field of the HashiCorp Vault secret at the given path,
+// of the form <path>[#<field>]. Both version 1 and 2 key/value secrets
+// engines are supported; for version 2, the path includes "data/", as for
+// the HTTP API.
+func readVault(ctx context.Context, name string) ([]byte, error) {
+	addr, err := getenv("VAULT_ADDR")
+	if err != nil {
+		return nil, err
+	}
+	token, err := getenv("VAULT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	path, field, ok := strings.Cut(name, "#")
+	if !ok {
+		field = "key"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); len(ns) > 0 {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	var rsp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := doJSON(req, &rsp); err != nil {
+		return nil, err
+	}
+	data := rsp.Data
+	// A version 2 secret nests its fields in data.data, alongside metadata.
+	if raw, ok := data["data"]; ok && data["metadata"] != nil {
+		data = nil
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("invalid secret data: %w", err)
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return nil, fmt.Errorf("secret has no %q field", field)
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("secret field %q isn't a string", field)
+	}
+	return []byte(v), nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate provides support for populating serverless logs with the
+// contents of logs stored elsewhere.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	tt "github.com/google/trillian/types"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/proof"
+)
+
+// ImportTrillian copies all of the leaves in the Trillian log with the given
+// tree ID which aren't yet present in the serverless log storage st, in
+// order, and integrates them.
+//
+// cp is the current checkpoint of the serverless log. The root hash of the
+// resulting tree is cross-checked against the latest root of the Trillian log,
+// and a consistency proof from the Trillian log is used to check that cp is
+// consistent with it.
+//
+// Returns the new checkpoint for the serverless log, which the caller should
+// sign and publish.
+func ImportTrillian(ctx context.Context, c trillian.TrillianLogClient, treeID int64, st log.Storage, h merkle.LogHasher, cp fmtlog.Checkpoint, batchSize int64) (*fmtlog.Checkpoint, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d", batchSize)
+	}
+	rResp, err := c.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: treeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest log root: %w", err)
+	}
+	var root tt.LogRootV1
+	if err := root.UnmarshalBinary(rResp.GetSignedLogRoot().GetLogRoot()); err != nil {
+		return nil, fmt.Errorf("failed to parse log root: %w", err)
+	}
+	glog.Infof("Source log has size %d and root hash %x", root.TreeSize, root.RootHash)
+	if cp.Size > root.TreeSize {
+		return nil, fmt.Errorf("serverless log (size %d) is larger than source log (size %d)", cp.Size, root.TreeSize)
+	}
+
+	// Ensure the entries we already have are consistent with the source log.
+	if cp.Size > 0 && cp.Size < root.TreeSize {
+		pResp, err := c.GetConsistencyProof(ctx, &trillian.GetConsistencyProofRequest{
+			LogId:          treeID,
+			FirstTreeSize:  int64(cp.Size),
+			SecondTreeSize: int64(root.TreeSize),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get consistency proof: %w", err)
+		}
+		if err := proof.VerifyConsistency(h, cp.Size, root.TreeSize, pResp.GetProof().GetHashes(), cp.Hash, root.RootHash); err != nil {
+			return nil, fmt.Errorf("serverless log is not consistent with source log: %w", err)
+		}
+	}
+
+	// Entries may have been sequenced by an earlier, interrupted, run, so
+	// skip over them. If they don't match the source, the root hash check
+	// below will fail.
+	pending, err := st.ScanSequenced(ctx, cp.Size, func(uint64, []byte) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sequenced entries: %w", err)
+	}
+	next := cp.Size + pending
+	for next < root.TreeSize {
+		count := batchSize
+		if r := int64(root.TreeSize - next); r < count {
+			count = r
+		}
+		lResp, err := c.GetLeavesByRange(ctx, &trillian.GetLeavesByRangeRequest{
+			LogId:      treeID,
+			StartIndex: int64(next),
+			Count:      count,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get leaves [%d, %d): %w", next, next+uint64(count), err)
+		}
+		if len(lResp.GetLeaves()) == 0 {
+			return nil, fmt.Errorf("source log returned no leaves from index %d", next)
+		}
+		for _, l := range lResp.GetLeaves() {
+			if got := l.GetLeafIndex(); got != int64(next) {
+				return nil, fmt.Errorf("source log returned leaf index %d, want %d", got, next)
+			}
+			lh := h.HashLeaf(l.GetLeafValue())
+			if mlh := l.GetMerkleLeafHash(); len(mlh) > 0 && !bytes.Equal(mlh, lh) {
+				return nil, fmt.Errorf("leaf %d has Merkle leaf hash %x, but its value hashes to %x", next, mlh, lh)
+			}
+			seq, err := st.Sequence(ctx, lh, l.GetLeafValue())
+			if errors.Is(err, log.ErrDupeLeaf) {
+				return nil, fmt.Errorf("leaf %d duplicates leaf %d, so can't be imported in order", next, seq)
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to sequence leaf %d: %w", next, err)
+			}
+			if seq != next {
+				return nil, fmt.Errorf("leaf %d was sequenced at index %d", next, seq)
+			}
+			next++
+		}
+		glog.V(1).Infof("Sequenced %d/%d leaves", next, root.TreeSize)
+	}
+
+	newCP, err := log.Integrate(ctx, cp, st, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to integrate: %w", err)
+	}
+	if newCP == nil {
+		newCP = &cp
+	}
+	if newCP.Size != root.TreeSize || !bytes.Equal(newCP.Hash, root.RootHash) {
+		return nil, fmt.Errorf("imported log has size %d and root hash %x, but source has size %d and root hash %x", newCP.Size, newCP.Hash, root.TreeSize, root.RootHash)
+	}
+	return newCP, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	tt "github.com/google/trillian/types"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"github.com/transparency-dev/merkle/testonly"
+	"google.golang.org/grpc"
+)
+
+// fakeLog is a minimal in-memory implementation of the parts of the Trillian
+// log API used by ImportTrillian.
+type fakeLog struct {
+	trillian.TrillianLogClient
+
+	leaves [][]byte
+	tree   *testonly.Tree
+	// maxLeaves limits the number of leaves returned by each GetLeavesByRange call.
+	maxLeaves int
+	// corrupt, if set, is applied to each returned leaf.
+	corrupt func(*trillian.LogLeaf)
+}
+
+func newFakeLog(n int) *fakeLog {
+	f := &fakeLog{tree: testonly.New(rfc6962.DefaultHasher), maxLeaves: 3}
+	for i := 0; i < n; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		f.leaves = append(f.leaves, l)
+		f.tree.AppendData(l)
+	}
+	return f
+}
+
+func (f *fakeLog) GetLatestSignedLogRoot(_ context.Context, _ *trillian.GetLatestSignedLogRootRequest, _ ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	r, err := (&tt.LogRootV1{TreeSize: f.tree.Size(), RootHash: f.tree.Hash()}).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &trillian.GetLatestSignedLogRootResponse{SignedLogRoot: &trillian.SignedLogRoot{LogRoot: r}}, nil
+}
+
+func (f *fakeLog) GetConsistencyProof(_ context.Context, req *trillian.GetConsistencyProofRequest, _ ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	p, err := f.tree.ConsistencyProof(uint64(req.FirstTreeSize), uint64(req.SecondTreeSize))
+	if err != nil {
+		return nil, err
+	}
+	return &trillian.GetConsistencyProofResponse{Proof: &trillian.Proof{Hashes: p}}, nil
+}
+
+func (f *fakeLog) GetLeavesByRange(_ context.Context, req *trillian.GetLeavesByRangeRequest, _ ...grpc.CallOption) (*trillian.GetLeavesByRangeResponse, error) {
+	resp := &trillian.GetLeavesByRangeResponse{}
+	for i := req.StartIndex; i < req.StartIndex+req.Count && i < int64(len(f.leaves)) && len(resp.Leaves) < f.maxLeaves; i++ {
+		l := &trillian.LogLeaf{
+			LeafIndex:      i,
+			LeafValue:      f.leaves[i],
+			MerkleLeafHash: rfc6962.DefaultHasher.HashLeaf(f.leaves[i]),
+		}
+		if f.corrupt != nil {
+			f.corrupt(l)
+		}
+		resp.Leaves = append(resp.Leaves, l)
+	}
+	return resp, nil
+}
+
+func TestImportTrillian(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	src := newFakeLog(10)
+	cp, err := ImportTrillian(ctx, src, 1, st, h, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, 4)
+	if err != nil {
+		t.Fatalf("ImportTrillian: %v", err)
+	}
+	if cp.Size != 10 || !bytes.Equal(cp.Hash, src.tree.Hash()) {
+		t.Errorf("Got checkpoint size %d hash %x, want size 10 hash %x", cp.Size, cp.Hash, src.tree.Hash())
+	}
+
+	// Importing again once the source has grown should only copy the new leaves.
+	for i := 10; i < 15; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		src.leaves = append(src.leaves, l)
+		src.tree.AppendData(l)
+	}
+	cp, err = ImportTrillian(ctx, src, 1, st, h, *cp, 4)
+	if err != nil {
+		t.Fatalf("ImportTrillian: %v", err)
+	}
+	if cp.Size != 15 || !bytes.Equal(cp.Hash, src.tree.Hash()) {
+		t.Errorf("Got checkpoint size %d hash %x, want size 15 hash %x", cp.Size, cp.Hash, src.tree.Hash())
+	}
+
+	// Nothing new to import.
+	if _, err := ImportTrillian(ctx, src, 1, st, h, *cp, 4); err != nil {
+		t.Fatalf("ImportTrillian: %v", err)
+	}
+}
+
+func TestImportTrillianErrors(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	for _, test := range []struct {
+		desc  string
+		src   func() *fakeLog
+		cp    fmtlog.Checkpoint
+		batch int64
+	}{
+		{
+			desc:  "bad batch size",
+			src:   func() *fakeLog { return newFakeLog(3) },
+			cp:    fmtlog.Checkpoint{Hash: h.EmptyRoot()},
+			batch: 0,
+		}, {
+			desc: "bad merkle leaf hash",
+			src: func() *fakeLog {
+				f := newFakeLog(3)
+				f.corrupt = func(l *trillian.LogLeaf) { l.MerkleLeafHash = h.HashLeaf([]byte("banana")) }
+				return f
+			},
+			cp:    fmtlog.Checkpoint{Hash: h.EmptyRoot()},
+			batch: 10,
+		}, {
+			desc: "wrong leaf index",
+			src: func() *fakeLog {
+				f := newFakeLog(3)
+				f.corrupt = func(l *trillian.LogLeaf) { l.LeafIndex++ }
+				return f
+			},
+			cp:    fmtlog.Checkpoint{Hash: h.EmptyRoot()},
+			batch: 10,
+		}, {
+			desc: "duplicate leaves",
+			src: func() *fakeLog {
+				f := newFakeLog(2)
+				f.leaves = append(f.leaves, f.leaves[0])
+				f.tree.AppendData(f.leaves[0])
+				return f
+			},
+			cp:    fmtlog.Checkpoint{Hash: h.EmptyRoot()},
+			batch: 10,
+		}, {
+			desc:  "local log larger",
+			src:   func() *fakeLog { return newFakeLog(3) },
+			cp:    fmtlog.Checkpoint{Size: 4, Hash: h.EmptyRoot()},
+			batch: 10,
+		}, {
+			desc:  "local log inconsistent",
+			src:   func() *fakeLog { return newFakeLog(3) },
+			cp:    fmtlog.Checkpoint{Size: 1, Hash: h.HashLeaf([]byte("banana"))},
+			batch: 10,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if _, err := ImportTrillian(ctx, test.src(), 1, st, h, test.cp, test.batch); err == nil {
+				t.Fatal("ImportTrillian succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package openapi provides the subset of the OpenAPI 3.0 document model
+// needed to describe the serverless log HTTP API, along with a generator of
+// minimal Go clients for the APIs it describes.
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Version is the version of the OpenAPI specification documents conform to.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI string `json:"openapi"`
+	Info    Info   `json:"info"`
+	// Paths maps each path to its operations, keyed by lower case HTTP
+	// method.
+	Paths map[string]map[string]Operation `json:"paths"`
+}
+
+// Info holds metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Operation describes a single API operation on a path.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Streaming is set if successful responses are streamed for as long as
+	// the client stays connected, rather than ending.
+	Streaming bool `json:"x-streaming,omitempty"`
+}
+
+// Parameter describes a parameter of an operation.
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Schema      Schema `json:"schema"`
+}
+
+// Schema describes the type of a parameter or response body.
+type Schema struct {
+	Type    string `json:"type"`
+	Format  string `json:"format,omitempty"`
+	Minimum *int   `json:"minimum,omitempty"`
+}
+
+// Response describes a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the body of a response with a given content type.
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// Marshal returns the JSON form of the document.
+func (d Document) Marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Parse parses the JSON form of a document.
+func Parse(raw []byte) (*Document, error) {
+	d := &Document{}
+	if err := json.Unmarshal(raw, d); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(d.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", d.OpenAPI)
+	}
+	return d, nil
+}
+
+type clientParam struct {
+	Name, GoName, GoType, Format string
+	// Set, if the parameter is optional, is the condition under which it's
+	// sent, i.e. that it doesn't have its zero value.
+	Set string
+}
+
+type clientMethod struct {
+	Name, Summary, Path string
+	Params              []clientParam
+	Streaming           bool
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by {{.Generator}} from the OpenAPI description of {{.Title}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- if .IO}}
+	"io"
+{{- end}}
+	"net/url"
+{{- if .Strconv}}
+	"strconv"
+{{- end}}
+)
+{{range .Methods}}
+// {{.Name}} {{.Summary}}
+func (c *Client) {{.Name}}(ctx context.Context{{range .Params}}, {{.GoName}} {{.GoType}}{{end}}) ({{if .Streaming}}io.ReadCloser{{else}}[]byte{{end}}, error) {
+	q := url.Values{}
+{{- range .Params}}
+{{- if .Set}}
+	if {{printf .Set .GoName}} {
+		q.Set({{printf "%q" .Name}}, {{printf .Format .GoName}})
+	}
+{{- else}}
+	q.Set({{printf "%q" .Name}}, {{printf .Format .GoName}})
+{{- end}}
+{{- end}}
+	return c.{{if .Streaming}}stream{{else}}get{{end}}(ctx, {{printf "%q" .Path}}, q)
+}
+{{end}}`))
+
+// GenerateGoClient returns the source of methods on a Client type in the
+// named package, one for each GET operation described by d. Each method
+// takes the operation's query parameters as arguments, sending optional ones
+// only if they're not the zero value, and returns the body of a successful
+// response, or for streaming operations the body itself,
+// which the caller must close.
+//
+// The Client type must be written by hand, and provide a method with the
+// signature get(ctx context.Context, path string, q url.Values) ([]byte, error)
+// which requests the path, relative to the root of the API, with the query.
+// If there are streaming operations, it must also provide a method stream
+// with the same arguments which returns an io.ReadCloser.
+func GenerateGoClient(d *Document, pkg, generator string) ([]byte, error) {
+	var methods []clientMethod
+	useStrconv, useIO := false, false
+	for p, ops := range d.Paths {
+		op, ok := ops["get"]
+		if !ok {
+			continue
+		}
+		m := clientMethod{
+			Name:      goName(op.OperationID, true),
+			Summary:   lowerFirst(op.Summary),
+			Path:      strings.TrimPrefix(p, "/"),
+			Streaming: op.Streaming,
+		}
+		useIO = useIO || op.Streaming
+		if len(m.Name) == 0 {
+			return nil, fmt.Errorf("operation on %q has no operationId", p)
+		}
+		for _, param := range op.Parameters {
+			if param.In != "query" {
+				return nil, fmt.Errorf("%s: unsupported parameter location %q", op.OperationID, param.In)
+			}
+			cp := clientParam{Name: param.Name, GoName: goName(param.Name, false)}
+			if token.IsKeyword(cp.GoName) {
+				cp.GoName += "Param"
+			}
+			switch param.Schema.Type {
+			case "integer":
+				cp.GoType, cp.Format, cp.Set = "uint64", "strconv.FormatUint(%s, 10)", "%s != 0"
+				useStrconv = true
+			case "string":
+				cp.GoType, cp.Format, cp.Set = "string", "%s", "%s != \"\""
+			case "boolean":
+				cp.GoType, cp.Format, cp.Set = "bool", "strconv.FormatBool(%s)", "%s"
+				useStrconv = true
+			default:
+				return nil, fmt.Errorf("%s: unsupported type %q of parameter %q", op.OperationID, param.Schema.Type, param.Name)
+			}
+			if param.Required {
+				cp.Set = ""
+			}
+			m.Params = append(m.Params, cp)
+		}
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+
+	b := &bytes.Buffer{}
+	err := clientTemplate.Execute(b, struct {
+		Generator, Title, Package string
+		Strconv, IO               bool
+		Methods                   []clientMethod
+	}{
+		Generator: generator,
+		Title:     d.Info.Title,
+		Package:   pkg,
+		Strconv:   useStrconv,
+		IO:        useIO,
+		Methods:   methods,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(b.Bytes())
+}
+
+// goName converts an identifier such as "getInclusionProof" or "tree_size"
+// to a Go name, which is exported if export is true.
+func goName(id string, export bool) string {
+	var b strings.Builder
+	upper := export
+	for _, r := range id {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteRune('_')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		} else if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
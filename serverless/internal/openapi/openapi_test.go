@@ -0,0 +1,108 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func doc(params ...Parameter) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: "Test", Version: "1"},
+		Paths: map[string]map[string]Operation{
+			"/thing/get": {"get": {OperationID: "get-thing", Summary: "Gets a thing.", Parameters: params}},
+			"/thing/put": {"put": {OperationID: "putThing"}},
+		},
+	}
+}
+
+func TestGenerateGoClient(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		params  []Parameter
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc: "no params",
+			want: []string{"func (c *Client) GetThing(ctx context.Context) ([]byte, error)", `c.get(ctx, "thing/get", q)`, "// GetThing gets a thing."},
+		}, {
+			desc:   "params",
+			params: []Parameter{{Name: "tree_size", In: "query", Required: true, Schema: Schema{Type: "integer"}}, {Name: "type", In: "query", Required: true, Schema: Schema{Type: "string"}}},
+			want:   []string{"GetThing(ctx context.Context, treeSize uint64, typeParam string)", "\tq.Set(\"tree_size\", strconv.FormatUint(treeSize, 10))", "\tq.Set(\"type\", typeParam)"},
+		}, {
+			desc:   "optional params",
+			params: []Parameter{{Name: "wait", In: "query", Schema: Schema{Type: "boolean"}}, {Name: "from", In: "query", Schema: Schema{Type: "integer"}}},
+			want:   []string{"GetThing(ctx context.Context, wait bool, from uint64)", "if wait {\n\t\tq.Set(\"wait\", strconv.FormatBool(wait))", "if from != 0 {"},
+		}, {
+			desc:    "path param",
+			params:  []Parameter{{Name: "id", In: "path", Schema: Schema{Type: "string"}}},
+			wantErr: true,
+		}, {
+			desc:    "unsupported type",
+			params:  []Parameter{{Name: "ids", In: "query", Schema: Schema{Type: "array"}}},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			src, err := GenerateGoClient(doc(test.params...), "thing", "test")
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("GenerateGoClient: %v, wantErr %t", err, test.wantErr)
+			}
+			for _, w := range test.want {
+				if !strings.Contains(string(src), w) {
+					t.Errorf("Generated client doesn't contain %q:\n%s", w, src)
+				}
+			}
+			if strings.Contains(string(src), "PutThing") {
+				t.Error("Generated client has method for PUT operation")
+			}
+		})
+	}
+}
+
+func TestGenerateGoClientStreaming(t *testing.T) {
+	d := doc()
+	d.Paths["/thing/follow"] = map[string]Operation{"get": {OperationID: "followThing", Summary: "Follows a thing.", Streaming: true}}
+	src, err := GenerateGoClient(d, "thing", "test")
+	if err != nil {
+		t.Fatalf("GenerateGoClient: %v", err)
+	}
+	for _, w := range []string{
+		"func (c *Client) FollowThing(ctx context.Context) (io.ReadCloser, error)",
+		`c.stream(ctx, "thing/follow", q)`,
+		"func (c *Client) GetThing(ctx context.Context) ([]byte, error)",
+		`"io"`,
+	} {
+		if !strings.Contains(string(src), w) {
+			t.Errorf("Generated client doesn't contain %q:\n%s", w, src)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	raw, err := doc().Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if _, err := Parse(raw); err != nil {
+		t.Errorf("Parse: %v", err)
+	}
+	if _, err := Parse([]byte(`{"openapi": "2.0"}`)); err == nil {
+		t.Error("Parse accepted unsupported version")
+	}
+}
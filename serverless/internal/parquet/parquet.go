@@ -0,0 +1,268 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package parquet writes flat tables in the Apache Parquet file format.
+//
+// Only as much of the format as is needed to export log entries is
+// supported: a file holds a single row group, each column is written as a
+// single uncompressed data page with PLAIN encoding, and columns are either
+// INT64 or BYTE_ARRAY, required or optional. Such files can be read by any
+// Parquet implementation.
+//
+// See https://github.com/apache/parquet-format for the format.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// magic starts and ends every Parquet file.
+const magic = "PAR1"
+
+// createdBy is recorded as the writer of files in their metadata.
+const createdBy = "trillian-examples serverless"
+
+// Type is the physical type of the values of a column.
+type Type int32
+
+// Supported physical types, numbered as in the Parquet format.
+const (
+	Int64     Type = 2
+	ByteArray Type = 6
+)
+
+// ConvertedType annotates a physical type with how its values should be
+// interpreted.
+type ConvertedType int
+
+// Supported annotations.
+const (
+	// None leaves the values uninterpreted.
+	None ConvertedType = iota
+	// UTF8 marks a ByteArray column as holding strings.
+	UTF8
+	// Uint64 marks an Int64 column as holding unsigned integers.
+	Uint64
+)
+
+// convertedTypes numbers the annotations as in the Parquet format.
+var convertedTypes = map[ConvertedType]int32{
+	UTF8:   0,
+	Uint64: 14,
+}
+
+// Enum values of the Parquet format used when writing files.
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageTypeData       = 0
+)
+
+// Column is a named column of a table, holding one value per row.
+type Column struct {
+	Name string
+	Type Type
+	// ConvertedType is the annotation of the column, if any.
+	ConvertedType ConvertedType
+	// Optional columns may hold nulls, represented by nil ByteArrays.
+	Optional bool
+	// Int64s holds the values of an Int64 column.
+	Int64s []int64
+	// ByteArrays holds the values of a ByteArray column.
+	ByteArrays [][]byte
+}
+
+// rows returns the number of values in the column.
+func (c Column) rows() int {
+	if c.Type == Int64 {
+		return len(c.Int64s)
+	}
+	return len(c.ByteArrays)
+}
+
+// chunk is a column chunk which has been written to a file.
+type chunk struct {
+	col    Column
+	offset int64
+	size   int64
+}
+
+// Write writes a Parquet file holding the given columns to w.
+// All columns must hold the same number of rows.
+func Write(w io.Writer, columns []Column) error {
+	if len(columns) == 0 {
+		return errors.New("no columns")
+	}
+	rows := columns[0].rows()
+	for _, c := range columns {
+		if c.Type != Int64 && c.Type != ByteArray {
+			return fmt.Errorf("column %q has unsupported type %d", c.Name, c.Type)
+		}
+		if c.Type == Int64 && c.Optional {
+			return fmt.Errorf("column %q: optional Int64 columns aren't supported", c.Name)
+		}
+		if n := c.rows(); n != rows {
+			return fmt.Errorf("column %q has %d rows, want %d", c.Name, n, rows)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(magic)
+	chunks := make([]chunk, 0, len(columns))
+	for _, c := range columns {
+		offset := int64(buf.Len())
+		writeChunk(buf, c, rows)
+		chunks = append(chunks, chunk{col: c, offset: offset, size: int64(buf.Len()) - offset})
+	}
+	meta := fileMetaData(chunks, rows)
+	buf.Write(meta)
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(meta))); err != nil {
+		return err
+	}
+	buf.WriteString(magic)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeChunk writes the column chunk holding c, as a single data page, to buf.
+func writeChunk(buf *bytes.Buffer, c Column, rows int) {
+	page := &bytes.Buffer{}
+	if c.Optional {
+		levels := make([]bool, rows)
+		for i, v := range c.ByteArrays {
+			levels[i] = v != nil
+		}
+		writeDefinitionLevels(page, levels)
+	}
+	var b [8]byte
+	switch c.Type {
+	case Int64:
+		for _, v := range c.Int64s {
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+			page.Write(b[:])
+		}
+	case ByteArray:
+		for _, v := range c.ByteArrays {
+			if v == nil && c.Optional {
+				continue
+			}
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+			page.Write(b[:4])
+			page.Write(v)
+		}
+	}
+
+	e := newEncoder()
+	e.i32(1, pageTypeData)
+	e.i32(2, int32(page.Len()))
+	e.i32(3, int32(page.Len()))
+	e.beginStruct(5)
+	e.i32(1, int32(rows))
+	e.i32(2, encodingPlain)
+	e.i32(3, encodingRLE)
+	e.i32(4, encodingRLE)
+	e.endStruct()
+	buf.Write(e.finish())
+	buf.Write(page.Bytes())
+}
+
+// writeDefinitionLevels writes the definition levels of an optional column,
+// true for each row which holds a value, using the length-prefixed RLE
+// hybrid encoding with a bit width of 1. Only RLE runs are used.
+func writeDefinitionLevels(page *bytes.Buffer, defined []bool) {
+	runs := &bytes.Buffer{}
+	var b [binary.MaxVarintLen64]byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		n := binary.PutUvarint(b[:], uint64(j-i)<<1)
+		runs.Write(b[:n])
+		if defined[i] {
+			runs.WriteByte(1)
+		} else {
+			runs.WriteByte(0)
+		}
+		i = j
+	}
+	binary.LittleEndian.PutUint32(b[:4], uint32(runs.Len()))
+	page.Write(b[:4])
+	page.Write(runs.Bytes())
+}
+
+// fileMetaData returns the encoded footer of a file holding chunks.
+func fileMetaData(chunks []chunk, rows int) []byte {
+	e := newEncoder()
+	e.i32(1, 1)
+	// The schema is flattened depth first, starting with the root.
+	e.beginList(2, typeStruct, len(chunks)+1)
+	e.beginElement()
+	e.string(4, "schema")
+	e.i32(5, int32(len(chunks)))
+	e.endStruct()
+	for _, c := range chunks {
+		e.beginElement()
+		e.i32(1, int32(c.col.Type))
+		if c.col.Optional {
+			e.i32(3, repetitionOptional)
+		} else {
+			e.i32(3, repetitionRequired)
+		}
+		e.string(4, c.col.Name)
+		if ct, ok := convertedTypes[c.col.ConvertedType]; ok {
+			e.i32(6, ct)
+		}
+		e.endStruct()
+	}
+	e.i64(3, int64(rows))
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+	e.beginList(4, typeStruct, 1)
+	e.beginElement()
+	e.beginList(1, typeStruct, len(chunks))
+	for _, c := range chunks {
+		e.beginElement()
+		e.i64(2, c.offset)
+		e.beginStruct(3)
+		e.i32(1, int32(c.col.Type))
+		e.beginList(2, typeI32, 2)
+		e.elementI32(encodingPlain)
+		e.elementI32(encodingRLE)
+		e.beginList(3, typeBinary, 1)
+		e.elementString(c.col.Name)
+		e.i32(4, codecUncompressed)
+		e.i64(5, int64(rows))
+		e.i64(6, c.size)
+		e.i64(7, c.size)
+		e.i64(9, c.offset)
+		e.endStruct()
+		e.endStruct()
+	}
+	e.i64(2, total)
+	e.i64(3, int64(rows))
+	e.endStruct()
+	e.string(6, createdBy)
+	return e.finish()
+}
@@ -0,0 +1,277 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// value is a decoded Thrift value: an int64, []byte, []value, or fields.
+type value interface{}
+
+// fields is a decoded Thrift struct, keyed by field ID.
+type fields map[int16]value
+
+// decoder reads the Thrift compact protocol, independently of encoder.
+type decoder struct {
+	b []byte
+}
+
+func (d *decoder) byte() byte {
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		panic("bad varint")
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) value(typ byte) value {
+	switch typ {
+	case typeI32, typeI64:
+		u := d.uvarint()
+		return int64(u>>1) ^ -int64(u&1)
+	case typeBinary:
+		n := d.uvarint()
+		v := d.b[:n]
+		d.b = d.b[n:]
+		return v
+	case typeList:
+		h := d.byte()
+		n, et := uint64(h>>4), h&0x0f
+		if n == 15 {
+			n = d.uvarint()
+		}
+		l := []value{}
+		for i := uint64(0); i < n; i++ {
+			l = append(l, d.value(et))
+		}
+		return l
+	case typeStruct:
+		s := fields{}
+		var id int16
+		for {
+			h := d.byte()
+			if h == 0 {
+				return s
+			}
+			if delta := int16(h >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(d.value(typeI32).(int64))
+			}
+			s[id] = d.value(h & 0x0f)
+		}
+	}
+	panic(fmt.Sprintf("unsupported type %d", typ))
+}
+
+// read decodes the file f, written by Write, returning its schema as
+// name:type:repetition:converted_type strings and its values by column.
+func read(t *testing.T, f []byte) ([]string, map[string][]value) {
+	t.Helper()
+	if !bytes.HasPrefix(f, []byte(magic)) || !bytes.HasSuffix(f, []byte(magic)) {
+		t.Fatalf("file isn't delimited by %q", magic)
+	}
+	n := binary.LittleEndian.Uint32(f[len(f)-8:])
+	d := &decoder{b: f[len(f)-8-int(n) : len(f)-8]}
+	meta := d.value(typeStruct).(fields)
+	if len(d.b) != 0 {
+		t.Fatalf("%d bytes follow the metadata", len(d.b))
+	}
+	if got := meta[1]; got != int64(1) {
+		t.Errorf("version %v, want 1", got)
+	}
+	rows := meta[3].(int64)
+
+	var schema []string
+	for _, v := range meta[2].([]value)[1:] {
+		e := v.(fields)
+		schema = append(schema, fmt.Sprintf("%s:%v:%v:%v", e[4], e[1], e[3], e[6]))
+	}
+
+	cols := map[string][]value{}
+	rgs := meta[4].([]value)
+	if len(rgs) != 1 {
+		t.Fatalf("%d row groups, want 1", len(rgs))
+	}
+	rg := rgs[0].(fields)
+	if got := rg[3]; got != rows {
+		t.Errorf("row group has %v rows, want %d", got, rows)
+	}
+	for _, c := range rg[1].([]value) {
+		cm := c.(fields)[3].(fields)
+		name := string(cm[3].([]value)[0].([]byte))
+		if got := cm[5]; got != rows {
+			t.Errorf("column %s has %v values, want %d", name, got, rows)
+		}
+		off, size := cm[9].(int64), cm[7].(int64)
+		d := &decoder{b: f[off : off+size]}
+		ph := d.value(typeStruct).(fields)
+		if got, want := ph[2], int64(len(d.b)); got != want {
+			t.Errorf("column %s page size %v, want %d", name, got, want)
+		}
+		dph := ph[5].(fields)
+		if got := dph[1]; got != rows {
+			t.Errorf("column %s page has %v values, want %d", name, got, rows)
+		}
+		page := d.b
+
+		// Definition levels are only present in optional columns.
+		defined := make([]bool, rows)
+		for i := range defined {
+			defined[i] = true
+		}
+		schemaElem := meta[2].([]value)[len(cols)+1].(fields)
+		if schemaElem[3] == int64(repetitionOptional) {
+			n := binary.LittleEndian.Uint32(page)
+			ld := &decoder{b: page[4 : 4+n]}
+			page = page[4+n:]
+			defined = defined[:0]
+			for len(ld.b) > 0 {
+				h := ld.uvarint()
+				if h&1 != 0 {
+					t.Fatalf("column %s uses bit-packed levels", name)
+				}
+				v := ld.byte() == 1
+				for i := uint64(0); i < h>>1; i++ {
+					defined = append(defined, v)
+				}
+			}
+			if int64(len(defined)) != rows {
+				t.Fatalf("column %s has %d definition levels, want %d", name, len(defined), rows)
+			}
+		}
+		var vals []value
+		for _, def := range defined {
+			switch {
+			case !def:
+				vals = append(vals, nil)
+			case cm[1] == int64(Int64):
+				vals = append(vals, int64(binary.LittleEndian.Uint64(page)))
+				page = page[8:]
+			default:
+				n := binary.LittleEndian.Uint32(page)
+				vals = append(vals, string(page[4:4+n]))
+				page = page[4+n:]
+			}
+		}
+		if len(page) != 0 {
+			t.Errorf("column %s has %d trailing bytes", name, len(page))
+		}
+		cols[name] = vals
+	}
+	return schema, cols
+}
+
+func TestWrite(t *testing.T) {
+	// Long enough for the run lengths to need multi-byte varints.
+	const rows = 200
+	var (
+		index  []int64
+		hashes [][]byte
+		sparse [][]byte
+	)
+	wantIndex, wantHashes, wantSparse := []value{}, []value{}, []value{}
+	for i := 0; i < rows; i++ {
+		index = append(index, int64(i))
+		wantIndex = append(wantIndex, int64(i))
+		h := fmt.Sprintf("hash %d", i)
+		hashes = append(hashes, []byte(h))
+		wantHashes = append(wantHashes, h)
+		// A single value, then alternating runs of nulls and empty values.
+		switch {
+		case i == 0:
+			sparse = append(sparse, []byte("first"))
+			wantSparse = append(wantSparse, "first")
+		case i/70%2 == 0:
+			sparse = append(sparse, nil)
+			wantSparse = append(wantSparse, nil)
+		default:
+			sparse = append(sparse, []byte{})
+			wantSparse = append(wantSparse, "")
+		}
+	}
+
+	b := &bytes.Buffer{}
+	if err := Write(b, []Column{
+		{Name: "index", Type: Int64, ConvertedType: Uint64, Int64s: index},
+		{Name: "hash", Type: ByteArray, ByteArrays: hashes},
+		{Name: "sparse", Type: ByteArray, ConvertedType: UTF8, Optional: true, ByteArrays: sparse},
+	}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	schema, cols := read(t, b.Bytes())
+	wantSchema := []string{"index:2:0:14", "hash:6:0:<nil>", "sparse:6:1:0"}
+	if diff := cmp.Diff(wantSchema, schema); len(diff) != 0 {
+		t.Errorf("schema had diff %s", diff)
+	}
+	want := map[string][]value{"index": wantIndex, "hash": wantHashes, "sparse": wantSparse}
+	if diff := cmp.Diff(want, cols); len(diff) != 0 {
+		t.Errorf("columns had diff %s", diff)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := Write(b, []Column{{Name: "payload", Type: ByteArray, Optional: true}}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	_, cols := read(t, b.Bytes())
+	if got := len(cols["payload"]); got != 0 {
+		t.Errorf("got %d values, want none", got)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		columns []Column
+	}{
+		{desc: "no columns"},
+		{
+			desc: "unequal rows",
+			columns: []Column{
+				{Name: "a", Type: Int64, Int64s: []int64{1, 2}},
+				{Name: "b", Type: ByteArray, ByteArrays: [][]byte{{1}}},
+			},
+		},
+		{
+			desc:    "optional int64",
+			columns: []Column{{Name: "a", Type: Int64, Optional: true, Int64s: []int64{1}}},
+		},
+		{
+			desc:    "unsupported type",
+			columns: []Column{{Name: "a", Type: 1}},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := Write(&bytes.Buffer{}, test.columns); err == nil {
+				t.Error("Write: got no error")
+			}
+		})
+	}
+}
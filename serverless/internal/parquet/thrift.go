@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Types of the Thrift compact protocol, in which Parquet metadata is encoded.
+const (
+	typeI32    = 5
+	typeI64    = 6
+	typeBinary = 8
+	typeList   = 9
+	typeStruct = 12
+)
+
+// encoder writes a Thrift struct using the compact protocol.
+//
+// See https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+type encoder struct {
+	buf bytes.Buffer
+	// lastID holds the ID of the last field written in each of the structs
+	// being written, innermost last, as field IDs are delta encoded.
+	lastID []int16
+}
+
+func newEncoder() *encoder {
+	return &encoder{lastID: []int16{0}}
+}
+
+// finish ends the outermost struct and returns the encoding.
+func (e *encoder) finish() []byte {
+	e.endStruct()
+	return e.buf.Bytes()
+}
+
+func (e *encoder) fieldHeader(id int16, typ byte) {
+	last := &e.lastID[len(e.lastID)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		e.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		e.buf.WriteByte(typ)
+		e.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes v zigzag encoded, as are all integers in the compact protocol.
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (e *encoder) i32(id int16, v int32) {
+	e.fieldHeader(id, typeI32)
+	e.varint(int64(v))
+}
+
+func (e *encoder) i64(id int16, v int64) {
+	e.fieldHeader(id, typeI64)
+	e.varint(v)
+}
+
+func (e *encoder) string(id int16, v string) {
+	e.fieldHeader(id, typeBinary)
+	e.elementString(v)
+}
+
+// beginStruct starts a struct field, which must be ended with endStruct.
+func (e *encoder) beginStruct(id int16) {
+	e.fieldHeader(id, typeStruct)
+	e.beginElement()
+}
+
+// beginElement starts a struct element of a list, which must be ended with
+// endStruct.
+func (e *encoder) beginElement() {
+	e.lastID = append(e.lastID, 0)
+}
+
+func (e *encoder) endStruct() {
+	e.buf.WriteByte(0)
+	e.lastID = e.lastID[:len(e.lastID)-1]
+}
+
+// beginList starts a list field of n elements of the given type, which must
+// be followed by exactly n elements.
+func (e *encoder) beginList(id int16, typ byte, n int) {
+	e.fieldHeader(id, typeList)
+	if n < 15 {
+		e.buf.WriteByte(byte(n)<<4 | typ)
+	} else {
+		e.buf.WriteByte(0xf0 | typ)
+		e.uvarint(uint64(n))
+	}
+}
+
+func (e *encoder) elementI32(v int32) {
+	e.varint(int64(v))
+}
+
+func (e *encoder) elementString(v string) {
+	e.uvarint(uint64(len(v)))
+	e.buf.WriteString(v)
+}
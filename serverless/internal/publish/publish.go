@@ -0,0 +1,220 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package publish provides publishers which push a log's latest checkpoint to
+// channels other than the log itself, such as a DNS TXT record. Each channel
+// is controlled separately from the log's storage, so a log which presents
+// different views to different clients must also keep every channel in step
+// with each view, which clients comparing the channels can detect.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/formats/log"
+)
+
+// Publisher publishes checkpoints to a single channel.
+type Publisher interface {
+	// Publish publishes cp, whose signed note is raw, replacing whatever
+	// was published before.
+	Publish(ctx context.Context, cp log.Checkpoint, raw []byte) error
+}
+
+// Digest returns the digest of cp which is published in channels which can't
+// hold the whole checkpoint.
+func Digest(cp log.Checkpoint) api.CheckpointDigest {
+	return api.CheckpointDigest{Size: cp.Size, Hash: cp.Hash}
+}
+
+// WellKnownFile publishes the signed checkpoint to a file served by a web
+// server other than the log's, conventionally at
+// /.well-known/serverless-checkpoint.
+type WellKnownFile struct {
+	// Path is the location of the file, e.g.
+	// /var/www/html/.well-known/serverless-checkpoint.
+	Path string
+}
+
+// Publish atomically replaces the file with raw.
+func (w WellKnownFile) Publish(_ context.Context, _ log.Checkpoint, raw []byte) error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(w.Path), filepath.Base(w.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), w.Path)
+}
+
+// DefaultCloudflareURL is the root of the Cloudflare v4 API.
+const DefaultCloudflareURL = "https://api.cloudflare.com/client/v4/"
+
+// CloudflareTXT publishes the checkpoint's digest to an existing DNS TXT
+// record of a zone hosted by Cloudflare, which clients look up with their own
+// resolver.
+type CloudflareTXT struct {
+	// Token is an API token with permission to edit the zone's DNS records.
+	Token string
+	// ZoneID and RecordID identify the TXT record, which must already
+	// exist, and Name is its fully qualified name.
+	ZoneID, RecordID, Name string
+	// TTL is the record's time to live in seconds, or 1 for Cloudflare's
+	// automatic TTL. Clients may see the previous digest for this long.
+	TTL int
+	// BaseURL is the root of the API, or DefaultCloudflareURL if empty.
+	BaseURL string
+	// Client makes the requests, or http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Publish replaces the contents of the TXT record with the digest of cp.
+func (c CloudflareTXT) Publish(ctx context.Context, cp log.Checkpoint, _ []byte) error {
+	base := c.BaseURL
+	if len(base) == 0 {
+		base = DefaultCloudflareURL
+	}
+	root, err := url.Parse(base)
+	if err != nil {
+		return fmt.Errorf("invalid API URL: %w", err)
+	}
+	u, err := root.Parse(fmt.Sprintf("zones/%s/dns_records/%s", url.PathEscape(c.ZoneID), url.PathEscape(c.RecordID)))
+	if err != nil {
+		return err
+	}
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = 1
+	}
+	body, err := json.Marshal(struct {
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Content string `json:"content"`
+		TTL     int    `json:"ttl"`
+	}{Type: "TXT", Name: c.Name, Content: Digest(cp).Marshal(), TTL: ttl})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	respBody, err := do(c.Client, req)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !resp.Success {
+		return fmt.Errorf("failed to update TXT record %q: %+v", c.Name, resp.Errors)
+	}
+	return nil
+}
+
+// Webhook publishes the checkpoint's digest as a status update, by posting it
+// to a URL in the JSON form accepted by many chat and microblogging services.
+// The post has a "text" field for humans, and "origin", "size" and "hash"
+// fields for machines.
+type Webhook struct {
+	URL string
+	// Token, if set, is sent as a bearer token.
+	Token string
+	// Client makes the requests, or http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Publish posts the digest of cp to the webhook.
+func (w Webhook) Publish(ctx context.Context, cp log.Checkpoint, _ []byte) error {
+	hash := base64.StdEncoding.EncodeToString(cp.Hash)
+	body, err := json.Marshal(struct {
+		Text   string `json:"text"`
+		Origin string `json:"origin"`
+		Size   uint64 `json:"size"`
+		Hash   string `json:"hash"`
+	}{
+		Text:   fmt.Sprintf("%s\n%s", cp.Origin, Digest(cp).Marshal()),
+		Origin: cp.Origin,
+		Size:   cp.Size,
+		Hash:   hash,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if len(w.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = do(w.Client, req)
+	return err
+}
+
+// maxResponseSize is the largest response body read from a publishing API.
+const maxResponseSize = 1 << 20
+
+// do makes the request with c, or http.DefaultClient if nil, and returns the
+// body of a successful response.
+func do(c *http.Client, req *http.Request) ([]byte, error) {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: unexpected http status %d: %s", req.Method, req.URL.Redacted(), resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
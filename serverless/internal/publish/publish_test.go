@@ -0,0 +1,122 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/transparency-dev/formats/log"
+)
+
+var testCP = log.Checkpoint{Origin: "Test Log", Size: 7, Hash: make([]byte, 32)}
+
+func TestWellKnownFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), ".well-known", "serverless-checkpoint")
+	w := WellKnownFile{Path: p}
+	for _, raw := range []string{"first", "second"} {
+		if err := w.Publish(context.Background(), testCP, []byte(raw)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if string(got) != raw {
+			t.Errorf("Published %q, want %q", got, raw)
+		}
+	}
+}
+
+func TestCloudflareTXT(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		status  int
+		resp    string
+		wantErr bool
+	}{
+		{
+			desc:   "updated",
+			status: http.StatusOK,
+			resp:   `{"success": true, "errors": []}`,
+		}, {
+			desc:    "unsuccessful",
+			status:  http.StatusOK,
+			resp:    `{"success": false, "errors": [{"code": 81058, "message": "An identical record already exists."}]}`,
+			wantErr: true,
+		}, {
+			desc:    "unauthorized",
+			status:  http.StatusForbidden,
+			resp:    `{"success": false}`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got struct {
+				Type, Name, Content string
+			}
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != "/zones/zone/dns_records/record" {
+					t.Errorf("Got %s %s", r.Method, r.URL.Path)
+				}
+				if got, want := r.Header.Get("Authorization"), "Bearer token"; got != want {
+					t.Errorf("Got Authorization %q, want %q", got, want)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("Decode: %v", err)
+				}
+				w.WriteHeader(test.status)
+				io.WriteString(w, test.resp)
+			}))
+			defer s.Close()
+
+			c := CloudflareTXT{Token: "token", ZoneID: "zone", RecordID: "record", Name: "_checkpoint.example.com", BaseURL: s.URL + "/"}
+			err := c.Publish(context.Background(), testCP, nil)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Publish: %v, want error %t", err, test.wantErr)
+			}
+			if got.Type != "TXT" || got.Name != c.Name || got.Content != Digest(testCP).Marshal() {
+				t.Errorf("Got record %+v, want TXT %q with digest", got, c.Name)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got struct {
+		Text   string
+		Origin string
+		Size   uint64
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Decode: %v", err)
+		}
+	}))
+	defer s.Close()
+
+	if err := (Webhook{URL: s.URL}).Publish(context.Background(), testCP, nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got.Origin != testCP.Origin || got.Size != testCP.Size || len(got.Text) == 0 {
+		t.Errorf("Got post %+v, want checkpoint of size %d", got, testCP.Size)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replica keeps copies of a serverless log stored on a local
+// filesystem in other locations, e.g. buckets in other regions mounted as
+// directories, which clients can fail over to when the log is unavailable.
+//
+// A replica is only ever published complete: its checkpoint is written after
+// every file it commits to has been copied and verified in the replica.
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/backup"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	dirPerm  = 0755
+	filePerm = 0644
+
+	// verifyBatchSize is the number of entries verified against the
+	// checkpoint at a time.
+	verifyBatchSize = 1024
+)
+
+// Stats describes the work done to update a replica.
+type Stats struct {
+	// Files is the number of files in the log, other than its checkpoint.
+	Files int
+	// Copied is the number of files copied to the replica, since it didn't
+	// have them or they'd changed.
+	Copied int
+	// Removed is the number of files removed from the replica, since they'd
+	// been removed from the log, e.g. the data of redacted entries.
+	Removed int
+}
+
+// Replicate brings the replica of the log in logDir held in replicaDir up to
+// date with the log's checkpoint, which is verified with v.
+//
+// The checkpoint must be consistent with the one the replica already has, if
+// any, so that a log which has been tampered with doesn't overwrite a good
+// replica. Every other file of the log is then copied, except immutable files
+// the replica already has, and files removed from the log are removed from
+// the replica. Before the checkpoint is written, the replica's copies are
+// verified: the checkpoint must be consistent with the replica's previous one
+// using the replica's tiles, and the entries added since must be committed to
+// by it.
+func Replicate(ctx context.Context, logDir, replicaDir string, h merkle.LogHasher, v note.Verifier, origin string) (*fmtlog.Checkpoint, *Stats, error) {
+	f := client.NewFSFetcher(os.DirFS(logDir))
+	cp, cpRaw, _, err := client.FetchCheckpoint(ctx, f, v, origin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	rf := client.NewFSFetcher(os.DirFS(replicaDir))
+	prev, _, _, err := client.FetchCheckpoint(ctx, rf, v, origin)
+	if errors.Is(err, os.ErrNotExist) {
+		prev = nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to read replica checkpoint: %w", err)
+	}
+	begin := uint64(0)
+	if prev != nil {
+		if prev.Size > cp.Size {
+			return nil, nil, fmt.Errorf("log has size %d, smaller than replica size %d", cp.Size, prev.Size)
+		}
+		if prev.Size > 0 {
+			if err := client.CheckConsistency(ctx, h, f, []fmtlog.Checkpoint{*prev, *cp}); err != nil {
+				return nil, nil, fmt.Errorf("log is not consistent with replica at size %d: %w", prev.Size, err)
+			}
+		}
+		begin = prev.Size
+	}
+
+	stats, err := copyFiles(ctx, logDir, replicaDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if prev != nil && prev.Size > 0 {
+		if err := client.CheckConsistency(ctx, h, rf, []fmtlog.Checkpoint{*prev, *cp}); err != nil {
+			return nil, nil, fmt.Errorf("replica is not consistent with its previous checkpoint at size %d: %w", prev.Size, err)
+		}
+	}
+	for ; begin < cp.Size; begin += verifyBatchSize {
+		end := begin + verifyBatchSize
+		if end > cp.Size {
+			end = cp.Size
+		}
+		if _, err := client.FetchVerifiedLeaves(ctx, rf, h, *cp, begin, end); err != nil {
+			return nil, nil, fmt.Errorf("failed to verify replicated entries [%d, %d): %w", begin, end, err)
+		}
+	}
+
+	if err := writeFile(filepath.Join(replicaDir, layout.CheckpointPath), cpRaw); err != nil {
+		return nil, nil, fmt.Errorf("failed to write replica checkpoint: %w", err)
+	}
+	glog.V(1).Infof("Replicated log at size %d to %q: %+v", cp.Size, replicaDir, stats)
+	return cp, stats, nil
+}
+
+// copyFiles copies the files of the log in logDir other than its checkpoint
+// to replicaDir, and removes those which are no longer in the log.
+func copyFiles(ctx context.Context, logDir, replicaDir string) (*Stats, error) {
+	stats := &Stats{}
+	inLog := make(map[string]bool)
+	err := walk(ctx, logDir, func(p, fp string) error {
+		inLog[p] = true
+		stats.Files++
+		rp := filepath.Join(replicaDir, filepath.FromSlash(p))
+		if immutable(p) {
+			if _, err := os.Stat(rp); err == nil {
+				return nil
+			}
+		}
+		// Partial tiles may be symlinks to the full tile, so this follows
+		// them, and the replica has a copy of it instead.
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", p, err)
+		}
+		if old, err := os.ReadFile(rp); err == nil && bytes.Equal(old, data) {
+			return nil
+		}
+		if err := writeFile(rp, data); err != nil {
+			return fmt.Errorf("failed to copy %q: %w", p, err)
+		}
+		stats.Copied++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy log: %w", err)
+	}
+	err = walk(ctx, replicaDir, func(p, fp string) error {
+		if inLog[p] {
+			return nil
+		}
+		if err := os.Remove(fp); err != nil {
+			return fmt.Errorf("failed to remove %q: %w", p, err)
+		}
+		stats.Removed++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove files from replica: %w", err)
+	}
+	return stats, nil
+}
+
+// walk calls fn with the slash-separated path, relative to dir, and the file
+// path of each file of the log in dir other than its checkpoint, skipping
+// those which backup.Skip reports aren't part of the log.
+func walk(ctx context.Context, dir string, fn func(p, fp string) error) error {
+	return filepath.WalkDir(dir, func(fp string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fp)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		if p == "." {
+			return nil
+		}
+		if backup.Skip(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || p == layout.CheckpointPath {
+			return nil
+		}
+		return fn(p, fp)
+	})
+}
+
+// immutable returns true if the file at p never changes once written, so
+// needn't be copied again if the replica has it. Partial tiles are excluded,
+// since without the immutable layout they're replaced by links to the full
+// tile once it's written.
+func immutable(p string) bool {
+	if !layout.Immutable(p) {
+		return false
+	}
+	_, _, partial, err := layout.ParseTilePath(p)
+	return err != nil || partial == 0
+}
+
+// writeFile atomically replaces the file at p with one containing data,
+// creating its directory if necessary.
+func writeFile(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), dirPerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
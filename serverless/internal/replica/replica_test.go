@@ -0,0 +1,129 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replica
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/testlog"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const origin = "Replica Test Log"
+
+// replicaSize returns the size of the checkpoint of the replica in dir.
+func replicaSize(t *testing.T, dir string, v note.Verifier) uint64 {
+	t.Helper()
+	cp, _, _, err := client.FetchCheckpoint(context.Background(), client.NewFSFetcher(os.DirFS(dir)), v, origin)
+	if err != nil {
+		t.Fatalf("FetchCheckpoint: %v", err)
+	}
+	return cp.Size
+}
+
+func TestReplicate(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	replicaDir := filepath.Join(t.TempDir(), "replica")
+
+	l.Grow(t, 300)
+	cp, stats, err := Replicate(ctx, l.Dir, replicaDir, h, l.V, origin)
+	if err != nil {
+		t.Fatalf("Replicate: %v", err)
+	}
+	if cp.Size != 300 || stats.Copied != stats.Files {
+		t.Errorf("First replication at size %d has stats %+v, want size 300 and every file copied", cp.Size, stats)
+	}
+
+	// Only the new entries and the new partial tile need to be copied.
+	l.Grow(t, 10)
+	if _, stats, err = Replicate(ctx, l.Dir, replicaDir, h, l.V, origin); err != nil {
+		t.Fatalf("Replicate: %v", err)
+	}
+	if got, want := stats.Copied, 3*10+1; got != want {
+		t.Errorf("Second replication copied %d files, want %d", got, want)
+	}
+	if got := replicaSize(t, replicaDir, l.V); got != 310 {
+		t.Errorf("Replica has size %d, want 310", got)
+	}
+
+	// Files removed from the log are removed from the replica.
+	d, f := layout.SeqPath(l.Dir, 7)
+	if err := os.Remove(filepath.Join(d, f)); err != nil {
+		t.Fatal(err)
+	}
+	if _, stats, err = Replicate(ctx, l.Dir, replicaDir, h, l.V, origin); err != nil {
+		t.Fatalf("Replicate: %v", err)
+	}
+	if stats.Copied != 0 || stats.Removed != 1 {
+		t.Errorf("Third replication has stats %+v, want nothing copied and one file removed", stats)
+	}
+	d, f = layout.SeqPath(replicaDir, 7)
+	if _, err := os.Stat(filepath.Join(d, f)); !os.IsNotExist(err) {
+		t.Errorf("Removed file still in replica: %v", err)
+	}
+}
+
+func TestReplicateRejectsInconsistentLog(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	replicaDir := t.TempDir()
+	l.Grow(t, 20)
+	if _, _, err := Replicate(ctx, l.Dir, replicaDir, h, l.V, origin); err != nil {
+		t.Fatalf("Replicate: %v", err)
+	}
+
+	// Replace the log with a different one, signed with the same key.
+	other := testlog.New(t, origin)
+	other.Prefix, other.S, other.V = "other ", l.S, l.V
+	other.Grow(t, 30)
+	if _, _, err := Replicate(ctx, other.Dir, replicaDir, h, l.V, origin); err == nil {
+		t.Error("Replicate of inconsistent log succeeded, want error")
+	}
+	if got := replicaSize(t, replicaDir, l.V); got != 20 {
+		t.Errorf("Replica has size %d after failed replication, want 20", got)
+	}
+}
+
+func TestReplicateRejectsCorruptEntry(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	l := testlog.New(t, origin)
+	replicaDir := t.TempDir()
+	l.Grow(t, 20)
+	if _, _, err := Replicate(ctx, l.Dir, replicaDir, h, l.V, origin); err != nil {
+		t.Fatalf("Replicate: %v", err)
+	}
+	l.Grow(t, 10)
+	d, f := layout.SeqPath(l.Dir, 25)
+	if err := os.WriteFile(filepath.Join(d, f), []byte("corrupt"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Replicate(ctx, l.Dir, replicaDir, h, l.V, origin); err == nil {
+		t.Error("Replicate of corrupt entry succeeded, want error")
+	}
+	// The replica's checkpoint isn't updated to one it can't back up.
+	if got := replicaSize(t, replicaDir, l.V); got != 20 {
+		t.Errorf("Replica has size %d after failed replication, want 20", got)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// corsMaxAge is how long browsers may cache the result of a preflight
+// request, in seconds.
+const corsMaxAge = 24 * 60 * 60
+
+// WithCORS returns a handler which allows scripts running in web pages from
+// the given origins to read the responses of h, which may then be used to
+// verify the log from a browser. An origin of "*" allows all origins.
+//
+// Since everything served is public, credentials are never allowed.
+func WithCORS(h http.Handler, origins []string) http.Handler {
+	allowAll := false
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		if o == "*" {
+			allowAll = true
+		}
+		allowed[o] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !allowAll {
+			// The response depends on the origin, so caches must not serve it
+			// to requests from other origins.
+			w.Header().Add("Vary", "Origin")
+		}
+		if len(origin) == 0 || !(allowAll || allowed[origin]) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if allowAll {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			// Preflight request.
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", "If-None-Match, Range")
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// Allow conditional requests to be made from scripts.
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		h.ServeHTTP(w, r)
+	})
+}
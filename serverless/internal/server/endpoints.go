@@ -0,0 +1,275 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+//go:generate go run ./gen --openapi=../../api/openapi.json --client=../../client/httpapi/client.gen.go
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/openapi"
+)
+
+const (
+	// LookupPath is the path of the endpoint serving the entries associated
+	// with an identifier, which takes identifier and size query parameters.
+	LookupPath = "/lookup"
+
+	// HealthzPath is the path of the liveness endpoint, which succeeds as
+	// long as the server is running.
+	HealthzPath = "/healthz"
+
+	// ReadyzPath is the path of the readiness endpoint, which succeeds only
+	// if the log can be served.
+	ReadyzPath = "/readyz"
+
+	// CheckpointEventsPath is the path of the endpoint streaming the log's
+	// checkpoints as server-sent events.
+	CheckpointEventsPath = "/checkpoint/events"
+
+	// TailPath is the path of the endpoint streaming the log's entries as
+	// they're integrated, which takes a from query parameter.
+	TailPath = "/tail"
+
+	// OpenAPIPath is the path of the endpoint serving the OpenAPI description
+	// of the server's API.
+	OpenAPIPath = "/openapi.json"
+
+	// APIVersion is the version of the API described by OpenAPI.
+	APIVersion = "1.0.0"
+
+	// Generator names the tool which generates the Go client from the
+	// OpenAPI description, in the header of the generated file.
+	Generator = "serverless/internal/server/gen"
+)
+
+// Param describes a query parameter of an endpoint.
+type Param struct {
+	Name        string
+	Description string
+	// Type is the OpenAPI type of the parameter, either "integer", "string"
+	// or "boolean".
+	Type string
+	// Optional is true if the parameter may be omitted.
+	Optional bool
+}
+
+// Endpoint describes an endpoint of the server's API.
+type Endpoint struct {
+	Path        string
+	OperationID string
+	Summary     string
+	Params      []Param
+	// ContentType is the type of successful responses.
+	ContentType string
+	// Immutable is true if successful responses never change.
+	Immutable bool
+	// Streaming is true if successful responses are streamed until the
+	// client disconnects.
+	Streaming bool
+	// Errors, if set, describes the unsuccessful responses by status code,
+	// in place of the default descriptions of bad requests and missing data.
+	Errors map[int]string
+
+	handler func(*Server, http.ResponseWriter, *http.Request)
+}
+
+// Endpoints returns the endpoints served by Handler, other than the log's
+// files. It is the source of both the routing and the OpenAPI description,
+// so the two can't disagree.
+func Endpoints() []Endpoint {
+	return []Endpoint{
+		{
+			Path:        "/" + layout.CheckpointPath,
+			OperationID: "getCheckpoint",
+			Summary:     "Returns the log's latest signed checkpoint.",
+			Params: []Param{
+				{Name: "wait", Description: "If true, and the current checkpoint has the ETag given by If-None-Match, if any, waits for a new checkpoint to be published before responding, or until the server's long-poll timeout, when the current checkpoint is returned.", Type: "boolean", Optional: true},
+			},
+			ContentType: "text/plain; charset=utf-8",
+			Errors: map[int]string{
+				http.StatusNotModified: "The checkpoint has the ETag given by If-None-Match.",
+				http.StatusBadRequest:  "A parameter is missing or invalid.",
+				http.StatusNotFound:    "The log has no checkpoint.",
+			},
+			handler: (*Server).getCheckpoint,
+		},
+		{
+			Path:        CheckpointEventsPath,
+			OperationID: "getCheckpointEvents",
+			Summary:     "Streams the log's checkpoints as server-sent events, starting with the latest and followed by each new one as it's published. Each event has type checkpoint, its size as ID, and the signed checkpoint as data, without its final newline.",
+			ContentType: "text/event-stream",
+			Streaming:   true,
+			Errors:      map[int]string{},
+			handler:     (*Server).getCheckpointEvents,
+		},
+		{
+			Path:        InclusionProofPath,
+			OperationID: "getInclusionProof",
+			Summary:     "Returns the proof that the leaf at index is included in the tree of the given size, with one base64 encoded hash per line.",
+			Params: []Param{
+				{Name: "index", Description: "Index of the leaf.", Type: "integer"},
+				{Name: "size", Description: "Size of the tree, which must be larger than index.", Type: "integer"},
+			},
+			ContentType: "text/plain; charset=utf-8",
+			Immutable:   true,
+			handler:     (*Server).getInclusionProof,
+		},
+		{
+			Path:        ConsistencyProofPath,
+			OperationID: "getConsistencyProof",
+			Summary:     "Returns the proof that the tree of size from is a prefix of the tree of size to, with one base64 encoded hash per line.",
+			Params: []Param{
+				{Name: "from", Description: "Size of the smaller tree.", Type: "integer"},
+				{Name: "to", Description: "Size of the larger tree.", Type: "integer"},
+			},
+			ContentType: "text/plain; charset=utf-8",
+			Immutable:   true,
+			handler:     (*Server).getConsistencyProof,
+		},
+		{
+			Path:        InclusionProofJSONPath,
+			OperationID: "getInclusionProofJSON",
+			Summary:     "Returns the proof that the leaf at index is included in the tree of the given size, as a JSON object with index, size, and base64 encoded hashes.",
+			Params: []Param{
+				{Name: "index", Description: "Index of the leaf.", Type: "integer"},
+				{Name: "size", Description: "Size of the tree, which must be larger than index.", Type: "integer"},
+			},
+			ContentType: "application/json",
+			Immutable:   true,
+			handler:     (*Server).getInclusionProofJSON,
+		},
+		{
+			Path:        ConsistencyProofJSONPath,
+			OperationID: "getConsistencyProofJSON",
+			Summary:     "Returns the proof that the tree of size from is a prefix of the tree of size to, as a JSON object with from, to, and base64 encoded hashes.",
+			Params: []Param{
+				{Name: "from", Description: "Size of the smaller tree.", Type: "integer"},
+				{Name: "to", Description: "Size of the larger tree.", Type: "integer"},
+			},
+			ContentType: "application/json",
+			Immutable:   true,
+			handler:     (*Server).getConsistencyProofJSON,
+		},
+		{
+			Path:        LookupPath,
+			OperationID: "lookupIdentifier",
+			Summary:     "Returns the entries associated with an identifier in the identifier map, along with the proof of them against the map root.",
+			Params: []Param{
+				{Name: "identifier", Description: "Identifier to look up.", Type: "string"},
+				{Name: "size", Description: "Log size at which the map was built, as committed to by a checkpoint.", Type: "integer"},
+			},
+			ContentType: "application/json",
+			Immutable:   true,
+			handler:     (*Server).lookupIdentifier,
+		},
+		{
+			Path:        TailPath,
+			OperationID: "tailEntries",
+			Summary:     "Streams the log's entries from index from onwards, waiting for new entries to be integrated, as newline delimited JSON objects with the entry's base64 encoded data, and a bundle of the signed checkpoint, leaf hash and inclusion proof verifying it.",
+			Params: []Param{
+				{Name: "from", Description: "Index of the first entry to stream.", Type: "integer"},
+			},
+			ContentType: "application/x-ndjson",
+			Streaming:   true,
+			Errors:      map[int]string{http.StatusBadRequest: "A parameter is missing or invalid."},
+			handler:     (*Server).tailEntries,
+		},
+		{
+			Path:        HealthzPath,
+			OperationID: "getHealth",
+			Summary:     "Reports that the server is running.",
+			ContentType: "text/plain; charset=utf-8",
+			Errors:      map[int]string{},
+			handler:     (*Server).getHealth,
+		},
+		{
+			Path:        ReadyzPath,
+			OperationID: "getReadiness",
+			Summary:     "Reports whether the server can serve the log: its storage is reachable, the checkpoint verifies with the log's key, and, if configured, the checkpoint is fresh.",
+			ContentType: "text/plain; charset=utf-8",
+			Errors:      map[int]string{http.StatusServiceUnavailable: "The server can't serve the log, for the reason given in the body."},
+			handler:     (*Server).getReadiness,
+		},
+		{
+			Path:        OpenAPIPath,
+			OperationID: "getOpenAPI",
+			Summary:     "Returns the OpenAPI description of this API.",
+			ContentType: "application/json",
+			handler:     (*Server).getOpenAPI,
+		},
+	}
+}
+
+// OpenAPI returns the OpenAPI description of the endpoints.
+func OpenAPI() *openapi.Document {
+	d := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Serverless Log",
+			Description: "Read-only API of a serverless transparency log. The log's files are also served at their paths in the storage layout.",
+			Version:     APIVersion,
+		},
+		Paths: make(map[string]map[string]openapi.Operation),
+	}
+	for _, e := range Endpoints() {
+		ok := "OK"
+		if e.Immutable {
+			ok = "OK. The response never changes, and may be cached indefinitely."
+		}
+		if e.Streaming {
+			ok = "OK. The response is streamed until the client disconnects."
+		}
+		op := openapi.Operation{
+			OperationID: e.OperationID,
+			Summary:     e.Summary,
+			Streaming:   e.Streaming,
+			Responses: map[string]openapi.Response{
+				"200": {
+					Description: ok,
+					Content:     map[string]openapi.MediaType{e.ContentType: {Schema: openapi.Schema{Type: "string"}}},
+				},
+			},
+		}
+		for _, p := range e.Params {
+			s := openapi.Schema{Type: p.Type}
+			if p.Type == "integer" {
+				zero := 0
+				s.Format, s.Minimum = "int64", &zero
+			}
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name:        p.Name,
+				In:          "query",
+				Description: p.Description,
+				Required:    !p.Optional,
+				Schema:      s,
+			})
+		}
+		errs := e.Errors
+		if errs == nil {
+			errs = map[int]string{http.StatusNotFound: "The requested data isn't in the log."}
+			if len(e.Params) > 0 {
+				errs[http.StatusBadRequest] = "A parameter is missing or invalid."
+			}
+		}
+		for code, desc := range errs {
+			op.Responses[strconv.Itoa(code)] = openapi.Response{Description: desc}
+		}
+		d.Paths[e.Path] = map[string]openapi.Operation{"get": op}
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/golang/glog"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// getCheckpointEvents streams the log's checkpoints as server-sent events,
+// starting with the current one, until the client disconnects or the server
+// is drained.
+func (s *Server) getCheckpointEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	ctx := r.Context()
+	var last []byte
+	for {
+		raw, cp, err := s.waitForCheckpoint(ctx, func(raw []byte, _ *fmtlog.Checkpoint) bool { return !bytes.Equal(raw, last) })
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, errDraining) {
+				glog.Warningf("Failed to stream checkpoints: %v", err)
+			}
+			return
+		}
+		if err := writeEvent(w, "checkpoint", fmt.Sprint(cp.Size), raw); err != nil {
+			// The client has gone away.
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		last = raw
+	}
+}
+
+// writeEvent writes a server-sent event with the given type, ID and data.
+// Each line of data is sent in its own field, which clients join with
+// newlines, so a final newline is lost.
+func writeEvent(w io.Writer, event, id string, data []byte) error {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "event: %s\nid: %s\n", event, id)
+	for _, l := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		fmt.Fprintf(b, "data: %s\n", l)
+	}
+	b.WriteString("\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main writes the OpenAPI description of the serve tool's API, and
+// the Go client generated from it.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/internal/openapi"
+	"github.com/google/trillian-examples/serverless/internal/server"
+)
+
+var (
+	openAPIFile = flag.String("openapi", "", "Path to write the OpenAPI document to.")
+	clientFile  = flag.String("client", "", "Path to write the generated Go client to.")
+	clientPkg   = flag.String("client_package", "httpapi", "Package of the generated Go client.")
+)
+
+func main() {
+	flag.Parse()
+
+	if len(*openAPIFile) == 0 || len(*clientFile) == 0 {
+		glog.Exitf("Please set --openapi and --client flags.")
+	}
+	doc, err := server.OpenAPI().Marshal()
+	if err != nil {
+		glog.Exitf("Failed to marshal OpenAPI document: %v", err)
+	}
+	if err := os.WriteFile(*openAPIFile, doc, 0644); err != nil {
+		glog.Exitf("Failed to write OpenAPI document: %v", err)
+	}
+	// Generate the client from the serialised document, as for any other
+	// language, rather than the Go description it came from.
+	d, err := openapi.Parse(doc)
+	if err != nil {
+		glog.Exitf("Failed to parse OpenAPI document: %v", err)
+	}
+	src, err := openapi.GenerateGoClient(d, *clientPkg, server.Generator)
+	if err != nil {
+		glog.Exitf("Failed to generate client: %v", err)
+	}
+	if err := os.WriteFile(*clientFile, src, 0644); err != nil {
+		glog.Exitf("Failed to write client: %v", err)
+	}
+}
@@ -0,0 +1,544 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server provides an HTTP server for a serverless log, which serves
+// the log's files along with proofs computed from them.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+const (
+	// InclusionProofPath is the path of the endpoint serving inclusion
+	// proofs, which takes index and size query parameters.
+	InclusionProofPath = "/proof/inclusion"
+
+	// ConsistencyProofPath is the path of the endpoint serving consistency
+	// proofs, which takes from and to query parameters.
+	ConsistencyProofPath = "/proof/consistency"
+
+	// InclusionProofJSONPath and ConsistencyProofJSONPath serve the same
+	// proofs as the endpoints above, in the JSON form defined by the api
+	// package.
+	InclusionProofJSONPath   = "/proof/inclusion.json"
+	ConsistencyProofJSONPath = "/proof/consistency.json"
+
+	// DefaultPollInterval is how often streaming endpoints check for a new
+	// checkpoint, unless the Server's PollInterval is set.
+	DefaultPollInterval = time.Second
+
+	// DefaultLongPollTimeout is how long a request for the checkpoint with
+	// wait set waits for a new one, unless the Server's LongPollTimeout is
+	// set.
+	DefaultLongPollTimeout = 30 * time.Second
+
+	// immutableCacheControl is sent with responses which never change, since
+	// the log is append-only.
+	immutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+// Server serves a serverless log over HTTP.
+type Server struct {
+	// MaxCheckpointAge, if non-zero, is how long ago the checkpoint may have
+	// been published for the server to report itself ready. It should be
+	// set before Handler is called.
+	MaxCheckpointAge time.Duration
+
+	// Immutable should be set if the log uses the immutable layout described
+	// by api.Manifest, so that its files which never change are served with
+	// headers allowing them to be cached indefinitely, e.g. by a CDN. It
+	// should be set before Handler is called.
+	Immutable bool
+
+	// PartialTiles should be set to the log's partial tiles mode, as given
+	// by api.Manifest, so that partial tiles which the log doesn't store are
+	// derived and served as if it did. It should be set before Handler is
+	// called.
+	PartialTiles api.PartialTiles
+
+	// PollInterval is how often streaming endpoints check for a new
+	// checkpoint, defaulting to DefaultPollInterval. Proofs are also built
+	// for the same checkpoint for up to this long before it's read again,
+	// unless a larger tree is asked for. It should be set before Handler is
+	// called.
+	PollInterval time.Duration
+
+	// LongPollTimeout is how long a request for the checkpoint with wait set
+	// waits for a new one, defaulting to DefaultLongPollTimeout. It should be
+	// set before Handler is called.
+	LongPollTimeout time.Duration
+
+	// draining is set once the server is shutting down.
+	draining atomic.Bool
+
+	// edgeMu guards edge.
+	edgeMu sync.Mutex
+	// edge is the tree of the latest checkpoint proofs were built for.
+	edge *edge
+
+	fsys   fs.FS
+	f      client.Fetcher
+	h      merkle.LogHasher
+	v      note.Verifier
+	origin string
+}
+
+// edge holds a ProofBuilder for a checkpoint of the log, which keeps the tiles
+// on the right edge of its tree and the ephemeral nodes above them. Proofs for
+// recent entries, which are the ones most often asked for, only need those,
+// so can be built without reading storage.
+type edge struct {
+	raw []byte
+	cp  *fmtlog.Checkpoint
+	pb  *client.ProofBuilder
+	// checked is when the checkpoint was last read.
+	checked time.Time
+}
+
+// New returns a Server for the log stored in fsys, whose checkpoints are
+// verified with v and must have the given origin.
+func New(fsys fs.FS, h merkle.LogHasher, v note.Verifier, origin string) *Server {
+	return &Server{
+		fsys:   fsys,
+		f:      client.DerivingFetcher(client.NewFSFetcher(fsys), h),
+		h:      h,
+		v:      v,
+		origin: origin,
+	}
+}
+
+// Handler returns an http.Handler which serves the API described by
+// Endpoints, and the log's files from all other paths.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, e := range Endpoints() {
+		e := e
+		mux.HandleFunc(e.Path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			e.handler(s, w, r)
+		})
+	}
+	mux.Handle("/", s.cacheControl(s.serveFiles()))
+	return mux
+}
+
+// serveFiles returns a handler which serves the log's files from fsys.
+//
+// Regular files, such as tiles and entries, are served with http.ServeContent
+// and their modification times, straight from the fs.File opened by fsys
+// rather than through the wrapper http.FS puts around it. When fsys is an
+// os.DirFS that's an *os.File, so the kernel can copy its contents to the
+// connection itself, e.g. with sendfile on Linux, without them passing
+// through the server's memory. Partial tiles which the log doesn't store are
+// derived, if it derives them. Anything else, such as a directory, is left to
+// http.FileServer.
+func (s *Server) serveFiles() http.Handler {
+	fileServer := http.FileServer(http.FS(s.fsys))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if len(name) == 0 {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		// The audit log of submitters isn't published with the log.
+		if name == layout.AuditDir || strings.HasPrefix(name, layout.AuditDir+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := s.fsys.Open(name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && s.PartialTiles == api.PartialTilesDerived {
+				if _, _, n, err := layout.ParseTilePath(name); err == nil && n > 0 {
+					s.serveDerivedTile(w, r, name)
+					return
+				}
+			}
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		rs, ok := f.(io.ReadSeeker)
+		if err != nil || !fi.Mode().IsRegular() || !ok {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), rs)
+	})
+}
+
+// serveDerivedTile serves the partial tile at the layout path p, which the
+// log doesn't store, by deriving it.
+func (s *Server) serveDerivedTile(w http.ResponseWriter, r *http.Request, p string) {
+	raw, err := s.f(r.Context(), p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		glog.Warningf("Failed to derive partial tile %q: %v", p, err)
+		http.Error(w, "failed to derive tile", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, path.Base(p), time.Time{}, bytes.NewReader(raw))
+}
+
+// cacheControl wraps h, which serves the log's files, so that caches will
+// revalidate those which may change. If the log uses the immutable layout,
+// the others may be cached indefinitely.
+func (s *Server) cacheControl(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if layout.Immutable(strings.TrimPrefix(r.URL.Path, "/")) {
+			if s.Immutable {
+				w.Header().Set("Cache-Control", immutableCacheControl)
+			}
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getCheckpoint(w http.ResponseWriter, r *http.Request) {
+	wait := false
+	if v := r.URL.Query().Get("wait"); len(v) > 0 {
+		var err error
+		if wait, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid wait parameter %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	raw, err := s.f(r.Context(), layout.CheckpointPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "log has no checkpoint", http.StatusNotFound)
+			return
+		}
+		glog.Warningf("Failed to read checkpoint: %v", err)
+		http.Error(w, "failed to read log", http.StatusInternalServerError)
+		return
+	}
+	// A client which is behind gets the current checkpoint straight away.
+	if inm := r.Header.Get("If-None-Match"); wait && (len(inm) == 0 || inm == etag(raw)) {
+		raw = s.longPoll(r.Context(), raw)
+	}
+	// The checkpoint is the only file in the log which changes. Clients may
+	// check whether it has with If-None-Match, which ServeContent handles.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag(raw))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(raw))
+}
+
+// longPoll waits for a checkpoint other than cur to be published, and returns
+// it. If none is before the long-poll timeout, or it fails, cur is returned,
+// and the client will have to ask again.
+func (s *Server) longPoll(ctx context.Context, cur []byte) []byte {
+	timeout := s.LongPollTimeout
+	if timeout <= 0 {
+		timeout = DefaultLongPollTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	raw, _, err := s.waitForCheckpoint(ctx, func(raw []byte, _ *fmtlog.Checkpoint) bool { return !bytes.Equal(raw, cur) })
+	if err != nil {
+		if ctx.Err() == nil && !errors.Is(err, errDraining) {
+			glog.Warningf("Failed to wait for checkpoint: %v", err)
+		}
+		return cur
+	}
+	return raw
+}
+
+func (s *Server) getHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// getReadiness reports whether the server can serve the log, i.e. that its
+// storage is reachable, its checkpoint verifies with the configured key, and
+// it was published recently enough.
+func (s *Server) getReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if err := s.ready(r.Context()); err != nil {
+		glog.Warningf("Not ready: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Drain marks the server as shutting down, after which it reports itself as
+// not ready so that load balancers stop sending it requests. Requests are
+// still served as usual, apart from streams, which are ended.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) ready(ctx context.Context) error {
+	if s.draining.Load() {
+		return errors.New("draining: server is shutting down")
+	}
+	raw, err := s.f(ctx, layout.CheckpointPath)
+	if err != nil {
+		return fmt.Errorf("storage: failed to read checkpoint: %v", err)
+	}
+	if _, _, _, err := fmtlog.ParseCheckpoint(raw, s.origin, s.v); err != nil {
+		return fmt.Errorf("key: failed to verify checkpoint: %v", err)
+	}
+	if s.MaxCheckpointAge > 0 {
+		fi, err := fs.Stat(s.fsys, layout.CheckpointPath)
+		if err != nil {
+			return fmt.Errorf("storage: failed to stat checkpoint: %v", err)
+		}
+		if age := time.Since(fi.ModTime()); age > s.MaxCheckpointAge {
+			return fmt.Errorf("freshness: checkpoint was published %v ago, more than %v", age.Truncate(time.Second), s.MaxCheckpointAge)
+		}
+	}
+	return nil
+}
+
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	b, err := OpenAPI().Marshal()
+	if err != nil {
+		glog.Warningf("Failed to marshal OpenAPI document: %v", err)
+		http.Error(w, "failed to describe API", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+}
+
+// proofBuilder returns a ProofBuilder for the latest verified checkpoint, for
+// building proofs in trees of up to the given size.
+//
+// The right edge of the checkpoint's tree is kept until the checkpoint
+// changes, which is checked for at most once per PollInterval unless a larger
+// tree is asked for, so that proofs for recent entries usually need no
+// storage reads at all.
+func (s *Server) proofBuilder(ctx context.Context, size uint64) (*client.ProofBuilder, *fmtlog.Checkpoint, error) {
+	s.edgeMu.Lock()
+	defer s.edgeMu.Unlock()
+	e := s.edge
+	if e == nil || e.cp.Size < size || time.Since(e.checked) >= s.pollInterval() {
+		raw, err := s.f(ctx, layout.CheckpointPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		if e == nil || !bytes.Equal(raw, e.raw) {
+			cp, _, _, err := fmtlog.ParseCheckpoint(raw, s.origin, s.v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+			}
+			pb, err := client.NewProofBuilder(ctx, *cp, s.h.HashChildren, s.f)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create proof builder: %w", err)
+			}
+			e = &edge{raw: raw, cp: cp, pb: pb}
+		}
+		e.checked = time.Now()
+		s.edge = e
+	}
+	// Tiles other than those on the right edge are only kept for the
+	// request.
+	return e.pb.Fork(s.f), e.cp, nil
+}
+
+// pollInterval returns how often the checkpoint is checked for changes.
+func (s *Server) pollInterval() time.Duration {
+	if s.PollInterval <= 0 {
+		return DefaultPollInterval
+	}
+	return s.PollInterval
+}
+
+func (s *Server) getInclusionProof(w http.ResponseWriter, r *http.Request) {
+	if _, _, p, ok := s.inclusionProof(w, r); ok {
+		serveImmutable(w, r, "text/plain; charset=utf-8", api.MarshalProof(p))
+	}
+}
+
+func (s *Server) getInclusionProofJSON(w http.ResponseWriter, r *http.Request) {
+	if index, size, p, ok := s.inclusionProof(w, r); ok {
+		serveImmutable(w, r, "application/json", api.InclusionProof{Index: index, Size: size, Hashes: p}.Marshal())
+	}
+}
+
+// inclusionProof builds the inclusion proof requested by r. If the request
+// can't be satisfied an error is written to w, and false returned.
+func (s *Server) inclusionProof(w http.ResponseWriter, r *http.Request) (uint64, uint64, [][]byte, bool) {
+	index, err := parseUintParam(r, "index")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+	size, err := parseUintParam(r, "size")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+	if index >= size {
+		http.Error(w, fmt.Sprintf("index %d is not less than size %d", index, size), http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+	pb, cp, err := s.proofBuilder(r.Context(), size)
+	if err != nil {
+		glog.Warningf("Failed to serve inclusion proof: %v", err)
+		http.Error(w, "failed to read log", http.StatusInternalServerError)
+		return 0, 0, nil, false
+	}
+	if size > cp.Size {
+		http.Error(w, fmt.Sprintf("size %d is larger than the log size %d", size, cp.Size), http.StatusNotFound)
+		return 0, 0, nil, false
+	}
+	p, err := pb.InclusionProofAt(r.Context(), index, size)
+	if err != nil {
+		glog.Warningf("Failed to build inclusion proof for index %d at size %d: %v", index, size, err)
+		http.Error(w, "failed to build proof", http.StatusInternalServerError)
+		return 0, 0, nil, false
+	}
+	return index, size, p, true
+}
+
+func (s *Server) getConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	if _, _, p, ok := s.consistencyProof(w, r); ok {
+		serveImmutable(w, r, "text/plain; charset=utf-8", api.MarshalProof(p))
+	}
+}
+
+func (s *Server) getConsistencyProofJSON(w http.ResponseWriter, r *http.Request) {
+	if from, to, p, ok := s.consistencyProof(w, r); ok {
+		serveImmutable(w, r, "application/json", api.ConsistencyProof{From: from, To: to, Hashes: p}.Marshal())
+	}
+}
+
+// consistencyProof builds the consistency proof requested by r. If the
+// request can't be satisfied an error is written to w, and false returned.
+func (s *Server) consistencyProof(w http.ResponseWriter, r *http.Request) (uint64, uint64, [][]byte, bool) {
+	from, err := parseUintParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+	to, err := parseUintParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+	if from > to {
+		http.Error(w, fmt.Sprintf("from %d is larger than to %d", from, to), http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+	pb, cp, err := s.proofBuilder(r.Context(), to)
+	if err != nil {
+		glog.Warningf("Failed to serve consistency proof: %v", err)
+		http.Error(w, "failed to read log", http.StatusInternalServerError)
+		return 0, 0, nil, false
+	}
+	if to > cp.Size {
+		http.Error(w, fmt.Sprintf("to %d is larger than the log size %d", to, cp.Size), http.StatusNotFound)
+		return 0, 0, nil, false
+	}
+	p, err := pb.ConsistencyProof(r.Context(), from, to)
+	if err != nil {
+		glog.Warningf("Failed to build consistency proof from %d to %d: %v", from, to, err)
+		http.Error(w, "failed to build proof", http.StatusInternalServerError)
+		return 0, 0, nil, false
+	}
+	return from, to, p, true
+}
+
+func (s *Server) lookupIdentifier(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("identifier")
+	if err := api.ValidateIdentifier(id); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := parseUintParam(r, "size")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	raw, err := s.f(r.Context(), path.Join(layout.MapPath("", size, api.IdentifierKey(id))))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, fmt.Sprintf("no entries for %q in map at size %d", id, size), http.StatusNotFound)
+			return
+		}
+		glog.Warningf("Failed to read map entry for %q at size %d: %v", id, size, err)
+		http.Error(w, "failed to read log", http.StatusInternalServerError)
+		return
+	}
+	contentType := "application/json"
+	if api.IsBinaryMapEntry(raw) {
+		contentType = "application/octet-stream"
+	}
+	serveImmutable(w, r, contentType, raw)
+}
+
+// serveImmutable writes body, which must never change. Since the log is
+// append-only, proofs and map snapshots don't, so they're served with a
+// strong ETag and may be cached indefinitely.
+func serveImmutable(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", immutableCacheControl)
+	w.Header().Set("ETag", etag(body))
+	// ServeContent handles conditional requests using the ETag.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+// etag returns the strong ETag of body.
+func etag(body []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(body)))
+}
+
+func parseUintParam(r *http.Request, name string) (uint64, error) {
+	v := r.URL.Query().Get(name)
+	if len(v) == 0 {
+		return 0, fmt.Errorf("missing %s parameter", name)
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter %q", name, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,926 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/openapi"
+	"github.com/google/trillian-examples/serverless/pkg/vmap"
+	"github.com/google/trillian-examples/serverless/testdata"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+const logDir = "../../testdata/log"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := New(os.DirFS(logDir), rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// checkpoint returns the testdata log's checkpoint of the given size.
+func checkpoint(t *testing.T, size int) fmtlog.Checkpoint {
+	t.Helper()
+	cp, _, _, err := fmtlog.ParseCheckpoint(testdata.Checkpoint(t, size), testdata.TestLogOrigin, testdata.LogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("ParseCheckpoint: %v", err)
+	}
+	return *cp
+}
+
+func get(t *testing.T, url string, hdr http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return resp, body
+}
+
+// parseProof parses a proof served with one base64 encoded hash per line.
+func parseProof(t *testing.T, body []byte) [][]byte {
+	t.Helper()
+	var p [][]byte
+	for _, l := range strings.Split(strings.TrimSuffix(string(body), "\n"), "\n") {
+		if len(l) == 0 {
+			continue
+		}
+		h, err := base64.StdEncoding.DecodeString(l)
+		if err != nil {
+			t.Fatalf("Invalid proof line %q: %v", l, err)
+		}
+		p = append(p, h)
+	}
+	return p
+}
+
+func TestInclusionProof(t *testing.T) {
+	ts := newTestServer(t)
+	h := rfc6962.DefaultHasher
+	for _, size := range []int{1, 5, 7, 14, 15} {
+		cp := checkpoint(t, size)
+		for i := uint64(0); i < cp.Size; i++ {
+			leaf, err := os.ReadFile(filepath.Join(logDir, filepath.Join(layout.SeqPath("", i))))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			resp, body := get(t, fmt.Sprintf("%s%s?index=%d&size=%d", ts.URL, InclusionProofPath, i, size), nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Inclusion proof for %d at size %d: status %d", i, size, resp.StatusCode)
+			}
+			if err := proof.VerifyInclusion(h, i, cp.Size, h.HashLeaf(leaf), parseProof(t, body), cp.Hash); err != nil {
+				t.Errorf("Inclusion proof for %d at size %d doesn't verify: %v", i, size, err)
+			}
+		}
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	ts := newTestServer(t)
+	for _, test := range []struct{ from, to int }{{1, 15}, {5, 7}, {7, 14}, {14, 15}, {15, 15}} {
+		from, to := checkpoint(t, test.from), checkpoint(t, test.to)
+		resp, body := get(t, fmt.Sprintf("%s%s?from=%d&to=%d", ts.URL, ConsistencyProofPath, test.from, test.to), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Consistency proof from %d to %d: status %d", test.from, test.to, resp.StatusCode)
+		}
+		if err := proof.VerifyConsistency(rfc6962.DefaultHasher, from.Size, to.Size, parseProof(t, body), from.Hash, to.Hash); err != nil {
+			t.Errorf("Consistency proof from %d to %d doesn't verify: %v", test.from, test.to, err)
+		}
+	}
+}
+
+func TestZipArchive(t *testing.T) {
+	// Bundle a snapshot of the testdata log into a directory of an in-memory
+	// zip archive, as served with --storage_zip.
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	if err := filepath.WalkDir(logDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(logDir, p)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(path.Join("log", filepath.ToSlash(rel)))
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}); err != nil {
+		t.Fatalf("Failed to create zip archive: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip archive: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open zip archive: %v", err)
+	}
+	fsys, err := fs.Sub(zr, "log")
+	if err != nil {
+		t.Fatalf("Sub: %v", err)
+	}
+	ts := httptest.NewServer(New(fsys, rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin).Handler())
+	defer ts.Close()
+
+	want, err := os.ReadFile(filepath.Join(logDir, layout.CheckpointPath))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if resp, body := get(t, ts.URL+"/"+layout.CheckpointPath, nil); resp.StatusCode != http.StatusOK || !bytes.Equal(body, want) {
+		t.Errorf("Got checkpoint %q with status %d, want %q", body, resp.StatusCode, want)
+	}
+	from, to := checkpoint(t, 5), checkpoint(t, 15)
+	resp, body := get(t, fmt.Sprintf("%s%s?from=%d&to=%d", ts.URL, ConsistencyProofPath, from.Size, to.Size), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Consistency proof: status %d", resp.StatusCode)
+	}
+	if err := proof.VerifyConsistency(rfc6962.DefaultHasher, from.Size, to.Size, parseProof(t, body), from.Hash, to.Hash); err != nil {
+		t.Errorf("Consistency proof doesn't verify: %v", err)
+	}
+}
+
+func TestProofCaching(t *testing.T) {
+	ts := newTestServer(t)
+	url := fmt.Sprintf("%s%s?index=3&size=7", ts.URL, InclusionProofPath)
+	resp, _ := get(t, url, nil)
+	etag := resp.Header.Get("ETag")
+	if len(etag) == 0 || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Got ETag %q, want strong ETag", etag)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != immutableCacheControl {
+		t.Errorf("Got Cache-Control %q, want %q", got, immutableCacheControl)
+	}
+	resp, _ = get(t, url, http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Conditional request got status %d, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+
+	resp, _ = get(t, ts.URL+"/"+layout.CheckpointPath, nil)
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Checkpoint got Cache-Control %q, want no-cache", got)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	ts := newTestServer(t)
+	for _, test := range []struct {
+		query string
+		want  int
+	}{
+		{query: InclusionProofPath + "?index=1", want: http.StatusBadRequest},
+		{query: InclusionProofPath + "?index=x&size=2", want: http.StatusBadRequest},
+		{query: InclusionProofPath + "?index=2&size=2", want: http.StatusBadRequest},
+		{query: InclusionProofPath + "?index=2&size=16", want: http.StatusNotFound},
+		{query: ConsistencyProofPath + "?from=3&to=2", want: http.StatusBadRequest},
+		{query: ConsistencyProofPath + "?from=-1&to=2", want: http.StatusBadRequest},
+		{query: ConsistencyProofPath + "?from=1&to=16", want: http.StatusNotFound},
+		{query: LookupPath + "?size=3", want: http.StatusBadRequest},
+		{query: LookupPath + "?identifier=apple", want: http.StatusBadRequest},
+		{query: LookupPath + "?identifier=apple&size=3", want: http.StatusNotFound},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			resp, _ := get(t, ts.URL+test.query, nil)
+			if resp.StatusCode != test.want {
+				t.Errorf("Got status %d, want %d", resp.StatusCode, test.want)
+			}
+			if cc := resp.Header.Get("Cache-Control"); cc == immutableCacheControl {
+				t.Error("Error response is marked immutable")
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	l := api.EntryList{Identifier: "apple", Indices: []uint64{1, 4}}
+	key := api.IdentifierKey(l.Identifier)
+	m, err := vmap.New(map[string][]byte{string(key): l.Marshal()})
+	if err != nil {
+		t.Fatalf("vmap.New: %v", err)
+	}
+	p, err := m.Proof(key)
+	if err != nil {
+		t.Fatalf("Proof: %v", err)
+	}
+	entry := api.MapEntry{Entries: l, Proof: *p}.Marshal()
+	fsys := fstest.MapFS{
+		path.Join(layout.MapPath("", 5, key)): &fstest.MapFile{Data: entry},
+	}
+	s := New(fsys, rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	resp, body := get(t, fmt.Sprintf("%s%s?identifier=%s&size=5", ts.URL, LookupPath, url.QueryEscape(l.Identifier)), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Lookup: status %d", resp.StatusCode)
+	}
+	if !bytes.Equal(body, entry) {
+		t.Errorf("Lookup got %q, want %q", body, entry)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != immutableCacheControl {
+		t.Errorf("Got Cache-Control %q, want %q", got, immutableCacheControl)
+	}
+	if resp, _ := get(t, fmt.Sprintf("%s%s?identifier=%s&size=4", ts.URL, LookupPath, l.Identifier), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Lookup in map of another size: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	ts := newTestServer(t)
+	for _, e := range Endpoints() {
+		resp, err := http.Post(ts.URL+e.Path, "text/plain", strings.NewReader("leaf"))
+		if err != nil {
+			t.Fatalf("Post(%q): %v", e.Path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Post(%q): status %d, want %d", e.Path, resp.StatusCode, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newTestServer(t)
+	resp, body := get(t, ts.URL+OpenAPIPath, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("OpenAPI: status %d", resp.StatusCode)
+	}
+	d, err := openapi.Parse(body)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, e := range Endpoints() {
+		if _, ok := d.Paths[e.Path]["get"]; !ok {
+			t.Errorf("OpenAPI document doesn't describe %s", e.Path)
+		}
+	}
+}
+
+// TestGeneratedFiles checks that the checked in OpenAPI document and Go
+// client match the endpoints. Run go generate if it fails.
+func TestGeneratedFiles(t *testing.T) {
+	doc, err := OpenAPI().Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	d, err := openapi.Parse(doc)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	src, err := openapi.GenerateGoClient(d, "httpapi", Generator)
+	if err != nil {
+		t.Fatalf("GenerateGoClient: %v", err)
+	}
+	for _, f := range []struct {
+		path string
+		want []byte
+	}{
+		{path: "../../api/openapi.json", want: doc},
+		{path: "../../client/httpapi/client.gen.go", want: src},
+	} {
+		got, err := os.ReadFile(f.path)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if !bytes.Equal(got, f.want) {
+			t.Errorf("%s is out of date, run go generate ./internal/server", f.path)
+		}
+	}
+}
+
+func TestJSONProofs(t *testing.T) {
+	ts := newTestServer(t)
+	h := rfc6962.DefaultHasher
+	cp := checkpoint(t, 7)
+	leaf, err := os.ReadFile(filepath.Join(logDir, filepath.Join(layout.SeqPath("", 3))))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	resp, body := get(t, fmt.Sprintf("%s%s?index=3&size=7", ts.URL, InclusionProofJSONPath), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Inclusion proof: status %d", resp.StatusCode)
+	}
+	ip, err := api.ParseInclusionProof(body)
+	if err != nil {
+		t.Fatalf("ParseInclusionProof: %v", err)
+	}
+	if err := proof.VerifyInclusion(h, ip.Index, ip.Size, h.HashLeaf(leaf), ip.Hashes, cp.Hash); err != nil {
+		t.Errorf("Inclusion proof doesn't verify: %v", err)
+	}
+
+	from, to := checkpoint(t, 5), checkpoint(t, 15)
+	resp, body = get(t, fmt.Sprintf("%s%s?from=5&to=15", ts.URL, ConsistencyProofJSONPath), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Consistency proof: status %d", resp.StatusCode)
+	}
+	cproof, err := api.ParseConsistencyProof(body)
+	if err != nil {
+		t.Fatalf("ParseConsistencyProof: %v", err)
+	}
+	if err := proof.VerifyConsistency(h, cproof.From, cproof.To, cproof.Hashes, from.Hash, to.Hash); err != nil {
+		t.Errorf("Consistency proof doesn't verify: %v", err)
+	}
+}
+
+// historyFS serves the testdata log with the checkpoint of the given size.
+type historyFS struct {
+	fs.FS
+	size atomic.Int64
+}
+
+func (h *historyFS) Open(name string) (fs.File, error) {
+	if name == layout.CheckpointPath {
+		name = fmt.Sprintf("%s.%d", layout.CheckpointPath, h.size.Load())
+	}
+	return h.FS.Open(name)
+}
+
+// noPartialsFS serves the testdata log without its partial tiles.
+type noPartialsFS struct {
+	fs.FS
+}
+
+func (n noPartialsFS) Open(name string) (fs.File, error) {
+	if _, _, size, err := layout.ParseTilePath(name); err == nil && size > 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return n.FS.Open(name)
+}
+
+func TestDerivedPartialTiles(t *testing.T) {
+	h := rfc6962.DefaultHasher
+	tilePath := path.Join(layout.TilePath("", 0, 0, 15))
+	want, err := os.ReadFile(filepath.Join(logDir, filepath.FromSlash(tilePath)))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for _, mode := range []api.PartialTiles{"", api.PartialTilesStored, api.PartialTilesDerived} {
+		s := New(noPartialsFS{os.DirFS(logDir)}, h, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+		s.PartialTiles = mode
+		ts := httptest.NewServer(s.Handler())
+		defer ts.Close()
+
+		resp, body := get(t, ts.URL+"/"+tilePath, nil)
+		if mode == api.PartialTilesDerived {
+			if resp.StatusCode != http.StatusOK || !bytes.Equal(body, want) {
+				t.Errorf("%q: derived tile is %d %q, want %q", mode, resp.StatusCode, body, want)
+			}
+		} else if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%q: partial tile which isn't stored has status %d, want %d", mode, resp.StatusCode, http.StatusNotFound)
+		}
+		if resp, _ := get(t, ts.URL+"/"+path.Join(layout.TilePath("", 0, 0, 16)), nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%q: tile beyond log has status %d, want %d", mode, resp.StatusCode, http.StatusNotFound)
+		}
+
+		// Proofs are built from derived tiles whatever the mode.
+		cp := checkpoint(t, 15)
+		leaf, err := os.ReadFile(filepath.Join(logDir, filepath.Join(layout.SeqPath("", 14))))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		resp, body = get(t, fmt.Sprintf("%s%s?index=14&size=15", ts.URL, InclusionProofPath), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%q: inclusion proof status %d", mode, resp.StatusCode)
+		}
+		if err := proof.VerifyInclusion(h, 14, cp.Size, h.HashLeaf(leaf), parseProof(t, body), cp.Hash); err != nil {
+			t.Errorf("%q: inclusion proof doesn't verify: %v", mode, err)
+		}
+	}
+}
+
+// countingFS counts the files opened in the FS it wraps.
+type countingFS struct {
+	fs.FS
+	opened atomic.Int64
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opened.Add(1)
+	return c.FS.Open(name)
+}
+
+func TestProofsFromRightEdge(t *testing.T) {
+	h := rfc6962.DefaultHasher
+	hfs := &historyFS{FS: os.DirFS(logDir)}
+	hfs.size.Store(14)
+	cfs := &countingFS{FS: hfs}
+	s := New(cfs, h, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	s.PollInterval = time.Hour
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	inclusion := func(index, size uint64) {
+		t.Helper()
+		cp := checkpoint(t, int(size))
+		leaf, err := os.ReadFile(filepath.Join(logDir, filepath.Join(layout.SeqPath("", index))))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		resp, body := get(t, fmt.Sprintf("%s%s?index=%d&size=%d", ts.URL, InclusionProofPath, index, size), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Inclusion proof for %d at size %d: status %d", index, size, resp.StatusCode)
+		}
+		if err := proof.VerifyInclusion(h, index, cp.Size, h.HashLeaf(leaf), parseProof(t, body), cp.Hash); err != nil {
+			t.Errorf("Inclusion proof for %d at size %d doesn't verify: %v", index, size, err)
+		}
+	}
+
+	inclusion(13, 14)
+	if cfs.opened.Load() == 0 {
+		t.Fatal("First proof read nothing")
+	}
+	// The checkpoint and the right edge of its tree are kept.
+	cfs.opened.Store(0)
+	for i := uint64(0); i < 14; i++ {
+		inclusion(i, 14)
+	}
+	if got := cfs.opened.Load(); got != 0 {
+		t.Errorf("Proofs from the right edge opened %d files, want none", got)
+	}
+
+	// Asking for a larger tree reads the new checkpoint, and its right edge.
+	hfs.size.Store(15)
+	inclusion(14, 15)
+	if cfs.opened.Load() == 0 {
+		t.Error("Proof in larger tree read nothing")
+	}
+	if resp, _ := get(t, fmt.Sprintf("%s%s?index=0&size=16", ts.URL, InclusionProofPath), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Proof beyond log has status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestTail(t *testing.T) {
+	h := rfc6962.DefaultHasher
+	hfs := &historyFS{FS: os.DirFS(logDir)}
+	hfs.size.Store(5)
+	s := New(hfs, h, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	s.PollInterval = 10 * time.Millisecond
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	if resp, _ := get(t, ts.URL+TailPath, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Tail without from: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+TailPath+"?from=2", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Tail: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Tail got Content-Type %q", ct)
+	}
+	dec := json.NewDecoder(resp.Body)
+	next := func(wantIndex, wantSize uint64) {
+		t.Helper()
+		var e api.TailEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if e.Proof.Index != wantIndex || e.Proof.Size != wantSize {
+			t.Fatalf("Got entry %d at size %d, want %d at size %d", e.Proof.Index, e.Proof.Size, wantIndex, wantSize)
+		}
+		leaf, err := os.ReadFile(filepath.Join(logDir, filepath.Join(layout.SeqPath("", wantIndex))))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if !bytes.Equal(e.Data, leaf) || !bytes.Equal(e.LeafHash, h.HashLeaf(leaf)) {
+			t.Errorf("Entry %d has data %q and leaf hash %x, want %q", wantIndex, e.Data, e.LeafHash, leaf)
+		}
+		cp, _, _, err := fmtlog.ParseCheckpoint([]byte(e.Checkpoint), testdata.TestLogOrigin, testdata.LogSigVerifier(t))
+		if err != nil {
+			t.Fatalf("ParseCheckpoint: %v", err)
+		}
+		if err := proof.VerifyInclusion(h, e.Proof.Index, cp.Size, e.LeafHash, e.Proof.Hashes, cp.Hash); err != nil {
+			t.Errorf("Entry %d doesn't verify: %v", wantIndex, err)
+		}
+	}
+	for i := uint64(2); i < 5; i++ {
+		next(i, 5)
+	}
+	// Entries are streamed as the log grows.
+	hfs.size.Store(9)
+	for i := uint64(5); i < 9; i++ {
+		next(i, 9)
+	}
+
+	// Draining the server ends the stream.
+	s.Drain()
+	if err := dec.Decode(&api.TailEntry{}); err != io.EOF {
+		t.Errorf("Decode after drain: %v, want EOF", err)
+	}
+}
+
+func TestCheckpointLongPoll(t *testing.T) {
+	hfs := &historyFS{FS: os.DirFS(logDir)}
+	hfs.size.Store(5)
+	s := New(hfs, rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	s.PollInterval = 10 * time.Millisecond
+	s.LongPollTimeout = 200 * time.Millisecond
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// With no new checkpoint, the current one is returned after the timeout.
+	start := time.Now()
+	resp, body := get(t, ts.URL+"/"+layout.CheckpointPath+"?wait=true", nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, testdata.Checkpoint(t, 5)) {
+		t.Errorf("Long poll got status %d and %q, want checkpoint of size 5", resp.StatusCode, body)
+	}
+	if d := time.Since(start); d < s.LongPollTimeout {
+		t.Errorf("Long poll returned after %v, before the timeout", d)
+	}
+
+	// A new checkpoint is returned as soon as it's published.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		hfs.size.Store(9)
+	}()
+	resp, body = get(t, ts.URL+"/"+layout.CheckpointPath+"?wait=1", nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, testdata.Checkpoint(t, 9)) {
+		t.Errorf("Long poll got status %d and %q, want checkpoint of size 9", resp.StatusCode, body)
+	}
+
+	if resp, _ := get(t, ts.URL+"/"+layout.CheckpointPath+"?wait=maybe", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Long poll with invalid wait: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestCheckpointETag(t *testing.T) {
+	hfs := &historyFS{FS: os.DirFS(logDir)}
+	hfs.size.Store(5)
+	s := New(hfs, rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	s.PollInterval = 10 * time.Millisecond
+	s.LongPollTimeout = 50 * time.Millisecond
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	u := ts.URL + "/" + layout.CheckpointPath
+
+	resp, _ := get(t, u, nil)
+	tag := resp.Header.Get("ETag")
+	if len(tag) == 0 {
+		t.Fatal("Checkpoint has no ETag")
+	}
+	hdr := http.Header{"If-None-Match": {tag}}
+	if resp, _ := get(t, u, hdr); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Unchanged checkpoint: status %d, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+	// A long-poll which times out doesn't send the checkpoint again.
+	if resp, _ := get(t, u+"?wait=true", hdr); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Long poll of unchanged checkpoint: status %d, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+
+	hfs.size.Store(9)
+	resp, body := get(t, u, hdr)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, testdata.Checkpoint(t, 9)) {
+		t.Errorf("Changed checkpoint: got status %d and %q, want checkpoint of size 9", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") == tag {
+		t.Error("Changed checkpoint has the same ETag")
+	}
+	// A client which is behind doesn't wait.
+	s.LongPollTimeout = time.Minute
+	if resp, _ := get(t, u+"?wait=true", hdr); resp.StatusCode != http.StatusOK {
+		t.Errorf("Long poll of changed checkpoint: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestCheckpointEvents(t *testing.T) {
+	hfs := &historyFS{FS: os.DirFS(logDir)}
+	hfs.size.Store(5)
+	s := New(hfs, rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	s.PollInterval = 10 * time.Millisecond
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + CheckpointEventsPath)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Got Content-Type %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	// next reads an event, and checks that it holds the checkpoint of the
+	// given size.
+	next := func(size int) {
+		t.Helper()
+		var id string
+		var data []string
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString: %v", err)
+			}
+			l = strings.TrimSuffix(l, "\n")
+			if len(l) == 0 {
+				break
+			}
+			switch f, v, _ := strings.Cut(l, ": "); f {
+			case "id":
+				id = v
+			case "data":
+				data = append(data, v)
+			}
+		}
+		if want := fmt.Sprint(size); id != want {
+			t.Errorf("Got event ID %q, want %q", id, want)
+		}
+		if got, want := strings.Join(data, "\n")+"\n", string(testdata.Checkpoint(t, size)); got != want {
+			t.Errorf("Got checkpoint %q, want %q", got, want)
+		}
+	}
+	next(5)
+	hfs.size.Store(9)
+	next(9)
+	hfs.size.Store(15)
+	next(15)
+}
+
+func TestCORS(t *testing.T) {
+	s := New(os.DirFS(logDir), rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	for _, test := range []struct {
+		desc      string
+		origins   []string
+		origin    string
+		wantAllow string
+	}{
+		{desc: "any", origins: []string{"*"}, origin: "https://a.example", wantAllow: "*"},
+		{desc: "listed", origins: []string{"https://a.example", "https://b.example"}, origin: "https://b.example", wantAllow: "https://b.example"},
+		{desc: "unlisted", origins: []string{"https://a.example"}, origin: "https://c.example"},
+		{desc: "same origin", origins: []string{"https://a.example"}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ts := httptest.NewServer(WithCORS(s.Handler(), test.origins))
+			defer ts.Close()
+			hdr := http.Header{}
+			if len(test.origin) > 0 {
+				hdr.Set("Origin", test.origin)
+			}
+
+			for _, p := range []string{"/" + layout.CheckpointPath, "/" + path.Join(layout.TilePath("", 0, 0, 15)), InclusionProofJSONPath + "?index=3&size=7"} {
+				resp, _ := get(t, ts.URL+p, hdr)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("Get(%q): status %d", p, resp.StatusCode)
+				}
+				if got := resp.Header.Get("Access-Control-Allow-Origin"); got != test.wantAllow {
+					t.Errorf("Get(%q) got Access-Control-Allow-Origin %q, want %q", p, got, test.wantAllow)
+				}
+				if len(test.wantAllow) > 0 && resp.Header.Get("Access-Control-Expose-Headers") != "ETag" {
+					t.Errorf("Get(%q) doesn't expose ETag", p)
+				}
+			}
+
+			req, err := http.NewRequest(http.MethodOptions, ts.URL+InclusionProofPath, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			req.Header = hdr.Clone()
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Preflight: %v", err)
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != test.wantAllow {
+				t.Errorf("Preflight got Access-Control-Allow-Origin %q, want %q", got, test.wantAllow)
+			}
+			if len(test.wantAllow) > 0 && resp.StatusCode != http.StatusNoContent {
+				t.Errorf("Preflight got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	cpRaw := testdata.Checkpoint(t, 15)
+	_, vkey, err := note.GenerateKey(rand.Reader, "other")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherV, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	for _, test := range []struct {
+		desc      string
+		fsys      fs.FS
+		v         note.Verifier
+		maxAge    time.Duration
+		drain     bool
+		wantReady bool
+	}{
+		{
+			desc:      "ready",
+			fsys:      fstest.MapFS{layout.CheckpointPath: {Data: cpRaw, ModTime: time.Now()}},
+			wantReady: true,
+		}, {
+			desc:      "fresh",
+			fsys:      fstest.MapFS{layout.CheckpointPath: {Data: cpRaw, ModTime: time.Now().Add(-time.Minute)}},
+			maxAge:    time.Hour,
+			wantReady: true,
+		}, {
+			desc:   "stale",
+			fsys:   fstest.MapFS{layout.CheckpointPath: {Data: cpRaw, ModTime: time.Now().Add(-2 * time.Hour)}},
+			maxAge: time.Hour,
+		}, {
+			desc:  "draining",
+			fsys:  fstest.MapFS{layout.CheckpointPath: {Data: cpRaw, ModTime: time.Now()}},
+			drain: true,
+		}, {
+			desc: "no checkpoint",
+			fsys: fstest.MapFS{},
+		}, {
+			desc: "wrong key",
+			fsys: fstest.MapFS{layout.CheckpointPath: {Data: cpRaw, ModTime: time.Now()}},
+			v:    otherV,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			v := test.v
+			if v == nil {
+				v = testdata.LogSigVerifier(t)
+			}
+			s := New(test.fsys, rfc6962.DefaultHasher, v, testdata.TestLogOrigin)
+			s.MaxCheckpointAge = test.maxAge
+			if test.drain {
+				s.Drain()
+			}
+			ts := httptest.NewServer(s.Handler())
+			defer ts.Close()
+
+			if resp, _ := get(t, ts.URL+HealthzPath, nil); resp.StatusCode != http.StatusOK {
+				t.Errorf("Healthz: status %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			want := http.StatusServiceUnavailable
+			if test.wantReady {
+				want = http.StatusOK
+			}
+			resp, body := get(t, ts.URL+ReadyzPath, nil)
+			if resp.StatusCode != want {
+				t.Errorf("Readyz: status %d (%q), want %d", resp.StatusCode, body, want)
+			}
+			if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Readyz got Cache-Control %q, want no-store", got)
+			}
+		})
+	}
+}
+
+func TestStaticCacheControl(t *testing.T) {
+	tilePath := path.Join(layout.TilePath("", 0, 0, 15))
+	for _, test := range []struct {
+		desc      string
+		immutable bool
+		path      string
+		want      string
+	}{
+		{desc: "checkpoint", path: "/" + layout.CheckpointPath, want: "no-cache"},
+		{desc: "manifest", path: "/" + layout.ManifestPath, want: "no-cache"},
+		{desc: "tile", path: "/" + tilePath},
+		{desc: "immutable checkpoint", immutable: true, path: "/" + layout.CheckpointPath, want: "no-cache"},
+		{desc: "immutable tile", immutable: true, path: "/" + tilePath, want: immutableCacheControl},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			s := New(os.DirFS(logDir), rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+			s.Immutable = test.immutable
+			ts := httptest.NewServer(s.Handler())
+			defer ts.Close()
+			resp, _ := get(t, ts.URL+test.path, nil)
+			if got := resp.Header.Get("Cache-Control"); got != test.want {
+				t.Errorf("Got Cache-Control %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStaticFiles(t *testing.T) {
+	ts := newTestServer(t)
+	tilePath := path.Join(layout.TilePath("", 0, 0, 15))
+	want, err := os.ReadFile(filepath.Join(logDir, tilePath))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(logDir, tilePath))
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	lastModified := fi.ModTime().UTC().Format(http.TimeFormat)
+
+	resp, body := get(t, ts.URL+"/"+tilePath, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, want) {
+		t.Fatalf("Got status %d and body %q, want %d and %q", resp.StatusCode, body, http.StatusOK, want)
+	}
+	if got := resp.Header.Get("Last-Modified"); got != lastModified {
+		t.Errorf("Got Last-Modified %q, want %q", got, lastModified)
+	}
+
+	for _, test := range []struct {
+		desc     string
+		path     string
+		hdr      http.Header
+		wantCode int
+		wantBody []byte
+	}{
+		{desc: "not modified", path: "/" + tilePath, hdr: http.Header{"If-Modified-Since": {lastModified}}, wantCode: http.StatusNotModified},
+		{desc: "range", path: "/" + tilePath, hdr: http.Header{"Range": {"bytes=0-2"}}, wantCode: http.StatusPartialContent, wantBody: want[:3]},
+		{desc: "unclean path", path: "/tile/../" + tilePath, wantCode: http.StatusOK, wantBody: want},
+		{desc: "missing", path: "/tile/nothing", wantCode: http.StatusNotFound},
+		{desc: "directory", path: "/tile/", wantCode: http.StatusOK},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			resp, body := get(t, ts.URL+test.path, test.hdr)
+			if resp.StatusCode != test.wantCode {
+				t.Fatalf("Got status %d, want %d", resp.StatusCode, test.wantCode)
+			}
+			if test.wantBody != nil && !bytes.Equal(body, test.wantBody) {
+				t.Errorf("Got body %q, want %q", body, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestAuditNotServed(t *testing.T) {
+	dir, file := layout.EntrySubmitterPath("", 0)
+	entry := path.Join(dir, file)
+	fsys := fstest.MapFS{
+		"checkpoint": {Data: testdata.Checkpoint(t, 1)},
+		entry:        {Data: []byte("key-a\n")},
+	}
+	s := New(fsys, rfc6962.DefaultHasher, testdata.LogSigVerifier(t), testdata.TestLogOrigin)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	for _, p := range []string{"/" + layout.AuditDir, "/" + layout.AuditDir + "/", "/" + entry, "/x/../" + entry} {
+		if resp, body := get(t, ts.URL+p, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Get(%q): status %d, want %d: %s", p, resp.StatusCode, http.StatusNotFound, body)
+		}
+	}
+	if resp, _ := get(t, ts.URL+"/checkpoint", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("Get(checkpoint): status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
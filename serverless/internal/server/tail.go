@@ -0,0 +1,146 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+
+	fmtlog "github.com/transparency-dev/formats/log"
+)
+
+// errDraining is returned while waiting for a checkpoint once the server is
+// shutting down.
+var errDraining = errors.New("server is shutting down")
+
+// waitForCheckpoint polls the log's checkpoint until it's one for which
+// want returns true, and returns it in both raw and parsed forms. It gives up
+// when ctx is done, or the server is drained.
+func (s *Server) waitForCheckpoint(ctx context.Context, want func(raw []byte, cp *fmtlog.Checkpoint) bool) ([]byte, *fmtlog.Checkpoint, error) {
+	t := time.NewTicker(s.pollInterval())
+	defer t.Stop()
+	for {
+		if s.draining.Load() {
+			return nil, nil, errDraining
+		}
+		raw, err := s.f(ctx, layout.CheckpointPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		cp, _, _, err := fmtlog.ParseCheckpoint(raw, s.origin, s.v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+		}
+		if want(raw, cp) {
+			return raw, cp, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// tailEntries streams the log's entries from the requested index onwards,
+// each with a bundle proving its inclusion under the checkpoint it was read
+// at, until the client disconnects or the server is drained.
+func (s *Server) tailEntries(w http.ResponseWriter, r *http.Request) {
+	next, err := parseUintParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	ctx := r.Context()
+	for {
+		raw, cp, err := s.waitForCheckpoint(ctx, func(_ []byte, cp *fmtlog.Checkpoint) bool { return cp.Size > next })
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, errDraining) {
+				glog.Warningf("Failed to tail entries: %v", err)
+			}
+			return
+		}
+		pb, err := client.NewProofBuilder(ctx, *cp, s.h.HashChildren, s.f)
+		if err != nil {
+			glog.Warningf("Failed to tail entries: failed to create proof builder: %v", err)
+			return
+		}
+		for ; next < cp.Size; next++ {
+			e, err := s.tailEntry(ctx, pb, raw, cp.Size, next)
+			if err != nil {
+				glog.Warningf("Failed to tail entries: %v", err)
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				// The client has gone away.
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// tailEntry returns the entry at index i, or its tombstone if it's been
+// redacted, along with its inclusion proof under the checkpoint cpRaw of the
+// given size.
+func (s *Server) tailEntry(ctx context.Context, pb *client.ProofBuilder, cpRaw []byte, size, i uint64) (*api.TailEntry, error) {
+	e := &api.TailEntry{}
+	var lh []byte
+	data, err := client.GetLeaf(ctx, s.f, i)
+	switch {
+	case errors.Is(err, client.ErrRedacted):
+		r, raw, err := client.FetchTombstone(ctx, s.f, i)
+		if err != nil {
+			return nil, err
+		}
+		e.Tombstone, lh = raw, r.LeafHash
+	case err != nil:
+		return nil, err
+	default:
+		e.Data, lh = data, s.h.HashLeaf(data)
+	}
+	p, err := pb.InclusionProof(ctx, i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build inclusion proof for index %d: %w", i, err)
+	}
+	if p == nil {
+		p = [][]byte{}
+	}
+	e.ProofBundle = api.ProofBundle{
+		Checkpoint: string(cpRaw),
+		LeafHash:   lh,
+		Proof:      api.InclusionProof{Index: i, Size: size, Hashes: p},
+	}
+	return e, nil
+}
@@ -16,17 +16,25 @@
 package fs
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/serverless/api"
 	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
 	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
 )
 
 const (
@@ -39,20 +47,53 @@ const (
 // The on-disk structure is:
 //
 //	<rootDir>/leaves/aa/bb/cc/ddeeff...
+//	<rootDir>/leaves/aa/bb/cc/ddeeff....ids
 //	<rootDir>/leaves/pending/aabbccddeeff...
+//	<rootDir>/leaves/requests/aa/bb/cc/ddeeff...
+//	<rootDir>/leaves/namespaces/aa/bb/cc/ddeeff...
+//	<rootDir>/leaves/instances/seq/aa/bb/cc/ddeeff...
 //	<rootDir>/seq/aa/bb/cc/ddeeff...
+//	<rootDir>/seq/aa/bb/cc/ddeeff....time
+//	<rootDir>/tombstones/seq/aa/bb/cc/ddeeff...
 //	<rootDir>/tile/<level>/aa/bb/ccddee...
+//	<rootDir>/index/aa/bb/cc/ddeeff...
+//	<rootDir>/map/<size>/aa/bb/cc/ddeeff...
+//	<rootDir>/map/pages/aa/bb/cc/ddeeff...
+//	<rootDir>/proof/inclusion/<size>/aa/bb/cc/dd/ee.json
+//	<rootDir>/inventory/<size>
+//	<rootDir>/audit/submitters/aa/bb/cc/ddeeff...
+//	<rootDir>/audit/seq/aa/bb/cc/ddeeff...
 //	<rootDir>/checkpoint
 //
 // The functions on this struct are not thread-safe.
 type Storage struct {
-	// rootDir is the root directory where tree data will be stored.
+	// rootDir is the absolute path of the root directory where tree data will
+	// be stored.
+	// Using absolute paths allows the os package to transparently support
+	// paths longer than MAX_PATH on Windows.
 	rootDir string
+	// resolvedRoot is the absolute form of rootDir with any symlinks
+	// resolved. Files read from storage must resolve to a location within it.
+	resolvedRoot string
 	// nextSeq is a hint to the Sequence func as to what the next available
 	// sequence number is to help performance.
 	// Note that nextSeq may be <= than the actual next available number, but
 	// never greater.
 	nextSeq uint64
+	// immutable is set if the log uses the immutable layout, so partial
+	// tiles must not be replaced once the full tile is written.
+	immutable bool
+	// duplicates is the log's duplicate policy.
+	duplicates api.DuplicatePolicy
+	// maxLeafSize is the largest entry Sequence accepts, or 0 for no limit.
+	maxLeafSize int
+	// prefixIndex is the number of leading bytes of entries IndexPrefix
+	// indexes them by, or 0 if they aren't.
+	prefixIndex int
+	// indexFormat is the format of new entry lists.
+	indexFormat api.IndexFormat
+	// partialTiles is how the log's partial tiles are made available.
+	partialTiles api.PartialTiles
 }
 
 const leavesPendingPathFmt = "leaves/pending/%0x"
@@ -69,12 +110,60 @@ func Load(rootDir string, cpSize uint64) (*Storage, error) {
 		return nil, fmt.Errorf("%q is not a directory", rootDir)
 	}
 
+	absRoot, resolvedRoot, err := resolve(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Storage{
-		rootDir: rootDir,
-		nextSeq: cpSize,
+		rootDir:      absRoot,
+		resolvedRoot: resolvedRoot,
+		nextSeq:      cpSize,
 	}, nil
 }
 
+// SetImmutable sets whether the log uses the immutable layout described by
+// api.Manifest, in which partial tiles are left in place rather than
+// replaced by links to the full tile once it's written.
+func (fs *Storage) SetImmutable(immutable bool) {
+	fs.immutable = immutable
+}
+
+// SetPrefixIndex sets the number of leading bytes of entries by which
+// IndexPrefix indexes them, as described by api.Manifest. The zero value
+// means entries aren't indexed by prefix.
+func (fs *Storage) SetPrefixIndex(n int) {
+	fs.prefixIndex = n
+}
+
+// SetIndexFormat sets the format in which new entry lists, and so their pages
+// and map entries, are written, as described by api.Manifest. Existing lists
+// keep the format they were written in. The zero value means JSON.
+func (fs *Storage) SetIndexFormat(f api.IndexFormat) {
+	fs.indexFormat = f
+}
+
+// SetPartialTiles sets whether partial tiles are stored, or derived when
+// they're read, as described by api.PartialTiles. The zero value means
+// they're stored.
+func (fs *Storage) SetPartialTiles(p api.PartialTiles) {
+	fs.partialTiles = p
+}
+
+// SetDuplicatePolicy sets how Sequence handles entries which have already
+// been sequenced, as described by api.DuplicatePolicy. The zero value is
+// api.DuplicatesReject.
+func (fs *Storage) SetDuplicatePolicy(p api.DuplicatePolicy) {
+	fs.duplicates = p
+}
+
+// SetMaxLeafSize sets the largest entry, in bytes, which Sequence accepts.
+// Larger entries are rejected with an error wrapping log.ErrLeafTooLarge. The
+// zero value means there's no limit.
+func (fs *Storage) SetMaxLeafSize(n int) {
+	fs.maxLeafSize = n
+}
+
 // Create creates a new filesystem hierarchy and returns a Storage representation for it.
 func Create(rootDir string) (*Storage, error) {
 	_, err := os.Stat(rootDir)
@@ -87,99 +176,998 @@ func Create(rootDir string) (*Storage, error) {
 	}
 
 	for _, sfx := range []string{"leaves/pending", "seq", "tile"} {
-		path := filepath.Join(rootDir, sfx)
-		if err := os.MkdirAll(path, dirPerm); err != nil {
-			return nil, fmt.Errorf("failed to create directory %q: %w", path, err)
+		dir := filepath.Join(rootDir, sfx)
+		if err := os.MkdirAll(dir, dirPerm); err != nil {
+			return nil, fmt.Errorf("failed to create directory %q: %w", dir, err)
 		}
 	}
 
+	absRoot, resolvedRoot, err := resolve(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
 	fs := &Storage{
-		rootDir: rootDir,
-		nextSeq: 0,
+		rootDir:      absRoot,
+		resolvedRoot: resolvedRoot,
+		nextSeq:      0,
 	}
 
 	return fs, nil
 }
 
+// resolve returns the absolute path of dir, and the same path with any
+// symlinks resolved.
+func resolve(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to determine absolute path of %q: %w", dir, err)
+	}
+	r, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve %q: %w", abs, err)
+	}
+	return abs, r, nil
+}
+
+// path returns the native filesystem path of the given slash-separated
+// layout path elements, relative to the storage root.
+func (fs *Storage) path(elem ...string) string {
+	return filepath.Join(fs.rootDir, filepath.FromSlash(path.Join(elem...)))
+}
+
+// readFile reads the contents of the file at p, which must resolve to a
+// location inside the storage root.
+// This guards against crafted storage contents (e.g. symlinks) causing data
+// from outside of the log to be read.
+func (fs *Storage) readFile(p string) ([]byte, error) {
+	r, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(r) {
+		if r, err = filepath.Abs(r); err != nil {
+			return nil, err
+		}
+	}
+	if !layout.IsWithin(fs.resolvedRoot, r) {
+		return nil, fmt.Errorf("%w: %q resolves to %q which is outside of storage root", layout.ErrInvalidPath, p, r)
+	}
+	return os.ReadFile(r)
+}
+
+// fetch is a client.Fetcher which reads the file at the layout path p.
+func (fs *Storage) fetch(_ context.Context, p string) ([]byte, error) {
+	return fs.readFile(fs.path(p))
+}
+
 // Sequence assigns the given leaf entry to the next available sequence number.
-// This method will attempt to silently squash duplicate leaves, but it cannot
-// be guaranteed that no duplicate entries will exist.
+// Unless the duplicate policy is api.DuplicatesAllow, this method will attempt
+// to silently squash duplicate leaves, but it cannot be guaranteed that no
+// duplicate entries will exist.
 // Returns the sequence number assigned to this leaf (if the leaf has already
-// been sequenced it will return the original sequence number and ErrDupeLeaf).
+// been sequenced it will return the original sequence number, along with
+// ErrDupeLeaf if the policy is api.DuplicatesReject).
+// Entries with the format of a padding entry are rejected with
+// ErrPaddingEntry.
+//
+// If the policy is api.DuplicatesPerNamespace, the entry is sequenced as one
+// submitted without identifiers, as by SequenceIdentified.
 func (fs *Storage) Sequence(_ context.Context, leafhash []byte, leaf []byte) (uint64, error) {
+	return fs.sequence(leafhash, leaf, nil)
+}
+
+// DuplicatesPerNamespace returns true if the duplicate policy is
+// api.DuplicatesPerNamespace, as described by log.NamespaceSequencer.
+func (fs *Storage) DuplicatesPerNamespace() bool {
+	return fs.duplicates == api.DuplicatesPerNamespace
+}
+
+// SequenceIdentified is like Sequence, or SequenceRequest if requestID isn't
+// empty, for an entry submitted with the identifiers ids, as described by
+// log.NamespaceSequencer. Unless the duplicate policy is
+// api.DuplicatesPerNamespace, ids are ignored.
+func (fs *Storage) SequenceIdentified(ctx context.Context, requestID string, leafhash []byte, leaf []byte, ids []string) (uint64, error) {
+	if len(requestID) > 0 {
+		return fs.sequenceRequest(ctx, requestID, leafhash, leaf, ids)
+	}
+	return fs.sequence(leafhash, leaf, ids)
+}
+
+// sequence implements Sequence for an entry submitted with the identifiers
+// ids, which only matter if the policy is api.DuplicatesPerNamespace.
+func (fs *Storage) sequence(leafhash []byte, leaf []byte, ids []string) (uint64, error) {
 	// 1. Check for dupe leafhash
 	// 2. Write temp file
 	// 3. Hard link temp -> seq file
 	// 4. Create leafhash file containing assigned sequence number
 
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return 0, err
+	}
+	if api.IsPaddingEntry(leaf) {
+		return 0, log.ErrPaddingEntry
+	}
+	if fs.maxLeafSize > 0 && len(leaf) > fs.maxLeafSize {
+		return 0, fmt.Errorf("leaf is %d bytes, more than the limit of %d: %w", len(leaf), fs.maxLeafSize, log.ErrLeafTooLarge)
+	}
 	// Ensure the leafhash directory structure is present
-	leafDir, leafFile := layout.LeafPath(fs.rootDir, leafhash)
-	if err := os.MkdirAll(leafDir, dirPerm); err != nil {
+	leafDir, leafFile := layout.LeafPath("", leafhash)
+	if err := os.MkdirAll(fs.path(leafDir), dirPerm); err != nil {
 		return 0, fmt.Errorf("failed to make leaf directory structure: %w", err)
 	}
+	leafFQ := fs.path(leafDir, leafFile)
+	if fs.duplicates == api.DuplicatesPerNamespace {
+		return fs.sequenceInNamespaces(leafFQ, leafhash, leaf, ids)
+	}
 	// Check for dupe leaf already present.
 	// If there is one, it should contain the existing leaf's sequence number,
 	// so read that back and return it.
-	leafFQ := filepath.Join(leafDir, leafFile)
-	if seqString, err := os.ReadFile(leafFQ); !os.IsNotExist(err) {
-		origSeq, err := strconv.ParseUint(string(seqString), 16, 64)
+	if seqString, err := fs.readFile(leafFQ); !os.IsNotExist(err) && fs.duplicates != api.DuplicatesAllow {
+		if err != nil {
+			return 0, fmt.Errorf("failed to read leafhash file: %w", err)
+		}
+		origSeq, err := api.ParseLeafIndex(seqString)
 		if err != nil {
 			return 0, err
 		}
+		if fs.duplicates == api.DuplicatesOriginal {
+			return origSeq, nil
+		}
 		return origSeq, log.ErrDupeLeaf
 	}
 
 	// Write a temp file with the leaf data
-	tmp := filepath.Join(fs.rootDir, fmt.Sprintf(leavesPendingPathFmt, leafhash))
+	tmp := fs.path(fmt.Sprintf(leavesPendingPathFmt, leafhash))
+	if err := createExclusive(tmp, leaf); err != nil {
+		return 0, fmt.Errorf("unable to write temporary file: %w", err)
+	}
+	defer func() {
+		os.Remove(tmp)
+	}()
+
+	seq, err := fs.linkNextSeq(tmp, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create a leafhash file containing the assigned sequence number, unless
+	// this is a duplicate, in which case the original's is kept.
+	// This isn't infallible though, if we crash after hardlinking the
+	// sequence file above, but before doing this a resubmission of the
+	// same leafhash would be permitted. Any such missing leafhash files
+	// are recreated by IndexLeaf when the leaf is integrated.
+	if err := writeLeafIndex(leafFQ, seq); err != nil {
+		return 0, err
+	}
+
+	// All done!
+	return seq, nil
+}
+
+// sequenceLockFileName is the lock held while sequencing an entry into a log
+// whose duplicate policy is api.DuplicatesPerNamespace.
+const sequenceLockFileName = ".sequence.lock"
+
+// sequenceInNamespaces sequences the entry with the given leafhash, whose
+// leafhash file is at leafFQ, into a log whose duplicate policy is
+// api.DuplicatesPerNamespace. It's a duplicate if an earlier instance was
+// submitted in any of the namespaces of ids, or without identifiers if ids is
+// empty.
+//
+// The identifiers of each instance are recorded by its sequence number before
+// it's sequenced, so that IndexIdentifiers associates it with its own
+// identifiers. Since the sequence number isn't known until then, sequencing is
+// serialised by a lock, so that concurrent submissions can't overwrite each
+// other's records.
+func (fs *Storage) sequenceInNamespaces(leafFQ string, leafhash []byte, leaf []byte, ids []string) (uint64, error) {
+	for _, id := range ids {
+		if err := api.ValidateIdentifier(id); err != nil {
+			return 0, err
+		}
+	}
+	unlock, err := waitLock(fs.path(sequenceLockFileName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock storage for sequencing: %w", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage after sequencing: %v", err)
+		}
+	}()
+
+	for _, ns := range instanceNamespaces(ids) {
+		seqString, err := fs.readFile(fs.path(layout.NamespaceLeafPath("", api.NamespaceLeafKey(ns, leafhash))))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read namespace leafhash file: %w", err)
+		}
+		origSeq, err := api.ParseLeafIndex(seqString)
+		if err != nil {
+			return 0, err
+		}
+		return origSeq, log.ErrDupeLeaf
+	}
+
+	tmp := fs.path(fmt.Sprintf(leavesPendingPathFmt, leafhash))
+	if err := createExclusive(tmp, leaf); err != nil {
+		return 0, fmt.Errorf("unable to write temporary file: %w", err)
+	}
+	defer func() {
+		os.Remove(tmp)
+	}()
+	inst := &api.InstanceIdentifiers{LeafHash: leafhash, Identifiers: ids}
+	seq, err := fs.linkNextSeq(tmp, inst)
+	if err != nil {
+		return 0, err
+	}
+	// As in Sequence, the leafhash file keeps the first instance's number.
+	if err := writeLeafIndex(leafFQ, seq); err != nil {
+		return 0, err
+	}
+	if err := fs.indexNamespaces(inst, seq); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// instanceNamespaces returns the namespaces an instance of an entry submitted
+// with the identifiers ids is added in, which is the empty namespace if there
+// are none.
+func instanceNamespaces(ids []string) []string {
+	if len(ids) == 0 {
+		return []string{""}
+	}
+	return api.IdentifierNamespaces(ids)
+}
+
+// indexNamespaces records that the instance of an entry at sequence number
+// seq was added in each of the namespaces of its identifiers, unless an
+// earlier instance already was.
+func (fs *Storage) indexNamespaces(inst *api.InstanceIdentifiers, seq uint64) error {
+	for _, ns := range instanceNamespaces(inst.Identifiers) {
+		nsDir, nsFile := layout.NamespaceLeafPath("", api.NamespaceLeafKey(ns, inst.LeafHash))
+		if err := os.MkdirAll(fs.path(nsDir), dirPerm); err != nil {
+			return fmt.Errorf("failed to make namespace directory structure: %w", err)
+		}
+		if err := writeLeafIndex(fs.path(nsDir, nsFile), seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeInstanceIdentifiers records the identifiers of the instance of an
+// entry at sequence number seq, replacing any earlier record.
+func (fs *Storage) writeInstanceIdentifiers(seq uint64, inst *api.InstanceIdentifiers) error {
+	instDir, instFile := layout.InstanceIdentifiersPath("", seq)
+	if err := os.MkdirAll(fs.path(instDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make instance directory structure: %w", err)
+	}
+	instFQ := fs.path(instDir, instFile)
+	tmp := fmt.Sprintf("%s.tmp", instFQ)
+	if err := createExclusive(tmp, inst.Marshal()); err != nil {
+		return fmt.Errorf("couldn't create temporary instance identifiers file: %w", err)
+	}
+	return rename(tmp, instFQ)
+}
+
+// SetInstanceIdentifiers records that the instance of the entry with the
+// given leafhash at sequence number seq was submitted with the identifiers
+// ids, for use when rebuilding a log whose duplicate policy is
+// api.DuplicatesPerNamespace, and whose order is already known.
+func (fs *Storage) SetInstanceIdentifiers(_ context.Context, seq uint64, leafhash []byte, ids []string) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := api.ValidateIdentifier(id); err != nil {
+			return err
+		}
+	}
+	inst := &api.InstanceIdentifiers{LeafHash: leafhash, Identifiers: ids}
+	if err := fs.writeInstanceIdentifiers(seq, inst); err != nil {
+		return err
+	}
+	return fs.indexNamespaces(inst, seq)
+}
+
+// requestPendingSuffix is the suffix of the file alongside a request record
+// which records that the submission is in progress.
+const requestPendingSuffix = ".pending"
+
+// SequenceRequest is like Sequence, but for an entry submitted with the given
+// request ID, so that retried submissions are assigned the same sequence
+// number rather than being added again, as described by log.RequestSequencer.
+//
+// Before sequencing, the submission is recorded as pending along with the
+// next sequence number, so that if it's interrupted after the entry is
+// sequenced, a retry finds the entry by scanning the entries sequenced since
+// rather than adding it again. As with Sequence, concurrent submissions of
+// the same request may still both be added.
+func (fs *Storage) SequenceRequest(ctx context.Context, requestID string, leafhash []byte, leaf []byte) (uint64, error) {
+	return fs.sequenceRequest(ctx, requestID, leafhash, leaf, nil)
+}
+
+// sequenceRequest implements SequenceRequest for an entry submitted with the
+// identifiers ids, as for sequence.
+func (fs *Storage) sequenceRequest(ctx context.Context, requestID string, leafhash []byte, leaf []byte, ids []string) (uint64, error) {
+	if err := api.ValidateRequestID(requestID); err != nil {
+		return 0, err
+	}
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return 0, err
+	}
+	reqDir, reqFile := layout.RequestPath("", api.RequestKey(requestID))
+	reqFQ := fs.path(reqDir, reqFile)
+	if r, err := fs.readRequest(reqFQ, leafhash); err == nil {
+		return r.Seq, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	pendingFQ := reqFQ + requestPendingSuffix
+	p, err := fs.readRequest(pendingFQ, leafhash)
+	switch {
+	case err == nil:
+		// An earlier attempt was interrupted, and may have sequenced the
+		// entry before it could record the outcome.
+		seq, found, err := fs.findSequenced(ctx, p.Seq, leaf)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			glog.Infof("Found entry %d sequenced by an interrupted submission of the same request", seq)
+			return seq, fs.recordRequest(reqFQ, pendingFQ, leafhash, seq)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if err := os.MkdirAll(fs.path(reqDir), dirPerm); err != nil {
+			return 0, fmt.Errorf("failed to make request directory structure: %w", err)
+		}
+		if err := createExclusive(pendingFQ, api.RequestRecord{LeafHash: leafhash, Seq: fs.nextSeq}.Marshal()); err != nil {
+			return 0, fmt.Errorf("failed to record pending request: %w", err)
+		}
+	default:
+		return 0, err
+	}
+
+	seq, err := fs.sequence(leafhash, leaf, ids)
+	if errors.Is(err, log.ErrDupeLeaf) {
+		// The rejection is the outcome of every retry too, since they'll
+		// find the same earlier entry.
+		if err := os.Remove(pendingFQ); err != nil {
+			glog.Warningf("Failed to remove pending request record: %v", err)
+		}
+		return seq, err
+	} else if err != nil {
+		return 0, err
+	}
+	return seq, fs.recordRequest(reqFQ, pendingFQ, leafhash, seq)
+}
+
+// readRequest reads the request record at the path p, checking that it's for
+// the entry with the given leaf hash.
+func (fs *Storage) readRequest(p string, leafhash []byte) (*api.RequestRecord, error) {
+	raw, err := fs.readFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read request record: %w", err)
+	}
+	r, err := api.ParseRequestRecord(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(r.LeafHash, leafhash) {
+		return nil, fmt.Errorf("request was for leaf hash %x, not %x: %w", r.LeafHash, leafhash, log.ErrRequestConflict)
+	}
+	return r, nil
+}
+
+// recordRequest records that the request whose record is at the path reqFQ
+// was assigned seq, and removes its pending record at pendingFQ.
+func (fs *Storage) recordRequest(reqFQ, pendingFQ string, leafhash []byte, seq uint64) error {
+	tmp := reqFQ + ".tmp"
+	if err := createExclusive(tmp, api.RequestRecord{LeafHash: leafhash, Seq: seq}.Marshal()); err != nil {
+		return fmt.Errorf("couldn't create temporary request record: %w", err)
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, reqFQ); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary request record in place: %w", err)
+	}
+	if err := os.Remove(pendingFQ); err != nil && !errors.Is(err, os.ErrNotExist) {
+		glog.Warningf("Failed to remove pending request record: %v", err)
+	}
+	return nil
+}
+
+// findSequenced returns the sequence number of the first entry at or after
+// begin which is the same as leaf, and whether there is one.
+func (fs *Storage) findSequenced(ctx context.Context, begin uint64, leaf []byte) (uint64, bool, error) {
+	var seq uint64
+	found := errors.New("found")
+	_, err := fs.ScanSequenced(ctx, begin, func(s uint64, entry []byte) error {
+		if bytes.Equal(entry, leaf) {
+			seq = s
+			return found
+		}
+		return nil
+	})
+	if errors.Is(err, found) {
+		return seq, true, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to scan sequenced entries: %w", err)
+	}
+	return 0, false, nil
+}
+
+// SequencePadding assigns the given padding entry to the next available
+// sequence number. Padding entries are distinct, and left out of the leafhash
+// index, so unlike Sequence it doesn't check for duplicates.
+func (fs *Storage) SequencePadding(_ context.Context, leafhash []byte, leaf []byte) (uint64, error) {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return 0, err
+	}
+	if !api.IsPaddingEntry(leaf) {
+		return 0, errors.New("not a padding entry")
+	}
+	tmp := fs.path(fmt.Sprintf(leavesPendingPathFmt, leafhash))
 	if err := createExclusive(tmp, leaf); err != nil {
 		return 0, fmt.Errorf("unable to write temporary file: %w", err)
 	}
 	defer func() {
 		os.Remove(tmp)
 	}()
+	return fs.linkNextSeq(tmp, nil)
+}
 
-	// Now try to sequence it, we may have to scan over some newly sequenced entries
-	// if Sequence has been called since the last time an Integrate/WriteCheckpoint
-	// was called.
+// linkNextSeq hardlinks the sequence file for the next available sequence
+// number to the entry in the file tmp, records the time at which it was
+// sequenced, and returns the sequence number. If inst is set, the identifiers
+// of the instance are recorded for the sequence number before it's linked.
+func (fs *Storage) linkNextSeq(tmp string, inst *api.InstanceIdentifiers) (uint64, error) {
+	// We may have to scan over some newly sequenced entries if Sequence has
+	// been called since the last time an Integrate/WriteCheckpoint was called.
 	for {
 		seq := fs.nextSeq
 
 		// Ensure the sequencing directory structure is present:
-		seqDir, seqFile := layout.SeqPath(fs.rootDir, seq)
-		if err := os.MkdirAll(seqDir, dirPerm); err != nil {
+		seqDir, seqFile := layout.SeqPath("", seq)
+		if err := os.MkdirAll(fs.path(seqDir), dirPerm); err != nil {
 			return 0, fmt.Errorf("failed to make seq directory structure: %w", err)
 		}
 
+		seqPath := fs.path(seqDir, seqFile)
+		if inst != nil {
+			if _, err := os.Stat(seqPath); err == nil {
+				fs.nextSeq++
+				continue
+			}
+			if err := fs.writeInstanceIdentifiers(seq, inst); err != nil {
+				return 0, err
+			}
+		}
+
 		// Hardlink the sequence file to the temporary file
-		seqPath := filepath.Join(seqDir, seqFile)
 		if err := os.Link(tmp, seqPath); errors.Is(err, os.ErrExist) {
-			// That sequence number is in use, try the next one
+			// That sequence number is in use, try the next one. Any record of
+			// the identifiers of the entry which took it isn't ours to keep.
+			if inst != nil {
+				if err := os.Remove(fs.path(layout.InstanceIdentifiersPath("", seq))); err != nil {
+					glog.Warningf("Failed to remove instance identifiers of entry %d: %v", seq, err)
+				}
+			}
 			fs.nextSeq++
 			continue
 		} else if err != nil {
 			return 0, fmt.Errorf("failed to link seq file: %w", err)
 		}
+		// The entry is already sequenced, so failing to record the time isn't
+		// fatal: SequencedTime falls back to the sequence file's mtime.
+		t := []byte(strconv.FormatInt(time.Now().UnixNano(), 10) + "\n")
+		if err := createExclusive(seqPath+seqTimeSuffix, t); err != nil {
+			glog.Warningf("Failed to record sequencing time of entry %d: %v", seq, err)
+		}
+		return seq, nil
+	}
+}
 
-		// Create a leafhash file containing the assigned sequence number.
-		// This isn't infallible though, if we crash after hardlinking the
-		// sequence file above, but before doing this a resubmission of the
-		// same leafhash would be permitted.
-		//
-		// First create a temp file
-		leafTmp := fmt.Sprintf("%s.tmp", leafFQ)
-		if err := createExclusive(leafTmp, []byte(strconv.FormatUint(seq, 16))); err != nil {
-			return 0, fmt.Errorf("couldn't create temporary leafhash file: %w", err)
+// seqTimeSuffix is the suffix of the file alongside each sequence file which
+// records the time at which the entry was sequenced, in unix nanoseconds.
+const seqTimeSuffix = ".time"
+
+// SequencedTime returns the time at which the entry at sequence number seq was
+// sequenced. Entries added by SequenceAt, or by older versions of Sequence,
+// have no recorded time, so the modification time of their sequence file is
+// used instead.
+func (fs *Storage) SequencedTime(_ context.Context, seq uint64) (time.Time, error) {
+	sp := fs.path(layout.SeqPath("", seq))
+	raw, err := fs.readFile(sp + seqTimeSuffix)
+	if err == nil {
+		ns, err := strconv.ParseInt(strings.TrimSuffix(string(raw), "\n"), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid sequencing time of entry %d: %w", seq, err)
 		}
-		defer os.Remove(leafTmp)
-		// Link the temporary file in place, if it already exists we likely crashed after
-		//creating the tmp file above.
-		if err := os.Link(leafTmp, leafFQ); err != nil && !errors.Is(err, os.ErrExist) {
-			return 0, fmt.Errorf("couldn't link temporary leafhash file in place: %w", err)
+		return time.Unix(0, ns), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, fmt.Errorf("failed to read sequencing time of entry %d: %w", seq, err)
+	}
+	fi, err := os.Stat(sp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat entry %d: %w", seq, err)
+	}
+	return fi.ModTime(), nil
+}
+
+// SequenceAt stores the given leaf entry at sequence number seq, for use when
+// rebuilding a log whose order is already known. Unlike Sequence it doesn't
+// squash duplicate leaves, or create the leafhash file: that's done by
+// IndexLeaf when the entry is integrated.
+// Returns an error wrapping os.ErrExist if seq is already in use.
+func (fs *Storage) SequenceAt(_ context.Context, seq uint64, leafhash []byte, leaf []byte) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	tmp := fs.path(fmt.Sprintf(leavesPendingPathFmt, leafhash))
+	if err := createExclusive(tmp, leaf); err != nil {
+		return fmt.Errorf("unable to write temporary file: %w", err)
+	}
+	defer func() {
+		os.Remove(tmp)
+	}()
+
+	seqDir, seqFile := layout.SeqPath("", seq)
+	if err := os.MkdirAll(fs.path(seqDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make seq directory structure: %w", err)
+	}
+	if err := os.Link(tmp, fs.path(seqDir, seqFile)); err != nil {
+		return fmt.Errorf("failed to link seq file: %w", err)
+	}
+	return nil
+}
+
+// writeLeafIndex creates the leafhash file at leafFQ containing seq, unless
+// it already exists.
+func writeLeafIndex(leafFQ string, seq uint64) error {
+	// First create a temp file
+	leafTmp := fmt.Sprintf("%s.tmp", leafFQ)
+	if err := createExclusive(leafTmp, api.MarshalLeafIndex(seq)); err != nil {
+		return fmt.Errorf("couldn't create temporary leafhash file: %w", err)
+	}
+	defer os.Remove(leafTmp)
+	// Link the temporary file in place, if it already exists we likely crashed after
+	//creating the tmp file above.
+	if err := os.Link(leafTmp, leafFQ); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary leafhash file in place: %w", err)
+	}
+	return nil
+}
+
+// LookupIndex returns the sequence number assigned to the leaf with the given
+// hash, or an error wrapping os.ErrNotExist if the leaf hash is unknown.
+func (fs *Storage) LookupIndex(_ context.Context, leafhash []byte) (uint64, error) {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return 0, err
+	}
+	seqString, err := fs.readFile(fs.path(layout.LeafPath("", leafhash)))
+	if err != nil {
+		return 0, err
+	}
+	return api.ParseLeafIndex(seqString)
+}
+
+// IndexLeaf records seq as the sequence number of the leaf with the given
+// hash, unless the leaf hash has already been mapped to a sequence number.
+func (fs *Storage) IndexLeaf(_ context.Context, leafhash []byte, seq uint64) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	leafDir, leafFile := layout.LeafPath("", leafhash)
+	leafFQ := fs.path(leafDir, leafFile)
+	if _, err := os.Lstat(leafFQ); !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(fs.path(leafDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make leaf directory structure: %w", err)
+	}
+	if err := writeLeafIndex(leafFQ, seq); err != nil && !errors.Is(err, os.ErrExist) {
+		// ErrExist means a concurrent Sequence call is creating the mapping.
+		return err
+	}
+	return nil
+}
+
+// SetIdentifiers records the application identifiers associated with the
+// entry with the given leafhash. It should be called before the entry is
+// sequenced, so that the identifiers are present when it's integrated.
+// Identifiers are only recorded for the first submission of an entry, later
+// calls for the same leafhash have no effect.
+func (fs *Storage) SetIdentifiers(_ context.Context, leafhash []byte, ids []string) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := api.ValidateIdentifier(id); err != nil {
+			return err
 		}
+	}
+	idsDir, idsFile := layout.IdentifiersPath("", leafhash)
+	if err := os.MkdirAll(fs.path(idsDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make leaf directory structure: %w", err)
+	}
+	idsFQ := fs.path(idsDir, idsFile)
+	tmp := fmt.Sprintf("%s.tmp", idsFQ)
+	if err := createExclusive(tmp, api.MarshalIdentifiers(ids)); err != nil {
+		return fmt.Errorf("couldn't create temporary identifiers file: %w", err)
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, idsFQ); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary identifiers file in place: %w", err)
+	}
+	return nil
+}
 
-		// All done!
-		return seq, nil
+// SetClaim records the signed claim to the identifiers associated with the
+// entry with the given leafhash, as verified by api.Namespaces.VerifyClaim.
+// Like SetIdentifiers, it should be called before the entry is sequenced, and
+// only the first claim for a leafhash is recorded.
+func (fs *Storage) SetClaim(_ context.Context, leafhash []byte, claim []byte) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	claimDir, claimFile := layout.ClaimPath("", leafhash)
+	if err := os.MkdirAll(fs.path(claimDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make leaf directory structure: %w", err)
 	}
+	claimFQ := fs.path(claimDir, claimFile)
+	tmp := fmt.Sprintf("%s.tmp", claimFQ)
+	if err := createExclusive(tmp, claim); err != nil {
+		return fmt.Errorf("couldn't create temporary claim file: %w", err)
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, claimFQ); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary claim file in place: %w", err)
+	}
+	return nil
+}
+
+// SetContentType records the content type the entry with the given leafhash
+// is tagged with. Like SetIdentifiers, it should be called before the entry
+// is sequenced, and only the first content type for a leafhash is recorded.
+func (fs *Storage) SetContentType(_ context.Context, leafhash []byte, t string) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	if err := api.ValidateContentType(t); err != nil {
+		return err
+	}
+	typeDir, typeFile := layout.ContentTypePath("", leafhash)
+	if err := os.MkdirAll(fs.path(typeDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make leaf directory structure: %w", err)
+	}
+	typeFQ := fs.path(typeDir, typeFile)
+	tmp := fmt.Sprintf("%s.tmp", typeFQ)
+	if err := createExclusive(tmp, api.MarshalContentType(t)); err != nil {
+		return fmt.Errorf("couldn't create temporary content type file: %w", err)
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, typeFQ); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary content type file in place: %w", err)
+	}
+	return nil
+}
+
+// RecordSubmission appends r to the audit log of the submissions of the given
+// submitter, and records them as the submitter of the entry r.Seq unless one
+// already is. Each record is appended with a single write, so processes
+// sequencing entries concurrently don't interleave them.
+func (fs *Storage) RecordSubmission(_ context.Context, submitter string, r api.SubmissionRecord) error {
+	if err := api.ValidateSubmitter(submitter); err != nil {
+		return err
+	}
+	if err := layout.ValidateLeafHash(r.LeafHash); err != nil {
+		return err
+	}
+	subDir, subFile := layout.SubmitterPath("", api.SubmitterKey(submitter))
+	if err := os.MkdirAll(fs.path(subDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make audit directory structure: %w", err)
+	}
+	f, err := os.OpenFile(fs.path(subDir, subFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open submitter audit log: %w", err)
+	}
+	if _, err := f.Write(r.Marshal()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append to submitter audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close submitter audit log: %w", err)
+	}
+
+	entryDir, entryFile := layout.EntrySubmitterPath("", r.Seq)
+	if err := os.MkdirAll(fs.path(entryDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make audit directory structure: %w", err)
+	}
+	entryFQ := fs.path(entryDir, entryFile)
+	tmp := fmt.Sprintf("%s.tmp", entryFQ)
+	if err := createExclusive(tmp, []byte(submitter+"\n")); err != nil {
+		return fmt.Errorf("couldn't create temporary submitter file: %w", err)
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, entryFQ); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("couldn't link temporary submitter file in place: %w", err)
+	}
+	return nil
+}
+
+// Submissions returns the records of the submissions made by the given
+// submitter at or after from and before to, oldest first.
+func (fs *Storage) Submissions(_ context.Context, submitter string, from, to time.Time) ([]api.SubmissionRecord, error) {
+	raw, err := fs.readFile(fs.path(layout.SubmitterPath("", api.SubmitterKey(submitter))))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read submitter audit log: %w", err)
+	}
+	all, err := api.ParseSubmissionRecords(raw)
+	if err != nil {
+		return nil, err
+	}
+	var r []api.SubmissionRecord
+	for _, s := range all {
+		if !s.Time.Before(from) && s.Time.Before(to) {
+			r = append(r, s)
+		}
+	}
+	// Concurrent sequencers may have appended records slightly out of order.
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Time.Before(r[j].Time) })
+	return r, nil
+}
+
+// EntrySubmitter returns the identity of the submitter who added the entry
+// with the given sequence number, as recorded by RecordSubmission.
+func (fs *Storage) EntrySubmitter(_ context.Context, seq uint64) (string, error) {
+	raw, err := fs.readFile(fs.path(layout.EntrySubmitterPath("", seq)))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(raw), "\n"), nil
+}
+
+// Redact withholds the data of the entry at the given sequence number, which
+// must have been integrated, storing tombstone in its place. The tombstone is
+// written before the data is removed, so that an interrupted redaction can be
+// retried with the same tombstone. Returns an error wrapping os.ErrExist if
+// the entry already has a different tombstone.
+func (fs *Storage) Redact(_ context.Context, seq uint64, tombstone []byte) error {
+	tDir, tFile := layout.TombstonePath("", seq)
+	if err := os.MkdirAll(fs.path(tDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make tombstone directory structure: %w", err)
+	}
+	tFQ := fs.path(tDir, tFile)
+	tmp := fmt.Sprintf("%s.tmp", tFQ)
+	if err := createExclusive(tmp, tombstone); err != nil {
+		return fmt.Errorf("couldn't create temporary tombstone file: %w", err)
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, tFQ); errors.Is(err, os.ErrExist) {
+		existing, err := fs.readFile(tFQ)
+		if err != nil {
+			return fmt.Errorf("failed to read existing tombstone: %w", err)
+		}
+		if !bytes.Equal(existing, tombstone) {
+			return fmt.Errorf("entry %d already has a different tombstone: %w", seq, os.ErrExist)
+		}
+	} else if err != nil {
+		return fmt.Errorf("couldn't link temporary tombstone file in place: %w", err)
+	}
+	if err := os.Remove(fs.path(layout.SeqPath("", seq))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove data of entry %d: %w", seq, err)
+	}
+	return nil
+}
+
+// IndexIdentifiers adds seq to the entry list of each identifier associated
+// with the leaf with the given hash by SetIdentifiers, unless it's already
+// present. If the identifiers the instance at seq was submitted with were
+// recorded, as they are when the duplicate policy is
+// api.DuplicatesPerNamespace, those are indexed instead.
+func (fs *Storage) IndexIdentifiers(_ context.Context, leafhash []byte, seq uint64) error {
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return err
+	}
+	if raw, err := fs.readFile(fs.path(layout.InstanceIdentifiersPath("", seq))); err == nil {
+		inst, err := api.ParseInstanceIdentifiers(raw)
+		if err != nil {
+			return err
+		}
+		// A record for a different entry was left by a submission which
+		// lost the sequence number to another.
+		if bytes.Equal(inst.LeafHash, leafhash) {
+			return fs.appendIndices(inst.Identifiers, seq)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read instance identifiers: %w", err)
+	}
+	raw, err := fs.readFile(fs.path(layout.IdentifiersPath("", leafhash)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read identifiers: %w", err)
+	}
+	ids, err := api.ParseIdentifiers(raw)
+	if err != nil {
+		return err
+	}
+	return fs.appendIndices(ids, seq)
+}
+
+// appendIndices adds seq to the entry list of each of the identifiers ids.
+func (fs *Storage) appendIndices(ids []string, seq uint64) error {
+	for _, id := range ids {
+		if err := fs.appendIndex(id, seq); err != nil {
+			return fmt.Errorf("failed to index identifier %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// IndexPrefix adds seq to the entry list of the identifier of the leading
+// bytes of entry, as set by SetPrefixIndex, unless it's already present or
+// the entry is too short.
+func (fs *Storage) IndexPrefix(_ context.Context, entry []byte, seq uint64) error {
+	if fs.prefixIndex == 0 || len(entry) < fs.prefixIndex {
+		return nil
+	}
+	return fs.appendIndex(api.PrefixIdentifier(entry[:fs.prefixIndex]), seq)
+}
+
+func (fs *Storage) appendIndex(id string, seq uint64) error {
+	indexDir, indexFile := layout.IndexPath("", api.IdentifierKey(id))
+	indexFQ := fs.path(indexDir, indexFile)
+	l := &api.EntryList{Format: fs.indexFormat, Identifier: id}
+	if raw, err := fs.readFile(indexFQ); err == nil {
+		if l, err = api.ParseEntryList(raw); err != nil {
+			return err
+		}
+		if l.Identifier != id {
+			return fmt.Errorf("entry list for %q found at path of %q", l.Identifier, id)
+		}
+		if l.Last() >= seq {
+			// Already indexed by an earlier, interrupted, integration.
+			return nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	l.Indices = append(l.Indices, seq)
+	if len(l.Indices) == api.EntryPageSize {
+		// The page is written before the list referencing it, so that an
+		// interrupted integration never leaves a dangling reference.
+		ref, err := fs.writeEntryPage(api.EntryList{Format: l.Format, Identifier: id, Indices: l.Indices})
+		if err != nil {
+			return err
+		}
+		l.Pages = append(l.Pages, ref)
+		l.Indices = []uint64{}
+	}
+
+	if err := os.MkdirAll(fs.path(indexDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make index directory structure: %w", err)
+	}
+	tmp := fmt.Sprintf("%s.tmp", indexFQ)
+	if err := createExclusive(tmp, l.Marshal()); err != nil {
+		return fmt.Errorf("failed to create temporary entry list file: %w", err)
+	}
+	return rename(tmp, indexFQ)
+}
+
+// writeEntryPage stores the given page of an entry list, and returns the
+// reference to it.
+func (fs *Storage) writeEntryPage(page api.EntryList) (api.EntryPage, error) {
+	ref, raw := api.NewEntryPage(page)
+	pageDir, pageFile := layout.EntryPagePath("", ref.Hash)
+	if err := os.MkdirAll(fs.path(pageDir), dirPerm); err != nil {
+		return ref, fmt.Errorf("failed to make entry page directory structure: %w", err)
+	}
+	p := fs.path(pageDir, pageFile)
+	tmp := fmt.Sprintf("%s.tmp", p)
+	if err := createExclusive(tmp, raw); err != nil {
+		return ref, fmt.Errorf("failed to create temporary entry page file: %w", err)
+	}
+	return ref, rename(tmp, p)
+}
+
+// ReadEntryPage returns the page of the entry list of identifier referenced
+// by ref, checked against the reference.
+func (fs *Storage) ReadEntryPage(_ context.Context, identifier string, ref api.EntryPage) (*api.EntryList, error) {
+	if len(ref.Hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid entry page hash length %d", len(ref.Hash))
+	}
+	raw, err := fs.readFile(fs.path(layout.EntryPagePath("", ref.Hash)))
+	if err != nil {
+		return nil, err
+	}
+	return api.ParseEntryPage(raw, identifier, ref)
+}
+
+// ScanEntryLists calls f for each entry list in the identifier index, in no
+// particular order. It stops scanning if the call to f returns an error.
+func (fs *Storage) ScanEntryLists(_ context.Context, f func(l *api.EntryList) error) error {
+	dir := fs.path("index")
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		raw, err := fs.readFile(p)
+		if err != nil {
+			return err
+		}
+		l, err := api.ParseEntryList(raw)
+		if err != nil {
+			return fmt.Errorf("invalid entry list at %q: %w", p, err)
+		}
+		return f(l)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// WriteMapEntry stores the entry of the identifier with the given key in the
+// snapshot of the identifier map built at the given log size.
+func (fs *Storage) WriteMapEntry(_ context.Context, size uint64, key []byte, raw []byte) error {
+	mapDir, mapFile := layout.MapPath("", size, key)
+	if err := os.MkdirAll(fs.path(mapDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make map directory structure: %w", err)
+	}
+	p := fs.path(mapDir, mapFile)
+	tmp := fmt.Sprintf("%s.tmp", p)
+	if err := createExclusive(tmp, raw); err != nil {
+		return fmt.Errorf("failed to create temporary map entry file: %w", err)
+	}
+	return rename(tmp, p)
+}
+
+// WriteInclusionProof stores the precomputed inclusion proof of the entry at
+// the given index in the tree of the given size.
+func (fs *Storage) WriteInclusionProof(_ context.Context, size, index uint64, raw []byte) error {
+	proofDir, proofFile := layout.InclusionProofPath("", size, index)
+	if err := os.MkdirAll(fs.path(proofDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make proof directory structure: %w", err)
+	}
+	p := fs.path(proofDir, proofFile)
+	tmp := fmt.Sprintf("%s.tmp", p)
+	if err := createExclusive(tmp, raw); err != nil {
+		return fmt.Errorf("failed to create temporary proof file: %w", err)
+	}
+	return rename(tmp, p)
+}
+
+// WriteInventory stores the signed inventory of the files committed to by the
+// checkpoint of the given size. Inventories are never replaced, so it returns
+// an error wrapping os.ErrExist if one has already been stored for the size.
+func (fs *Storage) WriteInventory(_ context.Context, size uint64, raw []byte) error {
+	invDir, invFile := layout.InventoryPath("", size)
+	if err := os.MkdirAll(fs.path(invDir), dirPerm); err != nil {
+		return fmt.Errorf("failed to make inventory directory: %w", err)
+	}
+	p := fs.path(invDir, invFile)
+	if _, err := os.Stat(p); err == nil {
+		return fmt.Errorf("inventory for size %d %w", size, os.ErrExist)
+	}
+	tmp := fmt.Sprintf("%s.tmp", p)
+	if err := createExclusive(tmp, raw); err != nil {
+		return fmt.Errorf("failed to create temporary inventory file: %w", err)
+	}
+	return rename(tmp, p)
 }
 
 // createExclusive creates the named file before writing the data in d to it.
@@ -210,8 +1198,8 @@ func createExclusive(f string, d []byte) error {
 func (fs *Storage) ScanSequenced(_ context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
 	end := begin
 	for {
-		sp := filepath.Join(layout.SeqPath(fs.rootDir, end))
-		entry, err := os.ReadFile(sp)
+		sp := fs.path(layout.SeqPath("", end))
+		entry, err := fs.readFile(sp)
 		if errors.Is(err, os.ErrNotExist) {
 			// we're done.
 			return end - begin, nil
@@ -227,41 +1215,50 @@ func (fs *Storage) ScanSequenced(_ context.Context, begin uint64, f func(seq uin
 
 // GetTile returns the tile at the given tile-level and tile-index.
 // If no complete tile exists at that location, it will attempt to find a
-// partial tile for the given tree size at that location.
-func (fs *Storage) GetTile(_ context.Context, level, index, logSize uint64) (*api.Tile, error) {
+// partial tile for the given tree size at that location, which is derived
+// from the tiles or entries below it if the log doesn't store partial tiles.
+func (fs *Storage) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
 	tileSize := layout.PartialTileSize(level, index, logSize)
-	p := filepath.Join(layout.TilePath(fs.rootDir, level, index, tileSize))
-	t, err := os.ReadFile(p)
+	p := fs.path(layout.TilePath("", level, index, tileSize))
+	t, err := fs.readFile(p)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("failed to read tile at %q: %w", p, err)
 		}
+		if tileSize > 0 && fs.partialTiles == api.PartialTilesDerived {
+			return client.DerivePartialTile(ctx, rfc6962.DefaultHasher, fs.fetch, level, index, tileSize)
+		}
 		return nil, err
 	}
 
-	var tile api.Tile
-	if err := tile.UnmarshalText(t); err != nil {
+	tile, err := api.ParseTile(t)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse tile: %w", err)
 	}
-	return &tile, nil
+	return tile, nil
 }
 
 // StoreTile writes a tile out to disk.
 // Fully populated tiles are stored at the path corresponding to the level &
 // index parameters, partially populated (i.e. right-hand edge) tiles are
-// stored with a .xx suffix where xx is the number of "tile leaves" in hex.
+// stored with a .xx suffix where xx is the number of "tile leaves" in hex,
+// unless the log derives its partial tiles, in which case they're dropped.
 func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.Tile) error {
 	tileSize := uint64(tile.NumLeaves)
 	glog.V(2).Infof("StoreTile: level %d index %x ts: %x", level, index, tileSize)
 	if tileSize == 0 || tileSize > 256 {
 		return fmt.Errorf("tileSize %d must be > 0 and <= 256", tileSize)
 	}
+	if tileSize < 256 && fs.partialTiles == api.PartialTilesDerived {
+		return nil
+	}
 	t, err := tile.MarshalText()
 	if err != nil {
 		return fmt.Errorf("failed to marshal tile: %w", err)
 	}
 
-	tDir, tFile := layout.TilePath(fs.rootDir, level, index, tileSize%256)
+	tDir, tFile := layout.TilePath("", level, index, tileSize%256)
+	tDir = fs.path(tDir)
 	tPath := filepath.Join(tDir, tFile)
 
 	if err := os.MkdirAll(tDir, dirPerm); err != nil {
@@ -273,27 +1270,20 @@ func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.T
 	if err := os.WriteFile(temp, t, filePerm); err != nil {
 		return fmt.Errorf("failed to write temporary tile file: %w", err)
 	}
-	if err := os.Rename(temp, tPath); err != nil {
+	if err := rename(temp, tPath); err != nil {
 		return fmt.Errorf("failed to rename temporary tile file: %w", err)
 	}
 
-	if tileSize == 256 {
-		partials, err := filepath.Glob(fmt.Sprintf("%s.*", tPath))
+	if tileSize == 256 && !fs.immutable {
+		partials, err := partialTiles(tDir, tFile)
 		if err != nil {
 			return fmt.Errorf("failed to list partial tiles for clean up; %w", err)
 		}
 		// Clean up old partial tiles by symlinking them to the new full tile.
 		for _, p := range partials {
 			glog.V(2).Infof("relink partial %s to %s", p, tPath)
-			// We have to do a little dance here to get POSIX atomicity:
-			// 1. Create a new temporary symlink to the full tile
-			// 2. Rename the temporary symlink over the top of the old partial tile
-			tmp := fmt.Sprintf("%s.link", tPath)
-			if err := os.Symlink(tPath, tmp); err != nil {
-				return fmt.Errorf("failed to create temp link to full tile: %w", err)
-			}
-			if err := os.Rename(tmp, p); err != nil {
-				return fmt.Errorf("failed to rename temp link over partial tile: %w", err)
+			if err := replaceWithLink(tDir, tFile, p, t); err != nil {
+				return err
 			}
 		}
 	}
@@ -301,14 +1291,91 @@ func (fs *Storage) StoreTile(_ context.Context, level, index uint64, tile *api.T
 	return nil
 }
 
+// partialTiles returns the paths of any partial tiles stored alongside the
+// full tile with the given file name in dir.
+// The directory is listed rather than globbed so that characters in the
+// storage root which have special meaning to filepath.Match can't interfere.
+func partialTiles(dir, tFile string) ([]string, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var r []string
+	for _, e := range ents {
+		n := e.Name()
+		if !strings.HasPrefix(n, tFile+".") {
+			continue
+		}
+		// Only consider .xx suffixes, and not e.g. temporary files.
+		if sfx := strings.TrimPrefix(n, tFile+"."); len(sfx) != 2 {
+			continue
+		} else if _, err := strconv.ParseUint(sfx, 16, 8); err != nil {
+			continue
+		}
+		r = append(r, filepath.Join(dir, n))
+	}
+	return r, nil
+}
+
+// replaceWithLink atomically replaces the partial tile at p with a symlink to
+// the full tile tFile in the same directory, dir.
+// If symlinks aren't available (e.g. on Windows without the necessary
+// privileges) a copy of the full tile, whose contents are t, is used instead.
+func replaceWithLink(dir, tFile, p string, t []byte) error {
+	// We have to do a little dance here to get POSIX atomicity:
+	// 1. Create a new temporary symlink to the full tile
+	// 2. Rename the temporary symlink over the top of the old partial tile
+	// The link target is relative so that it cannot refer outside of
+	// the tile directory, and remains valid if the log is moved.
+	tmp := filepath.Join(dir, fmt.Sprintf("%s.link", tFile))
+	if err := ops.symlink(tFile, tmp); err != nil {
+		glog.V(2).Infof("Failed to create symlink, falling back to copying full tile: %v", err)
+		if err := os.WriteFile(tmp, t, filePerm); err != nil {
+			return fmt.Errorf("failed to create temp copy of full tile: %w", err)
+		}
+	}
+	if err := rename(tmp, p); err != nil {
+		return fmt.Errorf("failed to rename temp link over partial tile: %w", err)
+	}
+	return nil
+}
+
 // WriteCheckpoint stores a raw log checkpoint on disk.
 func (fs Storage) WriteCheckpoint(_ context.Context, newCPRaw []byte) error {
-	oPath := filepath.Join(fs.rootDir, layout.CheckpointPath)
+	oPath := fs.path(layout.CheckpointPath)
 	tmp := fmt.Sprintf("%s.tmp", oPath)
 	if err := createExclusive(tmp, newCPRaw); err != nil {
 		return fmt.Errorf("failed to create temporary checkpoint file: %w", err)
 	}
-	return os.Rename(tmp, oPath)
+	return rename(tmp, oPath)
+}
+
+// ReadCompactRange reads the compact range stored by WriteCompactRange.
+func (fs Storage) ReadCompactRange(_ context.Context) (*api.CompactRange, error) {
+	raw, err := os.ReadFile(fs.path(layout.CompactRangePath))
+	if err != nil {
+		return nil, err
+	}
+	r := &api.CompactRange{}
+	if err := r.UnmarshalText(raw); err != nil {
+		return nil, fmt.Errorf("failed to parse compact range: %w", err)
+	}
+	return r, nil
+}
+
+// WriteCompactRange stores the compact range of the newly integrated tree on
+// disk, replacing any existing one.
+func (fs Storage) WriteCompactRange(_ context.Context, r *api.CompactRange) error {
+	raw, err := r.MarshalText()
+	if err != nil {
+		return fmt.Errorf("failed to marshal compact range: %w", err)
+	}
+	oPath := fs.path(layout.CompactRangePath)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := os.WriteFile(tmp, raw, filePerm); err != nil {
+		return fmt.Errorf("failed to write temporary compact range file: %w", err)
+	}
+	return rename(tmp, oPath)
 }
 
 // ReadCheckpoint reads and returns the contents of the log checkpoint file.
@@ -316,3 +1383,229 @@ func ReadCheckpoint(rootDir string) ([]byte, error) {
 	s := filepath.Join(rootDir, layout.CheckpointPath)
 	return os.ReadFile(s)
 }
+
+// WriteManifest stores a raw signed log manifest on disk, replacing any
+// existing manifest.
+func WriteManifest(rootDir string, manifestRaw []byte) error {
+	oPath := filepath.Join(rootDir, layout.ManifestPath)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, manifestRaw); err != nil {
+		return fmt.Errorf("failed to create temporary manifest file: %w", err)
+	}
+	return rename(tmp, oPath)
+}
+
+// WriteShardIndex stores a raw signed shard index in the root directory of a
+// sharded log, replacing any existing index.
+func WriteShardIndex(rootDir string, indexRaw []byte) error {
+	oPath := filepath.Join(rootDir, layout.ShardsPath)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, indexRaw); err != nil {
+		return fmt.Errorf("failed to create temporary shard index file: %w", err)
+	}
+	return rename(tmp, oPath)
+}
+
+// WriteNamespaces stores a raw signed namespace registry in the root directory
+// of a log, replacing any existing registry.
+func WriteNamespaces(rootDir string, namespacesRaw []byte) error {
+	oPath := filepath.Join(rootDir, layout.NamespacesPath)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, namespacesRaw); err != nil {
+		return fmt.Errorf("failed to create temporary namespace registry file: %w", err)
+	}
+	return rename(tmp, oPath)
+}
+
+// WritePublicKey stores the log's note verifier key in the root directory of a
+// log, replacing any existing key.
+func WritePublicKey(rootDir string, pubKey []byte) error {
+	oPath := filepath.Join(rootDir, layout.PublicKeyPath)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, pubKey); err != nil {
+		return fmt.Errorf("failed to create temporary public key file: %w", err)
+	}
+	return rename(tmp, oPath)
+}
+
+// WriteCheckpointTime stores a raw signed checkpoint time in the root
+// directory of a log, replacing any existing one.
+func WriteCheckpointTime(rootDir string, timeRaw []byte) error {
+	oPath := filepath.Join(rootDir, layout.CheckpointTimePath)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, timeRaw); err != nil {
+		return fmt.Errorf("failed to create temporary checkpoint time file: %w", err)
+	}
+	return rename(tmp, oPath)
+}
+
+// mutablePaths are the layout paths of the files which may be updated with
+// WriteIfGeneration.
+var mutablePaths = map[string]bool{
+	layout.CheckpointPath: true,
+	layout.ManifestPath:   true,
+	layout.ShardsPath:     true,
+	layout.LeasePath:      true,
+}
+
+// generation returns the Generation of a file with the given contents.
+func generation(d []byte) log.Generation {
+	return log.Generation(fmt.Sprintf("%x", sha256.Sum256(d)))
+}
+
+// ReadGeneration returns the contents and current Generation of the mutable
+// file at the given layout path. The Generation is the SHA-256 hash of the
+// contents.
+func (fs Storage) ReadGeneration(_ context.Context, p string) ([]byte, log.Generation, error) {
+	if !mutablePaths[p] {
+		return nil, log.NoGeneration, fmt.Errorf("%q is not a mutable file", p)
+	}
+	d, err := fs.readFile(fs.path(p))
+	if err != nil {
+		return nil, log.NoGeneration, err
+	}
+	return d, generation(d), nil
+}
+
+// WriteIfGeneration replaces the mutable file at the given layout path with
+// data, provided that its current Generation is expected.
+// Conditional writes to the same storage, from this or other processes, are
+// serialised with a lock which is independent of the one taken by Lock.
+// Unconditional writes, e.g. by WriteCheckpoint, aren't detected.
+func (fs Storage) WriteIfGeneration(ctx context.Context, p string, data []byte, expected log.Generation) error {
+	return fs.writeIf(ctx, p, data, expected, func() error { return nil })
+}
+
+// WriteIfFenced is as for WriteIfGeneration, except that the file is only
+// replaced if the stored lease has the given fencing token. The lease is
+// checked under the same lock as the write, so it can't be taken by another
+// integrator in between.
+func (fs Storage) WriteIfFenced(ctx context.Context, p string, data []byte, expected log.Generation, token uint64) error {
+	return fs.writeIf(ctx, p, data, expected, func() error {
+		raw, err := fs.readFile(fs.path(layout.LeasePath))
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no lease is held: %w", log.ErrFenced)
+		} else if err != nil {
+			return fmt.Errorf("failed to read lease: %w", err)
+		}
+		l, err := api.ParseLease(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse lease: %w", err)
+		}
+		if l.Token != token {
+			return fmt.Errorf("lease has token %d, want %d: %w", l.Token, token, log.ErrFenced)
+		}
+		return nil
+	})
+}
+
+// writeIf replaces the mutable file at the given layout path with data,
+// provided that its current Generation is expected and check returns no
+// error, holding the write lock throughout.
+func (fs Storage) writeIf(ctx context.Context, p string, data []byte, expected log.Generation, check func() error) error {
+	if !mutablePaths[p] {
+		return fmt.Errorf("%q is not a mutable file", p)
+	}
+	unlock, err := waitLock(fs.path(writeLockFileName))
+	if err != nil {
+		return fmt.Errorf("failed to lock storage for write: %w", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			glog.Warningf("Failed to unlock storage after write: %v", err)
+		}
+	}()
+
+	if err := check(); err != nil {
+		return err
+	}
+	_, got, err := fs.ReadGeneration(ctx, p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %q: %w", p, err)
+	}
+	if got != expected {
+		return fmt.Errorf("%q has generation %q, want %q: %w", p, got, expected, log.ErrGenerationMismatch)
+	}
+	oPath := fs.path(p)
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, data); err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %w", p, err)
+	}
+	return rename(tmp, oPath)
+}
+
+// WriteStagedCheckpoint stores the unsigned body of a staged checkpoint on
+// disk, replacing any previously staged checkpoint. Approvals of a previously
+// staged checkpoint with a different body are removed.
+func (fs Storage) WriteStagedCheckpoint(_ context.Context, cpBody []byte) error {
+	oPath := fs.path(layout.StagedCheckpointPath)
+	if old, err := os.ReadFile(oPath); err == nil && !bytes.Equal(old, cpBody) {
+		if err := os.RemoveAll(fs.path(layout.StagedApprovalsPath)); err != nil {
+			return fmt.Errorf("failed to remove stale approvals: %w", err)
+		}
+	}
+	tmp := fmt.Sprintf("%s.tmp", oPath)
+	if err := createExclusive(tmp, cpBody); err != nil {
+		return fmt.Errorf("failed to create temporary staged checkpoint file: %w", err)
+	}
+	return rename(tmp, oPath)
+}
+
+// ReadStagedCheckpoint reads and returns the contents of the staged
+// checkpoint file. An error wrapping os.ErrNotExist is returned if no
+// checkpoint is staged.
+func ReadStagedCheckpoint(rootDir string) ([]byte, error) {
+	s := filepath.Join(rootDir, layout.StagedCheckpointPath)
+	return os.ReadFile(s)
+}
+
+// RemoveStagedCheckpoint removes the staged checkpoint file and any approvals
+// of it, if present.
+func (fs Storage) RemoveStagedCheckpoint(_ context.Context) error {
+	if err := os.Remove(fs.path(layout.StagedCheckpointPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(fs.path(layout.StagedApprovalsPath))
+}
+
+// WriteApproval stores an approval of the staged checkpoint by the named
+// approver, replacing any earlier approval by them.
+func WriteApproval(rootDir, approver string, approval []byte) error {
+	if err := layout.ValidateElement(approver); err != nil {
+		return err
+	}
+	dir := filepath.Join(rootDir, layout.StagedApprovalsPath)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return fmt.Errorf("failed to create approvals directory: %w", err)
+	}
+	p := filepath.Join(dir, approver)
+	tmp := fmt.Sprintf("%s.tmp", p)
+	if err := createExclusive(tmp, approval); err != nil {
+		return fmt.Errorf("failed to create temporary approval file: %w", err)
+	}
+	return rename(tmp, p)
+}
+
+// ReadApprovals returns the approvals of the staged checkpoint, keyed by
+// approver.
+func ReadApprovals(rootDir string) (map[string][]byte, error) {
+	dir := filepath.Join(rootDir, layout.StagedApprovalsPath)
+	ents, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]byte{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]byte)
+	for _, e := range ents {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		a, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ret[e.Name()] = a
+	}
+	return ret, nil
+}
@@ -18,12 +18,21 @@ import (
 	"context"
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/storagetest"
 	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/google/trillian-examples/serverless/pkg/vmap"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
 )
 
 func TestCreate(t *testing.T) {
@@ -62,6 +71,21 @@ func TestLoadForNonExistentDir(t *testing.T) {
 	}
 }
 
+func TestConformance(t *testing.T) {
+	for _, immutable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("immutable=%t", immutable), func(t *testing.T) {
+			storagetest.Run(t, func(t *testing.T) log.Storage {
+				s, err := Create(filepath.Join(t.TempDir(), "storage"))
+				if err != nil {
+					t.Fatalf("Create = %v", err)
+				}
+				s.SetImmutable(immutable)
+				return s
+			})
+		})
+	}
+}
+
 func TestWriteLoadState(t *testing.T) {
 	d := filepath.Join(t.TempDir(), "storage")
 	s, err := Create(d)
@@ -85,6 +109,209 @@ func TestWriteLoadState(t *testing.T) {
 	}
 }
 
+func TestStagedCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if _, err := ReadStagedCheckpoint(d); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadStagedCheckpoint = %v, want not exists error", err)
+	}
+
+	for _, a := range [][]byte{[]byte("one"), []byte("two")} {
+		if err := s.WriteStagedCheckpoint(ctx, a); err != nil {
+			t.Fatalf("WriteStagedCheckpoint = %v", err)
+		}
+		b, err := ReadStagedCheckpoint(d)
+		if err != nil {
+			t.Fatalf("ReadStagedCheckpoint = %v", err)
+		}
+		if diff := cmp.Diff(b, a); len(diff) != 0 {
+			t.Errorf("Staged checkpoint had diff %s", diff)
+		}
+	}
+	if _, err := ReadCheckpoint(d); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadCheckpoint = %v, want staging to leave the published checkpoint alone", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.RemoveStagedCheckpoint(ctx); err != nil {
+			t.Fatalf("RemoveStagedCheckpoint = %v", err)
+		}
+	}
+	if _, err := ReadStagedCheckpoint(d); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadStagedCheckpoint = %v, want not exists error", err)
+	}
+}
+
+func TestWriteIfGeneration(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if _, _, err := s.ReadGeneration(ctx, layout.CheckpointPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadGeneration = %v, want not exists error", err)
+	}
+	if err := s.WriteIfGeneration(ctx, layout.CheckpointPath, []byte("one"), log.NoGeneration); err != nil {
+		t.Fatalf("WriteIfGeneration creating checkpoint = %v", err)
+	}
+	_, gen1, err := s.ReadGeneration(ctx, layout.CheckpointPath)
+	if err != nil {
+		t.Fatalf("ReadGeneration = %v", err)
+	}
+	if err := s.WriteIfGeneration(ctx, layout.CheckpointPath, []byte("two"), gen1); err != nil {
+		t.Fatalf("WriteIfGeneration = %v", err)
+	}
+	b, gen2, err := s.ReadGeneration(ctx, layout.CheckpointPath)
+	if err != nil {
+		t.Fatalf("ReadGeneration = %v", err)
+	}
+	if string(b) != "two" || gen2 == gen1 {
+		t.Fatalf("ReadGeneration = %q, %q, want two with a new generation", b, gen2)
+	}
+
+	for _, test := range []struct {
+		desc     string
+		path     string
+		expected log.Generation
+	}{
+		{desc: "stale", path: layout.CheckpointPath, expected: gen1},
+		{desc: "already exists", path: layout.CheckpointPath, expected: log.NoGeneration},
+		{desc: "doesn't exist", path: layout.ManifestPath, expected: gen2},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := s.WriteIfGeneration(ctx, test.path, []byte("three"), test.expected); !errors.Is(err, log.ErrGenerationMismatch) || !errors.Is(err, log.ErrStorageConflict) {
+				t.Errorf("WriteIfGeneration = %v, want generation mismatch", err)
+			}
+		})
+	}
+	if b, err := ReadCheckpoint(d); err != nil || string(b) != "two" {
+		t.Errorf("ReadCheckpoint = %q, %v, want failed writes to leave the checkpoint alone", b, err)
+	}
+	if err := s.WriteIfGeneration(ctx, layout.StagedCheckpointPath, []byte("staged"), log.NoGeneration); err == nil {
+		t.Error("WriteIfGeneration of a file which isn't mutable succeeded")
+	}
+
+	// Conditional writes are possible while the storage is locked.
+	unlock, err := Lock(d)
+	if err != nil {
+		t.Fatalf("Lock = %v", err)
+	}
+	defer unlock()
+	if err := s.WriteIfGeneration(ctx, layout.CheckpointPath, []byte("three"), gen2); err != nil {
+		t.Errorf("WriteIfGeneration while locked = %v", err)
+	}
+}
+
+func TestWriteIfFenced(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if err := s.WriteIfFenced(ctx, layout.CheckpointPath, []byte("one"), log.NoGeneration, 1); !errors.Is(err, log.ErrFenced) {
+		t.Fatalf("WriteIfFenced without a lease = %v, want ErrFenced", err)
+	}
+	l := api.Lease{Holder: "a", Token: 2, Expires: time.Now().Add(time.Minute)}
+	if err := s.WriteIfGeneration(ctx, layout.LeasePath, l.Marshal(), log.NoGeneration); err != nil {
+		t.Fatalf("WriteIfGeneration of lease = %v", err)
+	}
+	if err := s.WriteIfFenced(ctx, layout.CheckpointPath, []byte("one"), log.NoGeneration, 1); !errors.Is(err, log.ErrFenced) || !errors.Is(err, log.ErrStorageConflict) {
+		t.Fatalf("WriteIfFenced with stale token = %v, want ErrFenced", err)
+	}
+	if err := s.WriteIfFenced(ctx, layout.CheckpointPath, []byte("one"), log.NoGeneration, 2); err != nil {
+		t.Fatalf("WriteIfFenced = %v", err)
+	}
+	if err := s.WriteIfFenced(ctx, layout.CheckpointPath, []byte("two"), log.NoGeneration, 2); !errors.Is(err, log.ErrGenerationMismatch) {
+		t.Errorf("WriteIfFenced with stale generation = %v, want generation mismatch", err)
+	}
+	if b, err := ReadCheckpoint(d); err != nil || string(b) != "one" {
+		t.Errorf("ReadCheckpoint = %q, %v, want one", b, err)
+	}
+}
+
+func TestWriteInventory(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if err := s.WriteInventory(ctx, 5, []byte("one")); err != nil {
+		t.Fatalf("WriteInventory = %v", err)
+	}
+	if err := s.WriteInventory(ctx, 5, []byte("two")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("WriteInventory again = %v, want exists error", err)
+	}
+	invDir, invFile := layout.InventoryPath(d, 5)
+	if b, err := os.ReadFile(filepath.Join(invDir, invFile)); err != nil || string(b) != "one" {
+		t.Errorf("ReadFile = %q, %v, want the first inventory", b, err)
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if err := s.WriteStagedCheckpoint(ctx, []byte("one")); err != nil {
+		t.Fatalf("WriteStagedCheckpoint = %v", err)
+	}
+	if err := WriteApproval(d, "../escape", []byte("sig")); err == nil {
+		t.Error("WriteApproval with invalid approver name succeeded, want error")
+	}
+	for _, a := range []string{"alice", "bob", "alice"} {
+		if err := WriteApproval(d, a, []byte("sig "+a)); err != nil {
+			t.Fatalf("WriteApproval(%q) = %v", a, err)
+		}
+	}
+	// Key names may contain "/", so are encoded by log.ApproverID.
+	carol := log.ApproverID("example.com/carol", 0x1234abcd)
+	if err := WriteApproval(d, carol, []byte("sig carol")); err != nil {
+		t.Fatalf("WriteApproval(%q) = %v", carol, err)
+	}
+	want := map[string][]byte{"alice": []byte("sig alice"), "bob": []byte("sig bob"), carol: []byte("sig carol")}
+	got, err := ReadApprovals(d)
+	if err != nil {
+		t.Fatalf("ReadApprovals = %v", err)
+	}
+	if diff := cmp.Diff(got, want); len(diff) != 0 {
+		t.Errorf("Approvals had diff %s", diff)
+	}
+
+	// Re-staging the same checkpoint keeps its approvals, but staging a
+	// different one must not.
+	if err := s.WriteStagedCheckpoint(ctx, []byte("one")); err != nil {
+		t.Fatalf("WriteStagedCheckpoint = %v", err)
+	}
+	if got, err := ReadApprovals(d); err != nil || len(got) != 3 {
+		t.Errorf("ReadApprovals = %v, %v, want 3 approvals", got, err)
+	}
+	if err := s.WriteStagedCheckpoint(ctx, []byte("two")); err != nil {
+		t.Fatalf("WriteStagedCheckpoint = %v", err)
+	}
+	if got, err := ReadApprovals(d); err != nil || len(got) != 0 {
+		t.Errorf("ReadApprovals = %v, %v, want no approvals", got, err)
+	}
+
+	if err := WriteApproval(d, "alice", []byte("sig")); err != nil {
+		t.Fatalf("WriteApproval = %v", err)
+	}
+	if err := s.RemoveStagedCheckpoint(ctx); err != nil {
+		t.Fatalf("RemoveStagedCheckpoint = %v", err)
+	}
+	if got, err := ReadApprovals(d); err != nil || len(got) != 0 {
+		t.Errorf("ReadApprovals = %v, %v, want no approvals", got, err)
+	}
+}
+
 type errCheck func(error) bool
 
 func TestSequence(t *testing.T) {
@@ -92,6 +319,7 @@ func TestSequence(t *testing.T) {
 
 	for _, test := range []struct {
 		desc    string
+		policy  api.DuplicatePolicy
 		leaves  [][]byte
 		wantSeq []uint64
 		wantErr []errCheck
@@ -105,6 +333,22 @@ func TestSequence(t *testing.T) {
 			leaves:  [][]byte{{0x10}, {0x10}},
 			wantSeq: []uint64{0, 0},
 			wantErr: []errCheck{nil, func(e error) bool { return errors.Is(e, log.ErrDupeLeaf) }},
+		}, {
+			desc:    "dupe rejected",
+			policy:  api.DuplicatesReject,
+			leaves:  [][]byte{{0x10}, {0x11}, {0x10}},
+			wantSeq: []uint64{0, 1, 0},
+			wantErr: []errCheck{nil, nil, func(e error) bool { return errors.Is(e, log.ErrDupeLeaf) }},
+		}, {
+			desc:    "dupe returns original",
+			policy:  api.DuplicatesOriginal,
+			leaves:  [][]byte{{0x10}, {0x11}, {0x10}},
+			wantSeq: []uint64{0, 1, 0},
+		}, {
+			desc:    "dupe allowed",
+			policy:  api.DuplicatesAllow,
+			leaves:  [][]byte{{0x10}, {0x11}, {0x10}},
+			wantSeq: []uint64{0, 1, 2},
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
@@ -113,13 +357,14 @@ func TestSequence(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Create = %v", err)
 			}
+			s.SetDuplicatePolicy(test.policy)
 			for i, leaf := range test.leaves {
 				h := sha256.Sum256(leaf)
 				gotSeq, gotErr := s.Sequence(ctx, h[:], leaf)
 				if gotErr != nil {
 					t.Logf("Sequence %d = %v", i, gotErr)
 				}
-				if gotErr != nil && test.wantErr[i] == nil {
+				if gotErr != nil && (test.wantErr == nil || test.wantErr[i] == nil) {
 					t.Errorf("Got unexpected error %v, want no error", gotErr)
 				}
 				if test.wantErr != nil && test.wantErr[i] != nil && !test.wantErr[i](gotErr) {
@@ -133,3 +378,929 @@ func TestSequence(t *testing.T) {
 	}
 
 }
+
+func TestSequenceRequest(t *testing.T) {
+	ctx := context.Background()
+	type submission struct {
+		id      string
+		leaf    string
+		wantSeq uint64
+		wantErr error
+	}
+	for _, test := range []struct {
+		desc   string
+		policy api.DuplicatePolicy
+		// interrupted, if set, is a submission which was sequenced but
+		// interrupted before its outcome was recorded.
+		interrupted *submission
+		// pending, if set, is a submission which was interrupted before
+		// the entry was sequenced.
+		pending     *submission
+		submissions []submission
+	}{
+		{
+			desc: "retries",
+			submissions: []submission{
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "b", leaf: "two", wantSeq: 1},
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "b", leaf: "two", wantSeq: 1},
+			},
+		}, {
+			desc:   "retries with duplicates allowed",
+			policy: api.DuplicatesAllow,
+			submissions: []submission{
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "b", leaf: "one", wantSeq: 1},
+				{id: "b", leaf: "one", wantSeq: 1},
+			},
+		}, {
+			desc: "duplicate with another ID",
+			submissions: []submission{
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "b", leaf: "one", wantSeq: 0, wantErr: log.ErrDupeLeaf},
+				{id: "b", leaf: "one", wantSeq: 0, wantErr: log.ErrDupeLeaf},
+			},
+		}, {
+			desc: "ID reused for another entry",
+			submissions: []submission{
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "a", leaf: "two", wantErr: log.ErrRequestConflict},
+			},
+		}, {
+			desc:        "interrupted after sequencing",
+			policy:      api.DuplicatesAllow,
+			interrupted: &submission{id: "a", leaf: "one"},
+			submissions: []submission{
+				{id: "b", leaf: "two", wantSeq: 1},
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "a", leaf: "one", wantSeq: 0},
+			},
+		}, {
+			desc:    "interrupted before sequencing",
+			pending: &submission{id: "a", leaf: "one"},
+			submissions: []submission{
+				{id: "a", leaf: "one", wantSeq: 0},
+				{id: "a", leaf: "one", wantSeq: 0},
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			d := filepath.Join(t.TempDir(), "storage")
+			s, err := Create(d)
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			s.SetDuplicatePolicy(test.policy)
+			for _, p := range []*submission{test.interrupted, test.pending} {
+				if p == nil {
+					continue
+				}
+				h := sha256.Sum256([]byte(p.leaf))
+				dir, file := layout.RequestPath(d, api.RequestKey(p.id))
+				if err := os.MkdirAll(dir, dirPerm); err != nil {
+					t.Fatalf("MkdirAll = %v", err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, file+requestPendingSuffix), api.RequestRecord{LeafHash: h[:], Seq: 0}.Marshal(), filePerm); err != nil {
+					t.Fatalf("WriteFile = %v", err)
+				}
+				if p == test.interrupted {
+					if _, err := s.Sequence(ctx, h[:], []byte(p.leaf)); err != nil {
+						t.Fatalf("Sequence = %v", err)
+					}
+				}
+			}
+			for i, sub := range test.submissions {
+				h := sha256.Sum256([]byte(sub.leaf))
+				seq, err := s.SequenceRequest(ctx, sub.id, h[:], []byte(sub.leaf))
+				if sub.wantErr == nil && err != nil {
+					t.Fatalf("SequenceRequest %d = %v", i, err)
+				}
+				if !errors.Is(err, sub.wantErr) {
+					t.Fatalf("SequenceRequest %d = %v, want %v", i, err, sub.wantErr)
+				}
+				if err == nil && seq != sub.wantSeq {
+					t.Errorf("SequenceRequest %d = %d, want %d", i, seq, sub.wantSeq)
+				}
+			}
+			// Every distinct entry must have been sequenced exactly once.
+			entries := make(map[string]bool)
+			for _, sub := range test.submissions {
+				entries[sub.id+sub.leaf] = sub.wantErr == nil
+			}
+			want := uint64(0)
+			for _, ok := range entries {
+				if ok {
+					want++
+				}
+			}
+			if n, err := s.ScanSequenced(ctx, 0, func(uint64, []byte) error { return nil }); err != nil || n != want {
+				t.Errorf("ScanSequenced = %d, %v, want %d entries", n, err, want)
+			}
+		})
+	}
+}
+
+func TestSequenceAt(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	// Duplicates are kept, since they're part of the log being rebuilt.
+	leaves := [][]byte{{0x00}, {0x01}, {0x00}}
+	for i, leaf := range leaves {
+		h := sha256.Sum256(leaf)
+		if err := s.SequenceAt(ctx, uint64(i), h[:], leaf); err != nil {
+			t.Fatalf("SequenceAt(%d) = %v", i, err)
+		}
+	}
+	h := sha256.Sum256([]byte{0x02})
+	if err := s.SequenceAt(ctx, 1, h[:], []byte{0x02}); !errors.Is(err, os.ErrExist) {
+		t.Errorf("SequenceAt of used sequence number = %v, want ErrExist", err)
+	}
+
+	var got [][]byte
+	n, err := s.ScanSequenced(ctx, 0, func(_ uint64, entry []byte) error {
+		got = append(got, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanSequenced = %v", err)
+	}
+	if n != uint64(len(leaves)) || !cmp.Equal(got, leaves) {
+		t.Errorf("ScanSequenced found %d entries %x, want %x", n, got, leaves)
+	}
+}
+
+func TestSequencedTime(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	before := time.Now()
+	h := sha256.Sum256([]byte{0x00})
+	seq, err := s.Sequence(ctx, h[:], []byte{0x00})
+	if err != nil {
+		t.Fatalf("Sequence = %v", err)
+	}
+	after := time.Now()
+	got, err := s.SequencedTime(ctx, seq)
+	if err != nil {
+		t.Fatalf("SequencedTime = %v", err)
+	}
+	if got.Before(before) || got.After(after) {
+		t.Errorf("SequencedTime = %v, want between %v and %v", got, before, after)
+	}
+
+	// Entries without a recorded time fall back to their file's mtime.
+	h = sha256.Sum256([]byte{0x01})
+	if err := s.SequenceAt(ctx, 1, h[:], []byte{0x01}); err != nil {
+		t.Fatalf("SequenceAt = %v", err)
+	}
+	mtime := time.Unix(1680000000, 0)
+	if err := os.Chtimes(s.path(layout.SeqPath("", 1)), mtime, mtime); err != nil {
+		t.Fatalf("Chtimes = %v", err)
+	}
+	if got, err := s.SequencedTime(ctx, 1); err != nil || !got.Equal(mtime) {
+		t.Errorf("SequencedTime of entry without recorded time = %v, %v, want %v", got, err, mtime)
+	}
+	if _, err := s.SequencedTime(ctx, 2); err == nil {
+		t.Error("SequencedTime of missing entry succeeded, want error")
+	}
+}
+
+func TestSequenceMaxLeafSize(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	s.SetMaxLeafSize(4)
+	for _, leaf := range []string{"leaf", "big leaf"} {
+		h := sha256.Sum256([]byte(leaf))
+		_, err := s.Sequence(ctx, h[:], []byte(leaf))
+		if got, want := errors.Is(err, log.ErrLeafTooLarge), len(leaf) > 4; got != want {
+			t.Errorf("Sequence(%q) = %v, want ErrLeafTooLarge %t", leaf, err, want)
+		}
+	}
+}
+
+func TestSequencePadding(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	p, err := api.NewPaddingEntry()
+	if err != nil {
+		t.Fatalf("NewPaddingEntry = %v", err)
+	}
+	h := sha256.Sum256(p)
+	// Submitted entries mustn't be able to pass themselves off as padding.
+	if _, err := s.Sequence(ctx, h[:], p); !errors.Is(err, log.ErrPaddingEntry) {
+		t.Errorf("Sequence of padding entry = %v, want ErrPaddingEntry", err)
+	}
+	if _, err := s.SequencePadding(ctx, h[:], []byte("leaf")); err == nil {
+		t.Error("SequencePadding of other entry succeeded, want error")
+	}
+
+	for want := uint64(0); want < 2; want++ {
+		p, err := api.NewPaddingEntry()
+		if err != nil {
+			t.Fatalf("NewPaddingEntry = %v", err)
+		}
+		h := sha256.Sum256(p)
+		seq, err := s.SequencePadding(ctx, h[:], p)
+		if err != nil {
+			t.Fatalf("SequencePadding = %v", err)
+		}
+		if seq != want {
+			t.Errorf("SequencePadding = %d, want %d", seq, want)
+		}
+		if _, err := s.LookupIndex(ctx, h[:]); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("LookupIndex of padding entry = %v, want ErrNotExist", err)
+		}
+	}
+}
+
+func TestGetTileRefusesToEscapeRoot(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+
+	// Plant a tile outside of the storage root, and a crafted symlink to it
+	// where a tile for a log of size 1 would be.
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("32\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n"), 0644); err != nil {
+		t.Fatalf("WriteFile = %v", err)
+	}
+	tDir, tFile := layout.TilePath(d, 0, 0, 1)
+	if err := os.MkdirAll(tDir, 0755); err != nil {
+		t.Fatalf("MkdirAll = %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(tDir, tFile)); err != nil {
+		t.Skipf("Symlinks unsupported: %v", err)
+	}
+
+	if _, err := s.GetTile(ctx, 0, 0, 1); !errors.Is(err, layout.ErrInvalidPath) {
+		t.Fatalf("GetTile = %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestSequenceRejectsShortLeafHash(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	if _, err := s.Sequence(context.Background(), []byte{0x01}, []byte("leaf")); !errors.Is(err, layout.ErrInvalidPath) {
+		t.Fatalf("Sequence = %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestPartialTilesRelinkedWithRelativeRoot(t *testing.T) {
+	ctx := context.Background()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd = %v", err)
+	}
+	tmp := t.TempDir()
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatalf("Chdir = %v", err)
+	}
+	defer os.Chdir(wd)
+
+	s, err := Create("storage")
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	partial := &api.Tile{NumLeaves: 1, Nodes: [][]byte{make([]byte, 32)}}
+	if err := s.StoreTile(ctx, 0, 0, partial); err != nil {
+		t.Fatalf("StoreTile(partial) = %v", err)
+	}
+	full := &api.Tile{NumLeaves: 256, Nodes: make([][]byte, 511)}
+	for i := range full.Nodes {
+		full.Nodes[i] = make([]byte, 32)
+	}
+	if err := s.StoreTile(ctx, 0, 0, full); err != nil {
+		t.Fatalf("StoreTile(full) = %v", err)
+	}
+
+	// Reading the partial tile should now return the full tile via the link.
+	got, err := s.GetTile(ctx, 0, 0, 1)
+	if err != nil {
+		t.Fatalf("GetTile = %v", err)
+	}
+	if got.NumLeaves != 256 {
+		t.Errorf("GetTile returned tile with %d leaves, want 256", got.NumLeaves)
+	}
+}
+
+func TestStoreTileSymlinkFallback(t *testing.T) {
+	ctx := context.Background()
+	// Emulate a platform where symlinks are unavailable, e.g. Windows without
+	// developer mode enabled.
+	defer func(o osOps) { ops = o }(ops)
+	ops.symlink = func(string, string) error {
+		return errors.New("a required privilege is not held by the client")
+	}
+
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	partial := &api.Tile{NumLeaves: 1, Nodes: [][]byte{make([]byte, 32)}}
+	if err := s.StoreTile(ctx, 0, 0, partial); err != nil {
+		t.Fatalf("StoreTile(partial) = %v", err)
+	}
+	full := &api.Tile{NumLeaves: 256, Nodes: make([][]byte, 511)}
+	for i := range full.Nodes {
+		full.Nodes[i] = make([]byte, 32)
+	}
+	if err := s.StoreTile(ctx, 0, 0, full); err != nil {
+		t.Fatalf("StoreTile(full) = %v", err)
+	}
+	got, err := s.GetTile(ctx, 0, 0, 1)
+	if err != nil {
+		t.Fatalf("GetTile = %v", err)
+	}
+	if got.NumLeaves != 256 {
+		t.Errorf("GetTile returned tile with %d leaves, want 256", got.NumLeaves)
+	}
+	tDir, tFile := layout.TilePath(d, 0, 0, 1)
+	fi, err := os.Lstat(filepath.Join(tDir, tFile))
+	if err != nil {
+		t.Fatalf("Lstat = %v", err)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		t.Error("Partial tile is a symlink, want a copy")
+	}
+}
+
+func TestImmutableLayoutKeepsPartialTiles(t *testing.T) {
+	ctx := context.Background()
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	s.SetImmutable(true)
+	partial := &api.Tile{NumLeaves: 1, Nodes: [][]byte{make([]byte, 32)}}
+	if err := s.StoreTile(ctx, 0, 0, partial); err != nil {
+		t.Fatalf("StoreTile(partial) = %v", err)
+	}
+	full := &api.Tile{NumLeaves: 256, Nodes: make([][]byte, 511)}
+	for i := range full.Nodes {
+		full.Nodes[i] = make([]byte, 32)
+	}
+	if err := s.StoreTile(ctx, 0, 0, full); err != nil {
+		t.Fatalf("StoreTile(full) = %v", err)
+	}
+	got, err := s.GetTile(ctx, 0, 0, 1)
+	if err != nil {
+		t.Fatalf("GetTile = %v", err)
+	}
+	if got.NumLeaves != 1 {
+		t.Errorf("GetTile returned tile with %d leaves, want the original partial tile", got.NumLeaves)
+	}
+}
+
+func TestDerivedPartialTiles(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	stored, err := Create(filepath.Join(t.TempDir(), "stored"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	derived, err := Create(filepath.Join(t.TempDir(), "derived"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	derived.SetPartialTiles(api.PartialTilesDerived)
+
+	// Integrate in several steps, so that later ones have to read back the
+	// partial tiles on the right edge of the tree, including one on level 1.
+	cps := map[*Storage]*fmtlog.Checkpoint{stored: {}, derived: {}}
+	for _, size := range []uint64{3, 300, 515, 600} {
+		for st, cp := range cps {
+			for i := cp.Size; i < size; i++ {
+				e := []byte(fmt.Sprintf("entry %d", i))
+				if _, err := st.Sequence(ctx, h.HashLeaf(e), e); err != nil {
+					t.Fatalf("Sequence = %v", err)
+				}
+			}
+			if cps[st], err = log.Integrate(ctx, *cp, st, h); err != nil {
+				t.Fatalf("Integrate = %v", err)
+			}
+		}
+		if got, want := cps[derived].Hash, cps[stored].Hash; !cmp.Equal(got, want) {
+			t.Fatalf("Root of derived log at size %d is %x, want %x", size, got, want)
+		}
+	}
+
+	for _, tc := range []struct{ level, index uint64 }{{0, 2}, {1, 0}} {
+		want, err := stored.GetTile(ctx, tc.level, tc.index, 600)
+		if err != nil {
+			t.Fatalf("GetTile(%d, %d) from stored log = %v", tc.level, tc.index, err)
+		}
+		got, err := derived.GetTile(ctx, tc.level, tc.index, 600)
+		if err != nil {
+			t.Fatalf("GetTile(%d, %d) from derived log = %v", tc.level, tc.index, err)
+		}
+		// Parsed tiles have empty rather than nil missing nodes.
+		if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("Derived tile (%d, %d) differs from stored one (-want +got):\n%s", tc.level, tc.index, diff)
+		}
+	}
+	partials, err := filepath.Glob(filepath.Join(derived.rootDir, "tile", "*", "*", "*", "*", "*.*"))
+	if err != nil {
+		t.Fatalf("Glob = %v", err)
+	}
+	if len(partials) > 0 {
+		t.Errorf("Derived log stores partial tiles %v", partials)
+	}
+}
+
+func TestRenameRetriesTransientErrors(t *testing.T) {
+	errSharing := errors.New("the process cannot access the file because it is being used by another process")
+	for _, test := range []struct {
+		desc      string
+		failures  int
+		retryable bool
+		wantErr   bool
+		wantCalls int
+	}{
+		{desc: "success", wantCalls: 1},
+		{desc: "transient", failures: 2, retryable: true, wantCalls: 3},
+		{desc: "persistent", failures: renameAttempts, retryable: true, wantErr: true, wantCalls: renameAttempts},
+		{desc: "permanent", failures: 1, wantErr: true, wantCalls: 1},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			defer func(o osOps) { ops = o }(ops)
+			calls := 0
+			ops.rename = func(string, string) error {
+				calls++
+				if calls <= test.failures {
+					return errSharing
+				}
+				return nil
+			}
+			ops.retryableRename = func(err error) bool {
+				return test.retryable && errors.Is(err, errSharing)
+			}
+			if err := rename("a", "b"); (err != nil) != test.wantErr {
+				t.Fatalf("rename = %v, want err %t", err, test.wantErr)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("rename made %d attempts, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	if _, err := Create(d); err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	unlock, err := Lock(d)
+	if err != nil {
+		t.Fatalf("Lock = %v", err)
+	}
+	if _, err := Lock(d); !errors.Is(err, ErrLocked) || !errors.Is(err, log.ErrStorageConflict) {
+		t.Fatalf("Lock while locked = %v, want ErrLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+	unlock, err = Lock(d)
+	if err != nil {
+		t.Fatalf("Lock after unlock = %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock = %v", err)
+	}
+}
+
+func TestStoragePathsAreNative(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	got := s.path(layout.TilePath("", 1, 2, 3))
+	want := filepath.Join(s.rootDir, "tile", "01", "0000", "00", "00", "02.03")
+	if got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+	if !filepath.IsAbs(got) {
+		t.Errorf("path = %q, want absolute path", got)
+	}
+}
+
+func TestIntegrateRestoresLeafIndex(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	h := rfc6962.DefaultHasher
+	leaves := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+	for _, l := range leaves {
+		if _, err := s.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	// Simulate a crash during sequencing of the second leaf, which left it
+	// without a leafhash -> sequence number mapping.
+	lh := h.HashLeaf(leaves[1])
+	if err := os.Remove(s.path(layout.LeafPath("", lh))); err != nil {
+		t.Fatalf("Remove = %v", err)
+	}
+	if _, err := s.LookupIndex(ctx, lh); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LookupIndex = %v, want not exists error", err)
+	}
+
+	if _, err := log.Integrate(ctx, fmtlog.Checkpoint{}, s, h); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	for i, l := range leaves {
+		got, err := s.LookupIndex(ctx, h.HashLeaf(l))
+		if err != nil {
+			t.Fatalf("LookupIndex(%q) = %v", l, err)
+		}
+		if got != uint64(i) {
+			t.Errorf("LookupIndex(%q) = %d, want %d", l, got, i)
+		}
+	}
+
+	// Existing mappings must not be replaced.
+	if err := s.IndexLeaf(ctx, lh, 42); err != nil {
+		t.Fatalf("IndexLeaf = %v", err)
+	}
+	if got, err := s.LookupIndex(ctx, lh); err != nil || got != 1 {
+		t.Errorf("LookupIndex = %d, %v, want 1", got, err)
+	}
+}
+
+func TestIdentifierIndex(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	h := rfc6962.DefaultHasher
+	for _, e := range []struct {
+		leaf string
+		ids  []string
+	}{
+		{leaf: "one", ids: []string{"a"}},
+		{leaf: "two"},
+		{leaf: "three", ids: []string{"a", "b"}},
+	} {
+		lh := h.HashLeaf([]byte(e.leaf))
+		if len(e.ids) > 0 {
+			if err := s.SetIdentifiers(ctx, lh, e.ids); err != nil {
+				t.Fatalf("SetIdentifiers = %v", err)
+			}
+		}
+		if _, err := s.Sequence(ctx, lh, []byte(e.leaf)); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	// Only the identifiers given with the first submission are kept.
+	if err := s.SetIdentifiers(ctx, h.HashLeaf([]byte("one")), []string{"c"}); err != nil {
+		t.Fatalf("SetIdentifiers = %v", err)
+	}
+	if err := s.SetIdentifiers(ctx, h.HashLeaf([]byte("two")), []string{"bad\n"}); err == nil {
+		t.Error("SetIdentifiers with invalid identifier succeeded")
+	}
+	if _, err := log.Integrate(ctx, fmtlog.Checkpoint{}, s, h); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	// Indexing again, e.g. after an interrupted integration, is a no-op.
+	if err := s.IndexIdentifiers(ctx, h.HashLeaf([]byte("one")), 0); err != nil {
+		t.Fatalf("IndexIdentifiers = %v", err)
+	}
+
+	want := map[string][]uint64{"a": {0, 2}, "b": {2}}
+	got := make(map[string][]uint64)
+	if err := s.ScanEntryLists(ctx, func(l *api.EntryList) error {
+		got[l.Identifier] = l.Indices
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanEntryLists = %v", err)
+	}
+	if diff := cmp.Diff(got, want); len(diff) != 0 {
+		t.Errorf("Entry lists had diff %s", diff)
+	}
+
+	// A map built at size 1 only includes the first entry.
+	r, err := log.BuildMap(ctx, s, 1)
+	if err != nil {
+		t.Fatalf("BuildMap = %v", err)
+	}
+	raw, err := os.ReadFile(s.path(layout.MapPath("", 1, api.IdentifierKey("a"))))
+	if err != nil {
+		t.Fatalf("ReadFile = %v", err)
+	}
+	e, err := api.ParseMapEntry(raw)
+	if err != nil {
+		t.Fatalf("ParseMapEntry = %v", err)
+	}
+	if diff := cmp.Diff(e.Entries, api.EntryList{Identifier: "a", Indices: []uint64{0}}); len(diff) != 0 {
+		t.Errorf("Map entry had diff %s", diff)
+	}
+	if err := vmap.Verify(r.Root, api.IdentifierKey("a"), e.Entries.Marshal(), e.Proof); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	if _, err := os.Stat(s.path(layout.MapPath("", 1, api.IdentifierKey("b")))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of map entry for b = %v, want not exists error", err)
+	}
+}
+
+func TestSequencePerNamespace(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	s.SetDuplicatePolicy(api.DuplicatesPerNamespace)
+	h := rfc6962.DefaultHasher
+	for i, e := range []struct {
+		leaf     string
+		ids      []string
+		wantSeq  uint64
+		wantDupe bool
+	}{
+		{leaf: "sbom", ids: []string{"tenant-a/app"}, wantSeq: 0},
+		{leaf: "sbom", ids: []string{"tenant-b/app"}, wantSeq: 1},
+		// Rejected within a namespace, even under another identifier.
+		{leaf: "sbom", ids: []string{"tenant-a/other"}, wantSeq: 0, wantDupe: true},
+		{leaf: "sbom", ids: []string{"tenant-c/app", "tenant-b/app"}, wantSeq: 1, wantDupe: true},
+		{leaf: "sbom", wantSeq: 2},
+		{leaf: "sbom", wantSeq: 2, wantDupe: true},
+		{leaf: "other", ids: []string{"tenant-a/app"}, wantSeq: 3},
+	} {
+		lh := h.HashLeaf([]byte(e.leaf))
+		if i == 0 {
+			if err := s.SetIdentifiers(ctx, lh, e.ids); err != nil {
+				t.Fatalf("SetIdentifiers = %v", err)
+			}
+		}
+		var seq uint64
+		if len(e.ids) > 0 {
+			seq, err = s.SequenceIdentified(ctx, "", lh, []byte(e.leaf), e.ids)
+		} else {
+			seq, err = s.Sequence(ctx, lh, []byte(e.leaf))
+		}
+		if gotDupe := errors.Is(err, log.ErrDupeLeaf); err != nil && !gotDupe {
+			t.Fatalf("%d: Sequence = %v", i, err)
+		} else if gotDupe != e.wantDupe || seq != e.wantSeq {
+			t.Errorf("%d: Sequence = %d, %v, want %d, dupe %t", i, seq, err, e.wantSeq, e.wantDupe)
+		}
+	}
+	// Retries of a request return the same instance.
+	lh := h.HashLeaf([]byte("sbom"))
+	for i := 0; i < 2; i++ {
+		if seq, err := s.SequenceIdentified(ctx, "req-1", lh, []byte("sbom"), []string{"tenant-d"}); err != nil || seq != 4 {
+			t.Errorf("SequenceIdentified = %d, %v, want 4", seq, err)
+		}
+	}
+	if _, err := log.Integrate(ctx, fmtlog.Checkpoint{}, s, h); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+
+	// Each instance is indexed under its own identifiers.
+	want := map[string][]uint64{"tenant-a/app": {0, 3}, "tenant-b/app": {1}, "tenant-d": {4}}
+	got := make(map[string][]uint64)
+	if err := s.ScanEntryLists(ctx, func(l *api.EntryList) error {
+		got[l.Identifier] = l.Indices
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanEntryLists = %v", err)
+	}
+	if diff := cmp.Diff(got, want); len(diff) != 0 {
+		t.Errorf("Entry lists had diff %s", diff)
+	}
+	// Looking the entry up by its leaf hash finds the first instance.
+	if seq, err := s.LookupIndex(ctx, lh); err != nil || seq != 0 {
+		t.Errorf("LookupIndex = %d, %v, want 0", seq, err)
+	}
+}
+
+func TestPrefixIndex(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	s.SetPrefixIndex(4)
+	h := rfc6962.DefaultHasher
+	for _, leaf := range []string{"abcd/one", "abcd/two", "wxyz/one", "abc"} {
+		if _, err := s.Sequence(ctx, h.HashLeaf([]byte(leaf)), []byte(leaf)); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	if _, err := log.Integrate(ctx, fmtlog.Checkpoint{}, s, h); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	// Indexing again, e.g. after an interrupted integration, is a no-op.
+	if err := s.IndexPrefix(ctx, []byte("abcd/one"), 0); err != nil {
+		t.Fatalf("IndexPrefix = %v", err)
+	}
+
+	// Entries shorter than the prefix aren't indexed.
+	want := map[string][]uint64{
+		api.PrefixIdentifier([]byte("abcd")): {0, 1},
+		api.PrefixIdentifier([]byte("wxyz")): {2},
+	}
+	got := make(map[string][]uint64)
+	if err := s.ScanEntryLists(ctx, func(l *api.EntryList) error {
+		got[l.Identifier] = l.Indices
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanEntryLists = %v", err)
+	}
+	if diff := cmp.Diff(got, want); len(diff) != 0 {
+		t.Errorf("Entry lists had diff %s", diff)
+	}
+}
+
+func TestEntryListPagination(t *testing.T) {
+	for _, f := range []api.IndexFormat{api.IndexFormatJSON, api.IndexFormatBinary} {
+		t.Run(string(f), func(t *testing.T) {
+			ctx := context.Background()
+			s, err := Create(filepath.Join(t.TempDir(), "storage"))
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			s.SetIndexFormat(f)
+			h := rfc6962.DefaultHasher
+			const n = api.EntryPageSize + 5
+			for i := 0; i < n; i++ {
+				leaf := []byte(fmt.Sprintf("leaf %d", i))
+				lh := h.HashLeaf(leaf)
+				if err := s.SetIdentifiers(ctx, lh, []string{"hot"}); err != nil {
+					t.Fatalf("SetIdentifiers = %v", err)
+				}
+				if _, err := s.Sequence(ctx, lh, leaf); err != nil {
+					t.Fatalf("Sequence = %v", err)
+				}
+			}
+			if _, err := log.Integrate(ctx, fmtlog.Checkpoint{}, s, h); err != nil {
+				t.Fatalf("Integrate = %v", err)
+			}
+
+			var l *api.EntryList
+			if err := s.ScanEntryLists(ctx, func(got *api.EntryList) error {
+				l = got
+				return nil
+			}); err != nil {
+				t.Fatalf("ScanEntryLists = %v", err)
+			}
+			if len(l.Pages) != 1 || len(l.Indices) != n-api.EntryPageSize {
+				t.Fatalf("Entry list has %d pages and %d indices, want 1 and %d", len(l.Pages), len(l.Indices), n-api.EntryPageSize)
+			}
+			page, err := s.ReadEntryPage(ctx, "hot", l.Pages[0])
+			if err != nil {
+				t.Fatalf("ReadEntryPage = %v", err)
+			}
+			if page.Indices[0] != 0 || page.Last() != api.EntryPageSize-1 {
+				t.Errorf("Page covers [%d, %d], want [0, %d]", page.Indices[0], page.Last(), api.EntryPageSize-1)
+			}
+
+			// Maps built at sizes before the page was completed hold the entries in
+			// the page as the list's indices, as they were at that size.
+			for _, size := range []uint64{10, n} {
+				r, err := log.BuildMap(ctx, s, size)
+				if err != nil {
+					t.Fatalf("BuildMap(%d) = %v", size, err)
+				}
+				raw, err := os.ReadFile(s.path(layout.MapPath("", size, api.IdentifierKey("hot"))))
+				if err != nil {
+					t.Fatalf("ReadFile = %v", err)
+				}
+				e, err := api.ParseMapEntry(raw)
+				if err != nil {
+					t.Fatalf("ParseMapEntry = %v", err)
+				}
+				if got := api.IsBinaryMapEntry(raw); got != (f == api.IndexFormatBinary) {
+					t.Errorf("Map entry in format %q is binary: %t", f, got)
+				}
+				if err := vmap.Verify(r.Root, api.IdentifierKey("hot"), e.Entries.Marshal(), e.Proof); err != nil {
+					t.Errorf("Verify = %v", err)
+				}
+				if got := e.Entries.Last(); got != size-1 {
+					t.Errorf("Map at size %d has last index %d, want %d", size, got, size-1)
+				}
+				if size < api.EntryPageSize && (len(e.Entries.Pages) != 0 || len(e.Entries.Indices) != int(size)) {
+					t.Errorf("Map at size %d has %d pages and %d indices, want 0 and %d", size, len(e.Entries.Pages), len(e.Entries.Indices), size)
+				}
+			}
+		})
+	}
+}
+
+func TestSubmitterAudit(t *testing.T) {
+	ctx := context.Background()
+	s, err := Create(filepath.Join(t.TempDir(), "storage"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	h := rfc6962.DefaultHasher
+	t0 := time.Unix(1700000000, 0)
+	recs := []struct {
+		submitter string
+		r         api.SubmissionRecord
+	}{
+		{submitter: "key-a", r: api.SubmissionRecord{Time: t0, Seq: 0, LeafHash: h.HashLeaf([]byte("one"))}},
+		{submitter: "key-b", r: api.SubmissionRecord{Time: t0.Add(time.Second), Seq: 1, LeafHash: h.HashLeaf([]byte("two"))}},
+		{submitter: "key-a", r: api.SubmissionRecord{Time: t0.Add(3 * time.Second), Seq: 2, LeafHash: h.HashLeaf([]byte("three"))}},
+		// A duplicate submission by another submitter.
+		{submitter: "key-b", r: api.SubmissionRecord{Time: t0.Add(2 * time.Second), Seq: 0, LeafHash: h.HashLeaf([]byte("one"))}},
+	}
+	for _, r := range recs {
+		if err := s.RecordSubmission(ctx, r.submitter, r.r); err != nil {
+			t.Fatalf("RecordSubmission = %v", err)
+		}
+	}
+	if err := s.RecordSubmission(ctx, "bad\n", recs[0].r); err == nil {
+		t.Error("RecordSubmission with invalid submitter succeeded")
+	}
+
+	for _, test := range []struct {
+		submitter string
+		from, to  time.Time
+		want      []api.SubmissionRecord
+	}{
+		{submitter: "key-a", to: t0.Add(time.Hour), want: []api.SubmissionRecord{recs[0].r, recs[2].r}},
+		{submitter: "key-a", from: t0.Add(time.Second), to: t0.Add(time.Hour), want: []api.SubmissionRecord{recs[2].r}},
+		{submitter: "key-a", from: t0, to: t0.Add(3 * time.Second), want: []api.SubmissionRecord{recs[0].r}},
+		{submitter: "key-b", to: t0.Add(time.Hour), want: []api.SubmissionRecord{recs[1].r, recs[3].r}},
+		{submitter: "key-c", to: t0.Add(time.Hour)},
+	} {
+		got, err := s.Submissions(ctx, test.submitter, test.from, test.to)
+		if err != nil {
+			t.Fatalf("Submissions(%q) = %v", test.submitter, err)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Submissions(%q, %v, %v) had diff (-got +want):\n%s", test.submitter, test.from, test.to, diff)
+		}
+	}
+
+	// The entry's submitter is whoever first submitted it.
+	for seq, want := range []string{"key-a", "key-b", "key-a"} {
+		if got, err := s.EntrySubmitter(ctx, uint64(seq)); err != nil || got != want {
+			t.Errorf("EntrySubmitter(%d) = %q, %v, want %q", seq, got, err, want)
+		}
+	}
+	if _, err := s.EntrySubmitter(ctx, 3); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("EntrySubmitter of unknown entry = %v, want ErrNotExist", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(root)
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	h := rfc6962.DefaultHasher
+	for _, l := range []string{"one", "two"} {
+		if _, err := s.Sequence(ctx, h.HashLeaf([]byte(l)), []byte(l)); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+	if err := s.Redact(ctx, 0, []byte("tombstone")); err != nil {
+		t.Fatalf("Redact = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(layout.SeqPath(root, 0))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of redacted entry = %v, want ErrNotExist", err)
+	}
+	got, err := os.ReadFile(filepath.Join(layout.TombstonePath(root, 0)))
+	if err != nil || string(got) != "tombstone" {
+		t.Errorf("Tombstone = %q, %v, want %q", got, err, "tombstone")
+	}
+	// The leaf hash index is kept, so the entry can still be found.
+	if seq, err := s.LookupIndex(ctx, h.HashLeaf([]byte("one"))); err != nil || seq != 0 {
+		t.Errorf("LookupIndex of redacted entry = %d, %v, want 0", seq, err)
+	}
+	if err := s.Redact(ctx, 0, []byte("tombstone")); err != nil {
+		t.Errorf("Redact again = %v", err)
+	}
+	if err := s.Redact(ctx, 0, []byte("other")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Redact with another tombstone = %v, want ErrExist", err)
+	}
+	if _, err := os.Stat(filepath.Join(layout.SeqPath(root, 1))); err != nil {
+		t.Errorf("Stat of unredacted entry = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+// osOps abstracts the filesystem operations whose semantics differ between
+// platforms, so that the behaviour of this package on those platforms can be
+// tested anywhere.
+type osOps struct {
+	rename  func(oldpath, newpath string) error
+	symlink func(target, link string) error
+	// retryableRename returns true if err indicates a transient failure to
+	// rename a file which is likely to succeed if retried.
+	retryableRename func(err error) bool
+	// lock takes a non-blocking exclusive lock on f, returning errWouldBlock
+	// if it's held elsewhere.
+	lock   func(f *os.File) error
+	unlock func(f *os.File) error
+}
+
+// ops are the operations used by this package, the platform specific
+// implementations live in os_*.go.
+var ops = osOps{
+	rename:          os.Rename,
+	symlink:         os.Symlink,
+	retryableRename: isRetryableRenameError,
+	lock:            lockFile,
+	unlock:          unlockFile,
+}
+
+var (
+	// ErrLocked is returned by Lock when the storage is already locked by
+	// another process. It matches log.ErrStorageConflict.
+	ErrLocked = fmt.Errorf("storage is locked: %w", log.ErrStorageConflict)
+
+	// errWouldBlock is returned by the platform lock implementations when the
+	// lock is already held.
+	errWouldBlock = errors.New("lock would block")
+)
+
+const (
+	lockFileName = ".lock"
+	// writeLockFileName is the lock held for the duration of each
+	// conditional write. It's distinct from the lock taken by Lock so that
+	// conditional writes can be made while that's held.
+	writeLockFileName = ".write.lock"
+
+	writeLockAttempts   = 10
+	writeLockRetryDelay = time.Millisecond
+
+	renameAttempts   = 5
+	renameRetryDelay = 10 * time.Millisecond
+)
+
+// rename atomically renames oldpath to newpath, replacing newpath if it exists.
+// Transient failures, e.g. due to newpath being held open by another process
+// on Windows, are retried a few times with a short backoff.
+func rename(oldpath, newpath string) error {
+	var err error
+	for i := 0; i < renameAttempts; i++ {
+		if err = ops.rename(oldpath, newpath); err == nil || !ops.retryableRename(err) {
+			return err
+		}
+		time.Sleep(renameRetryDelay << i)
+	}
+	return err
+}
+
+// Lock takes an exclusive advisory lock on the log storage at rootDir, which
+// other callers of Lock (in this or other processes) will respect.
+// It does not block, and returns ErrLocked if the lock is already held.
+// The returned function must be called to release the lock.
+func Lock(rootDir string) (func() error, error) {
+	return lockPath(filepath.Join(rootDir, lockFileName))
+}
+
+// waitLock takes an exclusive lock on the file at p as lockPath does, but
+// retries a few times with a short backoff if the lock is held, since it's
+// only used for short critical sections.
+func waitLock(p string) (func() error, error) {
+	var err error
+	for i := 0; i < writeLockAttempts; i++ {
+		var unlock func() error
+		if unlock, err = lockPath(p); !errors.Is(err, ErrLocked) {
+			return unlock, err
+		}
+		time.Sleep(writeLockRetryDelay << i)
+	}
+	return nil, err
+}
+
+// lockPath takes a non-blocking exclusive lock on the file at p, creating it
+// if necessary.
+func lockPath(p string) (func() error, error) {
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %q: %w", p, err)
+	}
+	if err := ops.lock(f); err != nil {
+		f.Close()
+		if errors.Is(err, errWouldBlock) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock %q: %w", p, err)
+	}
+	return func() error {
+		err := ops.unlock(f)
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package fs
+
+import (
+	"os"
+)
+
+func isRetryableRenameError(error) bool {
+	return false
+}
+
+// lockFile is a no-op on platforms without a supported file locking
+// mechanism, so callers must arrange for mutual exclusion themselves.
+func lockFile(*os.File) error {
+	return nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
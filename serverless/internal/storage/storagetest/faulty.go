@@ -0,0 +1,205 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+// ErrInjected is returned (wrapped) by the operations a Faulty storage fails.
+var ErrInjected = errors.New("injected fault")
+
+// Faults configures the faults injected by a Faulty storage.
+type Faults struct {
+	// FailWrites makes writes fail with ErrInjected once FailAfter of them
+	// have succeeded, as if the writer crashed part way through, leaving
+	// only some of its writes in storage.
+	FailWrites bool
+	FailAfter  int
+	// Latency is added to every operation, to widen the windows in which
+	// concurrent readers and writers can race with it.
+	Latency time.Duration
+	// Conflicts is the number of conditional writes which fail with
+	// log.ErrGenerationMismatch, as if another writer had got there first,
+	// before they're passed through.
+	Conflicts int
+	// Reorder holds back stored tiles until Flush is called, and then
+	// stores them in the reverse order, so that they become visible in a
+	// different order to the one in which they were written.
+	Reorder bool
+}
+
+// Faulty is a log.Storage which injects faults into the operations it passes
+// through to another. It also implements log.ConditionalStorage and
+// log.Flusher, passing them through if the other storage does, but no other
+// optional interfaces.
+type Faulty struct {
+	st log.Storage
+	f  Faults
+
+	mu        sync.Mutex
+	writes    int
+	conflicts int
+	pending   []pendingTile
+}
+
+// pendingTile is a tile held back by a Faulty storage until it's flushed.
+type pendingTile struct {
+	level, index uint64
+	tile         *api.Tile
+}
+
+// NewFaulty returns a Faulty storage which injects the given faults into the
+// operations it passes through to st.
+func NewFaulty(st log.Storage, f Faults) *Faulty {
+	return &Faulty{st: st, f: f}
+}
+
+// delay waits for the configured latency, or until ctx is done.
+func (s *Faulty) delay(ctx context.Context) error {
+	if s.f.Latency <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(s.f.Latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write is called before each write, and returns an error if it should fail.
+func (s *Faulty) write(ctx context.Context, what string) error {
+	if err := s.delay(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f.FailWrites && s.writes >= s.f.FailAfter {
+		return fmt.Errorf("%w: %s after %d writes", ErrInjected, what, s.writes)
+	}
+	s.writes++
+	return nil
+}
+
+// GetTile implements log.Storage.
+func (s *Faulty) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
+	if err := s.delay(ctx); err != nil {
+		return nil, err
+	}
+	return s.st.GetTile(ctx, level, index, logSize)
+}
+
+// StoreTile implements log.Storage.
+func (s *Faulty) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	if s.f.Reorder {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		t := *tile
+		t.Nodes = append([][]byte{}, tile.Nodes...)
+		s.pending = append(s.pending, pendingTile{level: level, index: index, tile: &t})
+		return nil
+	}
+	if err := s.write(ctx, "StoreTile"); err != nil {
+		return err
+	}
+	return s.st.StoreTile(ctx, level, index, tile)
+}
+
+// Flush implements log.Flusher, storing any tiles held back by Reorder in the
+// reverse order to which they were written.
+func (s *Faulty) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for i := len(pending) - 1; i >= 0; i-- {
+		p := pending[i]
+		if err := s.write(ctx, "StoreTile"); err != nil {
+			return err
+		}
+		if err := s.st.StoreTile(ctx, p.level, p.index, p.tile); err != nil {
+			return err
+		}
+	}
+	if f, ok := s.st.(log.Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// WriteCheckpoint implements log.Storage.
+func (s *Faulty) WriteCheckpoint(ctx context.Context, newCPRaw []byte) error {
+	if err := s.write(ctx, "WriteCheckpoint"); err != nil {
+		return err
+	}
+	return s.st.WriteCheckpoint(ctx, newCPRaw)
+}
+
+// Sequence implements log.Storage.
+func (s *Faulty) Sequence(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error) {
+	if err := s.write(ctx, "Sequence"); err != nil {
+		return 0, err
+	}
+	return s.st.Sequence(ctx, leafhash, leaf)
+}
+
+// ScanSequenced implements log.Storage.
+func (s *Faulty) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
+	if err := s.delay(ctx); err != nil {
+		return 0, err
+	}
+	return s.st.ScanSequenced(ctx, begin, f)
+}
+
+// ReadGeneration implements log.ConditionalStorage.
+func (s *Faulty) ReadGeneration(ctx context.Context, path string) ([]byte, log.Generation, error) {
+	cs, ok := s.st.(log.ConditionalStorage)
+	if !ok {
+		return nil, log.NoGeneration, errors.New("storage doesn't support conditional writes")
+	}
+	if err := s.delay(ctx); err != nil {
+		return nil, log.NoGeneration, err
+	}
+	return cs.ReadGeneration(ctx, path)
+}
+
+// WriteIfGeneration implements log.ConditionalStorage.
+func (s *Faulty) WriteIfGeneration(ctx context.Context, path string, data []byte, expected log.Generation) error {
+	cs, ok := s.st.(log.ConditionalStorage)
+	if !ok {
+		return errors.New("storage doesn't support conditional writes")
+	}
+	if err := s.write(ctx, "WriteIfGeneration"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	conflict := s.conflicts < s.f.Conflicts
+	if conflict {
+		s.conflicts++
+	}
+	s.mu.Unlock()
+	if conflict {
+		return fmt.Errorf("%w: injected conflict writing %q", log.ErrGenerationMismatch, path)
+	}
+	return cs.WriteIfGeneration(ctx, path, data, expected)
+}
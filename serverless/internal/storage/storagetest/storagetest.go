@@ -0,0 +1,234 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storagetest provides a conformance suite which every log storage
+// driver must pass, and a decorator which injects faults into a driver, so
+// that new backends can be checked to keep logs intact through crashes,
+// latency, conflicting writers and reordered writes in the same way.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// NewStorageFunc returns a new, empty, instance of the storage driver under
+// test, with the default duplicate policy.
+type NewStorageFunc func(t *testing.T) log.Storage
+
+// Run runs the suite against the driver returned by newStorage.
+func Run(t *testing.T, newStorage NewStorageFunc) {
+	t.Helper()
+	t.Run("sequence", func(t *testing.T) { runSequence(t, newStorage(t)) })
+	t.Run("integrate", func(t *testing.T) { runIntegrate(t, newStorage(t)) })
+	t.Run("conditional writes", func(t *testing.T) { runConditional(t, newStorage(t)) })
+	t.Run("crash during integration", func(t *testing.T) { runCrash(t, newStorage) })
+	t.Run("reordered writes", func(t *testing.T) { runReordered(t, newStorage(t)) })
+}
+
+var h = rfc6962.DefaultHasher
+
+func entry(i uint64) []byte {
+	return []byte(fmt.Sprintf("entry %d", i))
+}
+
+// sequence sequences the entries in [begin, end) in st, which must assign
+// them the same sequence numbers.
+func sequence(ctx context.Context, t *testing.T, st log.Storage, begin, end uint64) {
+	t.Helper()
+	for i := begin; i < end; i++ {
+		seq, err := st.Sequence(ctx, h.HashLeaf(entry(i)), entry(i))
+		if err != nil {
+			t.Fatalf("Sequence(%d): %v", i, err)
+		}
+		if seq != i {
+			t.Fatalf("Sequence(%d) assigned %d", i, seq)
+		}
+	}
+}
+
+// integrate integrates the sequenced entries up to size into the tree
+// committed to by cp, and checks the stored tree.
+func integrate(ctx context.Context, t *testing.T, st log.Storage, cp fmtlog.Checkpoint, size uint64) fmtlog.Checkpoint {
+	t.Helper()
+	newCP, err := log.IntegrateUpTo(ctx, cp, st, h, size)
+	if err != nil {
+		t.Fatalf("IntegrateUpTo(%d): %v", size, err)
+	}
+	if newCP == nil || newCP.Size != size {
+		t.Fatalf("IntegrateUpTo(%d) returned %+v", size, newCP)
+	}
+	checkTree(ctx, t, st, *newCP)
+	return *newCP
+}
+
+// checkTree checks that the tree stored in st, and committed to by cp, holds
+// the entries returned by entry.
+func checkTree(ctx context.Context, t *testing.T, st log.Storage, cp fmtlog.Checkpoint) {
+	t.Helper()
+	rf := &compact.RangeFactory{Hash: h.HashChildren}
+	want := rf.NewEmptyRange(0)
+	for i := uint64(0); i < cp.Size; i++ {
+		if err := want.Append(h.HashLeaf(entry(i)), nil); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	wantRoot, err := want.GetRootHash(nil)
+	if err != nil {
+		t.Fatalf("GetRootHash: %v", err)
+	}
+	if !bytes.Equal(cp.Hash, wantRoot) {
+		t.Fatalf("Checkpoint at size %d has root %x, want %x", cp.Size, cp.Hash, wantRoot)
+	}
+	hashes, err := client.FetchRangeNodes(ctx, cp.Size, func(ctx context.Context, level, index uint64) (*api.Tile, error) {
+		return st.GetTile(ctx, level, index, cp.Size)
+	})
+	if err != nil {
+		t.Fatalf("FetchRangeNodes(%d): %v", cp.Size, err)
+	}
+	got, err := rf.NewRange(0, cp.Size, hashes)
+	if err != nil {
+		t.Fatalf("NewRange: %v", err)
+	}
+	if gotRoot, err := got.GetRootHash(nil); err != nil || !bytes.Equal(gotRoot, wantRoot) {
+		t.Fatalf("Stored tree at size %d has root %x (err %v), want %x", cp.Size, gotRoot, err, wantRoot)
+	}
+}
+
+func runSequence(t *testing.T, st log.Storage) {
+	ctx := context.Background()
+	sequence(ctx, t, st, 0, 10)
+	// Duplicates may be rejected, but must then return the original
+	// sequence number.
+	if seq, err := st.Sequence(ctx, h.HashLeaf(entry(3)), entry(3)); errors.Is(err, log.ErrDupeLeaf) && seq != 3 {
+		t.Errorf("Sequence(duplicate of 3) = %d, %v, want 3", seq, err)
+	} else if err != nil && !errors.Is(err, log.ErrDupeLeaf) {
+		t.Errorf("Sequence(duplicate of 3): %v", err)
+	}
+	for _, begin := range []uint64{0, 5} {
+		var got []uint64
+		n, err := st.ScanSequenced(ctx, begin, func(seq uint64, e []byte) error {
+			if seq < 10 && !bytes.Equal(e, entry(seq)) {
+				return fmt.Errorf("entry %d is %q, want %q", seq, e, entry(seq))
+			}
+			got = append(got, seq)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ScanSequenced(%d): %v", begin, err)
+		}
+		if n != uint64(len(got)) || n < 10-begin || got[0] != begin {
+			t.Errorf("ScanSequenced(%d) scanned %d entries %v, want %d from %d", begin, n, got, 10-begin, begin)
+		}
+	}
+}
+
+func runIntegrate(t *testing.T, st log.Storage) {
+	ctx := context.Background()
+	cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	sequence(ctx, t, st, 0, 600)
+	// The sizes cross and land on tile boundaries.
+	for _, size := range []uint64{1, 255, 256, 257, 512, 600} {
+		cp = integrate(ctx, t, st, cp, size)
+	}
+	if newCP, err := log.Integrate(ctx, cp, st, h); err != nil || newCP != nil {
+		t.Errorf("Integrate with nothing to do = %+v, %v, want nil", newCP, err)
+	}
+}
+
+func runConditional(t *testing.T, st log.Storage) {
+	ctx := context.Background()
+	cs, ok := st.(log.ConditionalStorage)
+	if !ok {
+		t.Skip("storage doesn't implement log.ConditionalStorage")
+	}
+	p := layout.CheckpointPath
+	// Drivers may or may not create the log with a checkpoint.
+	_, gen, err := cs.ReadGeneration(ctx, p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadGeneration: %v", err)
+	}
+	if err := cs.WriteIfGeneration(ctx, p, []byte("one"), gen); err != nil {
+		t.Fatalf("WriteIfGeneration: %v", err)
+	}
+	got, gen1, err := cs.ReadGeneration(ctx, p)
+	if err != nil || string(got) != "one" || gen1 == gen {
+		t.Fatalf("ReadGeneration = %q, %q, %v, want %q with a new generation", got, gen1, err, "one")
+	}
+	// Writes from a stale generation, or which expect the file not to
+	// exist, fail without changing it.
+	for _, stale := range []log.Generation{gen, log.NoGeneration} {
+		if err := cs.WriteIfGeneration(ctx, p, []byte("two"), stale); !errors.Is(err, log.ErrGenerationMismatch) {
+			t.Errorf("WriteIfGeneration(%q) = %v, want %v", stale, err, log.ErrGenerationMismatch)
+		}
+	}
+	// As do writes which conflict with another writer.
+	fst := NewFaulty(st, Faults{Conflicts: 1})
+	if err := fst.WriteIfGeneration(ctx, p, []byte("two"), gen1); !errors.Is(err, log.ErrStorageConflict) {
+		t.Errorf("WriteIfGeneration with conflict = %v, want %v", err, log.ErrStorageConflict)
+	}
+	if got, _, err := cs.ReadGeneration(ctx, p); err != nil || string(got) != "one" {
+		t.Errorf("ReadGeneration after failed writes = %q, %v, want %q", got, err, "one")
+	}
+	if err := fst.WriteIfGeneration(ctx, p, []byte("two"), gen1); err != nil {
+		t.Errorf("WriteIfGeneration after conflict: %v", err)
+	}
+	if got, _, err := cs.ReadGeneration(ctx, p); err != nil || string(got) != "two" {
+		t.Errorf("ReadGeneration = %q, %v, want %q", got, err, "two")
+	}
+}
+
+func runCrash(t *testing.T, newStorage NewStorageFunc) {
+	ctx := context.Background()
+	for _, failAfter := range []int{0, 1, 2, 3} {
+		t.Run(fmt.Sprintf("after %d writes", failAfter), func(t *testing.T) {
+			st := newStorage(t)
+			sequence(ctx, t, st, 0, 700)
+			cp := integrate(ctx, t, st, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, 100)
+
+			// An integration which crashes part way through leaves the
+			// tree committed to by the checkpoint intact, and the next
+			// integration completes it.
+			fst := NewFaulty(st, Faults{FailWrites: true, FailAfter: failAfter})
+			if _, err := log.Integrate(ctx, cp, fst, h); !errors.Is(err, ErrInjected) {
+				t.Fatalf("Integrate with crash = %v, want %v", err, ErrInjected)
+			}
+			checkTree(ctx, t, st, cp)
+			integrate(ctx, t, st, cp, 700)
+		})
+	}
+}
+
+func runReordered(t *testing.T, st log.Storage) {
+	ctx := context.Background()
+	sequence(ctx, t, st, 0, 700)
+	fst := NewFaulty(st, Faults{Reorder: true, Latency: time.Millisecond})
+	cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	for _, size := range []uint64{300, 700} {
+		cp = integrate(ctx, t, fst, cp, size)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testlog provides a log on the local filesystem for use in tests.
+//
+// It lives apart from storagetest because the fs package's own tests use
+// storagetest, and this package depends on fs.
+package testlog
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Log is a log on the local filesystem which can be grown.
+type Log struct {
+	// Dir is the root directory of the log.
+	Dir    string
+	Origin string
+	// Prefix is prepended to the entries added by Grow.
+	Prefix string
+	St     *fs.Storage
+	// CP is the most recently published checkpoint.
+	CP fmtlog.Checkpoint
+	S  note.Signer
+	V  note.Verifier
+}
+
+// New creates an empty log with the given origin in a temporary directory,
+// signed by a freshly generated key named "log".
+func New(t *testing.T, origin string) *Log {
+	t.Helper()
+	sk, vk, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	l := &Log{Dir: filepath.Join(t.TempDir(), "log"), Origin: origin}
+	if l.S, err = note.NewSigner(sk); err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	if l.V, err = note.NewVerifier(vk); err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	if l.St, err = fs.Create(l.Dir); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	l.CP = fmtlog.Checkpoint{Origin: origin, Hash: rfc6962.DefaultHasher.EmptyRoot()}
+	return l
+}
+
+// Grow adds n entries to the log, and publishes a new checkpoint.
+func (l *Log) Grow(t *testing.T, n int) {
+	t.Helper()
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	for i := 0; i < n; i++ {
+		e := []byte(fmt.Sprintf("%sentry %d", l.Prefix, l.CP.Size+uint64(i)))
+		if _, err := l.St.Sequence(ctx, h.HashLeaf(e), e); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	l.publish(t, false)
+}
+
+// Add adds entry to the log associated with the given identifiers, and
+// publishes a new checkpoint carrying a new snapshot of the identifier map.
+func (l *Log) Add(t *testing.T, entry string, identifiers ...string) {
+	t.Helper()
+	opts := log.SequenceOpts{Origin: l.Origin, Identifiers: identifiers}
+	if _, err := log.SequenceEntry(context.Background(), l.St, rfc6962.DefaultHasher, []byte(entry), opts); err != nil {
+		t.Fatalf("SequenceEntry: %v", err)
+	}
+	l.publish(t, true)
+}
+
+// publish integrates any sequenced entries and writes a new signed
+// checkpoint, with the identifier map extension if withMap is set.
+func (l *Log) publish(t *testing.T, withMap bool) {
+	t.Helper()
+	ctx := context.Background()
+	cp, err := log.Integrate(ctx, l.CP, l.St, rfc6962.DefaultHasher)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	cp.Origin = l.Origin
+	text := cp.Marshal()
+	if withMap {
+		r, err := log.BuildMap(ctx, l.St, cp.Size)
+		if err != nil {
+			t.Fatalf("BuildMap: %v", err)
+		}
+		text = append(text, r.Extension()...)
+	}
+	raw, err := note.Sign(&note.Note{Text: string(text)}, l.S)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := l.St.WriteCheckpoint(ctx, raw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+	l.CP = *cp
+}
@@ -29,7 +29,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"syscall/js"
 
@@ -168,13 +167,16 @@ func (fs *Storage) Sequence(_ context.Context, leafhash []byte, leaf []byte) (ui
 	// 3. Hard link temp -> seq file
 	// 4. Create leafhash file containing assigned sequence number
 
+	if err := layout.ValidateLeafHash(leafhash); err != nil {
+		return 0, err
+	}
 	leafDir, leafFile := layout.LeafPath(fs.root, leafhash)
 	// Check for dupe leaf already present.
 	// If there is one, it should contain the existing leaf's sequence number,
 	// so read that back and return it.
 	leafFQ := filepath.Join(leafDir, leafFile)
 	if seqString, err := get(leafFQ); !os.IsNotExist(err) {
-		origSeq, err := strconv.ParseUint(string(seqString), 16, 64)
+		origSeq, err := api.ParseLeafIndex(seqString)
 		if err != nil {
 			return 0, err
 		}
@@ -205,7 +207,7 @@ func (fs *Storage) Sequence(_ context.Context, leafhash []byte, leaf []byte) (ui
 		// This isn't infallible though, if we crash after hardlinking the
 		// sequence file above, but before doing this a resubmission of the
 		// same leafhash would be permitted.
-		if err := createExclusive(leafFQ, []byte(strconv.FormatUint(seq, 16))); err != nil {
+		if err := createExclusive(leafFQ, api.MarshalLeafIndex(seq)); err != nil {
 			return 0, fmt.Errorf("couldn't create temporary leafhash file: %w", err)
 		}
 		// All done!
@@ -249,11 +251,11 @@ func (fs *Storage) GetTile(_ context.Context, level, index, logSize uint64) (*ap
 		return nil, err
 	}
 
-	var tile api.Tile
-	if err := tile.UnmarshalText(t); err != nil {
+	tile, err := api.ParseTile(t)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse tile: %w", err)
 	}
-	return &tile, nil
+	return tile, nil
 }
 
 // StoreTile writes a tile out to disk.
@@ -291,3 +293,29 @@ func ReadCheckpoint(root string) ([]byte, error) {
 	s := filepath.Join(root, layout.CheckpointPath)
 	return get(s)
 }
+
+// ReadGeneration returns the contents and current Generation of the mutable
+// file at the given layout path. The Generation is the SHA-256 hash of the
+// contents.
+func (fs Storage) ReadGeneration(_ context.Context, p string) ([]byte, log.Generation, error) {
+	d, err := get(filepath.Join(fs.root, p))
+	if err != nil {
+		return nil, log.NoGeneration, err
+	}
+	return d, log.Generation(fmt.Sprintf("%x", sha256.Sum256(d))), nil
+}
+
+// WriteIfGeneration replaces the mutable file at the given layout path with
+// data, provided that its current Generation is expected.
+// No locking is needed since webstorage is only accessible from the single
+// thread of the page which owns it.
+func (fs Storage) WriteIfGeneration(ctx context.Context, p string, data []byte, expected log.Generation) error {
+	_, got, err := fs.ReadGeneration(ctx, p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if got != expected {
+		return fmt.Errorf("%q has generation %q, want %q: %w", p, got, expected, log.ErrGenerationMismatch)
+	}
+	return set(filepath.Join(fs.root, p), data)
+}
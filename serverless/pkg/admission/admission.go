@@ -0,0 +1,284 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admission provides a Kubernetes validating admission webhook which
+// only admits pods whose container images are pinned by digest, and have an
+// entry in a serverless log associated with that digest, e.g. a signature
+// added by the cosign_log command.
+//
+// Admission webhooks must answer within a few seconds, so each image's result
+// is cached: an image found in the log stays admitted, since the log is
+// append-only, while one which isn't is only checked again once the log has
+// grown.
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// ErrNotLogged is returned for artifacts with no verified entry in the log.
+var ErrNotLogged = errors.New("no verified entry in the log")
+
+// CheckerOpts configures a Checker.
+type CheckerOpts struct {
+	// RefreshInterval is how often the log's checkpoint is checked for
+	// updates. Defaults to one minute.
+	RefreshInterval time.Duration
+	// MaxCached is the number of results cached. Defaults to 4096.
+	MaxCached int
+	// Cache, if set, is the cache of the log's artifacts which the Fetcher
+	// reads through. Each check and refresh is made in a scope of it, so that
+	// only the artifacts they verify are cached.
+	Cache *client.ArtifactCache
+}
+
+// Checker checks that artifacts, given by their digest, have an entry in a
+// log associated with the digest in the log's identifier map, which is
+// included in the log's tree.
+//
+// Every new checkpoint is checked to be consistent with the previous one, so
+// all results are for a single consistent view of the log. A Checker is safe
+// for concurrent use.
+type Checker struct {
+	f        client.Fetcher
+	h        merkle.LogHasher
+	interval time.Duration
+	max      int
+	cache    *client.ArtifactCache
+
+	mu        sync.Mutex
+	lst       client.LogStateTracker
+	root      *api.MapRoot
+	refreshed time.Time
+	results   map[string]result
+}
+
+// result is the cached result of checking an identifier: the index of its
+// verified entry, or, if it had none, the size of the log checked.
+type result struct {
+	ok    bool
+	index uint64
+	size  uint64
+}
+
+// NewChecker returns a Checker for the log accessed via f, whose checkpoints
+// are signed by v with the given origin and must commit to a snapshot of its
+// identifier map. It fetches the log's current checkpoint.
+func NewChecker(ctx context.Context, f client.Fetcher, h merkle.LogHasher, v note.Verifier, origin string, opts CheckerOpts) (*Checker, error) {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Minute
+	}
+	if opts.MaxCached <= 0 {
+		opts.MaxCached = 4096
+	}
+	lst, err := client.NewLogStateTracker(ctx, f, h, nil, v, origin, client.UnilateralConsensus(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	c := &Checker{
+		f:         f,
+		h:         h,
+		interval:  opts.RefreshInterval,
+		max:       opts.MaxCached,
+		cache:     opts.Cache,
+		lst:       lst,
+		refreshed: time.Now(),
+		results:   make(map[string]result),
+	}
+	if c.root, err = mapRoot(lst); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Check returns the index of an entry in the log associated with the artifact
+// with the given digest, of the form <algorithm>:<hex digest>, which has been
+// verified to be included in the log. If there's none, an error wrapping
+// ErrNotLogged is returned.
+func (c *Checker) Check(ctx context.Context, digest string) (uint64, error) {
+	alg, d, ok := strings.Cut(digest, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid digest %q", digest)
+	}
+	id, err := api.DigestIdentifier(alg, d)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	if time.Since(c.refreshed) >= c.interval {
+		if err := c.refresh(ctx); err != nil {
+			// Results for the current checkpoint are still valid.
+			glog.Warningf("Failed to refresh checkpoint, continuing with size %d: %v", c.lst.LatestConsistent.Size, err)
+		}
+	}
+	cp, root := c.lst.LatestConsistent, c.root
+	r, cached := c.results[id]
+	c.mu.Unlock()
+	if cached && (r.ok || r.size == cp.Size) {
+		return r.result(id)
+	}
+
+	// The log is read without holding the lock, so that slow checks don't
+	// hold up others.
+	r, err = c.check(ctx, cp, root, id)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	if _, ok := c.results[id]; !ok && len(c.results) >= c.max {
+		c.evict()
+	}
+	c.results[id] = r
+	c.mu.Unlock()
+	return r.result(id)
+}
+
+// result returns the outcome of the check of identifier id.
+func (r result) result(id string) (uint64, error) {
+	if !r.ok {
+		return 0, fmt.Errorf("%s has %w of size %d", id, ErrNotLogged, r.size)
+	}
+	return r.index, nil
+}
+
+// check finds an entry associated with id in the snapshot of the identifier
+// map with the given root, and verifies its inclusion under cp.
+func (c *Checker) check(ctx context.Context, cp log.Checkpoint, root *api.MapRoot, id string) (r result, err error) {
+	if c.cache != nil {
+		var s *client.CacheScope
+		ctx, s = c.cache.Scope(ctx)
+		defer func() { s.Done(err) }()
+	}
+	none := result{size: cp.Size}
+	if root == nil {
+		return none, nil
+	}
+	el, err := client.LookupIdentifier(ctx, c.f, *root, id)
+	if errors.Is(err, os.ErrNotExist) {
+		return none, nil
+	} else if err != nil {
+		return result{}, fmt.Errorf("failed to look up %s: %w", id, err)
+	}
+	it := client.IterateEntries(c.f, el)
+	for it.Next(ctx) {
+		i := it.Index()
+		entry, err := client.GetLeaf(ctx, c.f, i)
+		if errors.Is(err, client.ErrRedacted) {
+			continue
+		} else if err != nil {
+			return result{}, fmt.Errorf("failed to fetch entry %d: %w", i, err)
+		}
+		if _, err := client.VerifyInclusion(ctx, c.f, c.h, cp, i, c.h.HashLeaf(entry)); err != nil {
+			return result{}, fmt.Errorf("failed to verify inclusion of entry %d: %w", i, err)
+		}
+		return result{ok: true, index: i, size: cp.Size}, nil
+	}
+	if err := it.Err(); err != nil {
+		return result{}, err
+	}
+	return none, nil
+}
+
+// Refresh fetches the log's latest checkpoint. If it's stale or can't be shown
+// to be consistent with the current one, an error is returned and the current
+// one is kept.
+func (c *Checker) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh(ctx)
+}
+
+// Run calls Refresh every RefreshInterval until ctx is done, so that checks
+// needn't wait for the checkpoint to be fetched.
+func (c *Checker) Run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := c.Refresh(ctx); err != nil {
+			glog.Warningf("Failed to refresh checkpoint: %v", err)
+		}
+	}
+}
+
+// refresh is as for Refresh, and must be called with c.mu held.
+func (c *Checker) refresh(ctx context.Context) (err error) {
+	if c.cache != nil {
+		var s *client.CacheScope
+		ctx, s = c.cache.Scope(ctx)
+		defer func() { s.Done(err) }()
+	}
+	c.refreshed = time.Now()
+	size := c.lst.LatestConsistent.Size
+	if _, _, _, err := c.lst.Update(ctx); err != nil {
+		return err
+	}
+	if c.lst.LatestConsistent.Size == size {
+		return nil
+	}
+	root, err := mapRoot(c.lst)
+	if err != nil {
+		return err
+	}
+	c.root = root
+	return nil
+}
+
+// evict removes a result from the cache, preferring one which didn't find an
+// entry. It must be called with c.mu held.
+func (c *Checker) evict() {
+	var victim string
+	for k, r := range c.results {
+		victim = k
+		if !r.ok {
+			break
+		}
+	}
+	delete(c.results, victim)
+}
+
+// mapRoot returns the root of the identifier map committed to by the latest
+// checkpoint of lst, or nil if the log is empty.
+func mapRoot(lst client.LogStateTracker) (*api.MapRoot, error) {
+	if lst.LatestConsistent.Size == 0 {
+		return nil, nil
+	}
+	_, ext, _, err := log.ParseCheckpoint(lst.LatestConsistentRaw, lst.Origin, lst.CpSigVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	root, err := api.ParseMapRoot(ext)
+	if err != nil {
+		return nil, fmt.Errorf("log doesn't have an identifier map: %w", err)
+	}
+	return root, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/testlog"
+	"github.com/google/trillian-examples/serverless/pkg/admission"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+var (
+	digestA = "sha256:" + strings.Repeat("aa", 32)
+	digestB = "sha256:" + strings.Repeat("bb", 32)
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+	l := testlog.New(t, "My Log")
+	l.Add(t, "signature of a", digestA)
+
+	fetches := 0
+	fsf := client.NewFSFetcher(os.DirFS(l.Dir))
+	f := func(ctx context.Context, p string) ([]byte, error) {
+		fetches++
+		return fsf(ctx, p)
+	}
+	c, err := admission.NewChecker(ctx, f, rfc6962.DefaultHasher, l.V, "My Log", admission.CheckerOpts{})
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	if i, err := c.Check(ctx, digestA); err != nil || i != 0 {
+		t.Errorf("Check(a) = %d, %v, want 0", i, err)
+	}
+	if _, err := c.Check(ctx, digestB); !errors.Is(err, admission.ErrNotLogged) {
+		t.Errorf("Check(b) = %v, want ErrNotLogged", err)
+	}
+	if _, err := c.Check(ctx, "banana"); err == nil {
+		t.Error("Check of invalid digest succeeded")
+	}
+
+	// Results are cached.
+	fetches = 0
+	if _, err := c.Check(ctx, digestA); err != nil {
+		t.Errorf("Check(a) again: %v", err)
+	}
+	if _, err := c.Check(ctx, digestB); !errors.Is(err, admission.ErrNotLogged) {
+		t.Errorf("Check(b) again = %v, want ErrNotLogged", err)
+	}
+	if fetches != 0 {
+		t.Errorf("Checks of cached results made %d fetches, want 0", fetches)
+	}
+
+	// Once the log has grown, images which weren't in it are checked again.
+	l.Add(t, "signature of b", digestB)
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if i, err := c.Check(ctx, digestB); err != nil || i != 1 {
+		t.Errorf("Check(b) after refresh = %d, %v, want 1", i, err)
+	}
+}
+
+func TestCheckerCache(t *testing.T) {
+	ctx := context.Background()
+	l := testlog.New(t, "My Log")
+	l.Add(t, "signature of a", digestA)
+
+	dir := t.TempDir()
+	cache := client.NewArtifactCache(client.NewFSFetcher(os.DirFS(l.Dir)), dir)
+	c, err := admission.NewChecker(ctx, cache.Fetch, rfc6962.DefaultHasher, l.V, "My Log", admission.CheckerOpts{Cache: cache})
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	if _, err := c.Check(ctx, digestA); err != nil {
+		t.Fatalf("Check(a): %v", err)
+	}
+
+	// The tile used to verify the entry's inclusion is cached.
+	if _, err := os.Stat(filepath.Join(layout.TilePath(dir, 0, 0, 1))); err != nil {
+		t.Errorf("Tile wasn't cached: %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	l := testlog.New(t, "My Log")
+	l.Add(t, "signature of a", digestA)
+	c, err := admission.NewChecker(ctx, client.NewFSFetcher(os.DirFS(l.Dir)), rfc6962.DefaultHasher, l.V, "My Log", admission.CheckerOpts{})
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	srv := httptest.NewServer(&admission.Webhook{Checker: c})
+	defer srv.Close()
+
+	review := func(kind string, images ...string) string {
+		var cs []string
+		for _, i := range images {
+			cs = append(cs, fmt.Sprintf(`{"name":"c","image":%q}`, i))
+		}
+		return fmt.Sprintf(`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"1234","kind":{"group":"","version":"v1","kind":%q},"object":{"spec":{"containers":[%s]}}}}`, kind, strings.Join(cs, ","))
+	}
+	for _, test := range []struct {
+		desc        string
+		req         string
+		wantAllowed bool
+	}{
+		{desc: "logged", req: review("Pod", "example.com/app@"+digestA), wantAllowed: true},
+		{desc: "logged with tag", req: review("Pod", "example.com/app:1.0@"+digestA), wantAllowed: true},
+		{desc: "not logged", req: review("Pod", "example.com/app@"+digestA, "example.com/lib@"+digestB)},
+		{desc: "tag only", req: review("Pod", "example.com/app:1.0")},
+		{desc: "other kind", req: review("ConfigMap"), wantAllowed: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			resp, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(test.req))
+			if err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			defer resp.Body.Close()
+			var got struct {
+				APIVersion string `json:"apiVersion"`
+				Response   struct {
+					UID     string `json:"uid"`
+					Allowed bool   `json:"allowed"`
+				} `json:"response"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got.APIVersion != "admission.k8s.io/v1" || got.Response.UID != "1234" {
+				t.Errorf("Response = %+v, want admission.k8s.io/v1 response to 1234", got)
+			}
+			if got.Response.Allowed != test.wantAllowed {
+				t.Errorf("Allowed = %t, want %t", got.Response.Allowed, test.wantAllowed)
+			}
+		})
+	}
+
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Post of empty review returned %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	for _, test := range []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "example.com/app@sha256:abcd", want: "sha256:abcd"},
+		{ref: "example.com:5000/app:1.0@sha256:abcd", want: "sha256:abcd"},
+		{ref: "example.com/app:1.0", wantErr: true},
+		{ref: "example.com/app@abcd", wantErr: true},
+		{ref: "@sha256:abcd", wantErr: true},
+	} {
+		got, err := admission.ImageDigest(test.ref)
+		if gotErr := err != nil; gotErr != test.wantErr || got != test.want {
+			t.Errorf("ImageDigest(%q) = %q, %v, want %q, err %t", test.ref, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// maxReviewSize is the largest AdmissionReview request accepted.
+const maxReviewSize = 3 << 20
+
+// review is the part of an admission.k8s.io/v1 AdmissionReview used by the
+// webhook, which avoids depending on the Kubernetes API modules.
+type review struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Request    *reviewRequest  `json:"request,omitempty"`
+	Response   *reviewResponse `json:"response,omitempty"`
+}
+
+type reviewRequest struct {
+	UID  string `json:"uid"`
+	Kind struct {
+		Kind string `json:"kind"`
+	} `json:"kind"`
+	Object json.RawMessage `json:"object"`
+}
+
+type reviewResponse struct {
+	UID     string        `json:"uid"`
+	Allowed bool          `json:"allowed"`
+	Status  *reviewStatus `json:"status,omitempty"`
+}
+
+type reviewStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// pod is the part of a Pod used by the webhook.
+type pod struct {
+	Spec struct {
+		Containers          []container `json:"containers"`
+		InitContainers      []container `json:"initContainers"`
+		EphemeralContainers []container `json:"ephemeralContainers"`
+	} `json:"spec"`
+}
+
+type container struct {
+	Image string `json:"image"`
+}
+
+// Webhook is an http.Handler serving the AdmissionReview requests of a
+// validating admission webhook for pods. A pod is admitted only if the
+// image of every one of its containers is given by digest, e.g.
+// example.com/app@sha256:..., and the digest passes Checker's check within
+// Timeout. Other kinds of object are admitted.
+type Webhook struct {
+	Checker *Checker
+	// Timeout is how long the images of a pod may take to check, which must
+	// be shorter than the webhook's timeout in Kubernetes. Defaults to 3s.
+	Timeout time.Duration
+}
+
+// ServeHTTP handles an AdmissionReview request.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxReviewSize))
+	if err != nil {
+		http.Error(rw, "failed to read request", http.StatusBadRequest)
+		return
+	}
+	var req review
+	if err := json.Unmarshal(body, &req); err != nil || req.Request == nil {
+		http.Error(rw, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+	resp := &reviewResponse{UID: req.Request.UID, Allowed: true}
+	if req.Request.Kind.Kind == "Pod" {
+		timeout := w.Timeout
+		if timeout <= 0 {
+			timeout = 3 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := w.admit(ctx, req.Request.Object); err != nil {
+			glog.Infof("Denying pod in request %s: %v", req.Request.UID, err)
+			resp.Allowed = false
+			resp.Status = &reviewStatus{Code: http.StatusForbidden, Message: err.Error()}
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(review{APIVersion: req.APIVersion, Kind: req.Kind, Response: resp}); err != nil {
+		glog.Warningf("Failed to write AdmissionReview response: %v", err)
+	}
+}
+
+// admit returns an error describing why the pod raw mustn't be admitted, if
+// it mustn't.
+func (w *Webhook) admit(ctx context.Context, raw json.RawMessage) error {
+	var p pod
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("invalid pod: %v", err)
+	}
+	for _, cs := range [][]container{p.Spec.InitContainers, p.Spec.Containers, p.Spec.EphemeralContainers} {
+		for _, c := range cs {
+			d, err := ImageDigest(c.Image)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Checker.Check(ctx, d); err != nil {
+				return fmt.Errorf("image %q: %v", c.Image, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ImageDigest returns the digest, of the form <algorithm>:<hex digest>, by
+// which the image reference ref is pinned, e.g. sha256:abcd... for
+// example.com/app:1.0@sha256:abcd.... Images given only by tag are rejected,
+// since the tag may be moved to another image.
+func ImageDigest(ref string) (string, error) {
+	i := strings.LastIndex(ref, "@")
+	if i < 0 {
+		return "", fmt.Errorf("image %q isn't pinned by digest", ref)
+	}
+	d := ref[i+1:]
+	if _, _, ok := strings.Cut(d, ":"); !ok || i == 0 {
+		return "", fmt.Errorf("image %q has an invalid digest", ref)
+	}
+	return d, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cosign reads the image signatures and attestations written by
+// `cosign download signature` and `cosign download attestation`, so that they
+// can be added to a serverless log, and verification pipelines can require
+// their inclusion in it alongside `cosign verify`.
+package cosign
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// EntryHeaderV0 is the first line of the log entry of a signature.
+const EntryHeaderV0 = "Serverless Log Cosign Signature v0"
+
+// inTotoPayloadType is the DSSE payload type of in-toto attestations.
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// Signature is a single cosign signature over a payload, which is either the
+// simple signing payload of an image signature or the in-toto statement of an
+// attestation.
+type Signature struct {
+	Payload   []byte
+	Signature []byte
+	// Subjects are the identifiers, as returned by api.DigestIdentifier, of
+	// the digests of the artifacts the payload is about.
+	Subjects []string
+}
+
+// Entry returns the log entry which records the signature, in the following
+// format:
+//
+// Serverless Log Cosign Signature v0\n
+// <base64 SHA-256 digest of the payload>\n
+// <base64 signature>\n
+//
+// The entry doesn't depend on the certificate or Rekor bundle cosign stores
+// alongside the signature, so a signature always has the same entry.
+func (s *Signature) Entry() []byte {
+	d := sha256.Sum256(s.Payload)
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n%s\n%s\n", EntryHeaderV0, base64.StdEncoding.EncodeToString(d[:]), base64.StdEncoding.EncodeToString(s.Signature))
+	return b.Bytes()
+}
+
+// VerifyBundle verifies that the proof bundle raw, in the JSON form of
+// api.ProofBundle, shows the inclusion of the signature's entry in the log
+// with the given origin, whose checkpoints are signed by v. Returns the
+// verified bundle.
+func (s *Signature) VerifyBundle(raw []byte, h merkle.LogHasher, v note.Verifier, origin string) (*api.ProofBundle, error) {
+	b, _, err := client.OpenProofBundle(raw, h, v, origin)
+	if err != nil {
+		return nil, err
+	}
+	if lh := h.HashLeaf(s.Entry()); !bytes.Equal(b.LeafHash, lh) {
+		return nil, fmt.Errorf("proof bundle is for leaf hash %x, want %x", b.LeafHash, lh)
+	}
+	return b, nil
+}
+
+// Parse parses the output of `cosign download signature` or `cosign download
+// attestation`, which has a JSON object per line, and returns its signatures.
+// An attestation signed by several keys gives a Signature for each.
+func Parse(raw []byte) ([]*Signature, error) {
+	var sigs []*Signature
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(nil, len(raw)+1)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		s, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		sigs = append(sigs, s...)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(sigs) == 0 {
+		return nil, errors.New("no signatures found")
+	}
+	return sigs, nil
+}
+
+// parseLine parses a single object written by cosign download.
+func parseLine(line []byte) ([]*Signature, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	switch {
+	case fields["Base64Signature"] != nil:
+		var d struct {
+			Base64Signature string
+			Payload         []byte
+		}
+		if err := json.Unmarshal(line, &d); err != nil {
+			return nil, fmt.Errorf("invalid signature: %v", err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(d.Base64Signature)
+		if err != nil || len(sig) == 0 {
+			return nil, fmt.Errorf("invalid signature %q", d.Base64Signature)
+		}
+		subjects, err := simpleSigningSubjects(d.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return []*Signature{{Payload: d.Payload, Signature: sig, Subjects: subjects}}, nil
+	case fields["payloadType"] != nil:
+		var env struct {
+			PayloadType string `json:"payloadType"`
+			Payload     []byte `json:"payload"`
+			Signatures  []struct {
+				Sig []byte `json:"sig"`
+			} `json:"signatures"`
+		}
+		if err := json.Unmarshal(line, &env); err != nil {
+			return nil, fmt.Errorf("invalid DSSE envelope: %v", err)
+		}
+		if env.PayloadType != inTotoPayloadType {
+			return nil, fmt.Errorf("attestation has payload type %q, want %q", env.PayloadType, inTotoPayloadType)
+		}
+		if len(env.Signatures) == 0 {
+			return nil, errors.New("attestation isn't signed")
+		}
+		subjects, err := inTotoSubjects(env.Payload)
+		if err != nil {
+			return nil, err
+		}
+		var sigs []*Signature
+		for _, s := range env.Signatures {
+			if len(s.Sig) == 0 {
+				return nil, errors.New("attestation has an empty signature")
+			}
+			sigs = append(sigs, &Signature{Payload: env.Payload, Signature: s.Sig, Subjects: subjects})
+		}
+		return sigs, nil
+	}
+	return nil, errors.New("neither a cosign signature nor an attestation")
+}
+
+// simpleSigningSubjects returns the identifier of the image digest signed by
+// the simple signing payload p.
+func simpleSigningSubjects(p []byte) ([]string, error) {
+	var ss struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(p, &ss); err != nil {
+		return nil, fmt.Errorf("invalid simple signing payload: %v", err)
+	}
+	alg, digest, ok := strings.Cut(ss.Critical.Image.Digest, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid image digest %q", ss.Critical.Image.Digest)
+	}
+	id, err := api.DigestIdentifier(alg, digest)
+	if err != nil {
+		return nil, err
+	}
+	return []string{id}, nil
+}
+
+// inTotoSubjects returns the identifiers of the digests of the subjects of the
+// in-toto statement p.
+func inTotoSubjects(p []byte) ([]string, error) {
+	var st struct {
+		Subject []struct {
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+	}
+	if err := json.Unmarshal(p, &st); err != nil {
+		return nil, fmt.Errorf("invalid in-toto statement: %v", err)
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, s := range st.Subject {
+		algs := make([]string, 0, len(s.Digest))
+		for alg := range s.Digest {
+			algs = append(algs, alg)
+		}
+		sort.Strings(algs)
+		for _, alg := range algs {
+			id, err := api.DigestIdentifier(alg, s.Digest[alg])
+			if err != nil {
+				return nil, err
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("in-toto statement has no subject digests")
+	}
+	return ids, nil
+}
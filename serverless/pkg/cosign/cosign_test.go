@@ -0,0 +1,141 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cosign_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/cosign"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const (
+	simpleSigning = `{"critical":{"identity":{"docker-reference":"example.com/app"},"image":{"docker-manifest-digest":"sha256:aa"},"type":"cosign container image signature"},"optional":null}`
+	statement     = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"example.com/app","digest":{"sha256":"aa","sha512":"bb"}},{"name":"example.com/lib","digest":{"sha256":"cc"}}],"predicate":{}}`
+)
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestParse(t *testing.T) {
+	sigLine := `{"Base64Signature":"` + b64("sig") + `","Payload":"` + b64(simpleSigning) + `","Cert":null,"Chain":null,"Bundle":{"SignedEntryTimestamp":"","Payload":{}}}`
+	attLine := `{"payloadType":"application/vnd.in-toto+json","payload":"` + b64(statement) + `","signatures":[{"keyid":"","sig":"` + b64("sig1") + `"},{"keyid":"","sig":"` + b64("sig2") + `"}]}`
+	for _, test := range []struct {
+		desc    string
+		raw     string
+		want    []*cosign.Signature
+		wantErr bool
+	}{
+		{
+			desc: "signature",
+			raw:  sigLine + "\n",
+			want: []*cosign.Signature{{Payload: []byte(simpleSigning), Signature: []byte("sig"), Subjects: []string{"sha256:aa"}}},
+		}, {
+			desc: "attestation",
+			raw:  attLine + "\n\n" + sigLine,
+			want: []*cosign.Signature{
+				{Payload: []byte(statement), Signature: []byte("sig1"), Subjects: []string{"sha256:aa", "sha512:bb", "sha256:cc"}},
+				{Payload: []byte(statement), Signature: []byte("sig2"), Subjects: []string{"sha256:aa", "sha512:bb", "sha256:cc"}},
+				{Payload: []byte(simpleSigning), Signature: []byte("sig"), Subjects: []string{"sha256:aa"}},
+			},
+		}, {
+			desc:    "empty",
+			raw:     "\n",
+			wantErr: true,
+		}, {
+			desc:    "not JSON",
+			raw:     sigLine + "\nsig\n",
+			wantErr: true,
+		}, {
+			desc:    "other object",
+			raw:     `{"critical":{}}`,
+			wantErr: true,
+		}, {
+			desc:    "bad image digest",
+			raw:     `{"Base64Signature":"` + b64("sig") + `","Payload":"` + b64(strings.Replace(simpleSigning, "sha256:aa", "aa", 1)) + `"}`,
+			wantErr: true,
+		}, {
+			desc:    "unsigned attestation",
+			raw:     `{"payloadType":"application/vnd.in-toto+json","payload":"` + b64(statement) + `","signatures":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "other payload type",
+			raw:     `{"payloadType":"text/plain","payload":"` + b64(statement) + `","signatures":[{"sig":"` + b64("sig1") + `"}]}`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := cosign.Parse([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Parse: got err %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+				t.Errorf("Parse had diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestEntry(t *testing.T) {
+	s := &cosign.Signature{Payload: []byte("payload"), Signature: []byte("sig")}
+	const want = "Serverless Log Cosign Signature v0\nI59Z7VXnN8dxR89VrQwbAwttfudIp0JpUvm4UtWpNeU=\nc2ln\n"
+	if got := string(s.Entry()); got != want {
+		t.Errorf("Entry = %q, want %q", got, want)
+	}
+}
+
+func TestVerifyBundle(t *testing.T) {
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	sig := &cosign.Signature{Payload: []byte(simpleSigning), Signature: []byte("sig")}
+	other := &cosign.Signature{Payload: []byte(simpleSigning), Signature: []byte("other sig")}
+
+	// The signature is the only entry in the log.
+	lh := h.HashLeaf(sig.Entry())
+	cp := log.Checkpoint{Origin: "My Log", Size: 1, Hash: lh}
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	raw := api.ProofBundle{Checkpoint: string(cpRaw), LeafHash: lh, Proof: api.InclusionProof{Index: 0, Size: 1}}.Marshal()
+	if _, err := sig.VerifyBundle(raw, h, v, "My Log"); err != nil {
+		t.Errorf("VerifyBundle: %v", err)
+	}
+	if _, err := other.VerifyBundle(raw, h, v, "My Log"); err == nil {
+		t.Error("VerifyBundle of other signature succeeded")
+	}
+	if _, err := sig.VerifyBundle(raw, h, v, "Other Log"); err == nil {
+		t.Error("VerifyBundle for other log succeeded")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package guard protects callers of a remote storage backend, such as an
+// object store or an HTTP server, from the backend being degraded. Each
+// attempt at an operation gets a deadline, retries are limited by a budget
+// shared by all operations, and a circuit breaker fails operations straight
+// away once the backend has failed repeatedly, so that callers such as the
+// sequencer fail quickly and clearly rather than hanging.
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpen is wrapped by the errors returned while the circuit breaker is
+	// open.
+	ErrOpen = errors.New("circuit breaker open")
+	// ErrBudgetExhausted is wrapped by the errors returned when an operation
+	// failed and couldn't be retried because the retry budget is spent.
+	ErrBudgetExhausted = errors.New("retry budget exhausted")
+)
+
+// Options configures a Guard. Zero values select the defaults.
+type Options struct {
+	// Deadline is how long each attempt at an operation may take. Defaults
+	// to 10s.
+	Deadline time.Duration
+	// Attempts is the maximum number of times an operation is attempted.
+	// Defaults to 3.
+	Attempts int
+	// RetryDelay is the delay before the first retry of an operation, which
+	// doubles on each subsequent retry. Defaults to 100ms.
+	RetryDelay time.Duration
+	// RetryBudget is the maximum number of retries which may be banked. Each
+	// retry spends one, and each operation which succeeds first time earns
+	// RetryRatio, so that retries can't multiply the load on a struggling
+	// backend. The budget starts full. Defaults to 10.
+	RetryBudget float64
+	// RetryRatio is the fraction of a retry earned by each operation which
+	// succeeds first time. Defaults to 0.1.
+	RetryRatio float64
+	// FailureThreshold is the number of consecutive failed operations after
+	// which the circuit breaker opens. Defaults to 5.
+	FailureThreshold int
+	// Cooldown is how long the circuit breaker stays open before letting a
+	// single trial operation through. Defaults to 30s.
+	Cooldown time.Duration
+}
+
+// Guard wraps the operations on a single backend. It's safe for concurrent
+// use, and should be shared by everything using the backend.
+type Guard struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	budget   float64
+	failures int
+	// openUntil is when the open breaker lets a trial operation through, and
+	// is zero when it's closed.
+	openUntil time.Time
+	// trial is set while a trial operation is in flight.
+	trial bool
+}
+
+// New returns a Guard configured by opts.
+func New(opts Options) *Guard {
+	if opts.Deadline <= 0 {
+		opts.Deadline = 10 * time.Second
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 100 * time.Millisecond
+	}
+	if opts.RetryBudget <= 0 {
+		opts.RetryBudget = 10
+	}
+	if opts.RetryRatio <= 0 {
+		opts.RetryRatio = 0.1
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	return &Guard{opts: opts, now: time.Now, budget: opts.RetryBudget}
+}
+
+// permanentError marks an error as the backend's answer.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err, returned by an operation, to mark it as the backend's
+// answer rather than a failure to reach it, e.g. an object not existing or a
+// precondition failing. It's returned by Do without being retried, and
+// doesn't count against the backend.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Do calls op, giving each attempt its own deadline, and retrying it while
+// it fails, there are attempts left, and the retry budget allows. It fails
+// straight away with an error wrapping ErrOpen while the circuit breaker is
+// open. Errors marked with Permanent are returned unwrapped.
+func (g *Guard) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	if err := g.admit(); err != nil {
+		return err
+	}
+	var err error
+	for i := 0; i < g.opts.Attempts; i++ {
+		if i > 0 {
+			if !g.spend() {
+				err = fmt.Errorf("%w after %d attempts: %v", ErrBudgetExhausted, i, err)
+				break
+			}
+			select {
+			case <-time.After(g.opts.RetryDelay << (i - 1)):
+			case <-ctx.Done():
+				g.abandon()
+				return ctx.Err()
+			}
+		}
+		err = g.attempt(ctx, op)
+		var perm permanentError
+		if err == nil || errors.As(err, &perm) {
+			g.record(true, i == 0)
+			if err != nil {
+				return perm.err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the backend.
+			g.abandon()
+			return err
+		}
+	}
+	g.record(false, false)
+	return err
+}
+
+// attempt calls op once, with the per-attempt deadline.
+func (g *Guard) attempt(ctx context.Context, op func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, g.opts.Deadline)
+	defer cancel()
+	err := op(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && err != nil {
+		return fmt.Errorf("attempt timed out after %v: %w", g.opts.Deadline, err)
+	}
+	return err
+}
+
+// admit returns an error if the circuit breaker is open, and otherwise lets
+// an operation through, as the trial one if the breaker has cooled down.
+func (g *Guard) admit() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.openUntil.IsZero() {
+		return nil
+	}
+	if now := g.now(); g.trial || now.Before(g.openUntil) {
+		wait := g.openUntil.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return fmt.Errorf("%w after %d consecutive failures, next trial in %v", ErrOpen, g.failures, wait.Round(time.Millisecond))
+	}
+	g.trial = true
+	return nil
+}
+
+// spend takes a retry from the budget, returning false if there isn't one.
+func (g *Guard) spend() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.budget < 1 {
+		return false
+	}
+	g.budget--
+	return true
+}
+
+// abandon records that the caller gave up on an operation, which counts as
+// neither a success nor a failure.
+func (g *Guard) abandon() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.trial = false
+}
+
+// record records the outcome of an operation. A success closes the breaker,
+// and earns a fraction of a retry if it took a single attempt. A failure
+// opens the breaker once there have been enough in a row, or reopens it if it
+// was the trial operation.
+func (g *Guard) record(ok, firstAttempt bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	wasTrial := g.trial
+	g.trial = false
+	if ok {
+		g.failures = 0
+		g.openUntil = time.Time{}
+		if firstAttempt {
+			g.budget += g.opts.RetryRatio
+			if g.budget > g.opts.RetryBudget {
+				g.budget = g.opts.RetryBudget
+			}
+		}
+		return
+	}
+	g.failures++
+	if wasTrial || g.failures >= g.opts.FailureThreshold {
+		g.openUntil = g.now().Add(g.opts.Cooldown)
+	}
+}
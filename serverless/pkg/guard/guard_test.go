@@ -0,0 +1,134 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+var errBackend = errors.New("backend error")
+
+// failN returns an operation which fails the first n times it's called, and
+// counts its calls.
+func failN(n int, calls *int) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return errBackend
+		}
+		return nil
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		desc      string
+		opts      Options
+		fail      int
+		wantCalls int
+		wantErr   error
+	}{
+		{desc: "ok", fail: 0, wantCalls: 1},
+		{desc: "retried", fail: 2, wantCalls: 3},
+		{desc: "attempts exhausted", fail: 3, wantCalls: 3, wantErr: errBackend},
+		{desc: "budget exhausted", opts: Options{RetryBudget: 1}, fail: 2, wantCalls: 2, wantErr: ErrBudgetExhausted},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			test.opts.RetryDelay = time.Millisecond
+			g := New(test.opts)
+			calls := 0
+			err := g.Do(ctx, failN(test.fail, &calls))
+			if test.wantErr == nil && err != nil || !errors.Is(err, test.wantErr) {
+				t.Errorf("Do: %v, want %v", err, test.wantErr)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("Got %d calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	g := New(Options{FailureThreshold: 1})
+	calls := 0
+	for i := 0; i < 3; i++ {
+		err := g.Do(context.Background(), func(context.Context) error {
+			calls++
+			return Permanent(os.ErrNotExist)
+		})
+		if err != os.ErrNotExist {
+			t.Fatalf("Do: %v, want unwrapped os.ErrNotExist", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Got %d calls, want 3 with no retries and the breaker closed", calls)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	g := New(Options{Deadline: 10 * time.Millisecond, Attempts: 1})
+	err := g.Do(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do: %v, want deadline exceeded", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	g := New(Options{Attempts: 1, FailureThreshold: 2, Cooldown: time.Minute})
+	g.now = func() time.Time { return now }
+	calls := 0
+	fail := failN(1<<30, &calls)
+
+	for i := 0; i < 2; i++ {
+		if err := g.Do(ctx, fail); !errors.Is(err, errBackend) {
+			t.Fatalf("Do %d: %v, want backend error", i, err)
+		}
+	}
+	// The breaker is open, so operations fail without being called.
+	if err := g.Do(ctx, fail); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Do with breaker open: %v, want ErrOpen", err)
+	}
+	if calls != 2 {
+		t.Errorf("Got %d calls, want 2", calls)
+	}
+
+	// After the cooldown a failing trial reopens it.
+	now = now.Add(time.Minute)
+	if err := g.Do(ctx, fail); !errors.Is(err, errBackend) {
+		t.Fatalf("Trial: %v, want backend error", err)
+	}
+	if err := g.Do(ctx, fail); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Do after failed trial: %v, want ErrOpen", err)
+	}
+
+	// A successful trial closes it.
+	now = now.Add(time.Minute)
+	if err := g.Do(ctx, func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("Trial: %v", err)
+	}
+	if err := g.Do(ctx, fail); !errors.Is(err, errBackend) {
+		t.Errorf("Do after successful trial: %v, want backend error", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// An approval of a staged checkpoint is a note signature line, as would be
+// appended to the checkpoint body by note.Sign, made by a party other than the
+// log. Approvals can be included in the published checkpoint as cosignatures.
+
+// SignApproval returns an approval of the staged checkpoint body by s.
+func SignApproval(cpBody []byte, s note.Signer) ([]byte, error) {
+	msg, err := note.Sign(&note.Note{Text: string(cpBody)}, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	return msg[len(cpBody)+1:], nil
+}
+
+// ApproverID returns a name under which approvals made by the holder of the
+// key with the given name and hash can be stored. Key names may contain
+// characters which can't be used in file names, such as "/" in
+// "example.com/approver", so the name and hash are base64url encoded.
+func ApproverID(name string, hash uint32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s+%08x", name, hash)))
+}
+
+// ApproverKey returns the name and hash of the key encoded in an ID returned
+// by ApproverID, as "<name>+<hash>", for display. Other IDs are returned as
+// they are.
+func ApproverKey(id string) string {
+	k, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return id
+	}
+	return string(k)
+}
+
+// VerifyApprovals returns the signatures from approvals which are valid
+// approvals of the staged checkpoint body by one of the given approvers.
+// At most one signature is returned for each approver key, and approvals which
+// can't be verified are ignored.
+func VerifyApprovals(cpBody []byte, approvals [][]byte, approvers note.Verifiers) []note.Signature {
+	seen := make(map[string]bool)
+	var sigs []note.Signature
+	for _, a := range approvals {
+		msg := append(append(append([]byte{}, cpBody...), '\n'), a...)
+		n, err := note.Open(msg, approvers)
+		if err != nil {
+			glog.V(1).Infof("Ignoring unverifiable approval %q: %v", a, err)
+			continue
+		}
+		for _, s := range n.Sigs {
+			if id := ApproverID(s.Name, s.Hash); !seen[id] {
+				seen[id] = true
+				sigs = append(sigs, s)
+			}
+		}
+	}
+	return sigs
+}
+
+// CombineApprovals returns the signature on the staged checkpoint body by the
+// log's threshold key, with verifier key vkey, made up of the approvals by its
+// members. This is how checkpoints of a log with a threshold key are signed:
+// members approve the staged checkpoint independently, and their approvals
+// are combined once enough have done so, so no one holds the log's key.
+func CombineApprovals(cpBody []byte, approvals [][]byte, vkey string) (note.Signature, error) {
+	var sigs []note.Signature
+	for _, a := range approvals {
+		msg := append(append(append([]byte{}, cpBody...), '\n'), a...)
+		// None of the signatures can be verified as a note signature, since
+		// the members' names aren't known, so they're checked by the
+		// combiner instead.
+		_, err := note.Open(msg, note.VerifierList())
+		var e *note.UnverifiedNoteError
+		if !errors.As(err, &e) {
+			glog.V(1).Infof("Ignoring malformed approval %q: %v", a, err)
+			continue
+		}
+		sigs = append(sigs, e.Note.UnverifiedSigs...)
+	}
+	return i_note.CombineThreshold(vkey, cpBody, sigs)
+}
@@ -0,0 +1,216 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+func TestVerifyApprovals(t *testing.T) {
+	body := []byte("Log Checkpoint v0\n2\nYmFuYW5h\n")
+	newKey := func(name string) (note.Signer, note.Verifier) {
+		t.Helper()
+		sk, vk, err := note.GenerateKey(rand.Reader, name)
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		s, err := note.NewSigner(sk)
+		if err != nil {
+			t.Fatalf("NewSigner: %v", err)
+		}
+		v, err := note.NewVerifier(vk)
+		if err != nil {
+			t.Fatalf("NewVerifier: %v", err)
+		}
+		return s, v
+	}
+	approve := func(s note.Signer, body []byte) []byte {
+		t.Helper()
+		a, err := log.SignApproval(body, s)
+		if err != nil {
+			t.Fatalf("SignApproval: %v", err)
+		}
+		return a
+	}
+	aliceS, aliceV := newKey("alice")
+	bobS, bobV := newKey("bob")
+	eveS, _ := newKey("eve")
+	approvers := note.VerifierList(aliceV, bobV)
+
+	for _, test := range []struct {
+		desc      string
+		approvals [][]byte
+		want      []string
+	}{
+		{
+			desc: "none",
+		}, {
+			desc:      "both",
+			approvals: [][]byte{approve(aliceS, body), approve(bobS, body)},
+			want:      []string{"alice", "bob"},
+		}, {
+			desc:      "duplicate",
+			approvals: [][]byte{approve(aliceS, body), approve(aliceS, body)},
+			want:      []string{"alice"},
+		}, {
+			desc:      "unknown approver",
+			approvals: [][]byte{approve(eveS, body), approve(bobS, body)},
+			want:      []string{"bob"},
+		}, {
+			desc:      "different checkpoint",
+			approvals: [][]byte{approve(aliceS, []byte("Log Checkpoint v0\n3\nYmFuYW5h\n")), approve(bobS, body)},
+			want:      []string{"bob"},
+		}, {
+			desc:      "garbage",
+			approvals: [][]byte{[]byte("banana"), approve(aliceS, body)},
+			want:      []string{"alice"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			sigs := log.VerifyApprovals(body, test.approvals, approvers)
+			if len(sigs) != len(test.want) {
+				t.Fatalf("Got %d approvals, want %d", len(sigs), len(test.want))
+			}
+			for i, s := range sigs {
+				if s.Name != test.want[i] {
+					t.Errorf("Approval %d by %q, want %q", i, s.Name, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApproverID(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		hash uint32
+	}{
+		{name: "approver", hash: 0x01020304},
+		{name: "example.com/approver", hash: 0xdeadbeef},
+		{name: "../../escape", hash: 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			id := log.ApproverID(test.name, test.hash)
+			if err := layout.ValidateElement(id); err != nil {
+				t.Errorf("ApproverID = %q, which isn't a valid path element: %v", id, err)
+			}
+			if got, want := log.ApproverKey(id), fmt.Sprintf("%s+%08x", test.name, test.hash); got != want {
+				t.Errorf("ApproverKey = %q, want %q", got, want)
+			}
+		})
+	}
+	if log.ApproverID("a", 1) == log.ApproverID("a", 2) {
+		t.Error("ApproverID is the same for keys with different hashes")
+	}
+}
+
+func TestCombineApprovals(t *testing.T) {
+	body := []byte("Log Checkpoint v0\n2\nYmFuYW5h\n")
+	var signers []note.Signer
+	var members []string
+	for _, name := range []string{"alice", "bob", "carol"} {
+		sk, vk, err := note.GenerateKey(rand.Reader, name)
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		s, err := note.NewSigner(sk)
+		if err != nil {
+			t.Fatalf("NewSigner: %v", err)
+		}
+		signers = append(signers, s)
+		members = append(members, vk)
+	}
+	vkey, err := i_note.GenerateThresholdKey("example.com/log", 2, members)
+	if err != nil {
+		t.Fatalf("GenerateThresholdKey: %v", err)
+	}
+	v, err := i_note.NewVerifierForKey(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifierForKey: %v", err)
+	}
+	approve := func(s note.Signer, body []byte) []byte {
+		t.Helper()
+		s, err := i_note.NewThresholdMemberSigner(vkey, s)
+		if err != nil {
+			t.Fatalf("NewThresholdMemberSigner: %v", err)
+		}
+		a, err := log.SignApproval(body, s)
+		if err != nil {
+			t.Fatalf("SignApproval: %v", err)
+		}
+		return a
+	}
+	// plain returns an approval by s which isn't a share of the threshold
+	// key's signature.
+	plain := func(s note.Signer) []byte {
+		t.Helper()
+		a, err := log.SignApproval(body, s)
+		if err != nil {
+			t.Fatalf("SignApproval: %v", err)
+		}
+		return a
+	}
+
+	for _, test := range []struct {
+		desc      string
+		approvals [][]byte
+		wantErr   bool
+	}{
+		{
+			desc:      "threshold",
+			approvals: [][]byte{approve(signers[0], body), approve(signers[2], body)},
+		}, {
+			desc:      "too few",
+			approvals: [][]byte{approve(signers[0], body), approve(signers[0], body)},
+			wantErr:   true,
+		}, {
+			desc:      "different checkpoint",
+			approvals: [][]byte{approve(signers[0], body), approve(signers[1], []byte("Log Checkpoint v0\n3\nYmFuYW5h\n"))},
+			wantErr:   true,
+		}, {
+			desc:      "ordinary approvals",
+			approvals: [][]byte{plain(signers[0]), plain(signers[1])},
+			wantErr:   true,
+		}, {
+			desc:      "garbage",
+			approvals: [][]byte{[]byte("banana"), approve(signers[1], body), approve(signers[2], body)},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			sig, err := log.CombineApprovals(body, test.approvals, vkey)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("CombineApprovals: %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			cp, err := note.Sign(&note.Note{Text: string(body), Sigs: []note.Signature{sig}})
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if _, err := note.Open(cp, note.VerifierList(v)); err != nil {
+				t.Errorf("Open: %v", err)
+			}
+		})
+	}
+}
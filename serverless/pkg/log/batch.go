@@ -0,0 +1,163 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Flusher is an optional interface which may be implemented by Storage
+// implementations which complete writes asynchronously.
+//
+// If the storage passed to Integrate implements it, Flush is called once all
+// of the new tiles have been stored, so that the returned checkpoint is never
+// published before the tiles it commits to.
+type Flusher interface {
+	// Flush waits for all outstanding writes to complete, and returns an
+	// error if any of them failed.
+	Flush(ctx context.Context) error
+}
+
+// WriteFunc writes data to the object at the given layout path.
+type WriteFunc func(ctx context.Context, path string, data []byte) error
+
+// BatchOptions configures a WriteBatcher.
+type BatchOptions struct {
+	// Parallelism is the maximum number of writes in flight at once.
+	// Defaults to 16.
+	Parallelism int
+	// Attempts is the number of times each write is attempted before giving
+	// up. Defaults to 3.
+	Attempts int
+	// RetryDelay is the delay before the first retry of a failed write, which
+	// doubles on each subsequent retry. Defaults to 100ms.
+	RetryDelay time.Duration
+	// Retryable returns true if a failed write should be retried. If nil, all
+	// failures are retried.
+	Retryable func(error) bool
+}
+
+// WriteBatcher groups many small writes, such as those of tiles during
+// integration, into concurrent uploads with bounded parallelism and retries.
+// It's intended for storage implementations on object stores, where the
+// latency of each write makes storing a large batch serially impractical.
+//
+// A WriteBatcher is safe for concurrent use.
+type WriteBatcher struct {
+	write WriteFunc
+	opts  BatchOptions
+	sem   chan struct{}
+	wg    sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewWriteBatcher returns a WriteBatcher which writes objects with write.
+func NewWriteBatcher(write WriteFunc, opts BatchOptions) *WriteBatcher {
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 16
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 100 * time.Millisecond
+	}
+	return &WriteBatcher{
+		write: write,
+		opts:  opts,
+		sem:   make(chan struct{}, opts.Parallelism),
+	}
+}
+
+// Write starts writing data to the object at the given layout path, and
+// returns once the write is in flight. It blocks while the maximum number of
+// writes are already in flight.
+//
+// Failures are reported by Flush, although once a write has failed later
+// calls to Write return its error without starting another write, so that
+// callers can stop early.
+func (b *WriteBatcher) Write(ctx context.Context, path string, data []byte) error {
+	if err := b.failed(); err != nil {
+		return err
+	}
+	select {
+	case b.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.wg.Add(1)
+	go func() {
+		defer func() {
+			<-b.sem
+			b.wg.Done()
+		}()
+		if err := b.writeWithRetry(ctx, path, data); err != nil {
+			b.mu.Lock()
+			if b.err == nil {
+				b.err = err
+			}
+			b.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Flush waits for all writes in flight to complete, and returns the error of
+// the first which failed, if any. Once a write has failed the WriteBatcher
+// can't be reused.
+func (b *WriteBatcher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.failed()
+}
+
+func (b *WriteBatcher) failed() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *WriteBatcher) writeWithRetry(ctx context.Context, path string, data []byte) error {
+	var err error
+	for i := 0; i < b.opts.Attempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(b.opts.RetryDelay << (i - 1)):
+			case <-ctx.Done():
+				return fmt.Errorf("failed to write %q: %w", path, ctx.Err())
+			}
+		}
+		if err = b.write(ctx, path, data); err == nil {
+			return nil
+		}
+		if b.opts.Retryable != nil && !b.opts.Retryable(err) {
+			break
+		}
+	}
+	return fmt.Errorf("failed to write %q: %w", path, err)
+}
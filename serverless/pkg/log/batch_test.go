@@ -0,0 +1,104 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+// fakeStore is an object store which fails the first few attempts to write
+// each object, as set by failures.
+type fakeStore struct {
+	failures int
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	attempts map[string]int
+	inFlight int
+	maxInFl  int
+}
+
+func newFakeStore(failures int) *fakeStore {
+	return &fakeStore{failures: failures, objects: make(map[string][]byte), attempts: make(map[string]int)}
+}
+
+func (s *fakeStore) write(_ context.Context, path string, data []byte) error {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFl {
+		s.maxInFl = s.inFlight
+	}
+	s.attempts[path]++
+	fail := s.attempts[path] <= s.failures
+	s.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if fail {
+		return errors.New("unavailable")
+	}
+	s.objects[path] = data
+	return nil
+}
+
+func TestWriteBatcher(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	for _, test := range []struct {
+		desc      string
+		failures  int
+		retryable func(error) bool
+		wantErr   bool
+	}{
+		{desc: "ok"},
+		{desc: "retried", failures: 2},
+		{desc: "too many failures", failures: 3, wantErr: true},
+		{desc: "not retryable", failures: 1, retryable: func(err error) bool { return errors.Is(err, errPermanent) }, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFakeStore(test.failures)
+			b := log.NewWriteBatcher(s.write, log.BatchOptions{Parallelism: 4, Attempts: 3, RetryDelay: time.Millisecond, Retryable: test.retryable})
+			const n = 50
+			for i := 0; i < n; i++ {
+				if err := b.Write(ctx, fmt.Sprintf("tile/%d", i), []byte{byte(i)}); err != nil {
+					if !test.wantErr {
+						t.Fatalf("Write: %v", err)
+					}
+					break
+				}
+			}
+			err := b.Flush(ctx)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Flush: %v, want error %t", err, test.wantErr)
+			}
+			if s.maxInFl > 4 {
+				t.Errorf("%d writes were in flight at once, want at most 4", s.maxInFl)
+			}
+			if !test.wantErr && len(s.objects) != n {
+				t.Errorf("Stored %d objects, want %d", len(s.objects), n)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Generation identifies a version of one of the log's mutable files, such as
+// its checkpoint. It's opaque to callers, who should only compare it for
+// equality, but is typically a hash of the file's contents, like an HTTP ETag.
+type Generation string
+
+// NoGeneration is the Generation of a file which doesn't exist.
+const NoGeneration Generation = ""
+
+// ErrStorageConflict is wrapped by errors returned when a change to the log's
+// storage can't be made because another writer holds it or has changed it
+// concurrently. The change may succeed if retried once the other writer is
+// done, starting again from the state it left.
+var ErrStorageConflict = errors.New("storage conflict")
+
+// ErrGenerationMismatch is returned (wrapped) by conditional writes when the
+// file being written has changed since its expected Generation was read. It
+// matches ErrStorageConflict.
+var ErrGenerationMismatch = fmt.Errorf("generation mismatch: %w", ErrStorageConflict)
+
+// ConditionalStorage is an optional interface which may be implemented by
+// Storage implementations which support compare-and-swap updates of the log's
+// mutable files: the checkpoint, manifest, and shard index.
+//
+// Tools which read a mutable file, derive a new version from it, and write
+// that back should use it where available, so that a concurrent update by
+// another writer is detected rather than silently overwritten, whatever
+// locking (if any) the storage provides.
+type ConditionalStorage interface {
+	// ReadGeneration returns the contents and current Generation of the
+	// mutable file at the given layout path, or an error wrapping
+	// os.ErrNotExist if the file doesn't exist.
+	ReadGeneration(ctx context.Context, path string) ([]byte, Generation, error)
+
+	// WriteIfGeneration atomically replaces the mutable file at the given
+	// layout path with data, provided that its current Generation is
+	// expected. If expected is NoGeneration the file is only created if it
+	// doesn't already exist. Otherwise an error wrapping
+	// ErrGenerationMismatch is returned, and the file is unchanged.
+	WriteIfGeneration(ctx context.Context, path string, data []byte, expected Generation) error
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/sbom"
+)
+
+// ErrInvalidContent is returned when an entry isn't valid content of the type
+// it was submitted with.
+var ErrInvalidContent = errors.New("invalid entry content")
+
+// ContentHandler validates an entry of a content type when it's sequenced,
+// and returns the identifiers derived from its contents to associate it with,
+// in addition to any it was submitted with.
+type ContentHandler func(entry []byte) ([]string, error)
+
+var (
+	contentHandlersMu sync.RWMutex
+	contentHandlers   = map[string]ContentHandler{
+		api.ContentTypeInToto:    inTotoHandler,
+		api.ContentTypeDSSE:      dsseHandler,
+		api.ContentTypeCycloneDX: cycloneDXHandler,
+		api.ContentTypeSPDX:      spdxHandler,
+	}
+)
+
+// RegisterContentHandler registers h as the handler of entries of content
+// type t, replacing any handler registered for it before, including the
+// built-in ones. Entries of types with no handler aren't validated.
+func RegisterContentHandler(t string, h ContentHandler) error {
+	if err := api.ValidateContentType(t); err != nil {
+		return err
+	}
+	contentHandlersMu.Lock()
+	defer contentHandlersMu.Unlock()
+	contentHandlers[t] = h
+	return nil
+}
+
+// HandleContent validates entry as content of type t with the handler
+// registered for it, and returns ids along with the identifiers derived from
+// the entry, without duplicates. Errors from the handler are wrapped in
+// ErrInvalidContent.
+func HandleContent(t string, entry []byte, ids []string) ([]string, error) {
+	if len(t) == 0 {
+		return ids, nil
+	}
+	if err := api.ValidateContentType(t); err != nil {
+		return nil, err
+	}
+	contentHandlersMu.RLock()
+	h := contentHandlers[t]
+	contentHandlersMu.RUnlock()
+	if h == nil {
+		return ids, nil
+	}
+	derived, err := h(entry)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not valid %s: %v", ErrInvalidContent, t, err)
+	}
+	seen := make(map[string]bool)
+	var all []string
+	for _, id := range append(append([]string(nil), ids...), derived...) {
+		if err := api.ValidateIdentifier(id); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidContent, err)
+		}
+		if !seen[id] {
+			seen[id] = true
+			all = append(all, id)
+		}
+	}
+	return all, nil
+}
+
+// digestIdentifiers returns the identifiers of the digests in d, which maps
+// algorithm names to hex digests.
+func digestIdentifiers(d map[string]string) ([]string, error) {
+	algs := make([]string, 0, len(d))
+	for alg := range d {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	var ids []string
+	for _, alg := range algs {
+		id, err := api.DigestIdentifier(alg, d[alg])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// inTotoHandler handles in-toto attestation statements, which are indexed by
+// the digests of their subjects.
+func inTotoHandler(entry []byte) ([]string, error) {
+	var s struct {
+		Type    string `json:"_type"`
+		Subject []struct {
+			Name   string            `json:"name"`
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		PredicateType string `json:"predicateType"`
+	}
+	if err := json.Unmarshal(entry, &s); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(s.Type, "https://in-toto.io/Statement/") {
+		return nil, fmt.Errorf("unknown statement type %q", s.Type)
+	}
+	if len(s.Subject) == 0 || len(s.PredicateType) == 0 {
+		return nil, errors.New("statement has no subject or predicate type")
+	}
+	var ids []string
+	for _, sub := range s.Subject {
+		if len(sub.Digest) == 0 {
+			return nil, fmt.Errorf("subject %q has no digest", sub.Name)
+		}
+		d, err := digestIdentifiers(sub.Digest)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, d...)
+	}
+	return ids, nil
+}
+
+// dsseHandler handles DSSE envelopes. Those carrying in-toto statements are
+// indexed as the statement is. The envelope's signatures aren't verified,
+// since the log doesn't know who should have signed it.
+func dsseHandler(entry []byte) ([]string, error) {
+	var e struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+		Signatures  []struct {
+			Sig string `json:"sig"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(entry, &e); err != nil {
+		return nil, err
+	}
+	if len(e.PayloadType) == 0 || len(e.Signatures) == 0 {
+		return nil, errors.New("envelope has no payload type or signatures")
+	}
+	p, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+	if e.PayloadType != api.ContentTypeInToto {
+		return nil, nil
+	}
+	return inTotoHandler(p)
+}
+
+// cycloneDXHandler handles CycloneDX SBOMs, which are indexed by the digests
+// of the component they describe.
+func cycloneDXHandler(entry []byte) ([]string, error) {
+	b, err := sbom.ParseCycloneDX(entry)
+	if err != nil {
+		return nil, err
+	}
+	return b.SubjectIdentifiers(), nil
+}
+
+// spdxHandler handles SPDX SBOMs, which are indexed by the digests of the
+// packages the document describes.
+func spdxHandler(entry []byte) ([]string, error) {
+	d, err := sbom.ParseSPDX(entry)
+	if err != nil {
+		return nil, err
+	}
+	return d.SubjectIdentifiers(), nil
+}
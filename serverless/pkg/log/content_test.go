@@ -0,0 +1,143 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+const (
+	digestA = "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"
+	digestB = "b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2"
+)
+
+func TestHandleContent(t *testing.T) {
+	statement := `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"a","digest":{"sha256":"` + digestA + `","sha1":"abcd"}},{"name":"b","digest":{"sha256":"` + digestB + `"}}]}`
+	for _, test := range []struct {
+		desc    string
+		t       string
+		entry   string
+		ids     []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:  "untyped",
+			entry: "anything",
+			ids:   []string{"x"},
+			want:  []string{"x"},
+		}, {
+			desc:  "no handler",
+			t:     "text/plain",
+			entry: "anything",
+		}, {
+			desc:    "invalid type",
+			t:       "text",
+			wantErr: true,
+		}, {
+			desc:  "in-toto",
+			t:     api.ContentTypeInToto,
+			entry: statement,
+			ids:   []string{"x", "sha256:" + digestB},
+			want:  []string{"x", "sha256:" + digestB, "sha1:abcd", "sha256:" + digestA},
+		}, {
+			desc:    "in-toto without subject",
+			t:       api.ContentTypeInToto,
+			entry:   `{"_type":"https://in-toto.io/Statement/v1","predicateType":"p","subject":[]}`,
+			wantErr: true,
+		}, {
+			desc:    "in-toto bad digest",
+			t:       api.ContentTypeInToto,
+			entry:   `{"_type":"https://in-toto.io/Statement/v1","predicateType":"p","subject":[{"digest":{"sha256":"zz"}}]}`,
+			wantErr: true,
+		}, {
+			desc:  "DSSE",
+			t:     api.ContentTypeDSSE,
+			entry: `{"payloadType":"application/vnd.in-toto+json","payload":"` + base64.StdEncoding.EncodeToString([]byte(statement)) + `","signatures":[{"sig":"c2ln"}]}`,
+			want:  []string{"sha1:abcd", "sha256:" + digestA, "sha256:" + digestB},
+		}, {
+			desc:  "DSSE of other payload",
+			t:     api.ContentTypeDSSE,
+			entry: `{"payloadType":"text/plain","payload":"aGk=","signatures":[{"sig":"c2ln"}]}`,
+		}, {
+			desc:    "unsigned DSSE",
+			t:       api.ContentTypeDSSE,
+			entry:   `{"payloadType":"text/plain","payload":"aGk=","signatures":[]}`,
+			wantErr: true,
+		}, {
+			desc:  "CycloneDX",
+			t:     api.ContentTypeCycloneDX,
+			entry: `{"bomFormat":"CycloneDX","specVersion":"1.5","metadata":{"component":{"name":"a","hashes":[{"alg":"SHA-256","content":"` + digestA + `"}]}},"components":[{"hashes":[{"alg":"SHA-256","content":"` + digestB + `"}]}]}`,
+			want:  []string{"sha256:" + digestA},
+		}, {
+			desc:    "not CycloneDX",
+			t:       api.ContentTypeCycloneDX,
+			entry:   `{"spdxVersion":"SPDX-2.3"}`,
+			wantErr: true,
+		}, {
+			desc: "SPDX",
+			t:    api.ContentTypeSPDX,
+			entry: `{"spdxVersion":"SPDX-2.3","SPDXID":"SPDXRef-DOCUMENT","packages":[` +
+				`{"SPDXID":"SPDXRef-a","checksums":[{"algorithm":"SHA256","checksumValue":"` + digestA + `"}]},` +
+				`{"SPDXID":"SPDXRef-b","checksums":[{"algorithm":"SHA256","checksumValue":"` + digestB + `"}]}],` +
+				`"relationships":[{"spdxElementId":"SPDXRef-DOCUMENT","relationshipType":"DESCRIBES","relatedSpdxElement":"SPDXRef-a"}]}`,
+			want: []string{"sha256:" + digestA},
+		}, {
+			desc:    "not JSON",
+			t:       api.ContentTypeSPDX,
+			entry:   "SPDXVersion: SPDX-2.3",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := log.HandleContent(test.t, []byte(test.entry), test.ids)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("HandleContent: %v, want error %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); len(diff) != 0 {
+				t.Errorf("HandleContent had diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestRegisterContentHandler(t *testing.T) {
+	const ct = "application/x-test"
+	errBad := errors.New("bad")
+	err := log.RegisterContentHandler(ct, func(entry []byte) ([]string, error) {
+		if string(entry) != "good" {
+			return nil, errBad
+		}
+		return []string{"test/" + string(entry)}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterContentHandler: %v", err)
+	}
+	if got, err := log.HandleContent(ct, []byte("good"), nil); err != nil || !cmp.Equal(got, []string{"test/good"}) {
+		t.Errorf("HandleContent = %q, %v, want [test/good]", got, err)
+	}
+	if _, err := log.HandleContent(ct, []byte("evil"), nil); !errors.Is(err, log.ErrInvalidContent) {
+		t.Errorf("HandleContent of invalid entry = %v, want ErrInvalidContent", err)
+	}
+	if err := log.RegisterContentHandler("Bad Type", nil); err == nil {
+		t.Error("RegisterContentHandler of invalid type succeeded")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// expiryBatchSize is the most entries ExpireEntries adds to the redaction log
+// at once.
+const expiryBatchSize = 1024
+
+// ExpiryStorage represents the set of functions needed to withhold the data of
+// a log's entries once they are older than its retention period.
+type ExpiryStorage interface {
+	RedactionStorage
+
+	// SequencedTime is as for TimestampStorage.
+	SequencedTime(ctx context.Context, seq uint64) (time.Time, error)
+}
+
+// RetentionReason returns the reason recorded in the tombstones of entries
+// withheld by ExpireEntries with the given retention period.
+func RetentionReason(retention time.Duration) string {
+	if retention%(24*time.Hour) == 0 {
+		return fmt.Sprintf("retention period of %d days expired", retention/(24*time.Hour))
+	}
+	return fmt.Sprintf("retention period of %v expired", retention)
+}
+
+// ExpireEntries withholds the data of the integrated entries of the log with
+// the given origin in st which were sequenced more than retention before now,
+// as for Redact, with the reason RetentionReason(retention). The entries' leaf
+// hashes stay in the tree, so the log's structure and proofs are unchanged,
+// and the redaction log serves as an auditable journal of the deletions.
+//
+// Entries are sequenced in time order, so the scan stops at the first entry
+// which hasn't yet expired. Entries already redacted for another reason are
+// left alone, and an interrupted run is completed by the next. Returns the
+// number of entries withheld.
+func ExpireEntries(ctx context.Context, h merkle.LogHasher, st ExpiryStorage, rst Storage, f client.Fetcher, s note.Signer, v note.Verifier, origin string, retention time.Duration, now time.Time) (int, error) {
+	if retention <= 0 {
+		return 0, fmt.Errorf("invalid retention period %v", retention)
+	}
+	reason := RetentionReason(retention)
+	cp, _, _, err := client.FetchCheckpoint(ctx, f, v, origin)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	cutoff := now.Add(-retention)
+	n := 0
+	var rs []*api.Redaction
+	flush := func() error {
+		if len(rs) == 0 {
+			return nil
+		}
+		if err := redact(ctx, h, st, rst, f, s, v, *cp, rs); err != nil {
+			return err
+		}
+		n += len(rs)
+		rs = nil
+		return nil
+	}
+	for idx := uint64(0); idx < cp.Size; idx++ {
+		prev, _, err := client.FetchTombstone(ctx, f, idx)
+		if errors.Is(err, os.ErrNotExist) {
+			t, err := st.SequencedTime(ctx, idx)
+			if err != nil {
+				return n, fmt.Errorf("failed to read sequencing time of entry %d: %w", idx, err)
+			}
+			if t.After(cutoff) {
+				break
+			}
+		} else if err != nil {
+			return n, err
+		} else if prev.Reason != reason {
+			continue
+		} else if _, err := f(ctx, path.Join(layout.SeqPath("", idx))); errors.Is(err, os.ErrNotExist) {
+			// The entry has already expired. If its data is still there, an
+			// earlier run was interrupted, so it's withheld again.
+			continue
+		} else if err != nil {
+			return n, fmt.Errorf("failed to read entry %d: %w", idx, err)
+		}
+		rs = append(rs, &api.Redaction{Origin: origin, Index: idx, Reason: reason})
+		if len(rs) == expiryBatchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, flush()
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// agedStorage is a log storage whose entries were sequenced a day apart.
+type agedStorage struct {
+	*fs.Storage
+	base time.Time
+}
+
+func (s agedStorage) SequencedTime(_ context.Context, seq uint64) (time.Time, error) {
+	return s.base.Add(time.Duration(seq) * 24 * time.Hour), nil
+}
+
+func TestExpireEntries(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	root := filepath.Join(t.TempDir(), "log")
+	fst, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := agedStorage{Storage: fst, base: base}
+	const size = 5
+	for i := 0; i < size; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	cp.Origin = "My Log"
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpRaw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+	rst, err := fs.Create(filepath.Join(root, layout.RedactionsDir))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+	if _, err := log.Redact(ctx, h, st, rst, f, s, v, "My Log", 1, "takedown"); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+
+	// Entries 0 to 2 are more than a week old.
+	const retention = 7 * 24 * time.Hour
+	now := base.Add(9*24*time.Hour + 12*time.Hour)
+	if _, err := log.ExpireEntries(ctx, h, st, rst, f, s, v, "My Log", 0, now); err == nil {
+		t.Error("ExpireEntries with no retention period succeeded, want error")
+	}
+	n, err := log.ExpireEntries(ctx, h, st, rst, f, s, v, "My Log", retention, now)
+	if err != nil {
+		t.Fatalf("ExpireEntries: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("ExpireEntries withheld %d entries, want 2", n)
+	}
+	if n, err := log.ExpireEntries(ctx, h, st, rst, f, s, v, "My Log", retention, now); err != nil || n != 0 {
+		t.Errorf("ExpireEntries again = %d, %v, want 0", n, err)
+	}
+
+	for i, want := range []string{log.RetentionReason(retention), "takedown", log.RetentionReason(retention)} {
+		r, err := client.FetchRedaction(ctx, f, h, v, "My Log", uint64(i))
+		if err != nil {
+			t.Fatalf("FetchRedaction(%d): %v", i, err)
+		}
+		if r.Reason != want {
+			t.Errorf("FetchRedaction(%d) reason = %q, want %q", i, r.Reason, want)
+		}
+	}
+	if got, want := log.RetentionReason(retention), "retention period of 7 days expired"; got != want {
+		t.Errorf("RetentionReason = %q, want %q", got, want)
+	}
+	for i := uint64(3); i < size; i++ {
+		if _, err := client.GetLeaf(ctx, f, i); err != nil {
+			t.Errorf("GetLeaf(%d) of unexpired entry: %v", i, err)
+		}
+	}
+	if _, err := client.GetLeaf(ctx, f, 0); !errors.Is(err, client.ErrRedacted) {
+		t.Errorf("GetLeaf of expired entry = %v, want ErrRedacted", err)
+	}
+	rcp, _, _, err := client.FetchCheckpoint(ctx, client.ShardFetcher(f, layout.RedactionsDir), v, api.RedactionsOrigin("My Log"))
+	if err != nil {
+		t.Fatalf("FetchCheckpoint of redaction log: %v", err)
+	}
+	if rcp.Size != 3 {
+		t.Errorf("Redaction log has size %d, want 3", rcp.Size)
+	}
+	if _, err := client.FetchVerifiedLeaves(ctx, f, h, *cp, 0, size); err != nil {
+		t.Errorf("FetchVerifiedLeaves: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/vmap"
+)
+
+// MapStorage represents the set of functions needed to build snapshots of the
+// identifier map.
+type MapStorage interface {
+	// ScanEntryLists calls f for each entry list in the identifier index.
+	// It should stop scanning if the call to f returns an error.
+	ScanEntryLists(ctx context.Context, f func(l *api.EntryList) error) error
+
+	// WriteMapEntry stores the entry of the identifier with the given key in
+	// the snapshot of the identifier map built at the given log size.
+	WriteMapEntry(ctx context.Context, size uint64, key []byte, raw []byte) error
+}
+
+// EntryPageReader is an optional interface which may be implemented by
+// MapStorage implementations whose entry lists are paginated, as described by
+// api.EntryList. BuildMap needs it to build snapshots at sizes which end part
+// way through a page.
+type EntryPageReader interface {
+	// ReadEntryPage returns the page of the entry list of identifier
+	// referenced by ref, checked against the reference.
+	ReadEntryPage(ctx context.Context, identifier string, ref api.EntryPage) (*api.EntryList, error)
+}
+
+// BuildMap builds a snapshot of the identifier map from the entries in the log
+// at the given size, and stores an entry with a proof for each identifier.
+// Entries at or beyond size are left out of the snapshot.
+//
+// The returned root should be committed to by a checkpoint for the same log
+// size, using its Extension line.
+func BuildMap(ctx context.Context, st MapStorage, size uint64) (*api.MapRoot, error) {
+	lists := make(map[string]api.EntryList)
+	values := make(map[string][]byte)
+	err := st.ScanEntryLists(ctx, func(l *api.EntryList) error {
+		if err := truncateEntryList(ctx, st, l, size); err != nil {
+			return err
+		}
+		if len(l.Pages) == 0 && len(l.Indices) == 0 {
+			return nil
+		}
+		k := string(api.IdentifierKey(l.Identifier))
+		lists[k] = *l
+		values[k] = l.Marshal()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan identifier index: %w", err)
+	}
+	m, err := vmap.New(values)
+	if err != nil {
+		return nil, err
+	}
+	for k, l := range lists {
+		p, err := m.Proof([]byte(k))
+		if err != nil {
+			return nil, err
+		}
+		e := api.MapEntry{Entries: l, Proof: *p}
+		if err := st.WriteMapEntry(ctx, size, []byte(k), e.Marshal()); err != nil {
+			return nil, fmt.Errorf("failed to store map entry for %q: %w", l.Identifier, err)
+		}
+	}
+	return &api.MapRoot{Size: size, Root: m.Root()}, nil
+}
+
+// truncateEntryList removes the indices at or beyond size from l, leaving it
+// as it was when the log had that size.
+func truncateEntryList(ctx context.Context, st MapStorage, l *api.EntryList, size uint64) error {
+	n := 0
+	for n < len(l.Pages) && l.Pages[n].Last < size {
+		n++
+	}
+	tail := l.Indices
+	if n < len(l.Pages) {
+		// The pages from n onwards were completed after size, so the
+		// entries before size in page n were the list's indices then.
+		tail = nil
+		if l.Pages[n].First < size {
+			r, ok := st.(EntryPageReader)
+			if !ok {
+				return fmt.Errorf("entry list for %q is paginated, but storage can't read pages", l.Identifier)
+			}
+			page, err := r.ReadEntryPage(ctx, l.Identifier, l.Pages[n])
+			if err != nil {
+				return fmt.Errorf("failed to read entry page of %q: %w", l.Identifier, err)
+			}
+			tail = page.Indices
+		}
+		l.Pages = l.Pages[:n]
+	}
+	k := 0
+	for k < len(tail) && tail[k] < size {
+		k++
+	}
+	l.Indices = tail[:k]
+	return nil
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 
 	"github.com/golang/glog"
@@ -39,7 +40,10 @@ type Storage interface {
 	// StoreTile stores the tile at the given level & index.
 	StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error
 
-	// WriteCheckpoint stores a newly updated log checkpoint.
+	// WriteCheckpoint stores a newly updated log checkpoint. It's only called
+	// once everything the checkpoint commits to has been stored, and must
+	// replace the previous checkpoint atomically, so that readers see one or
+	// the other, as described by the layout package.
 	WriteCheckpoint(ctx context.Context, newCPRaw []byte) error
 
 	// Sequence assigns sequence numbers to the passed in entry.
@@ -55,50 +59,213 @@ type Storage interface {
 	ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error)
 }
 
+// LeafIndexer is an optional interface which may be implemented by Storage
+// implementations which maintain a mapping from leaf hash to sequence number.
+//
+// If the storage passed to Integrate implements it, IndexLeaf is called for
+// every newly integrated leaf, so that the mapping covers every leaf committed
+// to by the new checkpoint even if its creation during sequencing failed.
+type LeafIndexer interface {
+	// IndexLeaf records seq as the sequence number of the leaf with the given
+	// hash. It must be idempotent, and must not replace an existing mapping
+	// for an earlier instance of the same leaf.
+	IndexLeaf(ctx context.Context, leafhash []byte, seq uint64) error
+
+	// LookupIndex returns the sequence number of the leaf with the given hash,
+	// or an error wrapping os.ErrNotExist if it is unknown.
+	LookupIndex(ctx context.Context, leafhash []byte) (uint64, error)
+}
+
+// IdentifierIndexer is an optional interface which may be implemented by
+// Storage implementations which maintain an index from application
+// identifiers to the sequence numbers of the entries associated with them.
+//
+// If the storage passed to Integrate implements it, IndexIdentifiers is called
+// for every newly integrated leaf.
+type IdentifierIndexer interface {
+	// IndexIdentifiers adds seq to the index of each identifier associated
+	// with the leaf with the given hash. It must be idempotent.
+	IndexIdentifiers(ctx context.Context, leafhash []byte, seq uint64) error
+}
+
+// PrefixIndexer is an optional interface which may be implemented by Storage
+// implementations which index entries by their leading bytes, as described by
+// api.Manifest.PrefixIndex.
+//
+// If the storage passed to Integrate implements it, IndexPrefix is called for
+// every newly integrated leaf.
+type PrefixIndexer interface {
+	// IndexPrefix adds seq to the index of the identifier of the leading
+	// bytes of entry, if it's indexed by prefix. It must be idempotent.
+	IndexPrefix(ctx context.Context, entry []byte, seq uint64) error
+}
+
+// PaddingSequencer is an optional interface which may be implemented by
+// Storage implementations which support padding entries, as created by
+// api.NewPaddingEntry. It's needed by IntegrateBatch to pad out batches.
+type PaddingSequencer interface {
+	// SequencePadding assigns the next available sequence number to the
+	// given padding entry, and returns it. Unlike Sequence, it mustn't
+	// record the entry in any index.
+	SequencePadding(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error)
+}
+
+// RequestSequencer is an optional interface which may be implemented by
+// Storage implementations which support idempotent sequencing, so that a
+// pipeline which delivers submissions at least once, retrying them after a
+// timeout or crash, doesn't add them more than once.
+type RequestSequencer interface {
+	// SequenceRequest is like Sequence, but for an entry submitted with the
+	// given request ID, as checked by api.ValidateRequestID. Once it has
+	// succeeded, later calls with the same request ID return the same
+	// sequence number without sequencing the entry again, whatever the
+	// log's duplicate policy. This holds even if an earlier call failed after
+	// the entry was sequenced, but before that was recorded. A call with a
+	// request ID already used for a different entry fails with an error
+	// wrapping ErrRequestConflict.
+	SequenceRequest(ctx context.Context, requestID string, leafhash []byte, leaf []byte) (uint64, error)
+}
+
+// NamespaceSequencer is an optional interface which may be implemented by
+// Storage implementations which can scope the detection of duplicate entries
+// to the namespaces of the identifiers they're submitted with, as described by
+// api.DuplicatesPerNamespace.
+type NamespaceSequencer interface {
+	// DuplicatesPerNamespace returns true if the log's duplicate policy is
+	// api.DuplicatesPerNamespace, in which case entries submitted with
+	// identifiers must be sequenced with SequenceIdentified.
+	DuplicatesPerNamespace() bool
+
+	// SequenceIdentified is like Sequence, or SequenceRequest if requestID
+	// isn't empty, but for an entry submitted with the identifiers ids. The
+	// entry is only a duplicate if an earlier instance of it was submitted
+	// with an identifier in the same namespace, and otherwise the new
+	// instance is associated with ids when it's integrated, rather than with
+	// those recorded for the leaf hash by SetIdentifiers.
+	SequenceIdentified(ctx context.Context, requestID string, leafhash []byte, leaf []byte, ids []string) (uint64, error)
+}
+
+// CompactRangeStorage is an optional interface which may be implemented by
+// Storage implementations which can keep the compact range of the tree
+// between integrations. Integration then resumes hashing from it, rather than
+// reading the tiles on the right edge of the tree, which speeds up starting
+// to integrate into very large logs. The stored range is only used if it's
+// for the tree committed to by the checkpoint being integrated from.
+type CompactRangeStorage interface {
+	// ReadCompactRange returns the last compact range written by
+	// WriteCompactRange, or an error wrapping os.ErrNotExist if there's none.
+	ReadCompactRange(ctx context.Context) (*api.CompactRange, error)
+	// WriteCompactRange stores the compact range of the tree which has just
+	// been integrated, replacing any earlier one.
+	WriteCompactRange(ctx context.Context, r *api.CompactRange) error
+}
+
+// ErrRequestConflict is returned (wrapped) by SequenceRequest when the request
+// ID has already been used to submit a different entry.
+var ErrRequestConflict = errors.New("request ID already used for a different entry")
+
+// ErrPaddingEntry is returned by the Sequence method of storage
+// implementations to indicate that an entry has the format of a padding
+// entry. Such entries are only added by the integrator, since clients skip
+// them, and a submitted entry mustn't be able to hide from them.
+var ErrPaddingEntry = errors.New("entry has the format of a padding entry")
+
 // ErrDupeLeaf is returned by the Sequence method of storage implementations to
 // indicate that a leaf has already been sequenced.
 var ErrDupeLeaf = errors.New("duplicate leaf")
 
+// ErrLeafTooLarge is returned (wrapped) by the Sequence method of storage
+// implementations which limit the size of entries, to indicate that an entry
+// is larger than the limit.
+var ErrLeafTooLarge = errors.New("leaf too large")
+
+// ErrInconsistentTree is returned (wrapped) when the tree read back from the
+// log doesn't match the checkpoint it's expected to commit to. It's the same
+// error as client.ErrInconsistentTree, so may be tested for with either.
+var ErrInconsistentTree = client.ErrInconsistentTree
+
+// ErrNotPublished is returned (wrapped) by Integrate when a tile of the new
+// tree can't be read back from storage after it's been stored, so the
+// checkpoint committing to it mustn't be published yet.
+var ErrNotPublished = errors.New("tile not published")
+
+// errReachedSize is returned by the ScanSequenced callback of IntegrateUpTo
+// to stop the scan once the requested tree size is reached.
+var errReachedSize = errors.New("reached requested tree size")
+
 // Integrate adds all sequenced entries greater than checkpoint.Size into the tree.
 // Returns an updated Checkpoint, or an error.
 func Integrate(ctx context.Context, checkpoint log.Checkpoint, st Storage, h merkle.LogHasher) (*log.Checkpoint, error) {
-	getTile := func(l, i uint64) (*api.Tile, error) {
-		return st.GetTile(ctx, l, i, checkpoint.Size)
-	}
+	return IntegrateUpTo(ctx, checkpoint, st, h, math.MaxUint64)
+}
 
-	hashes, err := client.FetchRangeNodes(ctx, checkpoint.Size, func(_ context.Context, l, i uint64) (*api.Tile, error) {
-		return getTile(l, i)
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch compact range nodes: %w", err)
-	}
+// IntegrateUpTo is like Integrate, but leaves any sequenced entries at or
+// beyond size out of the tree, for them to be integrated later.
+func IntegrateUpTo(ctx context.Context, checkpoint log.Checkpoint, st Storage, h merkle.LogHasher, size uint64) (*log.Checkpoint, error) {
+	return integrateUpTo(ctx, checkpoint, st, h, size, 0)
+}
 
-	rf := compact.RangeFactory{Hash: h.HashChildren}
-	baseRange, err := rf.NewRange(0, checkpoint.Size, hashes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create range covering existing log: %w", err)
+// integrateUpTo is IntegrateUpTo, holding no more than about budget bytes of
+// new tiles in memory if budget is non-zero, as for
+// ReleasePolicy.MemoryBudget.
+func integrateUpTo(ctx context.Context, checkpoint log.Checkpoint, st Storage, h merkle.LogHasher, size uint64, budget uint64) (*log.Checkpoint, error) {
+	if size <= checkpoint.Size {
+		glog.Infof("Nothing to do.")
+		return nil, nil
 	}
-
-	// Initialise a compact range representation, and verify the stored state.
-	r, err := baseRange.GetRootHash(nil)
+	rf := &compact.RangeFactory{Hash: h.HashChildren}
+	baseRange, rec, err := recoverTree(ctx, checkpoint, st, rf)
 	if err != nil {
-		return nil, fmt.Errorf("invalid log state, unable to recalculate root: %w", err)
+		return nil, err
+	}
+	getTile := func(l, i uint64) (*api.Tile, error) {
+		return rec.getTile(ctx, l, i)
 	}
-
-	glog.Infof("Loaded state with roothash %x", r)
 
 	// Create a new compact range which represents the update to the tree
 	newRange := rf.NewEmptyRange(checkpoint.Size)
-	tc := tileCache{m: make(map[tileKey]*api.Tile), getTile: getTile}
+	tc := &tileCache{m: make(map[tileKey]*api.Tile), getTile: getTile}
+	maxTiles := int(budget / tileMemory)
+	indexer, _ := st.(LeafIndexer)
+	idIndexer, _ := st.(IdentifierIndexer)
+	prefixIndexer, _ := st.(PrefixIndexer)
 	n, err := st.ScanSequenced(ctx,
 		checkpoint.Size,
 		func(seq uint64, entry []byte) error {
+			if seq >= size {
+				return errReachedSize
+			}
 			lh := h.HashLeaf(entry)
+			// Padding entries carry no data, so are left out of the indices.
+			if api.IsPaddingEntry(entry) {
+				newRange.Append(lh, tc.Visit)
+				return nil
+			}
+			if indexer != nil {
+				if err := indexer.IndexLeaf(ctx, lh, seq); err != nil {
+					return fmt.Errorf("failed to index leaf %d: %w", seq, err)
+				}
+			}
+			if idIndexer != nil {
+				if err := idIndexer.IndexIdentifiers(ctx, lh, seq); err != nil {
+					return fmt.Errorf("failed to index identifiers of leaf %d: %w", seq, err)
+				}
+			}
+			if prefixIndexer != nil {
+				if err := prefixIndexer.IndexPrefix(ctx, entry, seq); err != nil {
+					return fmt.Errorf("failed to index prefix of leaf %d: %w", seq, err)
+				}
+			}
 			// Update range and set nodes
 			newRange.Append(lh, tc.Visit)
+			if budget > 0 && len(tc.m) > maxTiles {
+				return tc.storeComplete(ctx, st, checkpoint.Size)
+			}
 			return nil
 		})
-	if err != nil {
+	if errors.Is(err, errReachedSize) {
+		n = size - checkpoint.Size
+	} else if err != nil {
 		return nil, fmt.Errorf("error while integrating: %w", err)
 	}
 	if n == 0 {
@@ -128,6 +295,21 @@ func Integrate(ctx context.Context, checkpoint log.Checkpoint, st Storage, h mer
 			return nil, fmt.Errorf("failed to store tile at level %d index %d: %w", k.level, k.index, err)
 		}
 	}
+	if f, ok := st.(Flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			return nil, fmt.Errorf("failed to store tiles: %w", err)
+		}
+	}
+	if err := checkPublished(ctx, st, baseRange.End()); err != nil {
+		return nil, err
+	}
+	if crs, ok := st.(CompactRangeStorage); ok {
+		// The stored range only saves reading tiles, so failing to store it
+		// isn't fatal.
+		if err := crs.WriteCompactRange(ctx, &api.CompactRange{Size: baseRange.End(), Hashes: baseRange.Hashes()}); err != nil {
+			glog.Warningf("Failed to store compact range: %v", err)
+		}
+	}
 
 	// Finally, return a new checkpoint struct to the caller, so they can sign &
 	// persist it.
@@ -144,6 +326,47 @@ func Integrate(ctx context.Context, checkpoint log.Checkpoint, st Storage, h mer
 	return &newCP, nil
 }
 
+// checkPublished checks that the tiles on the right edge of the tree of the
+// given size, which are the last to be stored for it, can be read back from
+// st with all of their leaves, returning an error wrapping ErrNotPublished if
+// not. This enforces the publication order described by the layout package
+// for storage whose writes may not be visible as soon as they return.
+func checkPublished(ctx context.Context, st Storage, size uint64) error {
+	for level := uint64(0); size>>(level*8) > 0; level++ {
+		sizeAtLevel := size >> (level * 8)
+		index := (sizeAtLevel - 1) / api.TileWidth
+		t, err := st.GetTile(ctx, level, index, size)
+		if err != nil {
+			return fmt.Errorf("%w: tile at level %d index %d: %v", ErrNotPublished, level, index, err)
+		}
+		if n := sizeAtLevel - index*api.TileWidth; uint64(t.NumLeaves) < n {
+			return fmt.Errorf("%w: tile at level %d index %d has %d leaves, want %d", ErrNotPublished, level, index, t.NumLeaves, n)
+		}
+	}
+	return nil
+}
+
+// VerifyAppendOnly independently checks that the tree committed to by next, as
+// read back from the log via f, is an append-only extension of the tree
+// committed to by prev.
+//
+// This is intended to be called by integrators before signing and publishing
+// a new checkpoint, to guard against the published state having been
+// tampered with between runs.
+func VerifyAppendOnly(ctx context.Context, h merkle.LogHasher, f client.Fetcher, prev, next log.Checkpoint) error {
+	if prev.Size > next.Size {
+		return fmt.Errorf("new checkpoint size %d is smaller than previous size %d", next.Size, prev.Size)
+	}
+	if err := client.CheckConsistency(ctx, h, f, []log.Checkpoint{prev, next}); err != nil {
+		return fmt.Errorf("new tree is not an extension of the previous tree: %w", err)
+	}
+	return nil
+}
+
+// tileMemory is roughly the memory used by a tile held by tileCache: a hash
+// and slice header for each of its nodes.
+const tileMemory = 2 * api.TileWidth * (api.HashSize + 24)
+
 // tileKey is a level/index key for the tile cache below.
 type tileKey struct {
 	level uint64
@@ -170,7 +393,7 @@ type tileCache struct {
 // If the tile containing id has not been seen before, this method will fetch
 // it from disk (or create a new empty in-memory tile if it doesn't exist), and
 // update it by setting the node corresponding to id to the value hash.
-func (tc tileCache) Visit(id compact.NodeID, hash []byte) {
+func (tc *tileCache) Visit(id compact.NodeID, hash []byte) {
 	tileLevel, tileIndex, nodeLevel, nodeIndex := layout.NodeCoordsToTileAddress(uint64(id.Level), uint64(id.Index))
 	tileKey := tileKey{level: tileLevel, index: tileIndex}
 	tile := tc.m[tileKey]
@@ -204,3 +427,36 @@ func (tc tileCache) Visit(id compact.NodeID, hash []byte) {
 		tile.NumLeaves = uint(nodeIndex + 1)
 	}
 }
+
+// storeComplete stores the cached tiles which are full and lie wholly beyond
+// the tree of size from, and drops them from the cache. No node of such a tile
+// can change for the rest of the integration, since all of its nodes are set
+// once its last leaf is appended and none is touched by merging the new range
+// onto the old tree.
+//
+// The stored tiles are beyond the current checkpoint, so aren't part of the
+// published tree until a checkpoint committing to them is written, and an
+// interrupted integration stores them again, identically, when it's re-run.
+func (tc *tileCache) storeComplete(ctx context.Context, st Storage, from uint64) error {
+	n := 0
+	for k, t := range tc.m {
+		if t.NumLeaves < api.TileWidth || (k.index*api.TileWidth)<<(k.level*8) < from {
+			continue
+		}
+		if err := st.StoreTile(ctx, k.level, k.index, t); err != nil {
+			return fmt.Errorf("failed to store tile at level %d index %d: %w", k.level, k.index, err)
+		}
+		delete(tc.m, k)
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	glog.V(1).Infof("Stored %d complete tiles to stay within memory budget", n)
+	if f, ok := st.(Flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			return fmt.Errorf("failed to store tiles: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerifyAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+
+	integrate := func(cp fmtlog.Checkpoint, from, to int) fmtlog.Checkpoint {
+		t.Helper()
+		for i := from; i < to; i++ {
+			l := []byte(fmt.Sprintf("leaf %d", i))
+			if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+				t.Fatalf("Sequence: %v", err)
+			}
+		}
+		newCP, err := log.Integrate(ctx, cp, st, h)
+		if err != nil {
+			t.Fatalf("Integrate: %v", err)
+		}
+		return *newCP
+	}
+	empty := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	cp1 := integrate(empty, 0, 3)
+	cp2 := integrate(cp1, 3, 7)
+
+	for _, test := range []struct {
+		desc       string
+		prev, next fmtlog.Checkpoint
+		wantErr    bool
+	}{
+		{desc: "from empty", prev: empty, next: cp1},
+		{desc: "extension", prev: cp1, next: cp2},
+		{desc: "same", prev: cp2, next: cp2},
+		{desc: "shrunk", prev: cp2, next: cp1, wantErr: true},
+		{desc: "tampered previous root", prev: fmtlog.Checkpoint{Size: cp1.Size, Hash: h.HashLeaf([]byte("banana"))}, next: cp2, wantErr: true},
+		{desc: "next root not in storage", prev: cp1, next: fmtlog.Checkpoint{Size: cp2.Size, Hash: cp1.Hash}, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := log.VerifyAppendOnly(ctx, h, f, test.prev, test.next)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyAppendOnly: got err %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+
+	// Tampering with the stored tree must be detected.
+	tile := filepath.Join(root, filepath.FromSlash(path.Join(layout.TilePath("", 0, 0, 7))))
+	if err := os.Remove(tile); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := os.WriteFile(tile, []byte("32\n1\n0Nc2CrefWKseHj/mStd+LqC8B+NrX0btIiPt2SmN+ek=\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := log.VerifyAppendOnly(ctx, h, f, cp1, cp2); err == nil {
+		t.Error("VerifyAppendOnly succeeded with tampered tile, want error")
+	}
+}
+
+func TestPrecomputeInclusionProofs(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+
+	cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	var leaves [][]byte
+	for _, size := range []int{1, 6, 300} {
+		for i := len(leaves); i < size; i++ {
+			l := []byte(fmt.Sprintf("leaf %d", i))
+			if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+				t.Fatalf("Sequence: %v", err)
+			}
+			leaves = append(leaves, l)
+		}
+		newCP, err := log.Integrate(ctx, cp, st, h)
+		if err != nil {
+			t.Fatalf("Integrate: %v", err)
+		}
+		cp = *newCP
+		if err := log.PrecomputeInclusionProofs(ctx, h, f, cp, st); err != nil {
+			t.Fatalf("PrecomputeInclusionProofs: %v", err)
+		}
+		for i, l := range leaves {
+			if _, err := client.VerifyPrecomputedInclusion(ctx, f, h, cp, uint64(i), h.HashLeaf(l)); err != nil {
+				t.Errorf("VerifyPrecomputedInclusion(%d) at size %d: %v", i, size, err)
+			}
+		}
+	}
+	// Proofs for a different leaf, or an older tree, must not verify.
+	if _, err := client.VerifyPrecomputedInclusion(ctx, f, h, cp, 1, h.HashLeaf(leaves[2])); err == nil {
+		t.Error("VerifyPrecomputedInclusion succeeded for the wrong leaf")
+	}
+	d, file := layout.InclusionProofPath(root, 6, 1)
+	raw, err := os.ReadFile(filepath.Join(d, file))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	d, file = layout.InclusionProofPath(root, cp.Size, 1)
+	if err := os.WriteFile(filepath.Join(d, file), raw, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := client.VerifyPrecomputedInclusion(ctx, f, h, cp, 1, h.HashLeaf(leaves[1])); err == nil {
+		t.Error("VerifyPrecomputedInclusion succeeded with a proof for an older tree")
+	}
+}
+
+func TestBuildInventory(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+	const size = 300
+	for i := 0; i < size; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	cp.Origin = "My Log"
+
+	inv, err := log.BuildInventory(ctx, h, f, *cp)
+	if err != nil {
+		t.Fatalf("BuildInventory: %v", err)
+	}
+	// A full tile and a partial tile on level 0, and the partial tile above
+	// them, along with every entry and its leaf hash index.
+	if got, want := len(inv.Objects), 3+2*size; got != want {
+		t.Errorf("Inventory lists %d objects, want %d", got, want)
+	}
+	if inv.Size != cp.Size || string(inv.Hash) != string(cp.Hash) {
+		t.Errorf("Inventory is for size %d root %x, want size %d root %x", inv.Size, inv.Hash, cp.Size, cp.Hash)
+	}
+	r, err := client.VerifyInventory(ctx, f, inv)
+	if err != nil {
+		t.Fatalf("VerifyInventory: %v", err)
+	}
+	if !r.OK() {
+		t.Errorf("VerifyInventory of the log itself = %+v, want OK", r)
+	}
+	// The inventory must also roundtrip, e.g. paths must be sorted.
+	if _, err := api.ParseInventory(inv.Marshal()); err != nil {
+		t.Errorf("ParseInventory: %v", err)
+	}
+}
+
+// lossyStorage drops the tiles stored at one level, as if the writes weren't
+// yet visible to readers.
+type lossyStorage struct {
+	*fs.Storage
+	level uint64
+}
+
+func (s lossyStorage) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	if level == s.level {
+		return nil
+	}
+	return s.Storage.StoreTile(ctx, level, index, tile)
+}
+
+func TestIntegrateChecksPublished(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 300; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	if _, err := log.Integrate(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, lossyStorage{Storage: st, level: 1}, h); !errors.Is(err, log.ErrNotPublished) {
+		t.Errorf("Integrate with lost tiles = %v, want %v", err, log.ErrNotPublished)
+	}
+}
+
+func TestSnapshotReadsDuringIntegration(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+	const origin = "example.com/log"
+	sk, vk, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(sk)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vk)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	publish := func(cp fmtlog.Checkpoint) error {
+		cp.Origin = origin
+		raw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+		if err != nil {
+			return err
+		}
+		return st.WriteCheckpoint(ctx, raw)
+	}
+	if err := publish(fmtlog.Checkpoint{Hash: h.EmptyRoot()}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	// The writer grows the log past several tile boundaries, sequencing the
+	// next batch of entries before publishing the checkpoint for the last,
+	// so there's always data beyond the published checkpoint.
+	done := make(chan error)
+	go func() {
+		cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+		for i := 0; i < 600; i++ {
+			l := []byte(fmt.Sprintf("leaf %d", i))
+			if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+				done <- err
+				return
+			}
+			if i%37 != 36 {
+				continue
+			}
+			newCP, err := log.IntegrateUpTo(ctx, cp, st, h, uint64(i-10))
+			if err != nil {
+				done <- err
+				return
+			}
+			if newCP == nil {
+				continue
+			}
+			cp = *newCP
+			if err := publish(cp); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for reads := 0; ; reads++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Writer failed: %v", err)
+			}
+			if reads == 0 {
+				t.Error("Reader made no reads")
+			}
+			return
+		default:
+		}
+		cp, _, _, err := client.FetchCheckpoint(ctx, f, v, origin)
+		if err != nil {
+			t.Fatalf("FetchCheckpoint: %v", err)
+		}
+		if cp.Size == 0 {
+			continue
+		}
+		sf := client.SnapshotFetcher(f, func() uint64 { return cp.Size })
+		if _, err := client.GetLeaf(ctx, sf, cp.Size); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("GetLeaf(%d) at size %d = %v, want not exist", cp.Size, cp.Size, err)
+		}
+		pb, err := client.NewProofBuilder(ctx, *cp, h.HashChildren, sf)
+		if err != nil {
+			t.Fatalf("NewProofBuilder at size %d: %v", cp.Size, err)
+		}
+		i := cp.Size - 1
+		l, err := client.GetLeaf(ctx, sf, i)
+		if err != nil {
+			t.Fatalf("GetLeaf(%d): %v", i, err)
+		}
+		p, err := pb.InclusionProof(ctx, i)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d) at size %d: %v", i, cp.Size, err)
+		}
+		if err := proof.VerifyInclusion(h, i, cp.Size, h.HashLeaf(l), p, cp.Hash); err != nil {
+			t.Fatalf("VerifyInclusion(%d) at size %d: %v", i, cp.Size, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+)
+
+// BuildInventory returns the inventory of the files of the log fetched with f
+// which are committed to by cp: its tiles, its entries or the tombstones of
+// redacted ones, and the leaf hash and identifier indices of those entries.
+// Partial tiles are only included if they're stored. The checkpoint's Origin
+// must be set.
+func BuildInventory(ctx context.Context, h merkle.LogHasher, f client.Fetcher, cp log.Checkpoint) (*api.Inventory, error) {
+	if len(cp.Origin) == 0 {
+		return nil, errors.New("checkpoint has no origin")
+	}
+	objs := make(map[string]api.InventoryObject)
+	add := func(p string, optional bool) ([]byte, error) {
+		if _, ok := objs[p]; ok {
+			return nil, nil
+		}
+		d, err := f(ctx, p)
+		if err != nil {
+			if optional && errors.Is(err, os.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to fetch %q: %w", p, err)
+		}
+		objs[p] = api.NewInventoryObject(p, d)
+		return d, nil
+	}
+
+	for l := uint64(0); cp.Size>>(8*l) > 0; l++ {
+		nodes := cp.Size >> (8 * l)
+		for i := uint64(0); i*256 < nodes; i++ {
+			// Logs which derive their partial tiles don't have them.
+			n := layout.PartialTileSize(l, i, cp.Size)
+			if _, err := add(path.Join(layout.TilePath("", l, i, n)), n > 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for seq := uint64(0); seq < cp.Size; seq++ {
+		sp := path.Join(layout.SeqPath("", seq))
+		entry, err := add(sp, true)
+		if err != nil {
+			return nil, err
+		}
+		lh := h.HashLeaf(entry)
+		if _, ok := objs[sp]; !ok {
+			// Redacted entries have a tombstone in place of their data.
+			r, raw, err := client.FetchTombstone(ctx, f, seq)
+			if err != nil {
+				return nil, err
+			}
+			p := path.Join(layout.TombstonePath("", seq))
+			objs[p] = api.NewInventoryObject(p, raw)
+			lh = r.LeafHash
+		}
+		if _, err := add(path.Join(layout.LeafPath("", lh)), false); err != nil {
+			return nil, err
+		}
+		if _, err := add(path.Join(layout.IdentifiersPath("", lh)), true); err != nil {
+			return nil, err
+		}
+		if _, err := add(path.Join(layout.ContentTypePath("", lh)), true); err != nil {
+			return nil, err
+		}
+		if _, err := add(path.Join(layout.InstanceIdentifiersPath("", seq)), true); err != nil {
+			return nil, err
+		}
+	}
+
+	inv := &api.Inventory{Origin: cp.Origin, Size: cp.Size, Hash: cp.Hash}
+	for _, o := range objs {
+		inv.Objects = append(inv.Objects, o)
+	}
+	sort.Slice(inv.Objects, func(i, j int) bool { return inv.Objects[i].Path < inv.Objects[j].Path })
+	return inv, nil
+}
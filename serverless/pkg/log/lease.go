@@ -0,0 +1,138 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+)
+
+// ErrNotLeader is returned (wrapped) by AcquireLease when another integrator
+// holds the lease. It matches ErrStorageConflict.
+var ErrNotLeader = fmt.Errorf("lease is held by another integrator: %w", ErrStorageConflict)
+
+// ErrFenced is returned (wrapped) by fenced writes when the lease has been
+// taken with a later fencing token than the writer's, so the writer is no
+// longer the leader. It matches ErrStorageConflict.
+var ErrFenced = fmt.Errorf("fencing token is stale: %w", ErrStorageConflict)
+
+// FencedStorage is an optional interface which may be implemented by
+// ConditionalStorage implementations which can check the fencing token of
+// the lease at layout.LeasePath atomically with a conditional write, so that
+// several integrators may share the log's storage, with only the holder of
+// the lease, as taken by AcquireLease, publishing checkpoints.
+//
+// The lease alone isn't enough, since its holder may be paused for longer
+// than it lasts, e.g. by garbage collection or a slow write, and carry on
+// as though it were still the leader once another integrator has taken over.
+type FencedStorage interface {
+	ConditionalStorage
+
+	// WriteIfFenced is as for WriteIfGeneration, except that it also
+	// returns an error wrapping ErrFenced, leaving the file unchanged, if
+	// the lease stored at layout.LeasePath doesn't have the given fencing
+	// token.
+	WriteIfFenced(ctx context.Context, path string, data []byte, expected Generation, token uint64) error
+}
+
+// AcquireLease takes or renews the lease on integrating the log for the
+// integrator with the given identity, as checked by api.ValidateLeaseHolder,
+// so that it expires ttl from now. The lease is taken if it's not held or has
+// expired; otherwise, if it's held by another integrator, an error wrapping
+// ErrNotLeader is returned.
+//
+// The lease's fencing token is incremented whenever it's taken, but not when
+// it's renewed by its holder, so the returned token is the one the holder
+// must pass to FencedStorage.WriteIfFenced. Since expiry is judged by each
+// integrator's own clock, ttl should be much longer than the clock skew
+// between them; fencing keeps the log safe if it isn't, but integrators may
+// then take the lease from one another needlessly.
+func AcquireLease(ctx context.Context, st ConditionalStorage, holder string, ttl time.Duration) (*api.Lease, error) {
+	if err := api.ValidateLeaseHolder(holder); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease TTL must be positive, got %v", ttl)
+	}
+	now := timeNow()
+	old, gen, err := readLease(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	l := &api.Lease{Holder: holder, Token: 1, Expires: now.Add(ttl)}
+	if old != nil {
+		switch {
+		case old.Holder == holder && now.Before(old.Expires):
+			l.Token = old.Token
+		case now.Before(old.Expires):
+			return nil, fmt.Errorf("%q holds the lease until %v: %w", old.Holder, old.Expires, ErrNotLeader)
+		default:
+			l.Token = old.Token + 1
+		}
+	}
+	if err := st.WriteIfGeneration(ctx, layout.LeasePath, l.Marshal(), gen); errors.Is(err, ErrStorageConflict) {
+		// Another integrator changed the lease first, so this one lost
+		// the race to take it.
+		return nil, fmt.Errorf("lease was taken concurrently: %v: %w", err, ErrNotLeader)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to write lease: %w", err)
+	}
+	return l, nil
+}
+
+// ReleaseLease gives up the lease if it's held by the integrator with the
+// given identity, so that another may take it without waiting for it to
+// expire, e.g. when the integrator is shut down. It's not an error if the
+// lease is held by another integrator, or not held at all.
+func ReleaseLease(ctx context.Context, st ConditionalStorage, holder string) error {
+	old, gen, err := readLease(ctx, st)
+	if err != nil || old == nil || old.Holder != holder {
+		return err
+	}
+	now := timeNow()
+	if !now.Before(old.Expires) {
+		return nil
+	}
+	// The lease is kept, expired, rather than removed, so that its next
+	// holder's token is greater.
+	l := api.Lease{Holder: old.Holder, Token: old.Token, Expires: now}
+	if err := st.WriteIfGeneration(ctx, layout.LeasePath, l.Marshal(), gen); errors.Is(err, ErrStorageConflict) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	return nil
+}
+
+// readLease returns the stored lease, if there is one, and its Generation.
+func readLease(ctx context.Context, st ConditionalStorage) (*api.Lease, Generation, error) {
+	raw, gen, err := st.ReadGeneration(ctx, layout.LeasePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, NoGeneration, nil
+	} else if err != nil {
+		return nil, NoGeneration, fmt.Errorf("failed to read lease: %w", err)
+	}
+	l, err := api.ParseLease(raw)
+	if err != nil {
+		return nil, NoGeneration, fmt.Errorf("failed to parse lease: %w", err)
+	}
+	return l, gen, nil
+}
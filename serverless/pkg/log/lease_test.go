@@ -0,0 +1,95 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+)
+
+func TestAcquireLease(t *testing.T) {
+	ctx := context.Background()
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	acquire := func(holder string, wantToken uint64) {
+		t.Helper()
+		l, err := log.AcquireLease(ctx, st, holder, time.Minute)
+		if err != nil {
+			t.Fatalf("AcquireLease(%q): %v", holder, err)
+		}
+		if l.Holder != holder || l.Token != wantToken {
+			t.Fatalf("AcquireLease(%q) = %+v, want token %d", holder, l, wantToken)
+		}
+	}
+
+	acquire("a", 1)
+	// Renewing the lease keeps its token.
+	acquire("a", 1)
+	if _, err := log.AcquireLease(ctx, st, "b", time.Minute); !errors.Is(err, log.ErrNotLeader) || !errors.Is(err, log.ErrStorageConflict) {
+		t.Fatalf("AcquireLease(b) while held by a = %v, want ErrNotLeader", err)
+	}
+
+	// Releasing the lease by anyone else is a no-op.
+	if err := log.ReleaseLease(ctx, st, "b"); err != nil {
+		t.Fatalf("ReleaseLease(b): %v", err)
+	}
+	if _, err := log.AcquireLease(ctx, st, "b", time.Minute); !errors.Is(err, log.ErrNotLeader) {
+		t.Fatalf("AcquireLease(b) after release by b = %v, want ErrNotLeader", err)
+	}
+	if err := log.ReleaseLease(ctx, st, "a"); err != nil {
+		t.Fatalf("ReleaseLease(a): %v", err)
+	}
+	acquire("b", 2)
+	if err := st.WriteIfFenced(ctx, layout.CheckpointPath, []byte("cp"), log.NoGeneration, 1); !errors.Is(err, log.ErrFenced) {
+		t.Errorf("WriteIfFenced by former leader = %v, want ErrFenced", err)
+	}
+
+	// An expired lease may be taken by anyone.
+	_, gen, err := st.ReadGeneration(ctx, layout.LeasePath)
+	if err != nil {
+		t.Fatalf("ReadGeneration: %v", err)
+	}
+	expired := api.Lease{Holder: "b", Token: 2, Expires: time.Now().Add(-time.Second)}
+	if err := st.WriteIfGeneration(ctx, layout.LeasePath, expired.Marshal(), gen); err != nil {
+		t.Fatalf("WriteIfGeneration: %v", err)
+	}
+	acquire("c", 3)
+
+	for _, test := range []struct {
+		desc   string
+		holder string
+		ttl    time.Duration
+	}{
+		{desc: "no holder", ttl: time.Minute},
+		{desc: "multi-line holder", holder: "c\nd", ttl: time.Minute},
+		{desc: "no ttl", holder: "c"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := log.AcquireLease(ctx, st, test.holder, test.ttl); err == nil || errors.Is(err, log.ErrStorageConflict) {
+				t.Errorf("AcquireLease = %v, want invalid argument error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+)
+
+// ProofStorage represents the set of functions needed to store precomputed
+// proofs.
+type ProofStorage interface {
+	// WriteInclusionProof stores the precomputed inclusion proof of the entry
+	// at the given index in the tree of the given size.
+	WriteInclusionProof(ctx context.Context, size, index uint64, raw []byte) error
+}
+
+// PrecomputeInclusionProofs builds the inclusion proof of every entry in the
+// tree committed to by cp from the tiles fetched with f, and stores them so
+// that they can be served by a static host.
+//
+// The number of proofs stored is the size of the tree, and each is stored
+// again for every new tree size, so this is only suitable for small logs.
+func PrecomputeInclusionProofs(ctx context.Context, h merkle.LogHasher, f client.Fetcher, cp log.Checkpoint, st ProofStorage) error {
+	pb, err := client.NewProofBuilder(ctx, cp, h.HashChildren, f)
+	if err != nil {
+		return fmt.Errorf("failed to create proof builder: %w", err)
+	}
+	for i := uint64(0); i < cp.Size; i++ {
+		p, err := pb.InclusionProof(ctx, i)
+		if err != nil {
+			return fmt.Errorf("failed to build inclusion proof for index %d: %w", i, err)
+		}
+		raw := api.InclusionProof{Index: i, Size: cp.Size, Hashes: p}.Marshal()
+		if err := st.WriteInclusionProof(ctx, cp.Size, i, raw); err != nil {
+			return fmt.Errorf("failed to store inclusion proof for index %d: %w", i, err)
+		}
+	}
+	return nil
+}
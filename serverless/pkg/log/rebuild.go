@@ -0,0 +1,173 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+)
+
+// rebuildBatchSize is the number of entries integrated at a time by Rebuild,
+// which bounds the number of tiles held in memory.
+const rebuildBatchSize = 1 << 16
+
+// RebuildStorage represents the set of functions needed to rebuild a log from
+// its entries.
+type RebuildStorage interface {
+	Storage
+	MapStorage
+
+	// SequenceAt stores the entry with the given leaf hash at sequence number
+	// seq. Unlike Sequence, it must not squash duplicate entries, since the
+	// order of the log being rebuilt is already fixed.
+	SequenceAt(ctx context.Context, seq uint64, leafhash []byte, leaf []byte) error
+
+	// SetIdentifiers records the application identifiers associated with the
+	// entry with the given leaf hash.
+	SetIdentifiers(ctx context.Context, leafhash []byte, ids []string) error
+
+	// SetInstanceIdentifiers records the identifiers the instance of the
+	// entry with the given leaf hash at sequence number seq was submitted
+	// with, in logs whose duplicate policy is api.DuplicatesPerNamespace.
+	SetInstanceIdentifiers(ctx context.Context, seq uint64, leafhash []byte, ids []string) error
+
+	// SetClaim records the signed claim to the identifiers associated with
+	// the entry with the given leaf hash.
+	SetClaim(ctx context.Context, leafhash []byte, claim []byte) error
+
+	// SetContentType records the content type the entry with the given leaf
+	// hash is tagged with.
+	SetContentType(ctx context.Context, leafhash []byte, t string) error
+}
+
+// Rebuild reconstructs a log in the empty storage st from nothing but its
+// entries, as read from the seq/ directory of the damaged log, or a copy of
+// it, with f. The identifiers associated with each entry are read from the
+// identifiers file alongside its leaf hash index if there is one, so that
+// the identifier index can be rebuilt too, and the claim to them is copied.
+// So are the identifiers recorded for each instance of an entry by logs whose
+// duplicate policy is api.DuplicatesPerNamespace.
+//
+// The rebuilt tree must match good, the last checkpoint known to be valid,
+// and entries beyond its size aren't copied. If goodExt, the extension lines
+// of good, commit to a snapshot of the identifier map, the map is rebuilt and
+// must match it too.
+//
+// Returns the checkpoint of the rebuilt log, which the caller should sign and
+// publish, along with the extension lines to publish with it.
+func Rebuild(ctx context.Context, h merkle.LogHasher, f client.Fetcher, st RebuildStorage, good log.Checkpoint, goodExt []byte) (*log.Checkpoint, []byte, error) {
+	cp := log.Checkpoint{Origin: good.Origin, Hash: h.EmptyRoot()}
+	for cp.Size < good.Size {
+		end := cp.Size + rebuildBatchSize
+		if end > good.Size {
+			end = good.Size
+		}
+		for seq := cp.Size; seq < end; seq++ {
+			entry, err := f(ctx, path.Join(layout.SeqPath("", seq)))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read entry %d: %w", seq, err)
+			}
+			lh := h.HashLeaf(entry)
+			claim, err := f(ctx, path.Join(layout.ClaimPath("", lh)))
+			if err == nil {
+				if err := st.SetClaim(ctx, lh, claim); err != nil {
+					return nil, nil, fmt.Errorf("failed to set claim of entry %d: %w", seq, err)
+				}
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, fmt.Errorf("failed to read claim of entry %d: %w", seq, err)
+			}
+			raw, err := f(ctx, path.Join(layout.IdentifiersPath("", lh)))
+			if err == nil {
+				ids, err := api.ParseIdentifiers(raw)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid identifiers of entry %d: %w", seq, err)
+				}
+				if err := st.SetIdentifiers(ctx, lh, ids); err != nil {
+					return nil, nil, fmt.Errorf("failed to set identifiers of entry %d: %w", seq, err)
+				}
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, fmt.Errorf("failed to read identifiers of entry %d: %w", seq, err)
+			}
+			raw, err = f(ctx, path.Join(layout.InstanceIdentifiersPath("", seq)))
+			if err == nil {
+				inst, err := api.ParseInstanceIdentifiers(raw)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid instance identifiers of entry %d: %w", seq, err)
+				}
+				if bytes.Equal(inst.LeafHash, lh) {
+					if err := st.SetInstanceIdentifiers(ctx, seq, lh, inst.Identifiers); err != nil {
+						return nil, nil, fmt.Errorf("failed to set instance identifiers of entry %d: %w", seq, err)
+					}
+				}
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, fmt.Errorf("failed to read instance identifiers of entry %d: %w", seq, err)
+			}
+			raw, err = f(ctx, path.Join(layout.ContentTypePath("", lh)))
+			if err == nil {
+				t, err := api.ParseContentType(raw)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid content type of entry %d: %w", seq, err)
+				}
+				if err := st.SetContentType(ctx, lh, t); err != nil {
+					return nil, nil, fmt.Errorf("failed to set content type of entry %d: %w", seq, err)
+				}
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, fmt.Errorf("failed to read content type of entry %d: %w", seq, err)
+			}
+			if err := st.SequenceAt(ctx, seq, lh, entry); err != nil {
+				return nil, nil, fmt.Errorf("failed to store entry %d: %w", seq, err)
+			}
+		}
+		next, err := Integrate(ctx, cp, st, h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to integrate entries [%d, %d): %w", cp.Size, end, err)
+		}
+		next.Origin = good.Origin
+		cp = *next
+		glog.Infof("Rebuilt tree of size %d", cp.Size)
+	}
+	if !bytes.Equal(cp.Hash, good.Hash) {
+		return nil, nil, fmt.Errorf("rebuilt tree has root %x, but the known good checkpoint has root %x: %w", cp.Hash, good.Hash, ErrInconsistentTree)
+	}
+
+	want, err := api.ParseMapRoot(goodExt)
+	if errors.Is(err, api.ErrNoMapRoot) {
+		return &cp, goodExt, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("invalid known good checkpoint: %w", err)
+	}
+	if want.Size > cp.Size {
+		return nil, nil, fmt.Errorf("known good checkpoint commits to an identifier map for size %d, larger than the tree", want.Size)
+	}
+	r, err := BuildMap(ctx, st, want.Size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build identifier map: %w", err)
+	}
+	if !bytes.Equal(r.Root, want.Root) {
+		return nil, nil, fmt.Errorf("rebuilt identifier map has root %x, but the known good checkpoint has root %x: %w", r.Root, want.Root, ErrInconsistentTree)
+	}
+	return &cp, goodExt, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// entryLists returns the identifier index of the log in st.
+func entryLists(t *testing.T, st log.MapStorage) map[string][]uint64 {
+	t.Helper()
+	r := make(map[string][]uint64)
+	if err := st.ScanEntryLists(context.Background(), func(l *api.EntryList) error {
+		r[l.Identifier] = l.Indices
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanEntryLists: %v", err)
+	}
+	return r
+}
+
+func TestRebuild(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+
+	// Build the original log, including a duplicate entry and some
+	// identifiers, and snapshot its identifier map.
+	srcDir := filepath.Join(t.TempDir(), "log")
+	src, err := fs.Create(srcDir)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	const size = 300
+	for i := 0; i < size; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if i == 42 {
+			l = []byte("leaf 7")
+		}
+		lh := h.HashLeaf(l)
+		if i%10 == 0 {
+			if err := src.SetIdentifiers(ctx, lh, []string{fmt.Sprintf("id-%d", i%30)}); err != nil {
+				t.Fatalf("SetIdentifiers: %v", err)
+			}
+			if err := src.SetClaim(ctx, lh, []byte(fmt.Sprintf("claim %d", i))); err != nil {
+				t.Fatalf("SetClaim: %v", err)
+			}
+		}
+		if err := src.SequenceAt(ctx, uint64(i), lh, l); err != nil {
+			t.Fatalf("SequenceAt: %v", err)
+		}
+	}
+	good, err := log.Integrate(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, src, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	good.Origin = "My Log"
+	mr, err := log.BuildMap(ctx, src, good.Size)
+	if err != nil {
+		t.Fatalf("BuildMap: %v", err)
+	}
+	goodExt := mr.Extension()
+	f := client.NewFSFetcher(os.DirFS(srcDir))
+
+	for _, test := range []struct {
+		desc              string
+		good              fmtlog.Checkpoint
+		ext               []byte
+		wantErr           bool
+		wantInconsistency bool
+	}{
+		{
+			desc: "rebuilds",
+			good: *good,
+			ext:  goodExt,
+		}, {
+			desc: "no map",
+			good: *good,
+		}, {
+			desc:              "wrong root",
+			good:              fmtlog.Checkpoint{Origin: good.Origin, Size: good.Size, Hash: h.EmptyRoot()},
+			wantErr:           true,
+			wantInconsistency: true,
+		}, {
+			desc:              "wrong map root",
+			good:              *good,
+			ext:               api.MapRoot{Size: good.Size, Root: h.EmptyRoot()}.Extension(),
+			wantErr:           true,
+			wantInconsistency: true,
+		}, {
+			desc:    "missing entries",
+			good:    fmtlog.Checkpoint{Origin: good.Origin, Size: good.Size + 1, Hash: good.Hash},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "rebuilt")
+			st, err := fs.Create(dir)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			cp, ext, err := log.Rebuild(ctx, h, f, st, test.good, test.ext)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Rebuild: %v, want error %t", err, test.wantErr)
+			}
+			if got := errors.Is(err, log.ErrInconsistentTree); got != test.wantInconsistency {
+				t.Errorf("errors.Is(%v, ErrInconsistentTree) = %t, want %t", err, got, test.wantInconsistency)
+			}
+			if err != nil {
+				return
+			}
+			if cp.Size != good.Size || !bytes.Equal(cp.Hash, good.Hash) || cp.Origin != good.Origin {
+				t.Errorf("Rebuild returned checkpoint %+v, want %+v", cp, good)
+			}
+			if !bytes.Equal(ext, test.ext) {
+				t.Errorf("Rebuild returned extension %q, want %q", ext, test.ext)
+			}
+
+			// The tiles, leaf hash indices and identifier index must match
+			// those of the original log.
+			rf := client.NewFSFetcher(os.DirFS(dir))
+			inv, err := log.BuildInventory(ctx, h, f, *good)
+			if err != nil {
+				t.Fatalf("BuildInventory: %v", err)
+			}
+			r, err := client.VerifyInventory(ctx, rf, inv)
+			if err != nil {
+				t.Fatalf("VerifyInventory: %v", err)
+			}
+			if !r.OK() {
+				t.Errorf("Rebuilt log differs from the original: %+v", r)
+			}
+			if diff := cmp.Diff(entryLists(t, src), entryLists(t, st)); diff != "" {
+				t.Errorf("Rebuilt identifier index has diff (-want +got):\n%s", diff)
+			}
+			// The duplicate entry must map to its first instance.
+			if idx, err := client.LookupIndex(ctx, rf, h.HashLeaf([]byte("leaf 7"))); err != nil || idx != 7 {
+				t.Errorf("LookupIndex of duplicate = %d, %v, want 7", idx, err)
+			}
+			if _, err := rf(ctx, path.Join(layout.SeqPath("", 42))); err != nil {
+				t.Errorf("Duplicate entry wasn't rebuilt: %v", err)
+			}
+			if c, err := rf(ctx, path.Join(layout.ClaimPath("", h.HashLeaf([]byte("leaf 10"))))); err != nil || string(c) != "claim 10" {
+				t.Errorf("Claim wasn't copied: %q, %v", c, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/compact"
+)
+
+// recovery reads the tiles of the tree committed to by a checkpoint from
+// storage, undoing any partial work left by an earlier integration which was
+// interrupted after storing some of its tiles, but before its checkpoint was
+// written.
+//
+// Such an integration may have extended the checkpoint's partial tiles, or
+// replaced them with links to full tiles, and stored tiles which are beyond
+// the checkpoint altogether. Those tiles are trimmed back to, or ignored in
+// favour of, the checkpoint's tree, so that integration recomputes their new
+// nodes from the sequenced entries rather than trusting them, and stores
+// tiles of the right size even if it integrates fewer entries than the
+// interrupted run.
+type recovery struct {
+	st   Storage
+	size uint64
+	// extended counts the tiles found to have been extended beyond the
+	// checkpoint.
+	extended int
+}
+
+// getTile returns the tile at the given level and index as of the tree of the
+// recovery's size, or an error wrapping os.ErrNotExist if the tree has no
+// such tile.
+func (r *recovery) getTile(ctx context.Context, level, index uint64) (*api.Tile, error) {
+	sizeAtLevel := r.size >> (level * 8)
+	if index*api.TileWidth >= sizeAtLevel {
+		return nil, os.ErrNotExist
+	}
+	t, err := r.st.GetTile(ctx, level, index, r.size)
+	if err != nil {
+		return nil, err
+	}
+	n := uint(api.TileWidth)
+	if index == sizeAtLevel/api.TileWidth {
+		n = uint(sizeAtLevel % api.TileWidth)
+	}
+	if t.NumLeaves > n {
+		r.extended++
+		t = t.Trim(n)
+	}
+	return t, nil
+}
+
+// recoverTree is the first phase of integration. It loads the compact range
+// covering the tree committed to by checkpoint from the tiles in st, made with
+// rf, and
+// checks that it has the checkpoint's root hash, returning an error wrapping
+// ErrInconsistentTree if not. Any partial work left by an interrupted
+// integration is detected and logged, and the returned recovery is then used
+// to read tiles for the rest of the integration.
+//
+// If st is a CompactRangeStorage holding the compact range of the
+// checkpoint's tree, that's used instead of reading the tiles.
+func recoverTree(ctx context.Context, checkpoint log.Checkpoint, st Storage, rf *compact.RangeFactory) (*compact.Range, *recovery, error) {
+	rec := &recovery{st: st, size: checkpoint.Size}
+	if r := storedRange(ctx, checkpoint, st, rf); r != nil {
+		glog.Infof("Resumed from stored compact range of tree size %d", checkpoint.Size)
+		return r, rec, nil
+	}
+	hashes, err := client.FetchRangeNodes(ctx, checkpoint.Size, func(ctx context.Context, l, i uint64) (*api.Tile, error) {
+		return rec.getTile(ctx, l, i)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch compact range nodes: %w", err)
+	}
+
+	baseRange, err := rf.NewRange(0, checkpoint.Size, hashes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create range covering existing log: %w", err)
+	}
+
+	// Initialise a compact range representation, and verify the stored state.
+	r, err := baseRange.GetRootHash(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid log state, unable to recalculate root: %w", err)
+	}
+	if checkpoint.Size > 0 && !bytes.Equal(r, checkpoint.Hash) {
+		return nil, nil, fmt.Errorf("stored tiles have root %x, but the checkpoint has root %x: %w", r, checkpoint.Hash, ErrInconsistentTree)
+	}
+	if rec.extended > 0 {
+		glog.Warningf("Found %d tiles extended beyond tree size %d by an interrupted integration, recomputing them", rec.extended, checkpoint.Size)
+	}
+
+	glog.Infof("Loaded state with roothash %x", r)
+	return baseRange, rec, nil
+}
+
+// storedRange returns the compact range stored by st, if it's a
+// CompactRangeStorage, made with rf, or nil if there's none usable for the
+// tree committed to by checkpoint. A range for a different tree, e.g. one
+// integrated by a run which failed before its checkpoint was published, or one
+// which doesn't have the checkpoint's root hash, is ignored.
+func storedRange(ctx context.Context, checkpoint log.Checkpoint, st Storage, rf *compact.RangeFactory) *compact.Range {
+	crs, ok := st.(CompactRangeStorage)
+	if !ok {
+		return nil
+	}
+	cr, err := crs.ReadCompactRange(ctx)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			glog.Warningf("Failed to read stored compact range, reading tiles instead: %v", err)
+		}
+		return nil
+	}
+	if cr.Size != checkpoint.Size {
+		glog.V(1).Infof("Stored compact range is for tree size %d, not %d", cr.Size, checkpoint.Size)
+		return nil
+	}
+	r, err := rf.NewRange(0, cr.Size, cr.Hashes)
+	if err != nil {
+		glog.Warningf("Invalid stored compact range, reading tiles instead: %v", err)
+		return nil
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil || (cr.Size > 0 && !bytes.Equal(root, checkpoint.Hash)) {
+		glog.Warningf("Stored compact range doesn't have the checkpoint's root hash, reading tiles instead")
+		return nil
+	}
+	return r
+}
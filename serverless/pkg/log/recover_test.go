@@ -0,0 +1,229 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// errCrash simulates the integrator crashing.
+var errCrash = errors.New("crash")
+
+// crashingStorage is a log storage which crashes after storing a given number
+// of tiles.
+type crashingStorage struct {
+	*fs.Storage
+	tiles int
+}
+
+func (s *crashingStorage) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	if s.tiles == 0 {
+		return errCrash
+	}
+	s.tiles--
+	return s.Storage.StoreTile(ctx, level, index, tile)
+}
+
+func TestIntegrateRecoversFromCrash(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	leaf := func(i uint64) []byte { return []byte(fmt.Sprintf("leaf %d", i)) }
+	// root returns the root hash of the tree of the first n leaves.
+	root := func(n uint64) []byte {
+		t.Helper()
+		r := (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0)
+		for i := uint64(0); i < n; i++ {
+			if err := r.Append(h.HashLeaf(leaf(i)), nil); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+		}
+		rh, err := r.GetRootHash(nil)
+		if err != nil {
+			t.Fatalf("GetRootHash: %v", err)
+		}
+		return rh
+	}
+	const start, crashSize = 100, 300
+
+	// Integration doesn't change the sequenced entries, so they're shared by
+	// every case, which starts again from a tree with only the tiles of the
+	// checkpoint before the crash.
+	dir := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(dir)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := uint64(0); i < crashSize; i++ {
+		if _, err := st.Sequence(ctx, h.HashLeaf(leaf(i)), leaf(i)); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+
+	for _, immutable := range []bool{false, true} {
+		// An integration of 100 to 300 entries stores 3 tiles, so crash
+		// before, between and after each of them. The last case is a
+		// crash after the tiles are stored, but before the checkpoint.
+		for crashAfter := 0; crashAfter <= 3; crashAfter++ {
+			// Resuming with a smaller batch than the interrupted run must
+			// also leave the tiles of the smaller tree.
+			for _, resume := range []uint64{crashSize, 120} {
+				t.Run(fmt.Sprintf("immutable=%t/crash after %d tiles/resume to %d", immutable, crashAfter, resume), func(t *testing.T) {
+					if err := os.RemoveAll(filepath.Join(dir, "tile")); err != nil {
+						t.Fatalf("RemoveAll: %v", err)
+					}
+					st.SetImmutable(immutable)
+					cp, err := log.IntegrateUpTo(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, st, h, start)
+					if err != nil {
+						t.Fatalf("IntegrateUpTo(%d): %v", start, err)
+					}
+
+					_, err = log.Integrate(ctx, *cp, &crashingStorage{Storage: st, tiles: crashAfter}, h)
+					if crashAfter < 3 && !errors.Is(err, errCrash) {
+						t.Fatalf("Integrate = %v, want crash", err)
+					} else if crashAfter == 3 && err != nil {
+						t.Fatalf("Integrate: %v", err)
+					}
+
+					// The checkpoint was never written, so integration
+					// resumes from the one before the crash.
+					for _, size := range []uint64{resume, crashSize} {
+						next, err := log.IntegrateUpTo(ctx, *cp, st, h, size)
+						if err != nil {
+							t.Fatalf("IntegrateUpTo(%d) after crash: %v", size, err)
+						}
+						if next == nil {
+							continue
+						}
+						if next.Size != size || !bytes.Equal(next.Hash, root(size)) {
+							t.Fatalf("IntegrateUpTo(%d) after crash = size %d root %x, want root %x", size, next.Size, next.Hash, root(size))
+						}
+						cp = next
+						r, err := client.VerifyLayout(ctx, client.NewFSFetcher(os.DirFS(dir)), h, *cp)
+						if err != nil {
+							t.Fatalf("VerifyLayout(%d): %v", size, err)
+						}
+						if len(r.Missing) > 0 || len(r.Mismatched) > 0 {
+							t.Errorf("VerifyLayout(%d) = %+v, want no missing or mismatched tiles", size, r)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestIntegrateRejectsTilesNotMatchingCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	cp, err := log.IntegrateUpTo(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, st, h, 5)
+	if err != nil {
+		t.Fatalf("IntegrateUpTo: %v", err)
+	}
+	bad := fmtlog.Checkpoint{Size: cp.Size, Hash: h.EmptyRoot()}
+	if _, err := log.Integrate(ctx, bad, st, h); !errors.Is(err, log.ErrInconsistentTree) {
+		t.Errorf("Integrate from checkpoint not matching tiles = %v, want ErrInconsistentTree", err)
+	}
+}
+
+// tileCountingStorage counts the tiles read from it.
+type tileCountingStorage struct {
+	*fs.Storage
+	reads int
+}
+
+func (s *tileCountingStorage) GetTile(ctx context.Context, level, index, logSize uint64) (*api.Tile, error) {
+	s.reads++
+	return s.Storage.GetTile(ctx, level, index, logSize)
+}
+
+func TestIntegrateResumesFromCompactRange(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	fst, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	want := (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0)
+	cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	// integrate adds n leaves and integrates them, returning the number of
+	// tiles read.
+	integrate := func(n int) int {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			l := []byte(fmt.Sprintf("leaf %d", want.End()))
+			if _, err := fst.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+				t.Fatalf("Sequence: %v", err)
+			}
+			if err := want.Append(h.HashLeaf(l), nil); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+		}
+		st := &tileCountingStorage{Storage: fst}
+		newCP, err := log.Integrate(ctx, cp, st, h)
+		if err != nil {
+			t.Fatalf("Integrate: %v", err)
+		}
+		if wantRoot, _ := want.GetRootHash(nil); !bytes.Equal(newCP.Hash, wantRoot) {
+			t.Fatalf("Integrate gave root %x, want %x", newCP.Hash, wantRoot)
+		}
+		cp = *newCP
+		return st.reads
+	}
+
+	integrate(600)
+	r, err := fst.ReadCompactRange(ctx)
+	if err != nil {
+		t.Fatalf("ReadCompactRange: %v", err)
+	}
+	if r.Size != cp.Size || len(r.Hashes) != len(want.Hashes()) {
+		t.Fatalf("Stored compact range has size %d and %d hashes, want %d and %d", r.Size, len(r.Hashes), cp.Size, len(want.Hashes()))
+	}
+	withRange := integrate(10)
+
+	// A stored range which doesn't match the checkpoint is ignored, and the
+	// range is read from the tiles instead.
+	bad := &api.CompactRange{Size: cp.Size, Hashes: append([][]byte{make([]byte, api.HashSize)}, want.Hashes()[1:]...)}
+	if err := fst.WriteCompactRange(ctx, bad); err != nil {
+		t.Fatalf("WriteCompactRange: %v", err)
+	}
+	withoutRange := integrate(10)
+	if withRange >= withoutRange {
+		t.Errorf("Integration read %d tiles with a stored compact range, and %d without, want fewer with", withRange, withoutRange)
+	}
+}
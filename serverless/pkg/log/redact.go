@@ -0,0 +1,131 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// RedactionStorage represents the set of functions needed to withhold the
+// data of a log's entries.
+type RedactionStorage interface {
+	// Redact withholds the data of the integrated entry at sequence number
+	// seq, storing tombstone in its place. Redacting an entry again with the
+	// same tombstone succeeds, but an entry's tombstone can't be changed, so
+	// a different one is rejected with an error wrapping os.ErrExist.
+	Redact(ctx context.Context, seq uint64, tombstone []byte) error
+}
+
+// Redact withholds the data of the entry at index idx of the log with the
+// given origin in st, which is read with f, for the given reason. The entry's
+// leaf hash stays in the tree, so proofs still verify, but its data is
+// replaced by a tombstone: its api.Redaction, signed with s.
+//
+// The tombstone is first added to the log's redaction log in rst, whose new
+// checkpoint is signed with s, so that no entry is withheld without a public
+// record. The log's checkpoint and that of the redaction log, if it has one
+// yet, must be signed by v. Only entries committed to by the log's checkpoint
+// can be redacted.
+func Redact(ctx context.Context, h merkle.LogHasher, st RedactionStorage, rst Storage, f client.Fetcher, s note.Signer, v note.Verifier, origin string, idx uint64, reason string) (*api.Redaction, error) {
+	if err := api.ValidateRedactionReason(reason); err != nil {
+		return nil, err
+	}
+	cp, _, _, err := client.FetchCheckpoint(ctx, f, v, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if idx >= cp.Size {
+		return nil, fmt.Errorf("entry %d isn't in the log of size %d: %w", idx, cp.Size, client.ErrNotIntegrated)
+	}
+	if prev, _, err := client.FetchTombstone(ctx, f, idx); err == nil {
+		// Only an interrupted redaction may be retried.
+		if prev.Reason != reason {
+			return nil, fmt.Errorf("entry %d has already been redacted for %q: %w", idx, prev.Reason, os.ErrExist)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	rs := []*api.Redaction{{Origin: origin, Index: idx, Reason: reason}}
+	if err := redact(ctx, h, st, rst, f, s, v, *cp, rs); err != nil {
+		return nil, err
+	}
+	return rs[0], nil
+}
+
+// redact withholds the data of the entries of the log with checkpoint cp
+// described by rs, which must be in increasing order of index, as for Redact.
+// The leaf hashes of rs are filled in, and all of their tombstones are added to
+// the redaction log at once.
+func redact(ctx context.Context, h merkle.LogHasher, st RedactionStorage, rst Storage, f client.Fetcher, s note.Signer, v note.Verifier, cp log.Checkpoint, rs []*api.Redaction) error {
+	first, last := rs[0].Index, rs[len(rs)-1].Index
+	lhs, err := client.FetchLeafHashes(ctx, f, first, last-first+1, cp.Size)
+	if err != nil {
+		return fmt.Errorf("failed to read leaf hashes of entries [%d, %d]: %w", first, last, err)
+	}
+	tombstones := make([][]byte, len(rs))
+	for i, r := range rs {
+		r.LeafHash = lhs[r.Index-first]
+		if tombstones[i], err = note.Sign(&note.Note{Text: string(r.Marshal())}, s); err != nil {
+			return fmt.Errorf("failed to sign redaction: %w", err)
+		}
+	}
+
+	rOrigin := api.RedactionsOrigin(cp.Origin)
+	rcp, _, _, err := client.FetchCheckpoint(ctx, client.ShardFetcher(f, layout.RedactionsDir), v, rOrigin)
+	if errors.Is(err, os.ErrNotExist) {
+		// This is the log's first redaction.
+		rcp = &log.Checkpoint{Origin: rOrigin, Hash: h.EmptyRoot()}
+	} else if err != nil {
+		return fmt.Errorf("failed to read redaction log checkpoint: %w", err)
+	}
+	// A retried redaction normally has the same tombstone, since Ed25519
+	// signatures are deterministic, so it's only listed once.
+	for _, t := range tombstones {
+		if _, err := rst.Sequence(ctx, h.HashLeaf(t), t); err != nil && !errors.Is(err, ErrDupeLeaf) {
+			return fmt.Errorf("failed to add redaction to redaction log: %w", err)
+		}
+	}
+	newRcp, err := Integrate(ctx, *rcp, rst, h)
+	if err != nil {
+		return fmt.Errorf("failed to integrate redaction log: %w", err)
+	}
+	if newRcp != nil {
+		newRcp.Origin = rOrigin
+		raw, err := note.Sign(&note.Note{Text: string(newRcp.Marshal())}, s)
+		if err != nil {
+			return fmt.Errorf("failed to sign redaction log checkpoint: %w", err)
+		}
+		if err := rst.WriteCheckpoint(ctx, raw); err != nil {
+			return fmt.Errorf("failed to write redaction log checkpoint: %w", err)
+		}
+	}
+
+	for i, r := range rs {
+		if err := st.Redact(ctx, r.Index, tombstones[i]); err != nil {
+			return fmt.Errorf("failed to redact entry %d: %w", r.Index, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestRedact(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	const size = 5
+	for i := 0; i < size; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	cp, err := log.Integrate(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	cp.Origin = "My Log"
+	cpRaw, err := note.Sign(&note.Note{Text: string(cp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := st.WriteCheckpoint(ctx, cpRaw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+	rst, err := fs.Create(filepath.Join(root, layout.RedactionsDir))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+
+	for _, idx := range []uint64{1, 3} {
+		if _, err := log.Redact(ctx, h, st, rst, f, s, v, "My Log", idx, fmt.Sprintf("takedown %d", idx)); err != nil {
+			t.Fatalf("Redact(%d): %v", idx, err)
+		}
+	}
+	// An interrupted redaction can be retried, but a redaction can't be
+	// changed.
+	if _, err := log.Redact(ctx, h, st, rst, f, s, v, "My Log", 1, "takedown 1"); err != nil {
+		t.Errorf("Redact again: %v", err)
+	}
+	if _, err := log.Redact(ctx, h, st, rst, f, s, v, "My Log", 1, "another reason"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Redact with another reason = %v, want ErrExist", err)
+	}
+	if _, err := log.Redact(ctx, h, st, rst, f, s, v, "My Log", size, "not yet"); !errors.Is(err, client.ErrNotIntegrated) {
+		t.Errorf("Redact of unintegrated entry = %v, want ErrNotIntegrated", err)
+	}
+
+	if _, err := client.GetLeaf(ctx, f, 1); !errors.Is(err, client.ErrRedacted) {
+		t.Errorf("GetLeaf of redacted entry = %v, want ErrRedacted", err)
+	}
+	r, err := client.FetchRedaction(ctx, f, h, v, "My Log", 1)
+	if err != nil {
+		t.Fatalf("FetchRedaction: %v", err)
+	}
+	if got, want := r.Reason, "takedown 1"; got != want {
+		t.Errorf("FetchRedaction reason = %q, want %q", got, want)
+	}
+	if _, err := client.VerifyInclusion(ctx, f, h, *cp, 1, r.LeafHash); err != nil {
+		t.Errorf("VerifyInclusion of redacted entry: %v", err)
+	}
+	if _, err := client.FetchRedaction(ctx, f, h, v, "My Log", 2); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("FetchRedaction of unredacted entry = %v, want ErrNotExist", err)
+	}
+	// Both redactions are listed once in the redaction log.
+	rcp, _, _, err := client.FetchCheckpoint(ctx, client.ShardFetcher(f, layout.RedactionsDir), v, api.RedactionsOrigin("My Log"))
+	if err != nil {
+		t.Fatalf("FetchCheckpoint of redaction log: %v", err)
+	}
+	if rcp.Size != 2 {
+		t.Errorf("Redaction log has size %d, want 2", rcp.Size)
+	}
+
+	// The rest of the log still verifies.
+	leaves, err := client.FetchVerifiedLeaves(ctx, f, h, *cp, 0, size)
+	if err != nil {
+		t.Fatalf("FetchVerifiedLeaves: %v", err)
+	}
+	for i, l := range leaves {
+		if redacted := i == 1 || i == 3; redacted != (l == nil) {
+			t.Errorf("FetchVerifiedLeaves returned %q for entry %d, want redacted %t", l, i, redacted)
+		}
+	}
+	lr, err := client.VerifyLayout(ctx, f, h, *cp)
+	if err != nil {
+		t.Fatalf("VerifyLayout: %v", err)
+	}
+	if !lr.OK() || len(lr.Redacted) != 2 {
+		t.Errorf("VerifyLayout = %+v, want OK with 2 redacted entries", lr)
+	}
+	inv, err := log.BuildInventory(ctx, h, f, *cp)
+	if err != nil {
+		t.Fatalf("BuildInventory: %v", err)
+	}
+	if ir, err := client.VerifyInventory(ctx, f, inv); err != nil || !ir.OK() {
+		t.Errorf("VerifyInventory = %+v, %v, want OK", ir, err)
+	}
+}
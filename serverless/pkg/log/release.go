@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+)
+
+// ReleasePolicy controls how many of the sequenced entries are integrated at
+// a time. Holding entries back and releasing them in batches of a fixed size,
+// optionally at fixed intervals, means that observers of the log can't
+// correlate the times at which its tree grows with individual submissions.
+//
+// The zero value releases every sequenced entry immediately.
+type ReleasePolicy struct {
+	// BatchSize, if non-zero, is the number of entries in a batch. Entries
+	// are only released in whole batches, and the rest are held back until
+	// there are enough of them, unless Pad is set.
+	BatchSize uint64
+	// Pad, if set, releases entries which don't fill a batch by padding it
+	// out with entries created by api.NewPaddingEntry.
+	Pad bool
+	// MemoryBudget, if non-zero, is roughly the number of bytes of new tiles
+	// which integrating a batch may hold in memory. Tiles are normally all
+	// stored together once the batch is integrated, so the memory needed
+	// grows with the size of the batch. With a budget, tiles which the rest
+	// of the batch can't change are stored as soon as it's exceeded, so that
+	// batches of any size can be integrated in a fixed amount of memory.
+	// A few tiles on the edges of the tree are always held, so very small
+	// budgets may be exceeded.
+	MemoryBudget uint64
+}
+
+// Release returns the number of the given number of pending entries to
+// release, and the number of padding entries to add to them.
+func (p ReleasePolicy) Release(pending uint64) (release, padding uint64) {
+	if p.BatchSize == 0 {
+		return pending, 0
+	}
+	rem := pending % p.BatchSize
+	if rem == 0 {
+		return pending, 0
+	}
+	if p.Pad {
+		return pending, p.BatchSize - rem
+	}
+	return pending - rem, 0
+}
+
+// IntegrateBatch integrates the sequenced entries which are due to be
+// released by p into the tree, padding them out first if necessary. Like
+// Integrate, it returns the updated checkpoint, or nil if there was nothing to
+// release.
+func IntegrateBatch(ctx context.Context, checkpoint log.Checkpoint, st Storage, h merkle.LogHasher, p ReleasePolicy) (*log.Checkpoint, error) {
+	pending, err := st.ScanSequenced(ctx, checkpoint.Size, func(uint64, []byte) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending entries: %w", err)
+	}
+	release, padding := p.Release(pending)
+	glog.V(1).Infof("%d entries pending, releasing %d with %d padding entries", pending, release, padding)
+	ps, ok := st.(PaddingSequencer)
+	if padding > 0 && !ok {
+		return nil, errors.New("storage doesn't support padding entries")
+	}
+	// Entries sequenced concurrently may be interleaved with the padding,
+	// but the batch is released in full regardless.
+	for i := uint64(0); i < padding; i++ {
+		e, err := api.NewPaddingEntry()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ps.SequencePadding(ctx, h.HashLeaf(e), e); err != nil {
+			return nil, fmt.Errorf("failed to sequence padding entry: %w", err)
+		}
+	}
+	return integrateUpTo(ctx, checkpoint, st, h, checkpoint.Size+release+padding, p.MemoryBudget)
+}
+
+// IntegrationPolicy controls when a long running integrator publishes a new
+// checkpoint, so that the log's checkpoint cadence is predictable rather than
+// depending on how often an external scheduler happens to run integration.
+//
+// The zero value integrates whenever there are entries to release.
+type IntegrationPolicy struct {
+	// MinInterval, if non-zero, is the minimum time between checkpoints.
+	MinInterval time.Duration
+	// MinBatchSize, if non-zero, is the number of entries which must be
+	// waiting to be released before they're integrated, unless MaxLatency
+	// has passed.
+	MinBatchSize uint64
+	// MaxLatency, if non-zero, is the longest an entry may wait to be
+	// integrated once MinInterval has passed, regardless of MinBatchSize.
+	// If it's zero, entries wait until there are MinBatchSize of them.
+	MaxLatency time.Duration
+}
+
+// Due returns true if a new checkpoint should be published at now, given that
+// the last was published at last, and there are pending entries waiting to be
+// released, the oldest of which was sequenced at oldest.
+func (p IntegrationPolicy) Due(now, last time.Time, pending uint64, oldest time.Time) bool {
+	if pending == 0 || now.Sub(last) < p.MinInterval {
+		return false
+	}
+	if pending >= p.MinBatchSize {
+		return true
+	}
+	return p.MaxLatency > 0 && now.Sub(oldest) >= p.MaxLatency
+}
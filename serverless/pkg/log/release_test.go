@@ -0,0 +1,216 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestReleasePolicy(t *testing.T) {
+	for _, test := range []struct {
+		desc        string
+		p           log.ReleasePolicy
+		pending     uint64
+		wantRelease uint64
+		wantPadding uint64
+	}{
+		{desc: "immediate", pending: 5, wantRelease: 5},
+		{desc: "held", p: log.ReleasePolicy{BatchSize: 4}, pending: 3},
+		{desc: "whole batches", p: log.ReleasePolicy{BatchSize: 4}, pending: 9, wantRelease: 8},
+		{desc: "exact", p: log.ReleasePolicy{BatchSize: 4, Pad: true}, pending: 8, wantRelease: 8},
+		{desc: "padded", p: log.ReleasePolicy{BatchSize: 4, Pad: true}, pending: 9, wantRelease: 9, wantPadding: 3},
+		{desc: "nothing pending", p: log.ReleasePolicy{BatchSize: 4, Pad: true}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			r, p := test.p.Release(test.pending)
+			if r != test.wantRelease || p != test.wantPadding {
+				t.Errorf("Release(%d) = %d, %d, want %d, %d", test.pending, r, p, test.wantRelease, test.wantPadding)
+			}
+		})
+	}
+}
+
+func TestIntegrationPolicy(t *testing.T) {
+	now := time.Unix(1680000000, 0)
+	for _, test := range []struct {
+		desc    string
+		p       log.IntegrationPolicy
+		last    time.Duration
+		pending uint64
+		oldest  time.Duration
+		want    bool
+	}{
+		{desc: "immediate", pending: 1, want: true},
+		{desc: "nothing pending", p: log.IntegrationPolicy{MaxLatency: time.Minute}, last: time.Hour},
+		{desc: "too soon", p: log.IntegrationPolicy{MinInterval: time.Minute}, last: 30 * time.Second, pending: 100, oldest: time.Hour},
+		{desc: "interval passed", p: log.IntegrationPolicy{MinInterval: time.Minute}, last: time.Minute, pending: 1, want: true},
+		{desc: "batch too small", p: log.IntegrationPolicy{MinBatchSize: 10}, last: time.Hour, pending: 9, oldest: time.Hour},
+		{desc: "batch big enough", p: log.IntegrationPolicy{MinBatchSize: 10}, pending: 10, want: true},
+		{desc: "latency not reached", p: log.IntegrationPolicy{MinBatchSize: 10, MaxLatency: time.Minute}, last: time.Hour, pending: 1, oldest: 30 * time.Second},
+		{desc: "latency reached", p: log.IntegrationPolicy{MinBatchSize: 10, MaxLatency: time.Minute}, last: time.Hour, pending: 1, oldest: time.Minute, want: true},
+		{desc: "latency reached too soon", p: log.IntegrationPolicy{MinInterval: time.Hour, MinBatchSize: 10, MaxLatency: time.Minute}, last: time.Minute, pending: 1, oldest: time.Minute},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := test.p.Due(now, now.Add(-test.last), test.pending, now.Add(-test.oldest)); got != test.want {
+				t.Errorf("Due = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIntegrateBatch(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	n := 0
+	sequence := func(count int) {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			l := []byte(fmt.Sprintf("leaf %d", n))
+			n++
+			if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+				t.Fatalf("Sequence: %v", err)
+			}
+		}
+	}
+
+	cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	for _, step := range []struct {
+		add      int
+		p        log.ReleasePolicy
+		wantSize uint64
+	}{
+		// The fifth entry is held back.
+		{add: 5, p: log.ReleasePolicy{BatchSize: 4}, wantSize: 4},
+		{add: 2, p: log.ReleasePolicy{BatchSize: 4}, wantSize: 4},
+		// The three held entries are released with one padding entry.
+		{add: 0, p: log.ReleasePolicy{BatchSize: 4, Pad: true}, wantSize: 8},
+		{add: 0, p: log.ReleasePolicy{BatchSize: 4, Pad: true}, wantSize: 8},
+	} {
+		sequence(step.add)
+		newCP, err := log.IntegrateBatch(ctx, cp, st, h, step.p)
+		if err != nil {
+			t.Fatalf("IntegrateBatch: %v", err)
+		}
+		if newCP != nil {
+			cp = *newCP
+		}
+		if cp.Size != step.wantSize {
+			t.Fatalf("IntegrateBatch after adding %d entries gave size %d, want %d", step.add, cp.Size, step.wantSize)
+		}
+	}
+
+	f := client.NewFSFetcher(os.DirFS(root))
+	leaves, err := client.FetchVerifiedLeaves(ctx, f, h, cp, 0, cp.Size)
+	if err != nil {
+		t.Fatalf("FetchVerifiedLeaves: %v", err)
+	}
+	for i, l := range leaves {
+		if got, want := api.IsPaddingEntry(l), i == 7; got != want {
+			t.Errorf("Entry %d is padding: %t, want %t", i, got, want)
+		}
+		// Padding entries are left out of the leaf hash index.
+		idx, err := st.LookupIndex(ctx, h.HashLeaf(l))
+		if api.IsPaddingEntry(l) {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("LookupIndex of padding entry %d = %d, %v, want ErrNotExist", i, idx, err)
+			}
+		} else if err != nil || idx != uint64(i) {
+			t.Errorf("LookupIndex of entry %d = %d, %v", i, idx, err)
+		}
+	}
+}
+
+// scanTrackingStorage counts the tiles stored while sequenced entries are
+// being scanned.
+type scanTrackingStorage struct {
+	*fs.Storage
+	scanning         bool
+	storedDuringScan int
+}
+
+func (s *scanTrackingStorage) ScanSequenced(ctx context.Context, begin uint64, f func(seq uint64, entry []byte) error) (uint64, error) {
+	s.scanning = true
+	defer func() { s.scanning = false }()
+	return s.Storage.ScanSequenced(ctx, begin, f)
+}
+
+func (s *scanTrackingStorage) StoreTile(ctx context.Context, level, index uint64, tile *api.Tile) error {
+	if s.scanning {
+		s.storedDuringScan++
+	}
+	return s.Storage.StoreTile(ctx, level, index, tile)
+}
+
+func TestIntegrateBatchMemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	var roots [][]byte
+	for _, budget := range []uint64{0, 1} {
+		fst, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		st := &scanTrackingStorage{Storage: fst}
+		cp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+		// The second batch starts part way through a tile, and fills several
+		// more.
+		for _, n := range []int{100, 2000} {
+			for i := 0; i < n; i++ {
+				l := []byte(fmt.Sprintf("leaf %d %d", cp.Size, i))
+				if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+					t.Fatalf("Sequence: %v", err)
+				}
+			}
+			newCP, err := log.IntegrateBatch(ctx, cp, st, h, log.ReleasePolicy{MemoryBudget: budget})
+			if err != nil {
+				t.Fatalf("IntegrateBatch with budget %d: %v", budget, err)
+			}
+			cp = *newCP
+		}
+		// Every full tile after the first, which the first batch is part
+		// of, is stored early.
+		if want := 0; budget > 0 {
+			want = 2100/256 - 1
+			if st.storedDuringScan < want {
+				t.Errorf("Budget %d: %d tiles stored during integration, want at least %d", budget, st.storedDuringScan, want)
+			}
+		} else if st.storedDuringScan != want {
+			t.Errorf("Budget %d: %d tiles stored during integration, want %d", budget, st.storedDuringScan, want)
+		}
+		roots = append(roots, cp.Hash)
+	}
+	if !bytes.Equal(roots[0], roots[1]) {
+		t.Errorf("Integration with a memory budget gave root %x, want %x", roots[1], roots[0])
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"github.com/transparency-dev/merkle/compact"
+)
+
+// Reproducer independently recomputes the tree a log builds when the given
+// entries are sequenced into it in order, without storing anything, so that
+// the log's published root can be checked against a known set of inputs.
+//
+// Logs which pad their batches can't be reproduced, since the padding
+// entries aren't among the inputs, and nor can logs whose duplicate policy is
+// api.DuplicatesPerNamespace, since which entries are duplicates depends on
+// the identifiers they were submitted with.
+type Reproducer struct {
+	h     merkle.LogHasher
+	dupes api.DuplicatePolicy
+	r     *compact.Range
+	seen  map[string]uint64
+}
+
+// NewReproducer returns a Reproducer of an empty log with the given duplicate
+// policy, or the default policy if it's empty.
+func NewReproducer(h merkle.LogHasher, dupes api.DuplicatePolicy) (*Reproducer, error) {
+	if len(dupes) == 0 {
+		dupes = api.DuplicatesReject
+	}
+	if !dupes.Valid() {
+		return nil, fmt.Errorf("invalid duplicate policy %q", dupes)
+	}
+	if dupes == api.DuplicatesPerNamespace {
+		return nil, fmt.Errorf("logs with duplicate policy %q can't be reproduced from their entries alone", dupes)
+	}
+	return &Reproducer{
+		h:     h,
+		dupes: dupes,
+		r:     (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0),
+		seen:  make(map[string]uint64),
+	}, nil
+}
+
+// Add sequences entry, returning its sequence number. As with storage, a
+// duplicate entry isn't added again unless the duplicate policy allows it,
+// and the sequence number of the original is returned with ErrDupeLeaf.
+func (p *Reproducer) Add(entry []byte) (uint64, error) {
+	if api.IsPaddingEntry(entry) {
+		return 0, ErrPaddingEntry
+	}
+	lh := p.h.HashLeaf(entry)
+	if seq, ok := p.seen[string(lh)]; ok && p.dupes != api.DuplicatesAllow {
+		return seq, ErrDupeLeaf
+	}
+	seq := p.r.End()
+	if err := p.r.Append(lh, nil); err != nil {
+		return 0, err
+	}
+	if _, ok := p.seen[string(lh)]; !ok {
+		p.seen[string(lh)] = seq
+	}
+	return seq, nil
+}
+
+// Checkpoint returns the size and root hash of the tree of the entries added
+// so far, with the given origin.
+func (p *Reproducer) Checkpoint(origin string) (log.Checkpoint, error) {
+	cp := log.Checkpoint{Origin: origin, Size: p.r.End(), Hash: p.h.EmptyRoot()}
+	if cp.Size == 0 {
+		return cp, nil
+	}
+	root, err := p.r.GetRootHash(nil)
+	if err != nil {
+		return log.Checkpoint{}, fmt.Errorf("failed to compute root: %w", err)
+	}
+	cp.Hash = root
+	return cp, nil
+}
+
+// VerifyReproduction checks that got, the checkpoint of a reproduced tree,
+// matches published, the log's checkpoint. If published is of a larger tree
+// and extended is true, got need only be consistent with it, which is
+// verified using proofs built from the log's tiles read with f, showing that
+// the log began with exactly the reproduced entries.
+func VerifyReproduction(ctx context.Context, h merkle.LogHasher, f client.Fetcher, got, published log.Checkpoint, extended bool) error {
+	switch {
+	case got.Size == published.Size:
+		if !bytes.Equal(got.Hash, published.Hash) {
+			return fmt.Errorf("reproduced root %x doesn't match the published root %x of the tree of size %d: %w", got.Hash, published.Hash, got.Size, ErrInconsistentTree)
+		}
+		return nil
+	case got.Size > published.Size:
+		return fmt.Errorf("reproduced tree of size %d is larger than the published tree of size %d", got.Size, published.Size)
+	case !extended:
+		return fmt.Errorf("reproduced tree of size %d is smaller than the published tree of size %d", got.Size, published.Size)
+	}
+	if err := client.CheckConsistency(ctx, h, f, []log.Checkpoint{got, published}); err != nil {
+		return fmt.Errorf("reproduced tree of size %d isn't a prefix of the published tree of size %d: %w", got.Size, published.Size, err)
+	}
+	return nil
+}
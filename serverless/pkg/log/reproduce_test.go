@@ -0,0 +1,110 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+func TestReproduce(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	// The inputs include a duplicate, which the log doesn't add again.
+	inputs := [][]byte{[]byte("a"), []byte("b"), []byte("a"), []byte("c")}
+	for i := 0; i < 300; i++ {
+		inputs = append(inputs, []byte(fmt.Sprintf("leaf %d", i)))
+	}
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, e := range inputs {
+		if _, err := log.SequenceEntry(ctx, st, h, e, log.SequenceOpts{}); err != nil {
+			t.Fatalf("SequenceEntry: %v", err)
+		}
+	}
+	published, err := log.Integrate(ctx, fmtlog.Checkpoint{Hash: h.EmptyRoot()}, st, h)
+	if err != nil {
+		t.Fatalf("Integrate: %v", err)
+	}
+	f := client.NewFSFetcher(os.DirFS(root))
+
+	reproduce := func(t *testing.T, dupes api.DuplicatePolicy, entries [][]byte) fmtlog.Checkpoint {
+		t.Helper()
+		p, err := log.NewReproducer(h, dupes)
+		if err != nil {
+			t.Fatalf("NewReproducer: %v", err)
+		}
+		for _, e := range entries {
+			if _, err := p.Add(e); err != nil && !errors.Is(err, log.ErrDupeLeaf) {
+				t.Fatalf("Add: %v", err)
+			}
+		}
+		cp, err := p.Checkpoint("")
+		if err != nil {
+			t.Fatalf("Checkpoint: %v", err)
+		}
+		return cp
+	}
+	swapped := append([][]byte{inputs[1], inputs[0]}, inputs[2:]...)
+	for _, test := range []struct {
+		desc     string
+		dupes    api.DuplicatePolicy
+		entries  [][]byte
+		extended bool
+		wantErr  bool
+	}{
+		{desc: "all inputs", entries: inputs},
+		{desc: "prefix", entries: inputs[:100], extended: true},
+		{desc: "prefix not allowed", entries: inputs[:100], wantErr: true},
+		{desc: "reordered", entries: swapped, wantErr: true},
+		{desc: "reordered prefix", entries: swapped[:100], extended: true, wantErr: true},
+		{desc: "duplicates allowed", dupes: api.DuplicatesAllow, entries: inputs, extended: true, wantErr: true},
+		{desc: "extra input", entries: append(inputs[:len(inputs):len(inputs)], []byte("d")), extended: true, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got := reproduce(t, test.dupes, test.entries)
+			err := log.VerifyReproduction(ctx, h, f, got, *published, test.extended)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("VerifyReproduction: %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+
+	p, err := log.NewReproducer(h, "")
+	if err != nil {
+		t.Fatalf("NewReproducer: %v", err)
+	}
+	pad, err := api.NewPaddingEntry()
+	if err != nil {
+		t.Fatalf("NewPaddingEntry: %v", err)
+	}
+	if _, err := p.Add(pad); !errors.Is(err, log.ErrPaddingEntry) {
+		t.Errorf("Add(padding) = %v, want %v", err, log.ErrPaddingEntry)
+	}
+}
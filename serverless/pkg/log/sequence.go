@@ -0,0 +1,250 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/internal/keys"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+
+	i_note "github.com/google/trillian-examples/internal/note"
+)
+
+// SequenceStorage represents the set of functions needed to sequence entries
+// and associate them with application identifiers.
+type SequenceStorage interface {
+	// Sequence is as for Storage.
+	Sequence(ctx context.Context, leafhash []byte, leaf []byte) (uint64, error)
+
+	RequestSequencer
+
+	// LookupIndex is as for LeafIndexer.
+	LookupIndex(ctx context.Context, leafhash []byte) (uint64, error)
+
+	// SetIdentifiers records the application identifiers associated with the
+	// entry with the given leaf hash.
+	SetIdentifiers(ctx context.Context, leafhash []byte, ids []string) error
+
+	// SetClaim records the signed claim to the identifiers associated with
+	// the entry with the given leaf hash.
+	SetClaim(ctx context.Context, leafhash []byte, claim []byte) error
+
+	// SetContentType records the content type the entry with the given leaf
+	// hash is tagged with.
+	SetContentType(ctx context.Context, leafhash []byte, t string) error
+}
+
+// SequenceOpts configures SequenceEntry.
+type SequenceOpts struct {
+	// Origin is the origin of the log, which is committed to by claims.
+	Origin string
+	// RequestID, if set, is the ID of the submission, as checked by
+	// api.ValidateRequestID, so that retrying it returns the original
+	// sequence number rather than adding the entry again.
+	RequestID string
+	// Identifiers are the application identifiers to associate with the
+	// entry, if any.
+	Identifiers []string
+	// Namespaces, if set, is the log's namespace registry, which the claim to
+	// Identifiers must satisfy.
+	Namespaces *api.Namespaces
+	// ClaimSigners are the keys of the owners of registered namespaces used
+	// by Identifiers, with which the claim to them is signed.
+	ClaimSigners []note.Signer
+	// ContentType, if set, is the content type to tag the entry with. The
+	// entry is validated by the handler registered for the type, if any, and
+	// associated with the identifiers it derives from the entry as well as
+	// with Identifiers. Callers should check that the log's manifest
+	// accepts the type.
+	ContentType string
+	// Submitter, if set, is the identity of the authenticated submitter of
+	// the entry, as checked by api.ValidateSubmitter, which is recorded in
+	// the storage's audit log of submissions. The storage must implement
+	// SubmitterStorage.
+	Submitter string
+}
+
+// Sequenced is the result of sequencing an entry.
+type Sequenced struct {
+	// Seq is the sequence number assigned to the entry.
+	Seq uint64
+	// Dupe is true if the entry was a duplicate of one already sequenced,
+	// and Seq is that of the earlier instance.
+	Dupe bool
+	// IdentifiersSkipped is true if the entry had already been added to the
+	// log, so wasn't associated with the identifiers.
+	IdentifiersSkipped bool
+}
+
+// LoadVerifier returns the verifier of the log's public key, read from the
+// location path, as for keys.Read, or, if path is empty, from the environment
+// variable env.
+func LoadVerifier(path, env string) (note.Verifier, error) {
+	pubKey, err := keys.Get(context.Background(), path, env)
+	if err != nil {
+		return nil, err
+	}
+	v, err := i_note.NewVerifierForKey(strings.TrimSpace(pubKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate verifier: %w", err)
+	}
+	return v, nil
+}
+
+// AssociateIdentifiers associates the entry with the given leaf hash with the
+// application identifiers in opts, signing the claim to them with
+// opts.ClaimSigners and checking it against opts.Namespaces. It must be
+// called before the entry is sequenced, since it may be integrated as soon as
+// it is. Returns false without changing anything if the entry has already
+// been added to the log, since its identifiers can then no longer change.
+//
+// If st detects duplicates per namespace, as described by NamespaceSequencer,
+// the claim is checked even if the entry has already been added, since it may
+// be added again with these identifiers.
+func AssociateIdentifiers(ctx context.Context, st SequenceStorage, leafhash []byte, opts SequenceOpts) (bool, error) {
+	if len(opts.Identifiers) == 0 {
+		return true, nil
+	}
+	perNamespace := duplicatesPerNamespace(st)
+	if !perNamespace {
+		if added, err := isAdded(ctx, st, leafhash); err != nil || added {
+			return false, err
+		}
+	}
+	var claim []byte
+	if len(opts.ClaimSigners) > 0 {
+		c := api.Claim{Origin: opts.Origin, LeafHash: leafhash, Identifiers: opts.Identifiers}
+		var err error
+		if claim, err = note.Sign(&note.Note{Text: string(c.Marshal())}, opts.ClaimSigners...); err != nil {
+			return false, fmt.Errorf("failed to sign claim: %w", err)
+		}
+	}
+	if opts.Namespaces != nil {
+		if err := opts.Namespaces.VerifyClaim(leafhash, opts.Identifiers, claim); err != nil {
+			return false, fmt.Errorf("not allowed to associate entry with identifiers: %w", err)
+		}
+	}
+	if perNamespace {
+		if added, err := isAdded(ctx, st, leafhash); err != nil || added {
+			return false, err
+		}
+	}
+	// The claim is recorded first, so that the identifiers are never present
+	// without it.
+	if len(claim) > 0 {
+		if err := st.SetClaim(ctx, leafhash, claim); err != nil {
+			return false, fmt.Errorf("failed to record claim: %w", err)
+		}
+	}
+	if err := st.SetIdentifiers(ctx, leafhash, opts.Identifiers); err != nil {
+		return false, fmt.Errorf("failed to set identifiers: %w", err)
+	}
+	return true, nil
+}
+
+// isAdded returns true if the entry with the given leaf hash has already been
+// added to the log.
+func isAdded(ctx context.Context, st SequenceStorage, leafhash []byte) (bool, error) {
+	if _, err := st.LookupIndex(ctx, leafhash); err == nil {
+		return true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to look up entry: %w", err)
+	}
+	return false, nil
+}
+
+// duplicatesPerNamespace returns true if st detects duplicates per namespace,
+// as described by NamespaceSequencer.
+func duplicatesPerNamespace(st SequenceStorage) bool {
+	ns, ok := st.(NamespaceSequencer)
+	return ok && ns.DuplicatesPerNamespace()
+}
+
+// SequenceEntry associates entry with the identifiers in opts, as for
+// AssociateIdentifiers, and then assigns it a sequence number in st. It's
+// the library equivalent of the sequence command, for services which add
+// entries to a log themselves.
+//
+// If opts.Submitter is set, the submission is recorded in the storage's audit
+// log of submitters once the entry is sequenced.
+//
+// Duplicate entries aren't an error, but are reported in the result. Entries
+// which aren't valid content of opts.ContentType are rejected with an error
+// wrapping ErrInvalidContent.
+//
+// If st detects duplicates per namespace, as described by NamespaceSequencer,
+// the entry is sequenced with its identifiers, so an entry which has already
+// been added may be added again, associated with them.
+func SequenceEntry(ctx context.Context, st SequenceStorage, h merkle.LogHasher, entry []byte, opts SequenceOpts) (Sequenced, error) {
+	var r Sequenced
+	lh := h.HashLeaf(entry)
+	ss, recordsSubmitters := st.(SubmitterStorage)
+	if len(opts.Submitter) > 0 {
+		if err := api.ValidateSubmitter(opts.Submitter); err != nil {
+			return r, err
+		}
+		if !recordsSubmitters {
+			return r, fmt.Errorf("storage %T doesn't record submitters", st)
+		}
+	}
+	ids, err := HandleContent(opts.ContentType, entry, opts.Identifiers)
+	if err != nil {
+		return r, err
+	}
+	opts.Identifiers = ids
+	ok, err := AssociateIdentifiers(ctx, st, lh, opts)
+	if err != nil {
+		return r, err
+	}
+	r.IdentifiersSkipped = !ok
+	if len(opts.ContentType) > 0 {
+		if err := st.SetContentType(ctx, lh, opts.ContentType); err != nil {
+			return r, fmt.Errorf("failed to set content type: %w", err)
+		}
+	}
+	perNamespace := duplicatesPerNamespace(st)
+	switch {
+	case perNamespace:
+		r.Seq, err = st.(NamespaceSequencer).SequenceIdentified(ctx, opts.RequestID, lh, entry, opts.Identifiers)
+	case len(opts.RequestID) > 0:
+		r.Seq, err = st.SequenceRequest(ctx, opts.RequestID, lh, entry)
+	default:
+		r.Seq, err = st.Sequence(ctx, lh, entry)
+	}
+	if errors.Is(err, ErrDupeLeaf) {
+		r.Dupe = true
+	} else if err != nil {
+		return r, fmt.Errorf("failed to sequence entry: %w", err)
+	}
+	if perNamespace && !r.Dupe {
+		// The new instance is associated with its own identifiers.
+		r.IdentifiersSkipped = false
+	}
+	// Duplicates are recorded too, since repeated submissions of the same
+	// entry may themselves be abuse.
+	if len(opts.Submitter) > 0 {
+		if err := RecordSubmission(ctx, ss, opts.Submitter, lh, r.Seq); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
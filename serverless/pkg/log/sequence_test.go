@@ -0,0 +1,257 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestLoadVerifier(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pub")
+	if err := os.WriteFile(keyFile, []byte(vkey+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	const env = "SERVERLESS_TEST_LOG_PUBLIC_KEY"
+	for _, test := range []struct {
+		desc    string
+		path    string
+		envVal  string
+		wantErr bool
+	}{
+		{desc: "file", path: keyFile},
+		{desc: "env", envVal: vkey},
+		{desc: "file wins", path: keyFile, envVal: "nonsense"},
+		{desc: "neither", wantErr: true},
+		{desc: "missing file", path: keyFile + ".missing", wantErr: true},
+		{desc: "private key", envVal: skey, wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			t.Setenv(env, test.envVal)
+			v, err := log.LoadVerifier(test.path, env)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("LoadVerifier: %v, want error %t", err, test.wantErr)
+			}
+			if v != nil && v.Name() != "log" {
+				t.Errorf("LoadVerifier returned verifier for %q, want %q", v.Name(), "log")
+			}
+		})
+	}
+}
+
+func TestSequenceEntry(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	owner, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	ns := &api.Namespaces{Origin: "My Log", Owners: map[string]api.NamespaceOwner{"example.com": {Key: vkey}}}
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	exists := func(dir, file string) bool {
+		_, err := os.Stat(filepath.Join(dir, file))
+		return err == nil
+	}
+
+	// An identifier in a registered namespace needs a claim signed by the
+	// owner, so the entry isn't sequenced without one.
+	opts := log.SequenceOpts{Origin: "My Log", Identifiers: []string{"example.com/a"}, Namespaces: ns}
+	if _, err := log.SequenceEntry(ctx, st, h, []byte("a"), opts); err == nil {
+		t.Fatal("SequenceEntry without a claim signer succeeded, want error")
+	}
+	if exists(layout.IdentifiersPath(root, h.HashLeaf([]byte("a")))) {
+		t.Error("Identifiers recorded for rejected entry")
+	}
+
+	opts.ClaimSigners = []note.Signer{owner}
+	r, err := log.SequenceEntry(ctx, st, h, []byte("a"), opts)
+	if err != nil {
+		t.Fatalf("SequenceEntry: %v", err)
+	}
+	if want := (log.Sequenced{Seq: 0}); r != want {
+		t.Errorf("SequenceEntry = %+v, want %+v", r, want)
+	}
+	lh := h.HashLeaf([]byte("a"))
+	if !exists(layout.ClaimPath(root, lh)) {
+		t.Error("Claim not recorded")
+	}
+	if !exists(layout.IdentifiersPath(root, lh)) {
+		t.Error("Identifiers not recorded")
+	}
+
+	// Once sequenced, the entry's identifiers can't change.
+	r, err = log.SequenceEntry(ctx, st, h, []byte("a"), log.SequenceOpts{Origin: "My Log", Identifiers: []string{"example.org/a"}, Namespaces: ns})
+	if err != nil {
+		t.Fatalf("SequenceEntry of dupe: %v", err)
+	}
+	if want := (log.Sequenced{Seq: 0, Dupe: true, IdentifiersSkipped: true}); r != want {
+		t.Errorf("SequenceEntry of dupe = %+v, want %+v", r, want)
+	}
+
+	// Retrying a request returns the original sequence number.
+	opts = log.SequenceOpts{RequestID: "req-1"}
+	for i := 0; i < 2; i++ {
+		r, err := log.SequenceEntry(ctx, st, h, []byte("b"), opts)
+		if err != nil {
+			t.Fatalf("SequenceEntry with request ID: %v", err)
+		}
+		if r.Seq != 1 {
+			t.Errorf("SequenceEntry with request ID, attempt %d = %d, want 1", i, r.Seq)
+		}
+	}
+}
+
+func TestSequenceEntryPerNamespace(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "tenant-a")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	owner, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	ns := &api.Namespaces{Origin: "My Log", Owners: map[string]api.NamespaceOwner{"tenant-a": {Key: vkey}}}
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	st.SetDuplicatePolicy(api.DuplicatesPerNamespace)
+
+	opts := log.SequenceOpts{Origin: "My Log", Identifiers: []string{"tenant-b/app"}, Namespaces: ns}
+	if r, err := log.SequenceEntry(ctx, st, h, []byte("a"), opts); err != nil || r != (log.Sequenced{Seq: 0}) {
+		t.Fatalf("SequenceEntry = %+v, %v, want entry 0", r, err)
+	}
+	// The same entry is added again in another namespace, but only with the
+	// claim its owner requires.
+	opts.Identifiers = []string{"tenant-a/app"}
+	if _, err := log.SequenceEntry(ctx, st, h, []byte("a"), opts); err == nil {
+		t.Fatal("SequenceEntry without a claim signer succeeded, want error")
+	}
+	opts.ClaimSigners = []note.Signer{owner}
+	if r, err := log.SequenceEntry(ctx, st, h, []byte("a"), opts); err != nil || r != (log.Sequenced{Seq: 1}) {
+		t.Errorf("SequenceEntry in another namespace = %+v, %v, want entry 1", r, err)
+	}
+	want := log.Sequenced{Seq: 1, Dupe: true, IdentifiersSkipped: true}
+	if r, err := log.SequenceEntry(ctx, st, h, []byte("a"), opts); err != nil || r != want {
+		t.Errorf("SequenceEntry in the same namespace = %+v, %v, want %+v", r, err, want)
+	}
+}
+
+func TestSequenceEntrySubmitter(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, e := range []struct {
+		entry, submitter string
+	}{
+		{entry: "a", submitter: "key-1"},
+		{entry: "b", submitter: "key-2"},
+		// Duplicates are recorded against the submitter too.
+		{entry: "a", submitter: "key-2"},
+	} {
+		if _, err := log.SequenceEntry(ctx, st, h, []byte(e.entry), log.SequenceOpts{Submitter: e.submitter}); err != nil {
+			t.Fatalf("SequenceEntry: %v", err)
+		}
+	}
+	subs, err := st.Submissions(ctx, "key-2", time.Time{}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Submissions: %v", err)
+	}
+	var seqs []uint64
+	for _, s := range subs {
+		seqs = append(seqs, s.Seq)
+	}
+	if diff := cmp.Diff(seqs, []uint64{1, 0}); diff != "" {
+		t.Errorf("Submissions had diff (-got +want):\n%s", diff)
+	}
+	if got, err := st.EntrySubmitter(ctx, 0); err != nil || got != "key-1" {
+		t.Errorf("EntrySubmitter(0) = %q, %v, want %q", got, err, "key-1")
+	}
+
+	if _, err := log.SequenceEntry(ctx, st, h, []byte("c"), log.SequenceOpts{Submitter: "two\nlines"}); err == nil {
+		t.Error("SequenceEntry with invalid submitter succeeded")
+	}
+	// Storage which can't record the submitter mustn't sequence the entry.
+	if _, err := log.SequenceEntry(ctx, struct{ log.SequenceStorage }{st}, h, []byte("c"), log.SequenceOpts{Submitter: "key-1"}); err == nil {
+		t.Error("SequenceEntry with submitter to storage without an audit log succeeded")
+	}
+	if _, err := st.LookupIndex(ctx, h.HashLeaf([]byte("c"))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LookupIndex of rejected entry = %v, want ErrNotExist", err)
+	}
+}
+
+func TestSequenceEntryContentType(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	opts := log.SequenceOpts{ContentType: api.ContentTypeInToto, Identifiers: []string{"release/v1"}}
+	if _, err := log.SequenceEntry(ctx, st, h, []byte("not a statement"), opts); !errors.Is(err, log.ErrInvalidContent) {
+		t.Fatalf("SequenceEntry of invalid content = %v, want ErrInvalidContent", err)
+	}
+
+	entry := []byte(`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"a","digest":{"sha256":"abcd"}}],"predicateType":"https://slsa.dev/provenance/v1"}`)
+	if _, err := log.SequenceEntry(ctx, st, h, entry, opts); err != nil {
+		t.Fatalf("SequenceEntry: %v", err)
+	}
+	lh := h.HashLeaf(entry)
+	raw, err := os.ReadFile(filepath.Join(layout.ContentTypePath(root, lh)))
+	if err != nil {
+		t.Fatalf("Content type not recorded: %v", err)
+	}
+	if got, want := string(raw), api.ContentTypeInToto+"\n"; got != want {
+		t.Errorf("Recorded content type %q, want %q", got, want)
+	}
+	raw, err = os.ReadFile(filepath.Join(layout.IdentifiersPath(root, lh)))
+	if err != nil {
+		t.Fatalf("Identifiers not recorded: %v", err)
+	}
+	if got, want := string(raw), "release/v1\nsha256:abcd\n"; got != want {
+		t.Errorf("Recorded identifiers %q, want %q", got, want)
+	}
+}
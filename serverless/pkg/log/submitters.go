@@ -0,0 +1,59 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+// SubmitterStorage is an optional interface which may be implemented by
+// Storage implementations which keep an audit log of who submitted each entry,
+// so that the operator can investigate abuse of authenticated submission.
+// The audit log isn't part of the published log.
+type SubmitterStorage interface {
+	// RecordSubmission records that the submitter with the given identity,
+	// as checked by api.ValidateSubmitter, made the submission r. The
+	// submitter of the entry is only recorded by the first call for its
+	// sequence number, so that submitting a duplicate doesn't change who
+	// added it, but every submission is in the submitter's audit log.
+	RecordSubmission(ctx context.Context, submitter string, r api.SubmissionRecord) error
+
+	// Submissions returns the records of the submissions made by the
+	// submitter with the given identity at or after from and before to,
+	// oldest first.
+	Submissions(ctx context.Context, submitter string, from, to time.Time) ([]api.SubmissionRecord, error)
+
+	// EntrySubmitter returns the identity of the submitter who added the
+	// entry with the given sequence number. If it wasn't recorded, the
+	// error wraps os.ErrNotExist.
+	EntrySubmitter(ctx context.Context, seq uint64) (string, error)
+}
+
+// timeNow is the clock submissions are recorded with, replaced in tests.
+var timeNow = time.Now
+
+// RecordSubmission records that the submitter with the given identity
+// submitted the entry with the given leaf hash, which was assigned seq, now.
+func RecordSubmission(ctx context.Context, st SubmitterStorage, submitter string, leafhash []byte, seq uint64) error {
+	r := api.SubmissionRecord{Time: timeNow(), Seq: seq, LeafHash: leafhash}
+	if err := st.RecordSubmission(ctx, submitter, r); err != nil {
+		return fmt.Errorf("failed to record submitter of entry %d: %w", seq, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// TimestampStorage represents the set of functions needed to read the times
+// at which the entries of a log were sequenced.
+type TimestampStorage interface {
+	Storage
+
+	// SequencedTime returns the time at which the entry at sequence number
+	// seq was sequenced.
+	SequencedTime(ctx context.Context, seq uint64) (time.Time, error)
+}
+
+// TimestampLogStorage represents the set of functions needed to maintain the
+// timestamp log of a log.
+type TimestampLogStorage interface {
+	Storage
+
+	// SequenceAt stores the entry with the given leaf hash at sequence number
+	// seq, returning an error wrapping os.ErrExist if seq is already in use.
+	SequenceAt(ctx context.Context, seq uint64, leafhash []byte, leaf []byte) error
+}
+
+// UpdateTimestamps extends the timestamp log in tst, whose current checkpoint
+// is tcp, to record the time at which each of the first size entries of the
+// log in st was sequenced. Entry i of the timestamp log is the api.Timestamp
+// of entry i of the log, so a relying party can verify the sequencing time of
+// an entry against a checkpoint of the timestamp log in the same way as the
+// entry itself.
+//
+// Returns the updated checkpoint of the timestamp log, which the caller should
+// sign with the log's key, using the origin api.TimestampsOrigin, and store. If
+// the timestamp log already covers size entries, nil is returned.
+func UpdateTimestamps(ctx context.Context, h merkle.LogHasher, st TimestampStorage, tst TimestampLogStorage, tcp log.Checkpoint, size uint64) (*log.Checkpoint, error) {
+	if size <= tcp.Size {
+		return nil, nil
+	}
+	// Records which were sequenced before a failed update are left as they
+	// are: they were derived from the same entries, so are identical.
+	_, err := st.ScanSequenced(ctx, tcp.Size, func(seq uint64, entry []byte) error {
+		if seq >= size {
+			return errReachedSize
+		}
+		t, err := st.SequencedTime(ctx, seq)
+		if err != nil {
+			return err
+		}
+		r := api.Timestamp{Index: seq, LeafHash: h.HashLeaf(entry), Sequenced: t}.Marshal()
+		if err := tst.SequenceAt(ctx, seq, h.HashLeaf(r), r); err != nil && !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to sequence timestamp of entry %d: %w", seq, err)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errReachedSize) {
+		return nil, err
+	}
+	cp, err := IntegrateUpTo(ctx, tcp, tst, h, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to integrate timestamps: %w", err)
+	}
+	if cp == nil || cp.Size != size {
+		return nil, fmt.Errorf("log has fewer than %d entries to timestamp", size)
+	}
+	return cp, nil
+}
+
+// PublishTimestamps brings the timestamp log in tst, which is read with f, up
+// to date with the first size entries of the log with the given origin in st,
+// and signs and stores its new checkpoint with s. The current checkpoint of
+// the timestamp log must be signed by v.
+func PublishTimestamps(ctx context.Context, h merkle.LogHasher, st TimestampStorage, tst TimestampLogStorage, f client.Fetcher, s note.Signer, v note.Verifier, origin string, size uint64) error {
+	tOrigin := api.TimestampsOrigin(origin)
+	tcp, _, _, err := client.FetchCheckpoint(ctx, f, v, tOrigin)
+	if err != nil {
+		return fmt.Errorf("failed to read timestamp log checkpoint: %w", err)
+	}
+	newTcp, err := UpdateTimestamps(ctx, h, st, tst, *tcp, size)
+	if err != nil || newTcp == nil {
+		return err
+	}
+	newTcp.Origin = tOrigin
+	raw, err := note.Sign(&note.Note{Text: string(newTcp.Marshal())}, s)
+	if err != nil {
+		return fmt.Errorf("failed to sign timestamp log checkpoint: %w", err)
+	}
+	return tst.WriteCheckpoint(ctx, raw)
+}
+
+// SignCheckpointTime returns the api.CheckpointTime stating that cp was the
+// log's latest checkpoint at now, signed with the log's timestamping key s,
+// for storing at layout.CheckpointTimePath. It should be signed again from
+// time to time while the log doesn't grow, to show that it's still current.
+func SignCheckpointTime(cp log.Checkpoint, s note.Signer, now time.Time) ([]byte, error) {
+	ct := api.CheckpointTime{Origin: cp.Origin, Size: cp.Size, Hash: cp.Hash, Time: now}
+	raw, err := note.Sign(&note.Note{Text: string(ct.Marshal())}, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint time: %w", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/api/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/pkg/log"
+	fmtlog "github.com/transparency-dev/formats/log"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestUpdateTimestamps(t *testing.T) {
+	ctx := context.Background()
+	h := rfc6962.DefaultHasher
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	tst, err := fs.Create(filepath.Join(root, layout.TimestampsDir))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	start := time.Now()
+	const size = 20
+	for i := 0; i < size; i++ {
+		l := []byte(fmt.Sprintf("leaf %d", i))
+		if _, err := st.Sequence(ctx, h.HashLeaf(l), l); err != nil {
+			t.Fatalf("Sequence: %v", err)
+		}
+	}
+	end := time.Now()
+
+	tcp := fmtlog.Checkpoint{Hash: h.EmptyRoot()}
+	for _, want := range []uint64{7, 7, size} {
+		cp, err := log.UpdateTimestamps(ctx, h, st, tst, tcp, want)
+		if err != nil {
+			t.Fatalf("UpdateTimestamps(%d): %v", want, err)
+		}
+		if want == tcp.Size {
+			if cp != nil {
+				t.Errorf("UpdateTimestamps(%d) = %+v, want nil", want, cp)
+			}
+			continue
+		}
+		if cp.Size != want {
+			t.Fatalf("UpdateTimestamps(%d) returned size %d", want, cp.Size)
+		}
+		tcp = *cp
+	}
+	tcp.Origin = api.TimestampsOrigin("My Log")
+	raw, err := note.Sign(&note.Note{Text: string(tcp.Marshal())}, s)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := tst.WriteCheckpoint(ctx, raw); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+
+	f := client.NewFSFetcher(os.DirFS(root))
+	for i := uint64(0); i < size; i++ {
+		lh := h.HashLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+		ts, err := client.FetchTimestamp(ctx, f, h, v, "My Log", i, lh)
+		if err != nil {
+			t.Fatalf("FetchTimestamp(%d): %v", i, err)
+		}
+		if ts.Sequenced.Before(start) || ts.Sequenced.After(end) {
+			t.Errorf("Entry %d sequenced at %v, want between %v and %v", i, ts.Sequenced, start, end)
+		}
+	}
+
+	if _, err := log.UpdateTimestamps(ctx, h, st, tst, tcp, size+1); err == nil {
+		t.Error("UpdateTimestamps beyond the sequenced entries succeeded, want error")
+	}
+}
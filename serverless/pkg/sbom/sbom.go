@@ -0,0 +1,278 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sbom parses software bills of materials in the JSON forms of SPDX
+// and CycloneDX, so that logs of them can be indexed by the digests and
+// package URLs of the software they describe and contain.
+package sbom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+// SBOM is the part of a bill of materials used to index it.
+type SBOM struct {
+	// ContentType is the content type of the SBOM's format,
+	// api.ContentTypeSPDX or api.ContentTypeCycloneDX.
+	ContentType string
+	// Name is the name of the document, or of the component it describes.
+	Name string
+	// Subjects are the components the SBOM describes, e.g. the artifact it
+	// was generated for.
+	Subjects []Component
+	// Components are the other components it lists, e.g. the packages the
+	// subjects depend on, and the files they're made of.
+	Components []Component
+}
+
+// Component is a package or file listed in an SBOM.
+type Component struct {
+	Name    string
+	Version string
+	// PURL is the component's package URL, if it has one.
+	PURL string
+	// Digests are the identifiers of the component's digests, as returned
+	// by api.DigestIdentifier.
+	Digests []string
+}
+
+// Parse parses raw as an SBOM in either format.
+func Parse(raw []byte) (*SBOM, error) {
+	var probe struct {
+		BOMFormat   string `json:"bomFormat"`
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(probe.BOMFormat) > 0:
+		return ParseCycloneDX(raw)
+	case len(probe.SPDXVersion) > 0:
+		return ParseSPDX(raw)
+	}
+	return nil, errors.New("not an SPDX or CycloneDX document")
+}
+
+// SubjectIdentifiers returns the identifiers of the digests of the SBOM's
+// subjects.
+func (s *SBOM) SubjectIdentifiers() []string {
+	var ids []string
+	for _, c := range s.Subjects {
+		ids = append(ids, c.Digests...)
+	}
+	return dedupe(ids)
+}
+
+// Identifiers returns the identifiers of the digests and package URLs of all
+// the components of the SBOM, subjects first. Package URLs which aren't valid
+// identifiers, e.g. because they're too long, are left out.
+func (s *SBOM) Identifiers() []string {
+	var ids []string
+	for _, c := range append(append([]Component(nil), s.Subjects...), s.Components...) {
+		ids = append(ids, c.Digests...)
+		if len(c.PURL) > 0 && api.ValidateIdentifier(c.PURL) == nil {
+			ids = append(ids, c.PURL)
+		}
+	}
+	return dedupe(ids)
+}
+
+// Mentions returns true if any component of the SBOM has the given
+// identifier, as returned by Identifiers.
+func (s *SBOM) Mentions(id string) bool {
+	for _, i := range s.Identifiers() {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe returns ids without duplicates, in the order they first appear.
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool)
+	var r []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// cdxComponent is a CycloneDX component, which may contain others.
+type cdxComponent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	PURL    string `json:"purl"`
+	Hashes  []struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	} `json:"hashes"`
+	Components []cdxComponent `json:"components"`
+}
+
+// ParseCycloneDX parses raw as a CycloneDX BOM in JSON form. Its subject is
+// the component in its metadata.
+func ParseCycloneDX(raw []byte) (*SBOM, error) {
+	var b struct {
+		BOMFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+		Metadata    struct {
+			Component *cdxComponent `json:"component"`
+		} `json:"metadata"`
+		Components []cdxComponent `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, err
+	}
+	if b.BOMFormat != "CycloneDX" || len(b.SpecVersion) == 0 {
+		return nil, errors.New("not a CycloneDX BOM")
+	}
+	s := &SBOM{ContentType: api.ContentTypeCycloneDX}
+	if c := b.Metadata.Component; c != nil {
+		s.Name = c.Name
+		sub, err := cdxComponents([]cdxComponent{{Name: c.Name, Version: c.Version, PURL: c.PURL, Hashes: c.Hashes}})
+		if err != nil {
+			return nil, err
+		}
+		s.Subjects = sub
+		b.Components = append(b.Components, c.Components...)
+	}
+	var err error
+	if s.Components, err = cdxComponents(b.Components); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// cdxComponents flattens cs and the components they contain.
+func cdxComponents(cs []cdxComponent) ([]Component, error) {
+	var r []Component
+	for _, c := range cs {
+		comp := Component{Name: c.Name, Version: c.Version, PURL: c.PURL}
+		for _, h := range c.Hashes {
+			id, err := api.DigestIdentifier(h.Alg, h.Content)
+			if err != nil {
+				return nil, fmt.Errorf("component %q: %v", c.Name, err)
+			}
+			comp.Digests = append(comp.Digests, id)
+		}
+		sub, err := cdxComponents(c.Components)
+		if err != nil {
+			return nil, err
+		}
+		r = append(append(r, comp), sub...)
+	}
+	return r, nil
+}
+
+// spdxChecksum is an SPDX checksum of a package or file.
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+// ParseSPDX parses raw as an SPDX document in JSON form. Its subjects are the
+// packages the document describes, either with documentDescribes or with
+// DESCRIBES relationships.
+func ParseSPDX(raw []byte) (*SBOM, error) {
+	var d struct {
+		SPDXVersion       string   `json:"spdxVersion"`
+		SPDXID            string   `json:"SPDXID"`
+		Name              string   `json:"name"`
+		DocumentDescribes []string `json:"documentDescribes"`
+		Packages          []struct {
+			SPDXID       string         `json:"SPDXID"`
+			Name         string         `json:"name"`
+			VersionInfo  string         `json:"versionInfo"`
+			Checksums    []spdxChecksum `json:"checksums"`
+			ExternalRefs []struct {
+				ReferenceType    string `json:"referenceType"`
+				ReferenceLocator string `json:"referenceLocator"`
+			} `json:"externalRefs"`
+		} `json:"packages"`
+		Files []struct {
+			FileName  string         `json:"fileName"`
+			Checksums []spdxChecksum `json:"checksums"`
+		} `json:"files"`
+		Relationships []struct {
+			Element string `json:"spdxElementId"`
+			Type    string `json:"relationshipType"`
+			Related string `json:"relatedSpdxElement"`
+		} `json:"relationships"`
+	}
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(d.SPDXVersion, "SPDX-") {
+		return nil, errors.New("not an SPDX document")
+	}
+	described := make(map[string]bool)
+	for _, id := range d.DocumentDescribes {
+		described[id] = true
+	}
+	for _, r := range d.Relationships {
+		if r.Element == d.SPDXID && r.Type == "DESCRIBES" {
+			described[r.Related] = true
+		}
+	}
+	s := &SBOM{ContentType: api.ContentTypeSPDX, Name: d.Name}
+	for _, p := range d.Packages {
+		c := Component{Name: p.Name, Version: p.VersionInfo}
+		var err error
+		if c.Digests, err = spdxDigests(p.Checksums); err != nil {
+			return nil, fmt.Errorf("package %q: %v", p.Name, err)
+		}
+		for _, r := range p.ExternalRefs {
+			if r.ReferenceType == "purl" {
+				c.PURL = r.ReferenceLocator
+			}
+		}
+		if described[p.SPDXID] {
+			s.Subjects = append(s.Subjects, c)
+		} else {
+			s.Components = append(s.Components, c)
+		}
+	}
+	for _, f := range d.Files {
+		c := Component{Name: f.FileName}
+		var err error
+		if c.Digests, err = spdxDigests(f.Checksums); err != nil {
+			return nil, fmt.Errorf("file %q: %v", f.FileName, err)
+		}
+		s.Components = append(s.Components, c)
+	}
+	return s, nil
+}
+
+// spdxDigests returns the identifiers of the digests in cs.
+func spdxDigests(cs []spdxChecksum) ([]string, error) {
+	var ids []string
+	for _, c := range cs {
+		id, err := api.DigestIdentifier(c.Algorithm, c.ChecksumValue)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
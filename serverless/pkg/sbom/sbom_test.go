@@ -0,0 +1,129 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/pkg/sbom"
+)
+
+const (
+	cycloneDX = `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "metadata": {
+    "component": {"name": "app", "version": "1.0", "hashes": [{"alg": "SHA-256", "content": "aa"}]}
+  },
+  "components": [
+    {"name": "lib", "version": "2.0", "purl": "pkg:golang/example.com/lib@v2.0.0", "hashes": [{"alg": "SHA-256", "content": "bb"}],
+     "components": [{"name": "inner", "hashes": [{"alg": "SHA-512", "content": "cc"}]}]}
+  ]
+}`
+	spdx = `{
+  "spdxVersion": "SPDX-2.3",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "app-sbom",
+  "documentDescribes": ["SPDXRef-app"],
+  "packages": [
+    {"SPDXID": "SPDXRef-app", "name": "app", "versionInfo": "1.0", "checksums": [{"algorithm": "SHA256", "checksumValue": "aa"}]},
+    {"SPDXID": "SPDXRef-lib", "name": "lib", "versionInfo": "2.0", "checksums": [{"algorithm": "SHA1", "checksumValue": "bb"}],
+     "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:npm/lib@2.0"}]}
+  ],
+  "files": [{"fileName": "./main", "checksums": [{"algorithm": "SHA256", "checksumValue": "cc"}]}]
+}`
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		desc         string
+		raw          string
+		want         *sbom.SBOM
+		wantSubjects []string
+		wantIDs      []string
+		wantErr      bool
+	}{
+		{
+			desc: "CycloneDX",
+			raw:  cycloneDX,
+			want: &sbom.SBOM{
+				ContentType: api.ContentTypeCycloneDX,
+				Name:        "app",
+				Subjects:    []sbom.Component{{Name: "app", Version: "1.0", Digests: []string{"sha256:aa"}}},
+				Components: []sbom.Component{
+					{Name: "lib", Version: "2.0", PURL: "pkg:golang/example.com/lib@v2.0.0", Digests: []string{"sha256:bb"}},
+					{Name: "inner", Digests: []string{"sha512:cc"}},
+				},
+			},
+			wantSubjects: []string{"sha256:aa"},
+			wantIDs:      []string{"sha256:aa", "sha256:bb", "pkg:golang/example.com/lib@v2.0.0", "sha512:cc"},
+		}, {
+			desc: "SPDX",
+			raw:  spdx,
+			want: &sbom.SBOM{
+				ContentType: api.ContentTypeSPDX,
+				Name:        "app-sbom",
+				Subjects:    []sbom.Component{{Name: "app", Version: "1.0", Digests: []string{"sha256:aa"}}},
+				Components: []sbom.Component{
+					{Name: "lib", Version: "2.0", PURL: "pkg:npm/lib@2.0", Digests: []string{"sha1:bb"}},
+					{Name: "./main", Digests: []string{"sha256:cc"}},
+				},
+			},
+			wantSubjects: []string{"sha256:aa"},
+			wantIDs:      []string{"sha256:aa", "sha1:bb", "pkg:npm/lib@2.0", "sha256:cc"},
+		}, {
+			desc:    "bad digest",
+			raw:     `{"spdxVersion":"SPDX-2.3","packages":[{"name":"a","checksums":[{"algorithm":"SHA256","checksumValue":"nothex"}]}]}`,
+			wantErr: true,
+		}, {
+			desc:    "unknown format",
+			raw:     `{"_type":"https://in-toto.io/Statement/v1"}`,
+			wantErr: true,
+		}, {
+			desc:    "not JSON",
+			raw:     `SPDXVersion: SPDX-2.3`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := sbom.Parse([]byte(test.raw))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Parse: %v, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, got); len(diff) != 0 {
+				t.Errorf("Parse had diff %s", diff)
+			}
+			if diff := cmp.Diff(test.wantSubjects, got.SubjectIdentifiers()); len(diff) != 0 {
+				t.Errorf("SubjectIdentifiers had diff %s", diff)
+			}
+			if diff := cmp.Diff(test.wantIDs, got.Identifiers()); len(diff) != 0 {
+				t.Errorf("Identifiers had diff %s", diff)
+			}
+			for _, id := range test.wantIDs {
+				if !got.Mentions(id) {
+					t.Errorf("Mentions(%q) = false, want true", id)
+				}
+			}
+			if got.Mentions("sha256:ff") {
+				t.Error("Mentions(sha256:ff) = true, want false")
+			}
+		})
+	}
+}
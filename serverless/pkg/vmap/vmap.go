@@ -0,0 +1,196 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vmap provides a verifiable map, implemented as a sparse Merkle tree
+// of depth api.MapDepth keyed by api.HashSize byte keys.
+//
+// Leaves are hashed as SHA256(0x00 || key || SHA256(value)), and interior
+// nodes as SHA256(0x01 || left || right). The hash of an empty leaf is all
+// zeros, and the hash of an empty subtree is built from the hashes of its
+// empty children.
+package vmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+// emptyHashes holds the hash of an empty subtree of each height.
+var emptyHashes = func() [api.MapDepth + 1][]byte {
+	var e [api.MapDepth + 1][]byte
+	e[0] = make([]byte, api.HashSize)
+	for i := 1; i <= api.MapDepth; i++ {
+		e[i] = hashChildren(e[i-1], e[i-1])
+	}
+	return e
+}()
+
+// EmptyRoot returns the root hash of a map with no keys.
+func EmptyRoot() []byte {
+	return emptyHashes[api.MapDepth]
+}
+
+// HashLeaf returns the hash of the leaf storing value under key.
+func HashLeaf(key, value []byte) []byte {
+	vh := sha256.Sum256(value)
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(key)
+	h.Write(vh[:])
+	return h.Sum(nil)
+}
+
+func hashChildren(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+// bit returns the bit of key at the given depth, counting from the most
+// significant bit of the first byte.
+func bit(key []byte, depth int) uint8 {
+	return (key[depth/8] >> (7 - depth%8)) & 1
+}
+
+// Map is a snapshot of a verifiable map, holding its root hash and a proof
+// for each key it contains.
+type Map struct {
+	root   []byte
+	proofs map[string]*api.MapProof
+}
+
+type leaf struct {
+	key   []byte
+	hash  []byte
+	proof *api.MapProof
+}
+
+// New builds a map holding the given values, keyed by the string form of
+// their api.HashSize byte keys.
+func New(values map[string][]byte) (*Map, error) {
+	leaves := make([]leaf, 0, len(values))
+	for k, v := range values {
+		key := []byte(k)
+		if len(key) != api.HashSize {
+			return nil, fmt.Errorf("invalid key length %d", len(key))
+		}
+		leaves = append(leaves, leaf{
+			key:   key,
+			hash:  HashLeaf(key, v),
+			proof: &api.MapProof{Bitmap: make([]byte, api.MapDepth/8)},
+		})
+	}
+	sort.Slice(leaves, func(i, j int) bool { return bytes.Compare(leaves[i].key, leaves[j].key) < 0 })
+
+	m := &Map{
+		root:   build(0, leaves),
+		proofs: make(map[string]*api.MapProof, len(leaves)),
+	}
+	for _, l := range leaves {
+		// build adds siblings starting with the one nearest the leaf.
+		sib := l.proof.Siblings
+		for i, j := 0, len(sib)-1; i < j; i, j = i+1, j-1 {
+			sib[i], sib[j] = sib[j], sib[i]
+		}
+		m.proofs[string(l.key)] = l.proof
+	}
+	return m, nil
+}
+
+// build returns the hash of the subtree at the given depth containing the
+// given sorted leaves, and adds the siblings of the subtree's children to
+// the proofs of the leaves below them.
+func build(depth int, leaves []leaf) []byte {
+	if len(leaves) == 0 {
+		return emptyHashes[api.MapDepth-depth]
+	}
+	if depth == api.MapDepth {
+		return leaves[0].hash
+	}
+	i := sort.Search(len(leaves), func(i int) bool { return bit(leaves[i].key, depth) == 1 })
+	l, r := build(depth+1, leaves[:i]), build(depth+1, leaves[i:])
+	addSibling := func(leaves []leaf, sibling []byte) {
+		if bytes.Equal(sibling, emptyHashes[api.MapDepth-depth-1]) {
+			return
+		}
+		for _, lf := range leaves {
+			lf.proof.Bitmap[depth/8] |= 1 << (7 - depth%8)
+			lf.proof.Siblings = append(lf.proof.Siblings, sibling)
+		}
+	}
+	addSibling(leaves[:i], r)
+	addSibling(leaves[i:], l)
+	return hashChildren(l, r)
+}
+
+// Root returns the root hash of the map.
+func (m *Map) Root() []byte {
+	return m.root
+}
+
+// Proof returns the proof of the value stored under key, which must be
+// present in the map.
+func (m *Map) Proof(key []byte) (*api.MapProof, error) {
+	p, ok := m.proofs[string(key)]
+	if !ok {
+		return nil, fmt.Errorf("key %x is not in the map", key)
+	}
+	return p, nil
+}
+
+// ErrRootMismatch is returned by Verify if the proof doesn't lead to the
+// expected root hash.
+var ErrRootMismatch = errors.New("map root mismatch")
+
+// Verify checks that p proves that value is stored under key in the map with
+// the given root hash.
+func Verify(root, key, value []byte, p api.MapProof) error {
+	if len(key) != api.HashSize {
+		return fmt.Errorf("invalid key length %d", len(key))
+	}
+	if len(p.Bitmap) != api.MapDepth/8 {
+		return fmt.Errorf("invalid proof bitmap length %d", len(p.Bitmap))
+	}
+	h := HashLeaf(key, value)
+	s := len(p.Siblings)
+	for depth := api.MapDepth - 1; depth >= 0; depth-- {
+		sibling := emptyHashes[api.MapDepth-depth-1]
+		if bit(p.Bitmap, depth) == 1 {
+			if s == 0 {
+				return errors.New("proof has too few siblings")
+			}
+			s--
+			sibling = p.Siblings[s]
+		}
+		if bit(key, depth) == 0 {
+			h = hashChildren(h, sibling)
+		} else {
+			h = hashChildren(sibling, h)
+		}
+	}
+	if s != 0 {
+		return errors.New("proof has too many siblings")
+	}
+	if !bytes.Equal(h, root) {
+		return fmt.Errorf("%w: calculated %x, want %x", ErrRootMismatch, h, root)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func key(i int) []byte {
+	k := sha256.Sum256([]byte(fmt.Sprintf("key %d", i)))
+	return k[:]
+}
+
+func values(n int) map[string][]byte {
+	vs := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		vs[string(key(i))] = []byte(fmt.Sprintf("value %d", i))
+	}
+	return vs
+}
+
+func TestMap(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 100} {
+		t.Run(fmt.Sprintf("%d keys", n), func(t *testing.T) {
+			vs := values(n)
+			m, err := New(vs)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if n == 0 && !bytes.Equal(m.Root(), EmptyRoot()) {
+				t.Errorf("Root() = %x, want empty root %x", m.Root(), EmptyRoot())
+			}
+			for k, v := range vs {
+				p, err := m.Proof([]byte(k))
+				if err != nil {
+					t.Fatalf("Proof(%x): %v", k, err)
+				}
+				if err := Verify(m.Root(), []byte(k), v, *p); err != nil {
+					t.Errorf("Verify(%x): %v", k, err)
+				}
+				if err := Verify(m.Root(), []byte(k), []byte("other"), *p); !errors.Is(err, ErrRootMismatch) {
+					t.Errorf("Verify(%x) with wrong value: %v, want ErrRootMismatch", k, err)
+				}
+			}
+			if _, err := m.Proof(key(n)); err == nil {
+				t.Error("Proof of absent key succeeded")
+			}
+		})
+	}
+}
+
+func TestRootCommitsToValues(t *testing.T) {
+	vs := values(10)
+	m1, err := New(vs)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	vs[string(key(3))] = []byte("changed")
+	m2, err := New(vs)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if bytes.Equal(m1.Root(), m2.Root()) {
+		t.Error("changing a value didn't change the root")
+	}
+	delete(vs, string(key(3)))
+	m3, err := New(vs)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if bytes.Equal(m1.Root(), m3.Root()) || bytes.Equal(m2.Root(), m3.Root()) {
+		t.Error("removing a key didn't change the root")
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	vs := values(5)
+	m, err := New(vs)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	k := key(0)
+	p, err := m.Proof(k)
+	if err != nil {
+		t.Fatalf("Proof: %v", err)
+	}
+	for _, test := range []struct {
+		desc string
+		key  []byte
+		p    api.MapProof
+	}{
+		{desc: "short key", key: k[:31], p: *p},
+		{desc: "short bitmap", key: k, p: api.MapProof{Bitmap: p.Bitmap[:31], Siblings: p.Siblings}},
+		{desc: "missing sibling", key: k, p: api.MapProof{Bitmap: p.Bitmap, Siblings: p.Siblings[1:]}},
+		{desc: "extra sibling", key: k, p: api.MapProof{Bitmap: p.Bitmap, Siblings: append([][]byte{EmptyRoot()}, p.Siblings...)}},
+		{desc: "other key", key: key(1), p: *p},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := Verify(m.Root(), test.key, vs[string(k)], test.p); err == nil {
+				t.Error("Verify succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestNewInvalidKey(t *testing.T) {
+	if _, err := New(map[string][]byte{"short": nil}); err == nil {
+		t.Error("New with short key succeeded")
+	}
+}
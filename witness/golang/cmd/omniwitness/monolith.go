@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/google/trillian-examples/internal/kms"
 	"github.com/google/trillian-examples/witness/golang/internal/persistence"
 	"github.com/google/trillian-examples/witness/golang/internal/persistence/inmemory"
 	psql "github.com/google/trillian-examples/witness/golang/internal/persistence/sql"
@@ -40,6 +41,7 @@ var (
 
 	signingKey  = flag.String("private_key", "", "The note-compatible signing key to use")
 	verifierKey = flag.String("public_key", "", "The note-compatible verifier key to use")
+	kmsKey      = flag.String("kms_key", "", "URI of a KMS or HSM held signing key to use instead of --private_key, e.g. gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version> or dsm://<key name>")
 
 	githubUser  = flag.String("gh_user", "", "The github user account to propose witnessed PRs from")
 	githubEmail = flag.String("gh_email", "", "The email that witnessed checkopoint git commits should be done under")
@@ -60,7 +62,12 @@ func main() {
 		Timeout: *httpTimeout,
 	}
 
-	signer, err := note.NewSigner(*signingKey)
+	var signer note.Signer
+	if len(*kmsKey) > 0 {
+		signer, err = kms.NewSigner(ctx, *kmsKey, *verifierKey)
+	} else {
+		signer, err = note.NewSigner(*signingKey)
+	}
 	if err != nil {
 		glog.Exitf("Failed to init signer: %v", err)
 	}
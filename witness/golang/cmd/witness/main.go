@@ -23,6 +23,7 @@ import (
 	"os"
 
 	"github.com/golang/glog"
+	"github.com/google/trillian-examples/internal/kms"
 	"github.com/google/trillian-examples/witness/golang/cmd/witness/impl"
 	"golang.org/x/mod/sumdb/note"
 	"gopkg.in/yaml.v2"
@@ -33,15 +34,27 @@ var (
 	dbFile     = flag.String("db_file", ":memory:", "path to a file to be used as sqlite3 storage for checkpoints, e.g. /tmp/chkpts.db")
 	configFile = flag.String("config_file", "example_config.yaml", "path to a YAML config file that specifies the logs followed by this witness")
 	witnessSK  = flag.String("private_key", "", "private signing key for the witness")
+	witnessPK  = flag.String("public_key", "", "public key of the witness, needed with --kms_key")
+	kmsKey     = flag.String("kms_key", "", "URI of a KMS or HSM held signing key to use instead of --private_key, e.g. gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version> or dsm://<key name>")
 )
 
 func main() {
 	flag.Parse()
 
-	if *witnessSK == "" {
-		glog.Exit("--private_key must not be empty")
+	ctx := context.Background()
+	var signer note.Signer
+	var err error
+	switch {
+	case *kmsKey != "":
+		if *witnessPK == "" {
+			glog.Exit("--public_key must be set with --kms_key")
+		}
+		signer, err = kms.NewSigner(ctx, *kmsKey, *witnessPK)
+	case *witnessSK != "":
+		signer, err = note.NewSigner(*witnessSK)
+	default:
+		glog.Exit("One of --private_key or --kms_key must be set")
 	}
-	signer, err := note.NewSigner(*witnessSK)
 	if err != nil {
 		glog.Exitf("Error forming a signer: %v", err)
 	}
@@ -58,7 +71,6 @@ func main() {
 		glog.Exitf("Failed to parse config file as proper YAML: %v", err)
 	}
 
-	ctx := context.Background()
 	if err := impl.Main(ctx, impl.ServerOpts{
 		ListenAddr: *listenAddr,
 		DBFile:     *dbFile,